@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/spf13/cobra"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/towns-protocol/towns/core/config"
+	"github.com/towns-protocol/towns/core/node/auth"
+	"github.com/towns-protocol/towns/core/node/crypto"
+	"github.com/towns-protocol/towns/core/node/infra"
+	"github.com/towns-protocol/towns/core/node/logging"
+	"github.com/towns-protocol/towns/core/xchain/entitlement"
+)
+
+func runAuthSelfTest(ctx context.Context, cfg config.Config, canarySpaceId string) error {
+	metricsFactory := infra.NewMetricsFactory(prometheus.NewRegistry(), "", "")
+	ctx = logging.CtxWithLog(ctx, logging.DefaultLogger(zapcore.WarnLevel))
+
+	if canarySpaceId != "" {
+		cfg.BaseChain.EntitlementSelfTestSpaceId = canarySpaceId
+	}
+
+	baseChain, err := crypto.NewBlockchain(ctx, &cfg.BaseChain, nil, metricsFactory, nil)
+	if err != nil {
+		return err
+	}
+
+	riverChain, err := crypto.NewBlockchain(ctx, &cfg.RiverChain, nil, metricsFactory, nil)
+	if err != nil {
+		return err
+	}
+
+	chainConfig, err := crypto.NewOnChainConfig(
+		ctx, riverChain.Client, cfg.RegistryContract.Address, riverChain.InitialBlockNum, riverChain.ChainMonitor)
+	if err != nil {
+		return err
+	}
+
+	evaluator, err := entitlement.NewEvaluatorFromConfig(ctx, &cfg, chainConfig, metricsFactory, nil)
+	if err != nil {
+		return err
+	}
+
+	chainAuth, err := auth.NewChainAuth(
+		ctx,
+		baseChain,
+		nil,
+		evaluator,
+		&cfg.ArchitectContract,
+		0,
+		0,
+		0,
+		0,
+		nil,
+		metricsFactory,
+	)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = chainAuth.Close() }()
+
+	report, err := chainAuth.SelfTest(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, result := range report.Results {
+		status := "PASS"
+		if result.Skipped {
+			status = "SKIP"
+		} else if !result.Passed {
+			status = "FAIL"
+		}
+		fmt.Printf("%-4s %-30s %8v %s\n", status, result.Component, result.Duration.Round(time.Millisecond), result.Error)
+	}
+
+	if !report.Passed {
+		return fmt.Errorf("auth self-test failed")
+	}
+	fmt.Println("auth self-test passed")
+	return nil
+}
+
+func init() {
+	var canarySpaceId string
+
+	cmd := &cobra.Command{
+		Use:   "auth-self-test",
+		Short: "Check that the contracts, chains and caches used to evaluate entitlements are functional",
+		Long: "Probes the base chain, the wallet link contract, the canary space and each configured xchain " +
+			"client with the node configuration and reports the outcome per component.",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return runAuthSelfTest(cmd.Context(), *cmdConfig, canarySpaceId)
+		},
+	}
+	cmd.Flags().StringVar(
+		&canarySpaceId, "space", "", "Canary space whose entitlements are read, overrides the configured one")
+
+	rootCmd.AddCommand(cmd)
+}
@@ -19,15 +19,8 @@ import (
 	"github.com/towns-protocol/towns/core/xchain/entitlement"
 )
 
-func isEntitledForSpaceAndChannel(
-	ctx context.Context,
-	cfg config.Config,
-	spaceId shared.StreamId,
-	channelId shared.StreamId,
-	userId string,
-) error {
+func newIsEntitledChainAuth(ctx context.Context, cfg *config.Config) (auth.ChainAuth, error) {
 	metricsFactory := infra.NewMetricsFactory(prometheus.NewRegistry(), "", "")
-	ctx = logging.CtxWithLog(ctx, logging.DefaultLogger(zapcore.InfoLevel))
 	baseChain, err := crypto.NewBlockchain(
 		ctx,
 		&cfg.BaseChain,
@@ -36,7 +29,7 @@ func isEntitledForSpaceAndChannel(
 		nil,
 	)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	riverChain, err := crypto.NewBlockchain(
@@ -47,45 +40,68 @@ func isEntitledForSpaceAndChannel(
 		nil,
 	)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	chainConfig, err := crypto.NewOnChainConfig(
 		ctx, riverChain.Client, cfg.RegistryContract.Address, riverChain.InitialBlockNum, riverChain.ChainMonitor)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	evaluator, err := entitlement.NewEvaluatorFromConfig(
 		ctx,
-		&cfg,
+		cfg,
 		chainConfig,
 		metricsFactory,
 		nil,
 	)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	chainAuth, err := auth.NewChainAuth(
 		ctx,
 		baseChain,
+		nil,
 		evaluator,
 		&cfg.ArchitectContract,
 		20,
 		30000,
+		0,
+		0,
+		nil,
 		metricsFactory,
 	)
+	if err != nil {
+		return nil, err
+	}
+
+	return chainAuth, nil
+}
+
+func isEntitledForSpaceAndChannel(
+	ctx context.Context,
+	cfg config.Config,
+	spaceId shared.StreamId,
+	channelId shared.StreamId,
+	userId string,
+) error {
+	ctx = logging.CtxWithLog(ctx, logging.DefaultLogger(zapcore.InfoLevel))
+	chainAuth, err := newIsEntitledChainAuth(ctx, &cfg)
 	if err != nil {
 		return err
 	}
 
-	args := auth.NewChainAuthArgsForChannel(
+	args, err := auth.ParseChainAuthArgsForChannel(
 		spaceId,
 		channelId,
 		userId,
 		auth.PermissionRead,
 	)
+	if err != nil {
+		return err
+	}
 
 	isEntitledResult, err := chainAuth.IsEntitled(
 		ctx,
@@ -103,6 +119,66 @@ func isEntitledForSpaceAndChannel(
 	return nil
 }
 
+func simulateWalletSet(
+	ctx context.Context,
+	cfg config.Config,
+	spaceId shared.StreamId,
+	channelId shared.StreamId,
+	userId string,
+	permission auth.Permission,
+	wallets []common.Address,
+) error {
+	ctx = logging.CtxWithLog(ctx, logging.DefaultLogger(zapcore.InfoLevel))
+	chainAuth, err := newIsEntitledChainAuth(ctx, &cfg)
+	if err != nil {
+		return err
+	}
+	simulator, ok := chainAuth.(auth.WalletSetSimulator)
+	if !ok {
+		return fmt.Errorf("chain auth does not support wallet set simulation")
+	}
+
+	var args *auth.ChainAuthArgs
+	if channelId != (shared.StreamId{}) {
+		args, err = auth.ParseChainAuthArgsForChannel(spaceId, channelId, userId, permission)
+	} else {
+		args, err = auth.ParseChainAuthArgsForSpace(spaceId, userId, permission)
+	}
+	if err != nil {
+		return err
+	}
+
+	result, err := simulator.SimulateWalletSet(ctx, &cfg, args, wallets)
+	if err != nil {
+		return err
+	}
+
+	details := auth.DetailsOf(result)
+	fmt.Printf("User %v with wallets %v simulated for %v permission in\n", userId, wallets, permission)
+	fmt.Printf(" - space   %v\n", spaceId.String())
+	if channelId != (shared.StreamId{}) {
+		fmt.Printf(" - channel %v\n", channelId.String())
+	}
+	fmt.Printf("isEntitled: %v, reason: %v\n", result.IsEntitled(), result.Reason())
+	if details.SatisfiedBy != (common.Address{}) {
+		fmt.Printf("satisfiedBy: %v\n", details.SatisfiedBy)
+	}
+	if details.RuleDenial != nil {
+		fmt.Printf("ruleDenial: %v\n", details.RuleDenial)
+	}
+	return nil
+}
+
+func parseWalletAddr(raw string) (common.Address, error) {
+	addr := common.HexToAddress(raw)
+	// HexToAddress never fails, so convert the hex back to a raw string and see if the strings match,
+	// case-insensitively.
+	if !strings.EqualFold(addr.String(), raw) {
+		return common.Address{}, fmt.Errorf("invalid address for walletAddr: %v, decodes to %v", raw, addr.String())
+	}
+	return addr, nil
+}
+
 func init() {
 	isEntitledCmd := &cobra.Command{
 		Use:          "is-entitled",
@@ -132,18 +208,55 @@ func init() {
 			}
 
 			rawUserId := args[2]
-			addr := common.HexToAddress(rawUserId)
-			// HexToAddress never fails, so convert the hex back to a raw string and see if the strings match,
-			// case-insensitively.
-			if !strings.EqualFold(addr.String(), rawUserId) {
-				return fmt.Errorf("invalid address for walletAddr: %v, decodes to %v", rawUserId, addr.String())
+			if _, err := parseWalletAddr(rawUserId); err != nil {
+				return err
 			}
 
 			return isEntitledForSpaceAndChannel(cmd.Context(), *cmdConfig, spaceId, channelId, rawUserId)
 		},
 	}
 
+	var simulateChannel, simulatePermission string
+	simulateCmd := &cobra.Command{
+		Use:   "simulate <spaceId> <walletAddr> [linkedWalletAddr...]",
+		Short: "Determine if a user would be entitled to a space or channel with the given linked wallets",
+		Args:  cobra.MinimumNArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			spaceId, err := shared.StreamIdFromString(args[0])
+			if err != nil {
+				return fmt.Errorf("could not parse spaceId: %w", err)
+			}
+			var channelId shared.StreamId
+			if simulateChannel != "" {
+				if channelId, err = shared.StreamIdFromString(simulateChannel); err != nil {
+					return fmt.Errorf("could not parse channelId: %w", err)
+				}
+			}
+			permission, ok := auth.ParsePermission(simulatePermission)
+			if !ok {
+				return fmt.Errorf("unknown permission: %v", simulatePermission)
+			}
+			if _, err := parseWalletAddr(args[1]); err != nil {
+				return err
+			}
+			var wallets []common.Address
+			for _, raw := range args[2:] {
+				wallet, err := parseWalletAddr(raw)
+				if err != nil {
+					return err
+				}
+				wallets = append(wallets, wallet)
+			}
+
+			return simulateWalletSet(
+				cmd.Context(), *cmdConfig, spaceId, channelId, args[1], permission, wallets)
+		},
+	}
+	simulateCmd.Flags().StringVar(&simulateChannel, "channel", "", "Channel to simulate the check for")
+	simulateCmd.Flags().StringVar(&simulatePermission, "permission", auth.PermissionRead.String(), "Permission to check")
+
 	isEntitledCmd.AddCommand(isEntitledToChannelCmd)
+	isEntitledCmd.AddCommand(simulateCmd)
 	// isEntitledCmd.AddCommand(isEntitledToSpaceCmd)
 	rootCmd.AddCommand(isEntitledCmd)
 }
@@ -73,6 +73,7 @@ func runGetLinkedWalletsCmd(cmd *cobra.Command, args []string) error {
 	linkedWallets, err := evaluator.GetLinkedWallets(
 		ctx,
 		addr,
+		0,
 		walletLink,
 		nil,
 		nil,
@@ -192,6 +192,23 @@ type Config struct {
 	EntitlementContract ContractConfig `mapstructure:"entitlement_contract"`
 	// History indicates how far back xchain must look for entitlement check requests after start
 	History time.Duration
+
+	// DiskCache configures persistence of the entitlement caches across node restarts.
+	DiskCache DiskCacheConfig
+
+	// MaxConcurrentMembershipChecks caps the membership calls a single entitlement check makes concurrently,
+	// one per linked wallet of the principal. The calls of all checks are capped by
+	// BaseChain.EntitlementMaxConcurrentMembershipChecks. If unset or <= 0, 5 is used.
+	MaxConcurrentMembershipChecks int
+
+	// LinkedWalletsLimitByPermission overrides BaseChain.LinkedWalletsLimit for the checks of the given
+	// permissions, keyed by permission name such as "ModifySpaceSettings". Overrides may raise or lower the
+	// limit: linked wallets are looked up up to the highest of the limits.
+	LinkedWalletsLimitByPermission map[string]int `json:",omitempty"`
+
+	// EntitlementChainIds lists the chains besides the base chain that spaces live on, the entitlement checks of
+	// their spaces are evaluated on them. Their RPC endpoints are read from Chains.
+	EntitlementChainIds []uint64 `json:",omitempty"`
 }
 
 type TLSConfig struct {
@@ -308,6 +325,137 @@ type ChainConfig struct {
 	NegativeEntitlementManagerCacheTTLSeconds int `json:",omitempty"`
 	LinkedWalletCacheSize                     int `json:",omitempty"`
 	LinkedWalletCacheTTLSeconds               int `json:",omitempty"`
+
+	// EntitlementManagerCacheMaxBytes caps the approximate memory held by cached space and channel
+	// entitlements. Largest and then oldest entries are evicted once exceeded. Defaults to 256MiB.
+	EntitlementManagerCacheMaxBytes int64 `json:",omitempty"`
+	// EntitlementPayloadWarnThresholdBytes is the size of cached entitlements for a single space or channel
+	// above which a warning is logged. Defaults to 1MiB.
+	EntitlementPayloadWarnThresholdBytes int `json:",omitempty"`
+	// EntitlementInvalidationMaxScopesPerBlock caps the number of distinct cache invalidations applied for a
+	// block. Once exceeded, whole spaces are invalidated instead. Defaults to 1000.
+	EntitlementInvalidationMaxScopesPerBlock int `json:",omitempty"`
+	// EntitlementCacheExpiryJitterPercent randomly moves the expiry of entitlement and membership cache entries
+	// by up to this percentage of the TTL, so entries cached together don't expire together. Disabled by default.
+	EntitlementCacheExpiryJitterPercent int `json:",omitempty"`
+	// EntitlementCacheWarmSpaceIds lists spaces whose entitlements are prefetched in the background at startup.
+	EntitlementCacheWarmSpaceIds []string `json:",omitempty"`
+	// EntitlementCacheWarmConcurrency is the number of spaces warmed concurrently. Defaults to 8.
+	EntitlementCacheWarmConcurrency int `json:",omitempty"`
+	// EntitlementCacheWarmTimeout bounds the time spent warming the caches at startup. Defaults to 30s.
+	EntitlementCacheWarmTimeout time.Duration `json:",omitempty"`
+	// EntitlementSelfTestSpaceId is the canary space whose entitlements are read by the auth self-test.
+	// The space probe is skipped if not set.
+	EntitlementSelfTestSpaceId string `json:",omitempty"`
+	// EntitlementSelfTestTimeout bounds each probe of the auth self-test. Defaults to 5s.
+	EntitlementSelfTestTimeout time.Duration `json:",omitempty"`
+	// EntitlementRpcMaxAttempts is the number of attempts made for chain calls that evaluate entitlements or
+	// verify receipts when they fail with transient errors such as timeouts and rate limits. Defaults to 3,
+	// set to 1 to disable retries.
+	EntitlementRpcMaxAttempts int `json:",omitempty"`
+	// EntitlementRpcRetryDelay is the delay before the first retry, doubled for each following one.
+	// Defaults to 100ms.
+	EntitlementRpcRetryDelay time.Duration `json:",omitempty"`
+	// EntitlementDualReadSampleRate is the fraction of entitlement checks served from the cache that are
+	// evaluated again in the background to report disagreements with the cached decision. Disabled by default.
+	EntitlementDualReadSampleRate float64 `json:",omitempty"`
+	// EntitlementDualReadConcurrency caps the number of concurrent background evaluations. Defaults to 4.
+	EntitlementDualReadConcurrency int `json:",omitempty"`
+	// EntitlementDualReadMaxPerSecond caps the rate of background evaluations, samples over the concurrency
+	// or rate limits are dropped. Defaults to 10.
+	EntitlementDualReadMaxPerSecond float64 `json:",omitempty"`
+	// DisableEntitlementJoinPrewarm disables resolving the entitlements of users that just joined a space
+	// before their first actions.
+	DisableEntitlementJoinPrewarm bool `json:",omitempty"`
+	// EntitlementJoinPrewarmConcurrency caps the number of joins pre-warmed concurrently, joins over the cap
+	// are not pre-warmed. Defaults to 4.
+	EntitlementJoinPrewarmConcurrency int `json:",omitempty"`
+	// EntitlementJoinPrewarmMaxChecks is the budget of checks, and so of chain calls, pre-warming a single
+	// join may spend. Defaults to 10.
+	EntitlementJoinPrewarmMaxChecks int `json:",omitempty"`
+	// EntitlementJoinPrewarmTimeout bounds the time from a join to the end of its pre-warming, including the
+	// time it waits in the entitlement work queue. Defaults to 10s.
+	EntitlementJoinPrewarmTimeout time.Duration `json:",omitempty"`
+	// EntitlementMaxConcurrentChecks caps the number of entitlement checks computed concurrently on cache misses,
+	// checks over the cap wait for a slot until their deadline. Defaults to 64.
+	EntitlementMaxConcurrentChecks int `json:",omitempty"`
+	// EntitlementMaxConcurrentMembershipChecks caps the number of membership calls in flight across all
+	// entitlement checks, which check the linked wallets of the principal in parallel. Defaults to 128.
+	EntitlementMaxConcurrentMembershipChecks int `json:",omitempty"`
+	// EntitlementAllocSampleRate is the fraction of uncached entitlement checks whose heap allocations are
+	// reported. The runtime reports allocations of the whole process, so samples are approximate. Disabled
+	// by default.
+	EntitlementAllocSampleRate float64 `json:",omitempty"`
+	// EntitlementPolicyHookTimeout bounds the evaluation of each entitlement policy hook, hooks that time out
+	// leave the on-chain decision unchanged. Defaults to 50ms.
+	EntitlementPolicyHookTimeout time.Duration `json:",omitempty"`
+	// EntitlementDenyList denies entitlement checks of principals and in spaces the chain allows, e.g. to
+	// apply legal blocks locally. Empty by default.
+	EntitlementDenyList EntitlementDenyListConfig `json:",omitempty"`
+	// EntitlementDenialHookQueueSize caps the entitlement denials waiting to be delivered to the denial hooks,
+	// denials are dropped on overflow. Defaults to 1000.
+	EntitlementDenialHookQueueSize int `json:",omitempty"`
+	// EntitlementDenialLogSampleRate is the fraction of entitlement denials logged at info level with the
+	// principal, the space, the channel and the reason of the denial. Disabled by default.
+	EntitlementDenialLogSampleRate float64 `json:",omitempty"`
+	// EntitlementAuditBufferSize is the number of the latest entitlement decisions kept in memory for the
+	// support bundles of users. Defaults to 1000, a negative size disables the buffer.
+	EntitlementAuditBufferSize int `json:",omitempty"`
+	// EntitlementCacheConcerningAge is the age past which decisions served from the entitlement and
+	// membership caches are counted as concerning. Defaults to 10m.
+	EntitlementCacheConcerningAge time.Duration `json:",omitempty"`
+	// EntitlementCacheMemoryReconcileInterval is how often the memory accounted for the entries of the
+	// entitlement caches is compared with a deep measurement of a sample of the entries. Defaults to 5m, a
+	// negative interval disables the reconciliation.
+	EntitlementCacheMemoryReconcileInterval time.Duration `json:",omitempty"`
+	// EntitlementCacheMemorySampleSize is the number of entries of each entitlement cache measured by a
+	// reconciliation. Defaults to 100.
+	EntitlementCacheMemorySampleSize int `json:",omitempty"`
+	// EntitlementCacheMemoryDriftTolerance is the relative difference between the accounted and the sampled
+	// memory of an entitlement cache past which the drift is logged and counted. Defaults to 0.25.
+	EntitlementCacheMemoryDriftTolerance float64 `json:",omitempty"`
+	// BanCacheTTL is how long the list of the wallets banned from a space is cached. Ban and unban events of
+	// watched spaces invalidate it earlier. Defaults to 15s.
+	BanCacheTTL time.Duration `json:",omitempty"`
+	// EntitlementSlowCheckThreshold is the duration past which entitlement checks are logged with the time
+	// spent in each of their stages. Defaults to 1s.
+	EntitlementSlowCheckThreshold time.Duration `json:",omitempty"`
+	// EntitlementFastPathTimeout bounds the IsWalletLinked and IsSpaceMember checks, which only resolve linked
+	// wallets and memberships, instead of the contract calls timeout of the space and channel checks.
+	// Defaults to 2s.
+	EntitlementFastPathTimeout time.Duration `json:",omitempty"`
+	// EntitlementMaxCallTimeout caps the timeouts callers set on single entitlement checks, which override
+	// the contract calls timeout, see ChainAuthArgs.WithTimeout. Defaults to 60s.
+	EntitlementMaxCallTimeout time.Duration `json:",omitempty"`
+	// EntitlementMaxMembersPageSize caps the page size of ChainAuth.ListSpaceMembers, larger pages are
+	// refused. Defaults to 1000.
+	EntitlementMaxMembersPageSize int `json:",omitempty"`
+	// EntitlementWorkQueueSize caps the background entitlement work, such as join pre-warming and dual
+	// reads, waiting to run. The oldest work of the lowest priority is dropped on overflow. Defaults to 1000.
+	EntitlementWorkQueueSize int `json:",omitempty"`
+	// EntitlementWorkQueueConcurrency caps the background entitlement work running at once. Defaults to 8.
+	EntitlementWorkQueueConcurrency int `json:",omitempty"`
+	// EntitlementWorkQueueSpaceConcurrency caps the background entitlement work of a single space running at
+	// once. Defaults to 2.
+	EntitlementWorkQueueSpaceConcurrency int `json:",omitempty"`
+	// LinkedWalletsFallbackTTL is how long the linked wallets read from the base chain only, when the cross-chain
+	// evaluator is unavailable, and the decisions made with them are cached. Defaults to 30s.
+	LinkedWalletsFallbackTTL time.Duration `json:",omitempty"`
+	// EntitlementSimulationConcurrency caps the number of wallet set simulations run at once, simulations over
+	// the cap are refused as they read the chain without the caches. Defaults to 2.
+	EntitlementSimulationConcurrency int `json:",omitempty"`
+}
+
+// EntitlementDenyListConfig is the static deny-list of the entitlement checks, see ChainConfig.
+type EntitlementDenyListConfig struct {
+	// Principals are the hex addresses of the denied principals.
+	Principals []string `json:",omitempty"`
+	// Spaces are the ids of the spaces whose checks are denied.
+	Spaces []string `json:",omitempty"`
+}
+
+func (c *EntitlementDenyListConfig) IsEmpty() bool {
+	return len(c.Principals) == 0 && len(c.Spaces) == 0
 }
 
 func (c ChainConfig) BlockTime() time.Duration {
@@ -513,6 +661,8 @@ type DebugEndpointsConfig struct {
 	Stream          bool
 	TxPool          bool
 	CorruptStreams  bool
+	// AuthSelfTest exposes the auth self-test, which calls the configured contracts and chains on every request.
+	AuthSelfTest bool
 
 	// Make storage statistics available via debug endpoints. This may involve running queries
 	// on the underlying database.
@@ -535,6 +685,27 @@ type DebugEndpointsConfig struct {
 	MemProfileInterval time.Duration
 }
 
+// DiskCacheConfig specifies where the entitlement caches are persisted so they are warm after a restart.
+type DiskCacheConfig struct {
+	// Path to the write-ahead log file the entitlement caches are written to.
+	// If empty, the caches are kept in memory only.
+	Path string
+
+	// MaxRestoreAge is the maximum age of the entries restored after a restart, older entries are dropped
+	// rather than served until their TTL elapses, e.g. after a long downtime. The age of an entry is measured
+	// from when it was cached and from the block of the base chain it was written at, whichever is older.
+	// If unset or <= 0, entries are restored as long as their TTL didn't elapse.
+	MaxRestoreAge time.Duration `json:",omitempty"`
+
+	// CompactionInterval is how often the log is rewritten from a snapshot of the caches, which drops the
+	// entries that were removed or replaced since. Defaults to 10m.
+	CompactionInterval time.Duration `json:",omitempty"`
+
+	// MaxSizeBytes is the size of the log past which it is compacted before the next interval.
+	// Defaults to 64MiB.
+	MaxSizeBytes int64 `json:",omitempty"`
+}
+
 type RiverRegistryConfig struct {
 	// PageSize is the number of streams to read from the contract at once using GetPaginatedStreams.
 	PageSize int
@@ -648,6 +819,13 @@ func (c *Config) GetGraffiti() string {
 	return c.Graffiti
 }
 
+func (c *Config) GetMaxConcurrentMembershipChecks() int {
+	if c == nil || c.MaxConcurrentMembershipChecks <= 0 {
+		return 5
+	}
+	return c.MaxConcurrentMembershipChecks
+}
+
 // Get the address of the contract that receives entitlement check requests.
 func (c *Config) GetEntitlementContractAddress() common.Address {
 	return c.EntitlementContract.Address
@@ -3,11 +3,15 @@ package types
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math/big"
+	"regexp"
+	"strconv"
 	"strings"
 
 	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
 
 	"github.com/towns-protocol/towns/core/contracts/base"
@@ -27,6 +31,54 @@ const (
 	ModuleTypeUserEntitlement   = "UserEntitlement"
 )
 
+// ErrUndecodableEntitlement is returned for entitlement modules this node can't decode, such as modules of
+// an unknown kind, modules encoded with a version introduced by a newer contract, or malformed data. Callers
+// skip such modules, which never grants access as a user is entitled if any module entitles them.
+var ErrUndecodableEntitlement = errors.New("undecodable entitlement")
+
+// supportedEntitlementVersions are the encoding versions of each module kind this node decodes. The entitlement
+// type of a module is its kind followed by its version, e.g. RuleEntitlementV2, the first version has no suffix.
+var supportedEntitlementVersions = map[string]int{
+	ModuleTypeRuleEntitlement: 2,
+	ModuleTypeUserEntitlement: 1,
+}
+
+var entitlementTypeRegexp = regexp.MustCompile(`^([A-Za-z]+?)(?:V([2-9]|[1-9][0-9]+))?$`)
+
+// EntitlementVersion returns the module kind and encoding version of an entitlement type. An error wrapping
+// ErrUndecodableEntitlement is returned for unknown kinds and for versions newer than the supported ones.
+func EntitlementVersion(entitlementType string) (kind string, version int, err error) {
+	match := entitlementTypeRegexp.FindStringSubmatch(entitlementType)
+	if match == nil {
+		return "", 0, fmt.Errorf("%w: invalid entitlement type '%s'", ErrUndecodableEntitlement, entitlementType)
+	}
+
+	kind, version = match[1], 1
+	if match[2] != "" {
+		if version, err = strconv.Atoi(match[2]); err != nil {
+			return "", 0, fmt.Errorf(
+				"%w: invalid entitlement type '%s': %w", ErrUndecodableEntitlement, entitlementType, err)
+		}
+	}
+
+	supported, ok := supportedEntitlementVersions[kind]
+	if !ok {
+		return "", 0, fmt.Errorf("%w: invalid entitlement type '%s'", ErrUndecodableEntitlement, entitlementType)
+	}
+	if version > supported {
+		return "", 0, fmt.Errorf(
+			"%w: unsupported version %d of entitlement type '%s', up to %d is supported",
+			ErrUndecodableEntitlement,
+			version,
+			kind,
+			supported,
+		)
+	}
+	return kind, version, nil
+}
+
+// MarshalEntitlement decodes the data of an entitlement module. An error wrapping ErrUndecodableEntitlement
+// is returned if the module kind, its version or its data can't be decoded by this node.
 func MarshalEntitlement(
 	ctx context.Context,
 	rawEntitlement base.IEntitlementDataQueryableBaseEntitlementData,
@@ -37,111 +89,36 @@ func MarshalEntitlement(
 		"entitlement_data", rawEntitlement.EntitlementData,
 		"entitlement_type", rawEntitlement.EntitlementType,
 	)
-	if rawEntitlement.EntitlementType == ModuleTypeRuleEntitlement {
-		// Parse the ABI definition
-		parsedABI, err := base.RuleEntitlementMetaData.GetAbi()
-		if err != nil {
-			log.Errorw("Failed to parse ABI", "error", err)
-			return Entitlement{}, err
-		}
 
-		var ruleData base.IRuleEntitlementBaseRuleData
-
-		unpackedData, err := parsedABI.Unpack("getRuleData", rawEntitlement.EntitlementData)
-		if err != nil {
-			log.Warnw(
-				"Failed to unpack rule data",
-				"error",
-				err,
-				"entitlement",
-				rawEntitlement,
-				"entitlement_data",
-				rawEntitlement.EntitlementData,
-				"len(entitlement.EntitlementData)",
-				len(rawEntitlement.EntitlementData),
-			)
-		}
-
-		if len(unpackedData) > 0 {
-			// Marshal into JSON, because for some UnpackIntoInterface doesn't work when unpacking directly into a struct
-			jsonData, err := json.Marshal(unpackedData[0])
-			if err != nil {
-				log.Warnw("Failed to marshal data to JSON", "error", err, "unpackedData", unpackedData)
-			}
+	kind, version, err := EntitlementVersion(rawEntitlement.EntitlementType)
+	if err != nil {
+		return Entitlement{}, err
+	}
 
-			err = json.Unmarshal(jsonData, &ruleData)
-			if err != nil {
-				log.Warnw(
-					"Failed to unmarshal JSON to struct",
-					"error",
-					err,
-					"jsonData",
-					jsonData,
-					"ruleData",
-					ruleData,
-				)
-			}
-		} else {
-			log.Warnw("No data unpacked", "unpackedData", unpackedData)
+	switch {
+	case kind == ModuleTypeRuleEntitlement && version == 1:
+		var ruleData base.IRuleEntitlementBaseRuleData
+		if err := unpackRuleData(
+			ctx, base.RuleEntitlementMetaData, "getRuleData", rawEntitlement, &ruleData); err != nil {
+			return Entitlement{}, err
 		}
-
 		return Entitlement{
 			EntitlementType: rawEntitlement.EntitlementType,
 			RuleEntitlement: &ruleData,
 		}, nil
-	} else if rawEntitlement.EntitlementType == ModuleTypeRuleEntitlementV2 {
-		// Parse the ABI definition
-		parsedABI, err := base.RuleEntitlementV2MetaData.GetAbi()
-		if err != nil {
-			log.Errorw("Failed to parse ABI", "error", err)
-			return Entitlement{}, err
-		}
 
+	case kind == ModuleTypeRuleEntitlement && version == 2:
 		var ruleData base.IRuleEntitlementBaseRuleDataV2
-
-		unpackedData, err := parsedABI.Unpack("getRuleDataV2", rawEntitlement.EntitlementData)
-		if err != nil {
-			log.Warnw(
-				"Failed to unpack rule data",
-				"error",
-				err,
-				"entitlement",
-				rawEntitlement,
-				"entitlement_data",
-				rawEntitlement.EntitlementData,
-				"len(entitlement.EntitlementData)",
-				len(rawEntitlement.EntitlementData),
-			)
-		}
-
-		if len(unpackedData) > 0 {
-			// Marshal into JSON, because for some UnpackIntoInterface doesn't work when unpacking directly into a struct
-			jsonData, err := json.Marshal(unpackedData[0])
-			if err != nil {
-				log.Warnw("Failed to marshal data to JSON", "error", err, "unpackedData", unpackedData)
-			}
-
-			err = json.Unmarshal(jsonData, &ruleData)
-			if err != nil {
-				log.Warnw(
-					"Failed to unmarshal JSON to struct",
-					"error",
-					err,
-					"jsonData",
-					jsonData,
-					"ruleData",
-					ruleData,
-				)
-			}
-		} else {
-			log.Warnw("No data unpacked", "unpackedData", unpackedData)
+		if err := unpackRuleData(
+			ctx, base.RuleEntitlementV2MetaData, "getRuleDataV2", rawEntitlement, &ruleData); err != nil {
+			return Entitlement{}, err
 		}
-
 		return Entitlement{
 			EntitlementType:   rawEntitlement.EntitlementType,
 			RuleEntitlementV2: &ruleData,
 		}, nil
-	} else if rawEntitlement.EntitlementType == ModuleTypeUserEntitlement {
+
+	case kind == ModuleTypeUserEntitlement:
 		abiDef := `[{"name":"getAddresses","outputs":[{"type":"address[]","name":"out"}],"constant":true,"payable":false,"type":"function"}]`
 
 		// Parse the ABI definition
@@ -153,7 +130,7 @@ func MarshalEntitlement(
 		// Unpack the data
 		err = parsedABI.UnpackIntoInterface(&addresses, "getAddresses", rawEntitlement.EntitlementData)
 		if err != nil {
-			return Entitlement{}, err
+			return Entitlement{}, fmt.Errorf("%w: %w", ErrUndecodableEntitlement, err)
 		}
 		return Entitlement{
 			EntitlementType: rawEntitlement.EntitlementType,
@@ -161,7 +138,67 @@ func MarshalEntitlement(
 		}, nil
 	}
 
-	return Entitlement{}, fmt.Errorf("invalid entitlement type '%s'", rawEntitlement.EntitlementType)
+	return Entitlement{}, fmt.Errorf(
+		"%w: no decoder for entitlement type '%s'", ErrUndecodableEntitlement, rawEntitlement.EntitlementType)
+}
+
+// unpackRuleData decodes the rule data returned by method of a rule entitlement module into ruleData.
+func unpackRuleData(
+	ctx context.Context,
+	metaData *bind.MetaData,
+	method string,
+	rawEntitlement base.IEntitlementDataQueryableBaseEntitlementData,
+	ruleData any,
+) error {
+	log := logging.FromCtx(ctx)
+
+	// Parse the ABI definition
+	parsedABI, err := metaData.GetAbi()
+	if err != nil {
+		log.Errorw("Failed to parse ABI", "error", err)
+		return err
+	}
+
+	unpackedData, err := parsedABI.Unpack(method, rawEntitlement.EntitlementData)
+	if err != nil {
+		log.Warnw(
+			"Failed to unpack rule data",
+			"error",
+			err,
+			"entitlement",
+			rawEntitlement,
+			"entitlement_data",
+			rawEntitlement.EntitlementData,
+			"len(entitlement.EntitlementData)",
+			len(rawEntitlement.EntitlementData),
+		)
+		return fmt.Errorf("%w: %w", ErrUndecodableEntitlement, err)
+	}
+	if len(unpackedData) == 0 {
+		log.Warnw("No data unpacked", "unpackedData", unpackedData)
+		return fmt.Errorf("%w: no rule data unpacked", ErrUndecodableEntitlement)
+	}
+
+	// Marshal into JSON, because for some UnpackIntoInterface doesn't work when unpacking directly into a struct
+	jsonData, err := json.Marshal(unpackedData[0])
+	if err != nil {
+		log.Warnw("Failed to marshal data to JSON", "error", err, "unpackedData", unpackedData)
+		return fmt.Errorf("%w: %w", ErrUndecodableEntitlement, err)
+	}
+
+	if err = json.Unmarshal(jsonData, ruleData); err != nil {
+		log.Warnw(
+			"Failed to unmarshal JSON to struct",
+			"error",
+			err,
+			"jsonData",
+			jsonData,
+			"ruleData",
+			ruleData,
+		)
+		return fmt.Errorf("%w: %w", ErrUndecodableEntitlement, err)
+	}
+	return nil
 }
 
 type ThresholdParams struct {
@@ -1,11 +1,14 @@
 package types_test
 
 import (
+	"encoding/json"
 	"fmt"
 	"math/big"
+	"os"
 	"testing"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/stretchr/testify/require"
 
 	"github.com/towns-protocol/towns/core/contracts/base"
@@ -244,3 +247,94 @@ func TestConvertV1RuleDataToV2(t *testing.T) {
 		})
 	}
 }
+
+func TestEntitlementVersion(t *testing.T) {
+	tests := []struct {
+		entitlementType string
+		kind            string
+		version         int
+	}{
+		{types.ModuleTypeRuleEntitlement, types.ModuleTypeRuleEntitlement, 1},
+		{types.ModuleTypeRuleEntitlementV2, types.ModuleTypeRuleEntitlement, 2},
+		{types.ModuleTypeUserEntitlement, types.ModuleTypeUserEntitlement, 1},
+		// Newer versions and unknown kinds can't be decoded.
+		{"RuleEntitlementV3", "", 0},
+		{"UserEntitlementV2", "", 0},
+		{"RuleEntitlementV99999999999999999999", "", 0},
+		{"TokenGatedEntitlement", "", 0},
+		{"RuleEntitlementV1", "", 0},
+		{"", "", 0},
+	}
+	for _, tt := range tests {
+		kind, version, err := types.EntitlementVersion(tt.entitlementType)
+		if tt.kind == "" {
+			require.ErrorIs(t, err, types.ErrUndecodableEntitlement, tt.entitlementType)
+			continue
+		}
+		require.NoError(t, err, tt.entitlementType)
+		require.Equal(t, tt.kind, kind)
+		require.Equal(t, tt.version, version)
+	}
+}
+
+// entitlementCorpusEntry is an encoded entitlement module and its expected decoding, nil if the module must be
+// reported as undecodable.
+type entitlementCorpusEntry struct {
+	Name            string          `json:"name"`
+	EntitlementType string          `json:"entitlementType"`
+	Data            hexutil.Bytes   `json:"data"`
+	Decoded         json.RawMessage `json:"decoded,omitempty"`
+}
+
+// loadEntitlementCorpus reads the encodings of entitlement modules of each contract version. The encoded data
+// is frozen, the expected decodings may only change along with a deliberate change of the decoder.
+func loadEntitlementCorpus(t testing.TB) []entitlementCorpusEntry {
+	data, err := os.ReadFile("testdata/entitlement_corpus.json")
+	require.NoError(t, err)
+	var corpus []entitlementCorpusEntry
+	require.NoError(t, json.Unmarshal(data, &corpus))
+	require.NotEmpty(t, corpus)
+	return corpus
+}
+
+func TestMarshalEntitlementCorpus(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	for _, entry := range loadEntitlementCorpus(t) {
+		t.Run(entry.Name, func(t *testing.T) {
+			entitlement, err := types.MarshalEntitlement(ctx, base.IEntitlementDataQueryableBaseEntitlementData{
+				EntitlementType: entry.EntitlementType,
+				EntitlementData: entry.Data,
+			})
+			if entry.Decoded == nil {
+				require.ErrorIs(t, err, types.ErrUndecodableEntitlement)
+				return
+			}
+			require.NoError(t, err)
+			decoded, err := json.Marshal(entitlement)
+			require.NoError(t, err)
+			require.JSONEq(t, string(entry.Decoded), string(decoded))
+		})
+	}
+}
+
+func FuzzMarshalEntitlement(f *testing.F) {
+	for _, entry := range loadEntitlementCorpus(f) {
+		f.Add(entry.EntitlementType, []byte(entry.Data))
+	}
+
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	f.Fuzz(func(t *testing.T, entitlementType string, data []byte) {
+		// Malformed data must be reported as undecodable, not panic or fail otherwise.
+		_, err := types.MarshalEntitlement(ctx, base.IEntitlementDataQueryableBaseEntitlementData{
+			EntitlementType: entitlementType,
+			EntitlementData: data,
+		})
+		if err != nil {
+			require.ErrorIs(t, err, types.ErrUndecodableEntitlement)
+		}
+	})
+}
@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"math/rand/v2"
+	runtimeMetrics "runtime/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/towns-protocol/towns/core/config"
+	"github.com/towns-protocol/towns/core/node/infra"
+)
+
+const (
+	allocBytesMetric   = "/gc/heap/allocs:bytes"
+	allocObjectsMetric = "/gc/heap/allocs:objects"
+)
+
+// allocSampler reports the heap allocations of a sample of uncached entitlement checks. The runtime only
+// reports the allocations of the whole process, so a sample also includes the allocations other goroutines
+// made while the check ran. Samples are indicative on busy nodes: they are meant to compare builds and spot
+// regressions, not to account for every byte.
+type allocSampler struct {
+	sampleRate float64
+
+	bytes   prometheus.Histogram
+	objects prometheus.Histogram
+}
+
+func newAllocSampler(cfg *config.ChainConfig, metrics infra.MetricsFactory) *allocSampler {
+	return &allocSampler{
+		sampleRate: cfg.EntitlementAllocSampleRate,
+		bytes: metrics.NewHistogramEx(
+			"entitlement_check_alloc_bytes",
+			"Bytes allocated by the process while sampled uncached entitlement checks ran",
+			prometheus.ExponentialBuckets(1024, 4, 9),
+		),
+		objects: metrics.NewHistogramEx(
+			"entitlement_check_alloc_objects",
+			"Objects allocated by the process while sampled uncached entitlement checks ran",
+			prometheus.ExponentialBuckets(16, 4, 9),
+		),
+	}
+}
+
+// allocSample is an in-progress measurement started by allocSampler.start.
+type allocSample struct {
+	sampler *allocSampler
+	samples [2]runtimeMetrics.Sample
+}
+
+// start starts measuring the allocations of a check if it is sampled, returns nil otherwise.
+func (s *allocSampler) start() *allocSample {
+	if s.sampleRate <= 0 || rand.Float64() >= s.sampleRate {
+		return nil
+	}
+	sample := &allocSample{sampler: s}
+	sample.samples[0].Name = allocBytesMetric
+	sample.samples[1].Name = allocObjectsMetric
+	runtimeMetrics.Read(sample.samples[:])
+	return sample
+}
+
+// done reports the allocations made since the sample was started.
+func (sample *allocSample) done() {
+	startBytes, startObjects := sample.samples[0].Value.Uint64(), sample.samples[1].Value.Uint64()
+	runtimeMetrics.Read(sample.samples[:])
+	sample.sampler.bytes.Observe(float64(sample.samples[0].Value.Uint64() - startBytes))
+	sample.sampler.objects.Observe(float64(sample.samples[1].Value.Uint64() - startObjects))
+}
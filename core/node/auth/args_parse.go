@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	. "github.com/towns-protocol/towns/core/node/base"
+	. "github.com/towns-protocol/towns/core/node/protocol"
+	"github.com/towns-protocol/towns/core/node/shared"
+)
+
+// ParseChainAuthArgsForSpace is NewChainAuthArgsForSpace for user and space ids that come from requests. The
+// constructors convert any user id to an address, malformed ids become the zero address or the last 20 bytes
+// of longer ids, which are checked without error. The Parse constructors reject them instead, see parseUserId,
+// along with space ids that are not space streams.
+func ParseChainAuthArgsForSpace(
+	spaceId shared.StreamId,
+	userId string,
+	permission Permission,
+) (*ChainAuthArgs, error) {
+	if err := validateSpaceId(spaceId); err != nil {
+		return nil, AsRiverError(err).Func("ParseChainAuthArgsForSpace")
+	}
+	principal, err := parseUserId(userId)
+	if err != nil {
+		return nil, AsRiverError(err).Func("ParseChainAuthArgsForSpace")
+	}
+	return NewChainAuthArgsForSpace(spaceId, principal.Hex(), permission), nil
+}
+
+// ParseChainAuthArgsForChannel is NewChainAuthArgsForChannel for ids that come from requests, see
+// ParseChainAuthArgsForSpace. The channel id must be a channel stream.
+func ParseChainAuthArgsForChannel(
+	spaceId shared.StreamId,
+	channelId shared.StreamId,
+	userId string,
+	permission Permission,
+) (*ChainAuthArgs, error) {
+	if err := validateSpaceId(spaceId); err != nil {
+		return nil, AsRiverError(err).Func("ParseChainAuthArgsForChannel")
+	}
+	if !shared.ValidChannelStreamId(&channelId) {
+		return nil, RiverError(Err_BAD_STREAM_ID, "Not a channel stream id", "channelId", channelId).
+			Func("ParseChainAuthArgsForChannel")
+	}
+	principal, err := parseUserId(userId)
+	if err != nil {
+		return nil, AsRiverError(err).Func("ParseChainAuthArgsForChannel")
+	}
+	return NewChainAuthArgsForChannel(spaceId, channelId, principal.Hex(), permission), nil
+}
+
+// ParseChainAuthArgsForIsSpaceMember is NewChainAuthArgsForIsSpaceMember for ids that come from requests, see
+// ParseChainAuthArgsForSpace.
+func ParseChainAuthArgsForIsSpaceMember(spaceId shared.StreamId, userId string) (*ChainAuthArgs, error) {
+	if err := validateSpaceId(spaceId); err != nil {
+		return nil, AsRiverError(err).Func("ParseChainAuthArgsForIsSpaceMember")
+	}
+	principal, err := parseUserId(userId)
+	if err != nil {
+		return nil, AsRiverError(err).Func("ParseChainAuthArgsForIsSpaceMember")
+	}
+	return NewChainAuthArgsForIsSpaceMember(spaceId, principal.Hex()), nil
+}
+
+// parseUserId returns the address of a user id, which must be a 0x prefixed hex address other than the zero
+// address.
+func parseUserId(userId string) (common.Address, error) {
+	if !strings.HasPrefix(userId, "0x") && !strings.HasPrefix(userId, "0X") {
+		return common.Address{}, RiverError(Err_BAD_ADDRESS, "User id is not 0x prefixed", "userId", userId)
+	}
+	if !common.IsHexAddress(userId) {
+		return common.Address{}, RiverError(Err_BAD_ADDRESS, "User id is not a hex address", "userId", userId)
+	}
+	principal := common.HexToAddress(userId)
+	if principal == (common.Address{}) {
+		return common.Address{}, RiverError(Err_BAD_ADDRESS, "User id is the zero address", "userId", userId)
+	}
+	return principal, nil
+}
+
+// validateSpaceId returns an error if spaceId is not a space stream id.
+func validateSpaceId(spaceId shared.StreamId) error {
+	if spaceId == (shared.StreamId{}) {
+		return RiverError(Err_BAD_STREAM_ID, "Space id is not set")
+	}
+	if !shared.ValidSpaceStreamId(&spaceId) {
+		return RiverError(Err_BAD_STREAM_ID, "Not a space stream id", "spaceId", spaceId)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/towns-protocol/towns/core/node/base"
+	. "github.com/towns-protocol/towns/core/node/protocol"
+	"github.com/towns-protocol/towns/core/node/shared"
+	"github.com/towns-protocol/towns/core/node/testutils"
+)
+
+func TestParseChainAuthArgs(t *testing.T) {
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+	channelId := testutils.FakeStreamId(shared.STREAM_CHANNEL_BIN)
+	user := common.HexToAddress("0x0000000000000000000000000000000000000abc")
+
+	tests := []struct {
+		name      string
+		spaceId   shared.StreamId
+		channelId shared.StreamId
+		userId    string
+		code      Err
+	}{
+		{name: "valid", spaceId: spaceId, channelId: channelId, userId: user.Hex()},
+		{name: "lower case", spaceId: spaceId, channelId: channelId, userId: strings.ToLower(user.Hex())},
+		{name: "no prefix", spaceId: spaceId, channelId: channelId, userId: user.Hex()[2:], code: Err_BAD_ADDRESS},
+		{
+			name:      "too long",
+			spaceId:   spaceId,
+			channelId: channelId,
+			userId:    "0x" + strings.Repeat("ab", 32),
+			code:      Err_BAD_ADDRESS,
+		},
+		{
+			name:      "not hex",
+			spaceId:   spaceId,
+			channelId: channelId,
+			userId:    "0x" + strings.Repeat("zz", 20),
+			code:      Err_BAD_ADDRESS,
+		},
+		{name: "zero address", spaceId: spaceId, channelId: channelId, userId: common.Address{}.Hex(), code: Err_BAD_ADDRESS},
+		{name: "empty", spaceId: spaceId, channelId: channelId, userId: "", code: Err_BAD_ADDRESS},
+		{name: "no space", channelId: channelId, userId: user.Hex(), code: Err_BAD_STREAM_ID},
+		{name: "channel as space", spaceId: channelId, channelId: channelId, userId: user.Hex(), code: Err_BAD_STREAM_ID},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			check := func(args *ChainAuthArgs, err error) {
+				if tc.code != 0 {
+					require.Nil(t, args)
+					require.Equal(t, tc.code, AsRiverError(err).Code, err)
+					return
+				}
+				require.NoError(t, err)
+				require.Equal(t, tc.spaceId, args.spaceId)
+				require.Equal(t, user, args.principal)
+			}
+
+			check(ParseChainAuthArgsForSpace(tc.spaceId, tc.userId, PermissionRead))
+			check(ParseChainAuthArgsForChannel(tc.spaceId, tc.channelId, tc.userId, PermissionRead))
+			check(ParseChainAuthArgsForIsSpaceMember(tc.spaceId, tc.userId))
+		})
+	}
+
+	t.Run("space as channel", func(t *testing.T) {
+		args, err := ParseChainAuthArgsForChannel(spaceId, spaceId, user.Hex(), PermissionRead)
+		require.Nil(t, args)
+		require.Equal(t, Err_BAD_STREAM_ID, AsRiverError(err).Code)
+	})
+}
@@ -0,0 +1,183 @@
+package auth
+
+import (
+	"context"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/towns-protocol/towns/core/config"
+	. "github.com/towns-protocol/towns/core/node/base"
+	"github.com/towns-protocol/towns/core/node/logging"
+	"github.com/towns-protocol/towns/core/node/shared"
+)
+
+type AuditDecision string
+
+const (
+	AuditDecisionAllow AuditDecision = "allow"
+	AuditDecisionDeny  AuditDecision = "deny"
+)
+
+// AuditRecord is the audit trail entry of a single entitlement decision.
+type AuditRecord struct {
+	Timestamp time.Time `json:"timestamp"`
+	// BlockNumber is the latest block of the chain of the space when the decision was recorded, 0 if it
+	// couldn't be read. Decisions served from the caches were evaluated with the state of an earlier block.
+	BlockNumber uint64 `json:"blockNumber"`
+	// Kind is the kind of the check, such as space, channel or isSpaceMember.
+	Kind       string          `json:"kind"`
+	Principal  common.Address  `json:"principal"`
+	SpaceId    shared.StreamId `json:"spaceId"`
+	ChannelId  shared.StreamId `json:"channelId"`
+	ChainId    uint64          `json:"chainId,omitempty"`
+	Permission Permission      `json:"permission"`
+	// CustomPermission is the name of the app-defined permission checked, see NewChainAuthArgsForCustomPermission.
+	CustomPermission string `json:"customPermission,omitempty"`
+	// Permissions are the permissions checked instead of Permission, combined as PermissionMode tells, see
+	// ChainAuthArgs.WithPermissions.
+	Permissions    []Permission            `json:"permissions,omitempty"`
+	PermissionMode PermissionMode          `json:"permissionMode,omitempty"`
+	Decision       AuditDecision           `json:"decision"`
+	Reason         EntitlementResultReason `json:"reason"`
+	// Wallets are the linked wallets of the principal the decision was evaluated against. It is empty if the
+	// decision was made before the linked wallets were resolved, e.g. because the space is disabled, or if
+	// they changed since the decision was cached.
+	Wallets []common.Address `json:"wallets"`
+	// WalletSetDigest is the digest of the wallets the decision was evaluated against, see WalletSetDigest.
+	WalletSetDigest common.Hash `json:"walletSetDigest"`
+	// EntitlementsDigest is the digest of the entitlements of the space or the channel the decision was
+	// evaluated with, see EntitlementsDigest. It is the zero hash for checks that don't evaluate entitlements
+	// or if they couldn't be read.
+	EntitlementsDigest common.Hash `json:"entitlementsDigest"`
+	FromCache          bool        `json:"fromCache"`
+	// ReasonChain is the on-chain decision followed by the verdicts of the policy hooks, see PolicyHook.
+	ReasonChain []ReasonChainStep `json:"reasonChain,omitempty"`
+}
+
+// AuditSink receives the audit records of entitlement decisions.
+type AuditSink interface {
+	Write(record AuditRecord) error
+}
+
+// CheckEntitlementWithAuditLog is IsEntitled that writes an audit record of the decision to sink before
+// returning. Failures to write the record are logged and don't fail the check. No record is written if
+// the check fails.
+func (ca *chainAuth) CheckEntitlementWithAuditLog(
+	ctx context.Context,
+	cfg *config.Config,
+	args *ChainAuthArgs,
+	sink AuditSink,
+) (IsEntitledResult, error) {
+	result, err := ca.IsEntitled(ctx, cfg, args)
+	if err != nil {
+		return nil, AsRiverError(err).Func("CheckEntitlementWithAuditLog")
+	}
+
+	record := newAuditRecord(args, result)
+	record.BlockNumber = ca.auditedBlockNumber(ctx, args.chainId)
+	if record.WalletSetDigest != (common.Hash{}) {
+		record.Wallets = ca.auditedWallets(ctx, cfg, args, record.WalletSetDigest)
+		// Checks of several permissions are evaluated with several sets of entitlements, none is recorded.
+		if (args.kind == chainAuthKindSpace || args.kind == chainAuthKindChannel ||
+			args.kind == chainAuthKindChannelModerator) && args.permissions == "" {
+			digest, err := ca.auditedEntitlements(ctx, args)
+			if err != nil {
+				logging.FromCtx(ctx).Warnw(
+					"Failed to read entitlements for entitlement audit record", "args", args, "error", err)
+			}
+			record.EntitlementsDigest = digest
+		}
+	}
+
+	if err := sink.Write(record); err != nil {
+		logging.FromCtx(ctx).Errorw("Failed to write entitlement audit record", "record", record, "error", err)
+	}
+	return result, nil
+}
+
+// newAuditRecord returns the audit record of the decision of args, without the block number, the wallets and
+// the entitlements digest of the decision, which take chain reads.
+func newAuditRecord(args *ChainAuthArgs, result IsEntitledResult) AuditRecord {
+	details := DetailsOf(result)
+	record := AuditRecord{
+		Timestamp:        time.Now(),
+		Kind:             args.kind.String(),
+		Principal:        args.principal,
+		SpaceId:          args.spaceId,
+		ChannelId:        args.channelId,
+		ChainId:          args.chainId,
+		Permission:       args.permission,
+		CustomPermission: args.customPermission,
+		Permissions:      deserializePermissions(args.permissions),
+		PermissionMode:   args.permissionMode,
+		Decision:         AuditDecisionDeny,
+		Reason:           result.Reason(),
+		WalletSetDigest:  details.WalletSetDigest,
+		FromCache:        details.FromCache,
+		ReasonChain:      details.ReasonChain,
+	}
+	if result.IsEntitled() {
+		record.Decision = AuditDecisionAllow
+	}
+	return record
+}
+
+// auditedWallets returns the linked wallets of the principal if they match the digest of the decision. Linked
+// wallets are served from the cache, so they normally match unless the wallets changed since the decision was
+// cached.
+func (ca *chainAuth) auditedWallets(
+	ctx context.Context,
+	cfg *config.Config,
+	args *ChainAuthArgs,
+	digest common.Hash,
+) []common.Address {
+	if args.hasPreFetchedWallets {
+		return deserializeWallets(args.preFetchedWallets)
+	}
+
+	log := logging.FromCtx(ctx)
+	wallets, err := ca.getLinkedWallets(ctx, cfg, args)
+	if err != nil {
+		log.Warnw("Failed to resolve linked wallets for entitlement audit record", "args", args, "error", err)
+		return nil
+	}
+	if WalletSetDigest(wallets) != digest {
+		log.Warnw("Linked wallets changed since the audited decision was made", "args", args)
+		return nil
+	}
+	return wallets
+}
+
+// auditedBlockNumber returns the latest block of the given chain, the default chain if chainId is 0, or 0 if it
+// can't be read.
+func (ca *chainAuth) auditedBlockNumber(ctx context.Context, chainId uint64) uint64 {
+	blockchain, err := ca.blockchainFor(chainId)
+	if err != nil || blockchain == nil || blockchain.Client == nil {
+		return 0
+	}
+	blockNum, err := retryRpc(ctx, ca.rpcRetry, "BlockNumber", blockchain.Client.BlockNumber)
+	if err != nil {
+		logging.FromCtx(ctx).Warnw("Failed to read block number for entitlement audit record", "error", err)
+		return 0
+	}
+	return blockNum
+}
+
+// auditedEntitlements returns the digest of the entitlements the space or channel check of args is evaluated
+// with. They are served from the cache like those of the check.
+func (ca *chainAuth) auditedEntitlements(ctx context.Context, args *ChainAuthArgs) (common.Hash, error) {
+	onMiss := ca.getSpaceEntitlementsForPermissionUncached
+	if args.kind == chainAuthKindChannelModerator {
+		args = args.asChannelCheck()
+	}
+	if args.kind == chainAuthKindChannel {
+		onMiss = ca.getChannelEntitlementsForPermissionUncached
+	}
+	result, _, err := ca.entitlementManagerCache.executeUsingCache(ctx, nil, newArgsForEntitlementManager(args), onMiss)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	entitlements := result.(*timestampedCacheValue).Result().(*entitlementCacheResult)
+	return EntitlementsDigest(entitlements.entitlementData, entitlements.owner), nil
+}
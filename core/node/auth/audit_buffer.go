@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"sync"
+
+	"github.com/towns-protocol/towns/core/config"
+)
+
+// DEFAULT_AUDIT_BUFFER_SIZE is the default number of the latest decisions kept by the audit buffer.
+const DEFAULT_AUDIT_BUFFER_SIZE = 1000
+
+// auditBuffer keeps the audit records of the latest decisions of IsEntitled in memory, so support can look up
+// the recent decisions of a user, see CollectUserAuthBundle. Unlike the records of CheckEntitlementWithAuditLog
+// they don't hold the block number, the wallets and the entitlements digest of the decision, which would take
+// chain reads on every check.
+type auditBuffer struct {
+	mu      sync.Mutex
+	records []AuditRecord
+	// next is the index the next record is written at, the records before it are the latest.
+	next int
+	full bool
+}
+
+var _ AuditSink = (*auditBuffer)(nil)
+
+func newAuditBuffer(cfg *config.ChainConfig) *auditBuffer {
+	size := DEFAULT_AUDIT_BUFFER_SIZE
+	if cfg.EntitlementAuditBufferSize != 0 {
+		size = max(cfg.EntitlementAuditBufferSize, 0)
+	}
+	return &auditBuffer{records: make([]AuditRecord, size)}
+}
+
+// enabled returns false if the buffer keeps no records.
+func (b *auditBuffer) enabled() bool {
+	return len(b.records) > 0
+}
+
+// Write keeps record, replacing the oldest record if the buffer is full.
+func (b *auditBuffer) Write(record AuditRecord) error {
+	if !b.enabled() {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.records[b.next] = record
+	b.next++
+	if b.next == len(b.records) {
+		b.next = 0
+		b.full = true
+	}
+	return nil
+}
+
+// recent returns up to limit of the records that match, the latest first. truncated is true if more records
+// match.
+func (b *auditBuffer) recent(match func(*AuditRecord) bool, limit int) (records []AuditRecord, truncated bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	count := b.next
+	if b.full {
+		count = len(b.records)
+	}
+	records = []AuditRecord{}
+	for i := range count {
+		record := &b.records[(b.next-1-i+len(b.records))%len(b.records)]
+		if !match(record) {
+			continue
+		}
+		if len(records) == limit {
+			return records, true
+		}
+		records = append(records, *record)
+	}
+	return records, false
+}
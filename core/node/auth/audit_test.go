@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+
+	"github.com/towns-protocol/towns/core/config"
+	"github.com/towns-protocol/towns/core/node/base/test"
+	"github.com/towns-protocol/towns/core/node/shared"
+	"github.com/towns-protocol/towns/core/node/testutils"
+)
+
+// fakeAuditSink collects the audit records, or fails to write them if err is set.
+type fakeAuditSink struct {
+	records []AuditRecord
+	err     error
+}
+
+func (s *fakeAuditSink) Write(record AuditRecord) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.records = append(s.records, record)
+	return nil
+}
+
+func TestCheckEntitlementWithAuditLog(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	alice := common.HexToAddress("0xa11ce")
+	bob := common.HexToAddress("0xb0b")
+	linked := common.HexToAddress("0x11e4")
+	ca := newTestChainAuth(t, ctx, newFakeSpaceContract(common.HexToAddress("0x0e"), alice))
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+	channelId := testutils.MakeChannelId(spaceId)
+	sink := &fakeAuditSink{}
+
+	result, err := ca.CheckEntitlementWithAuditLog(
+		ctx, cfg, NewChainAuthArgsForChannel(spaceId, channelId, alice.Hex(), PermissionRead), sink)
+	require.NoError(t, err)
+	require.True(t, result.IsEntitled())
+	require.Len(t, sink.records, 1)
+
+	record := sink.records[0]
+	require.False(t, record.Timestamp.IsZero())
+	require.Equal(t, alice, record.Principal)
+	require.Equal(t, spaceId, record.SpaceId)
+	require.Equal(t, channelId, record.ChannelId)
+	require.Equal(t, PermissionRead, record.Permission)
+	require.Equal(t, AuditDecisionAllow, record.Decision)
+	require.Equal(t, EntitlementResultReason_NONE, record.Reason)
+	require.Equal(t, []common.Address{alice}, record.Wallets)
+	require.Equal(t, DetailsOf(result).WalletSetDigest, record.WalletSetDigest)
+	require.False(t, record.FromCache)
+
+	// Denials are audited with the wallets the caller supplied.
+	result, err = ca.CheckEntitlementWithAuditLog(
+		ctx, cfg, NewChainAuthArgsForIsSpaceMemberV2(spaceId, bob.Hex(), []common.Address{bob, linked}), sink)
+	require.NoError(t, err)
+	require.False(t, result.IsEntitled())
+	require.Len(t, sink.records, 2)
+
+	record = sink.records[1]
+	require.Equal(t, bob, record.Principal)
+	require.Equal(t, AuditDecisionDeny, record.Decision)
+	require.Equal(t, result.Reason(), record.Reason)
+	require.Equal(t, []common.Address{bob, linked}, record.Wallets)
+
+	// Failures to write the record don't fail the check.
+	sink.err = errors.New("sink unavailable")
+	result, err = ca.CheckEntitlementWithAuditLog(
+		ctx, cfg, NewChainAuthArgsForChannel(spaceId, channelId, alice.Hex(), PermissionRead), sink)
+	require.NoError(t, err)
+	require.True(t, result.IsEntitled())
+	require.Len(t, sink.records, 2)
+}
@@ -1,16 +1,17 @@
 package auth
 
 import (
-	"bytes"
 	"context"
 	"errors"
 	"fmt"
-	"github.com/ethereum/go-ethereum"
+	"slices"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sync/semaphore"
+	"golang.org/x/sync/singleflight"
 
 	"github.com/towns-protocol/towns/core/config"
 	"github.com/towns-protocol/towns/core/contracts/base"
@@ -25,43 +26,256 @@ import (
 
 	"github.com/ethereum/go-ethereum/common"
 	ethTypes "github.com/ethereum/go-ethereum/core/types"
+	ethCrypto "github.com/ethereum/go-ethereum/crypto"
 )
 
 type ChainAuth interface {
 	/*
 		IsEntitled algorithm
 		====================
+		The steps are checked against the implementation by the scenarios of testdata/entitlement_policy.json,
+		update both together.
+
 		1. If this check has been recently performed, return the cached result.
 		2. Validate that the space or channel is enabled, depending on whether the request is for a space or channel.
 		   This computation is cached and if a cached result is available, it is used.
 		   If the space or channel is disabled, return false.
+		   If the space doesn't exist, return false with the SPACE_NOT_FOUND reason.
 		3. All linked wallets for the principal are retrieved.
-		4. All linked wallets are checked for space membership. If any are not a space member, the permission check fails.
-		5. If the number of linked wallets exceeds the limit, the permission check fails.
+		4. If the number of linked wallets exceeds the limit, the permission check fails with an error.
+		5. The linked wallets are checked for space membership. If none holds a membership that didn't expire, the
+		   permission check fails.
 		6A. For spaces, the space entitlements are retrieved and checked against all linked wallets.
 			1. If the owner of the space is in the linked wallets, the permission check passes.
-			2. If the space has a rule entitlement, the rule is evaluated against the linked wallets. If it passes,
-			   the permission check passes.
-			3. If the space has a user entitlement, all linked wallets are checked against the user entitlement. If any
+			2. If any of the linked wallets is banned from the space, the permission check fails.
+			3. If the space has a user entitlement including the everyone address, the permission check passes
+			   without evaluating the other entitlements.
+			4. If the space has a rule entitlement, the rule is evaluated against the linked wallets. If it passes,
+			   the permission check passes. If it can't be evaluated, the permission check fails with the
+			   RULE_CHECK_FAILED reason and the result is not cached.
+			5. If the space has a user entitlement, all linked wallets are checked against the user entitlement. If any
 			   linked wallets are in the user entitlement, the permission check passes.
-			4. If none of the above checks pass, the permission check fails.
-		6B. For channels, the space contract method `IsEntitledToChannel` is called for each linked wallet. If any of the
-			linked wallets are entitled to the channel, the permission check passes. Otherwise, it fails.
+			6. If none of the above checks pass, the permission check fails.
+		6B. For channels, the channel entitlements are retrieved and checked against all linked wallets as in 6A.
 	*/
 	IsEntitled(ctx context.Context, cfg *config.Config, args *ChainAuthArgs) (IsEntitledResult, error)
+	// IsEntitledToPermissions checks the permissions of the user in the space, or in the channel if channelId
+	// is set. The results are the results IsEntitled returns for each permission and share its cache, but the
+	// linked wallets, membership and ban status of the user are resolved once for all permissions.
+	//
+	// If some permissions can't be checked, the results of the others are returned along with a
+	// PermissionErrors error holding the error of each failed permission.
+	IsEntitledToPermissions(
+		ctx context.Context,
+		cfg *config.Config,
+		spaceId shared.StreamId,
+		channelId shared.StreamId,
+		userId string,
+		permissions []Permission,
+	) (map[Permission]IsEntitledResult, error)
+	// IsEntitledToChannels checks the permission of the user in each of the channels of the space, e.g. to find
+	// the channels a user joining the space can read. The results are the results IsEntitled returns for each
+	// channel and share its cache, but the linked wallets, membership and ban status of the user are resolved
+	// once for all channels, and the entitlements of the channels are read concurrently.
+	//
+	// If some channels can't be checked, the results of the others are returned along with a ChannelErrors
+	// error holding the error of each failed channel.
+	IsEntitledToChannels(
+		ctx context.Context,
+		cfg *config.Config,
+		spaceId shared.StreamId,
+		channelIds []shared.StreamId,
+		userId string,
+		permission Permission,
+	) (map[shared.StreamId]IsEntitledResult, error)
+	// CheckEntitlementsForPrincipals checks the permission of each of the principals in the space, e.g. to
+	// re-check the members of a space when scrubbing it. The results are the results IsEntitled returns for
+	// each principal and share its cache, but the entitlements of the space and the wallets banned from it are
+	// read once for all principals, and the linked wallets of the principals are served from the cache even
+	// for the Read permission. The principals are checked concurrently within the limits of opts.
+	//
+	// If some principals can't be checked, the results of the others are returned along with a
+	// PrincipalErrors error holding the error of each failed principal.
+	CheckEntitlementsForPrincipals(
+		ctx context.Context,
+		cfg *config.Config,
+		spaceId shared.StreamId,
+		principals []common.Address,
+		permission Permission,
+		opts PrincipalsCheckOpts,
+	) (map[common.Address]IsEntitledResult, error)
+	// ExplainEntitlement runs the check of args like IsEntitled and returns which wallets were found, which
+	// were members, which were banned and which satisfied each entitlement and each operation of its rules,
+	// along with the decision and the step that denied it. It bypasses the caches unless opts.Cached is set and
+	// is much more expensive than IsEntitled, it is meant for debugging access decisions, not for the hot path.
+	ExplainEntitlement(
+		ctx context.Context,
+		cfg *config.Config,
+		args *ChainAuthArgs,
+		opts ExplainOpts,
+	) (*EntitlementExplanation, error)
 	VerifyReceipt(ctx context.Context, cfg *config.Config, receipt *BlockchainTransactionReceipt) (bool, error)
+	// VerifyWalletLink returns true if signature is a valid proof by rootKey that wallet is linked to it, for
+	// links the wallet link contract has not indexed yet. Use NewChainAuthArgsForIsWalletLinked to check the
+	// links of the contract.
+	VerifyWalletLink(
+		ctx context.Context,
+		cfg *config.Config,
+		rootKey common.Address,
+		wallet common.Address,
+		signature []byte,
+	) (bool, error)
+	// IsBanned returns true if any of the wallets linked to the principal is banned from the space.
+	IsBanned(ctx context.Context, cfg *config.Config, spaceId shared.StreamId, principal common.Address) (bool, error)
+	// GetChannelEntitlements returns the entitlements configured on the channel for the permission and the owner
+	// of the space. Results are shared with the cache used to evaluate channel entitlements.
+	GetChannelEntitlements(
+		ctx context.Context,
+		cfg *config.Config,
+		spaceId shared.StreamId,
+		channelId shared.StreamId,
+		permission Permission,
+	) ([]types.Entitlement, common.Address, error)
+	// GetSpaceOwner returns the owner of the space. It shares the cache of the entitlements of the space for
+	// the Read permission, so it doesn't make a contract call for spaces whose entitlements were checked.
+	GetSpaceOwner(ctx context.Context, cfg *config.Config, spaceId shared.StreamId) (common.Address, error)
+	// IsSpaceGated returns whether the permission in the space requires an entitlement, e.g. holding a token,
+	// rather than being granted to everyone, so clients can tell whether to prompt for a wallet. The space is
+	// gated unless a user entitlement grants the permission to everyone and it has no rule entitlements. Members
+	// of a space that isn't gated still need a membership. It shares the cache of the entitlements of the space.
+	IsSpaceGated(ctx context.Context, cfg *config.Config, spaceId shared.StreamId, permission Permission) (bool, error)
+	// GetLinkedWallets returns the wallets linked to the principal through the wallet link contract, including
+	// the wallets that delegated to them on Ethereum mainnet. The principal may be a root key or one of its
+	// linked wallets. The linked wallets are looked up again rather than served from the cache, as the
+	// linked wallets of Read checks are, and the cache is updated with them. Without a wallet link contract
+	// the principal is only linked to itself.
+	//
+	// The principal comes first unless opts exclude it, followed by the other wallets in ascending order of
+	// their addresses, without duplicates. The order doesn't depend on the order the wallets were linked in.
+	GetLinkedWallets(
+		ctx context.Context,
+		cfg *config.Config,
+		principal common.Address,
+		opts LinkedWalletsOpts,
+	) ([]common.Address, error)
+	// IsSpaceEnabled returns whether the space is enabled, without checking the entitlements of a principal.
+	// The result is shared with the cache of the entitlement checks of the space, callers that need a fresher
+	// result than the one returned can force a refresh with ContextWithForceRefresh.
+	IsSpaceEnabled(ctx context.Context, cfg *config.Config, spaceId shared.StreamId) (*StreamEnabledResult, error)
+	// IsChannelEnabled returns whether the channel is enabled, see IsSpaceEnabled. It doesn't check whether the
+	// space of the channel is enabled.
+	IsChannelEnabled(
+		ctx context.Context,
+		cfg *config.Config,
+		spaceId shared.StreamId,
+		channelId shared.StreamId,
+	) (*StreamEnabledResult, error)
+	// GetMembershipStatus returns the membership status of the principal in the space, including the tokens
+	// the principal holds and their expiry. It shares the cache of space membership checks and only considers
+	// the principal, not its linked wallets.
+	GetMembershipStatus(
+		ctx context.Context,
+		cfg *config.Config,
+		spaceId shared.StreamId,
+		principal common.Address,
+	) (*MembershipStatus, error)
+	// GetMembershipExpiry returns when the membership of the principal in the space expires, or when it expired
+	// if it is expired, so clients can warn before it lapses. The zero time is returned if it never expires, and
+	// Err_NOT_FOUND if the principal holds no membership. It is served from the cache of GetMembershipStatus.
+	GetMembershipExpiry(
+		ctx context.Context,
+		cfg *config.Config,
+		spaceId shared.StreamId,
+		principal common.Address,
+	) (time.Time, error)
+	// ListSpaceMembers lists the members of the space by pages of membership tokens for bulk operations such as
+	// analytics or batch revocations, see SpaceContract.ListSpaceMembers for the pages. Pages larger than the
+	// EntitlementMaxMembersPageSize of the config are refused. The members are read from the chain on every call.
+	ListSpaceMembers(
+		ctx context.Context,
+		cfg *config.Config,
+		spaceId shared.StreamId,
+		page int,
+		pageSize int,
+	) ([]common.Address, error)
+}
+
+// LinkedWalletsOpts are the options of ChainAuth.GetLinkedWallets.
+type LinkedWalletsOpts struct {
+	// ExcludePrincipal leaves the principal out of the linked wallets.
+	ExcludePrincipal bool
 }
 
 type isEntitledResult struct {
-	isAllowed bool
-	reason    EntitlementResultReason
+	isAllowed       bool
+	reason          EntitlementResultReason
+	walletSetDigest common.Hash
+	cachedAt        time.Time
+	fromCache       bool
+	reasonChain     []ReasonChainStep
+	ruleDenial      *entitlement.RuleDenial
+	baseChainOnly   bool
+	satisfiedBy     common.Address
+	validUntil      time.Time
 }
 
+// IsEntitledResult is the decision of an entitlement check. It is kept minimal so that implementations outside
+// of this package, e.g. mocks, keep compiling as checks learn more about their decisions. The details of a
+// decision are reported by results that implement DetailedResult, see DetailsOf.
 type IsEntitledResult interface {
 	IsEntitled() bool
 	Reason() EntitlementResultReason
 }
 
+// DetailedResult is implemented by results that report the details of their decision.
+type DetailedResult interface {
+	IsEntitledResult
+	ResultDetails() ResultDetails
+}
+
+// ResultDetails are the details of an entitlement decision beyond the decision and its reason. New details are
+// added as fields, zero values mean the detail is not known or doesn't apply to the decision.
+type ResultDetails struct {
+	// WalletSetDigest identifies the set of linked wallets the check was evaluated against without
+	// revealing the wallets, see WalletSetDigest. It is the zero hash if the check completed before
+	// the linked wallets were resolved.
+	WalletSetDigest common.Hash
+	// CachedAt is the time the oldest data the result was derived from was read from the chain. It is the
+	// time of the check if nothing was served from the caches.
+	CachedAt time.Time
+	// FromCache is true if the result, or the space and channel entitlements it was evaluated with, were
+	// served from the caches.
+	FromCache bool
+	// ReasonChain holds the steps of the decision: the on-chain decision followed by the verdicts of the
+	// policy hooks that ran, see PolicyHook.
+	ReasonChain []ReasonChainStep
+	// RuleDenial is the check of the rule entitlements the user doesn't satisfy if the rule entitlements
+	// of the space or channel denied the check, e.g. to tell the user the token balance they're missing.
+	// It is nil for other results.
+	RuleDenial *entitlement.RuleDenial
+	// BaseChainOnlyWallets is true if the linked wallets the check was evaluated against were read from the
+	// base chain only because the cross-chain evaluator was unavailable, so they miss the wallets delegating to
+	// them on Ethereum mainnet. Such results are cached for a shorter time.
+	BaseChainOnlyWallets bool
+	// SatisfiedBy is the linked wallet that satisfied an allowed check: the owner of the space, the wallet
+	// of a user entitlement, or the wallet a rule entitlement was evaluated against if it was the only one, as
+	// rules may be satisfied by the combined balances of several wallets. It is zero if no single wallet is
+	// known to satisfy the check, e.g. if the entitlements grant everyone, and for denials.
+	SatisfiedBy common.Address
+	// ValidUntil is the time the membership an allowed check was evaluated with expires, callers can
+	// schedule a re-check of the user then. The user may hold other memberships that expire later. It is
+	// zero if the membership doesn't expire or is not known, for checks that don't require one and for denials.
+	ValidUntil time.Time
+}
+
+// DetailsOf returns the details of result, or zero details if result doesn't report them.
+func DetailsOf(result IsEntitledResult) ResultDetails {
+	if detailed, ok := result.(DetailedResult); ok {
+		return detailed.ResultDetails()
+	}
+	return ResultDetails{}
+}
+
 func (r *isEntitledResult) IsEntitled() bool {
 	if r == nil {
 		return false
@@ -76,6 +290,26 @@ func (r *isEntitledResult) Reason() EntitlementResultReason {
 	return r.reason
 }
 
+func (r *isEntitledResult) ResultDetails() ResultDetails {
+	if r == nil {
+		return ResultDetails{}
+	}
+	details := ResultDetails{
+		WalletSetDigest:      r.walletSetDigest,
+		CachedAt:             r.cachedAt,
+		FromCache:            r.fromCache,
+		ReasonChain:          r.reasonChain,
+		BaseChainOnlyWallets: r.baseChainOnly,
+	}
+	if r.isAllowed {
+		details.SatisfiedBy = r.satisfiedBy
+		details.ValidUntil = r.validUntil
+	} else {
+		details.RuleDenial = r.ruleDenial
+	}
+	return details
+}
+
 var everyone = common.HexToAddress("0x1") // This represents an Ethereum address of "0x1"
 
 func NewChainAuthArgsForSpace(spaceId shared.StreamId, userId string, permission Permission) *ChainAuthArgs {
@@ -102,6 +336,61 @@ func NewChainAuthArgsForChannel(
 	}
 }
 
+// NewChainAuthArgsForCustomPermission creates arguments for checking an app-defined permission, such as
+// "CAN_MINT_NFT", that is granted by the roles of the space like the built-in permissions. The permission is
+// checked in the channel if channelId is set and in the space otherwise. Users are not entitled to names
+// that no role grants.
+func NewChainAuthArgsForCustomPermission(
+	spaceId shared.StreamId,
+	channelId shared.StreamId,
+	userId string,
+	permissionName string,
+) *ChainAuthArgs {
+	args := NewChainAuthArgsForSpace(spaceId, userId, PermissionUndefined)
+	if channelId != (shared.StreamId{}) {
+		args = NewChainAuthArgsForChannel(spaceId, channelId, userId, PermissionUndefined)
+	}
+	args.customPermission = permissionName
+	return args
+}
+
+// NewChainAuthArgsForIsChannelModerator creates arguments for checking whether the user may moderate the
+// channel, e.g. mute or kick members and pin messages. Moderators are granted PermissionModifyChannel in the
+// channel, the check is evaluated like the channel checks of the permission and its denials by the
+// entitlements of the channel have the NOT_MODERATOR reason.
+func NewChainAuthArgsForIsChannelModerator(
+	spaceId shared.StreamId,
+	channelId shared.StreamId,
+	userId string,
+) *ChainAuthArgs {
+	return &ChainAuthArgs{
+		kind:       chainAuthKindChannelModerator,
+		spaceId:    spaceId,
+		channelId:  channelId,
+		principal:  common.HexToAddress(userId),
+		permission: PermissionModifyChannel,
+	}
+}
+
+// NewChainAuthArgsForApp creates arguments for checking whether an app, such as a bot, installed in the space is
+// entitled to the permission. Apps act under their own address: they have no linked wallets and hold no
+// membership, the space contract tells whether the app is installed and granted the permission. Apps are
+// granted their permissions for the whole space, a check in a channel also requires the channel to be enabled.
+func NewChainAuthArgsForApp(
+	spaceId shared.StreamId,
+	channelId shared.StreamId,
+	appAddress common.Address,
+	permission Permission,
+) *ChainAuthArgs {
+	return &ChainAuthArgs{
+		kind:       chainAuthKindApp,
+		spaceId:    spaceId,
+		channelId:  channelId,
+		principal:  appAddress,
+		permission: permission,
+	}
+}
+
 func NewChainAuthArgsForIsSpaceMember(spaceId shared.StreamId, userId string) *ChainAuthArgs {
 	return &ChainAuthArgs{
 		kind:      chainAuthKindIsSpaceMember,
@@ -110,6 +399,46 @@ func NewChainAuthArgsForIsSpaceMember(spaceId shared.StreamId, userId string) *C
 	}
 }
 
+// NewChainAuthArgsForSpaceWithWallets creates arguments for checking whether any wallet in the given set is
+// entitled to the permission in the space. The wallets are used as is, no linked wallets are looked up, and
+// the check is subject to the same linked wallets limit.
+func NewChainAuthArgsForSpaceWithWallets(
+	spaceId shared.StreamId,
+	wallets []common.Address,
+	permission Permission,
+) *ChainAuthArgs {
+	return (&ChainAuthArgs{
+		kind:       chainAuthKindSpace,
+		spaceId:    spaceId,
+		permission: permission,
+	}).WithPreFetchedWallets(wallets)
+}
+
+// NewChainAuthArgsForChannelWithWallets is the channel equivalent of NewChainAuthArgsForSpaceWithWallets.
+func NewChainAuthArgsForChannelWithWallets(
+	spaceId shared.StreamId,
+	channelId shared.StreamId,
+	wallets []common.Address,
+	permission Permission,
+) *ChainAuthArgs {
+	return (&ChainAuthArgs{
+		kind:       chainAuthKindChannel,
+		spaceId:    spaceId,
+		channelId:  channelId,
+		permission: permission,
+	}).WithPreFetchedWallets(wallets)
+}
+
+// NewChainAuthArgsForIsSpaceMemberV2 is like NewChainAuthArgsForIsSpaceMember, but evaluates membership against
+// linked wallets the caller already fetched instead of looking them up again.
+func NewChainAuthArgsForIsSpaceMemberV2(
+	spaceId shared.StreamId,
+	userId string,
+	linkedWallets []common.Address,
+) *ChainAuthArgs {
+	return NewChainAuthArgsForIsSpaceMember(spaceId, userId).WithPreFetchedWallets(linkedWallets)
+}
+
 func NewChainAuthArgsForIsWalletLinked(
 	userAddress []byte,
 	walletAddress []byte,
@@ -130,8 +459,32 @@ const (
 	chainAuthKindChannelEnabled
 	chainAuthKindIsSpaceMember
 	chainAuthKindIsWalletLinked
+	chainAuthKindIsBanned
+	chainAuthKindBannedWallets
+	chainAuthKindChannelModerator
+	chainAuthKindApp
 )
 
+var chainAuthKindNames = []string{
+	"space",
+	"channel",
+	"spaceEnabled",
+	"channelEnabled",
+	"isSpaceMember",
+	"isWalletLinked",
+	"isBanned",
+	"bannedWallets",
+	"channelModerator",
+	"app",
+}
+
+func (k chainAuthKind) String() string {
+	if k < 0 || int(k) >= len(chainAuthKindNames) {
+		return fmt.Sprintf("chainAuthKind(%d)", int(k))
+	}
+	return chainAuthKindNames[k]
+}
+
 type ChainAuthArgs struct {
 	kind          chainAuthKind
 	spaceId       shared.StreamId
@@ -140,35 +493,183 @@ type ChainAuthArgs struct {
 	permission    Permission
 	linkedWallets string // a serialized list of linked wallets to comply with the cache key constraints
 	walletAddress common.Address
+	// customPermission is the name of an app-defined permission, it replaces permission if set.
+	customPermission string
+	// preFetchedWallets is a serialized list of linked wallets supplied by the caller. If
+	// hasPreFetchedWallets is set the linked wallets are not looked up.
+	preFetchedWallets    string
+	hasPreFetchedWallets bool
+	// generation is the generation of the space the key was captured with, see spaceGenerations.
+	generation uint64
+	// forceRefresh is set by WithForceRefresh. It is not part of the cache key: IsEntitled and
+	// getMembershipStatus clear it before looking up the caches.
+	forceRefresh bool
+	// timeout is set by WithTimeout, 0 if not set. Like forceRefresh it is not part of the cache key.
+	timeout time.Duration
+	// chainId is the chain the space lives on, see WithChainId. 0 is the default chain of chainAuth.
+	chainId uint64
+	// permissions is a serialized list of the permissions checked instead of permission, combined as
+	// permissionMode tells, see WithPermissions.
+	permissions    string
+	permissionMode PermissionMode
 }
 
 func (args *ChainAuthArgs) Principal() common.Address {
 	return args.principal
 }
 
+func (args *ChainAuthArgs) SpaceId() shared.StreamId {
+	return args.spaceId
+}
+
+// ChannelId returns the channel of the check, the zero stream id if the check is not scoped to a channel.
+func (args *ChainAuthArgs) ChannelId() shared.StreamId {
+	return args.channelId
+}
+
 func (args *ChainAuthArgs) String() string {
 	return fmt.Sprintf(
-		"ChainAuthArgs{kind: %d, spaceId: %s, channelId: %s, principal: %s, permission: %s, linkedWallets: %s, walletAddress: %s}",
+		"ChainAuthArgs{kind: %d, spaceId: %s, channelId: %s, principal: %s, permission: %s, customPermission: %s, linkedWallets: %s, walletAddress: %s, preFetchedWallets: %s, generation: %d, chainId: %d, permissions: %s, permissionMode: %s}",
 		args.kind,
 		args.spaceId,
 		args.channelId,
 		args.principal.Hex(),
 		args.permission,
+		args.customPermission,
 		args.linkedWallets,
 		args.walletAddress.Hex(),
+		args.preFetchedWallets,
+		args.generation,
+		args.chainId,
+		args.permissions,
+		args.permissionMode,
 	)
 }
 
-func (args *ChainAuthArgs) withLinkedWallets(linkedWallets []common.Address) *ChainAuthArgs {
+// WithPreFetchedWallets returns a copy of args that is evaluated against the given linked wallets
+// instead of fetching them. The wallets are expected to include the principal, as the linked wallets
+// returned by the wallet link contract do.
+func (args *ChainAuthArgs) WithPreFetchedWallets(wallets []common.Address) *ChainAuthArgs {
 	ret := *args
-	var builder strings.Builder
-	for i, addr := range linkedWallets {
-		if i > 0 {
-			builder.WriteString(",")
-		}
-		builder.WriteString(addr.Hex())
+	ret.preFetchedWallets = serializeWallets(wallets)
+	ret.hasPreFetchedWallets = true
+	return &ret
+}
+
+// WithForceRefresh returns a copy of args whose check bypasses the caches: all results the check depends on
+// are computed from the chain and written back to the caches, so subsequent checks see them as well.
+// It is meant for internal tooling that needs an authoritative answer, e.g. after executing a ban, and must
+// never be derived from client input.
+func (args *ChainAuthArgs) WithForceRefresh() *ChainAuthArgs {
+	ret := *args
+	ret.forceRefresh = true
+	return &ret
+}
+
+// WithTimeout returns a copy of args whose check gives up after timeout instead of the contract calls timeout
+// chainAuth was configured with, e.g. a short timeout for interactive checks and a long one for background
+// checks that can wait for the evaluation of cross-chain rules. The timeout is capped by the
+// EntitlementMaxCallTimeout of the config. It doesn't change which cached results the check is served.
+func (args *ChainAuthArgs) WithTimeout(timeout time.Duration) *ChainAuthArgs {
+	ret := *args
+	ret.timeout = timeout
+	return &ret
+}
+
+// WithChainId returns a copy of args that is evaluated against the space contracts of the given chain instead
+// of the default chain of chainAuth. The chain must be one of the chains chainAuth was constructed with.
+func (args *ChainAuthArgs) WithChainId(chainId uint64) *ChainAuthArgs {
+	ret := *args
+	ret.chainId = chainId
+	return &ret
+}
+
+// WithPermission returns a copy of args that checks the permission instead. It replaces the app-defined
+// permission of args created with NewChainAuthArgsForCustomPermission.
+func (args *ChainAuthArgs) WithPermission(permission Permission) *ChainAuthArgs {
+	ret := *args
+	ret.permission = permission
+	ret.customPermission = ""
+	ret.permissions = ""
+	ret.permissionMode = RequireAll
+	return &ret
+}
+
+// WithPermissions returns a copy of args that checks several permissions at once: with RequireAll the check is
+// allowed if the principal holds all of them, with RequireAny if it holds at least one. The linked wallets,
+// membership and ban status of the principal are resolved once for all permissions, and the evaluation stops
+// at the first permission that decides the check. The result is the result of that permission, or of the last
+// permission checked. Denied checks are denied with RULE_CHECK_FAILED if a permission couldn't be checked.
+//
+// Only space and channel checks can hold several permissions. A single permission is checked like WithPermission.
+func (args *ChainAuthArgs) WithPermissions(mode PermissionMode, permissions ...Permission) *ChainAuthArgs {
+	if len(permissions) == 1 {
+		return args.WithPermission(permissions[0])
+	}
+	ret := *args
+	ret.permission = PermissionUndefined
+	ret.customPermission = ""
+	ret.permissions = serializePermissions(permissions)
+	ret.permissionMode = mode
+	return &ret
+}
+
+// hasPermission reports whether args check the permission, alone or as one of their permissions.
+func (args *ChainAuthArgs) hasPermission(permission Permission) bool {
+	if args.permissions == "" {
+		return args.permission == permission
 	}
-	ret.linkedWallets = builder.String()
+	return slices.Contains(deserializePermissions(args.permissions), permission)
+}
+
+// WithLinkedWallets returns a copy of args that is evaluated against the given linked wallets instead of
+// fetching them, see WithPreFetchedWallets.
+func (args *ChainAuthArgs) WithLinkedWallets(wallets []common.Address) *ChainAuthArgs {
+	return args.WithPreFetchedWallets(wallets)
+}
+
+// WithWalletAddress returns a copy of args created with NewChainAuthArgsForIsWalletLinked that checks whether
+// the given wallet is linked to the principal instead.
+func (args *ChainAuthArgs) WithWalletAddress(wallet common.Address) *ChainAuthArgs {
+	ret := *args
+	ret.walletAddress = wallet
+	return &ret
+}
+
+// withoutCallOptions returns ctx and args to look up the caches with. The options of args that are not part of
+// the cache key, the forced refresh and the timeout, are moved from args to the returned context.
+func (args *ChainAuthArgs) withoutCallOptions(ctx context.Context) (context.Context, *ChainAuthArgs) {
+	if !args.forceRefresh && args.timeout == 0 {
+		return ctx, args
+	}
+	ret := *args
+	if ret.forceRefresh {
+		ctx = withForceRefresh(ctx)
+		ret.forceRefresh = false
+	}
+	if ret.timeout != 0 {
+		ctx = context.WithValue(ctx, callTimeoutCtxKey{}, ret.timeout)
+		ret.timeout = 0
+	}
+	return ctx, &ret
+}
+
+type callTimeoutCtxKey struct{}
+
+// callTimeout returns the timeout set on the check with WithTimeout, capped by maxTimeout, or defaultTimeout if
+// none was set.
+func callTimeout(ctx context.Context, defaultTimeout time.Duration, maxTimeout time.Duration) time.Duration {
+	timeout, ok := ctx.Value(callTimeoutCtxKey{}).(time.Duration)
+	if !ok || timeout <= 0 {
+		return defaultTimeout
+	}
+	return min(timeout, maxTimeout)
+}
+
+// asChannelCheck returns a copy of the channel moderator check args as the channel check of its permission.
+func (args *ChainAuthArgs) asChannelCheck() *ChainAuthArgs {
+	ret := *args
+	ret.kind = chainAuthKindChannel
 	return &ret
 }
 
@@ -179,6 +680,22 @@ func newArgsForEnabledSpace(spaceId shared.StreamId) *ChainAuthArgs {
 	}
 }
 
+func newArgsForIsBanned(spaceId shared.StreamId, principal common.Address) *ChainAuthArgs {
+	return &ChainAuthArgs{
+		kind:      chainAuthKindIsBanned,
+		spaceId:   spaceId,
+		principal: principal,
+	}
+}
+
+func newArgsForIsSpaceMember(spaceId shared.StreamId, principal common.Address) *ChainAuthArgs {
+	return &ChainAuthArgs{
+		kind:      chainAuthKindIsSpaceMember,
+		spaceId:   spaceId,
+		principal: principal,
+	}
+}
+
 func newArgsForEnabledChannel(spaceId shared.StreamId, channelId shared.StreamId) *ChainAuthArgs {
 	return &ChainAuthArgs{
 		kind:      chainAuthKindChannelEnabled,
@@ -194,50 +711,166 @@ func newArgsForLinkedWallets(principal common.Address) *ChainAuthArgs {
 	}
 }
 
+// Used as a cache key for entitlement manager lookups. Roles and entitlements only depend on the
+// space, channel and permission, so the principal and linked wallets are left out of the key and a
+// single contract fetch serves every user in the space.
+func newArgsForEntitlementManager(args *ChainAuthArgs) *ChainAuthArgs {
+	return &ChainAuthArgs{
+		kind:             args.kind,
+		spaceId:          args.spaceId,
+		channelId:        args.channelId,
+		permission:       args.permission,
+		customPermission: args.customPermission,
+		chainId:          args.chainId,
+	}
+}
+
 const (
 	DEFAULT_REQUEST_TIMEOUT_MS = 10000
 	DEFAULT_MAX_WALLETS        = 10
+	// DEFAULT_MAX_CALL_TIMEOUT caps the timeouts set on single checks with ChainAuthArgs.WithTimeout.
+	DEFAULT_MAX_CALL_TIMEOUT = time.Minute
+	// DEFAULT_MAX_MEMBERS_PAGE_SIZE caps the page size of ListSpaceMembers.
+	DEFAULT_MAX_MEMBERS_PAGE_SIZE = 1000
+	// DEFAULT_MAX_CONCURRENT_MEMBERSHIP_CHECKS bounds the membership calls in flight across all checks.
+	DEFAULT_MAX_CONCURRENT_MEMBERSHIP_CHECKS = 128
 )
 
 type chainAuth struct {
 	blockchain              *crypto.Blockchain
 	evaluator               *entitlement.Evaluator
 	spaceContract           SpaceContract
-	walletLinkContract      *base.WalletLink
-	linkedWalletsLimit      int
+	chains                  map[uint64]*entitlementChain
+	walletResolver          *WalletResolver
+	walletLinkAddress       common.Address
+	receiptVerifier         *ReceiptVerifier
+	rpcRetry                rpcRetryPolicy
+	linkedWalletsLimit      *linkedWalletsLimit
 	contractCallsTimeoutMs  int
+	maxCallTimeout          time.Duration
+	maxMembersPageSize      int
 	entitlementCache        *entitlementCache
 	membershipCache         *entitlementCache
 	entitlementManagerCache *entitlementCache
 	linkedWalletCache       *entitlementCache
-
-	isEntitledToChannelCacheHit  prometheus.Counter
-	isEntitledToChannelCacheMiss prometheus.Counter
-	isEntitledToSpaceCacheHit    prometheus.Counter
-	isEntitledToSpaceCacheMiss   prometheus.Counter
-	isSpaceEnabledCacheHit       prometheus.Counter
-	isSpaceEnabledCacheMiss      prometheus.Counter
-	isChannelEnabledCacheHit     prometheus.Counter
-	isChannelEnabledCacheMiss    prometheus.Counter
-	entitlementCacheHit          prometheus.Counter
-	entitlementCacheMiss         prometheus.Counter
-	linkedWalletCacheHit         prometheus.Counter
-	linkedWalletCacheMiss        prometheus.Counter
-	linkedWalletCacheBust        prometheus.Counter
-	membershipCacheHit           prometheus.Counter
-	membershipCacheMiss          prometheus.Counter
+	appCache                *entitlementCache
+	banCache                *entitlementCache
+	banListDigests          *banListDigests
+	cacheWal                *cacheWal
+	invalidator             *cacheInvalidator
+	warmer                  *cacheWarmer
+	selfTester              *selfTester
+	dualReader              *dualReader
+	joinPrewarmer           *joinPrewarmer
+	workQueue               *workQueue
+	computeLimiter          *computeLimiter
+	membershipChecks        *semaphore.Weighted
+	simulations             *semaphore.Weighted
+	argsPool                *chainAuthArgsPool
+	readOnly                *readOnlyMode
+	policyHooks             *policyHooks
+	denialHooks             *denialHooks
+	auditBuffer             *auditBuffer
+	invalidations           *cacheInvalidations
+	linkedWalletLookups     singleflight.Group
+	allocSampler            *allocSampler
+	generations             *spaceGenerations
+	slowCheckThreshold      time.Duration
+	fastPaths               *fastPathChecks
+	// walletsFallbackTTL is how long linked wallets read from the base chain only are cached.
+	walletsFallbackTTL time.Duration
+	metrics            infra.MetricsFactory
+	// clock tells the time cached results and memberships expire at, see setClock.
+	clock       Clock
+	cacheMemory *cacheMemory
+
+	// closeCtx is cancelled when chainAuth is closed, which stops the background workers.
+	closeMu     sync.Mutex
+	closeCtx    context.Context
+	closeCancel context.CancelFunc
+	workers     sync.WaitGroup
+
+	// flushMu serializes FlushAllCaches.
+	flushMu sync.Mutex
+
+	// observer observes the internal decisions, see SetObserver.
+	observer entitlementObserver
+
+	isEntitledCacheHit           *cacheCounter
+	isEntitledCacheMiss          *cacheCounter
+	isEntitledToChannelCacheHit  *cacheCounter
+	isEntitledToChannelCacheMiss *cacheCounter
+	isEntitledToSpaceCacheHit    *cacheCounter
+	isEntitledToSpaceCacheMiss   *cacheCounter
+	isSpaceEnabledCacheHit       *cacheCounter
+	isSpaceEnabledCacheMiss      *cacheCounter
+	isChannelEnabledCacheHit     *cacheCounter
+	isChannelEnabledCacheMiss    *cacheCounter
+	entitlementCacheHit          *cacheCounter
+	entitlementCacheMiss         *cacheCounter
+	entitlementManagerCacheHit   *cacheCounter
+	entitlementManagerCacheMiss  *cacheCounter
+	linkedWalletCacheHit         *cacheCounter
+	linkedWalletCacheMiss        *cacheCounter
+	linkedWalletCacheBust        *cacheCounter
+	linkedWalletCollapsed        *cacheCounter
+	membershipCacheHit           *cacheCounter
+	membershipCacheMiss          *cacheCounter
+	banCacheHit                  *cacheCounter
+	banCacheMiss                 *cacheCounter
+	appCacheHit                  *cacheCounter
+	appCacheMiss                 *cacheCounter
+
+	// cacheCounters and coalescedCounters are the vectors of the cache counters above and of the coalesced
+	// misses of the caches, see initCacheCounters.
+	cacheCounters     *prometheus.CounterVec
+	coalescedCounters *prometheus.CounterVec
+
+	// denialReasons counts the negative results computed by checkEntitlement by reason.
+	denialReasons *prometheus.CounterVec
+	// linkedWalletsFallbacks counts the linked wallet lookups that fell back to the base chain by result.
+	linkedWalletsFallbacks *prometheus.CounterVec
 }
 
 var _ ChainAuth = (*chainAuth)(nil)
 
+// ChainAuthOption configures optional behavior of the chainAuth returned by NewChainAuth.
+type ChainAuthOption func(*chainAuthOptions)
+
+type chainAuthOptions struct {
+	clock                          Clock
+	linkedWalletsLimitByPermission map[string]int
+}
+
+// WithClock makes chainAuth and its caches read the time from clock instead of the system clock, e.g. for tests
+// to control the expiry of cached results without waiting.
+func WithClock(clock Clock) ChainAuthOption {
+	return func(opts *chainAuthOptions) {
+		opts.clock = clock
+	}
+}
+
+// WithLinkedWalletsLimitByPermission overrides the linked wallets limit for the checks of the given permissions,
+// keyed by permission name, see config.Config.LinkedWalletsLimitByPermission.
+func WithLinkedWalletsLimitByPermission(limits map[string]int) ChainAuthOption {
+	return func(opts *chainAuthOptions) {
+		opts.linkedWalletsLimitByPermission = limits
+	}
+}
+
 func NewChainAuth(
 	ctx context.Context,
 	blockchain *crypto.Blockchain,
+	chains map[uint64]*EntitlementChain,
 	evaluator *entitlement.Evaluator,
 	architectCfg *config.ContractConfig,
 	linkedWalletsLimit int,
 	contractCallsTimeoutMs int,
+	maxConcurrentMembershipChecks int,
+	cacheExpiryJitterPercent int,
+	diskCacheCfg *config.DiskCacheConfig,
 	metrics infra.MetricsFactory,
+	opts ...ChainAuthOption,
 ) (*chainAuth, error) {
 	// instantiate contract facets from diamond configuration
 	spaceContract, err := NewSpaceContractV3(ctx, architectCfg, blockchain.Config, blockchain.Client)
@@ -250,187 +883,659 @@ func NewChainAuth(
 		return nil, err
 	}
 
-	entitlementCache, err := newEntitlementCache(ctx, blockchain.Config)
+	entitlementChains, err := newEntitlementChains(ctx, architectCfg, chains, evaluator)
+	if err != nil {
+		return nil, err
+	}
+
+	ca, err := newChainAuth(
+		ctx,
+		blockchain,
+		evaluator,
+		spaceContract,
+		entitlementChains,
+		walletLinkContract,
+		linkedWalletsLimit,
+		contractCallsTimeoutMs,
+		maxConcurrentMembershipChecks,
+		cacheExpiryJitterPercent,
+		diskCacheCfg,
+		metrics,
+		opts...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	ca.walletLinkAddress = architectCfg.Address
+	return ca, nil
+}
+
+func newChainAuth(
+	ctx context.Context,
+	blockchain *crypto.Blockchain,
+	evaluator *entitlement.Evaluator,
+	spaceContract SpaceContract,
+	chains map[uint64]*entitlementChain,
+	walletLinkContract *base.WalletLink,
+	linkedWalletsLimit int,
+	contractCallsTimeoutMs int,
+	maxConcurrentMembershipChecks int,
+	cacheExpiryJitterPercent int,
+	diskCacheCfg *config.DiskCacheConfig,
+	metrics infra.MetricsFactory,
+	opts ...ChainAuthOption,
+) (*chainAuth, error) {
+	var options chainAuthOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	var denyList PolicyHook
+	if !blockchain.Config.EntitlementDenyList.IsEmpty() {
+		var err error
+		if denyList, err = NewDenyListPolicyHook(&blockchain.Config.EntitlementDenyList); err != nil {
+			return nil, err
+		}
+	}
+
+	limitByPermission, err := parseLinkedWalletsLimitByPermission(options.linkedWalletsLimitByPermission)
+	if err != nil {
+		return nil, err
+	}
+
+	entitlementCache, err := newEntitlementCache(ctx, blockchain.Config, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	membershipCache, err := newEntitlementCache(ctx, blockchain.Config)
+	membershipCache, err := newEntitlementCache(ctx, blockchain.Config, nil)
 	if err != nil {
 		return nil, err
 	}
 
 	// separate cache for entitlement manager as the timeouts are shorter
-	entitlementManagerCache, err := newEntitlementManagerCache(ctx, blockchain.Config)
+	entitlementManagerCache, err := newEntitlementManagerCache(ctx, blockchain.Config, metrics, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	linkedWalletCache, err := newLinkedWalletCache(ctx, blockchain.Config)
+	linkedWalletCache, err := newLinkedWalletCache(ctx, blockchain.Config, nil)
 	if err != nil {
 		return nil, err
 	}
 
-	if linkedWalletsLimit <= 0 {
-		linkedWalletsLimit = DEFAULT_MAX_WALLETS
+	banCache, err := newBanCache(ctx, blockchain.Config)
+	if err != nil {
+		return nil, err
+	}
+
+	banListDigests, err := newBanListDigests(blockchain.Config)
+	if err != nil {
+		return nil, err
 	}
+
+	// separate cache for the checks of apps, which don't depend on linked wallets and memberships
+	appCache, err := newEntitlementCache(ctx, blockchain.Config, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Without a clock, the caches expire their entries with the system clock. The clock is set before the
+	// caches are restored from disk, which drops the entries that expired while the node was down.
+	clock := options.clock
+	if clock == nil {
+		clock = realClock{}
+	}
+	entitlementCache.clock = clock
+	membershipCache.clock = clock
+	entitlementManagerCache.clock = clock
+	linkedWalletCache.clock = clock
+	banCache.clock = clock
+	appCache.clock = clock
+
+	// Caches of results that depend on the space are invalidated by incrementing its generation.
+	generations := newSpaceGenerations()
+	entitlementCache.generations = generations
+	membershipCache.generations = generations
+	entitlementManagerCache.generations = generations
+	banCache.generations = generations
+	appCache.generations = generations
+
+	// Spread the expiry of entries cached together, e.g. after a restart or a mass invalidation,
+	// so that popular spaces don't re-fetch all their entitlements at once.
+	entitlementCache.setExpiryJitter(cacheExpiryJitterPercent)
+	membershipCache.setExpiryJitter(cacheExpiryJitterPercent)
+	appCache.setExpiryJitter(cacheExpiryJitterPercent)
+
+	// The memory of the entries is accounted for before the caches are restored from disk.
+	memory := newCacheMemory(blockchain.Config, metrics, cacheMemoryCaches{
+		"entitlement":        entitlementCache,
+		"membership":         membershipCache,
+		"entitlementManager": entitlementManagerCache,
+		"linkedWallet":       linkedWalletCache,
+		"banList":            banCache,
+		"app":                appCache,
+	})
+
+	var wal *cacheWal
+	if diskCacheCfg != nil && diskCacheCfg.Path != "" {
+		restorePolicy := cacheWalRestorePolicy{
+			maxAge:    diskCacheCfg.MaxRestoreAge,
+			blockTime: blockchain.Config.BlockTime(),
+			outcomes: metrics.NewCounterVecEx(
+				"entitlement_cache_restored",
+				"Entitlement cache entries read from disk at startup, by whether they were restored",
+				"cache",
+				"outcome",
+			),
+		}
+		// Without the head, entries are only checked against their timestamps.
+		if blockchain.Client != nil {
+			if restorePolicy.head, err = blockchain.Client.BlockNumber(ctx); err != nil {
+				logging.FromCtx(ctx).Warnw("Failed to read the head of the base chain to restore the entitlement caches",
+					"error", err)
+			}
+		}
+		wal, err = openCacheWal(ctx, diskCacheCfg, cacheWalCaches{
+			"entitlement":        entitlementCache,
+			"membership":         membershipCache,
+			"entitlementManager": entitlementManagerCache,
+			"linkedWallet":       linkedWalletCache,
+			"app":                appCache,
+		}, banListDigests, restorePolicy, clock)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	invalidator := newCacheInvalidator(
+		blockchain.Config.EntitlementInvalidationMaxScopesPerBlock,
+		metrics,
+		entitlementCache,
+		membershipCache,
+		entitlementManagerCache,
+		banCache,
+		appCache,
+	)
+
+	walletsLimit := newLinkedWalletsLimit(
+		linkedWalletsLimit,
+		limitByPermission,
+		metrics.NewGaugeEx(
+			"linked_wallets_over_limit",
+			"Number of principals with more linked wallets than the limit in their most recent check",
+		),
+	)
 	if contractCallsTimeoutMs <= 0 {
 		contractCallsTimeoutMs = DEFAULT_REQUEST_TIMEOUT_MS
 	}
+	if maxConcurrentMembershipChecks <= 0 {
+		maxConcurrentMembershipChecks = DEFAULT_MAX_CONCURRENT_MEMBERSHIP_CHECKS
+	}
 
 	counter := metrics.NewCounterVecEx(
-		"entitlement_cache", "Cache hits and misses for entitlement caches", "function", "result")
+		"entitlement_cache",
+		"Cache hits and misses for entitlement caches, by the reason of the cached denial",
+		"function",
+		"result",
+		"reason",
+	)
+
+	coalesced := metrics.NewCounterVecEx(
+		"entitlement_cache_coalesced", "Cache misses that waited for an identical in-flight lookup", "cache")
 
-	return &chainAuth{
+	rpcRetry := newRpcRetryPolicy(blockchain.Config, metrics.NewCounterVecEx(
+		"entitlement_rpc_retries", "Chain calls retried after a transient error", "op"))
+	receiptVerifier := NewReceiptVerifier(evaluator)
+	receiptVerifier.retry = rpcRetry
+	receiptVerifier.metrics = newReceiptMetrics(metrics)
+
+	warmingConcurrency := DEFAULT_CACHE_WARMING_CONCURRENCY
+	if blockchain.Config.EntitlementCacheWarmConcurrency > 0 {
+		warmingConcurrency = blockchain.Config.EntitlementCacheWarmConcurrency
+	}
+	warmingTimeout := DEFAULT_CACHE_WARMING_TIMEOUT
+	if blockchain.Config.EntitlementCacheWarmTimeout > 0 {
+		warmingTimeout = blockchain.Config.EntitlementCacheWarmTimeout
+	}
+	slowCheckThreshold := DEFAULT_SLOW_CHECK_THRESHOLD
+	if blockchain.Config.EntitlementSlowCheckThreshold > 0 {
+		slowCheckThreshold = blockchain.Config.EntitlementSlowCheckThreshold
+	}
+	maxCallTimeout := DEFAULT_MAX_CALL_TIMEOUT
+	if blockchain.Config.EntitlementMaxCallTimeout > 0 {
+		maxCallTimeout = blockchain.Config.EntitlementMaxCallTimeout
+	}
+	maxMembersPageSize := DEFAULT_MAX_MEMBERS_PAGE_SIZE
+	if blockchain.Config.EntitlementMaxMembersPageSize > 0 {
+		maxMembersPageSize = blockchain.Config.EntitlementMaxMembersPageSize
+	}
+	walletsFallbackTTL := DEFAULT_LINKED_WALLETS_FALLBACK_TTL
+	if blockchain.Config.LinkedWalletsFallbackTTL > 0 {
+		walletsFallbackTTL = blockchain.Config.LinkedWalletsFallbackTTL
+	}
+	warmingCounter := metrics.NewCounterVecEx(
+		"entitlement_cache_warming", "Spaces whose entitlement caches were warmed at startup", "result")
+
+	walletResolver := NewWalletResolver(evaluator, walletLinkContract, WalletResolverMetrics{})
+
+	tester := &selfTester{
+		spaceContract:  spaceContract,
+		walletResolver: walletResolver,
+		caches: []selfTestCache{
+			{"entitlement", entitlementCache},
+			{"membership", membershipCache},
+			{"entitlementManager", entitlementManagerCache},
+			{"linkedWallet", linkedWalletCache},
+			{"banList", banCache},
+			{"app", appCache},
+		},
+		canarySpaceId: blockchain.Config.EntitlementSelfTestSpaceId,
+		timeout:       DEFAULT_SELF_TEST_TIMEOUT,
+	}
+	if blockchain.Client != nil {
+		tester.baseChain = blockchain.Client
+	}
+	if evaluator != nil {
+		tester.xchainClients = evaluator
+	}
+	if blockchain.Config.EntitlementSelfTestTimeout > 0 {
+		tester.timeout = blockchain.Config.EntitlementSelfTestTimeout
+	}
+
+	closeCtx, closeCancel := context.WithCancel(context.Background())
+
+	ca := &chainAuth{
 		blockchain:              blockchain,
 		evaluator:               evaluator,
 		spaceContract:           spaceContract,
-		walletLinkContract:      walletLinkContract,
-		linkedWalletsLimit:      linkedWalletsLimit,
+		chains:                  chains,
+		walletResolver:          walletResolver,
+		receiptVerifier:         receiptVerifier,
+		rpcRetry:                rpcRetry,
+		linkedWalletsLimit:      walletsLimit,
 		contractCallsTimeoutMs:  contractCallsTimeoutMs,
+		maxCallTimeout:          maxCallTimeout,
+		maxMembersPageSize:      maxMembersPageSize,
+		membershipChecks:        semaphore.NewWeighted(int64(maxConcurrentMembershipChecks)),
+		simulations:             newSimulations(blockchain.Config),
+		argsPool:                newChainAuthArgsPool(),
+		readOnly:                newReadOnlyMode(metrics),
+		policyHooks:             newPolicyHooks(blockchain.Config, metrics),
+		allocSampler:            newAllocSampler(blockchain.Config, metrics),
+		auditBuffer:             newAuditBuffer(blockchain.Config),
+		invalidations:           newCacheInvalidations(),
+		clock:                   clock,
+		cacheMemory:             memory,
 		entitlementCache:        entitlementCache,
 		membershipCache:         membershipCache,
 		entitlementManagerCache: entitlementManagerCache,
 		linkedWalletCache:       linkedWalletCache,
+		appCache:                appCache,
+		banCache:                banCache,
+		banListDigests:          banListDigests,
+		cacheWal:                wal,
+		invalidator:             invalidator,
+		generations:             generations,
+		selfTester:              tester,
+		dualReader:              newDualReader(blockchain.Config, metrics),
+		joinPrewarmer:           newJoinPrewarmer(blockchain.Config, metrics),
+		computeLimiter:          newComputeLimiter(blockchain.Config.EntitlementMaxConcurrentChecks, metrics),
+		slowCheckThreshold:      slowCheckThreshold,
+		fastPaths:               newFastPathChecks(blockchain.Config, metrics),
+		walletsFallbackTTL:      walletsFallbackTTL,
+		warmer: &cacheWarmer{
+			concurrency: warmingConcurrency,
+			timeout:     warmingTimeout,
+			warmed:      warmingCounter.WithLabelValues("warmed"),
+			failed:      warmingCounter.WithLabelValues("failed"),
+		},
+		metrics:     metrics,
+		closeCtx:    closeCtx,
+		closeCancel: closeCancel,
+
+		cacheCounters:     counter,
+		coalescedCounters: coalesced,
+
+		denialReasons: metrics.NewCounterVecEx(
+			"entitlement_denial_reason_total", "Entitlement checks evaluated to a denial by reason", "reason"),
+		linkedWalletsFallbacks: metrics.NewCounterVecEx(
+			"linked_wallets_fallback", "Linked wallet lookups read from the base chain only by result", "result"),
+	}
+	ca.workQueue = newWorkQueue(blockchain.Config, metrics, ca.startWorker)
+	if memory.interval > 0 {
+		_ = ca.startWorker(ctx, memory.run)
+	}
+	ca.denialHooks = newDenialHooks(blockchain.Config, metrics, ca.startWorker)
+
+	ca.initCacheCounters()
+	servedAge := newCacheServedAgeMetrics(blockchain.Config, metrics)
+	ca.entitlementCache.servedAge = servedAge
+	ca.membershipCache.servedAge = servedAge
+	ca.appCache.servedAge = servedAge
+	for name, ec := range ca.caches() {
+		ec.name = name
+		ec.readOnly = ca.readOnly
+	}
+	if denyList != nil {
+		ca.AddPolicyHook(denyList)
+	}
+	if rate := blockchain.Config.EntitlementDenialLogSampleRate; rate > 0 {
+		// Registration only fails once chainAuth is closed.
+		_ = ca.RegisterDenialHook(NewSampledDenialLogHook(rate))
+	}
+
+	if blockchain.ChainMonitor != nil {
+		blockchain.ChainMonitor.OnBlock(func(ctx context.Context, blockNum crypto.BlockNumber) {
+			if ca.closeCtx.Err() == nil {
+				invalidator.onBlock(ctx, blockNum)
+				ca.onPrewarmBlock(ctx, blockNum)
+				if ca.cacheWal != nil {
+					ca.cacheWal.onBlock(uint64(blockNum))
+				}
+			}
+		})
+	}
 
-		isEntitledToChannelCacheHit:  counter.WithLabelValues("isEntitledToChannel", "hit"),
-		isEntitledToChannelCacheMiss: counter.WithLabelValues("isEntitledToChannel", "miss"),
-		isEntitledToSpaceCacheHit:    counter.WithLabelValues("isEntitledToSpace", "hit"),
-		isEntitledToSpaceCacheMiss:   counter.WithLabelValues("isEntitledToSpace", "miss"),
-		isSpaceEnabledCacheHit:       counter.WithLabelValues("isSpaceEnabled", "hit"),
-		isSpaceEnabledCacheMiss:      counter.WithLabelValues("isSpaceEnabled", "miss"),
-		isChannelEnabledCacheHit:     counter.WithLabelValues("isChannelEnabled", "hit"),
-		isChannelEnabledCacheMiss:    counter.WithLabelValues("isChannelEnabled", "miss"),
-		entitlementCacheHit:          counter.WithLabelValues("entitlement", "hit"),
-		entitlementCacheMiss:         counter.WithLabelValues("entitlement", "miss"),
-		linkedWalletCacheHit:         counter.WithLabelValues("linkedWallet", "hit"),
-		linkedWalletCacheMiss:        counter.WithLabelValues("linkedWallet", "miss"),
-		linkedWalletCacheBust:        counter.WithLabelValues("linkedWallet", "bust"),
-		membershipCacheHit:           counter.WithLabelValues("membership", "hit"),
-		membershipCacheMiss:          counter.WithLabelValues("membership", "miss"),
-	}, nil
+	// Warming runs in the background, it must never delay or fail startup.
+	if len(blockchain.Config.EntitlementCacheWarmSpaceIds) > 0 {
+		var spaceIds []shared.StreamId
+		for _, id := range blockchain.Config.EntitlementCacheWarmSpaceIds {
+			spaceId, err := shared.StreamIdFromString(id)
+			if err != nil {
+				ca.warmer.failed.Inc()
+				logging.FromCtx(ctx).Warnw(
+					"Invalid space id configured for entitlement cache warming", "spaceId", id, "error", err)
+				continue
+			}
+			spaceIds = append(spaceIds, spaceId)
+		}
+		_ = ca.startWorker(ctx, func(ctx context.Context) {
+			ca.WarmCaches(ctx, spaceIds)
+		})
+	}
+
+	return ca, nil
 }
 
-func (ca *chainAuth) VerifyReceipt(
-	ctx context.Context,
-	cfg *config.Config,
-	userReceipt *BlockchainTransactionReceipt,
-) (bool, error) {
-	client, err := ca.evaluator.GetClient(userReceipt.GetChainId())
-	if err != nil {
-		return false, err
+// chainAuthMetrics are the names of the metrics created by chainAuth.
+var chainAuthMetrics = []string{
+	"entitlement_cache",
+	"entitlement_cache_accounted_bytes",
+	"entitlement_cache_coalesced",
+	"entitlement_cache_heap_share",
+	"entitlement_cache_memory_drift",
+	"entitlement_cache_invalidations",
+	"entitlement_cache_restored",
+	"entitlement_cache_sampled_bytes",
+	"entitlement_cache_served_age_seconds",
+	"entitlement_cache_served_concerning_age",
+	"entitlement_cache_warming",
+	"entitlement_check_alloc_bytes",
+	"entitlement_check_alloc_objects",
+	"entitlement_denial_hook_dropped",
+	"entitlement_denial_reason_total",
+	"entitlement_dual_read_disagreements",
+	"entitlement_dual_reads",
+	"entitlement_fast_path_checks",
+	"entitlement_fast_path_duration_seconds",
+	"entitlement_join_first_actions",
+	"entitlement_join_prewarms",
+	"entitlement_read_only",
+	"entitlement_read_only_buffered_space_events",
+	"entitlement_policy_hook_verdicts",
+	"entitlement_read_only_refused",
+	"entitlement_receipt_verification_duration_seconds",
+	"entitlement_receipt_verifications",
+	"entitlement_rpc_retries",
+	"entitlement_uncached_check_waits",
+	"entitlement_uncached_checks_inflight",
+	"entitlement_work_queue_depth",
+	"entitlement_work_queue_tasks",
+	"entitlement_manager_cache_bytes",
+	"linked_wallets_fallback",
+	"linked_wallets_over_limit",
+}
+
+// startWorker runs f in a background goroutine with a context that is cancelled when ctx is done or
+// chainAuth is closed. Returns an error if chainAuth is already closed.
+func (ca *chainAuth) startWorker(ctx context.Context, f func(ctx context.Context)) error {
+	ca.closeMu.Lock()
+	defer ca.closeMu.Unlock()
+
+	if ca.closeCtx.Err() != nil {
+		return RiverError(Err_UNAVAILABLE, "chainAuth is closed")
 	}
-	txHash := common.BytesToHash(userReceipt.GetTransactionHash())
-	chainReceipt, err := client.TransactionReceipt(ctx, txHash)
-	if err != nil {
-		if errors.Is(err, ethereum.NotFound) {
-			return false, RiverError(Err_PERMISSION_DENIED, "Transaction receipt not found", "txHash", txHash.Hex())
-		}
-		return false, AsRiverError(err, Err_DOWNSTREAM_NETWORK_ERROR)
+
+	ctx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(ca.closeCtx, cancel)
+	ca.workers.Add(1)
+	go func() {
+		defer ca.workers.Done()
+		defer stop()
+		defer cancel()
+		f(ctx)
+	}()
+	return nil
+}
+
+// Close stops the background workers, writes the caches to disk if persistence is configured, releases the
+// caches and unregisters the metrics of chainAuth, so that another instance can be created with the same
+// metrics factory. chainAuth must not be used after Close.
+func (ca *chainAuth) Close() error {
+	ca.closeMu.Lock()
+	if ca.closeCtx.Err() != nil {
+		ca.closeMu.Unlock()
+		return nil
 	}
+	ca.closeCancel()
+	ca.closeMu.Unlock()
+
+	ca.workQueue.close()
+	ca.workers.Wait()
+	ca.readOnly.close()
 
-	// Check if the block number matches:
-	if chainReceipt.BlockNumber.Uint64() != userReceipt.BlockNumber {
-		return false, RiverError(Err_PERMISSION_DENIED, "Block number mismatch", "got",
-			chainReceipt.BlockNumber.Uint64(), "user uploaded", userReceipt.BlockNumber)
+	var err error
+	if ca.cacheWal != nil {
+		err = ca.cacheWal.flush()
+		ca.cacheWal.close()
 	}
 
-	// Check logs count and match the event log data
-	if len(chainReceipt.Logs) != len(userReceipt.Logs) {
-		return false, RiverError(Err_PERMISSION_DENIED, "Log count mismatch: chain:",
-			len(chainReceipt.Logs), "uploaded:", len(userReceipt.Logs))
+	for _, ec := range []*entitlementCache{
+		ca.entitlementCache,
+		ca.membershipCache,
+		ca.entitlementManagerCache,
+		ca.linkedWalletCache,
+		ca.banCache,
+		ca.appCache,
+	} {
+		ec.positiveCache.Purge()
+		ec.negativeCache.Purge()
 	}
 
-	// For each log, check address, topics, data
-	for i, chainLog := range chainReceipt.Logs {
-		uploadedLog := userReceipt.Logs[i]
-		if !bytes.Equal(chainLog.Address[:], uploadedLog.Address) {
-			return false, RiverError(
-				Err_PERMISSION_DENIED,
-				"Log address mismatch:",
-				i,
-				"address:",
-				chainLog.Address.Hex(),
-				"uploaded:",
-				uploadedLog.Address,
-			)
-		}
+	for _, name := range chainAuthMetrics {
+		ca.metrics.Unregister(name)
+	}
+	return err
+}
 
-		if len(chainLog.Topics) != len(uploadedLog.Topics) {
-			return false, RiverError(Err_PERMISSION_DENIED, "Log topics count mismatch", i)
-		}
+// caches returns the entitlement caches of ca by name.
+func (ca *chainAuth) caches() map[string]*entitlementCache {
+	return map[string]*entitlementCache{
+		"entitlement":        ca.entitlementCache,
+		"membership":         ca.membershipCache,
+		"entitlementManager": ca.entitlementManagerCache,
+		"linkedWallet":       ca.linkedWalletCache,
+		"banList":            ca.banCache,
+		"app":                ca.appCache,
+	}
+}
 
-		for j, topic := range chainLog.Topics {
-			if !bytes.Equal(topic[:], uploadedLog.Topics[j]) {
-				return false, RiverError(Err_PERMISSION_DENIED, "Log topic mismatch",
-					i, "topic index: ", j, "chain: ", topic.Hex(), "uploaded: ", uploadedLog.Topics[j])
-			}
-		}
+// initCacheCounters binds the cache counters of ca and of its caches to the counter vectors.
+func (ca *chainAuth) initCacheCounters() {
+	ca.isEntitledCacheHit = newCacheCounter(ca.cacheCounters, "isEntitled", "hit")
+	ca.isEntitledCacheMiss = newCacheCounter(ca.cacheCounters, "isEntitled", "miss")
+	ca.isEntitledToChannelCacheHit = newCacheCounter(ca.cacheCounters, "isEntitledToChannel", "hit")
+	ca.isEntitledToChannelCacheMiss = newCacheCounter(ca.cacheCounters, "isEntitledToChannel", "miss")
+	ca.isEntitledToSpaceCacheHit = newCacheCounter(ca.cacheCounters, "isEntitledToSpace", "hit")
+	ca.isEntitledToSpaceCacheMiss = newCacheCounter(ca.cacheCounters, "isEntitledToSpace", "miss")
+	ca.isSpaceEnabledCacheHit = newCacheCounter(ca.cacheCounters, "isSpaceEnabled", "hit")
+	ca.isSpaceEnabledCacheMiss = newCacheCounter(ca.cacheCounters, "isSpaceEnabled", "miss")
+	ca.isChannelEnabledCacheHit = newCacheCounter(ca.cacheCounters, "isChannelEnabled", "hit")
+	ca.isChannelEnabledCacheMiss = newCacheCounter(ca.cacheCounters, "isChannelEnabled", "miss")
+	ca.entitlementCacheHit = newCacheCounter(ca.cacheCounters, "entitlement", "hit")
+	ca.entitlementCacheMiss = newCacheCounter(ca.cacheCounters, "entitlement", "miss")
+	ca.entitlementManagerCacheHit = newCacheCounter(ca.cacheCounters, "entitlementManager", "hit")
+	ca.entitlementManagerCacheMiss = newCacheCounter(ca.cacheCounters, "entitlementManager", "miss")
+	ca.linkedWalletCacheHit = newCacheCounter(ca.cacheCounters, "linkedWallet", "hit")
+	ca.linkedWalletCacheMiss = newCacheCounter(ca.cacheCounters, "linkedWallet", "miss")
+	ca.linkedWalletCacheBust = newCacheCounter(ca.cacheCounters, "linkedWallet", "bust")
+	ca.linkedWalletCollapsed = newCacheCounter(ca.cacheCounters, "linkedWallet", "collapsed")
+	ca.membershipCacheHit = newCacheCounter(ca.cacheCounters, "membership", "hit")
+	ca.membershipCacheMiss = newCacheCounter(ca.cacheCounters, "membership", "miss")
+	ca.banCacheHit = newCacheCounter(ca.cacheCounters, "banList", "hit")
+	ca.banCacheMiss = newCacheCounter(ca.cacheCounters, "banList", "miss")
+	ca.appCacheHit = newCacheCounter(ca.cacheCounters, "app", "hit")
+	ca.appCacheMiss = newCacheCounter(ca.cacheCounters, "app", "miss")
+
+	ca.entitlementCache.coalesced = ca.coalescedCounters.WithLabelValues("entitlement")
+	ca.membershipCache.coalesced = ca.coalescedCounters.WithLabelValues("membership")
+	ca.entitlementManagerCache.coalesced = ca.coalescedCounters.WithLabelValues("entitlementManager")
+	ca.linkedWalletCache.coalesced = ca.coalescedCounters.WithLabelValues("linkedWallet")
+	ca.banCache.coalesced = ca.coalescedCounters.WithLabelValues("banList")
+	ca.appCache.coalesced = ca.coalescedCounters.WithLabelValues("app")
+}
 
-		if !bytes.Equal(chainLog.Data, uploadedLog.Data) {
-			return false, RiverError(Err_PERMISSION_DENIED, "Log data mismatch", i)
-		}
+// cacheCounter counts the lookups of an entitlement cache with a given function and result by the reason of
+// the denial they returned. Lookups of allowed results, and of caches that don't hold decisions, are counted
+// with the NONE reason. Reasons are bounded by EntitlementResultReason, which bounds the label cardinality.
+type cacheCounter struct {
+	prometheus.Counter // counts the lookups with the NONE reason
+
+	vec      *prometheus.CounterVec
+	function string
+	result   string
+}
+
+func newCacheCounter(vec *prometheus.CounterVec, function string, result string) *cacheCounter {
+	return &cacheCounter{
+		Counter:  vec.WithLabelValues(function, result, EntitlementResultReason_NONE.String()),
+		vec:      vec,
+		function: function,
+		result:   result,
+	}
+}
+
+// incFor counts a lookup that returned val.
+func (c *cacheCounter) incFor(val CacheResult) {
+	if val.IsAllowed() || val.Reason() == EntitlementResultReason_NONE {
+		c.Inc()
+		return
+	}
+	c.vec.WithLabelValues(c.function, c.result, val.Reason().String()).Inc()
+}
+
+// FlushAllCaches removes all entries from the entitlement caches and resets the cache counters, so that
+// subsequent checks behave as on a freshly started node. It is meant for integration tests that need a cold
+// cache without creating a new chainAuth, and must not be called while checks are running: results of checks
+// in flight may be stored after the flush, and the counters are replaced without synchronization.
+func (ca *chainAuth) FlushAllCaches() {
+	ca.flushMu.Lock()
+	defer ca.flushMu.Unlock()
+
+	for _, ec := range []*entitlementCache{
+		ca.entitlementCache,
+		ca.membershipCache,
+		ca.entitlementManagerCache,
+		ca.linkedWalletCache,
+		ca.banCache,
+		ca.appCache,
+	} {
+		ec.flush()
+	}
+
+	ca.cacheCounters.Reset()
+	ca.coalescedCounters.Reset()
+	ca.initCacheCounters()
+}
+
+func (ca *chainAuth) VerifyReceipt(
+	ctx context.Context,
+	cfg *config.Config,
+	userReceipt *BlockchainTransactionReceipt,
+) (bool, error) {
+	if err := ca.readOnly.check("receipt"); err != nil {
+		return false, AsRiverError(err).Func("VerifyReceipt")
 	}
-
-	// get the transaction
-	tx, isPending, err := client.TransactionByHash(ctx, txHash)
+	tx, err := ca.receiptVerifier.Verify(ctx, userReceipt)
 	if err != nil {
 		return false, err
 	}
-	if isPending {
-		return false, RiverError(Err_PERMISSION_DENIED, "Transaction is pending", "txHash", txHash.Hex())
-	}
 
-	// check the to address
-	if !bytes.Equal(tx.To()[:], userReceipt.GetTo()) {
-		return false, RiverError(
-			Err_PERMISSION_DENIED,
-			"To address mismatch",
-			"chain",
-			tx.To().Hex(),
-			"uploaded",
-			userReceipt.To,
-		)
-	}
+	ca.onTransactionVerified(ctx, tx.To, tx.From, tx.Logs)
 
-	// check the from addresses
-	signer := ethTypes.LatestSignerForChainID(tx.ChainId())
-	sender, err := signer.Sender(tx)
-	if err != nil {
-		return false, err
-	}
-	if !bytes.Equal(sender.Bytes(), userReceipt.GetFrom()) {
-		return false, RiverError(
-			Err_PERMISSION_DENIED,
-			"From address mismatch",
-			"chain",
-			sender.Hex(),
-			"uploaded",
-			userReceipt.From,
-		)
-	}
+	return true, nil
+}
 
-	// If we reach here, the logs match exactly.
+// membershipTokenIssuedTopic is the topic of the
+// MembershipTokenIssued(address indexed recipient, uint256 indexed tokenId) event a space emits
+// when a membership token is minted for a user joining the space.
+var membershipTokenIssuedTopic = ethCrypto.Keccak256Hash([]byte("MembershipTokenIssued(address,uint256)"))
 
-	// 3) Check the number of confirmations
-	latestBlockNumber, err := ca.blockchain.Client.BlockNumber(ctx)
-	if err != nil {
-		return false, RiverError(Err_PERMISSION_DENIED, "Failed to get latest block number: %v", err)
-	}
-
-	confirmations := latestBlockNumber - chainReceipt.BlockNumber.Uint64()
-	if confirmations < 1 {
-		return false, RiverError(
-			Err_PERMISSION_DENIED,
-			"Transaction has 0 confirmations.",
-			"latestBlockNumber",
-			latestBlockNumber,
-			"uploaded:",
-			chainReceipt.BlockNumber.Uint64(),
-		)
+// onTransactionVerified busts cached membership results for users that joined a space in a verified transaction.
+// Without this, a user who was denied before joining keeps being denied until the negative cache entries expire.
+func (ca *chainAuth) onTransactionVerified(
+	ctx context.Context,
+	to common.Address,
+	from common.Address,
+	logs []*ethTypes.Log,
+) {
+	log := logging.FromCtx(ctx)
+
+	for _, l := range logs {
+		// Only membership tokens minted by the space the transaction was sent to are considered.
+		if l.Address != to || len(l.Topics) != 3 || l.Topics[0] != membershipTokenIssuedTopic {
+			continue
+		}
+
+		spaceId := shared.SpaceIdFromAddress(l.Address)
+		recipient := common.BytesToAddress(l.Topics[1].Bytes())
+
+		scopes, principals := ca.membershipScopes(ctx, spaceId, recipient, from)
+		log.Debugw("Busting cached membership for verified space join", "spaceId", spaceId, "scopes", len(scopes))
+		ca.invalidator.invalidateNow(scopes...)
+		// The invalidations are applied, the entitlements of the new member can be warmed right away.
+		ca.onMemberJoined(ctx, spaceId, 0, principals[:1])
 	}
+}
 
-	return true, nil
+// membershipScopes returns the invalidation scopes for cached results of the given wallets in the space,
+// including the results cached for the root keys the wallets are linked to, and the principals of the wallets:
+// the root key a wallet is linked to, or the wallet itself if it is not linked or its root key can't be read.
+func (ca *chainAuth) membershipScopes(
+	ctx context.Context,
+	spaceId shared.StreamId,
+	wallets ...common.Address,
+) ([]invalidationScope, []common.Address) {
+	var scopes []invalidationScope
+	principals := make([]common.Address, 0, len(wallets))
+	for _, wallet := range wallets {
+		scopes = append(scopes, invalidationScope{spaceId: spaceId, principal: wallet})
+		rootKey, err := ca.walletResolver.RootKey(ctx, wallet)
+		if err != nil {
+			logging.FromCtx(ctx).Warnw(
+				"Failed to get root key for wallet", "wallet", wallet, "spaceId", spaceId, "error", err)
+			principals = append(principals, wallet)
+			continue
+		}
+		if rootKey == (common.Address{}) {
+			principals = append(principals, wallet)
+			continue
+		}
+		scopes = append(scopes, invalidationScope{spaceId: spaceId, principal: rootKey})
+		principals = append(principals, rootKey)
+	}
+	return scopes, principals
 }
 
 func (ca *chainAuth) IsEntitled(
@@ -438,41 +1543,156 @@ func (ca *chainAuth) IsEntitled(
 	cfg *config.Config,
 	args *ChainAuthArgs,
 ) (IsEntitledResult, error) {
-	// TODO: counter for cache hits here?
-	result, _, err := ca.entitlementCache.executeUsingCache(
+	ctx, trace := withCheckTrace(ctx)
+	defer trace.logIfSlow(ctx, ca.slowCheckThreshold)
+	ctx, args = args.withoutCallOptions(ctx)
+	start := time.Now()
+
+	// The checks of apps are cached and counted apart from those of users.
+	cache, cacheHitCounter, cacheMissCounter := ca.entitlementCache, ca.isEntitledCacheHit, ca.isEntitledCacheMiss
+	if args.kind == chainAuthKindApp {
+		cache, cacheHitCounter, cacheMissCounter = ca.appCache, ca.appCacheHit, ca.appCacheMiss
+	}
+	result, cacheHit, err := ca.executeCheckUsingCache(
 		ctx,
 		cfg,
+		cache,
 		args,
 		ca.checkEntitlement,
 	)
+	ca.fastPaths.observe(args, err == nil && result.IsAllowed(), err, time.Since(start))
 	if err != nil {
 		return nil, AsRiverError(err).Func("IsEntitled")
 	}
-
-	return &isEntitledResult{
-		isAllowed: result.IsAllowed(),
-		reason:    result.Reason(),
-	}, nil
+	if cacheHit {
+		cacheHitCounter.incFor(result)
+	} else {
+		cacheMissCounter.incFor(result)
+	}
+
+	// Checks that bypass the caches, such as simulations, are not actions of the principal, and apps don't
+	// join spaces.
+	if !isCacheBypassed(ctx) && args.kind != chainAuthKindApp {
+		ca.joinPrewarmer.recordAction(args, cacheHit)
+	}
+	if cacheHit && ca.dualReader.sample() && !ca.readOnly.active() {
+		ca.startDualRead(ctx, cfg, args, result.(*timestampedCacheValue))
+	}
+
+	val := result.(*timestampedCacheValue)
+	fromCache := cacheHit
+	var walletSetDigest common.Hash
+	baseChainOnly := false
+	var validUntil time.Time
+	if walletSet, ok := val.Result().(*walletSetCacheResult); ok {
+		walletSetDigest = walletSet.walletSetDigest
+		fromCache = fromCache || !walletSet.dataCachedAt.IsZero()
+		baseChainOnly = !walletSet.baseChainOnlyUntil.IsZero()
+		validUntil = walletSet.validUntil
+	}
+
+	ret := &isEntitledResult{
+		isAllowed:       result.IsAllowed(),
+		reason:          result.Reason(),
+		walletSetDigest: walletSetDigest,
+		cachedAt:        val.cachedAt(),
+		fromCache:       fromCache,
+		ruleDenial:      ruleDenialOf(val.Result()),
+		baseChainOnly:   baseChainOnly,
+		satisfiedBy:     satisfiedByOf(val.Result()),
+		validUntil:      validUntil,
+	}
+	ret.reasonChain = []ReasonChainStep{{
+		Source:  ReasonChainSourceChain,
+		Outcome: PolicyOutcomeDeny,
+		Reason:  ret.reason.String(),
+	}}
+	if ret.isAllowed {
+		ret.reasonChain[0].Outcome = PolicyOutcomeAllow
+	}
+	stopPolicyHooks := traceStage(ctx, checkStagePolicyHooks)
+	err = ca.policyHooks.apply(ctx, args, ret)
+	stopPolicyHooks()
+	if err != nil {
+		return nil, AsRiverError(err).Func("IsEntitled")
+	}
+	if ca.auditBuffer.enabled() {
+		_ = ca.auditBuffer.Write(newAuditRecord(args, ret))
+	}
+	if !ret.isAllowed {
+		ca.denialHooks.notify(ctx, args, ret.reason)
+	}
+	ca.observer.entitlementEvaluated(ctx, args, ret, cacheHit)
+	return ret, nil
 }
 
 func (ca *chainAuth) areLinkedWalletsEntitled(
 	ctx context.Context,
 	cfg *config.Config,
 	args *ChainAuthArgs,
-) (bool, EntitlementResultReason, error) {
+) (CacheResult, error) {
 	log := logging.FromCtx(ctx)
-	if args.kind == chainAuthKindSpace {
+	if args.permissions != "" {
+		log.Debugw("isWalletEntitled", "kind", "permissions", "args", args)
+		return ca.areLinkedWalletsEntitledToPermissions(ctx, cfg, args)
+	} else if args.kind == chainAuthKindSpace {
 		log.Debugw("isWalletEntitled", "kind", "space", "args", args)
 		return ca.isEntitledToSpace(ctx, cfg, args)
 	} else if args.kind == chainAuthKindChannel {
 		log.Debugw("isWalletEntitled", "kind", "channel", "args", args)
 		return ca.isEntitledToChannel(ctx, cfg, args)
+	} else if args.kind == chainAuthKindChannelModerator {
+		log.Debugw("isWalletEntitled", "kind", "channelModerator", "args", args)
+		return ca.isChannelModerator(ctx, cfg, args)
 	} else if args.kind == chainAuthKindIsSpaceMember {
 		log.Debugw("isWalletEntitled", "kind", "isSpaceMember", "args", args)
-		return true, EntitlementResultReason_NONE, nil // is space member is checked by the calling code in checkEntitlement
+		// is space member is checked by the calling code in checkEntitlement
+		return boolCacheResult{isAllowed: true, reason: EntitlementResultReason_NONE}, nil
 	} else {
-		return false, EntitlementResultReason_NONE, RiverError(Err_INTERNAL, "Unknown chain auth kind").Func("isWalletEntitled")
+		return nil, RiverError(Err_INTERNAL, "Unknown chain auth kind").Func("isWalletEntitled")
+	}
+}
+
+// areLinkedWalletsEntitledToPermissions evaluates the space or channel check of each of the permissions of args
+// until one decides the check as the permission mode of args tells. Each permission is evaluated, and cached,
+// like the single permission check of the same linked wallets.
+func (ca *chainAuth) areLinkedWalletsEntitledToPermissions(
+	ctx context.Context,
+	cfg *config.Config,
+	args *ChainAuthArgs,
+) (CacheResult, error) {
+	check := ca.isEntitledToSpace
+	if args.kind == chainAuthKindChannel {
+		check = ca.isEntitledToChannel
+	}
+
+	var result, failed CacheResult
+	for _, permission := range deserializePermissions(args.permissions) {
+		permissionArgs := *args
+		permissionArgs.permission = permission
+		permissionArgs.permissions = ""
+		permissionArgs.permissionMode = RequireAll
+
+		var err error
+		result, err = check(ctx, cfg, &permissionArgs)
+		if err != nil {
+			return nil, err
+		}
+		if result.IsAllowed() == (args.permissionMode == RequireAny) {
+			break
+		}
+		if !isCacheable(result) {
+			failed = result
+		}
 	}
+	if result == nil {
+		return nil, RiverError(Err_INVALID_ARGUMENT, "No permissions to check").Func("areLinkedWalletsEntitled")
+	}
+	// Permissions that couldn't be checked may have allowed a check denied by the others.
+	if !result.IsAllowed() && failed != nil {
+		return failed, nil
+	}
+	return result, nil
 }
 
 func (ca *chainAuth) isSpaceEnabledUncached(
@@ -480,35 +1700,62 @@ func (ca *chainAuth) isSpaceEnabledUncached(
 	cfg *config.Config,
 	args *ChainAuthArgs,
 ) (CacheResult, error) {
+	defer traceStage(ctx, checkStageStreamEnabled)()
+
+	spaceContract, err := ca.spaceContractFor(args.chainId)
+	if err != nil {
+		return nil, err
+	}
 	// This is awkward as we want enabled to be cached for 15 minutes, but the API returns the inverse
-	isDisabled, err := ca.spaceContract.IsSpaceDisabled(ctx, args.spaceId)
+	isDisabled, err := spaceContract.IsSpaceDisabled(ctx, args.spaceId)
+	if IsRiverErrorCode(err, Err_NOT_FOUND) {
+		return boolCacheResult{isAllowed: false, reason: EntitlementResultReason_SPACE_NOT_FOUND}, nil
+	}
 	if err != nil {
 		return nil, err
 	}
-	return boolCacheResult{!isDisabled, EntitlementResultReason_SPACE_DISABLED}, nil
+	return boolCacheResult{isAllowed: !isDisabled, reason: EntitlementResultReason_SPACE_DISABLED}, nil
 }
 
 func (ca *chainAuth) checkSpaceEnabled(
 	ctx context.Context,
 	cfg *config.Config,
 	spaceId shared.StreamId,
+	chainId uint64,
 ) (bool, EntitlementResultReason, error) {
+	result, err := ca.spaceEnabled(ctx, cfg, spaceId, chainId)
+	if err != nil {
+		return false, EntitlementResultReason_NONE, err
+	}
+	return result.Enabled, result.Reason, nil
+}
+
+// spaceEnabled returns whether the space is enabled, served from the cache shared with the entitlement checks
+// of the space.
+func (ca *chainAuth) spaceEnabled(
+	ctx context.Context,
+	cfg *config.Config,
+	spaceId shared.StreamId,
+	chainId uint64,
+) (*StreamEnabledResult, error) {
+	key := newArgsForEnabledSpace(spaceId)
+	key.chainId = chainId
 	isEnabled, cacheHit, err := ca.entitlementCache.executeUsingCache(
 		ctx,
 		cfg,
-		newArgsForEnabledSpace(spaceId),
+		key,
 		ca.isSpaceEnabledUncached,
 	)
 	if err != nil {
-		return false, EntitlementResultReason_NONE, err
+		return nil, err
 	}
 	if cacheHit {
-		ca.isSpaceEnabledCacheHit.Inc()
+		ca.isSpaceEnabledCacheHit.incFor(isEnabled)
 	} else {
-		ca.isSpaceEnabledCacheMiss.Inc()
+		ca.isSpaceEnabledCacheMiss.incFor(isEnabled)
 	}
 
-	return isEnabled.IsAllowed(), isEnabled.Reason(), nil
+	return newStreamEnabledResult(isEnabled, cacheHit), nil
 }
 
 func (ca *chainAuth) isChannelEnabledUncached(
@@ -516,12 +1763,21 @@ func (ca *chainAuth) isChannelEnabledUncached(
 	cfg *config.Config,
 	args *ChainAuthArgs,
 ) (CacheResult, error) {
+	defer traceStage(ctx, checkStageStreamEnabled)()
+
+	spaceContract, err := ca.spaceContractFor(args.chainId)
+	if err != nil {
+		return nil, err
+	}
 	// This is awkward as we want enabled to be cached for 15 minutes, but the API returns the inverse
-	isDisabled, err := ca.spaceContract.IsChannelDisabled(ctx, args.spaceId, args.channelId)
+	isDisabled, err := spaceContract.IsChannelDisabled(ctx, args.spaceId, args.channelId)
+	if IsRiverErrorCode(err, Err_NOT_FOUND) {
+		return boolCacheResult{isAllowed: false, reason: EntitlementResultReason_SPACE_NOT_FOUND}, nil
+	}
 	if err != nil {
 		return nil, err
 	}
-	return boolCacheResult{!isDisabled, EntitlementResultReason_CHANNEL_DISABLED}, nil
+	return boolCacheResult{isAllowed: !isDisabled, reason: EntitlementResultReason_CHANNEL_DISABLED}, nil
 }
 
 func (ca *chainAuth) checkChannelEnabled(
@@ -529,23 +1785,92 @@ func (ca *chainAuth) checkChannelEnabled(
 	cfg *config.Config,
 	spaceId shared.StreamId,
 	channelId shared.StreamId,
+	chainId uint64,
 ) (bool, EntitlementResultReason, error) {
+	result, err := ca.channelEnabled(ctx, cfg, spaceId, channelId, chainId)
+	if err != nil {
+		return false, EntitlementResultReason_NONE, err
+	}
+	return result.Enabled, result.Reason, nil
+}
+
+// channelEnabled returns whether the channel is enabled, served from the cache shared with the entitlement
+// checks of the channel.
+func (ca *chainAuth) channelEnabled(
+	ctx context.Context,
+	cfg *config.Config,
+	spaceId shared.StreamId,
+	channelId shared.StreamId,
+	chainId uint64,
+) (*StreamEnabledResult, error) {
+	key := newArgsForEnabledChannel(spaceId, channelId)
+	key.chainId = chainId
 	isEnabled, cacheHit, err := ca.entitlementCache.executeUsingCache(
 		ctx,
 		cfg,
-		newArgsForEnabledChannel(spaceId, channelId),
+		key,
 		ca.isChannelEnabledUncached,
 	)
 	if err != nil {
-		return false, EntitlementResultReason_NONE, err
+		return nil, err
 	}
 	if cacheHit {
-		ca.isChannelEnabledCacheHit.Inc()
+		ca.isChannelEnabledCacheHit.incFor(isEnabled)
 	} else {
-		ca.isChannelEnabledCacheMiss.Inc()
+		ca.isChannelEnabledCacheMiss.incFor(isEnabled)
+	}
+
+	return newStreamEnabledResult(isEnabled, cacheHit), nil
+}
+
+// StreamEnabledResult tells whether a space or channel is enabled, see ChainAuth.IsSpaceEnabled.
+type StreamEnabledResult struct {
+	Enabled bool
+	// Reason is SPACE_DISABLED or CHANNEL_DISABLED if the stream is disabled, SPACE_NOT_FOUND if the space
+	// doesn't exist, NONE otherwise.
+	Reason EntitlementResultReason
+	// CachedAt is the time the result was read from the chain.
+	CachedAt time.Time
+	// FromCache is set if the result was served from the cache.
+	FromCache bool
+}
+
+func newStreamEnabledResult(val CacheResult, cacheHit bool) *StreamEnabledResult {
+	result := &StreamEnabledResult{
+		Enabled:   val.IsAllowed(),
+		Reason:    EntitlementResultReason_NONE,
+		CachedAt:  val.(*timestampedCacheValue).cachedAt(),
+		FromCache: cacheHit,
+	}
+	if !result.Enabled {
+		result.Reason = val.Reason()
+	}
+	return result
+}
+
+func (ca *chainAuth) IsSpaceEnabled(
+	ctx context.Context,
+	cfg *config.Config,
+	spaceId shared.StreamId,
+) (*StreamEnabledResult, error) {
+	result, err := ca.spaceEnabled(ctx, cfg, spaceId, 0)
+	if err != nil {
+		return nil, AsRiverError(err).Func("IsSpaceEnabled").Tag("spaceId", spaceId)
 	}
+	return result, nil
+}
 
-	return isEnabled.IsAllowed(), isEnabled.Reason(), nil
+func (ca *chainAuth) IsChannelEnabled(
+	ctx context.Context,
+	cfg *config.Config,
+	spaceId shared.StreamId,
+	channelId shared.StreamId,
+) (*StreamEnabledResult, error) {
+	result, err := ca.channelEnabled(ctx, cfg, spaceId, channelId, 0)
+	if err != nil {
+		return nil, AsRiverError(err).Func("IsChannelEnabled").Tag("spaceId", spaceId).Tag("channelId", channelId)
+	}
+	return result, nil
 }
 
 // CacheResult is the result of a cache lookup.
@@ -565,18 +1890,42 @@ func (ecr *entitlementCacheResult) Reason() EntitlementResultReason {
 	return EntitlementResultReason_NONE // entitlement cache results are a second layer of caching, so we don't need to return a reason
 }
 
-// If entitlements are found for the permissions, they are returned and the allowed flag is set true so the results may be cached.
-// If the call fails or the space is not found, the allowed flag is set to false so the negative caching time applies.
+// If entitlements are found for the permissions, they are returned and the allowed flag is set true so the results
+// are kept for the positive cache TTL. Failed calls, including for spaces that are not found, return an error and
+// are not cached, so transient chain errors clear on the next check.
 func (ca *chainAuth) getSpaceEntitlementsForPermissionUncached(
 	ctx context.Context,
 	cfg *config.Config,
 	args *ChainAuthArgs,
 ) (CacheResult, error) {
+	defer traceStage(ctx, checkStageEntitlements)()
+
 	log := logging.FromCtx(ctx)
-	entitlementData, owner, err := ca.spaceContract.GetSpaceEntitlementsForPermission(
+	var owner common.Address
+	entitlementData, err := retryRpc(
 		ctx,
-		args.spaceId,
-		args.permission,
+		ca.rpcRetry,
+		"GetSpaceEntitlementsForPermission",
+		func(ctx context.Context) (entitlements []types.Entitlement, err error) {
+			spaceContract, err := ca.spaceContractFor(args.chainId)
+			if err != nil {
+				return nil, err
+			}
+			if args.customPermission != "" {
+				entitlements, owner, err = spaceContract.GetSpaceEntitlementsForCustomPermission(
+					ctx,
+					args.spaceId,
+					args.customPermission,
+				)
+				return entitlements, err
+			}
+			entitlements, owner, err = spaceContract.GetSpaceEntitlementsForPermission(
+				ctx,
+				args.spaceId,
+				args.permission,
+			)
+			return entitlements, err
+		},
 	)
 
 	log.Debugw("getSpaceEntitlementsForPermissionUncached", "args", args, "entitlementData", entitlementData)
@@ -591,20 +1940,38 @@ func (ca *chainAuth) getSpaceEntitlementsForPermissionUncached(
 	return &entitlementCacheResult{allowed: true, entitlementData: entitlementData, owner: owner}, nil
 }
 
-// If entitlements are found for the permissions, they are returned and the allowed flag is set true so the results may be cached.
-// If the call fails or the space is not found, the allowed flag is set to false so the negative caching time applies.
+// If entitlements are found for the permissions, they are returned and the allowed flag is set true so the results
+// are kept for the positive cache TTL. Failed calls, including for spaces that are not found, return an error and
+// are not cached, so transient chain errors clear on the next check.
 func (ca *chainAuth) getChannelEntitlementsForPermissionUncached(
 	ctx context.Context,
 	cfg *config.Config,
 	args *ChainAuthArgs,
 ) (CacheResult, error) {
+	defer traceStage(ctx, checkStageEntitlements)()
+
 	log := logging.FromCtx(ctx)
-	entitlementData, owner, err := ca.spaceContract.GetChannelEntitlementsForPermission(
-		ctx,
-		args.spaceId,
-		args.channelId,
-		args.permission,
-	)
+	var entitlementData []types.Entitlement
+	var owner common.Address
+	spaceContract, err := ca.spaceContractFor(args.chainId)
+	if err != nil {
+		return nil, err
+	}
+	if args.customPermission != "" {
+		entitlementData, owner, err = spaceContract.GetChannelEntitlementsForCustomPermission(
+			ctx,
+			args.spaceId,
+			args.channelId,
+			args.customPermission,
+		)
+	} else {
+		entitlementData, owner, err = spaceContract.GetChannelEntitlementsForPermission(
+			ctx,
+			args.spaceId,
+			args.channelId,
+			args.permission,
+		)
+	}
 
 	log.Debugw("getChannelEntitlementsForPermissionUncached", "args", args, "entitlementData", entitlementData)
 	if err != nil {
@@ -629,7 +1996,7 @@ func (ca *chainAuth) isEntitledToChannelUncached(
 	result, cacheHit, err := ca.entitlementManagerCache.executeUsingCache(
 		ctx,
 		cfg,
-		args,
+		newArgsForEntitlementManager(args),
 		ca.getChannelEntitlementsForPermissionUncached,
 	)
 	if err != nil {
@@ -645,22 +2012,78 @@ func (ca *chainAuth) isEntitledToChannelUncached(
 	temp := (result.(*timestampedCacheValue).Result())
 	entitlementData := temp.(*entitlementCacheResult) // Assuming result is of *entitlementCacheResult type
 
-	allowed, err := ca.evaluateWithEntitlements(
+	allowed, satisfiedBy, ruleDenial, err := ca.evaluateWithEntitlements(
 		ctx,
 		args,
 		entitlementData.owner,
 		entitlementData.entitlementData,
 	)
+	if errors.Is(err, errWalletsBanned) {
+		return boolCacheResult{isAllowed: false, reason: EntitlementResultReason_BANNED}, nil
+	}
+	if denial := ruleCheckFailed(ctx, args, err); denial != nil {
+		return denial, nil
+	}
 	if err != nil {
 		return nil, AsRiverError(err).
 			Func("isEntitledToChannel").
 			Message("Failed to evaluate entitlements").
 			Tag("channelId", args.channelId)
 	}
-	return boolCacheResult{allowed, EntitlementResultReason_CHANNEL_ENTITLEMENTS}, nil
+	if ruleDenial != nil {
+		return &ruleDenialCacheResult{
+			boolCacheResult: boolCacheResult{isAllowed: false, reason: EntitlementResultReason_CHANNEL_ENTITLEMENTS},
+			ruleDenial:      ruleDenial,
+		}, nil
+	}
+	return boolCacheResult{
+		isAllowed:   allowed,
+		reason:      EntitlementResultReason_CHANNEL_ENTITLEMENTS,
+		satisfiedBy: satisfiedBy,
+	}, nil
+}
+
+// WalletSetDigest returns the canonical digest of a set of wallets: the keccak256 hash of the
+// concatenated addresses after sorting them and removing duplicates. The digest does not depend
+// on the order in which the wallets were linked, so it can be used to group entitlement checks
+// by wallet set without storing the wallets themselves.
+func WalletSetDigest(wallets []common.Address) common.Hash {
+	scratch := getWalletScratch()
+	defer scratch.put(len(wallets))
+
+	sorted := append(scratch.wallets[:0], wallets...)
+	slices.SortFunc(sorted, func(a, b common.Address) int {
+		return a.Cmp(b)
+	})
+	sorted = slices.Compact(sorted)
+
+	data := scratch.data[:0]
+	for i := range sorted {
+		data = append(data, sorted[i][:]...)
+	}
+	scratch.wallets, scratch.data = sorted, data
+	return scratch.hash(data)
+}
+
+func serializeWallets(wallets []common.Address) string {
+	scratch := getWalletScratch()
+	defer scratch.put(len(wallets))
+
+	data := scratch.data[:0]
+	for i := range wallets {
+		if i > 0 {
+			data = append(data, ',')
+		}
+		data = scratch.appendHex(data, &wallets[i])
+	}
+	scratch.data = data
+	return string(data)
 }
 
 func deserializeWallets(serialized string) []common.Address {
+	if serialized == "" {
+		return nil
+	}
 	addressStrings := strings.Split(serialized, ",")
 	linkedWallets := make([]common.Address, len(addressStrings))
 	for i, addrStr := range addressStrings {
@@ -672,15 +2095,41 @@ func deserializeWallets(serialized string) []common.Address {
 // evaluateEntitlementData evaluates a list of entitlements and returns true if any of them are true.
 // The entitlements are evaluated across all linked wallets - if any of the wallets are entitled, the user is entitled.
 // Rule entitlements are evaluated by a library shared with xchain and user entitlements are evaluated in the loop.
+// The children of the AND and OR operations of a rule are evaluated concurrently, once a child decides the
+// operation the other is canceled.
+// If the user is entitled, the wallet that satisfied the entitlements is returned if a single wallet is known to.
+// If the user is not entitled, the unsatisfied check of the first rule entitlement is returned along with false,
+// or an error wrapping errRuleCheckFailed if a rule entitlement failed to evaluate.
 func (ca *chainAuth) evaluateEntitlementData(
 	ctx context.Context,
 	entitlements []types.Entitlement,
 	args *ChainAuthArgs,
-) (bool, error) {
+) (bool, common.Address, *entitlement.RuleDenial, error) {
+	defer traceStage(ctx, checkStageRuleEvaluation)()
+
 	log := logging.FromCtx(ctx).With("function", "evaluateEntitlementData")
 	log.Debugw("evaluateEntitlementData", "args", args)
 
+	// Everyone is entitled, the rule entitlements don't need to be evaluated against the wallets.
+	if grantsEveryone(entitlements) {
+		log.Debugw("user entitlement: everyone is entitled", "spaceId", args.spaceId, "channelId", args.channelId)
+		return true, common.Address{}, nil, nil
+	}
+
 	wallets := deserializeWallets(args.linkedWallets)
+	// Rules may be satisfied by the combined balances of the wallets, they are only known to be satisfied by a
+	// wallet if it is the only one.
+	var ruleSatisfiedBy common.Address
+	if len(wallets) == 1 {
+		ruleSatisfiedBy = wallets[0]
+	}
+	evaluator, err := ca.evaluatorFor(args.chainId)
+	if err != nil {
+		return false, common.Address{}, nil, err
+	}
+	var ruleDenial *entitlement.RuleDenial
+	// The other entitlements may allow the check if a rule fails to evaluate, it is only denied if none does.
+	var ruleErr error
 	for _, ent := range entitlements {
 		if ent.EntitlementType == types.ModuleTypeRuleEntitlement {
 			re := ent.RuleEntitlement
@@ -689,45 +2138,52 @@ func (ca *chainAuth) evaluateEntitlementData(
 			// Convert the rule data to the latest version
 			reV2, err := types.ConvertV1RuleDataToV2(ctx, re)
 			if err != nil {
-				return false, err
+				return false, common.Address{}, nil, err
 			}
 
-			result, err := ca.evaluator.EvaluateRuleData(ctx, wallets, reV2)
+			result, denial, err := evaluator.EvaluateRuleDataWithDenial(ctx, wallets, reV2)
 			if err != nil {
-				return false, err
+				if ruleErr == nil {
+					ruleErr = err
+				}
+				continue
 			}
 			if result {
 				log.Debugw("rule entitlement is true", "spaceId", args.spaceId)
-				return true, nil
+				return true, ruleSatisfiedBy, nil, nil
 			} else {
 				log.Debugw("rule entitlement is false", "spaceId", args.spaceId)
+				if ruleDenial == nil {
+					ruleDenial = denial
+				}
 			}
 		} else if ent.EntitlementType == types.ModuleTypeRuleEntitlementV2 {
 			re := ent.RuleEntitlementV2
 			log.Debugw(ent.EntitlementType, "re", re)
-			result, err := ca.evaluator.EvaluateRuleData(ctx, wallets, re)
+			result, denial, err := evaluator.EvaluateRuleDataWithDenial(ctx, wallets, re)
 			if err != nil {
-				return false, err
+				if ruleErr == nil {
+					ruleErr = err
+				}
+				continue
 			}
 			if result {
 				log.Debugw("rule entitlement v2 is true", "spaceId", args.spaceId)
-				return true, nil
+				return true, ruleSatisfiedBy, nil, nil
 			} else {
 				log.Debugw("rule entitlement v2 is false", "spaceId", args.spaceId)
+				if ruleDenial == nil {
+					ruleDenial = denial
+				}
 			}
 
 		} else if ent.EntitlementType == types.ModuleTypeUserEntitlement {
 			log.Debugw("UserEntitlement", "userEntitlement", ent.UserEntitlement)
 			for _, user := range ent.UserEntitlement {
-				if user == everyone {
-					log.Debugw("user entitlement: everyone is entitled to space", "spaceId", args.spaceId)
-					return true, nil
-				} else {
-					for _, wallet := range wallets {
-						if wallet == user {
-							log.Debugw("user entitlement: wallet is entitled to space", "spaceId", args.spaceId, "wallet", wallet)
-							return true, nil
-						}
+				for _, wallet := range wallets {
+					if wallet == user {
+						log.Debugw("user entitlement: wallet is entitled to space", "spaceId", args.spaceId, "wallet", wallet)
+						return true, wallet, nil, nil
 					}
 				}
 			}
@@ -735,19 +2191,53 @@ func (ca *chainAuth) evaluateEntitlementData(
 			log.Warnw("Invalid entitlement type", "entitlement", ent)
 		}
 	}
-	return false, nil
+	if ruleErr != nil {
+		return false, common.Address{}, nil, fmt.Errorf("%w: %w", errRuleCheckFailed, ruleErr)
+	}
+	return false, common.Address{}, ruleDenial, nil
+}
+
+// grantsEveryone returns true if a user entitlement of entitlements includes the everyone address.
+func grantsEveryone(entitlements []types.Entitlement) bool {
+	for _, ent := range entitlements {
+		if ent.EntitlementType == types.ModuleTypeUserEntitlement && slices.Contains(ent.UserEntitlement, everyone) {
+			return true
+		}
+	}
+	return false
 }
 
+// errRuleCheckFailed wraps the errors of the evaluation of rule entitlements returned by evaluateEntitlementData,
+// the check is denied with the RULE_CHECK_FAILED reason, see ruleCheckFailed.
+var errRuleCheckFailed = errors.New("failed to evaluate rule entitlement")
+
+// ruleCheckFailed returns the denial of a check whose rule entitlements failed to evaluate with err, nil if err
+// is another error or the check was canceled or timed out, those are returned as errors.
+func ruleCheckFailed(ctx context.Context, args *ChainAuthArgs, err error) CacheResult {
+	if !errors.Is(err, errRuleCheckFailed) || ctx.Err() != nil {
+		return nil
+	}
+	logging.FromCtx(ctx).Warnw("Failed to evaluate rule entitlements", "args", args, "error", err)
+	return boolCacheResult{isAllowed: false, reason: EntitlementResultReason_RULE_CHECK_FAILED}
+}
+
+// errWalletsBanned is returned by evaluateWithEntitlements if one of the wallets is banned from the space, the
+// check is denied with the BANNED reason.
+var errWalletsBanned = errors.New("wallets are banned from the space")
+
 // evaluateWithEntitlements evaluates a user permission considering 3 factors:
 // 1. Are they the space owner? The space owner has su over all space operations.
 // 2. Are they banned from the space? If so, they are not entitled to anything.
 // 3. Are they entitled to the space based on the entitlement data?
+//
+// Allows are returned with the wallet that satisfied them if known, see evaluateEntitlementData. Denials by the
+// rule entitlements are returned with the unsatisfied check of the rules, bans with errWalletsBanned.
 func (ca *chainAuth) evaluateWithEntitlements(
 	ctx context.Context,
 	args *ChainAuthArgs,
 	owner common.Address,
 	entitlements []types.Entitlement,
-) (bool, error) {
+) (bool, common.Address, *entitlement.RuleDenial, error) {
 	log := logging.FromCtx(ctx)
 
 	// 1. Check if the user is the space owner
@@ -764,13 +2254,13 @@ func (ca *chainAuth) evaluateWithEntitlements(
 				"principal",
 				args.principal,
 			)
-			return true, nil
+			return true, wallet, nil, nil
 		}
 	}
 	// 2. Check if the user has been banned
-	banned, err := ca.spaceContract.IsBanned(ctx, args.spaceId, wallets)
+	banned, err := ca.areWalletsBanned(ctx, args, wallets)
 	if err != nil {
-		return false, AsRiverError(err).Func("evaluateEntitlements").
+		return false, common.Address{}, nil, AsRiverError(err).Func("evaluateEntitlements").
 			Tag("spaceId", args.spaceId).
 			Tag("userId", args.principal)
 	}
@@ -784,15 +2274,15 @@ func (ca *chainAuth) evaluateWithEntitlements(
 			"linkedWallets",
 			args.linkedWallets,
 		)
-		return false, nil
+		return false, common.Address{}, nil, errWalletsBanned
 	}
 
 	// 3. Evaluate entitlement data to check if the user is entitled to the space.
-	allowed, err := ca.evaluateEntitlementData(ctx, entitlements, args)
+	allowed, satisfiedBy, ruleDenial, err := ca.evaluateEntitlementData(ctx, entitlements, args)
 	if err != nil {
-		return false, AsRiverError(err).Func("evaluateEntitlements")
+		return false, common.Address{}, nil, AsRiverError(err).Func("evaluateEntitlements")
 	} else {
-		return allowed, nil
+		return allowed, satisfiedBy, ruleDenial, nil
 	}
 }
 
@@ -803,10 +2293,57 @@ func (ca *chainAuth) isEntitledToSpaceUncached(
 ) (CacheResult, error) {
 	log := logging.FromCtx(ctx)
 	log.Debugw("isEntitledToSpaceUncached", "args", args)
+	entitlementData, err := ca.getSpaceEntitlements(ctx, cfg, args)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed, satisfiedBy, ruleDenial, err := ca.evaluateWithEntitlements(
+		ctx,
+		args,
+		entitlementData.owner,
+		entitlementData.entitlementData,
+	)
+	if errors.Is(err, errWalletsBanned) {
+		return boolCacheResult{isAllowed: false, reason: EntitlementResultReason_BANNED}, nil
+	}
+	if denial := ruleCheckFailed(ctx, args, err); denial != nil {
+		return denial, nil
+	}
+	if err != nil {
+		return nil, AsRiverError(err).
+			Func("isEntitledToSpace").
+			Message("Failed to evaluate entitlements")
+	}
+	if ruleDenial != nil {
+		return &ruleDenialCacheResult{
+			boolCacheResult: boolCacheResult{isAllowed: false, reason: EntitlementResultReason_SPACE_ENTITLEMENTS},
+			ruleDenial:      ruleDenial,
+		}, nil
+	}
+	return boolCacheResult{
+		isAllowed:   allowed,
+		reason:      EntitlementResultReason_SPACE_ENTITLEMENTS,
+		satisfiedBy: satisfiedBy,
+	}, nil
+}
+
+// getSpaceEntitlements returns the entitlements of the space of args for its permission, from the batch of
+// ctx if it has one for the space and the permission.
+func (ca *chainAuth) getSpaceEntitlements(
+	ctx context.Context,
+	cfg *config.Config,
+	args *ChainAuthArgs,
+) (*entitlementCacheResult, error) {
+	batch := principalsBatchFromCtx(ctx, args.spaceId, args.chainId)
+	if batch != nil && batch.permission == args.permission && args.customPermission == "" {
+		return batch.entitlements, nil
+	}
+
 	result, cacheHit, err := ca.entitlementManagerCache.executeUsingCache(
 		ctx,
 		cfg,
-		args,
+		newArgsForEntitlementManager(args),
 		ca.getSpaceEntitlementsForPermissionUncached,
 	)
 	if err != nil {
@@ -820,99 +2357,162 @@ func (ca *chainAuth) isEntitledToSpaceUncached(
 		ca.entitlementCacheMiss.Inc()
 	}
 
-	temp := (result.(*timestampedCacheValue).Result())
-	entitlementData := temp.(*entitlementCacheResult) // Assuming result is of *entitlementCacheResult type
-
-	allowed, err := ca.evaluateWithEntitlements(ctx, args, entitlementData.owner, entitlementData.entitlementData)
-	if err != nil {
-		return nil, AsRiverError(err).
-			Func("isEntitledToSpace").
-			Message("Failed to evaluate entitlements")
-	}
-	return boolCacheResult{allowed, EntitlementResultReason_SPACE_ENTITLEMENTS}, nil
+	return result.(*timestampedCacheValue).Result().(*entitlementCacheResult), nil
 }
 
 func (ca *chainAuth) isEntitledToSpace(
 	ctx context.Context,
 	cfg *config.Config,
 	args *ChainAuthArgs,
-) (bool, EntitlementResultReason, error) {
+) (CacheResult, error) {
 	if args.kind != chainAuthKindSpace {
-		return false, EntitlementResultReason_NONE, RiverError(Err_INTERNAL, "Wrong chain auth kind")
+		return nil, RiverError(Err_INTERNAL, "Wrong chain auth kind")
 	}
 
-	isEntitled, cacheHit, err := ca.entitlementCache.executeUsingCache(ctx, cfg, args, ca.isEntitledToSpaceUncached)
+	isEntitled, cacheHit, err := ca.executeCheckUsingCache(
+		ctx, cfg, ca.entitlementCache, args, ca.isEntitledToSpaceUncached)
 	if err != nil {
-		return false, EntitlementResultReason_NONE, err
+		return nil, err
 	}
 	if cacheHit {
-		ca.isEntitledToSpaceCacheHit.Inc()
+		ca.isEntitledToSpaceCacheHit.incFor(isEntitled)
 	} else {
-		ca.isEntitledToSpaceCacheMiss.Inc()
+		ca.isEntitledToSpaceCacheMiss.incFor(isEntitled)
 	}
 
-	return isEntitled.IsAllowed(), isEntitled.Reason(), nil
+	return isEntitled.(*timestampedCacheValue).Result(), nil
 }
 
 func (ca *chainAuth) isEntitledToChannel(
 	ctx context.Context,
 	cfg *config.Config,
 	args *ChainAuthArgs,
-) (bool, EntitlementResultReason, error) {
+) (CacheResult, error) {
 	if args.kind != chainAuthKindChannel {
-		return false, EntitlementResultReason_NONE, RiverError(Err_INTERNAL, "Wrong chain auth kind")
+		return nil, RiverError(Err_INTERNAL, "Wrong chain auth kind")
 	}
 
-	isEntitled, cacheHit, err := ca.entitlementCache.executeUsingCache(ctx, cfg, args, ca.isEntitledToChannelUncached)
+	isEntitled, cacheHit, err := ca.executeCheckUsingCache(
+		ctx, cfg, ca.entitlementCache, args, ca.isEntitledToChannelUncached)
 	if err != nil {
-		return false, EntitlementResultReason_NONE, err
+		return nil, err
 	}
 	if cacheHit {
-		ca.isEntitledToChannelCacheHit.Inc()
+		ca.isEntitledToChannelCacheHit.incFor(isEntitled)
 	} else {
-		ca.isEntitledToChannelCacheMiss.Inc()
+		ca.isEntitledToChannelCacheMiss.incFor(isEntitled)
+	}
+
+	return isEntitled.(*timestampedCacheValue).Result(), nil
+}
+
+// isChannelModerator evaluates the channel moderator check of args as the channel check of its permission,
+// sharing the cached channel results, and reports denials by the entitlements of the channel as NOT_MODERATOR.
+func (ca *chainAuth) isChannelModerator(
+	ctx context.Context,
+	cfg *config.Config,
+	args *ChainAuthArgs,
+) (CacheResult, error) {
+	result, err := ca.isEntitledToChannel(ctx, cfg, args.asChannelCheck())
+	if err != nil {
+		return nil, err
+	}
+	if result.IsAllowed() || result.Reason() != EntitlementResultReason_CHANNEL_ENTITLEMENTS {
+		return result, nil
+	}
+	if denial, ok := result.(*ruleDenialCacheResult); ok {
+		return &ruleDenialCacheResult{
+			boolCacheResult: boolCacheResult{isAllowed: false, reason: EntitlementResultReason_NOT_MODERATOR},
+			ruleDenial:      denial.ruleDenial,
+		}, nil
+	}
+	return boolCacheResult{isAllowed: false, reason: EntitlementResultReason_NOT_MODERATOR}, nil
+}
+
+func (ca *chainAuth) getLinkedWalletsUncached(
+	ctx context.Context,
+	_ *config.Config,
+	args *ChainAuthArgs,
+) (CacheResult, error) {
+	defer traceStage(ctx, checkStageLinkedWallets)()
+
+	log := logging.FromCtx(ctx)
+
+	// Concurrent misses for the same principal share a single lookup. The cache coalesces misses as well, but
+	// Read checks bust the cache, after which misses no longer wait for lookups that started before the bust.
+	leader := false
+	wallets, err, _ := ca.linkedWalletLookups.Do(args.principal.Hex(), func() (any, error) {
+		leader = true
+		return ca.resolveLinkedWallets(ctx, args.principal)
+	})
+	if !leader {
+		ca.linkedWalletCollapsed.Inc()
+		// The caller that made the lookup may have given up on it, that doesn't fail the other callers.
+		if err != nil && ctx.Err() == nil &&
+			(errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)) {
+			wallets, err = ca.resolveLinkedWallets(ctx, args.principal)
+		}
+	}
+	if err != nil {
+		log.Errorw("Failed to get linked wallets", "error", err, "wallet", args.principal.Hex())
+		return nil, err
+	}
+
+	return wallets.(*linkedWalletCacheValue), nil
+}
+
+func (ca *chainAuth) getLinkedWallets(
+	ctx context.Context,
+	cfg *config.Config,
+	args *ChainAuthArgs,
+) ([]common.Address, error) {
+	// We want fresh linked wallets when evaluating space and channel joins, key solicitations,
+	// user scrubs, and checking if a wallet is linked, all of which request the Read permission.
+	// Note: space joins seem to request Read on the space, but they should probably actually
+	// be sending chain auth args with kind set to chainAuthKindIsSpaceMember.
+	fresh := args.hasPermission(PermissionRead) || args.kind == chainAuthKindIsSpaceMember ||
+		args.kind == chainAuthKindIsWalletLinked
+	if wallets, ok, err := ca.batchLinkedWallets(ctx, cfg, args.principal); ok {
+		return wallets, err
 	}
-
-	return isEntitled.IsAllowed(), isEntitled.Reason(), nil
+	return ca.getLinkedWalletsOf(ctx, cfg, args.principal, fresh)
 }
 
-func (ca *chainAuth) getLinkedWalletsUncached(
+// getLinkedWalletsOf returns the cached linked wallets of the principal, including the principal. If fresh is
+// set, the cached wallets are busted and looked up again. The returned slice is shared with the cache and
+// must not be modified.
+func (ca *chainAuth) getLinkedWalletsOf(
 	ctx context.Context,
-	_ *config.Config,
-	args *ChainAuthArgs,
-) (CacheResult, error) {
-	log := logging.FromCtx(ctx)
-
-	wallets, err := ca.evaluator.GetLinkedWallets(ctx, args.principal, ca.walletLinkContract, nil, nil, nil)
+	cfg *config.Config,
+	principal common.Address,
+	fresh bool,
+) ([]common.Address, error) {
+	value, err := ca.linkedWalletsOf(ctx, cfg, principal, fresh)
 	if err != nil {
-		log.Errorw("Failed to get linked wallets", "error", err, "wallet", args.principal.Hex())
 		return nil, err
 	}
-
-	return &linkedWalletCacheValue{
-		wallets: wallets,
-	}, nil
+	recordBaseChainOnlyWallets(ctx, value.baseChainOnlyUntil)
+	return value.wallets, nil
 }
 
-func (ca *chainAuth) getLinkedWallets(
+// linkedWalletsOf is getLinkedWalletsOf, returning the cached value of the wallets.
+func (ca *chainAuth) linkedWalletsOf(
 	ctx context.Context,
 	cfg *config.Config,
-	args *ChainAuthArgs,
-) ([]common.Address, error) {
+	principal common.Address,
+	fresh bool,
+) (*linkedWalletCacheValue, error) {
 	log := logging.FromCtx(ctx)
 
-	if ca.walletLinkContract == nil {
+	if !ca.walletResolver.hasWalletLink() {
 		log.Warnw("Wallet link contract is not setup properly, returning root key only")
-		return []common.Address{args.principal}, nil
+		ca.observer.linkedWalletsFetched(ctx, principal, []common.Address{principal}, false)
+		return &linkedWalletCacheValue{wallets: []common.Address{principal}}, nil
 	}
 
-	userCacheKey := newArgsForLinkedWallets(args.principal)
-	// We want fresh linked wallets when evaluating space and channel joins, key solicitations,
-	// user scrubs, and checking if a wallet is linked, all of which request the Read permission.
-	// Note: space joins seem to request Read on the space, but they should probably actually
-	// be sending chain auth args with kind set to chainAuthKindIsSpaceMember.
-	if args.permission == PermissionRead || args.kind == chainAuthKindIsSpaceMember ||
-		args.kind == chainAuthKindIsWalletLinked {
+	userCacheKey := newArgsForLinkedWallets(principal)
+	// Lookups that bypass the cache are fresh and must not change it.
+	if fresh && !isCacheBypassed(ctx) {
 		ca.linkedWalletCache.bust(userCacheKey)
 		ca.linkedWalletCacheBust.Inc()
 	}
@@ -924,7 +2524,7 @@ func (ca *chainAuth) getLinkedWallets(
 		ca.getLinkedWalletsUncached,
 	)
 	if err != nil {
-		log.Errorw("Failed to get linked wallets", "error", err, "wallet", args.principal.Hex())
+		log.Errorw("Failed to get linked wallets", "error", err, "wallet", principal.Hex())
 		return nil, err
 	}
 
@@ -934,7 +2534,41 @@ func (ca *chainAuth) getLinkedWallets(
 		ca.linkedWalletCacheMiss.Inc()
 	}
 
-	return result.(*timestampedCacheValue).result.(*linkedWalletCacheValue).wallets, nil
+	value := result.(*timestampedCacheValue).result.(*linkedWalletCacheValue)
+	ca.observer.linkedWalletsFetched(ctx, principal, value.wallets, cacheHit)
+	return value, nil
+}
+
+func (ca *chainAuth) GetLinkedWallets(
+	ctx context.Context,
+	cfg *config.Config,
+	principal common.Address,
+	opts LinkedWalletsOpts,
+) ([]common.Address, error) {
+	wallets, err := ca.getLinkedWalletsOf(ctx, cfg, principal, true)
+	if err != nil {
+		return nil, AsRiverError(err).Func("GetLinkedWallets").Tag("principal", principal)
+	}
+	return orderLinkedWallets(principal, wallets, opts), nil
+}
+
+// orderLinkedWallets returns a copy of wallets in the order documented by ChainAuth.GetLinkedWallets.
+func orderLinkedWallets(principal common.Address, wallets []common.Address, opts LinkedWalletsOpts) []common.Address {
+	ret := make([]common.Address, 0, len(wallets)+1)
+	if !opts.ExcludePrincipal {
+		ret = append(ret, principal)
+	}
+	start := len(ret)
+	for _, wallet := range wallets {
+		if wallet != principal {
+			ret = append(ret, wallet)
+		}
+	}
+	others := ret[start:]
+	slices.SortFunc(others, func(a, b common.Address) int {
+		return a.Cmp(b)
+	})
+	return append(ret[:start], slices.Compact(others)...)
 }
 
 func (ca *chainAuth) checkMembershipUncached(
@@ -942,7 +2576,23 @@ func (ca *chainAuth) checkMembershipUncached(
 	_ *config.Config,
 	args *ChainAuthArgs,
 ) (CacheResult, error) {
-	membershipStatus, err := ca.spaceContract.GetMembershipStatus(ctx, args.spaceId, args.principal)
+	membershipStatus, err := retryRpc(
+		ctx,
+		ca.rpcRetry,
+		"GetMembershipStatus",
+		func(ctx context.Context) (*MembershipStatus, error) {
+			spaceContract, err := ca.spaceContractFor(args.chainId)
+			if err != nil {
+				return nil, err
+			}
+			// Waiting for a slot is aborted once another linked wallet is found to be a member.
+			if err := ca.membershipChecks.Acquire(ctx, 1); err != nil {
+				return nil, AsRiverError(err).Func("checkMembershipUncached")
+			}
+			defer ca.membershipChecks.Release(1)
+			return spaceContract.GetMembershipStatus(ctx, args.spaceId, args.principal)
+		},
+	)
 	if err != nil {
 		return &membershipStatusCacheResult{status: nil}, err
 	}
@@ -954,6 +2604,7 @@ func (ca *chainAuth) checkMembership(
 	cfg *config.Config,
 	address common.Address,
 	spaceId shared.StreamId,
+	chainId uint64,
 	results chan<- *membershipStatusCacheResult,
 	errors chan<- error,
 	wg *sync.WaitGroup,
@@ -965,6 +2616,7 @@ func (ca *chainAuth) checkMembership(
 		kind:      chainAuthKindIsSpaceMember,
 		spaceId:   spaceId,
 		principal: address,
+		chainId:   chainId,
 	}
 	result, cacheHit, err := ca.membershipCache.executeUsingCache(
 		ctx,
@@ -997,6 +2649,7 @@ func (ca *chainAuth) checkMembership(
 	}
 
 	cachedResult := result.(*timestampedCacheValue).result.(*membershipStatusCacheResult)
+	ca.observer.membershipChecked(ctx, spaceId, address, cachedResult.status, cacheHit)
 	results <- cachedResult
 }
 
@@ -1006,17 +2659,22 @@ func (ca *chainAuth) checkStreamIsEnabled(
 	args *ChainAuthArgs,
 ) (bool, EntitlementResultReason, error) {
 	if args.kind == chainAuthKindSpace || args.kind == chainAuthKindIsSpaceMember {
-		isEnabled, reason, err := ca.checkSpaceEnabled(ctx, cfg, args.spaceId)
+		isEnabled, reason, err := ca.checkSpaceEnabled(ctx, cfg, args.spaceId, args.chainId)
 		if err != nil {
 			return false, reason, err
 		}
 		return isEnabled, reason, nil
-	} else if args.kind == chainAuthKindChannel {
-		isEnabled, reason, err := ca.checkChannelEnabled(ctx, cfg, args.spaceId, args.channelId)
+	} else if args.kind == chainAuthKindChannel || args.kind == chainAuthKindChannelModerator {
+		isEnabled, reason, err := ca.checkChannelEnabled(ctx, cfg, args.spaceId, args.channelId, args.chainId)
 		if err != nil {
 			return false, reason, err
 		}
 		return isEnabled, reason, nil
+	} else if args.kind == chainAuthKindApp {
+		if args.channelId == (shared.StreamId{}) {
+			return ca.checkSpaceEnabled(ctx, cfg, args.spaceId, args.chainId)
+		}
+		return ca.checkChannelEnabled(ctx, cfg, args.spaceId, args.channelId, args.chainId)
 	} else if args.kind == chainAuthKindIsWalletLinked {
 		return true, EntitlementResultReason_NONE, nil
 	} else {
@@ -1035,42 +2693,196 @@ func (ca *chainAuth) checkEntitlement(
 	cfg *config.Config,
 	args *ChainAuthArgs,
 ) (CacheResult, error) {
-	log := logging.FromCtx(ctx)
+	if sample := ca.allocSampler.start(); sample != nil {
+		defer sample.done()
+	}
 
-	ctx, cancel := context.WithTimeout(ctx, time.Millisecond*time.Duration(ca.contractCallsTimeoutMs))
+	// The fast paths have a shorter timeout of their own, the caller may override both.
+	timeout := ca.fastPaths.timeoutFor(args, time.Millisecond*time.Duration(ca.contractCallsTimeoutMs))
+	timeout = callTimeout(ctx, timeout, ca.maxCallTimeout)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
+	ctx, provenance := withCacheProvenance(ctx)
+
+	// The time spent waiting for a computation slot counts against the timeout of the check.
+	stopComputeWait := traceStage(ctx, checkStageComputeWait)
+	err := ca.computeLimiter.acquire(ctx)
+	stopComputeWait()
+	if err != nil {
+		return nil, AsRiverError(err).Func("checkEntitlement")
+	}
+	defer ca.computeLimiter.release()
+
+	if args.permissions != "" && args.kind != chainAuthKindSpace && args.kind != chainAuthKindChannel {
+		return nil, RiverError(Err_INVALID_ARGUMENT, "Only space and channel checks can hold several permissions").
+			Func("checkEntitlement").
+			Tag("kind", args.kind)
+	}
 
 	isEnabled, reason, err := ca.checkStreamIsEnabled(ctx, cfg, args)
 	if err != nil {
 		return nil, err
 	} else if !isEnabled {
-		return boolCacheResult{false, reason}, nil
+		ca.countDenial(ctx, reason)
+		return &walletSetCacheResult{
+			CacheResult:  boolCacheResult{isAllowed: false, reason: reason},
+			dataCachedAt: provenance.cachedAt(),
+		}, nil
+	}
+
+	// Apps have no linked wallets and no membership, the space contract decides on its own.
+	if args.kind == chainAuthKindApp {
+		result, err := ca.checkAppEntitlement(ctx, args)
+		if err != nil {
+			return nil, err
+		}
+		if !result.IsAllowed() {
+			ca.countDenial(ctx, result.Reason())
+		}
+		return &walletSetCacheResult{CacheResult: result, dataCachedAt: provenance.cachedAt()}, nil
+	}
+
+	// Get all linked wallets, unless the caller already fetched them.
+	var wallets []common.Address
+	if args.hasPreFetchedWallets {
+		wallets = deserializeWallets(args.preFetchedWallets)
+	} else {
+		wallets, err = ca.getLinkedWallets(ctx, cfg, args)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result, err := ca.checkEntitlementForWallets(ctx, cfg, args, wallets)
+	if err != nil {
+		return nil, err
 	}
+	if !result.IsAllowed() {
+		ca.countDenial(ctx, result.Reason())
+	}
+	return &walletSetCacheResult{
+		CacheResult:        result,
+		walletSetDigest:    WalletSetDigest(wallets),
+		dataCachedAt:       provenance.cachedAt(),
+		baseChainOnlyUntil: provenance.baseChainOnlyWalletsUntil(),
+		validUntil:         provenance.membershipValidUntil(),
+	}, nil
+}
 
-	// Get all linked wallets.
-	wallets, err := ca.getLinkedWallets(ctx, cfg, args)
+// checkAppEntitlement checks whether the app principal of args is installed in the space and granted the
+// permission. Installed apps that aren't granted the permission are denied like users by the entitlements of
+// the space or channel of the check.
+func (ca *chainAuth) checkAppEntitlement(ctx context.Context, args *ChainAuthArgs) (CacheResult, error) {
+	defer traceStage(ctx, checkStageEntitlements)()
+	spaceContract, err := ca.spaceContractFor(args.chainId)
 	if err != nil {
 		return nil, err
 	}
+	installed, entitled, err := spaceContract.IsAppEntitled(ctx, args.spaceId, args.principal, args.permission)
+	if err != nil {
+		return nil, AsRiverError(err, Err_CANNOT_CHECK_ENTITLEMENTS).
+			Func("checkAppEntitlement").
+			Message("Failed to check app entitlement").
+			Tag("spaceId", args.spaceId).
+			Tag("app", args.principal)
+	}
+	if !installed {
+		return boolCacheResult{isAllowed: false, reason: EntitlementResultReason_APP_NOT_INSTALLED}, nil
+	}
+	if !entitled {
+		reason := EntitlementResultReason_SPACE_ENTITLEMENTS
+		if args.channelId != (shared.StreamId{}) {
+			reason = EntitlementResultReason_CHANNEL_ENTITLEMENTS
+		}
+		return boolCacheResult{isAllowed: false, reason: reason}, nil
+	}
+	return boolCacheResult{isAllowed: true, reason: EntitlementResultReason_NONE, satisfiedBy: args.principal}, nil
+}
+
+// countDenial counts a denial computed by checkEntitlement. Evaluations that bypass the cache don't serve
+// their result and are not counted, see dualReader.
+func (ca *chainAuth) countDenial(ctx context.Context, reason EntitlementResultReason) {
+	if !isCacheBypassed(ctx) {
+		ca.denialReasons.WithLabelValues(reason.String()).Inc()
+	}
+}
+
+// checkEntitlementForWallets evaluates the entitlement check against the given set of linked wallets.
+func (ca *chainAuth) checkEntitlementForWallets(
+	ctx context.Context,
+	cfg *config.Config,
+	args *ChainAuthArgs,
+	wallets []common.Address,
+) (CacheResult, error) {
+	log := logging.FromCtx(ctx)
 
 	// handle checking if the user is linked to a specific wallet
 	if args.kind == chainAuthKindIsWalletLinked {
 		for _, wallet := range wallets {
 			if wallet == args.walletAddress {
-				return boolCacheResult{true, EntitlementResultReason_NONE}, nil
+				return boolCacheResult{isAllowed: true, reason: EntitlementResultReason_NONE, satisfiedBy: wallet}, nil
 			}
 		}
-		return boolCacheResult{false, EntitlementResultReason_WALLET_NOT_LINKED}, nil
+		return boolCacheResult{isAllowed: false, reason: EntitlementResultReason_WALLET_NOT_LINKED}, nil
 	}
 
 	// If the user has more linked wallets than we can evaluate, go ahead and short-circuit the evaluation.
-	if len(wallets) > ca.linkedWalletsLimit {
-		return nil, RiverError(Err_RESOURCE_EXHAUSTED,
+	if limit := ca.linkedWalletsLimit.forArgs(args); !ca.linkedWalletsLimit.check(args.principal, len(wallets), limit) {
+		return nil, RiverError(Err_LINKED_WALLETS_LIMIT_EXCEEDED,
 			"too many wallets linked to the root key",
-			"rootKey", args.principal, "wallets", len(wallets)).LogError(log)
+			"rootKey", args.principal, "wallets", len(wallets), "limit", limit).LogError(log)
+	}
+
+	args = ca.argsPool.withLinkedWallets(args, wallets)
+	defer ca.argsPool.put(args)
+
+	// Previews evaluate the check as if the principal were a member, see CheckEntitlementIgnoringMembership.
+	if !isMembershipIgnored(ctx) {
+		denial, validUntil, err := ca.checkWalletsMembershipOnce(ctx, cfg, args, wallets)
+		if err != nil || denial != nil {
+			return denial, err
+		}
+		recordMembershipExpiry(ctx, validUntil)
 	}
 
-	args = args.withLinkedWallets(wallets)
+	return ca.areLinkedWalletsEntitled(ctx, cfg, args)
+}
+
+// checkWalletsMembership checks that one of the wallets is a member of the space of args whose membership
+// didn't expire. It returns the denial if none is, nil otherwise along with the time the membership that was
+// found expires, zero if it doesn't. Other wallets may hold memberships that expire later.
+func (ca *chainAuth) checkWalletsMembership(
+	ctx context.Context,
+	cfg *config.Config,
+	args *ChainAuthArgs,
+	wallets []common.Address,
+) (CacheResult, time.Time, error) {
+	defer traceStage(ctx, checkStageMembership)()
+
+	log := logging.FromCtx(ctx)
+
+	// The statuses of several wallets are fetched in a single call if the space contract can batch them.
+	if len(wallets) > 1 {
+		if statuses := ca.getMembershipStatusBatch(ctx, cfg, args, wallets); statuses != nil {
+			isMember := false
+			for _, status := range statuses {
+				if status.IsMember && !status.IsExpired {
+					return nil, (&membershipStatusCacheResult{status: status}).expiresAt(), nil
+				}
+				isMember = isMember || status.IsMember
+			}
+			if !isMember {
+				log.Debugw("User is not a member of the space", "userId", args.principal, "spaceId", args.spaceId,
+					"wallets", wallets)
+				return boolCacheResult{isAllowed: false, reason: EntitlementResultReason_MEMBERSHIP}, time.Time{}, nil
+			}
+			log.Debugw("Membership expired", "principal", args.principal, "spaceId", args.spaceId)
+			return boolCacheResult{
+				isAllowed: false,
+				reason:    EntitlementResultReason_MEMBERSHIP_EXPIRED,
+			}, time.Time{}, nil
+		}
+	}
 
 	isMemberCtx, isMemberCancel := context.WithCancel(ctx)
 	defer isMemberCancel()
@@ -1080,10 +2892,25 @@ func (ca *chainAuth) checkEntitlement(
 
 	var isMemberWg sync.WaitGroup
 
-	for _, address := range wallets {
-		isMemberWg.Add(1)
-		go ca.checkMembership(isMemberCtx, cfg, address, args.spaceId, isMemberResults, isMemberError, &isMemberWg)
-	}
+	// At most cfg.MaxConcurrentMembershipChecks wallets are checked at a time, the remaining wallets are not
+	// checked once the checks are cancelled. The checks can outlive args, which is reused once this returns.
+	checks := semaphore.NewWeighted(int64(cfg.GetMaxConcurrentMembershipChecks()))
+	spaceId, chainId := args.spaceId, args.chainId
+	isMemberWg.Add(len(wallets))
+	go func() {
+		for i, address := range wallets {
+			if err := checks.Acquire(isMemberCtx, 1); err != nil {
+				isMemberError <- err
+				isMemberWg.Add(i - len(wallets))
+				return
+			}
+			go func() {
+				defer checks.Release(1)
+				ca.checkMembership(
+					isMemberCtx, cfg, address, spaceId, chainId, isMemberResults, isMemberError, &isMemberWg)
+			}()
+		}
+	}()
 
 	// Wait for at least one true result or all to complete
 	go func() {
@@ -1094,7 +2921,8 @@ func (ca *chainAuth) checkEntitlement(
 
 	isMember := false
 	isExpired := true
-	var membershipError error = nil
+	var validUntil time.Time
+	var membershipErrors []error
 
 	// This loop will wait on at least one true result, and will exit if the channel is closed,
 	// meaning all checks have terminated, or if at least one check was positive.
@@ -1104,6 +2932,7 @@ func (ca *chainAuth) checkEntitlement(
 			// if not expired, cancel other checks, otherwise continue
 			if !result.status.IsExpired {
 				isExpired = false
+				validUntil = result.expiresAt()
 				isMemberCancel()
 				break
 			}
@@ -1122,14 +2951,16 @@ func (ca *chainAuth) checkEntitlement(
 			// Here, we collect all errors and report them, assuming that when the isMember result is false,
 			// no contexts were cancelled by us and therefore any errors that occur at all are informative.
 			if err != nil {
-				if membershipError != nil {
-					membershipError = fmt.Errorf("%w; %w", membershipError, err)
-				} else {
-					membershipError = err
-				}
+				membershipErrors = append(membershipErrors, err)
 			}
 		}
-		if membershipError != nil {
+		if len(membershipErrors) > 0 {
+			// A single error keeps its code, several are joined so each of them can still be matched with
+			// errors.Is and errors.As.
+			membershipError := membershipErrors[0]
+			if len(membershipErrors) > 1 {
+				membershipError = errors.Join(membershipErrors...)
+			}
 			membershipError = AsRiverError(membershipError, Err_CANNOT_CHECK_ENTITLEMENTS).
 				Message("Error(s) evaluating user space membership").
 				Func("checkEntitlement").
@@ -1148,7 +2979,7 @@ func (ca *chainAuth) checkEntitlement(
 				"aggregateError",
 				membershipError,
 			)
-			return nil, membershipError
+			return nil, time.Time{}, membershipError
 		} else {
 			// It is expected that some membership checks will fail when the user is legitimately
 			// not entitled, so this log statement is for debugging only.
@@ -1161,21 +2992,106 @@ func (ca *chainAuth) checkEntitlement(
 				"wallets",
 				wallets,
 			)
-			return boolCacheResult{false, EntitlementResultReason_MEMBERSHIP}, nil
+			return boolCacheResult{isAllowed: false, reason: EntitlementResultReason_MEMBERSHIP}, time.Time{}, nil
 		}
 	}
 
 	if isExpired {
 		log.Debugw("Membership expired", "principal", args.principal, "spaceId", args.spaceId)
-		return boolCacheResult{false, EntitlementResultReason_MEMBERSHIP_EXPIRED}, nil
+		return boolCacheResult{
+			isAllowed: false,
+			reason:    EntitlementResultReason_MEMBERSHIP_EXPIRED,
+		}, time.Time{}, nil
+	}
+	return nil, validUntil, nil
+}
+
+// getMembershipStatusBatch returns the membership statuses of the wallets in the space of args, in the order
+// of the wallets. The statuses that are not cached are fetched in a single SpaceContract.GetMembershipStatusBatch
+// call and cached per wallet. It returns nil if they can't be fetched in a batch, the caller checks the wallets
+// one by one then.
+func (ca *chainAuth) getMembershipStatusBatch(
+	ctx context.Context,
+	cfg *config.Config,
+	args *ChainAuthArgs,
+	wallets []common.Address,
+) []*MembershipStatus {
+	log := logging.FromCtx(ctx)
+
+	statuses := make([]*MembershipStatus, len(wallets))
+	keys := make([]ChainAuthArgs, len(wallets))
+	var missed []common.Address
+	var missedIdx []int
+	for i, wallet := range wallets {
+		keys[i] = ChainAuthArgs{
+			kind:      chainAuthKindIsSpaceMember,
+			spaceId:   args.spaceId,
+			principal: wallet,
+			chainId:   args.chainId,
+		}
+		if val, ok := ca.membershipCache.lookup(ctx, &keys[i]); ok {
+			ca.membershipCacheHit.Inc()
+			statuses[i] = val.(*timestampedCacheValue).result.(*membershipStatusCacheResult).status
+			ca.observer.membershipChecked(ctx, args.spaceId, wallet, statuses[i], true)
+		} else {
+			missed = append(missed, wallet)
+			missedIdx = append(missedIdx, i)
+		}
+	}
+	if len(missed) == 0 {
+		return statuses
 	}
 
-	result, reason, err := ca.areLinkedWalletsEntitled(ctx, cfg, args)
+	fetched, err := retryRpc(
+		ctx,
+		ca.rpcRetry,
+		"GetMembershipStatusBatch",
+		func(ctx context.Context) ([]*MembershipStatus, error) {
+			spaceContract, err := ca.spaceContractFor(args.chainId)
+			if err != nil {
+				return nil, err
+			}
+			if err := ca.membershipChecks.Acquire(ctx, 1); err != nil {
+				return nil, AsRiverError(err).Func("getMembershipStatusBatch")
+			}
+			defer ca.membershipChecks.Release(1)
+			return spaceContract.GetMembershipStatusBatch(ctx, args.spaceId, missed)
+		},
+	)
 	if err != nil {
-		return nil, err
+		if !errors.Is(err, ErrMembershipBatchUnsupported) {
+			log.Warnw("Failed to check the membership of the wallets in a batch", "spaceId", args.spaceId,
+				"wallets", missed, "error", err)
+		}
+		return nil
+	}
+	if len(fetched) != len(missed) {
+		log.Warnw("Wrong number of membership statuses in batch", "spaceId", args.spaceId, "wallets", missed,
+			"statuses", len(fetched))
+		return nil
 	}
 
-	return boolCacheResult{result, reason}, nil
+	for j, i := range missedIdx {
+		status := fetched[j]
+		if status == nil {
+			return nil
+		}
+		_, _, err := ca.membershipCache.executeUsingCache(
+			ctx,
+			cfg,
+			&keys[i],
+			func(context.Context, *config.Config, *ChainAuthArgs) (CacheResult, error) {
+				return &membershipStatusCacheResult{status: status}, nil
+			},
+		)
+		if err != nil {
+			return nil
+		}
+		ca.membershipCacheMiss.Inc()
+		statuses[i] = status
+		ca.observer.membershipChecked(ctx, args.spaceId, wallets[i], status, false)
+	}
+	return statuses
 }
 
 func (ca *chainAuth) GetMembershipStatus(
@@ -1184,16 +3100,80 @@ func (ca *chainAuth) GetMembershipStatus(
 	spaceId shared.StreamId,
 	principal common.Address,
 ) (*MembershipStatus, error) {
-	args := ChainAuthArgs{
-		kind:      chainAuthKindIsSpaceMember,
-		spaceId:   spaceId,
-		principal: principal,
+	return ca.getMembershipStatus(ctx, cfg, newArgsForIsSpaceMember(spaceId, principal))
+}
+
+func (ca *chainAuth) GetMembershipExpiry(
+	ctx context.Context,
+	cfg *config.Config,
+	spaceId shared.StreamId,
+	principal common.Address,
+) (time.Time, error) {
+	status, err := ca.getMembershipStatus(ctx, cfg, newArgsForIsSpaceMember(spaceId, principal))
+	if err != nil {
+		return time.Time{}, err
+	}
+	expiry, err := membershipExpiry(status)
+	if err != nil {
+		return time.Time{}, AsRiverError(err).Func("GetMembershipExpiry").
+			Tag("spaceId", spaceId).
+			Tag("principal", principal)
+	}
+	return expiry, nil
+}
+
+func (ca *chainAuth) ListSpaceMembers(
+	ctx context.Context,
+	cfg *config.Config,
+	spaceId shared.StreamId,
+	page int,
+	pageSize int,
+) ([]common.Address, error) {
+	if page < 0 || pageSize <= 0 || pageSize > ca.maxMembersPageSize {
+		return nil, RiverError(
+			Err_INVALID_ARGUMENT,
+			"Invalid page",
+			"page", page,
+			"pageSize", pageSize,
+			"maxPageSize", ca.maxMembersPageSize,
+		).Func("ListSpaceMembers")
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Millisecond*time.Duration(ca.contractCallsTimeoutMs))
+	defer cancel()
+	members, err := retryRpc(
+		ctx,
+		ca.rpcRetry,
+		"ListSpaceMembers",
+		func(ctx context.Context) ([]common.Address, error) {
+			return ca.spaceContract.ListSpaceMembers(ctx, spaceId, page, pageSize)
+		},
+	)
+	if errors.Is(err, ErrNoMoreSpaceMembers) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, AsRiverError(err).Func("ListSpaceMembers").Tag("spaceId", spaceId).Tag("page", page)
+	}
+	return members, nil
+}
+
+// getMembershipStatus returns the membership status of the principal in the space, args must be created
+// with NewChainAuthArgsForIsSpaceMember. The returned status is a copy of the cached one and may be modified.
+func (ca *chainAuth) getMembershipStatus(
+	ctx context.Context,
+	cfg *config.Config,
+	args *ChainAuthArgs,
+) (*MembershipStatus, error) {
+	if args.kind != chainAuthKindIsSpaceMember {
+		return nil, RiverError(Err_INTERNAL, "Wrong chain auth kind").Func("GetMembershipStatus")
 	}
+	ctx, args = args.withoutCallOptions(ctx)
+	spaceId, principal := args.spaceId, args.principal
 
 	result, cacheHit, err := ca.membershipCache.executeUsingCache(
 		ctx,
 		cfg,
-		&args,
+		args,
 		ca.checkMembershipUncached,
 	)
 	if err != nil {
@@ -1208,10 +3188,132 @@ func (ca *chainAuth) GetMembershipStatus(
 		ca.membershipCacheMiss.Inc()
 	}
 
-	if cachedResult, ok := result.(*timestampedCacheValue).result.(*membershipStatusCacheResult); ok {
-		return cachedResult.GetMembershipStatus(), nil
+	cachedResult, ok := result.(*timestampedCacheValue).result.(*membershipStatusCacheResult)
+	if !ok || cachedResult.GetMembershipStatus() == nil {
+		return nil, RiverError(Err_INTERNAL, "Unexpected membership cache value").
+			Func("GetMembershipStatus").
+			Tag("spaceId", spaceId).
+			Tag("principal", principal)
+	}
+	ca.observer.membershipChecked(ctx, spaceId, principal, cachedResult.GetMembershipStatus(), cacheHit)
+	return cachedResult.GetMembershipStatus().clone(), nil
+}
+
+// IsBanned returns true if the principal or any of its linked wallets is banned from the space. It is not
+// cached itself: the linked wallets and the ban list of the space are, so it agrees with the entitlement checks
+// for as long as the ban list is cached and no longer.
+func (ca *chainAuth) IsBanned(
+	ctx context.Context,
+	cfg *config.Config,
+	spaceId shared.StreamId,
+	principal common.Address,
+) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Millisecond*time.Duration(ca.contractCallsTimeoutMs))
+	defer cancel()
+
+	wallets, err := ca.getLinkedWallets(ctx, cfg, newArgsForIsBanned(spaceId, principal))
+	if err != nil {
+		return false, AsRiverError(err).Func("IsBanned").
+			Tag("spaceId", spaceId).
+			Tag("principal", principal)
+	}
+
+	bannedWallets, err := ca.getBannedWallets(ctx, spaceId, 0)
+	if err != nil {
+		return false, AsRiverError(err).Func("IsBanned").
+			Tag("spaceId", spaceId).
+			Tag("principal", principal)
+	}
+	return bannedWallets.isBanned(wallets), nil
+}
+
+func (ca *chainAuth) GetChannelEntitlements(
+	ctx context.Context,
+	cfg *config.Config,
+	spaceId shared.StreamId,
+	channelId shared.StreamId,
+	permission Permission,
+) ([]types.Entitlement, common.Address, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Millisecond*time.Duration(ca.contractCallsTimeoutMs))
+	defer cancel()
+
+	result, cacheHit, err := ca.entitlementManagerCache.executeUsingCache(
+		ctx,
+		cfg,
+		newArgsForEntitlementManager(&ChainAuthArgs{
+			kind:       chainAuthKindChannel,
+			spaceId:    spaceId,
+			channelId:  channelId,
+			permission: permission,
+		}),
+		ca.getChannelEntitlementsForPermissionUncached,
+	)
+	if err != nil {
+		return nil, common.Address{}, AsRiverError(err).Func("GetChannelEntitlements").
+			Tag("spaceId", spaceId).
+			Tag("channelId", channelId).
+			Tag("permission", permission)
+	}
+
+	if cacheHit {
+		ca.entitlementManagerCacheHit.Inc()
+	} else {
+		ca.entitlementManagerCacheMiss.Inc()
+	}
+
+	entitlementData := result.(*timestampedCacheValue).Result().(*entitlementCacheResult)
+	return entitlementData.entitlementData, entitlementData.owner, nil
+}
+
+func (ca *chainAuth) GetSpaceOwner(
+	ctx context.Context,
+	cfg *config.Config,
+	spaceId shared.StreamId,
+) (common.Address, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Millisecond*time.Duration(ca.contractCallsTimeoutMs))
+	defer cancel()
+
+	result, cacheHit, err := ca.entitlementManagerCache.executeUsingCache(
+		ctx,
+		cfg,
+		newArgsForEntitlementManager(NewChainAuthArgsForSpace(spaceId, "", PermissionRead)),
+		ca.getSpaceEntitlementsForPermissionUncached,
+	)
+	if err != nil {
+		return common.Address{}, AsRiverError(err).Func("GetSpaceOwner").Tag("spaceId", spaceId)
+	}
+
+	if cacheHit {
+		ca.entitlementCacheHit.Inc()
+	} else {
+		ca.entitlementCacheMiss.Inc()
+	}
+
+	return result.(*timestampedCacheValue).Result().(*entitlementCacheResult).owner, nil
+}
+
+func (ca *chainAuth) IsSpaceGated(
+	ctx context.Context,
+	cfg *config.Config,
+	spaceId shared.StreamId,
+	permission Permission,
+) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Millisecond*time.Duration(ca.contractCallsTimeoutMs))
+	defer cancel()
+
+	entitlements, err := ca.getSpaceEntitlements(ctx, cfg, NewChainAuthArgsForSpace(spaceId, "", permission))
+	if err != nil {
+		return false, AsRiverError(err).Func("IsSpaceGated").Tag("spaceId", spaceId).Tag("permission", permission)
 	}
+	return isGated(entitlements.entitlementData), nil
+}
 
-	// Fallback to direct contract call if cache type conversion fails
-	return ca.spaceContract.GetMembershipStatus(ctx, spaceId, principal)
+// isGated returns false if entitlements grant everyone and are all user entitlements, true otherwise.
+func isGated(entitlements []types.Entitlement) bool {
+	for _, ent := range entitlements {
+		if ent.EntitlementType != types.ModuleTypeUserEntitlement {
+			return true
+		}
+	}
+	return !grantsEveryone(entitlements)
 }
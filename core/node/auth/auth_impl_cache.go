@@ -2,15 +2,23 @@ package auth
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	lru "github.com/hashicorp/golang-lru/arc/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sync/singleflight"
 
 	"github.com/towns-protocol/towns/core/config"
 	. "github.com/towns-protocol/towns/core/node/base"
+	"github.com/towns-protocol/towns/core/node/infra"
 	"github.com/towns-protocol/towns/core/node/logging"
 	"github.com/towns-protocol/towns/core/node/protocol"
+	"github.com/towns-protocol/towns/core/xchain/entitlement"
 )
 
 type entitlementCache struct {
@@ -21,8 +29,45 @@ type entitlementCache struct {
 	negativeCache    *lru.ARCCache[ChainAuthArgs, entitlementCacheValue]
 	positiveCacheTTL time.Duration
 	negativeCacheTTL time.Duration
+
+	// name identifies the cache in the write-ahead log and in metrics, wal is nil if disk persistence is
+	// disabled.
+	name string
+	wal  *cacheWal
+
+	// readOnly refuses misses while chainAuth is read-only, nil if the cache is never read-only.
+	readOnly *readOnlyMode
+
+	// sizeLimiter is nil for caches that don't account for the memory held by their entries.
+	sizeLimiter *cacheSizeLimiter
+
+	// generations is nil for caches whose keys don't depend on the space generation.
+	generations *spaceGenerations
+	sweeper     cacheGenerationSweeper
+
+	// expiryJitter is the fraction of the TTL by which the expiry of inserted entries is randomly
+	// moved forward or back, so entries inserted together don't all expire at once. 0 disables it.
+	expiryJitter float64
+
+	// inflight coalesces concurrent misses for the same key into a single computation of the result.
+	inflight singleflight.Group
+	// coalesced counts the misses that waited for the result of another caller, nil if not tracked.
+	coalesced prometheus.Counter
+	// servedAge records the age of the values served from the cache, nil if not tracked.
+	servedAge *cacheServedAgeMetrics
+
+	// onEvict is called before an entry is removed, nil if not set.
+	onEvict cacheEvictFunc
+
+	// clock tells the time entries are stored and expire at, the system clock if nil.
+	clock Clock
 }
 
+// cacheEvictFunc is called synchronously before an entry is removed from an entitlement cache because it
+// expired, was busted or invalidated, or was evicted to bound the memory held by the cache. It is not called
+// for entries the underlying LRU drops to make room for new ones. The callback must not modify the cache.
+type cacheEvictFunc func(args *ChainAuthArgs, result CacheResult)
+
 type EntitlementResultReason int
 
 const (
@@ -34,6 +79,28 @@ const (
 	EntitlementResultReason_SPACE_DISABLED
 	EntitlementResultReason_CHANNEL_DISABLED
 	EntitlementResultReason_WALLET_NOT_LINKED
+	// EntitlementResultReason_MAINTENANCE tags the errors of checks refused while chainAuth is read-only, it
+	// is never the reason of a result, see chainAuth.SetReadOnly.
+	EntitlementResultReason_MAINTENANCE
+	// EntitlementResultReason_POLICY_DENIED is the reason of checks allowed by the chain and denied by a
+	// policy hook, see PolicyHook.
+	EntitlementResultReason_POLICY_DENIED
+	// EntitlementResultReason_NOT_MODERATOR is the reason of channel moderator checks denied by the
+	// entitlements of the channel, see NewChainAuthArgsForIsChannelModerator.
+	EntitlementResultReason_NOT_MODERATOR
+	// EntitlementResultReason_APP_NOT_INSTALLED is the reason of app checks denied because the app is not
+	// installed in the space, see NewChainAuthArgsForApp.
+	EntitlementResultReason_APP_NOT_INSTALLED
+	// EntitlementResultReason_BANNED is the reason of checks denied because one of the wallets of the principal
+	// is banned from the space.
+	EntitlementResultReason_BANNED
+	// EntitlementResultReason_SPACE_NOT_FOUND is the reason of checks denied because the space, or the space
+	// of the channel, doesn't exist, as opposed to SPACE_DISABLED for spaces that exist and are disabled.
+	EntitlementResultReason_SPACE_NOT_FOUND
+	// EntitlementResultReason_RULE_CHECK_FAILED is the reason of checks denied because a rule entitlement
+	// couldn't be evaluated, e.g. a chain it reads is unreachable, as opposed to SPACE_ENTITLEMENTS and
+	// CHANNEL_ENTITLEMENTS for rules the user doesn't satisfy. These results are not cached, see isCacheable.
+	EntitlementResultReason_RULE_CHECK_FAILED
 
 	EntitlementResultReason_MAX // MAX - leave at the end
 )
@@ -47,6 +114,13 @@ var entitlementResultReasonDescriptions = []string{
 	"SPACE_DISABLED",
 	"CHANNEL_DISABLED",
 	"WALLET_NOT_LINKED",
+	"MAINTENANCE",
+	"POLICY_DENIED",
+	"NOT_MODERATOR",
+	"APP_NOT_INSTALLED",
+	"BANNED",
+	"SPACE_NOT_FOUND",
+	"RULE_CHECK_FAILED",
 }
 
 func (r EntitlementResultReason) String() string {
@@ -58,6 +132,19 @@ type CacheResult interface {
 	Reason() EntitlementResultReason
 }
 
+// isCacheable returns false for results that don't decide the check, such as the denials of rules that
+// couldn't be evaluated. They are returned to the caller but not stored, so the next check evaluates them again.
+func isCacheable(result CacheResult) bool {
+	return result.Reason() != EntitlementResultReason_RULE_CHECK_FAILED
+}
+
+// expiringCacheResult is implemented by results that become invalid at a known time, cached entries of
+// these results are not served past that time even if their TTL hasn't elapsed.
+type expiringCacheResult interface {
+	// expiresAt returns the time the result becomes invalid, zero if it doesn't expire.
+	expiresAt() time.Time
+}
+
 // Cached results of isEntitlement check with the TTL of the result
 type entitlementCacheValue interface {
 	IsAllowed() bool
@@ -68,6 +155,10 @@ type entitlementCacheValue interface {
 type timestampedCacheValue struct {
 	result    CacheResult
 	timestamp time.Time
+	// ttlJitter is added to the TTL of the cache the value is stored in.
+	ttlJitter time.Duration
+	// expiresAt caps the TTL of the value if set, see expiringCacheResult.
+	expiresAt time.Time
 }
 
 func (ccv *timestampedCacheValue) IsAllowed() bool {
@@ -86,9 +177,20 @@ func (ccv *timestampedCacheValue) GetTimestamp() time.Time {
 	return ccv.timestamp
 }
 
+// cachedAt returns the timestamp of the oldest data the value was computed from.
+func (ccv *timestampedCacheValue) cachedAt() time.Time {
+	if walletSet, ok := ccv.result.(*walletSetCacheResult); ok &&
+		!walletSet.dataCachedAt.IsZero() && walletSet.dataCachedAt.Before(ccv.timestamp) {
+		return walletSet.dataCachedAt
+	}
+	return ccv.timestamp
+}
+
 type boolCacheResult struct {
 	isAllowed bool
 	reason    EntitlementResultReason
+	// satisfiedBy is the linked wallet that satisfied an allowed check, zero if no single wallet is known to.
+	satisfiedBy common.Address
 }
 
 func (b boolCacheResult) IsAllowed() bool {
@@ -102,6 +204,62 @@ func (b boolCacheResult) Reason() EntitlementResultReason {
 	return b.reason
 }
 
+// walletSetCacheResult is the result of an entitlement check along with the digest of the linked
+// wallets it was evaluated against.
+type walletSetCacheResult struct {
+	CacheResult
+	walletSetDigest common.Hash
+	// dataCachedAt is the timestamp of the oldest cached value the check was evaluated with, zero if the
+	// check only used fresh values.
+	dataCachedAt time.Time
+	// baseChainOnlyUntil is set if the check was evaluated with linked wallets read from the base chain only,
+	// the result is not served past it, see linkedWalletCacheValue.
+	baseChainOnlyUntil time.Time
+	// validUntil is the time the membership an allowed check was evaluated with expires, zero if it doesn't
+	// or if it is not known. The result is not served past it.
+	validUntil time.Time
+}
+
+func (r *walletSetCacheResult) expiresAt() time.Time {
+	if r.validUntil.IsZero() || (!r.baseChainOnlyUntil.IsZero() && r.baseChainOnlyUntil.Before(r.validUntil)) {
+		return r.baseChainOnlyUntil
+	}
+	return r.validUntil
+}
+
+// ruleDenialCacheResult is a denial by the rule entitlements of a space or channel along with the check of
+// the rules the user doesn't satisfy.
+type ruleDenialCacheResult struct {
+	boolCacheResult
+	ruleDenial *entitlement.RuleDenial
+}
+
+// ruleDenialOf returns the unsatisfied check of the rule entitlements that denied result, nil if result is
+// not a denial by rule entitlements.
+func ruleDenialOf(result CacheResult) *entitlement.RuleDenial {
+	switch result := result.(type) {
+	case *ruleDenialCacheResult:
+		return result.ruleDenial
+	case *walletSetCacheResult:
+		return ruleDenialOf(result.CacheResult)
+	default:
+		return nil
+	}
+}
+
+// satisfiedByOf returns the linked wallet that satisfied result, zero if result is not an allow by a single
+// wallet.
+func satisfiedByOf(result CacheResult) common.Address {
+	switch result := result.(type) {
+	case boolCacheResult:
+		return result.satisfiedBy
+	case *walletSetCacheResult:
+		return satisfiedByOf(result.CacheResult)
+	default:
+		return common.Address{}
+	}
+}
+
 type membershipStatusCacheResult struct {
 	status *MembershipStatus
 }
@@ -117,6 +275,15 @@ func (ms *membershipStatusCacheResult) GetMembershipStatus() *MembershipStatus {
 	return ms.status
 }
 
+// expiresAt returns the on-chain expiration of the membership, zero if the membership doesn't expire or
+// is not active.
+func (ms *membershipStatusCacheResult) expiresAt() time.Time {
+	if ms.status == nil || ms.status.ExpiryTime == nil || ms.status.ExpiryTime.Sign() == 0 {
+		return time.Time{}
+	}
+	return time.Unix(ms.status.ExpiryTime.Int64(), 0)
+}
+
 func (ms *membershipStatusCacheResult) Reason() EntitlementResultReason {
 	if ms.status == nil {
 		return EntitlementResultReason_NONE
@@ -132,6 +299,14 @@ func (ms *membershipStatusCacheResult) Reason() EntitlementResultReason {
 
 type linkedWalletCacheValue struct {
 	wallets []common.Address
+	// baseChainOnlyUntil is set if the wallets were read from the base chain only because the cross-chain
+	// evaluator failed, they miss the wallets that delegated to them on Ethereum mainnet. The wallets are not
+	// served past it, see resolveLinkedWallets.
+	baseChainOnlyUntil time.Time
+}
+
+func (lwcv *linkedWalletCacheValue) expiresAt() time.Time {
+	return lwcv.baseChainOnlyUntil
 }
 
 func (lwcv *linkedWalletCacheValue) GetLinkedWallets() []common.Address {
@@ -152,7 +327,11 @@ func (lwcv *linkedWalletCacheValue) GetTimestamp() time.Time {
 	return time.Now()
 }
 
-func newEntitlementCache(ctx context.Context, cfg *config.ChainConfig) (*entitlementCache, error) {
+func newEntitlementCache(
+	ctx context.Context,
+	cfg *config.ChainConfig,
+	onEvict cacheEvictFunc,
+) (*entitlementCache, error) {
 	log := logging.FromCtx(ctx)
 
 	positiveCacheSize := 10000
@@ -186,10 +365,11 @@ func newEntitlementCache(ctx context.Context, cfg *config.ChainConfig) (*entitle
 	}
 
 	return &entitlementCache{
-		positiveCache,
-		negativeCache,
-		positiveCacheTTL,
-		negativeCacheTTL,
+		positiveCache:    positiveCache,
+		negativeCache:    negativeCache,
+		positiveCacheTTL: positiveCacheTTL,
+		negativeCacheTTL: negativeCacheTTL,
+		onEvict:          onEvict,
 	}, nil
 }
 
@@ -197,7 +377,11 @@ func newEntitlementCache(ctx context.Context, cfg *config.ChainConfig) (*entitle
 // but for space and channel joins, key solicitations, and channel scrubs, we want to use the most
 // recent value. That's why the auth_impl module busts the cache whenever IsEntitled is called with
 // the Read permission is requested, or space membership is being evaluated.
-func newLinkedWalletCache(ctx context.Context, cfg *config.ChainConfig) (*entitlementCache, error) {
+func newLinkedWalletCache(
+	ctx context.Context,
+	cfg *config.ChainConfig,
+	onEvict cacheEvictFunc,
+) (*entitlementCache, error) {
 	log := logging.FromCtx(ctx)
 
 	positiveCacheSize := 50000
@@ -230,14 +414,20 @@ func newLinkedWalletCache(ctx context.Context, cfg *config.ChainConfig) (*entitl
 	negativeCacheTTL := 2 * time.Second
 
 	return &entitlementCache{
-		positiveCache,
-		negativeCache,
-		positiveCacheTTL,
-		negativeCacheTTL,
+		positiveCache:    positiveCache,
+		negativeCache:    negativeCache,
+		positiveCacheTTL: positiveCacheTTL,
+		negativeCacheTTL: negativeCacheTTL,
+		onEvict:          onEvict,
 	}, nil
 }
 
-func newEntitlementManagerCache(ctx context.Context, cfg *config.ChainConfig) (*entitlementCache, error) {
+func newEntitlementManagerCache(
+	ctx context.Context,
+	cfg *config.ChainConfig,
+	metrics infra.MetricsFactory,
+	onEvict cacheEvictFunc,
+) (*entitlementCache, error) {
 	log := logging.FromCtx(ctx)
 
 	positiveCacheSize := 10000
@@ -270,25 +460,121 @@ func newEntitlementManagerCache(ctx context.Context, cfg *config.ChainConfig) (*
 		negativeCacheTTL = time.Duration(cfg.NegativeEntitlementManagerCacheTTLSeconds) * time.Second
 	}
 
+	// Rule entitlement trees can get large for spaces with many roles, so the memory held by this cache is capped.
+	maxBytes := int64(DEFAULT_ENTITLEMENT_MANAGER_CACHE_MAX_BYTES)
+	if cfg.EntitlementManagerCacheMaxBytes > 0 {
+		maxBytes = cfg.EntitlementManagerCacheMaxBytes
+	}
+	warnThreshold := DEFAULT_ENTITLEMENT_PAYLOAD_WARN_THRESHOLD_BYTES
+	if cfg.EntitlementPayloadWarnThresholdBytes > 0 {
+		warnThreshold = cfg.EntitlementPayloadWarnThresholdBytes
+	}
+
 	return &entitlementCache{
-		positiveCache,
-		negativeCache,
-		positiveCacheTTL,
-		negativeCacheTTL,
+		positiveCache:    positiveCache,
+		negativeCache:    negativeCache,
+		positiveCacheTTL: positiveCacheTTL,
+		negativeCacheTTL: negativeCacheTTL,
+		sizeLimiter: newCacheSizeLimiter(
+			cacheResultSize,
+			maxBytes,
+			warnThreshold,
+			metrics.NewGaugeEx(
+				"entitlement_manager_cache_bytes",
+				"Approximate memory held by the entitlement manager cache entries",
+			),
+		),
+		onEvict: onEvict,
 	}, nil
 }
 
+// setExpiryJitter spreads the expiry of subsequently inserted entries by up to percent of the TTL.
+func (ec *entitlementCache) setExpiryJitter(percent int) {
+	ec.expiryJitter = float64(min(max(percent, 0), 100)) / 100
+}
+
+// jitter returns a random TTL adjustment for a new entry in [-expiryJitter*ttl, expiryJitter*ttl].
+func (ec *entitlementCache) jitter(ttl time.Duration) time.Duration {
+	if ec.expiryJitter <= 0 {
+		return 0
+	}
+	return time.Duration((rand.Float64()*2 - 1) * ec.expiryJitter * float64(ttl))
+}
+
+// now returns the current time of the clock of the cache.
+func (ec *entitlementCache) now() time.Time {
+	if ec.clock == nil {
+		return time.Now()
+	}
+	return ec.clock.Now()
+}
+
+// isFresh returns true if val is younger than ttl at now, adjusted by the jitter of the entry, and has not
+// reached its expiration.
+func isFresh(val entitlementCacheValue, ttl time.Duration, now time.Time) bool {
+	if tsVal, ok := val.(*timestampedCacheValue); ok {
+		if !tsVal.expiresAt.IsZero() && !now.Before(tsVal.expiresAt) {
+			return false
+		}
+		ttl += tsVal.ttlJitter
+	}
+	return now.Sub(val.GetTimestamp()) < ttl
+}
+
 func (ec *entitlementCache) bust(
 	key *ChainAuthArgs,
 ) {
-	if ok := ec.positiveCache.Contains(*key); ok {
-		ec.positiveCache.Remove(*key)
+	ec.remove(*ec.withGeneration(key))
+}
+
+// remove removes the entry stored under key, which must include the generation it was stored with. The removal
+// is recorded in the WAL, if any, so the entry is not restored after a restart.
+func (ec *entitlementCache) remove(key ChainAuthArgs) {
+	removed := false
+	if val, ok := ec.positiveCache.Peek(key); ok {
+		ec.notifyEvict(key, val)
+		ec.positiveCache.Remove(key)
+		removed = true
 	}
 
 	// Check negative cache
-	if ok := ec.negativeCache.Contains(*key); ok {
-		ec.negativeCache.Remove(*key)
+	if val, ok := ec.negativeCache.Peek(key); ok {
+		ec.notifyEvict(key, val)
+		ec.negativeCache.Remove(key)
+		removed = true
+	}
+
+	if removed && ec.wal != nil {
+		ec.wal.removeKey(ec, key)
+	}
+
+	if ec.sizeLimiter != nil {
+		ec.sizeLimiter.untrack(key)
+	}
+
+	// Misses after the removal don't wait for a computation that started before it.
+	ec.inflight.Forget(key.flightKey())
+}
+
+// flush removes all entries of the cache.
+func (ec *entitlementCache) flush() {
+	for _, cache := range []*lru.ARCCache[ChainAuthArgs, entitlementCacheValue]{ec.positiveCache, ec.negativeCache} {
+		for _, key := range cache.Keys() {
+			ec.remove(key)
+		}
+	}
+}
+
+// notifyEvict calls the eviction callback, if any, for the entry stored under key.
+func (ec *entitlementCache) notifyEvict(key ChainAuthArgs, val entitlementCacheValue) {
+	if ec.onEvict == nil {
+		return
+	}
+	var result CacheResult = val
+	if tsVal, ok := val.(*timestampedCacheValue); ok {
+		result = tsVal.Result()
 	}
+	ec.onEvict(&key, result)
 }
 
 func (ec *entitlementCache) executeUsingCache(
@@ -297,38 +583,146 @@ func (ec *entitlementCache) executeUsingCache(
 	key *ChainAuthArgs,
 	onMiss func(context.Context, *config.Config, *ChainAuthArgs) (CacheResult, error),
 ) (CacheResult, bool, error) {
+	// The generation of the space is captured before the lookup, if the space is invalidated while the
+	// result is computed, it is stored under a key that is no longer read.
+	key = ec.withGeneration(key)
+
+	// The caller wants a fresh result without reading or changing the cache.
+	if isCacheBypassed(ctx) {
+		if err := ec.readOnly.check(ec.name); err != nil {
+			return nil, false, err
+		}
+		result, err := onMiss(ctx, cfg, key)
+		if err != nil {
+			return nil, false, err
+		}
+		return &timestampedCacheValue{result: result, timestamp: ec.now()}, false, nil
+	}
+
+	// A forced refresh replaces the cached result of the key with a fresh one.
+	if isForceRefresh(ctx) {
+		ec.remove(*key)
+		cacheVal, err := ec.executeAndStore(ctx, cfg, key, onMiss)
+		if err != nil {
+			return nil, false, err
+		}
+		return cacheVal, false, nil
+	}
+
 	// Check positive cache first
 	if val, ok := ec.positiveCache.Get(*key); ok {
 		// Positive cache is only valid for a longer time
-		if time.Since(val.GetTimestamp()) < ec.positiveCacheTTL {
+		if isFresh(val, ec.positiveCacheTTL, ec.now()) {
+			recordCacheHit(ctx, val)
+			ec.servedAge.observe(ec.name, val, ec.now())
 			return val, true, nil
 		} else {
 			// Positive cache key is stale, remove it
+			ec.notifyEvict(*key, val)
 			ec.positiveCache.Remove(*key)
+			if ec.sizeLimiter != nil {
+				ec.sizeLimiter.untrack(*key)
+			}
 		}
 	}
 
 	// Check negative cache
 	if val, ok := ec.negativeCache.Get(*key); ok {
 		// Negative cache is only valid for 2 seconds, basically one block
-		if time.Since(val.GetTimestamp()) < ec.negativeCacheTTL {
+		if isFresh(val, ec.negativeCacheTTL, ec.now()) {
+			recordCacheHit(ctx, val)
+			ec.servedAge.observe(ec.name, val, ec.now())
 			return val, true, nil
 		} else {
 			// Negative cache key is stale, remove it
+			ec.notifyEvict(*key, val)
 			ec.negativeCache.Remove(*key)
+			if ec.sizeLimiter != nil {
+				ec.sizeLimiter.untrack(*key)
+			}
 		}
 	}
 
-	// Cache miss, execute the closure
-	result, err := onMiss(ctx, cfg, key)
+	// Cache miss. Identical concurrent misses wait for a single execution of the closure.
+	leader := false
+	val, err, _ := ec.inflight.Do(key.flightKey(), func() (any, error) {
+		leader = true
+		return ec.executeAndStore(ctx, cfg, key, onMiss)
+	})
+	if !leader {
+		if ec.coalesced != nil {
+			ec.coalesced.Inc()
+		}
+		// The caller that executed the closure may have given up on it, that doesn't fail the other callers.
+		if err != nil && ctx.Err() == nil &&
+			(errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)) {
+			val, err = ec.executeAndStore(ctx, cfg, key, onMiss)
+		}
+	}
 	if err != nil {
 		return nil, false, err
 	}
+	return val.(*timestampedCacheValue), false, nil
+}
+
+// lookup returns the fresh cached result of the key, without computing it on a miss. Lookups that bypass or
+// refresh the cache always miss.
+func (ec *entitlementCache) lookup(ctx context.Context, key *ChainAuthArgs) (CacheResult, bool) {
+	if isCacheBypassed(ctx) || isForceRefresh(ctx) {
+		return nil, false
+	}
+	key = ec.withGeneration(key)
+	if val, ok := ec.positiveCache.Get(*key); ok && isFresh(val, ec.positiveCacheTTL, ec.now()) {
+		recordCacheHit(ctx, val)
+		ec.servedAge.observe(ec.name, val, ec.now())
+		return val, true
+	}
+	if val, ok := ec.negativeCache.Get(*key); ok && isFresh(val, ec.negativeCacheTTL, ec.now()) {
+		recordCacheHit(ctx, val)
+		ec.servedAge.observe(ec.name, val, ec.now())
+		return val, true
+	}
+	return nil, false
+}
+
+// executeAndStore executes the closure and stores its result in the cache.
+func (ec *entitlementCache) executeAndStore(
+	ctx context.Context,
+	cfg *config.Config,
+	key *ChainAuthArgs,
+	onMiss func(context.Context, *config.Config, *ChainAuthArgs) (CacheResult, error),
+) (*timestampedCacheValue, error) {
+	// While read-only, misses fail fast and nothing is stored, cached results are still served.
+	if err := ec.readOnly.check(ec.name); err != nil {
+		return nil, err
+	}
+
+	result, err := onMiss(ctx, cfg, key)
+	if err != nil {
+		return nil, err
+	}
+	if !isCacheable(result) {
+		return &timestampedCacheValue{result: result, timestamp: ec.now()}, nil
+	}
 
 	// Store the result in the appropriate cache
 	cacheVal := &timestampedCacheValue{
 		result:    result,
-		timestamp: time.Now(),
+		timestamp: ec.now(),
+	}
+	if expiring, ok := result.(expiringCacheResult); ok {
+		cacheVal.expiresAt = expiring.expiresAt()
+	}
+
+	if result.IsAllowed() {
+		cacheVal.ttlJitter = ec.jitter(ec.positiveCacheTTL)
+	} else {
+		cacheVal.ttlJitter = ec.jitter(ec.negativeCacheTTL)
+	}
+
+	// The entry is queued for the WAL before it is cached, so that its removal is always recorded after it.
+	if ec.wal != nil {
+		ec.wal.append(ec, *key, cacheVal)
 	}
 
 	if result.IsAllowed() {
@@ -337,5 +731,189 @@ func (ec *entitlementCache) executeUsingCache(
 		ec.negativeCache.Add(*key, cacheVal)
 	}
 
-	return cacheVal, false, nil
+	if ec.sizeLimiter != nil {
+		ec.sizeLimiter.track(ctx, ec, *key, cacheVal)
+	}
+
+	ec.maybeSweepStaleGenerations(ctx)
+
+	return cacheVal, nil
+}
+
+// DEFAULT_CACHE_CONCERNING_AGE is the default age past which served cache values are counted as concerning.
+const DEFAULT_CACHE_CONCERNING_AGE = 10 * time.Minute
+
+// cacheServedAgeMetrics reports how stale the decisions served from the caches are, to tune their TTLs.
+type cacheServedAgeMetrics struct {
+	concerningAge time.Duration
+
+	// ages is the age of the served values by cache and result polarity.
+	ages *prometheus.HistogramVec
+	// concerning counts the values served past concerningAge by cache and result polarity.
+	concerning *prometheus.CounterVec
+}
+
+func newCacheServedAgeMetrics(cfg *config.ChainConfig, metrics infra.MetricsFactory) *cacheServedAgeMetrics {
+	concerningAge := DEFAULT_CACHE_CONCERNING_AGE
+	if cfg.EntitlementCacheConcerningAge > 0 {
+		concerningAge = cfg.EntitlementCacheConcerningAge
+	}
+	return &cacheServedAgeMetrics{
+		concerningAge: concerningAge,
+		ages: metrics.NewHistogramVecEx(
+			"entitlement_cache_served_age_seconds",
+			"Age of the values served from entitlement caches in seconds by cache and result",
+			[]float64{0.5, 1, 2, 5, 15, 30, 60, 120, 300, 600, 900, 1800, 3600},
+			"cache",
+			"result",
+		),
+		concerning: metrics.NewCounterVecEx(
+			"entitlement_cache_served_concerning_age",
+			"Values served from entitlement caches past the concerning age by cache and result",
+			"cache",
+			"result",
+		),
+	}
+}
+
+// observe records the age of val at now, served from the cache named cache.
+func (m *cacheServedAgeMetrics) observe(cache string, val entitlementCacheValue, now time.Time) {
+	if m == nil {
+		return
+	}
+	result := "denied"
+	if val.IsAllowed() {
+		result = "allowed"
+	}
+	age := now.Sub(val.GetTimestamp())
+	m.ages.WithLabelValues(cache, result).Observe(age.Seconds())
+	if age > m.concerningAge {
+		m.concerning.WithLabelValues(cache, result).Inc()
+	}
+}
+
+type forceRefreshCtxKey struct{}
+
+// withForceRefresh returns a context in which cache lookups are bypassed, see ChainAuthArgs.WithForceRefresh.
+func withForceRefresh(ctx context.Context) context.Context {
+	return context.WithValue(ctx, forceRefreshCtxKey{}, true)
+}
+
+// ContextWithForceRefresh returns a context in which the results of the ChainAuth calls without ChainAuthArgs,
+// such as IsSpaceEnabled, are read from the chain and written back to the caches. Like
+// ChainAuthArgs.WithForceRefresh it must never be derived from client input.
+func ContextWithForceRefresh(ctx context.Context) context.Context {
+	return withForceRefresh(ctx)
+}
+
+func isForceRefresh(ctx context.Context) bool {
+	forced, _ := ctx.Value(forceRefreshCtxKey{}).(bool)
+	return forced
+}
+
+type cacheProvenanceCtxKey struct{}
+
+// cacheProvenance tracks the oldest cached value read while a result is computed, whether the linked
+// wallets it was computed with were read from the base chain only, and when the membership it found expires.
+type cacheProvenance struct {
+	mu     sync.Mutex
+	oldest time.Time
+	// baseChainOnlyUntil is the earliest linkedWalletCacheValue.baseChainOnlyUntil of the wallets read.
+	baseChainOnlyUntil time.Time
+	// membershipExpiry is the earliest expiry of the memberships recorded, see recordMembershipExpiry.
+	membershipExpiry time.Time
+}
+
+// withCacheProvenance returns a context in which cache hits are recorded in the returned cacheProvenance.
+// Hits are only recorded in the innermost cacheProvenance of the context.
+func withCacheProvenance(ctx context.Context) (context.Context, *cacheProvenance) {
+	provenance := &cacheProvenance{}
+	return context.WithValue(ctx, cacheProvenanceCtxKey{}, provenance), provenance
+}
+
+func recordCacheHit(ctx context.Context, val entitlementCacheValue) {
+	provenance, ok := ctx.Value(cacheProvenanceCtxKey{}).(*cacheProvenance)
+	if !ok {
+		return
+	}
+	cachedAt := val.GetTimestamp()
+	if tsVal, ok := val.(*timestampedCacheValue); ok {
+		cachedAt = tsVal.cachedAt()
+	}
+
+	provenance.mu.Lock()
+	defer provenance.mu.Unlock()
+	if provenance.oldest.IsZero() || cachedAt.Before(provenance.oldest) {
+		provenance.oldest = cachedAt
+	}
+}
+
+// cachedAt returns the timestamp of the oldest cached value read, zero if there were no cache hits.
+func (p *cacheProvenance) cachedAt() time.Time {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.oldest
+}
+
+// recordBaseChainOnlyWallets records in the provenance of ctx that the linked wallets of the result were read
+// from the base chain only, until is their linkedWalletCacheValue.baseChainOnlyUntil. Zero times are ignored.
+func recordBaseChainOnlyWallets(ctx context.Context, until time.Time) {
+	provenance, ok := ctx.Value(cacheProvenanceCtxKey{}).(*cacheProvenance)
+	if !ok || until.IsZero() {
+		return
+	}
+
+	provenance.mu.Lock()
+	defer provenance.mu.Unlock()
+	if provenance.baseChainOnlyUntil.IsZero() || until.Before(provenance.baseChainOnlyUntil) {
+		provenance.baseChainOnlyUntil = until
+	}
+}
+
+// baseChainOnlyWalletsUntil returns the time until which the result may be served if its linked wallets were
+// read from the base chain only, zero otherwise.
+func (p *cacheProvenance) baseChainOnlyWalletsUntil() time.Time {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.baseChainOnlyUntil
+}
+
+// recordMembershipExpiry records in the provenance of ctx that the result was computed with a membership that
+// expires at expiry. Zero times, of memberships that don't expire, are ignored.
+func recordMembershipExpiry(ctx context.Context, expiry time.Time) {
+	provenance, ok := ctx.Value(cacheProvenanceCtxKey{}).(*cacheProvenance)
+	if !ok || expiry.IsZero() {
+		return
+	}
+
+	provenance.mu.Lock()
+	defer provenance.mu.Unlock()
+	if provenance.membershipExpiry.IsZero() || expiry.Before(provenance.membershipExpiry) {
+		provenance.membershipExpiry = expiry
+	}
+}
+
+// membershipValidUntil returns the time the membership the result was computed with expires, zero if it
+// doesn't or no membership was recorded.
+func (p *cacheProvenance) membershipValidUntil() time.Time {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.membershipExpiry
+}
+
+type bypassCacheCtxKey struct{}
+
+// withoutCache returns a context in which cache lookups are evaluated without reading or storing results.
+func withoutCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, bypassCacheCtxKey{}, true)
+}
+
+func isCacheBypassed(ctx context.Context) bool {
+	bypassed, _ := ctx.Value(bypassCacheCtxKey{}).(bool)
+	return bypassed
+}
+
+// flightKey identifies the computations of key that can be coalesced.
+func (key *ChainAuthArgs) flightKey() string {
+	return fmt.Sprintf("%s/%t", key, key.hasPreFetchedWallets)
 }
@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/towns-protocol/towns/core/node/shared"
+)
+
+// staleGenerationSweepInterval is the minimum time between sweeps of a cache for entries of old generations.
+const staleGenerationSweepInterval = time.Minute
+
+// spaceGenerations holds a generation counter per space. Cache keys include the generation of their space
+// captured when the cache is read, so incrementing it makes all entries cached for the space unreachable at
+// once, including entries written back by computations that started before the increment.
+type spaceGenerations struct {
+	mu          sync.RWMutex
+	generations map[shared.StreamId]uint64
+
+	// bumps counts the increments, caches use it to tell whether they hold unreachable entries.
+	bumps atomic.Uint64
+}
+
+func newSpaceGenerations() *spaceGenerations {
+	return &spaceGenerations{generations: make(map[shared.StreamId]uint64)}
+}
+
+func (g *spaceGenerations) get(spaceId shared.StreamId) uint64 {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	return g.generations[spaceId]
+}
+
+func (g *spaceGenerations) bump(spaceId shared.StreamId) {
+	g.mu.Lock()
+	g.generations[spaceId]++
+	g.mu.Unlock()
+	g.bumps.Add(1)
+}
+
+// isCurrent returns true if key was captured with the current generation of its space.
+func (g *spaceGenerations) isCurrent(key *ChainAuthArgs) bool {
+	return key.generation == g.get(key.spaceId)
+}
+
+// cacheGenerationSweeper removes entries of old generations from a cache. Such entries are never read again,
+// so they are collected lazily, at most once per staleGenerationSweepInterval, instead of on every increment.
+type cacheGenerationSweeper struct {
+	mu         sync.Mutex
+	sweptBumps uint64
+	lastSweep  time.Time
+}
+
+// withGeneration returns a copy of key with the current generation of its space, or key itself if the cache
+// does not track generations.
+func (ec *entitlementCache) withGeneration(key *ChainAuthArgs) *ChainAuthArgs {
+	if ec.generations == nil {
+		return key
+	}
+	ret := *key
+	ret.generation = ec.generations.get(key.spaceId)
+	return &ret
+}
+
+// maybeSweepStaleGenerations removes the entries of old generations if spaces were invalidated since the
+// last sweep and the sweep interval has passed.
+func (ec *entitlementCache) maybeSweepStaleGenerations(ctx context.Context) {
+	if ec.generations == nil {
+		return
+	}
+	bumps := ec.generations.bumps.Load()
+
+	if !ec.sweeper.mu.TryLock() {
+		return
+	}
+	defer ec.sweeper.mu.Unlock()
+
+	if bumps == ec.sweeper.sweptBumps || time.Since(ec.sweeper.lastSweep) < staleGenerationSweepInterval {
+		return
+	}
+	ec.sweeper.sweptBumps = bumps
+	ec.sweeper.lastSweep = time.Now()
+
+	for _, keys := range [][]ChainAuthArgs{ec.positiveCache.Keys(), ec.negativeCache.Keys()} {
+		for _, key := range keys {
+			if !ec.generations.isCurrent(&key) {
+				ec.remove(key)
+			}
+		}
+	}
+}
+
+// InvalidateCacheForSpace makes all results cached for the space unreachable. Computations that are in
+// flight when the space is invalidated don't make their results visible to subsequent checks, and the results
+// are not restored from the WAL after a restart.
+func (ca *chainAuth) InvalidateCacheForSpace(spaceId shared.StreamId) {
+	ca.generations.bump(spaceId)
+	if ca.cacheWal != nil {
+		ca.cacheWal.removeSpace(spaceId)
+	}
+}
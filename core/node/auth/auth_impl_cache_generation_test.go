@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+
+	"github.com/towns-protocol/towns/core/config"
+	"github.com/towns-protocol/towns/core/node/base/test"
+	"github.com/towns-protocol/towns/core/node/shared"
+	"github.com/towns-protocol/towns/core/node/testutils"
+)
+
+func TestSpaceGenerationDropsInFlightResults(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	ca := newTestChainAuth(t, ctx, newFakeSpaceContract(common.HexToAddress("0x0e")))
+	ec := ca.entitlementCache
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+	key := NewChainAuthArgsForSpace(spaceId, "0x3", PermissionRead)
+	ec.sweeper.lastSweep = time.Now()
+
+	// A slow computation is started before the space is invalidated and completes afterwards.
+	started := make(chan struct{})
+	release := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		result, cacheHit, err := ec.executeUsingCache(
+			ctx,
+			cfg,
+			key,
+			func(context.Context, *config.Config, *ChainAuthArgs) (CacheResult, error) {
+				close(started)
+				<-release
+				return &simpleCacheResult{allowed: true}, nil
+			},
+		)
+		require.NoError(t, err)
+		require.False(t, cacheHit)
+		require.True(t, result.IsAllowed())
+	}()
+
+	<-started
+	ca.InvalidateCacheForSpace(spaceId)
+	close(release)
+	<-done
+
+	// The stale result was written back, but subsequent callers don't see it.
+	require.Equal(t, 1, ec.positiveCache.Len())
+	result, cacheHit, err := ec.executeUsingCache(
+		ctx,
+		cfg,
+		key,
+		func(context.Context, *config.Config, *ChainAuthArgs) (CacheResult, error) {
+			return &simpleCacheResult{allowed: false}, nil
+		},
+	)
+	require.NoError(t, err)
+	require.False(t, cacheHit)
+	require.False(t, result.IsAllowed())
+
+	// Results cached for the current generation are served from the cache.
+	result, cacheHit, err = ec.executeUsingCache(
+		ctx,
+		cfg,
+		key,
+		func(context.Context, *config.Config, *ChainAuthArgs) (CacheResult, error) {
+			return &simpleCacheResult{allowed: true}, nil
+		},
+	)
+	require.NoError(t, err)
+	require.True(t, cacheHit)
+	require.False(t, result.IsAllowed())
+
+	// Other spaces are not affected.
+	otherKey := NewChainAuthArgsForSpace(testutils.FakeStreamId(shared.STREAM_SPACE_BIN), "0x3", PermissionRead)
+	_, _, err = ec.executeUsingCache(
+		ctx,
+		cfg,
+		otherKey,
+		func(context.Context, *config.Config, *ChainAuthArgs) (CacheResult, error) {
+			return &simpleCacheResult{allowed: true}, nil
+		},
+	)
+	require.NoError(t, err)
+	require.True(t, ec.positiveCache.Contains(*otherKey))
+
+	// Entries of old generations are swept lazily on a later insert.
+	require.True(t, ec.positiveCache.Contains(*key))
+	ec.sweeper.lastSweep = time.Now().Add(-staleGenerationSweepInterval)
+	_, _, err = ec.executeUsingCache(
+		ctx,
+		cfg,
+		NewChainAuthArgsForSpace(spaceId, "0x4", PermissionRead),
+		func(context.Context, *config.Config, *ChainAuthArgs) (CacheResult, error) {
+			return &simpleCacheResult{allowed: true}, nil
+		},
+	)
+	require.NoError(t, err)
+	require.False(t, ec.positiveCache.Contains(*key))
+	require.True(t, ec.positiveCache.Contains(*otherKey))
+}
@@ -0,0 +1,235 @@
+package auth
+
+import (
+	"context"
+	"sync"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/towns-protocol/towns/core/node/crypto"
+	"github.com/towns-protocol/towns/core/node/infra"
+	"github.com/towns-protocol/towns/core/node/shared"
+)
+
+const DEFAULT_INVALIDATION_MAX_SCOPES_PER_BLOCK = 1000
+
+// invalidationScope selects the cache entries that are busted by an on-chain event. A zero channelId or
+// principal matches entries for all channels or principals in the space.
+type invalidationScope struct {
+	spaceId   shared.StreamId
+	channelId shared.StreamId
+	principal common.Address
+}
+
+func (s invalidationScope) isWholeSpace() bool {
+	return s.channelId == (shared.StreamId{}) && s.principal == (common.Address{})
+}
+
+func (s invalidationScope) matches(key *ChainAuthArgs) bool {
+	if s.channelId != (shared.StreamId{}) && s.channelId != key.channelId {
+		return false
+	}
+	if s.principal != (common.Address{}) && s.principal != key.principal {
+		return false
+	}
+	return true
+}
+
+type spaceInvalidation struct {
+	wholeSpace bool
+	scopes     map[invalidationScope]struct{}
+}
+
+// cacheInvalidator coalesces cache invalidations caused by on-chain events per block. Scopes collected for a
+// block are applied with a single pass over the caches once the block is complete, so bursts of events don't
+// thrash the caches. If a block affects more than maxScopesPerBlock scopes, the pending invalidations fall back
+// to busting whole spaces, which bounds the work done per cache entry.
+type cacheInvalidator struct {
+	caches            []*entitlementCache
+	maxScopesPerBlock int
+
+	mu         sync.Mutex
+	block      crypto.BlockNumber
+	pending    map[shared.StreamId]*spaceInvalidation
+	numScopes  int
+	overflowed bool
+
+	received  prometheus.Counter
+	coalesced prometheus.Counter
+	overflows prometheus.Counter
+	passes    prometheus.Counter
+	busted    prometheus.Counter
+}
+
+func newCacheInvalidator(
+	maxScopesPerBlock int,
+	metrics infra.MetricsFactory,
+	caches ...*entitlementCache,
+) *cacheInvalidator {
+	if maxScopesPerBlock <= 0 {
+		maxScopesPerBlock = DEFAULT_INVALIDATION_MAX_SCOPES_PER_BLOCK
+	}
+
+	counter := metrics.NewCounterVecEx(
+		"entitlement_cache_invalidations", "Coalesced invalidations of the entitlement caches", "result")
+
+	return &cacheInvalidator{
+		caches:            caches,
+		maxScopesPerBlock: maxScopesPerBlock,
+		pending:           make(map[shared.StreamId]*spaceInvalidation),
+		received:          counter.WithLabelValues("received"),
+		coalesced:         counter.WithLabelValues("coalesced"),
+		overflows:         counter.WithLabelValues("overflow"),
+		passes:            counter.WithLabelValues("pass"),
+		busted:            counter.WithLabelValues("busted"),
+	}
+}
+
+// invalidate schedules the entries matching scope for removal once blockNum is complete. Invalidations
+// pending for earlier blocks are applied first.
+func (inv *cacheInvalidator) invalidate(blockNum crypto.BlockNumber, scope invalidationScope) {
+	if ready := inv.enqueue(blockNum, scope); ready != nil {
+		inv.apply(ready)
+	}
+}
+
+// invalidateNow busts the entries matching the given scopes right away instead of waiting for the
+// block to complete, for invalidations that must be visible to the next check.
+func (inv *cacheInvalidator) invalidateNow(scopes ...invalidationScope) {
+	spaces := make(map[shared.StreamId]*spaceInvalidation)
+	for _, scope := range scopes {
+		space, ok := spaces[scope.spaceId]
+		if !ok {
+			space = &spaceInvalidation{scopes: make(map[invalidationScope]struct{})}
+			spaces[scope.spaceId] = space
+		}
+		if scope.isWholeSpace() {
+			space.wholeSpace = true
+		}
+		space.scopes[scope] = struct{}{}
+	}
+	if len(spaces) > 0 {
+		inv.apply(spaces)
+	}
+}
+
+// onBlock applies the pending invalidations if the block they were collected for is complete.
+func (inv *cacheInvalidator) onBlock(_ context.Context, blockNum crypto.BlockNumber) {
+	inv.mu.Lock()
+	var ready map[shared.StreamId]*spaceInvalidation
+	if inv.block <= blockNum {
+		ready = inv.takeLocked()
+	}
+	inv.mu.Unlock()
+
+	if ready != nil {
+		inv.apply(ready)
+	}
+}
+
+func (inv *cacheInvalidator) enqueue(
+	blockNum crypto.BlockNumber,
+	scope invalidationScope,
+) map[shared.StreamId]*spaceInvalidation {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	inv.received.Inc()
+
+	var ready map[shared.StreamId]*spaceInvalidation
+	if blockNum > inv.block {
+		ready = inv.takeLocked()
+		inv.block = blockNum
+	}
+
+	space, ok := inv.pending[scope.spaceId]
+	if !ok {
+		space = &spaceInvalidation{}
+		inv.pending[scope.spaceId] = space
+		if inv.overflowed {
+			space.wholeSpace = true
+			inv.numScopes++
+			return ready
+		}
+	}
+
+	if space.wholeSpace {
+		inv.coalesced.Inc()
+		return ready
+	}
+
+	if scope.isWholeSpace() {
+		inv.numScopes += 1 - len(space.scopes)
+		space.wholeSpace = true
+		space.scopes = nil
+		return ready
+	}
+
+	if _, ok := space.scopes[scope]; ok {
+		inv.coalesced.Inc()
+		return ready
+	}
+	if space.scopes == nil {
+		space.scopes = make(map[invalidationScope]struct{})
+	}
+	space.scopes[scope] = struct{}{}
+	inv.numScopes++
+
+	if inv.numScopes > inv.maxScopesPerBlock {
+		inv.overflows.Inc()
+		inv.overflowed = true
+		for _, space := range inv.pending {
+			space.wholeSpace = true
+			space.scopes = nil
+		}
+		inv.numScopes = len(inv.pending)
+	}
+	return ready
+}
+
+// takeLocked detaches the pending invalidations, returns nil if there are none.
+func (inv *cacheInvalidator) takeLocked() map[shared.StreamId]*spaceInvalidation {
+	if len(inv.pending) == 0 {
+		return nil
+	}
+	ready := inv.pending
+	inv.pending = make(map[shared.StreamId]*spaceInvalidation)
+	inv.numScopes = 0
+	inv.overflowed = false
+	return ready
+}
+
+// apply busts the entries matching the given invalidations with a single pass over each cache.
+func (inv *cacheInvalidator) apply(spaces map[shared.StreamId]*spaceInvalidation) {
+	matches := func(key *ChainAuthArgs) bool {
+		space, ok := spaces[key.spaceId]
+		if !ok {
+			return false
+		}
+		if space.wholeSpace {
+			return true
+		}
+		for scope := range space.scopes {
+			if scope.matches(key) {
+				return true
+			}
+		}
+		return false
+	}
+
+	busted := 0
+	for _, ec := range inv.caches {
+		for _, keys := range [][]ChainAuthArgs{ec.positiveCache.Keys(), ec.negativeCache.Keys()} {
+			for _, key := range keys {
+				if matches(&key) {
+					ec.remove(key)
+					busted++
+				}
+			}
+		}
+	}
+
+	inv.passes.Inc()
+	inv.busted.Add(float64(busted))
+}
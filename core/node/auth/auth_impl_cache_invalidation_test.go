@@ -0,0 +1,102 @@
+package auth
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/towns-protocol/towns/core/config"
+	"github.com/towns-protocol/towns/core/node/base/test"
+	"github.com/towns-protocol/towns/core/node/infra"
+	"github.com/towns-protocol/towns/core/node/shared"
+	"github.com/towns-protocol/towns/core/node/testutils"
+)
+
+func TestCacheInvalidatorCoalescesBursts(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	ec, err := newEntitlementCache(ctx, &config.ChainConfig{PositiveEntitlementCacheSize: 100000}, nil)
+	require.NoError(t, err)
+	inv := newCacheInvalidator(1000, infra.NewMetricsFactory(prometheus.NewRegistry(), "", ""), ec)
+
+	const numSpaces = 100
+	const numPrincipals = 20
+	spaces := make([]shared.StreamId, numSpaces)
+	principals := make([]common.Address, numPrincipals)
+	for i := range principals {
+		principals[i] = common.BytesToAddress([]byte{0x10, byte(i)})
+	}
+	for i := range spaces {
+		spaces[i] = testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+		for _, principal := range principals {
+			args := NewChainAuthArgsForSpace(spaces[i], principal.Hex(), PermissionRead)
+			ec.positiveCache.Add(*args, &timestampedCacheValue{result: boolCacheResult{isAllowed: true}})
+		}
+	}
+
+	// A burst of 10k events for the first 40 spaces in a single block exceeds the per block cap, so the
+	// invalidations fall back to whole space busts.
+	var maxHold time.Duration
+	for i := range 10000 {
+		scope := invalidationScope{
+			spaceId:   spaces[i%40],
+			channelId: testutils.FakeStreamId(shared.STREAM_CHANNEL_BIN),
+		}
+		start := time.Now()
+		ready := inv.enqueue(1, scope)
+		maxHold = max(maxHold, time.Since(start))
+		require.Nil(t, ready)
+	}
+	require.Less(t, maxHold, 20*time.Millisecond)
+	require.Equal(t, 1.0, testutil.ToFloat64(inv.overflows))
+	require.Equal(t, 8999.0, testutil.ToFloat64(inv.coalesced))
+	require.Equal(t, 40, inv.numScopes)
+
+	// Nothing is busted until the block is complete, and then in a single pass.
+	require.Equal(t, numSpaces*numPrincipals, ec.positiveCache.Len())
+	inv.onBlock(ctx, 1)
+	require.Equal(t, 1.0, testutil.ToFloat64(inv.passes))
+	require.Equal(t, float64(40*numPrincipals), testutil.ToFloat64(inv.busted))
+	for i, spaceId := range spaces {
+		args := NewChainAuthArgsForSpace(spaceId, principals[0].Hex(), PermissionRead)
+		require.Equal(t, i >= 40, ec.positiveCache.Contains(*args))
+	}
+
+	// Principal scoped invalidations within the cap only bust the matching entries. Duplicates are coalesced.
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, principal := range principals[:5] {
+				inv.invalidate(2, invalidationScope{spaceId: spaces[50], principal: principal})
+			}
+		}()
+	}
+	wg.Wait()
+	require.Equal(t, 8999.0+45, testutil.ToFloat64(inv.coalesced))
+
+	// Events for the next block apply the pending invalidations.
+	inv.invalidate(3, invalidationScope{spaceId: spaces[99]})
+	require.Equal(t, 2.0, testutil.ToFloat64(inv.passes))
+	for i, principal := range principals {
+		args := NewChainAuthArgsForSpace(spaces[50], principal.Hex(), PermissionRead)
+		require.Equal(t, i >= 5, ec.positiveCache.Contains(*args))
+	}
+	require.True(t, ec.positiveCache.Contains(*NewChainAuthArgsForSpace(spaces[99], principals[0].Hex(), PermissionRead)))
+
+	inv.onBlock(ctx, 3)
+	require.Equal(t, 3.0, testutil.ToFloat64(inv.passes))
+	require.False(t, ec.positiveCache.Contains(*NewChainAuthArgsForSpace(spaces[99], principals[0].Hex(), PermissionRead)))
+	require.Equal(t, float64(40*numPrincipals+5+numPrincipals), testutil.ToFloat64(inv.busted))
+
+	// Blocks without invalidations don't touch the caches.
+	inv.onBlock(ctx, 4)
+	require.Equal(t, 3.0, testutil.ToFloat64(inv.passes))
+}
@@ -0,0 +1,265 @@
+package auth
+
+import (
+	"context"
+	"math/big"
+	"slices"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/towns-protocol/towns/core/contracts/base"
+	"github.com/towns-protocol/towns/core/contracts/types"
+	"github.com/towns-protocol/towns/core/node/logging"
+)
+
+const (
+	DEFAULT_ENTITLEMENT_MANAGER_CACHE_MAX_BYTES      = 256 * 1024 * 1024
+	DEFAULT_ENTITLEMENT_PAYLOAD_WARN_THRESHOLD_BYTES = 1024 * 1024
+
+	// arcEntryOverhead approximates the memory held by the ARC bookkeeping of an entry: its list element and
+	// the slot of its key.
+	arcEntryOverhead = 128
+	// entitlementCacheEntryOverhead approximates the memory held by a cache entry besides its payload and the
+	// strings of its key: the key, the timestamped value wrapper and the ARC bookkeeping.
+	entitlementCacheEntryOverhead = int(unsafe.Sizeof(ChainAuthArgs{})+unsafe.Sizeof(timestampedCacheValue{})) +
+		arcEntryOverhead
+	// mapHeaderSize approximates the memory held by an empty map.
+	mapHeaderSize = 48
+	// cacheSizeLowWaterPercent is the percentage of the byte cap the entries are evicted down to once it is
+	// exceeded, so that the entries are sorted once per eviction of several entries, not on every store.
+	cacheSizeLowWaterPercent = 90
+)
+
+type cacheEntrySize struct {
+	size      int
+	timestamp time.Time
+}
+
+// cacheSizeLimiter tracks the approximate memory held by the entries of an entitlementCache and evicts
+// the largest, then oldest, entries once the total exceeds maxBytes, down to cacheSizeLowWaterPercent of it.
+// Caches without a cap only account for their memory.
+type cacheSizeLimiter struct {
+	sizeOf        func(CacheResult) int
+	maxBytes      int64
+	warnThreshold int
+	gauge         prometheus.Gauge
+	// accounted reports the total along with the other caches, nil if not reported, see cacheMemory.
+	accounted prometheus.Gauge
+
+	mu      sync.Mutex
+	entries map[ChainAuthArgs]cacheEntrySize
+	total   int64
+}
+
+func newCacheSizeLimiter(
+	sizeOf func(CacheResult) int,
+	maxBytes int64,
+	warnThreshold int,
+	gauge prometheus.Gauge,
+) *cacheSizeLimiter {
+	return &cacheSizeLimiter{
+		sizeOf:        sizeOf,
+		maxBytes:      maxBytes,
+		warnThreshold: warnThreshold,
+		gauge:         gauge,
+		entries:       make(map[ChainAuthArgs]cacheEntrySize),
+	}
+}
+
+// track records the size of an entry that was just stored in ec and enforces the byte cap.
+func (l *cacheSizeLimiter) track(ctx context.Context, ec *entitlementCache, key ChainAuthArgs, val entitlementCacheValue) {
+	payload := 0
+	if tsVal, ok := val.(*timestampedCacheValue); ok {
+		payload = l.sizeOf(tsVal.result)
+	}
+	size := entitlementCacheEntryOverhead + cacheKeySize(&key) + payload
+
+	if l.warnThreshold > 0 && payload > l.warnThreshold {
+		logging.FromCtx(ctx).Warnw(
+			"Large entitlement payload cached, space may be misconfigured",
+			"spaceId", key.spaceId,
+			"channelId", key.channelId,
+			"permission", key.permission,
+			"bytes", payload,
+		)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if prev, ok := l.entries[key]; ok {
+		l.total -= int64(prev.size)
+	}
+	l.entries[key] = cacheEntrySize{size: size, timestamp: val.GetTimestamp()}
+	l.total += int64(size)
+
+	// The ARC caches evict entries on their own once they reach capacity, drop those from the accounting. The
+	// entries are scanned once the evicted entries add up to a fraction of the cache, not on every eviction.
+	if cached := ec.positiveCache.Len() + ec.negativeCache.Len(); len(l.entries) > cached+cached/16 {
+		for k, entry := range l.entries {
+			if !ec.positiveCache.Contains(k) && !ec.negativeCache.Contains(k) {
+				delete(l.entries, k)
+				l.total -= int64(entry.size)
+			}
+		}
+	}
+
+	if l.maxBytes > 0 && l.total > l.maxBytes {
+		l.evict(ec)
+	}
+
+	l.report()
+}
+
+// report sets the gauges to the total. Must be called with l.mu held.
+func (l *cacheSizeLimiter) report() {
+	if l.gauge != nil {
+		l.gauge.Set(float64(l.total))
+	}
+	if l.accounted != nil {
+		l.accounted.Set(float64(l.total))
+	}
+}
+
+// untrack removes an entry that was removed from ec from the accounting.
+func (l *cacheSizeLimiter) untrack(key ChainAuthArgs) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if entry, ok := l.entries[key]; ok {
+		delete(l.entries, key)
+		l.total -= int64(entry.size)
+		l.report()
+	}
+}
+
+// evict removes the largest entries, oldest first among entries of equal size, until the total is within
+// the low-water mark of the cap. Must be called with l.mu held.
+func (l *cacheSizeLimiter) evict(ec *entitlementCache) {
+	lowWater := l.maxBytes * cacheSizeLowWaterPercent / 100
+	keys := make([]ChainAuthArgs, 0, len(l.entries))
+	for k := range l.entries {
+		keys = append(keys, k)
+	}
+	slices.SortFunc(keys, func(a, b ChainAuthArgs) int {
+		ea, eb := l.entries[a], l.entries[b]
+		if ea.size != eb.size {
+			return eb.size - ea.size
+		}
+		return ea.timestamp.Compare(eb.timestamp)
+	})
+
+	for _, k := range keys {
+		if l.total <= lowWater {
+			break
+		}
+		if val, ok := ec.positiveCache.Peek(k); ok {
+			ec.notifyEvict(k, val)
+			ec.positiveCache.Remove(k)
+		}
+		if val, ok := ec.negativeCache.Peek(k); ok {
+			ec.notifyEvict(k, val)
+			ec.negativeCache.Remove(k)
+		}
+		l.total -= int64(l.entries[k].size)
+		delete(l.entries, k)
+	}
+}
+
+// cacheKeySize approximates the memory held by the strings of key, the rest of the key is part of
+// entitlementCacheEntryOverhead.
+func cacheKeySize(key *ChainAuthArgs) int {
+	return len(key.linkedWallets) + len(key.customPermission) + len(key.preFetchedWallets) + len(key.permissions)
+}
+
+// cacheResultSize approximates the memory held by a cached result of any of the caches of chainAuth.
+func cacheResultSize(result CacheResult) int {
+	switch result := result.(type) {
+	case boolCacheResult:
+		return int(unsafe.Sizeof(result))
+	case *walletSetCacheResult:
+		return int(unsafe.Sizeof(*result)) + cacheResultSize(result.CacheResult)
+	case *ruleDenialCacheResult:
+		size := int(unsafe.Sizeof(*result))
+		if rd := result.ruleDenial; rd != nil {
+			size += int(unsafe.Sizeof(*rd)) +
+				bigIntSize(rd.ChainId) + bigIntSize(rd.Threshold) + bigIntSize(rd.TokenId) + bigIntSize(rd.Balance)
+		}
+		return size
+	case *membershipStatusCacheResult:
+		size := int(unsafe.Sizeof(*result))
+		if status := result.status; status != nil {
+			size += int(unsafe.Sizeof(*status)) + cap(status.TokenIds)*int(unsafe.Sizeof((*big.Int)(nil))) +
+				bigIntSize(status.ExpiryTime) + bigIntSize(status.ExpiredAt)
+			for _, tokenId := range status.TokenIds {
+				size += bigIntSize(tokenId)
+			}
+		}
+		return size
+	case *linkedWalletCacheValue:
+		return int(unsafe.Sizeof(*result)) + cap(result.wallets)*common.AddressLength
+	case *bannedWalletsCacheResult:
+		return int(unsafe.Sizeof(*result)) + mapSize(len(result.wallets), common.AddressLength)
+	case *entitlementCacheResult:
+		return entitlementCacheResultSize(result)
+	default:
+		return 0
+	}
+}
+
+// mapSize approximates the memory held by a map of entries whose key and value take slotSize bytes, the
+// slots of the map are kept at most 7/8 full.
+func mapSize(entries int, slotSize int) int {
+	if entries == 0 {
+		return mapHeaderSize
+	}
+	return mapHeaderSize + (entries*8/7+1)*(slotSize+1)
+}
+
+// entitlementCacheResultSize approximates the memory held by the entitlement data of an entitlement manager
+// cache entry, which is dominated by the rule data of rule entitlements.
+func entitlementCacheResultSize(result CacheResult) int {
+	ecr, ok := result.(*entitlementCacheResult)
+	if !ok {
+		return 0
+	}
+
+	size := int(unsafe.Sizeof(*ecr)) + cap(ecr.entitlementData)*int(unsafe.Sizeof(types.Entitlement{}))
+	for _, ent := range ecr.entitlementData {
+		size += len(ent.EntitlementType) + cap(ent.UserEntitlement)*common.AddressLength
+		if re := ent.RuleEntitlement; re != nil {
+			size += int(unsafe.Sizeof(*re)) + ruleDataSize(re.Operations, re.LogicalOperations) +
+				cap(re.CheckOperations)*int(unsafe.Sizeof(base.IRuleEntitlementBaseCheckOperation{}))
+			for _, op := range re.CheckOperations {
+				size += bigIntSize(op.ChainId) + bigIntSize(op.Threshold)
+			}
+		}
+		if re := ent.RuleEntitlementV2; re != nil {
+			size += int(unsafe.Sizeof(*re)) + ruleDataSize(re.Operations, re.LogicalOperations) +
+				cap(re.CheckOperations)*int(unsafe.Sizeof(base.IRuleEntitlementBaseCheckOperationV2{}))
+			for _, op := range re.CheckOperations {
+				size += bigIntSize(op.ChainId) + cap(op.Params)
+			}
+		}
+	}
+	return size
+}
+
+func ruleDataSize(
+	operations []base.IRuleEntitlementBaseOperation,
+	logicalOperations []base.IRuleEntitlementBaseLogicalOperation,
+) int {
+	return cap(operations)*int(unsafe.Sizeof(base.IRuleEntitlementBaseOperation{})) +
+		cap(logicalOperations)*int(unsafe.Sizeof(base.IRuleEntitlementBaseLogicalOperation{}))
+}
+
+func bigIntSize(i *big.Int) int {
+	if i == nil {
+		return 0
+	}
+	return int(unsafe.Sizeof(*i)) + cap(i.Bits())*int(unsafe.Sizeof(big.Word(0)))
+}
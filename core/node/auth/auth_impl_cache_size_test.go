@@ -0,0 +1,140 @@
+package auth
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/towns-protocol/towns/core/config"
+	"github.com/towns-protocol/towns/core/contracts/base"
+	"github.com/towns-protocol/towns/core/contracts/types"
+	"github.com/towns-protocol/towns/core/node/base/test"
+	"github.com/towns-protocol/towns/core/node/infra"
+	"github.com/towns-protocol/towns/core/node/shared"
+	"github.com/towns-protocol/towns/core/node/testutils"
+)
+
+// syntheticRuleEntitlements returns rule entitlements with the given number of check operations,
+// each carrying paramsLen bytes of params.
+func syntheticRuleEntitlements(checkOperations int, paramsLen int) []types.Entitlement {
+	ruleData := &base.IRuleEntitlementBaseRuleDataV2{}
+	for i := 0; i < checkOperations; i++ {
+		ruleData.Operations = append(ruleData.Operations, base.IRuleEntitlementBaseOperation{Index: uint8(i)})
+		ruleData.CheckOperations = append(ruleData.CheckOperations, base.IRuleEntitlementBaseCheckOperationV2{
+			ChainId:         big.NewInt(1),
+			ContractAddress: common.BigToAddress(big.NewInt(int64(i))),
+			Params:          make([]byte, paramsLen),
+		})
+	}
+	return []types.Entitlement{
+		{
+			EntitlementType:   types.ModuleTypeRuleEntitlementV2,
+			RuleEntitlementV2: ruleData,
+		},
+	}
+}
+
+func TestEntitlementManagerCacheSizeCap(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	ec, err := newEntitlementManagerCache(
+		ctx,
+		&config.ChainConfig{EntitlementManagerCacheMaxBytes: 256 * 1024},
+		infra.NewMetricsFactory(prometheus.NewRegistry(), "", ""),
+		nil,
+	)
+	require.NoError(t, err)
+
+	small := syntheticRuleEntitlements(4, 1024)
+	large := syntheticRuleEntitlements(64, 2048)
+	require.Less(t, entitlementCacheResultSize(&entitlementCacheResult{entitlementData: small}), 8*1024)
+	require.Greater(t, entitlementCacheResultSize(&entitlementCacheResult{entitlementData: large}), 128*1024)
+
+	store := func(key *ChainAuthArgs, entitlements []types.Entitlement) {
+		_, _, err := ec.executeUsingCache(
+			ctx,
+			cfg,
+			key,
+			func(context.Context, *config.Config, *ChainAuthArgs) (CacheResult, error) {
+				return &entitlementCacheResult{allowed: true, entitlementData: entitlements}, nil
+			},
+		)
+		require.NoError(t, err)
+	}
+
+	var smallKeys []*ChainAuthArgs
+	for i := 0; i < 10; i++ {
+		key := newArgsForEnabledSpace(testutils.FakeStreamId(shared.STREAM_SPACE_BIN))
+		smallKeys = append(smallKeys, key)
+		store(key, small)
+	}
+	require.Less(t, ec.sizeLimiter.total, int64(256*1024))
+
+	// The first large payload still fits, the second one pushes the cache over the cap.
+	largeKey1 := newArgsForEnabledSpace(testutils.FakeStreamId(shared.STREAM_SPACE_BIN))
+	store(largeKey1, large)
+	require.True(t, ec.positiveCache.Contains(*largeKey1))
+
+	largeKey2 := newArgsForEnabledSpace(testutils.FakeStreamId(shared.STREAM_SPACE_BIN))
+	store(largeKey2, large)
+
+	// Largest entries are evicted first, and among those the oldest one goes.
+	require.False(t, ec.positiveCache.Contains(*largeKey1))
+	require.True(t, ec.positiveCache.Contains(*largeKey2))
+	for _, key := range smallKeys {
+		require.True(t, ec.positiveCache.Contains(*key))
+	}
+	// The entries are evicted down to the low-water mark, not just within the cap.
+	require.LessOrEqual(t, ec.sizeLimiter.total, int64(256*1024*cacheSizeLowWaterPercent/100))
+
+	require.Equal(t, float64(ec.sizeLimiter.total), testutil.ToFloat64(ec.sizeLimiter.gauge))
+
+	// Busting an entry releases its size.
+	before := ec.sizeLimiter.total
+	ec.bust(largeKey2)
+	require.Less(t, ec.sizeLimiter.total, before)
+	require.Equal(t, float64(ec.sizeLimiter.total), testutil.ToFloat64(ec.sizeLimiter.gauge))
+}
+
+func TestCacheSizeLimiterEvictsToLowWater(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	ec, err := newEntitlementCache(ctx, &config.ChainConfig{}, nil)
+	require.NoError(t, err)
+	const payload = 1000
+	entrySize := int64(entitlementCacheEntryOverhead + payload)
+	ec.sizeLimiter = newCacheSizeLimiter(func(CacheResult) int { return payload }, 10*entrySize, 0, nil)
+	clock := newFakeClock()
+	ec.clock = clock
+
+	var keys []*ChainAuthArgs
+	for range 11 {
+		clock.advance(time.Second)
+		key := newArgsForEnabledSpace(testutils.FakeStreamId(shared.STREAM_SPACE_BIN))
+		keys = append(keys, key)
+		_, _, err := ec.executeUsingCache(
+			ctx,
+			&config.Config{},
+			key,
+			func(context.Context, *config.Config, *ChainAuthArgs) (CacheResult, error) {
+				return boolCacheResult{isAllowed: true}, nil
+			},
+		)
+		require.NoError(t, err)
+	}
+
+	// Exceeding the cap by one entry evicts the entries down to 90% of it, the oldest first.
+	require.Equal(t, 9*entrySize, ec.sizeLimiter.total)
+	require.Equal(t, 9, ec.positiveCache.Len())
+	require.False(t, ec.positiveCache.Contains(*keys[0]))
+	require.False(t, ec.positiveCache.Contains(*keys[1]))
+}
@@ -2,10 +2,18 @@ package auth
 
 import (
 	"context"
+	"math/big"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 
 	"github.com/towns-protocol/towns/core/config"
 	"github.com/towns-protocol/towns/core/node/base/test"
+	"github.com/towns-protocol/towns/core/node/infra"
 	"github.com/towns-protocol/towns/core/node/shared"
 	"github.com/towns-protocol/towns/core/node/testutils"
 
@@ -58,6 +66,7 @@ func TestCache(t *testing.T) {
 			PositiveEntitlementCacheTTLSeconds: 15,
 			NegativeEntitlementCacheTTLSeconds: 2,
 		},
+		nil,
 	)
 	assert.NoError(t, err)
 	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
@@ -147,3 +156,309 @@ func TestCache(t *testing.T) {
 	assert.False(t, cacheHit)
 	assert.True(t, cacheMissForReal)
 }
+
+func TestCacheExpiryJitter(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	c, err := newEntitlementCache(ctx, &config.ChainConfig{PositiveEntitlementCacheTTLSeconds: 100}, nil)
+	assert.NoError(t, err)
+
+	store := func() *timestampedCacheValue {
+		key := NewChainAuthArgsForSpace(testutils.FakeStreamId(shared.STREAM_SPACE_BIN), "3", PermissionRead)
+		result, _, err := c.executeUsingCache(
+			ctx,
+			cfg,
+			key,
+			func(context.Context, *config.Config, *ChainAuthArgs) (CacheResult, error) {
+				return &simpleCacheResult{allowed: true}, nil
+			},
+		)
+		assert.NoError(t, err)
+		return result.(*timestampedCacheValue)
+	}
+
+	// Without jitter all entries expire after exactly the TTL.
+	assert.Zero(t, store().ttlJitter)
+
+	c.setExpiryJitter(10)
+	jitters := map[time.Duration]struct{}{}
+	for range 100 {
+		jitter := store().ttlJitter
+		assert.LessOrEqual(t, jitter, 10*time.Second)
+		assert.GreaterOrEqual(t, jitter, -10*time.Second)
+		jitters[jitter] = struct{}{}
+	}
+	assert.Greater(t, len(jitters), 90)
+
+	// Expiry honors the jitter of the entry.
+	assert.True(t, isFresh(&timestampedCacheValue{
+		timestamp: time.Now().Add(-105 * time.Second),
+		ttlJitter: 10 * time.Second,
+	}, c.positiveCacheTTL, time.Now()))
+	assert.False(t, isFresh(&timestampedCacheValue{
+		timestamp: time.Now().Add(-95 * time.Second),
+		ttlJitter: -10 * time.Second,
+	}, c.positiveCacheTTL, time.Now()))
+}
+
+func TestCacheServedAge(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	c, err := newEntitlementCache(ctx, &config.ChainConfig{}, nil)
+	assert.NoError(t, err)
+	c.name = "entitlement"
+	c.servedAge = newCacheServedAgeMetrics(
+		&config.ChainConfig{EntitlementCacheConcerningAge: time.Minute},
+		infra.NewMetricsFactory(prometheus.NewRegistry(), "", ""),
+	)
+
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+	lookup := func(key *ChainAuthArgs, allowed bool) bool {
+		_, cacheHit, err := c.executeUsingCache(
+			ctx,
+			cfg,
+			key,
+			func(context.Context, *config.Config, *ChainAuthArgs) (CacheResult, error) {
+				return &simpleCacheResult{allowed: allowed}, nil
+			},
+		)
+		assert.NoError(t, err)
+		return cacheHit
+	}
+
+	// Misses are not observed, hits are observed by the polarity of the served value.
+	allowedKey := NewChainAuthArgsForSpace(spaceId, "3", PermissionRead)
+	deniedKey := NewChainAuthArgsForSpace(spaceId, "4", PermissionRead)
+	assert.False(t, lookup(allowedKey, true))
+	assert.False(t, lookup(deniedKey, false))
+	assert.Zero(t, testutil.CollectAndCount(c.servedAge.ages))
+	assert.True(t, lookup(allowedKey, true))
+	assert.True(t, lookup(deniedKey, false))
+	assert.Equal(t, 2, testutil.CollectAndCount(c.servedAge.ages))
+	assert.Zero(t, testutil.CollectAndCount(c.servedAge.concerning))
+
+	// Values served past the concerning age are counted.
+	c.positiveCache.Add(*c.withGeneration(allowedKey), &timestampedCacheValue{
+		result:    &simpleCacheResult{allowed: true},
+		timestamp: time.Now().Add(-2 * time.Minute),
+	})
+	assert.True(t, lookup(allowedKey, true))
+	assert.EqualValues(t, 1, testutil.ToFloat64(c.servedAge.concerning.WithLabelValues("entitlement", "allowed")))
+	assert.Equal(t, 1, testutil.CollectAndCount(c.servedAge.concerning))
+}
+
+func TestCacheCoalescesConcurrentMisses(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	c, err := newEntitlementCache(ctx, &config.ChainConfig{}, nil)
+	assert.NoError(t, err)
+	c.coalesced = prometheus.NewCounter(prometheus.CounterOpts{Name: "coalesced"})
+
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+	var calls atomic.Int32
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	execute := func(ctx context.Context, key *ChainAuthArgs, wg *sync.WaitGroup) {
+		defer wg.Done()
+		result, cacheHit, err := c.executeUsingCache(
+			ctx,
+			cfg,
+			key,
+			func(ctx context.Context, _ *config.Config, _ *ChainAuthArgs) (CacheResult, error) {
+				if calls.Add(1) == 1 {
+					close(started)
+					select {
+					case <-release:
+					case <-ctx.Done():
+						return nil, ctx.Err()
+					}
+				}
+				return &simpleCacheResult{allowed: true}, nil
+			},
+		)
+		if ctx.Err() != nil {
+			return
+		}
+		assert.NoError(t, err)
+		assert.True(t, result.IsAllowed())
+		assert.False(t, cacheHit)
+	}
+
+	// Misses that arrive while the result is computed wait for it instead of computing it again.
+	key := NewChainAuthArgsForSpace(spaceId, "3", PermissionWrite)
+	var wg sync.WaitGroup
+	wg.Add(10)
+	go execute(ctx, key, &wg)
+	<-started
+	for range 9 {
+		go execute(ctx, key, &wg)
+	}
+	time.Sleep(100 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.EqualValues(t, 1, calls.Load())
+	assert.EqualValues(t, 9, testutil.ToFloat64(c.coalesced))
+
+	// A caller that gives up on the computation it started doesn't fail the callers waiting for it.
+	calls.Store(0)
+	started = make(chan struct{})
+	release = make(chan struct{})
+	defer close(release)
+
+	key = NewChainAuthArgsForSpace(spaceId, "4", PermissionWrite)
+	leaderCtx, leaderCancel := context.WithCancel(ctx)
+	wg.Add(2)
+	go execute(leaderCtx, key, &wg)
+	<-started
+	go execute(ctx, key, &wg)
+	time.Sleep(100 * time.Millisecond)
+	leaderCancel()
+	wg.Wait()
+
+	assert.EqualValues(t, 2, calls.Load())
+	assert.EqualValues(t, 10, testutil.ToFloat64(c.coalesced))
+}
+
+func TestMembershipCacheExpiresWithMembership(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	c, err := newEntitlementCache(
+		ctx,
+		&config.ChainConfig{
+			PositiveEntitlementCacheSize:       100,
+			NegativeEntitlementCacheSize:       100,
+			PositiveEntitlementCacheTTLSeconds: 900,
+			NegativeEntitlementCacheTTLSeconds: 2,
+		},
+		nil,
+	)
+	assert.NoError(t, err)
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+
+	var misses int
+	check := func(args *ChainAuthArgs, expiryTime int64) *timestampedCacheValue {
+		result, _, err := c.executeUsingCache(
+			ctx,
+			cfg,
+			args,
+			func(context.Context, *config.Config, *ChainAuthArgs) (CacheResult, error) {
+				misses++
+				return &membershipStatusCacheResult{
+					status: &MembershipStatus{IsMember: true, ExpiryTime: big.NewInt(expiryTime)},
+				}, nil
+			},
+		)
+		assert.NoError(t, err)
+		return result.(*timestampedCacheValue)
+	}
+	// elapse moves the cached value back in time as if d had passed.
+	elapse := func(val *timestampedCacheValue, d time.Duration) {
+		val.timestamp = val.timestamp.Add(-d)
+		if !val.expiresAt.IsZero() {
+			val.expiresAt = val.expiresAt.Add(-d)
+		}
+	}
+
+	// A membership expiring in 10 seconds is cached until then, not for the whole positive TTL.
+	expiring := NewChainAuthArgsForIsSpaceMember(spaceId, "0x1")
+	val := check(expiring, time.Now().Add(10*time.Second).Unix())
+	assert.True(t, val.IsAllowed())
+	assert.WithinDuration(t, time.Now().Add(10*time.Second), val.expiresAt, time.Second)
+
+	check(expiring, 0)
+	assert.Equal(t, 1, misses)
+
+	elapse(val, 11*time.Second)
+	check(expiring, 0)
+	assert.Equal(t, 2, misses)
+
+	// Memberships that don't expire keep the positive TTL.
+	permanent := NewChainAuthArgsForIsSpaceMember(spaceId, "0x2")
+	val = check(permanent, 0)
+	assert.True(t, val.expiresAt.IsZero())
+
+	elapse(val, 11*time.Second)
+	check(permanent, 0)
+	assert.Equal(t, 3, misses)
+
+	// Expired memberships are negatively cached.
+	expired := NewChainAuthArgsForIsSpaceMember(spaceId, "0x3")
+	result, _, err := c.executeUsingCache(
+		ctx,
+		cfg,
+		expired,
+		func(context.Context, *config.Config, *ChainAuthArgs) (CacheResult, error) {
+			return &membershipStatusCacheResult{status: &MembershipStatus{IsMember: true, IsExpired: true}}, nil
+		},
+	)
+	assert.NoError(t, err)
+	assert.False(t, result.IsAllowed())
+	_, ok := c.negativeCache.Peek(*c.withGeneration(expired))
+	assert.True(t, ok)
+}
+
+func TestCacheEvictionCallback(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	type eviction struct {
+		args    ChainAuthArgs
+		allowed bool
+		cached  bool
+	}
+	var c *entitlementCache
+	var evictions []eviction
+	c, err := newEntitlementCache(ctx, &config.ChainConfig{}, func(args *ChainAuthArgs, result CacheResult) {
+		// The callback runs before the entry is removed.
+		cached := c.positiveCache.Contains(*args) || c.negativeCache.Contains(*args)
+		evictions = append(evictions, eviction{args: *args, allowed: result.IsAllowed(), cached: cached})
+	})
+	assert.NoError(t, err)
+
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+	check := func(key *ChainAuthArgs, allowed bool) *timestampedCacheValue {
+		result, _, err := c.executeUsingCache(
+			ctx,
+			cfg,
+			key,
+			func(context.Context, *config.Config, *ChainAuthArgs) (CacheResult, error) {
+				return &simpleCacheResult{allowed: allowed}, nil
+			},
+		)
+		assert.NoError(t, err)
+		return result.(*timestampedCacheValue)
+	}
+
+	// Expired entries are reported when they are found stale.
+	allowed := NewChainAuthArgsForSpace(spaceId, "0x1", PermissionRead)
+	denied := NewChainAuthArgsForSpace(spaceId, "0x2", PermissionRead)
+	val := check(allowed, true)
+	check(denied, false).timestamp = time.Now().Add(-c.negativeCacheTTL)
+	check(allowed, true)
+	assert.Empty(t, evictions)
+
+	check(denied, false)
+	assert.Equal(t, []eviction{{args: *denied, allowed: false, cached: true}}, evictions)
+
+	val.timestamp = time.Now().Add(-c.positiveCacheTTL)
+	check(allowed, true)
+	assert.Equal(t, eviction{args: *allowed, allowed: true, cached: true}, evictions[1])
+
+	// Busted entries are reported, busting a missing entry is not.
+	evictions = nil
+	c.bust(allowed)
+	c.bust(allowed)
+	assert.Equal(t, []eviction{{args: *allowed, allowed: true, cached: true}}, evictions)
+	assert.False(t, c.positiveCache.Contains(*allowed))
+}
@@ -0,0 +1,753 @@
+package auth
+
+import (
+	"bufio"
+	"context"
+	"encoding/gob"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/towns-protocol/towns/core/config"
+	"github.com/towns-protocol/towns/core/contracts/types"
+	. "github.com/towns-protocol/towns/core/node/base"
+	"github.com/towns-protocol/towns/core/node/logging"
+	. "github.com/towns-protocol/towns/core/node/protocol"
+	"github.com/towns-protocol/towns/core/node/shared"
+	"github.com/towns-protocol/towns/core/xchain/entitlement"
+)
+
+const (
+	// DEFAULT_CACHE_WAL_COMPACTION_INTERVAL is the default interval at which the log is compacted.
+	DEFAULT_CACHE_WAL_COMPACTION_INTERVAL = 10 * time.Minute
+	// DEFAULT_CACHE_WAL_MAX_SIZE is the default size of the log past which it is compacted.
+	DEFAULT_CACHE_WAL_MAX_SIZE = 64 << 20
+	// cacheWalMaxPending caps the records waiting to be written. Records are dropped once exceeded, and the log
+	// is compacted instead, as the snapshot holds the entries they recorded.
+	cacheWalMaxPending = 10_000
+)
+
+// cacheWal persists entitlement cache entries to a write-ahead log so the caches are warm after a restart.
+// The file is a single gob stream: it is rewritten from a snapshot of the caches on startup, on flush and
+// whenever it is compacted, and every entry stored in between is appended to it.
+//
+// Entries are appended by a background writer, storing an entry only queues its record. Entries queued when
+// the node crashes are lost, which only leaves the caches colder after the restart.
+type cacheWal struct {
+	path          string
+	caches        cacheWalCaches
+	restorePolicy cacheWalRestorePolicy
+	// banListDigests are persisted along with the caches, so that the results restored after a restart are
+	// evaluated again if the ban list of their space changed while the node was down, see isBanListNewer.
+	banListDigests *banListDigests
+	// clock tells the age of the entries of the log, it is the clock of the caches.
+	clock Clock
+	// head is the latest block of the base chain seen, entries are recorded with the head they are written at.
+	head atomic.Uint64
+	log  *logging.Log
+
+	compactionInterval time.Duration
+	maxSize            int64
+
+	// pending are the records waiting to be written, in the order they were appended.
+	pendingMu sync.Mutex
+	pending   []*cacheWalRecord
+	// overflow is set if records were dropped because too many were pending.
+	overflow bool
+	closed   bool
+	wake     chan struct{}
+	done     chan struct{}
+	stopped  chan struct{}
+
+	// mu serializes the writes to the file. Pending records are taken while holding it, so they are written in
+	// order with the snapshots.
+	mu      sync.Mutex
+	file    *os.File
+	writer  *bufio.Writer
+	encoder *gob.Encoder
+	// size is the number of bytes written to the file.
+	size *countingWriter
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// cacheWalRestorePolicy tells which entries of the log are restored. Entries whose TTL elapsed are never restored,
+// entries that are too old or were written at a block the base chain hasn't reached are dropped as well: they
+// were evaluated with chain state the node can't vouch for, e.g. after a long downtime or a switch of RPC
+// provider.
+type cacheWalRestorePolicy struct {
+	// maxAge is the maximum age of restored entries, entries of any age are restored if it is 0.
+	maxAge time.Duration
+	// head is the latest block of the base chain at startup, 0 if it couldn't be read.
+	head uint64
+	// blockTime is the block period of the base chain, used to turn the blocks since an entry was written
+	// into its age.
+	blockTime time.Duration
+	// outcomes counts the entries of the log by cache and by whether they were restored.
+	outcomes *prometheus.CounterVec
+}
+
+const (
+	cacheWalRestored    = "restored"
+	cacheWalExpired     = "expired"
+	cacheWalTooOld      = "too_old"
+	cacheWalAheadOfHead = "ahead_of_head"
+)
+
+// check returns why the record must be dropped, the empty string if it can be restored.
+func (p *cacheWalRestorePolicy) check(r *cacheWalRecord, now time.Time) string {
+	if p.head != 0 && r.BlockNumber > p.head {
+		return cacheWalAheadOfHead
+	}
+	if p.maxAge <= 0 {
+		return ""
+	}
+	if now.Sub(r.Timestamp) > p.maxAge {
+		return cacheWalTooOld
+	}
+	// The entry was evaluated at or before the block it was written at.
+	if p.head != 0 && r.BlockNumber != 0 && time.Duration(p.head-r.BlockNumber)*p.blockTime > p.maxAge {
+		return cacheWalTooOld
+	}
+	return ""
+}
+
+func (p *cacheWalRestorePolicy) count(cache string, outcome string) {
+	if p.outcomes != nil {
+		p.outcomes.WithLabelValues(cache, outcome).Inc()
+	}
+}
+
+// cacheWalCaches maps the name a cache is recorded under in the write-ahead log to the cache.
+type cacheWalCaches map[string]*entitlementCache
+
+// cacheWalBanListDigest is the name the digests of the ban lists are recorded under in the write-ahead log.
+// Their records hold the space, the chain, the digest in WalletSetDigest and the time the list last changed in
+// Timestamp.
+const cacheWalBanListDigest = "banListDigest"
+
+type cacheWalResultType uint8
+
+const (
+	cacheWalResultBool cacheWalResultType = iota
+	cacheWalResultMembership
+	cacheWalResultLinkedWallets
+	cacheWalResultEntitlements
+	cacheWalResultWalletSet
+)
+
+// cacheWalRemoval tells which entries a tombstone record removes.
+type cacheWalRemoval uint8
+
+const (
+	// cacheWalStore records a stored entry.
+	cacheWalStore cacheWalRemoval = iota
+	// cacheWalRemoveKey removes the entry of the key of the record from its cache.
+	cacheWalRemoveKey
+	// cacheWalRemoveSpace removes the entries of the space of the record from all caches.
+	cacheWalRemoveSpace
+)
+
+// cacheWalRecord is the on-disk form of a single cache entry, or of the removal of entries recorded before it.
+type cacheWalRecord struct {
+	Removal              cacheWalRemoval
+	Cache                string
+	Kind                 chainAuthKind
+	SpaceId              shared.StreamId
+	ChannelId            shared.StreamId
+	Principal            common.Address
+	Permission           Permission
+	CustomPermission     string
+	LinkedWallets        string
+	WalletAddress        common.Address
+	PreFetchedWallets    string
+	HasPreFetchedWallets bool
+	ChainId              uint64
+	Permissions          string
+	PermissionMode       PermissionMode
+	Timestamp            time.Time
+	TTLJitter            time.Duration
+	ExpiresAt            time.Time
+
+	ResultType       cacheWalResultType
+	Allowed          bool
+	Reason           EntitlementResultReason
+	MembershipStatus *MembershipStatus
+	Wallets          []common.Address
+	Entitlements     []types.Entitlement
+	Owner            common.Address
+	WalletSetDigest  common.Hash
+	DataCachedAt     time.Time
+	RuleDenial       *entitlement.RuleDenial
+	SatisfiedBy      common.Address
+	// BaseChainOnlyUntil is set for linked wallets, and results evaluated with them, read from the base chain
+	// only.
+	BaseChainOnlyUntil time.Time
+	// ValidUntil is set for results evaluated with a membership that expires.
+	ValidUntil time.Time
+	// BlockNumber is the latest block of the base chain seen when the record was written, 0 if none was.
+	// The entry was evaluated at or before it.
+	BlockNumber uint64
+}
+
+// newCacheWalRecord converts a cache entry into a record. Entries holding result types that can't be
+// persisted are reported with ok set to false.
+func newCacheWalRecord(cache string, key ChainAuthArgs, val entitlementCacheValue) (*cacheWalRecord, bool) {
+	tsVal, ok := val.(*timestampedCacheValue)
+	if !ok {
+		return nil, false
+	}
+
+	record := newCacheWalKeyRecord(cache, key)
+	record.Timestamp = tsVal.timestamp
+	record.TTLJitter = tsVal.ttlJitter
+	record.ExpiresAt = tsVal.expiresAt
+
+	switch result := tsVal.result.(type) {
+	case boolCacheResult:
+		record.ResultType = cacheWalResultBool
+		record.Allowed = result.isAllowed
+		record.Reason = result.reason
+		record.SatisfiedBy = result.satisfiedBy
+	case *ruleDenialCacheResult:
+		record.ResultType = cacheWalResultBool
+		record.Allowed = result.isAllowed
+		record.Reason = result.reason
+		record.RuleDenial = result.ruleDenial
+	case *membershipStatusCacheResult:
+		record.ResultType = cacheWalResultMembership
+		record.MembershipStatus = result.status
+	case *linkedWalletCacheValue:
+		record.ResultType = cacheWalResultLinkedWallets
+		record.Wallets = result.wallets
+		record.BaseChainOnlyUntil = result.baseChainOnlyUntil
+	case *walletSetCacheResult:
+		record.ResultType = cacheWalResultWalletSet
+		record.Allowed = result.IsAllowed()
+		record.Reason = result.Reason()
+		record.WalletSetDigest = result.walletSetDigest
+		record.DataCachedAt = result.dataCachedAt
+		record.RuleDenial = ruleDenialOf(result.CacheResult)
+		record.SatisfiedBy = satisfiedByOf(result.CacheResult)
+		record.BaseChainOnlyUntil = result.baseChainOnlyUntil
+		record.ValidUntil = result.validUntil
+	case *entitlementCacheResult:
+		record.ResultType = cacheWalResultEntitlements
+		record.Allowed = result.allowed
+		record.Entitlements = result.entitlementData
+		record.Owner = result.owner
+	default:
+		return nil, false
+	}
+	return record, true
+}
+
+// newCacheWalBanListDigestRecord returns the record of the digest of the ban list of key.
+func newCacheWalBanListDigestRecord(key banListKey, digest banListDigest) *cacheWalRecord {
+	return &cacheWalRecord{
+		Cache:           cacheWalBanListDigest,
+		Kind:            chainAuthKindBannedWallets,
+		SpaceId:         key.spaceId,
+		ChainId:         key.chainId,
+		WalletSetDigest: digest.digest,
+		Timestamp:       digest.changedAt,
+	}
+}
+
+// newCacheWalKeyRecord returns a record of cache holding the fields of key.
+func newCacheWalKeyRecord(cache string, key ChainAuthArgs) *cacheWalRecord {
+	return &cacheWalRecord{
+		Cache:                cache,
+		Kind:                 key.kind,
+		SpaceId:              key.spaceId,
+		ChannelId:            key.channelId,
+		Principal:            key.principal,
+		Permission:           key.permission,
+		CustomPermission:     key.customPermission,
+		LinkedWallets:        key.linkedWallets,
+		WalletAddress:        key.walletAddress,
+		PreFetchedWallets:    key.preFetchedWallets,
+		HasPreFetchedWallets: key.hasPreFetchedWallets,
+		ChainId:              key.chainId,
+		Permissions:          key.permissions,
+		PermissionMode:       key.permissionMode,
+	}
+}
+
+func (r *cacheWalRecord) key() ChainAuthArgs {
+	return ChainAuthArgs{
+		kind:                 r.Kind,
+		spaceId:              r.SpaceId,
+		channelId:            r.ChannelId,
+		principal:            r.Principal,
+		permission:           r.Permission,
+		customPermission:     r.CustomPermission,
+		linkedWallets:        r.LinkedWallets,
+		walletAddress:        r.WalletAddress,
+		preFetchedWallets:    r.PreFetchedWallets,
+		hasPreFetchedWallets: r.HasPreFetchedWallets,
+		chainId:              r.ChainId,
+		permissions:          r.Permissions,
+		permissionMode:       r.PermissionMode,
+	}
+}
+
+func (r *cacheWalRecord) value() (*timestampedCacheValue, bool) {
+	var result CacheResult
+	switch r.ResultType {
+	case cacheWalResultBool:
+		result = r.boolResult()
+	case cacheWalResultMembership:
+		result = &membershipStatusCacheResult{status: r.MembershipStatus}
+	case cacheWalResultLinkedWallets:
+		result = &linkedWalletCacheValue{wallets: r.Wallets, baseChainOnlyUntil: r.BaseChainOnlyUntil}
+	case cacheWalResultEntitlements:
+		result = &entitlementCacheResult{allowed: r.Allowed, entitlementData: r.Entitlements, owner: r.Owner}
+	case cacheWalResultWalletSet:
+		result = &walletSetCacheResult{
+			CacheResult:        r.boolResult(),
+			walletSetDigest:    r.WalletSetDigest,
+			dataCachedAt:       r.DataCachedAt,
+			baseChainOnlyUntil: r.BaseChainOnlyUntil,
+			validUntil:         r.ValidUntil,
+		}
+	default:
+		return nil, false
+	}
+	return &timestampedCacheValue{
+		result:    result,
+		timestamp: r.Timestamp,
+		ttlJitter: r.TTLJitter,
+		expiresAt: r.ExpiresAt,
+	}, true
+}
+
+// boolResult returns the decision of the record, along with the wallet that satisfied allows and the
+// unsatisfied rule check of denials by rule entitlements.
+func (r *cacheWalRecord) boolResult() CacheResult {
+	result := boolCacheResult{isAllowed: r.Allowed, reason: r.Reason, satisfiedBy: r.SatisfiedBy}
+	if r.RuleDenial != nil {
+		return &ruleDenialCacheResult{boolCacheResult: result, ruleDenial: r.RuleDenial}
+	}
+	return result
+}
+
+// openCacheWal loads the entries in the write-ahead log of cfg into the given caches and the ban list digests
+// into banListDigests, if set, skipping entries whose TTL has elapsed at the time of clock or that
+// restorePolicy drops, compacts the log so that subsequent entries can be appended to it and starts the
+// writer. The writer stops with close.
+func openCacheWal(
+	ctx context.Context,
+	cfg *config.DiskCacheConfig,
+	caches cacheWalCaches,
+	banListDigests *banListDigests,
+	restorePolicy cacheWalRestorePolicy,
+	clock Clock,
+) (*cacheWal, error) {
+	wal := &cacheWal{
+		path:               cfg.Path,
+		caches:             caches,
+		banListDigests:     banListDigests,
+		restorePolicy:      restorePolicy,
+		clock:              clock,
+		log:                logging.FromCtx(ctx),
+		compactionInterval: cfg.CompactionInterval,
+		maxSize:            cfg.MaxSizeBytes,
+		wake:               make(chan struct{}, 1),
+		done:               make(chan struct{}),
+		stopped:            make(chan struct{}),
+	}
+	if wal.compactionInterval <= 0 {
+		wal.compactionInterval = DEFAULT_CACHE_WAL_COMPACTION_INTERVAL
+	}
+	if wal.maxSize <= 0 {
+		wal.maxSize = DEFAULT_CACHE_WAL_MAX_SIZE
+	}
+	wal.head.Store(restorePolicy.head)
+
+	if err := wal.load(ctx); err != nil {
+		return nil, err
+	}
+
+	for name, cache := range caches {
+		cache.name = name
+		cache.wal = wal
+	}
+	if banListDigests != nil {
+		banListDigests.wal = wal
+	}
+
+	if err := wal.flush(); err != nil {
+		return nil, err
+	}
+	go wal.run()
+	return wal, nil
+}
+
+// run writes the pending records as they are appended and compacts the log every compaction interval, or
+// once it grows past the maximum size. It writes the last pending records and returns once the log is closed.
+func (w *cacheWal) run() {
+	defer close(w.stopped)
+
+	ticker := time.NewTicker(w.compactionInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			w.writePending()
+			return
+		case <-w.wake:
+			w.writePending()
+		case <-ticker.C:
+			if err := w.flush(); err != nil {
+				w.log.Warnw("Failed to compact entitlement cache WAL", "path", w.path, "error", err)
+			}
+		}
+	}
+}
+
+func (w *cacheWal) load(ctx context.Context) error {
+	log := logging.FromCtx(ctx)
+
+	file, err := os.Open(w.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return AsRiverError(err, Err_INTERNAL).
+			Message("Failed to open entitlement cache WAL").
+			Tag("path", w.path).
+			Func("openCacheWal")
+	}
+	defer file.Close()
+
+	loaded, dropped, removed := 0, 0, 0
+	now := w.clock.Now()
+	// restored are the keys restored by space, to apply the space tombstones to.
+	type restoredKey struct {
+		cache *entitlementCache
+		key   ChainAuthArgs
+	}
+	restored := make(map[shared.StreamId][]restoredKey)
+	decoder := gob.NewDecoder(file)
+	for {
+		var record cacheWalRecord
+		if err := decoder.Decode(&record); err != nil {
+			if !errors.Is(err, io.EOF) {
+				// A truncated tail is expected if the node was not shut down gracefully.
+				log.Warnw("Stopped reading entitlement cache WAL", "path", w.path, "error", err)
+			}
+			break
+		}
+
+		if record.Removal == cacheWalRemoveSpace {
+			for _, r := range restored[record.SpaceId] {
+				r.cache.remove(r.key)
+			}
+			removed += len(restored[record.SpaceId])
+			delete(restored, record.SpaceId)
+			continue
+		}
+
+		// Digests tell whether the ban lists changed since, they are restored regardless of their age.
+		if record.Cache == cacheWalBanListDigest {
+			if w.banListDigests != nil {
+				w.banListDigests.restore(
+					banListKey{spaceId: record.SpaceId, chainId: record.ChainId},
+					banListDigest{digest: record.WalletSetDigest, changedAt: record.Timestamp},
+				)
+			}
+			continue
+		}
+
+		cache, ok := w.caches[record.Cache]
+		if !ok {
+			continue
+		}
+		if record.Removal == cacheWalRemoveKey {
+			cache.remove(record.key())
+			removed++
+			continue
+		}
+		val, ok := record.value()
+		if !ok {
+			continue
+		}
+		if reason := w.restorePolicy.check(&record, now); reason != "" {
+			w.restorePolicy.count(record.Cache, reason)
+			dropped++
+			continue
+		}
+		if key := record.key(); cache.restore(ctx, key, val) {
+			restored[key.spaceId] = append(restored[key.spaceId], restoredKey{cache: cache, key: key})
+			w.restorePolicy.count(record.Cache, cacheWalRestored)
+			loaded++
+		} else {
+			w.restorePolicy.count(record.Cache, cacheWalExpired)
+		}
+	}
+
+	log.Infow("Loaded entitlement cache WAL", "path", w.path, "entries", loaded, "dropped", dropped,
+		"removed", removed, "head", w.restorePolicy.head)
+	return nil
+}
+
+// append queues an entry stored under key in ec to be written to the end of the log.
+func (w *cacheWal) append(ec *entitlementCache, key ChainAuthArgs, val entitlementCacheValue) {
+	record, ok := newCacheWalRecord(ec.name, key, val)
+	if !ok {
+		return
+	}
+	record.BlockNumber = w.head.Load()
+	w.enqueue(record, ec.generations, &key)
+}
+
+// appendBanListDigest queues the digest of the ban list of key to be written to the end of the log.
+func (w *cacheWal) appendBanListDigest(key banListKey, digest banListDigest) {
+	w.enqueue(newCacheWalBanListDigestRecord(key, digest), nil, nil)
+}
+
+// removeKey queues a tombstone of the entry stored under key in ec.
+func (w *cacheWal) removeKey(ec *entitlementCache, key ChainAuthArgs) {
+	record := newCacheWalKeyRecord(ec.name, key)
+	record.Removal = cacheWalRemoveKey
+	w.enqueue(record, ec.generations, &key)
+}
+
+// removeSpace queues a tombstone of the entries of spaceId in all caches. It must be called once the
+// generation of the space is bumped, the entries of the previous generations stored afterwards are not
+// recorded.
+func (w *cacheWal) removeSpace(spaceId shared.StreamId) {
+	w.enqueue(&cacheWalRecord{Removal: cacheWalRemoveSpace, SpaceId: spaceId}, nil, nil)
+}
+
+// enqueue queues record for the writer. Records of keys that are not of the current generation of their space
+// are dropped: checking the generation while holding pendingMu orders them before the tombstone of their space.
+// Records appended once too many are pending are dropped, and the log is compacted instead.
+func (w *cacheWal) enqueue(record *cacheWalRecord, generations *spaceGenerations, key *ChainAuthArgs) {
+	w.pendingMu.Lock()
+	switch {
+	case w.closed:
+	case generations != nil && !generations.isCurrent(key):
+	case len(w.pending) >= cacheWalMaxPending:
+		w.overflow = true
+	default:
+		w.pending = append(w.pending, record)
+	}
+	w.pendingMu.Unlock()
+
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// takePending returns the pending records and whether records were dropped since the last call. It must be
+// called with mu held.
+func (w *cacheWal) takePending() ([]*cacheWalRecord, bool) {
+	w.pendingMu.Lock()
+	defer w.pendingMu.Unlock()
+	pending, overflow := w.pending, w.overflow
+	w.pending, w.overflow = nil, false
+	return pending, overflow
+}
+
+// writePending writes the pending records to the log. The log is compacted instead if records were dropped or
+// it grew past the maximum size.
+func (w *cacheWal) writePending() {
+	w.mu.Lock()
+	pending, overflow := w.takePending()
+	err := w.writeRecords(pending)
+	compact := overflow || (w.size != nil && w.size.n > w.maxSize)
+	w.mu.Unlock()
+
+	if err != nil {
+		w.log.Warnw("Failed to append to entitlement cache WAL", "path", w.path, "error", err)
+		compact = true
+	}
+	if compact {
+		if err := w.flush(); err != nil {
+			w.log.Warnw("Failed to compact entitlement cache WAL", "path", w.path, "error", err)
+		}
+	}
+}
+
+// writeRecords writes records to the log, it must be called with mu held.
+func (w *cacheWal) writeRecords(records []*cacheWalRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+	if w.encoder == nil {
+		return RiverError(Err_INTERNAL, "Entitlement cache WAL is closed", "path", w.path)
+	}
+	for _, record := range records {
+		if err := w.encoder.Encode(record); err != nil {
+			return err
+		}
+	}
+	return w.writer.Flush()
+}
+
+// flush replaces the log with a snapshot of the non-expired entries in the caches, which makes the pending
+// records redundant. The snapshot is written to a temporary file that is then renamed over the log, so a failed
+// flush leaves the previous log intact.
+func (w *cacheWal) flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// The records pending before the snapshot is taken recorded changes it holds, those appended while it is
+	// written are written after it.
+	_, _ = w.takePending()
+
+	tmp, err := os.CreateTemp(filepath.Dir(w.path), filepath.Base(w.path)+".*.tmp")
+	if err != nil {
+		return AsRiverError(err, Err_INTERNAL).Message("Failed to create entitlement cache WAL").Tag("path", w.path)
+	}
+
+	size := &countingWriter{w: tmp}
+	writer := bufio.NewWriter(size)
+	encoder := gob.NewEncoder(writer)
+	for name, cache := range w.caches {
+		if err := cache.snapshot(name, encoder, w.head.Load()); err != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+			return AsRiverError(err, Err_INTERNAL).Message("Failed to write entitlement cache WAL").Tag("path", w.path)
+		}
+	}
+	if w.banListDigests != nil {
+		if err := w.banListDigests.snapshot(encoder); err != nil {
+			_ = tmp.Close()
+			_ = os.Remove(tmp.Name())
+			return AsRiverError(err, Err_INTERNAL).Message("Failed to write entitlement cache WAL").Tag("path", w.path)
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return AsRiverError(err, Err_INTERNAL).Message("Failed to write entitlement cache WAL").Tag("path", w.path)
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return AsRiverError(err, Err_INTERNAL).Message("Failed to sync entitlement cache WAL").Tag("path", w.path)
+	}
+	if err := os.Rename(tmp.Name(), w.path); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return AsRiverError(err, Err_INTERNAL).Message("Failed to replace entitlement cache WAL").Tag("path", w.path)
+	}
+
+	if w.file != nil {
+		_ = w.file.Close()
+	}
+	w.file = tmp
+	w.writer = writer
+	w.encoder = encoder
+	w.size = size
+	return nil
+}
+
+// onBlock records the latest block of the base chain, entries written afterwards are recorded with it.
+func (w *cacheWal) onBlock(blockNum uint64) {
+	w.head.Store(max(w.head.Load(), blockNum))
+}
+
+// close writes the pending records, stops the writer and closes the log. Entries stored afterwards are not
+// persisted.
+func (w *cacheWal) close() {
+	w.pendingMu.Lock()
+	if w.closed {
+		w.pendingMu.Unlock()
+		return
+	}
+	w.closed = true
+	w.pendingMu.Unlock()
+	close(w.done)
+	<-w.stopped
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file != nil {
+		_ = w.file.Close()
+	}
+	w.file = nil
+	w.writer = nil
+	w.encoder = nil
+}
+
+// restore adds an entry read from the write-ahead log to the cache, unless its TTL has already elapsed.
+func (ec *entitlementCache) restore(ctx context.Context, key ChainAuthArgs, val *timestampedCacheValue) bool {
+	if val.IsAllowed() {
+		if !isFresh(val, ec.positiveCacheTTL, ec.now()) {
+			return false
+		}
+		ec.positiveCache.Add(key, val)
+	} else {
+		if !isFresh(val, ec.negativeCacheTTL, ec.now()) {
+			return false
+		}
+		ec.negativeCache.Add(key, val)
+	}
+	if ec.sizeLimiter != nil {
+		ec.sizeLimiter.track(ctx, ec, key, val)
+	}
+	return true
+}
+
+// snapshot encodes the non-expired entries of the cache, recorded as written at block head.
+func (ec *entitlementCache) snapshot(name string, encoder *gob.Encoder, head uint64) error {
+	write := func(key ChainAuthArgs, ttl time.Duration, val entitlementCacheValue, ok bool) error {
+		if !ok || !isFresh(val, ttl, ec.now()) || (ec.generations != nil && !ec.generations.isCurrent(&key)) {
+			return nil
+		}
+		record, ok := newCacheWalRecord(name, key, val)
+		if !ok {
+			return nil
+		}
+		record.BlockNumber = head
+		return encoder.Encode(record)
+	}
+
+	for _, key := range ec.positiveCache.Keys() {
+		val, ok := ec.positiveCache.Peek(key)
+		if err := write(key, ec.positiveCacheTTL, val, ok); err != nil {
+			return err
+		}
+	}
+	for _, key := range ec.negativeCache.Keys() {
+		val, ok := ec.negativeCache.Peek(key)
+		if err := write(key, ec.negativeCacheTTL, val, ok); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FlushCacheToDisk writes a compacted snapshot of the entitlement caches to the write-ahead log.
+// It is a no-op if disk persistence is not configured. Intended to be called on graceful shutdown.
+func (ca *chainAuth) FlushCacheToDisk() error {
+	if ca.cacheWal == nil {
+		return nil
+	}
+	return ca.cacheWal.flush()
+}
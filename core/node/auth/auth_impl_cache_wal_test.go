@@ -0,0 +1,423 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/gob"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/towns-protocol/towns/core/config"
+	"github.com/towns-protocol/towns/core/contracts/types"
+	"github.com/towns-protocol/towns/core/node/base/test"
+	"github.com/towns-protocol/towns/core/node/crypto"
+	"github.com/towns-protocol/towns/core/node/infra"
+	"github.com/towns-protocol/towns/core/node/shared"
+	"github.com/towns-protocol/towns/core/node/testutils"
+	"github.com/towns-protocol/towns/core/xchain/entitlement"
+)
+
+func TestCacheWalWarmsCachesAfterRestart(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	diskCacheCfg := &config.DiskCacheConfig{Path: filepath.Join(t.TempDir(), "entitlements.wal")}
+	alice := common.HexToAddress("0xa11ce")
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+
+	newChainAuthWithWal := func(spaceContract SpaceContract) *chainAuth {
+		ca, err := newChainAuth(
+			ctx,
+			&crypto.Blockchain{Config: &config.ChainConfig{}},
+			nil,
+			spaceContract,
+			nil,
+			nil,
+			0,
+			0,
+			0,
+			0,
+			diskCacheCfg,
+			infra.NewMetricsFactory(prometheus.NewRegistry(), "", ""),
+		)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = ca.Close() })
+		return ca
+	}
+
+	spaceContract := newFakeSpaceContract(common.HexToAddress("0x0e"), alice)
+	ca := newChainAuthWithWal(spaceContract)
+	result, err := ca.IsEntitled(ctx, cfg, NewChainAuthArgsForSpace(spaceId, alice.Hex(), PermissionWrite))
+	require.NoError(t, err)
+	require.True(t, result.IsEntitled())
+	ca.cacheWal.writePending()
+
+	// Entries appended to the log are loaded by a new instance without touching the contract.
+	restartedContract := newFakeSpaceContract(common.HexToAddress("0x0e"), alice)
+	restarted := newChainAuthWithWal(restartedContract)
+	result, err = restarted.IsEntitled(ctx, cfg, NewChainAuthArgsForSpace(spaceId, alice.Hex(), PermissionWrite))
+	require.NoError(t, err)
+	require.True(t, result.IsEntitled())
+	require.Zero(t, restartedContract.callCount("GetSpaceEntitlementsForPermission"))
+	require.Zero(t, restartedContract.callCount("GetMembershipStatus"))
+
+	// Expired entries are dropped when the log is compacted.
+	key := newArgsForEnabledSpace(testutils.FakeStreamId(shared.STREAM_SPACE_BIN))
+	restarted.entitlementCache.positiveCache.Add(*key, &timestampedCacheValue{
+		result:    boolCacheResult{isAllowed: true},
+		timestamp: time.Now().Add(-time.Hour),
+	})
+	require.NoError(t, restarted.FlushCacheToDisk())
+
+	reloaded := newChainAuthWithWal(newFakeSpaceContract(common.HexToAddress("0x0e"), alice))
+	require.False(t, reloaded.entitlementCache.positiveCache.Contains(*key))
+	require.True(t, reloaded.entitlementCache.positiveCache.Contains(
+		*NewChainAuthArgsForSpace(spaceId, alice.Hex(), PermissionWrite),
+	))
+}
+
+func TestCacheWalRestoresBanListDigests(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	diskCacheCfg := &config.DiskCacheConfig{Path: filepath.Join(t.TempDir(), "entitlements.wal")}
+	alice := common.HexToAddress("0xa11ce")
+	bob := common.HexToAddress("0xb0b")
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+
+	newChainAuthWithWal := func(spaceContract SpaceContract) *chainAuth {
+		ca, err := newChainAuth(
+			ctx,
+			&crypto.Blockchain{Config: &config.ChainConfig{}},
+			nil,
+			spaceContract,
+			nil,
+			nil,
+			0,
+			0,
+			0,
+			0,
+			diskCacheCfg,
+			infra.NewMetricsFactory(prometheus.NewRegistry(), "", ""),
+		)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = ca.Close() })
+		return ca
+	}
+	isEntitled := func(ca *chainAuth, principal common.Address) bool {
+		result, err := ca.IsEntitled(ctx, cfg, NewChainAuthArgsForSpace(spaceId, principal.Hex(), PermissionWrite))
+		require.NoError(t, err)
+		return result.IsEntitled()
+	}
+
+	ca := newChainAuthWithWal(newFakeSpaceContract(common.HexToAddress("0x0e"), alice, bob))
+	require.True(t, isEntitled(ca, alice))
+	require.True(t, isEntitled(ca, bob))
+	ca.cacheWal.writePending()
+
+	// Alice is banned while the node is down. The ban list fetched after the restart differs from the restored
+	// digest, so the restored results of the space are evaluated again.
+	restartedContract := newFakeSpaceContract(common.HexToAddress("0x0e"), alice, bob)
+	restartedContract.banned[alice] = true
+	restarted := newChainAuthWithWal(restartedContract)
+	require.False(t, isEntitled(restarted, alice))
+	require.True(t, isEntitled(restarted, bob))
+	require.Equal(t, 1, restartedContract.callCount("GetBannedWallets"))
+
+	// The digest of the changed list is persisted as well, and survives the compaction of the log.
+	require.NoError(t, restarted.FlushCacheToDisk())
+	digest, ok := restarted.banListDigests.digests.Peek(banListKey{spaceId: spaceId})
+	require.True(t, ok)
+	require.False(t, digest.changedAt.IsZero())
+
+	reloaded := newChainAuthWithWal(restartedContract)
+	reloadedDigest, ok := reloaded.banListDigests.digests.Peek(banListKey{spaceId: spaceId})
+	require.True(t, ok)
+	require.Equal(t, digest.digest, reloadedDigest.digest)
+	require.True(t, digest.changedAt.Equal(reloadedDigest.changedAt))
+	require.False(t, isEntitled(reloaded, alice))
+}
+
+func TestCacheWalDoesNotRestoreRemovedEntries(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	diskCacheCfg := &config.DiskCacheConfig{Path: filepath.Join(t.TempDir(), "entitlements.wal")}
+	alice := common.HexToAddress("0xa11ce")
+	bob := common.HexToAddress("0xb0b")
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+	otherSpaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+
+	newChainAuthWithWal := func() *chainAuth {
+		ca, err := newChainAuth(
+			ctx,
+			&crypto.Blockchain{Config: &config.ChainConfig{}},
+			nil,
+			newFakeSpaceContract(common.HexToAddress("0x0e"), alice, bob),
+			nil,
+			nil,
+			0,
+			0,
+			0,
+			0,
+			diskCacheCfg,
+			infra.NewMetricsFactory(prometheus.NewRegistry(), "", ""),
+		)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = ca.Close() })
+		return ca
+	}
+	cached := func(ca *chainAuth, spaceId shared.StreamId, principal common.Address) bool {
+		return len(ca.DumpCache(CacheDumpFilter{SpaceId: spaceId, Principal: principal}).Entries) > 0
+	}
+
+	ca := newChainAuthWithWal()
+	for _, spaceId := range []shared.StreamId{spaceId, otherSpaceId} {
+		for _, principal := range []common.Address{alice, bob} {
+			result, err := ca.IsEntitled(ctx, cfg, NewChainAuthArgsForSpace(spaceId, principal.Hex(), PermissionWrite))
+			require.NoError(t, err)
+			require.True(t, result.IsEntitled())
+		}
+	}
+
+	// The node crashes after removing the entries of alice in a space and those of the other space, the log
+	// holds the stored entries followed by their tombstones.
+	_, err := ca.InvalidateCaches(CacheInvalidationRequest{
+		IdempotencyKey: "alice",
+		Version:        1,
+		Actor:          "operator",
+		SpaceId:        spaceId,
+		Principal:      alice,
+	})
+	require.NoError(t, err)
+	ca.InvalidateCacheForSpace(otherSpaceId)
+	ca.cacheWal.writePending()
+
+	restarted := newChainAuthWithWal()
+	require.False(t, cached(restarted, spaceId, alice))
+	require.True(t, cached(restarted, spaceId, bob))
+	require.False(t, cached(restarted, otherSpaceId, alice))
+	require.False(t, cached(restarted, otherSpaceId, bob))
+
+	// Entries stored after the invalidation of their space are restored.
+	result, err := restarted.IsEntitled(ctx, cfg, NewChainAuthArgsForSpace(otherSpaceId, bob.Hex(), PermissionWrite))
+	require.NoError(t, err)
+	require.True(t, result.IsEntitled())
+	restarted.cacheWal.writePending()
+
+	reloaded := newChainAuthWithWal()
+	require.True(t, cached(reloaded, otherSpaceId, bob))
+	require.False(t, cached(reloaded, spaceId, alice))
+}
+
+func TestCacheWalRecordRuleDenial(t *testing.T) {
+	ruleDenial := &entitlement.RuleDenial{
+		CheckType:       types.ERC20,
+		ChainId:         big.NewInt(8453),
+		ContractAddress: common.HexToAddress("0x70c4e5"),
+		Threshold:       big.NewInt(10),
+		Balance:         big.NewInt(3),
+	}
+	spaceDenial := &ruleDenialCacheResult{
+		boolCacheResult: boolCacheResult{isAllowed: false, reason: EntitlementResultReason_SPACE_ENTITLEMENTS},
+		ruleDenial:      ruleDenial,
+	}
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+	args := NewChainAuthArgsForSpace(spaceId, common.HexToAddress("0xa11ce").Hex(), PermissionRead)
+
+	for _, result := range []CacheResult{
+		spaceDenial,
+		&walletSetCacheResult{CacheResult: spaceDenial, walletSetDigest: common.HexToHash("0x1")},
+	} {
+		record, ok := newCacheWalRecord("entitlement", *args, &timestampedCacheValue{
+			result:    result,
+			timestamp: time.Now(),
+		})
+		require.True(t, ok)
+
+		// The denial survives the encoding of the log.
+		var buf bytes.Buffer
+		require.NoError(t, gob.NewEncoder(&buf).Encode(record))
+		var decoded cacheWalRecord
+		require.NoError(t, gob.NewDecoder(&buf).Decode(&decoded))
+
+		value, ok := decoded.value()
+		require.True(t, ok)
+		require.False(t, value.IsAllowed())
+		require.Equal(t, EntitlementResultReason_SPACE_ENTITLEMENTS, value.Reason())
+		require.Equal(t, ruleDenial, ruleDenialOf(value.Result()))
+	}
+
+	// Other decisions don't carry a denial.
+	value, ok := (&cacheWalRecord{ResultType: cacheWalResultBool}).value()
+	require.True(t, ok)
+	require.Nil(t, ruleDenialOf(value.Result()))
+}
+
+func TestCacheWalRecordSatisfiedBy(t *testing.T) {
+	alice := common.HexToAddress("0xa11ce")
+	allow := boolCacheResult{isAllowed: true, reason: EntitlementResultReason_NONE, satisfiedBy: alice}
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+	args := NewChainAuthArgsForSpace(spaceId, alice.Hex(), PermissionRead)
+
+	for _, result := range []CacheResult{
+		allow,
+		&walletSetCacheResult{CacheResult: allow, walletSetDigest: common.HexToHash("0x1")},
+	} {
+		record, ok := newCacheWalRecord("entitlement", *args, &timestampedCacheValue{
+			result:    result,
+			timestamp: time.Now(),
+		})
+		require.True(t, ok)
+
+		var buf bytes.Buffer
+		require.NoError(t, gob.NewEncoder(&buf).Encode(record))
+		var decoded cacheWalRecord
+		require.NoError(t, gob.NewDecoder(&buf).Decode(&decoded))
+
+		value, ok := decoded.value()
+		require.True(t, ok)
+		require.True(t, value.IsAllowed())
+		require.Equal(t, alice, satisfiedByOf(value.Result()))
+	}
+}
+
+func TestCacheWalRestorePolicy(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	path := filepath.Join(t.TempDir(), "entitlements.wal")
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+	// The ages of the entries are measured with the clock of the caches, not the system clock.
+	clock := newFakeClock()
+	now := clock.Now()
+	const head = 10_000
+
+	// Entries of varying ages: the age of an entry is measured from its timestamp and from the block it was
+	// written at, 2 seconds apart.
+	fixtures := []struct {
+		principal   common.Address
+		timestamp   time.Time
+		blockNumber uint64
+		outcome     string
+	}{
+		{common.HexToAddress("0x1"), now.Add(-time.Minute), head - 30, cacheWalRestored},
+		{common.HexToAddress("0x2"), now.Add(-time.Minute), 0, cacheWalRestored},
+		{common.HexToAddress("0x3"), now.Add(-3 * time.Hour), head - 30, cacheWalTooOld},
+		{common.HexToAddress("0x4"), now.Add(-time.Minute), head - 5_000, cacheWalTooOld},
+		{common.HexToAddress("0x5"), now.Add(-time.Minute), head + 100, cacheWalAheadOfHead},
+	}
+	file, err := os.Create(path)
+	require.NoError(t, err)
+	encoder := gob.NewEncoder(file)
+	for _, f := range fixtures {
+		args := NewChainAuthArgsForSpace(spaceId, f.principal.Hex(), PermissionRead)
+		record, ok := newCacheWalRecord("entitlement", *args, &timestampedCacheValue{
+			result:    boolCacheResult{isAllowed: true},
+			timestamp: f.timestamp,
+		})
+		require.True(t, ok)
+		record.BlockNumber = f.blockNumber
+		require.NoError(t, encoder.Encode(record))
+	}
+	require.NoError(t, file.Close())
+
+	ec, err := newEntitlementCache(ctx, &config.ChainConfig{PositiveEntitlementCacheTTLSeconds: 86400}, nil)
+	require.NoError(t, err)
+	ec.clock = clock
+	outcomes := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "restored"}, []string{"cache", "outcome"})
+	wal, err := openCacheWal(
+		ctx,
+		&config.DiskCacheConfig{Path: path},
+		cacheWalCaches{"entitlement": ec},
+		nil,
+		cacheWalRestorePolicy{
+			maxAge:    2 * time.Hour,
+			head:      head,
+			blockTime: 2 * time.Second,
+			outcomes:  outcomes,
+		},
+		clock,
+	)
+	require.NoError(t, err)
+
+	counts := map[string]float64{}
+	for _, f := range fixtures {
+		args := NewChainAuthArgsForSpace(spaceId, f.principal.Hex(), PermissionRead)
+		require.Equal(t, f.outcome == cacheWalRestored, ec.positiveCache.Contains(*args), f.principal)
+		counts[f.outcome]++
+	}
+	for outcome, count := range counts {
+		require.Equal(t, count, testutil.ToFloat64(outcomes.WithLabelValues("entitlement", outcome)), outcome)
+	}
+
+	// The restored entries are written back at the head, entries appended later at the latest block seen.
+	wal.onBlock(head + 10)
+	appended := NewChainAuthArgsForSpace(spaceId, common.HexToAddress("0x7").Hex(), PermissionRead)
+	wal.append(ec, *appended, &timestampedCacheValue{
+		result:    boolCacheResult{isAllowed: true},
+		timestamp: now,
+	})
+	wal.close()
+
+	ec, err = newEntitlementCache(ctx, &config.ChainConfig{PositiveEntitlementCacheTTLSeconds: 86400}, nil)
+	require.NoError(t, err)
+	ec.clock = clock
+	reopened, err := openCacheWal(
+		ctx,
+		&config.DiskCacheConfig{Path: path},
+		cacheWalCaches{"entitlement": ec},
+		nil,
+		cacheWalRestorePolicy{head: head + 5},
+		clock,
+	)
+	require.NoError(t, err)
+	defer reopened.close()
+	require.Equal(t, 2, ec.positiveCache.Len())
+	require.False(t, ec.positiveCache.Contains(*appended))
+}
+
+func TestCacheWalCompactsPastMaxSize(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	path := filepath.Join(t.TempDir(), "entitlements.wal")
+	clock := newFakeClock()
+	ec, err := newEntitlementCache(ctx, &config.ChainConfig{}, nil)
+	require.NoError(t, err)
+	ec.clock = clock
+	wal, err := openCacheWal(
+		ctx,
+		&config.DiskCacheConfig{Path: path, MaxSizeBytes: 4096},
+		cacheWalCaches{"entitlement": ec},
+		nil,
+		cacheWalRestorePolicy{},
+		clock,
+	)
+	require.NoError(t, err)
+	defer wal.close()
+
+	// Storing the same entry again and again grows the log until it is compacted to the single cached entry.
+	key := NewChainAuthArgsForSpace(
+		testutils.FakeStreamId(shared.STREAM_SPACE_BIN), common.HexToAddress("0xa11ce").Hex(), PermissionRead)
+	val := &timestampedCacheValue{result: boolCacheResult{isAllowed: true}, timestamp: clock.Now()}
+	ec.positiveCache.Add(*key, val)
+	for range 1000 {
+		wal.append(ec, *key, val)
+		wal.writePending()
+	}
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.LessOrEqual(t, info.Size(), int64(4096+1024))
+}
@@ -0,0 +1,140 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/towns-protocol/towns/core/config"
+	. "github.com/towns-protocol/towns/core/node/base"
+	"github.com/towns-protocol/towns/core/node/logging"
+	"github.com/towns-protocol/towns/core/node/shared"
+)
+
+const (
+	DEFAULT_CACHE_WARMING_CONCURRENCY = 8
+	DEFAULT_CACHE_WARMING_TIMEOUT     = 30 * time.Second
+)
+
+// cacheWarmer prefetches the entitlements of popular spaces so that the first users after a restart
+// don't pay for cold caches.
+type cacheWarmer struct {
+	concurrency int
+	timeout     time.Duration
+
+	warmed prometheus.Counter
+	failed prometheus.Counter
+}
+
+// warmedPermissions are the permissions whose space entitlements are prefetched.
+var warmedPermissions = []Permission{PermissionRead, PermissionWrite}
+
+// WarmCaches prefetches whether the given spaces are enabled and their entitlements for reading and writing.
+// Spaces are warmed concurrently by a bounded number of workers until all are done or the warming deadline
+// passes. Failures are logged and counted, never returned, as warming is only an optimization.
+func (ca *chainAuth) WarmCaches(ctx context.Context, spaceIds []shared.StreamId) {
+	if len(spaceIds) == 0 {
+		return
+	}
+	if ca.readOnly.active() {
+		ca.warmer.failed.Add(float64(len(spaceIds)))
+		logging.FromCtx(ctx).Warnw("Entitlement cache warming skipped, chainAuth is read-only", "spaces", len(spaceIds))
+		return
+	}
+
+	log := logging.FromCtx(ctx)
+	ctx, cancel := context.WithTimeout(ctx, ca.warmer.timeout)
+	defer cancel()
+
+	spaces := make(chan shared.StreamId)
+	var wg sync.WaitGroup
+	for range min(ca.warmer.concurrency, len(spaceIds)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for spaceId := range spaces {
+				if err := ca.warmSpace(ctx, nil, spaceId, warmedPermissions); err != nil {
+					ca.warmer.failed.Inc()
+					log.Warnw("Failed to warm entitlement caches for space", "spaceId", spaceId, "error", err)
+				} else {
+					ca.warmer.warmed.Inc()
+				}
+			}
+		}()
+	}
+
+	start := time.Now()
+	for i, spaceId := range spaceIds {
+		select {
+		case spaces <- spaceId:
+		case <-ctx.Done():
+			ca.warmer.failed.Add(float64(len(spaceIds) - i))
+			log.Warnw("Entitlement cache warming deadline exceeded", "remaining", len(spaceIds)-i)
+			close(spaces)
+			wg.Wait()
+			return
+		}
+	}
+	close(spaces)
+	wg.Wait()
+
+	log.Infow("Warmed entitlement caches", "spaces", len(spaceIds), "duration", time.Since(start))
+}
+
+// WarmSpace prefetches whether the space is enabled and its entitlements for the given permissions, so that a
+// wave of users joining a large space doesn't stampede the chain with identical reads. Operators call it after
+// detecting a traffic spike or on a schedule for high-value spaces. Results that are already cached are not
+// fetched again. Unlike WarmCaches, failures are returned to the caller.
+func (ca *chainAuth) WarmSpace(
+	ctx context.Context,
+	cfg *config.Config,
+	spaceId shared.StreamId,
+	permissions []Permission,
+) error {
+	if err := ca.readOnly.check("warm"); err != nil {
+		return AsRiverError(err).Func("WarmSpace")
+	}
+	if err := ca.warmSpace(ctx, cfg, spaceId, permissions); err != nil {
+		ca.warmer.failed.Inc()
+		return AsRiverError(err).Func("WarmSpace").Tag("spaceId", spaceId)
+	}
+	ca.warmer.warmed.Inc()
+	return nil
+}
+
+func (ca *chainAuth) warmSpace(
+	ctx context.Context,
+	cfg *config.Config,
+	spaceId shared.StreamId,
+	permissions []Permission,
+) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Millisecond*time.Duration(ca.contractCallsTimeoutMs))
+	defer cancel()
+
+	if _, _, err := ca.entitlementCache.executeUsingCache(
+		ctx,
+		cfg,
+		newArgsForEnabledSpace(spaceId),
+		ca.isSpaceEnabledUncached,
+	); err != nil {
+		return err
+	}
+
+	for _, permission := range permissions {
+		if _, _, err := ca.entitlementManagerCache.executeUsingCache(
+			ctx,
+			cfg,
+			newArgsForEntitlementManager(&ChainAuthArgs{
+				kind:       chainAuthKindSpace,
+				spaceId:    spaceId,
+				permission: permission,
+			}),
+			ca.getSpaceEntitlementsForPermissionUncached,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/towns-protocol/towns/core/config"
+	"github.com/towns-protocol/towns/core/node/base/test"
+	"github.com/towns-protocol/towns/core/node/crypto"
+	"github.com/towns-protocol/towns/core/node/infra"
+	"github.com/towns-protocol/towns/core/node/shared"
+	"github.com/towns-protocol/towns/core/node/testutils"
+)
+
+func TestWarmCaches(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	alice := common.HexToAddress("0xa11ce")
+	spaceContract := newFakeSpaceContract(common.HexToAddress("0x0e"), alice)
+	spaceIds := make([]shared.StreamId, 20)
+	configured := []string{"not a space id"}
+	for i := range spaceIds {
+		spaceIds[i] = testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+		configured = append(configured, spaceIds[i].String())
+	}
+
+	ca, err := newChainAuth(
+		ctx,
+		&crypto.Blockchain{Config: &config.ChainConfig{
+			EntitlementCacheWarmSpaceIds:    configured,
+			EntitlementCacheWarmConcurrency: 4,
+		}},
+		nil,
+		spaceContract,
+		nil,
+		nil,
+		0,
+		0,
+		0,
+		0,
+		nil,
+		infra.NewMetricsFactory(prometheus.NewRegistry(), "", ""),
+	)
+	require.NoError(t, err)
+
+	// Warming runs in the background, invalid space ids are counted as failures.
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(ca.warmer.warmed) == float64(len(spaceIds))
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, 1.0, testutil.ToFloat64(ca.warmer.failed))
+	require.Equal(t, len(spaceIds), spaceContract.callCount("IsSpaceDisabled"))
+	require.Equal(t, 2*len(spaceIds), spaceContract.callCount("GetSpaceEntitlementsForPermission"))
+
+	// Checks against warmed spaces are served from the caches without hitting the contract again.
+	cfg := &config.Config{}
+	for _, spaceId := range spaceIds {
+		result, err := ca.IsEntitled(ctx, cfg, NewChainAuthArgsForSpace(spaceId, alice.Hex(), PermissionWrite))
+		require.NoError(t, err)
+		require.True(t, result.IsEntitled())
+	}
+	require.Equal(t, float64(len(spaceIds)), testutil.ToFloat64(ca.isSpaceEnabledCacheHit))
+	require.Zero(t, testutil.ToFloat64(ca.isSpaceEnabledCacheMiss))
+	require.Equal(t, float64(len(spaceIds)), testutil.ToFloat64(ca.entitlementCacheHit))
+	require.Zero(t, testutil.ToFloat64(ca.entitlementCacheMiss))
+	require.Equal(t, len(spaceIds), spaceContract.callCount("IsSpaceDisabled"))
+	require.Equal(t, 2*len(spaceIds), spaceContract.callCount("GetSpaceEntitlementsForPermission"))
+}
+
+func TestWarmSpace(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	alice := common.HexToAddress("0xa11ce")
+	spaceContract := newFakeSpaceContract(common.HexToAddress("0x0e"), alice)
+	ca := newTestChainAuth(t, ctx, spaceContract)
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+
+	require.NoError(t, ca.WarmSpace(ctx, cfg, spaceId, []Permission{PermissionReact, PermissionRedact}))
+	require.Equal(t, 1, spaceContract.callCount("IsSpaceDisabled"))
+	require.Equal(t, 2, spaceContract.callCount("GetSpaceEntitlementsForPermission"))
+	require.Equal(t, 1.0, testutil.ToFloat64(ca.warmer.warmed))
+
+	// Warming an already warm space doesn't read the chain again.
+	require.NoError(t, ca.WarmSpace(ctx, cfg, spaceId, []Permission{PermissionReact}))
+	require.Equal(t, 1, spaceContract.callCount("IsSpaceDisabled"))
+	require.Equal(t, 2, spaceContract.callCount("GetSpaceEntitlementsForPermission"))
+
+	// Checks of the warmed permissions are served from the caches.
+	result, err := ca.IsEntitled(ctx, cfg, NewChainAuthArgsForSpace(spaceId, alice.Hex(), PermissionReact))
+	require.NoError(t, err)
+	require.True(t, result.IsEntitled())
+	require.Equal(t, 1.0, testutil.ToFloat64(ca.isSpaceEnabledCacheHit))
+	require.Equal(t, 1.0, testutil.ToFloat64(ca.entitlementCacheHit))
+	require.Zero(t, testutil.ToFloat64(ca.entitlementCacheMiss))
+	require.Equal(t, 2, spaceContract.callCount("GetSpaceEntitlementsForPermission"))
+
+	// Warming is refused while chainAuth is read-only.
+	require.NoError(t, ca.SetReadOnly(time.Minute))
+	require.Error(t, ca.WarmSpace(ctx, cfg, testutils.FakeStreamId(shared.STREAM_SPACE_BIN), []Permission{PermissionRead}))
+	require.Equal(t, 1, spaceContract.callCount("IsSpaceDisabled"))
+}
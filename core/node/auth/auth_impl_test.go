@@ -0,0 +1,2297 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	ethTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/towns-protocol/towns/core/config"
+	"github.com/towns-protocol/towns/core/contracts/base"
+	"github.com/towns-protocol/towns/core/contracts/types"
+	. "github.com/towns-protocol/towns/core/node/base"
+	"github.com/towns-protocol/towns/core/node/base/test"
+	"github.com/towns-protocol/towns/core/node/crypto"
+	"github.com/towns-protocol/towns/core/node/infra"
+	. "github.com/towns-protocol/towns/core/node/protocol"
+	"github.com/towns-protocol/towns/core/node/shared"
+	"github.com/towns-protocol/towns/core/node/testutils"
+	"github.com/towns-protocol/towns/core/xchain/entitlement"
+)
+
+// fakeSpaceContract is an in-memory SpaceContract that counts the calls made against it.
+type fakeSpaceContract struct {
+	SpaceContract
+
+	mu           sync.Mutex
+	owner        common.Address
+	members      map[common.Address]bool
+	banned       map[common.Address]bool
+	entitlements []types.Entitlement
+	channels     []types.BaseChannel
+	// customEntitlements are the entitlements of app-defined permissions by name.
+	customEntitlements map[string][]types.Entitlement
+	// apps are the permissions of the apps installed in the space.
+	apps map[common.Address][]Permission
+	// batchMembership makes GetMembershipStatusBatch answer, it returns ErrMembershipBatchUnsupported otherwise.
+	batchMembership bool
+	calls           map[string]int
+}
+
+func newFakeSpaceContract(owner common.Address, entitled ...common.Address) *fakeSpaceContract {
+	members := map[common.Address]bool{owner: true}
+	for _, addr := range entitled {
+		members[addr] = true
+	}
+	return &fakeSpaceContract{
+		owner:   owner,
+		members: members,
+		banned:  map[common.Address]bool{},
+		entitlements: []types.Entitlement{
+			{
+				EntitlementType: types.ModuleTypeUserEntitlement,
+				UserEntitlement: entitled,
+			},
+		},
+		calls: map[string]int{},
+	}
+}
+
+func (sc *fakeSpaceContract) called(name string) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.calls[name]++
+}
+
+func (sc *fakeSpaceContract) callCount(name string) int {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	return sc.calls[name]
+}
+
+func (sc *fakeSpaceContract) IsSpaceDisabled(ctx context.Context, spaceId shared.StreamId) (bool, error) {
+	sc.called("IsSpaceDisabled")
+	return false, nil
+}
+
+func (sc *fakeSpaceContract) IsChannelDisabled(
+	ctx context.Context,
+	spaceId shared.StreamId,
+	channelId shared.StreamId,
+) (bool, error) {
+	sc.called("IsChannelDisabled")
+	return false, nil
+}
+
+func (sc *fakeSpaceContract) GetSpaceEntitlementsForPermission(
+	ctx context.Context,
+	spaceId shared.StreamId,
+	permission Permission,
+) ([]types.Entitlement, common.Address, error) {
+	sc.called("GetSpaceEntitlementsForPermission")
+	return sc.entitlements, sc.owner, nil
+}
+
+func (sc *fakeSpaceContract) GetChannelEntitlementsForPermission(
+	ctx context.Context,
+	spaceId shared.StreamId,
+	channelId shared.StreamId,
+	permission Permission,
+) ([]types.Entitlement, common.Address, error) {
+	sc.called("GetChannelEntitlementsForPermission")
+	return sc.entitlements, sc.owner, nil
+}
+
+func (sc *fakeSpaceContract) GetSpaceEntitlementsForCustomPermission(
+	ctx context.Context,
+	spaceId shared.StreamId,
+	permissionName string,
+) ([]types.Entitlement, common.Address, error) {
+	sc.called("GetSpaceEntitlementsForCustomPermission")
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	return sc.customEntitlements[permissionName], sc.owner, nil
+}
+
+func (sc *fakeSpaceContract) GetChannelEntitlementsForCustomPermission(
+	ctx context.Context,
+	spaceId shared.StreamId,
+	channelId shared.StreamId,
+	permissionName string,
+) ([]types.Entitlement, common.Address, error) {
+	sc.called("GetChannelEntitlementsForCustomPermission")
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	return sc.customEntitlements[permissionName], sc.owner, nil
+}
+
+func (sc *fakeSpaceContract) GetMembershipStatus(
+	ctx context.Context,
+	spaceId shared.StreamId,
+	user common.Address,
+) (*MembershipStatus, error) {
+	sc.called("GetMembershipStatus")
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	return &MembershipStatus{IsMember: sc.members[user], IsExpired: !sc.members[user]}, nil
+}
+
+func (sc *fakeSpaceContract) GetMembershipExpiry(
+	ctx context.Context,
+	spaceId shared.StreamId,
+	wallet common.Address,
+) (time.Time, error) {
+	status, err := sc.GetMembershipStatus(ctx, spaceId, wallet)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return membershipExpiry(status)
+}
+
+func (sc *fakeSpaceContract) GetMembershipStatusBatch(
+	ctx context.Context,
+	spaceId shared.StreamId,
+	wallets []common.Address,
+) ([]*MembershipStatus, error) {
+	if !sc.batchMembership {
+		return nil, ErrMembershipBatchUnsupported
+	}
+	sc.called("GetMembershipStatusBatch")
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	statuses := make([]*MembershipStatus, len(wallets))
+	for i, wallet := range wallets {
+		statuses[i] = &MembershipStatus{IsMember: sc.members[wallet], IsExpired: !sc.members[wallet]}
+	}
+	return statuses, nil
+}
+
+// ListSpaceMembers lists the members by address, a token per member.
+func (sc *fakeSpaceContract) ListSpaceMembers(
+	ctx context.Context,
+	spaceId shared.StreamId,
+	page int,
+	pageSize int,
+) ([]common.Address, error) {
+	sc.called("ListSpaceMembers")
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	var members []common.Address
+	for member, isMember := range sc.members {
+		if isMember {
+			members = append(members, member)
+		}
+	}
+	slices.SortFunc(members, func(a, b common.Address) int { return a.Cmp(b) })
+	start := page * pageSize
+	if page > 0 && start >= len(members) {
+		return nil, ErrNoMoreSpaceMembers
+	}
+	return members[min(start, len(members)):min(start+pageSize, len(members))], nil
+}
+
+func (sc *fakeSpaceContract) GetChannels(
+	ctx context.Context,
+	spaceId shared.StreamId,
+) ([]types.BaseChannel, error) {
+	sc.called("GetChannels")
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	return sc.channels, nil
+}
+
+func (sc *fakeSpaceContract) IsBanned(
+	ctx context.Context,
+	spaceId shared.StreamId,
+	linkedWallets []common.Address,
+) (bool, error) {
+	sc.called("IsBanned")
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	for _, wallet := range linkedWallets {
+		if sc.banned[wallet] {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (sc *fakeSpaceContract) IsAppEntitled(
+	ctx context.Context,
+	spaceId shared.StreamId,
+	app common.Address,
+	permission Permission,
+) (bool, bool, error) {
+	sc.called("IsAppEntitled")
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	permissions, installed := sc.apps[app]
+	return installed, slices.Contains(permissions, permission), nil
+}
+
+func (sc *fakeSpaceContract) GetBannedWallets(ctx context.Context, spaceId shared.StreamId) ([]common.Address, error) {
+	sc.called("GetBannedWallets")
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	var banned []common.Address
+	for wallet, isBanned := range sc.banned {
+		if isBanned {
+			banned = append(banned, wallet)
+		}
+	}
+	return banned, nil
+}
+
+func newTestChainAuth(t *testing.T, ctx context.Context, spaceContract SpaceContract) *chainAuth {
+	ca, err := newChainAuth(
+		ctx,
+		&crypto.Blockchain{Config: &config.ChainConfig{}},
+		nil,
+		spaceContract,
+		nil,
+		nil,
+		0,
+		0,
+		0,
+		0,
+		nil,
+		infra.NewMetricsFactory(prometheus.NewRegistry(), "", ""),
+	)
+	require.NoError(t, err)
+	return ca
+}
+
+func TestEntitlementManagerCacheSharedAcrossPrincipals(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	alice := common.HexToAddress("0xa11ce")
+	bob := common.HexToAddress("0xb0b")
+	spaceContract := newFakeSpaceContract(common.HexToAddress("0x0e"), alice, bob)
+	ca := newTestChainAuth(t, ctx, spaceContract)
+
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+	channelId := testutils.MakeChannelId(spaceId)
+
+	for _, principal := range []common.Address{alice, bob} {
+		result, err := ca.IsEntitled(ctx, cfg, NewChainAuthArgsForSpace(spaceId, principal.Hex(), PermissionWrite))
+		require.NoError(t, err)
+		require.True(t, result.IsEntitled())
+	}
+	require.Equal(t, 1, spaceContract.callCount("GetSpaceEntitlementsForPermission"))
+
+	for _, principal := range []common.Address{alice, bob} {
+		result, err := ca.IsEntitled(
+			ctx,
+			cfg,
+			NewChainAuthArgsForChannel(spaceId, channelId, principal.Hex(), PermissionWrite),
+		)
+		require.NoError(t, err)
+		require.True(t, result.IsEntitled())
+	}
+	require.Equal(t, 1, spaceContract.callCount("GetChannelEntitlementsForPermission"))
+
+	// Evaluation against the shared entitlements still happens per principal.
+	mallory := common.HexToAddress("0x3a11")
+	spaceContract.members[mallory] = true
+	result, err := ca.IsEntitled(ctx, cfg, NewChainAuthArgsForSpace(spaceId, mallory.Hex(), PermissionWrite))
+	require.NoError(t, err)
+	require.False(t, result.IsEntitled())
+	require.Equal(t, EntitlementResultReason_SPACE_ENTITLEMENTS, result.Reason())
+	require.Equal(t, 1, spaceContract.callCount("GetSpaceEntitlementsForPermission"))
+	// The wallets banned from the space are shared across principals as well.
+	require.Equal(t, 1, spaceContract.callCount("GetBannedWallets"))
+}
+
+func TestIsBanned(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	alice := common.HexToAddress("0xa11ce")
+	bob := common.HexToAddress("0xb0b")
+	spaceContract := newFakeSpaceContract(common.HexToAddress("0x0e"), alice, bob)
+	spaceContract.banned[bob] = true
+	ca := newTestChainAuth(t, ctx, spaceContract)
+
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+
+	banned, err := ca.IsBanned(ctx, cfg, spaceId, alice)
+	require.NoError(t, err)
+	require.False(t, banned)
+
+	banned, err = ca.IsBanned(ctx, cfg, spaceId, bob)
+	require.NoError(t, err)
+	require.True(t, banned)
+	// The ban list of the space is fetched once for both principals.
+	require.Equal(t, 1, spaceContract.callCount("GetBannedWallets"))
+
+	// Unbanned results are served from the cache.
+	banned, err = ca.IsBanned(ctx, cfg, spaceId, alice)
+	require.NoError(t, err)
+	require.False(t, banned)
+	require.Equal(t, 1, spaceContract.callCount("GetBannedWallets"))
+}
+
+func TestIsBannedLinkedWallet(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	rootKey := common.HexToAddress("0x1")
+	linked := common.HexToAddress("0x11")
+	banned := common.HexToAddress("0x12")
+	other := common.HexToAddress("0x2")
+	spaceContract := newFakeSpaceContract(common.HexToAddress("0x0e"), rootKey, other)
+	spaceContract.banned[banned] = true
+	ca := newTestChainAuth(t, ctx, spaceContract)
+	walletLink, err := base.NewWalletLink(common.HexToAddress("0xabc"), &fakeWalletLinkBackend{t: t})
+	require.NoError(t, err)
+	evaluator := &fakeLinkedWalletsEvaluator{wallets: map[common.Address][]common.Address{
+		rootKey: {rootKey, linked, banned},
+		other:   {other},
+	}}
+	ca.walletResolver = &WalletResolver{evaluator: evaluator, walletLink: walletLink}
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+
+	// The root key is banned through its linked wallet, the entitlement checks agree.
+	isBanned, err := ca.IsBanned(ctx, cfg, spaceId, rootKey)
+	require.NoError(t, err)
+	require.True(t, isBanned)
+	result, err := ca.IsEntitled(ctx, cfg, NewChainAuthArgsForSpace(spaceId, rootKey.Hex(), PermissionWrite))
+	require.NoError(t, err)
+	require.False(t, result.IsEntitled())
+	require.Equal(t, EntitlementResultReason_BANNED, result.Reason())
+
+	isBanned, err = ca.IsBanned(ctx, cfg, spaceId, other)
+	require.NoError(t, err)
+	require.False(t, isBanned)
+	result, err = ca.IsEntitled(ctx, cfg, NewChainAuthArgsForSpace(spaceId, other.Hex(), PermissionWrite))
+	require.NoError(t, err)
+	require.True(t, result.IsEntitled())
+
+	// Both checks share the ban list of the space.
+	require.Equal(t, 1, spaceContract.callCount("GetBannedWallets"))
+}
+
+func TestIsEntitledBannedReason(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	alice := common.HexToAddress("0xa11ce")
+	bob := common.HexToAddress("0xb0b")
+	spaceContract := newFakeSpaceContract(common.HexToAddress("0x0e"), alice, bob)
+	spaceContract.banned[bob] = true
+	ca := newTestChainAuth(t, ctx, spaceContract)
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+	channelId := testutils.MakeChannelId(spaceId)
+
+	// Bans are reported as such rather than as a lack of entitlements, even if another wallet is entitled.
+	for _, args := range []*ChainAuthArgs{
+		NewChainAuthArgsForSpaceWithWallets(spaceId, []common.Address{alice, bob}, PermissionWrite),
+		NewChainAuthArgsForChannelWithWallets(spaceId, channelId, []common.Address{alice, bob}, PermissionWrite),
+		NewChainAuthArgsForIsChannelModerator(spaceId, channelId, bob.Hex()),
+	} {
+		result, err := ca.IsEntitled(ctx, cfg, args)
+		require.NoError(t, err)
+		require.False(t, result.IsEntitled(), args)
+		require.Equal(t, EntitlementResultReason_BANNED, result.Reason(), args)
+	}
+
+	result, err := ca.IsEntitled(ctx, cfg, NewChainAuthArgsForSpace(spaceId, alice.Hex(), PermissionWrite))
+	require.NoError(t, err)
+	require.True(t, result.IsEntitled())
+}
+
+func TestForceRefresh(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	alice := common.HexToAddress("0xa11ce")
+	bob := common.HexToAddress("0xb0b")
+	spaceContract := newFakeSpaceContract(common.HexToAddress("0x0e"), alice, bob)
+	ca := newTestChainAuth(t, ctx, spaceContract)
+
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+	args := NewChainAuthArgsForSpace(spaceId, bob.Hex(), PermissionWrite)
+
+	result, err := ca.IsEntitled(ctx, cfg, args)
+	require.NoError(t, err)
+	require.True(t, result.IsEntitled())
+
+	// The ban is not visible until the cached allow expires.
+	spaceContract.mu.Lock()
+	spaceContract.banned[bob] = true
+	spaceContract.mu.Unlock()
+	result, err = ca.IsEntitled(ctx, cfg, args)
+	require.NoError(t, err)
+	require.True(t, result.IsEntitled())
+
+	// A forced check bypasses the cached allow and replaces it.
+	result, err = ca.IsEntitled(ctx, cfg, args.WithForceRefresh())
+	require.NoError(t, err)
+	require.False(t, result.IsEntitled())
+	require.False(t, args.forceRefresh)
+
+	calls := spaceContract.callCount("GetBannedWallets")
+	result, err = ca.IsEntitled(ctx, cfg, args)
+	require.NoError(t, err)
+	require.False(t, result.IsEntitled())
+	require.Equal(t, calls, spaceContract.callCount("GetBannedWallets"))
+
+	// Membership status works the same way.
+	memberArgs := NewChainAuthArgsForIsSpaceMember(spaceId, alice.Hex())
+	status, err := ca.GetMembershipStatus(ctx, cfg, spaceId, alice)
+	require.NoError(t, err)
+	require.True(t, status.IsMember)
+
+	spaceContract.mu.Lock()
+	spaceContract.members[alice] = false
+	spaceContract.mu.Unlock()
+	status, err = ca.GetMembershipStatus(ctx, cfg, spaceId, alice)
+	require.NoError(t, err)
+	require.True(t, status.IsMember)
+
+	status, err = ca.getMembershipStatus(ctx, cfg, memberArgs.WithForceRefresh())
+	require.NoError(t, err)
+	require.False(t, status.IsMember)
+
+	calls = spaceContract.callCount("GetMembershipStatus")
+	status, err = ca.GetMembershipStatus(ctx, cfg, spaceId, alice)
+	require.NoError(t, err)
+	require.False(t, status.IsMember)
+	require.Equal(t, calls, spaceContract.callCount("GetMembershipStatus"))
+}
+
+func TestCustomPermission(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	owner := common.HexToAddress("0x0e")
+	alice := common.HexToAddress("0xa11ce")
+	bob := common.HexToAddress("0xb0b")
+	spaceContract := newFakeSpaceContract(owner, alice, bob)
+	spaceContract.customEntitlements = map[string][]types.Entitlement{
+		"CAN_MINT_NFT": {{EntitlementType: types.ModuleTypeUserEntitlement, UserEntitlement: []common.Address{alice}}},
+	}
+	ca := newTestChainAuth(t, ctx, spaceContract)
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+	channelId := testutils.MakeChannelId(spaceId)
+
+	tests := []struct {
+		channelId shared.StreamId
+		user      common.Address
+		name      string
+		entitled  bool
+	}{
+		{shared.StreamId{}, alice, "CAN_MINT_NFT", true},
+		{shared.StreamId{}, bob, "CAN_MINT_NFT", false},
+		{shared.StreamId{}, alice, "CAN_BURN_NFT", false},
+		{shared.StreamId{}, owner, "CAN_BURN_NFT", true},
+		{channelId, alice, "CAN_MINT_NFT", true},
+		{channelId, bob, "CAN_MINT_NFT", false},
+	}
+	for _, tt := range tests {
+		result, err := ca.IsEntitled(
+			ctx, cfg, NewChainAuthArgsForCustomPermission(spaceId, tt.channelId, tt.user.Hex(), tt.name))
+		require.NoError(t, err)
+		require.Equal(t, tt.entitled, result.IsEntitled(), "%+v", tt)
+	}
+
+	require.Equal(t, 2, spaceContract.callCount("GetSpaceEntitlementsForCustomPermission"))
+	require.Equal(t, 1, spaceContract.callCount("GetChannelEntitlementsForCustomPermission"))
+	require.Zero(t, spaceContract.callCount("GetSpaceEntitlementsForPermission"))
+	require.Zero(t, spaceContract.callCount("GetChannelEntitlementsForPermission"))
+
+	// Custom permissions don't share cache entries with the built-in ones.
+	result, err := ca.IsEntitled(ctx, cfg, NewChainAuthArgsForSpace(spaceId, bob.Hex(), PermissionWrite))
+	require.NoError(t, err)
+	require.True(t, result.IsEntitled())
+
+	require.True(t, isContractRevert(fmt.Errorf("call: %w", fakeRevertError{})))
+	require.False(t, isContractRevert(errors.New("connection refused")))
+}
+
+// fakeRevertError is the error of a reverted contract call.
+type fakeRevertError struct{}
+
+func (fakeRevertError) Error() string          { return "execution reverted" }
+func (fakeRevertError) ErrorCode() int         { return 3 }
+func (fakeRevertError) ErrorData() interface{} { return "0x" }
+
+func TestGetChannelEntitlements(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	owner := common.HexToAddress("0x0e")
+	alice := common.HexToAddress("0xa11ce")
+	spaceContract := newFakeSpaceContract(owner, alice)
+	ca := newTestChainAuth(t, ctx, spaceContract)
+
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+	channelId := testutils.MakeChannelId(spaceId)
+
+	entitlements, entitlementsOwner, err := ca.GetChannelEntitlements(ctx, cfg, spaceId, channelId, PermissionWrite)
+	require.NoError(t, err)
+	require.Equal(t, spaceContract.entitlements, entitlements)
+	require.Equal(t, owner, entitlementsOwner)
+	require.Equal(t, 1, spaceContract.callCount("GetChannelEntitlementsForPermission"))
+	require.Equal(t, float64(1), testutil.ToFloat64(ca.entitlementManagerCacheMiss))
+	require.Zero(t, testutil.ToFloat64(ca.entitlementCacheMiss))
+
+	// Entitlement checks for the channel share the cached entitlements.
+	result, err := ca.IsEntitled(
+		ctx,
+		cfg,
+		NewChainAuthArgsForChannel(spaceId, channelId, alice.Hex(), PermissionWrite),
+	)
+	require.NoError(t, err)
+	require.True(t, result.IsEntitled())
+	require.Equal(t, 1, spaceContract.callCount("GetChannelEntitlementsForPermission"))
+
+	// Entitlements are cached per permission.
+	_, _, err = ca.GetChannelEntitlements(ctx, cfg, spaceId, channelId, PermissionRead)
+	require.NoError(t, err)
+	require.Equal(t, 2, spaceContract.callCount("GetChannelEntitlementsForPermission"))
+
+	// Lookups of cached entitlements are counted as hits of the entitlement manager cache.
+	_, _, err = ca.GetChannelEntitlements(ctx, cfg, spaceId, channelId, PermissionRead)
+	require.NoError(t, err)
+	require.Equal(t, float64(1), testutil.ToFloat64(ca.entitlementManagerCacheHit))
+}
+
+func TestChannelOpenToEveryone(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	alice := common.HexToAddress("0xa11ce")
+	bob := common.HexToAddress("0xb0b")
+	stranger := common.HexToAddress("0x5")
+	spaceContract := newFakeSpaceContract(common.HexToAddress("0x0e"), alice, bob)
+	spaceContract.banned[bob] = true
+	// The rule entitlement can't be evaluated without an evaluator, it must be skipped.
+	spaceContract.entitlements = []types.Entitlement{
+		{
+			EntitlementType:   types.ModuleTypeRuleEntitlementV2,
+			RuleEntitlementV2: &base.IRuleEntitlementBaseRuleDataV2{},
+		},
+		{
+			EntitlementType: types.ModuleTypeUserEntitlement,
+			UserEntitlement: []common.Address{everyone},
+		},
+	}
+	ca := newTestChainAuth(t, ctx, spaceContract)
+
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+	channelId := testutils.MakeChannelId(spaceId)
+	for _, tc := range []struct {
+		principal common.Address
+		entitled  bool
+		reason    EntitlementResultReason
+	}{
+		{alice, true, EntitlementResultReason_NONE},
+		{bob, false, EntitlementResultReason_BANNED},
+		{stranger, false, EntitlementResultReason_MEMBERSHIP},
+	} {
+		result, err := ca.IsEntitled(
+			ctx,
+			cfg,
+			NewChainAuthArgsForChannel(spaceId, channelId, tc.principal.Hex(), PermissionWrite),
+		)
+		require.NoError(t, err)
+		require.Equal(t, tc.entitled, result.IsEntitled(), tc)
+		require.Equal(t, tc.reason, result.Reason(), tc)
+	}
+	require.Equal(t, 1, spaceContract.callCount("GetChannelEntitlementsForPermission"))
+}
+
+// permissionRecordingSpaceContract records the permissions the channel entitlements are read for.
+type permissionRecordingSpaceContract struct {
+	*fakeSpaceContract
+
+	permissions []Permission
+}
+
+func (sc *permissionRecordingSpaceContract) GetChannelEntitlementsForPermission(
+	ctx context.Context,
+	spaceId shared.StreamId,
+	channelId shared.StreamId,
+	permission Permission,
+) ([]types.Entitlement, common.Address, error) {
+	sc.permissions = append(sc.permissions, permission)
+	return sc.fakeSpaceContract.GetChannelEntitlementsForPermission(ctx, spaceId, channelId, permission)
+}
+
+func TestIsChannelModerator(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	alice := common.HexToAddress("0xa11ce")
+	bob := common.HexToAddress("0xb0b")
+	stranger := common.HexToAddress("0x5")
+	spaceContract := &permissionRecordingSpaceContract{
+		fakeSpaceContract: newFakeSpaceContract(common.HexToAddress("0x0e"), alice),
+	}
+	spaceContract.members[bob] = true
+	ca := newTestChainAuth(t, ctx, spaceContract)
+
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+	channelId := testutils.MakeChannelId(spaceId)
+	for _, tc := range []struct {
+		principal common.Address
+		entitled  bool
+		reason    EntitlementResultReason
+	}{
+		{alice, true, EntitlementResultReason_NONE},
+		{bob, false, EntitlementResultReason_NOT_MODERATOR},
+		{stranger, false, EntitlementResultReason_MEMBERSHIP},
+	} {
+		args := NewChainAuthArgsForIsChannelModerator(spaceId, channelId, tc.principal.Hex())
+		result, err := ca.IsEntitled(ctx, cfg, args)
+		require.NoError(t, err)
+		require.Equal(t, tc.entitled, result.IsEntitled(), tc)
+		require.Equal(t, tc.reason, result.Reason(), tc)
+
+		explanation, err := ca.ExplainEntitlement(ctx, cfg, args, ExplainOpts{Cached: true})
+		require.NoError(t, err)
+		require.Equal(t, tc.entitled, explanation.Allowed, tc)
+		require.Equal(t, tc.reason, explanation.Reason, tc)
+	}
+	require.Equal(t, []Permission{PermissionModifyChannel}, spaceContract.permissions)
+
+	// The channel check of the permission shares the cached channel results and reports its own reason.
+	result, err := ca.IsEntitled(
+		ctx,
+		cfg,
+		NewChainAuthArgsForChannel(spaceId, channelId, bob.Hex(), PermissionModifyChannel),
+	)
+	require.NoError(t, err)
+	require.False(t, result.IsEntitled())
+	require.Equal(t, EntitlementResultReason_CHANNEL_ENTITLEMENTS, result.Reason())
+	require.Len(t, spaceContract.permissions, 1)
+}
+
+func TestGetSpaceOwner(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	owner := common.HexToAddress("0x0e")
+	alice := common.HexToAddress("0xa11ce")
+	spaceContract := newFakeSpaceContract(owner, alice)
+	ca := newTestChainAuth(t, ctx, spaceContract)
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+
+	// The owner is served from the entitlements cached by the Read check.
+	result, err := ca.IsEntitled(ctx, cfg, NewChainAuthArgsForSpace(spaceId, alice.Hex(), PermissionRead))
+	require.NoError(t, err)
+	require.True(t, result.IsEntitled())
+	require.Equal(t, 1, spaceContract.callCount("GetSpaceEntitlementsForPermission"))
+
+	spaceOwner, err := ca.GetSpaceOwner(ctx, cfg, spaceId)
+	require.NoError(t, err)
+	require.Equal(t, owner, spaceOwner)
+	require.Equal(t, 1, spaceContract.callCount("GetSpaceEntitlementsForPermission"))
+
+	// The owner of a space that wasn't checked yet is fetched once.
+	otherSpaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+	for range 2 {
+		spaceOwner, err = ca.GetSpaceOwner(ctx, cfg, otherSpaceId)
+		require.NoError(t, err)
+		require.Equal(t, owner, spaceOwner)
+	}
+	require.Equal(t, 2, spaceContract.callCount("GetSpaceEntitlementsForPermission"))
+}
+
+func TestIsSpaceGated(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	alice := common.HexToAddress("0xa11ce")
+	bob := common.HexToAddress("0xb0b")
+	spaceContract := newFakeSpaceContract(common.HexToAddress("0x0e"))
+	spaceContract.members[alice] = true
+	ca := newTestChainAuth(t, ctx, spaceContract)
+	users := func(users ...common.Address) types.Entitlement {
+		return types.Entitlement{EntitlementType: types.ModuleTypeUserEntitlement, UserEntitlement: users}
+	}
+	rule := types.Entitlement{EntitlementType: types.ModuleTypeRuleEntitlementV2}
+
+	for name, tc := range map[string]struct {
+		entitlements []types.Entitlement
+		gated        bool
+	}{
+		"everyone":               {[]types.Entitlement{users(everyone)}, false},
+		"everyone and users":     {[]types.Entitlement{users(bob), users(everyone)}, false},
+		"users":                  {[]types.Entitlement{users(bob)}, true},
+		"everyone and rule":      {[]types.Entitlement{users(everyone), rule}, true},
+		"rule":                   {[]types.Entitlement{rule}, true},
+		"no entitlements at all": {nil, true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			spaceContract.mu.Lock()
+			spaceContract.entitlements = tc.entitlements
+			spaceContract.mu.Unlock()
+
+			gated, err := ca.IsSpaceGated(ctx, cfg, testutils.FakeStreamId(shared.STREAM_SPACE_BIN), PermissionRead)
+			require.NoError(t, err)
+			require.Equal(t, tc.gated, gated)
+		})
+	}
+
+	// The entitlements fetched for the query are shared with the entitlement checks.
+	spaceContract.mu.Lock()
+	spaceContract.entitlements = []types.Entitlement{users(everyone)}
+	spaceContract.mu.Unlock()
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+	calls := spaceContract.callCount("GetSpaceEntitlementsForPermission")
+
+	gated, err := ca.IsSpaceGated(ctx, cfg, spaceId, PermissionRead)
+	require.NoError(t, err)
+	require.False(t, gated)
+	result, err := ca.IsEntitled(ctx, cfg, NewChainAuthArgsForSpace(spaceId, alice.Hex(), PermissionRead))
+	require.NoError(t, err)
+	require.True(t, result.IsEntitled())
+	require.Equal(t, calls+1, spaceContract.callCount("GetSpaceEntitlementsForPermission"))
+}
+
+func TestWalletSetDigest(t *testing.T) {
+	a := common.HexToAddress("0x1111111111111111111111111111111111111111")
+	b := common.HexToAddress("0x2222222222222222222222222222222222222222")
+	c := common.HexToAddress("0xaBcDef0123456789aBcDeF0123456789AbCdEf01")
+
+	// Golden values lock the digest algorithm, external systems recompute and compare them.
+	tests := []struct {
+		wallets []common.Address
+		digest  string
+	}{
+		{nil, "0xc5d2460186f7233c927e7db2dcc703c0e500b653ca82273b7bfad8045d85a470"},
+		{[]common.Address{a}, "0xe2c07404b8c1df4c46226425cac68c28d27a766bbddce62309f36724839b22c0"},
+		{[]common.Address{a, b, c}, "0x4bb39afdcf200123a39c9dae64144f6172d1055e84aa5304a6ddc926df35f87d"},
+		{[]common.Address{c, b, a}, "0x4bb39afdcf200123a39c9dae64144f6172d1055e84aa5304a6ddc926df35f87d"},
+		{[]common.Address{b, c, a, c, b}, "0x4bb39afdcf200123a39c9dae64144f6172d1055e84aa5304a6ddc926df35f87d"},
+	}
+	for _, tc := range tests {
+		require.Equal(t, tc.digest, WalletSetDigest(tc.wallets).Hex(), "wallets: %v", tc.wallets)
+	}
+
+	// The input is not modified.
+	wallets := []common.Address{c, b, a}
+	WalletSetDigest(wallets)
+	require.Equal(t, []common.Address{c, b, a}, wallets)
+}
+
+func TestIsEntitledResultWalletSetDigest(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	alice := common.HexToAddress("0xa11ce")
+	ca := newTestChainAuth(t, ctx, newFakeSpaceContract(common.HexToAddress("0x0e"), alice))
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+
+	// Without a wallet link contract the root key is the only wallet.
+	for range 2 {
+		result, err := ca.IsEntitled(ctx, cfg, NewChainAuthArgsForSpace(spaceId, alice.Hex(), PermissionWrite))
+		require.NoError(t, err)
+		require.True(t, result.IsEntitled())
+		require.Equal(t, WalletSetDigest([]common.Address{alice}), DetailsOf(result).WalletSetDigest)
+	}
+}
+
+// legacyResult implements IsEntitledResult like the mocks written before the details of the results moved to
+// ResultDetails.
+type legacyResult struct{}
+
+func (legacyResult) IsEntitled() bool                    { return true }
+func (legacyResult) Reason() EntitlementResultReason     { return EntitlementResultReason_NONE }
+func (legacyResult) WalletSetDigest() common.Hash        { return common.HexToHash("0x1") }
+func (legacyResult) CachedAt() time.Time                 { return time.Now() }
+func (legacyResult) FromCache() bool                     { return true }
+func (legacyResult) ReasonChain() []ReasonChainStep      { return nil }
+func (legacyResult) RuleDenial() *entitlement.RuleDenial { return nil }
+func (legacyResult) BaseChainOnlyWallets() bool          { return false }
+func (legacyResult) SatisfiedBy() common.Address         { return common.Address{} }
+func (legacyResult) ValidUntil() time.Time               { return time.Time{} }
+
+var (
+	_ IsEntitledResult = legacyResult{}
+	_ DetailedResult   = (*isEntitledResult)(nil)
+)
+
+func TestDetailsOf(t *testing.T) {
+	// Results that don't report their details have zero details.
+	require.Equal(t, ResultDetails{}, DetailsOf(legacyResult{}))
+	require.Equal(t, ResultDetails{}, DetailsOf((*isEntitledResult)(nil)))
+
+	allowed := &isEntitledResult{
+		isAllowed:   true,
+		fromCache:   true,
+		satisfiedBy: common.HexToAddress("0xa11ce"),
+		ruleDenial:  &entitlement.RuleDenial{},
+	}
+	details := DetailsOf(allowed)
+	require.True(t, details.FromCache)
+	require.Equal(t, common.HexToAddress("0xa11ce"), details.SatisfiedBy)
+	require.Nil(t, details.RuleDenial)
+
+	denied := &isEntitledResult{reason: EntitlementResultReason_SPACE_ENTITLEMENTS, ruleDenial: &entitlement.RuleDenial{}}
+	require.NotNil(t, DetailsOf(denied).RuleDenial)
+}
+
+func TestIsEntitledResultCacheProvenance(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	alice := common.HexToAddress("0xa11ce")
+	bob := common.HexToAddress("0xb0b")
+	ca := newTestChainAuth(t, ctx, newFakeSpaceContract(common.HexToAddress("0x0e"), alice, bob))
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+
+	start := time.Now()
+	result, err := ca.IsEntitled(ctx, cfg, NewChainAuthArgsForSpace(spaceId, alice.Hex(), PermissionWrite))
+	require.NoError(t, err)
+	require.True(t, result.IsEntitled())
+	require.False(t, DetailsOf(result).FromCache)
+	require.False(t, DetailsOf(result).CachedAt.Before(start))
+	firstCachedAt := DetailsOf(result).CachedAt
+
+	time.Sleep(10 * time.Millisecond)
+
+	// An identical check is served from the cache.
+	result, err = ca.IsEntitled(ctx, cfg, NewChainAuthArgsForSpace(spaceId, alice.Hex(), PermissionWrite))
+	require.NoError(t, err)
+	require.True(t, result.IsEntitled())
+	require.True(t, DetailsOf(result).FromCache)
+	require.Equal(t, firstCachedAt, DetailsOf(result).CachedAt)
+	require.Greater(t, time.Since(DetailsOf(result).CachedAt), 10*time.Millisecond)
+
+	// The check of another user is evaluated with the cached space entitlements and reports their age.
+	result, err = ca.IsEntitled(ctx, cfg, NewChainAuthArgsForSpace(spaceId, bob.Hex(), PermissionWrite))
+	require.NoError(t, err)
+	require.True(t, result.IsEntitled())
+	require.True(t, DetailsOf(result).FromCache)
+	require.True(t, DetailsOf(result).CachedAt.Before(firstCachedAt))
+
+	// Forced checks are fresh.
+	start = time.Now()
+	result, err = ca.IsEntitled(
+		ctx, cfg, NewChainAuthArgsForSpace(spaceId, bob.Hex(), PermissionWrite).WithForceRefresh())
+	require.NoError(t, err)
+	require.False(t, DetailsOf(result).FromCache)
+	require.False(t, DetailsOf(result).CachedAt.Before(start))
+}
+
+func TestIsEntitledWithPreFetchedWallets(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	rootKey := common.HexToAddress("0x5007")
+	linked := common.HexToAddress("0x11e4")
+	spaceContract := newFakeSpaceContract(common.HexToAddress("0x0e"), linked)
+	ca := newTestChainAuth(t, ctx, spaceContract)
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+
+	// The root key alone is not a member, the pre-fetched linked wallet is.
+	result, err := ca.IsEntitled(ctx, cfg, NewChainAuthArgsForIsSpaceMember(spaceId, rootKey.Hex()))
+	require.NoError(t, err)
+	require.False(t, result.IsEntitled())
+
+	result, err = ca.IsEntitled(
+		ctx,
+		cfg,
+		NewChainAuthArgsForIsSpaceMemberV2(spaceId, rootKey.Hex(), []common.Address{rootKey, linked}),
+	)
+	require.NoError(t, err)
+	require.True(t, result.IsEntitled())
+	require.Equal(t, WalletSetDigest([]common.Address{rootKey, linked}), DetailsOf(result).WalletSetDigest)
+
+	require.Zero(t, testutil.ToFloat64(ca.linkedWalletCacheHit)+testutil.ToFloat64(ca.linkedWalletCacheMiss))
+}
+
+func TestIsEntitledWithSuppliedWallets(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	alice := common.HexToAddress("0xa11ce")
+	bob := common.HexToAddress("0xb0b")
+	spaceContract := newFakeSpaceContract(common.HexToAddress("0x0e"), alice)
+	ca := newTestChainAuth(t, ctx, spaceContract)
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+	channelId := testutils.FakeStreamId(shared.STREAM_CHANNEL_BIN)
+
+	result, err := ca.IsEntitled(
+		ctx,
+		cfg,
+		NewChainAuthArgsForSpaceWithWallets(spaceId, []common.Address{bob, alice}, PermissionWrite),
+	)
+	require.NoError(t, err)
+	require.True(t, result.IsEntitled())
+
+	result, err = ca.IsEntitled(
+		ctx,
+		cfg,
+		NewChainAuthArgsForChannelWithWallets(spaceId, channelId, []common.Address{bob}, PermissionWrite),
+	)
+	require.NoError(t, err)
+	require.False(t, result.IsEntitled())
+
+	// An empty wallet set is not entitled to anything.
+	result, err = ca.IsEntitled(ctx, cfg, NewChainAuthArgsForSpaceWithWallets(spaceId, nil, PermissionRead))
+	require.NoError(t, err)
+	require.False(t, result.IsEntitled())
+
+	require.Zero(t, testutil.ToFloat64(ca.linkedWalletCacheHit)+testutil.ToFloat64(ca.linkedWalletCacheMiss))
+
+	// Supplied wallet sets are subject to the linked wallets limit.
+	wallets := make([]common.Address, ca.linkedWalletsLimit.get()+1)
+	for i := range wallets {
+		wallets[i] = common.BytesToAddress([]byte{0x20, byte(i)})
+	}
+	_, err = ca.IsEntitled(ctx, cfg, NewChainAuthArgsForSpaceWithWallets(spaceId, wallets, PermissionRead))
+	require.Error(t, err)
+}
+
+func TestIsEntitledResultSatisfiedBy(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	owner := common.HexToAddress("0x0e")
+	alice := common.HexToAddress("0xa11ce")
+	bob := common.HexToAddress("0xb0b")
+	carol := common.HexToAddress("0xca201")
+	ca := newTestChainAuth(t, ctx, newFakeSpaceContract(owner, alice))
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+
+	// The second linked wallet is the entitled one.
+	args := NewChainAuthArgsForSpaceWithWallets(spaceId, []common.Address{bob, alice}, PermissionWrite)
+	result, err := ca.IsEntitled(ctx, cfg, args)
+	require.NoError(t, err)
+	require.True(t, result.IsEntitled())
+	require.False(t, DetailsOf(result).FromCache)
+	require.Equal(t, alice, DetailsOf(result).SatisfiedBy)
+
+	// The wallet survives the cache.
+	result, err = ca.IsEntitled(ctx, cfg, args)
+	require.NoError(t, err)
+	require.True(t, DetailsOf(result).FromCache)
+	require.Equal(t, alice, DetailsOf(result).SatisfiedBy)
+
+	// The owner is entitled regardless of the entitlements.
+	result, err = ca.IsEntitled(
+		ctx,
+		cfg,
+		NewChainAuthArgsForSpaceWithWallets(spaceId, []common.Address{carol, owner}, PermissionWrite),
+	)
+	require.NoError(t, err)
+	require.True(t, result.IsEntitled())
+	require.Equal(t, owner, DetailsOf(result).SatisfiedBy)
+
+	// Denials are not satisfied by any wallet.
+	result, err = ca.IsEntitled(
+		ctx,
+		cfg,
+		NewChainAuthArgsForSpaceWithWallets(spaceId, []common.Address{bob, carol}, PermissionWrite),
+	)
+	require.NoError(t, err)
+	require.False(t, result.IsEntitled())
+	require.Equal(t, common.Address{}, DetailsOf(result).SatisfiedBy)
+}
+
+func TestIsEntitledApp(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	installed := common.HexToAddress("0xa991")
+	readOnly := common.HexToAddress("0xa992")
+	stranger := common.HexToAddress("0xa993")
+	spaceContract := newFakeSpaceContract(common.HexToAddress("0x0e"))
+	spaceContract.apps = map[common.Address][]Permission{
+		installed: {PermissionRead, PermissionWrite},
+		readOnly:  {PermissionRead},
+	}
+	ca := newTestChainAuth(t, ctx, spaceContract)
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+	channelId := testutils.MakeChannelId(spaceId)
+
+	for name, tc := range map[string]struct {
+		args    *ChainAuthArgs
+		allowed bool
+		reason  EntitlementResultReason
+	}{
+		"installed and entitled": {
+			NewChainAuthArgsForApp(spaceId, shared.StreamId{}, installed, PermissionWrite),
+			true,
+			EntitlementResultReason_NONE,
+		},
+		"installed and entitled in channel": {
+			NewChainAuthArgsForApp(spaceId, channelId, installed, PermissionWrite),
+			true,
+			EntitlementResultReason_NONE,
+		},
+		"installed but not entitled": {
+			NewChainAuthArgsForApp(spaceId, shared.StreamId{}, readOnly, PermissionWrite),
+			false,
+			EntitlementResultReason_SPACE_ENTITLEMENTS,
+		},
+		"installed but not entitled in channel": {
+			NewChainAuthArgsForApp(spaceId, channelId, readOnly, PermissionWrite),
+			false,
+			EntitlementResultReason_CHANNEL_ENTITLEMENTS,
+		},
+		"not installed": {
+			NewChainAuthArgsForApp(spaceId, shared.StreamId{}, stranger, PermissionRead),
+			false,
+			EntitlementResultReason_APP_NOT_INSTALLED,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			result, err := ca.IsEntitled(ctx, cfg, tc.args)
+			require.NoError(t, err)
+			require.Equal(t, tc.allowed, result.IsEntitled())
+			require.Equal(t, tc.reason, result.Reason())
+			if tc.allowed {
+				require.Equal(t, tc.args.principal, DetailsOf(result).SatisfiedBy)
+			}
+
+			// The result is served from the cache of the checks of apps.
+			result, err = ca.IsEntitled(ctx, cfg, tc.args)
+			require.NoError(t, err)
+			require.True(t, DetailsOf(result).FromCache)
+			require.Equal(t, tc.reason, result.Reason())
+		})
+	}
+
+	// Apps skip the wallet links and the membership of the space, their results are cached apart from those of
+	// users.
+	require.Equal(t, 5, spaceContract.callCount("IsAppEntitled"))
+	require.Zero(t, spaceContract.callCount("GetMembershipStatus"))
+	require.Zero(t, ca.linkedWalletCache.positiveCache.Len()+ca.linkedWalletCache.negativeCache.Len())
+	require.Equal(t, 2, ca.appCache.positiveCache.Len())
+	require.Equal(t, 3, ca.appCache.negativeCache.Len())
+	require.Equal(t, 5.0, testutil.ToFloat64(ca.cacheCounters.WithLabelValues("app", "hit", "NONE"))+
+		testutil.ToFloat64(ca.cacheCounters.WithLabelValues("app", "hit", "SPACE_ENTITLEMENTS"))+
+		testutil.ToFloat64(ca.cacheCounters.WithLabelValues("app", "hit", "CHANNEL_ENTITLEMENTS"))+
+		testutil.ToFloat64(ca.cacheCounters.WithLabelValues("app", "hit", "APP_NOT_INSTALLED")))
+}
+
+func TestLinkedWalletsLimitLoweredAndRaised(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	alice := common.HexToAddress("0xa11ce")
+	spaceContract := newFakeSpaceContract(common.HexToAddress("0x0e"), alice)
+	ca := newTestChainAuth(t, ctx, spaceContract)
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+	otherSpaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+
+	wallets := []common.Address{alice}
+	for i := range 3 {
+		wallets = append(wallets, common.BytesToAddress([]byte{0x30, byte(i)}))
+	}
+	args := func(spaceId shared.StreamId) *ChainAuthArgs {
+		return NewChainAuthArgsForSpace(spaceId, alice.Hex(), PermissionWrite).WithPreFetchedWallets(wallets)
+	}
+
+	ca.SetLinkedWalletsLimit(5)
+	result, err := ca.IsEntitled(ctx, cfg, args(spaceId))
+	require.NoError(t, err)
+	require.True(t, result.IsEntitled())
+
+	// Lowering the limit below the number of wallets keeps the cached allow until it expires.
+	ca.SetLinkedWalletsLimit(2)
+	result, err = ca.IsEntitled(ctx, cfg, args(spaceId))
+	require.NoError(t, err)
+	require.True(t, result.IsEntitled())
+	require.Zero(t, testutil.ToFloat64(ca.linkedWalletsLimit.gauge))
+
+	// New evaluations enforce the new limit.
+	_, err = ca.IsEntitled(ctx, cfg, args(otherSpaceId))
+	require.Equal(t, Err_LINKED_WALLETS_LIMIT_EXCEEDED, AsRiverError(err).Code)
+	require.Equal(t, 1.0, testutil.ToFloat64(ca.linkedWalletsLimit.gauge))
+
+	ca.entitlementCache.bust(args(spaceId))
+	_, err = ca.IsEntitled(ctx, cfg, args(spaceId))
+	require.Equal(t, Err_LINKED_WALLETS_LIMIT_EXCEEDED, AsRiverError(err).Code)
+	require.Equal(t, 1.0, testutil.ToFloat64(ca.linkedWalletsLimit.gauge))
+
+	// Denials caused by the limit are not cached, raising it takes effect right away.
+	ca.SetLinkedWalletsLimit(4)
+	require.Zero(t, testutil.ToFloat64(ca.linkedWalletsLimit.gauge))
+	for _, spaceId := range []shared.StreamId{spaceId, otherSpaceId} {
+		result, err = ca.IsEntitled(ctx, cfg, args(spaceId))
+		require.NoError(t, err)
+		require.True(t, result.IsEntitled())
+	}
+	require.Zero(t, testutil.ToFloat64(ca.linkedWalletsLimit.gauge))
+}
+
+func TestLinkedWalletsLimitByPermission(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	alice := common.HexToAddress("0xa11ce")
+	ca, err := newChainAuth(
+		ctx,
+		&crypto.Blockchain{Config: &config.ChainConfig{}},
+		nil,
+		newFakeSpaceContract(common.HexToAddress("0x0e"), alice),
+		nil,
+		nil,
+		4,
+		0,
+		0,
+		0,
+		nil,
+		infra.NewMetricsFactory(prometheus.NewRegistry(), "", ""),
+		WithLinkedWalletsLimitByPermission(map[string]int{"ModifySpaceSettings": 2, "read": 3}),
+	)
+	require.NoError(t, err)
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+
+	wallets := []common.Address{alice}
+	for i := range 2 {
+		wallets = append(wallets, common.BytesToAddress([]byte{0x50, byte(i)}))
+	}
+	check := func(args *ChainAuthArgs) error {
+		result, err := ca.IsEntitled(ctx, cfg, args.WithPreFetchedWallets(wallets))
+		if err == nil {
+			require.True(t, result.IsEntitled())
+		}
+		return err
+	}
+
+	// Permissions without a limit of their own get the global limit.
+	require.NoError(t, check(NewChainAuthArgsForSpace(spaceId, alice.Hex(), PermissionWrite)))
+	require.NoError(t, check(NewChainAuthArgsForSpace(spaceId, alice.Hex(), PermissionRead)))
+	err = check(NewChainAuthArgsForSpace(spaceId, alice.Hex(), PermissionModifySpaceSettings))
+	require.Equal(t, Err_LINKED_WALLETS_LIMIT_EXCEEDED, AsRiverError(err).Code)
+
+	// Checks of several permissions get the lowest limit.
+	err = check(NewChainAuthArgsForSpace(spaceId, alice.Hex(), PermissionRead).
+		WithPermissions(RequireAny, PermissionRead, PermissionModifySpaceSettings))
+	require.Equal(t, Err_LINKED_WALLETS_LIMIT_EXCEEDED, AsRiverError(err).Code)
+
+	// The global limit can still be lowered at runtime.
+	ca.SetLinkedWalletsLimit(2)
+	otherSpaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+	err = check(NewChainAuthArgsForSpace(otherSpaceId, alice.Hex(), PermissionWrite))
+	require.Equal(t, Err_LINKED_WALLETS_LIMIT_EXCEEDED, AsRiverError(err).Code)
+
+	for _, limits := range []map[string]int{{"NoSuchPermission": 1}, {"Read": 0}} {
+		_, err := parseLinkedWalletsLimitByPermission(limits)
+		require.Equal(t, Err_BAD_CONFIG, AsRiverError(err).Code)
+	}
+}
+
+func TestLinkedWalletsLimitByPermissionRaisesLimit(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	rootKey := common.HexToAddress("0x1")
+	wallets := []common.Address{rootKey}
+	for i := range 3 {
+		wallets = append(wallets, common.BytesToAddress([]byte{0x60, byte(i)}))
+	}
+	ca, err := newChainAuth(
+		ctx,
+		&crypto.Blockchain{Config: &config.ChainConfig{}},
+		nil,
+		newFakeSpaceContract(common.HexToAddress("0x0e"), wallets[3]),
+		nil,
+		nil,
+		2,
+		0,
+		0,
+		0,
+		nil,
+		infra.NewMetricsFactory(prometheus.NewRegistry(), "", ""),
+		WithLinkedWalletsLimitByPermission(map[string]int{"ModifySpaceSettings": 4}),
+	)
+	require.NoError(t, err)
+	walletLink, err := base.NewWalletLink(
+		common.HexToAddress("0xabc"),
+		&fakeWalletLinkBackend{t: t, walletsByRootKey: map[common.Address][]common.Address{rootKey: wallets[1:]}},
+	)
+	require.NoError(t, err)
+	evaluator := &fakeLinkedWalletsEvaluator{wallets: map[common.Address][]common.Address{rootKey: wallets}}
+	ca.walletResolver = &WalletResolver{evaluator: evaluator, walletLink: walletLink}
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+
+	// The wallets are looked up up to the highest limit, the override above the global limit applies.
+	result, err := ca.IsEntitled(ctx, cfg, NewChainAuthArgsForSpace(spaceId, rootKey.Hex(), PermissionModifySpaceSettings))
+	require.NoError(t, err)
+	require.True(t, result.IsEntitled())
+	require.Equal(t, 4, evaluator.maxWallets)
+
+	// Permissions without a limit of their own are still evaluated against the global limit.
+	_, err = ca.IsEntitled(ctx, cfg, NewChainAuthArgsForSpace(spaceId, rootKey.Hex(), PermissionWrite))
+	require.Equal(t, Err_LINKED_WALLETS_LIMIT_EXCEEDED, AsRiverError(err).Code)
+}
+
+func TestLinkedWalletsLookupStopsAtLimit(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	rootKey := common.HexToAddress("0x1")
+	wallets := []common.Address{rootKey}
+	for i := range 4 {
+		wallets = append(wallets, common.BytesToAddress([]byte{0x40, byte(i)}))
+	}
+	ca := newTestChainAuth(t, ctx, newFakeSpaceContract(common.HexToAddress("0x0e")))
+	walletLink, err := base.NewWalletLink(
+		common.HexToAddress("0xabc"),
+		&fakeWalletLinkBackend{t: t, walletsByRootKey: map[common.Address][]common.Address{rootKey: wallets[1:]}},
+	)
+	require.NoError(t, err)
+	evaluator := &fakeLinkedWalletsEvaluator{wallets: map[common.Address][]common.Address{rootKey: wallets}}
+	ca.walletResolver = &WalletResolver{evaluator: evaluator, walletLink: walletLink}
+	args := NewChainAuthArgsForIsWalletLinked(rootKey.Bytes(), wallets[4].Bytes())
+
+	// Checking whether a wallet is linked doesn't evaluate the wallets against the limit, the lookup stops at it.
+	ca.SetLinkedWalletsLimit(3)
+	_, err = ca.IsEntitled(ctx, cfg, args)
+	require.Equal(t, Err_LINKED_WALLETS_LIMIT_EXCEEDED, AsRiverError(err).Code)
+	require.Equal(t, 3, evaluator.maxWallets)
+	require.Equal(t, 1.0, testutil.ToFloat64(ca.linkedWalletsLimit.gauge))
+
+	ca.SetLinkedWalletsLimit(5)
+	result, err := ca.IsEntitled(ctx, cfg, args)
+	require.NoError(t, err)
+	require.True(t, result.IsEntitled())
+
+	// The wallets read from the base chain stop at the limit as well, the root key counts as a wallet.
+	_, err = ca.walletResolver.BaseChainLinkedWallets(ctx, rootKey, 4)
+	require.ErrorIs(t, err, entitlement.ErrTooManyLinkedWallets)
+	baseChainWallets, err := ca.walletResolver.BaseChainLinkedWallets(ctx, rootKey, 5)
+	require.NoError(t, err)
+	require.ElementsMatch(t, wallets, baseChainWallets)
+}
+
+func TestVerifiedJoinBustsMembershipCache(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	membershipAbi, err := base.MembershipMetaData.GetAbi()
+	require.NoError(t, err)
+	require.Equal(t, membershipAbi.Events["MembershipTokenIssued"].ID, membershipTokenIssuedTopic)
+
+	cfg := &config.Config{}
+	alice := common.HexToAddress("0xa11ce")
+	spaceContract := newFakeSpaceContract(common.HexToAddress("0x0e"))
+	ca := newTestChainAuth(t, ctx, spaceContract)
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+	spaceAddress, err := shared.AddressFromSpaceId(spaceId)
+	require.NoError(t, err)
+
+	result, err := ca.IsEntitled(ctx, cfg, NewChainAuthArgsForIsSpaceMember(spaceId, alice.Hex()))
+	require.NoError(t, err)
+	require.False(t, result.IsEntitled())
+	require.Equal(t, EntitlementResultReason_MEMBERSHIP, result.Reason())
+
+	// Alice joins, the denial is still cached.
+	spaceContract.mu.Lock()
+	spaceContract.members[alice] = true
+	spaceContract.mu.Unlock()
+	result, err = ca.IsEntitled(ctx, cfg, NewChainAuthArgsForIsSpaceMember(spaceId, alice.Hex()))
+	require.NoError(t, err)
+	require.False(t, result.IsEntitled())
+
+	// Logs of other contracts or events are ignored.
+	ca.onTransactionVerified(ctx, spaceAddress, alice, []*ethTypes.Log{
+		{
+			Address: common.HexToAddress("0xbad"),
+			Topics:  []common.Hash{membershipTokenIssuedTopic, common.BytesToHash(alice.Bytes()), {}},
+		},
+		{
+			Address: spaceAddress,
+			Topics:  []common.Hash{common.HexToHash("0x1234"), common.BytesToHash(alice.Bytes()), {}},
+		},
+	})
+	result, err = ca.IsEntitled(ctx, cfg, NewChainAuthArgsForIsSpaceMember(spaceId, alice.Hex()))
+	require.NoError(t, err)
+	require.False(t, result.IsEntitled())
+
+	// Once the join transaction is verified the next check succeeds right away.
+	ca.onTransactionVerified(ctx, spaceAddress, alice, []*ethTypes.Log{
+		{
+			Address: spaceAddress,
+			Topics:  []common.Hash{membershipTokenIssuedTopic, common.BytesToHash(alice.Bytes()), common.BigToHash(common.Big1)},
+		},
+	})
+	result, err = ca.IsEntitled(ctx, cfg, NewChainAuthArgsForIsSpaceMember(spaceId, alice.Hex()))
+	require.NoError(t, err)
+	require.True(t, result.IsEntitled())
+}
+
+// expiringSpaceContract reports the memberships of expired wallets as expired.
+type expiringSpaceContract struct {
+	*fakeSpaceContract
+	expired map[common.Address]bool
+}
+
+func (sc *expiringSpaceContract) GetMembershipStatus(
+	ctx context.Context,
+	spaceId shared.StreamId,
+	user common.Address,
+) (*MembershipStatus, error) {
+	if sc.expired[user] {
+		return &MembershipStatus{IsMember: true, IsExpired: true}, nil
+	}
+	return sc.fakeSpaceContract.GetMembershipStatus(ctx, spaceId, user)
+}
+
+// concurrencyTrackingSpaceContract records the largest number of membership calls in flight at once.
+type concurrencyTrackingSpaceContract struct {
+	*fakeSpaceContract
+	inflight    atomic.Int32
+	maxInflight atomic.Int32
+}
+
+func (sc *concurrencyTrackingSpaceContract) GetMembershipStatus(
+	ctx context.Context,
+	spaceId shared.StreamId,
+	user common.Address,
+) (*MembershipStatus, error) {
+	inflight := sc.inflight.Add(1)
+	defer sc.inflight.Add(-1)
+	for {
+		current := sc.maxInflight.Load()
+		if inflight <= current || sc.maxInflight.CompareAndSwap(current, inflight) {
+			break
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+	return sc.fakeSpaceContract.GetMembershipStatus(ctx, spaceId, user)
+}
+
+func TestMaxConcurrentMembershipChecks(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	spaceContract := &concurrencyTrackingSpaceContract{
+		fakeSpaceContract: newFakeSpaceContract(common.HexToAddress("0x0e")),
+	}
+	ca := newTestChainAuth(t, ctx, spaceContract)
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+	var wallets []common.Address
+	for i := range 10 {
+		wallets = append(wallets, common.BigToAddress(big.NewInt(int64(0x100+i))))
+	}
+	args := NewChainAuthArgsForSpace(spaceId, wallets[0].Hex(), PermissionRead)
+
+	// All wallets are checked, at most MaxConcurrentMembershipChecks at a time.
+	denial, _, err := ca.checkWalletsMembership(ctx, &config.Config{MaxConcurrentMembershipChecks: 3}, args, wallets)
+	require.NoError(t, err)
+	require.Equal(t, EntitlementResultReason_MEMBERSHIP, denial.Reason())
+	require.Equal(t, len(wallets), spaceContract.callCount("GetMembershipStatus"))
+	require.LessOrEqual(t, spaceContract.maxInflight.Load(), int32(3))
+}
+
+// failingMembershipSpaceContract fails the membership checks of the wallets in errs with their error.
+type failingMembershipSpaceContract struct {
+	*fakeSpaceContract
+
+	errs map[common.Address]error
+}
+
+func (sc *failingMembershipSpaceContract) GetMembershipStatus(
+	ctx context.Context,
+	spaceId shared.StreamId,
+	user common.Address,
+) (*MembershipStatus, error) {
+	if err := sc.errs[user]; err != nil {
+		return nil, err
+	}
+	return sc.fakeSpaceContract.GetMembershipStatus(ctx, spaceId, user)
+}
+
+func TestMembershipErrorsJoined(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	alice := common.HexToAddress("0xa11ce")
+	bob := common.HexToAddress("0xb0b")
+	carol := common.HexToAddress("0xca501")
+	aliceErr := errors.New("alice membership failed")
+	bobErr := RiverError(Err_CANNOT_CALL_CONTRACT, "bob membership failed")
+	spaceContract := &failingMembershipSpaceContract{
+		fakeSpaceContract: newFakeSpaceContract(common.HexToAddress("0x0e")),
+		errs:              map[common.Address]error{alice: aliceErr, bob: bobErr},
+	}
+	ca := newTestChainAuth(t, ctx, spaceContract)
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+	args := NewChainAuthArgsForSpace(spaceId, alice.Hex(), PermissionWrite)
+
+	// Each failed check can be matched through the aggregate error.
+	_, _, err := ca.checkWalletsMembership(ctx, cfg, args, []common.Address{alice, bob, carol})
+	require.Equal(t, Err_CANNOT_CHECK_ENTITLEMENTS, AsRiverError(err).Code)
+	require.ErrorIs(t, err, aliceErr)
+	require.ErrorIs(t, err, bobErr)
+
+	// A single failed check keeps its code.
+	_, _, err = ca.checkWalletsMembership(ctx, cfg, args, []common.Address{bob, carol})
+	require.Equal(t, Err_CANNOT_CALL_CONTRACT, AsRiverError(err).Code)
+	require.ErrorIs(t, err, bobErr)
+	require.NotErrorIs(t, err, aliceErr)
+}
+
+// expiringMembershipSpaceContract serves memberships that expire at the given unix times.
+type expiringMembershipSpaceContract struct {
+	*fakeSpaceContract
+
+	expiries map[common.Address]int64
+}
+
+func (sc *expiringMembershipSpaceContract) GetMembershipStatus(
+	ctx context.Context,
+	spaceId shared.StreamId,
+	user common.Address,
+) (*MembershipStatus, error) {
+	status, err := sc.fakeSpaceContract.GetMembershipStatus(ctx, spaceId, user)
+	if err == nil && status.IsMember {
+		status.ExpiryTime = big.NewInt(sc.expiries[user])
+	}
+	return status, err
+}
+
+func TestIsEntitledResultValidUntil(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	alice := common.HexToAddress("0xa11ce")
+	bob := common.HexToAddress("0xb0b")
+	carol := common.HexToAddress("0xca201")
+	stranger := common.HexToAddress("0x5")
+	soon := time.Now().Add(time.Minute).Truncate(time.Second)
+	later := time.Now().Add(time.Hour).Truncate(time.Second)
+	spaceContract := &expiringMembershipSpaceContract{
+		fakeSpaceContract: newFakeSpaceContract(common.HexToAddress("0x0e"), alice, bob, carol),
+		expiries:          map[common.Address]int64{alice: soon.Unix(), bob: later.Unix()},
+	}
+	ca := newTestChainAuth(t, ctx, spaceContract)
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+	require.Equal(t, 15*time.Minute, ca.entitlementCache.positiveCacheTTL)
+
+	for _, tc := range []struct {
+		name       string
+		principal  common.Address
+		validUntil time.Time
+	}{
+		{"expires before the cache TTL", alice, soon},
+		{"expires after the cache TTL", bob, later},
+		{"doesn't expire", carol, time.Time{}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			args := NewChainAuthArgsForSpace(spaceId, tc.principal.Hex(), PermissionWrite)
+			result, err := ca.IsEntitled(ctx, cfg, args)
+			require.NoError(t, err)
+			require.True(t, result.IsEntitled())
+			require.True(t, tc.validUntil.Equal(DetailsOf(result).ValidUntil))
+
+			// The cached result is not served past the expiry, the TTL caps entries that expire later.
+			val, ok := ca.entitlementCache.positiveCache.Peek(*ca.entitlementCache.withGeneration(args))
+			require.True(t, ok)
+			cached := val.(*timestampedCacheValue)
+			require.True(t, tc.validUntil.Equal(cached.expiresAt))
+			require.True(t, isFresh(cached, ca.entitlementCache.positiveCacheTTL, time.Now()))
+
+			result, err = ca.IsEntitled(ctx, cfg, args)
+			require.NoError(t, err)
+			require.True(t, DetailsOf(result).FromCache)
+			require.True(t, tc.validUntil.Equal(DetailsOf(result).ValidUntil))
+		})
+	}
+
+	// Denials are not valid until any time.
+	result, err := ca.IsEntitled(ctx, cfg, NewChainAuthArgsForSpace(spaceId, stranger.Hex(), PermissionWrite))
+	require.NoError(t, err)
+	require.False(t, result.IsEntitled())
+	require.True(t, DetailsOf(result).ValidUntil.IsZero())
+}
+
+func TestListSpaceMembers(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	var members []common.Address
+	for i := range 5 {
+		members = append(members, common.BigToAddress(big.NewInt(int64(i+1))))
+	}
+	// The owner is a member too.
+	owner := common.HexToAddress("0x0e")
+	members = append(members, owner)
+	spaceContract := newFakeSpaceContract(owner, members...)
+	ca := newTestChainAuth(t, ctx, spaceContract)
+	defer ca.Close()
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+
+	// The pages are listed until the end of the members.
+	var listed []common.Address
+	for page := 0; ; page++ {
+		pageMembers, err := ca.ListSpaceMembers(ctx, cfg, spaceId, page, 2)
+		if errors.Is(err, ErrNoMoreSpaceMembers) {
+			break
+		}
+		require.NoError(t, err)
+		require.LessOrEqual(t, len(pageMembers), 2)
+		listed = append(listed, pageMembers...)
+	}
+	require.Equal(t, members, listed)
+	require.Equal(t, 4, spaceContract.callCount("ListSpaceMembers"))
+
+	// Pages are bounded.
+	for _, pageSize := range []int{0, -1, DEFAULT_MAX_MEMBERS_PAGE_SIZE + 1} {
+		_, err := ca.ListSpaceMembers(ctx, cfg, spaceId, 0, pageSize)
+		require.Equal(t, Err_INVALID_ARGUMENT, AsRiverError(err).Code, pageSize)
+	}
+	_, err := ca.ListSpaceMembers(ctx, cfg, spaceId, -1, 2)
+	require.Equal(t, Err_INVALID_ARGUMENT, AsRiverError(err).Code)
+	require.Equal(t, 4, spaceContract.callCount("ListSpaceMembers"))
+}
+
+func TestGetMembershipExpiry(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	alice := common.HexToAddress("0xa11ce")
+	carol := common.HexToAddress("0xca201")
+	stranger := common.HexToAddress("0x5")
+	later := time.Now().Add(time.Hour).Truncate(time.Second)
+	spaceContract := &expiringMembershipSpaceContract{
+		fakeSpaceContract: newFakeSpaceContract(common.HexToAddress("0x0e"), alice, carol),
+		expiries:          map[common.Address]int64{alice: later.Unix()},
+	}
+	ca := newTestChainAuth(t, ctx, spaceContract)
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+
+	expiry, err := ca.GetMembershipExpiry(ctx, cfg, spaceId, alice)
+	require.NoError(t, err)
+	require.True(t, later.Equal(expiry))
+
+	expiry, err = ca.GetMembershipExpiry(ctx, cfg, spaceId, carol)
+	require.NoError(t, err)
+	require.True(t, expiry.IsZero())
+
+	_, err = ca.GetMembershipExpiry(ctx, cfg, spaceId, stranger)
+	require.Equal(t, Err_NOT_FOUND, AsRiverError(err).Code)
+
+	// The expiry is served from the membership cache.
+	calls := spaceContract.callCount("GetMembershipStatus")
+	status, err := ca.GetMembershipStatus(ctx, cfg, spaceId, alice)
+	require.NoError(t, err)
+	require.Equal(t, later.Unix(), status.ExpiryTime.Int64())
+	_, err = ca.GetMembershipExpiry(ctx, cfg, spaceId, alice)
+	require.NoError(t, err)
+	require.Equal(t, calls, spaceContract.callCount("GetMembershipStatus"))
+
+	// Expired memberships report when they expired.
+	earlier := time.Now().Add(-time.Hour).Truncate(time.Second)
+	expired := &MembershipStatus{IsMember: true, IsExpired: true, ExpiredAt: big.NewInt(earlier.Unix())}
+	expiry, err = membershipExpiry(expired)
+	require.NoError(t, err)
+	require.True(t, earlier.Equal(expiry))
+}
+
+func TestMembershipBatch(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	member := common.HexToAddress("0x3e3b")
+	spaceContract := newFakeSpaceContract(common.HexToAddress("0x0e"), member)
+	spaceContract.batchMembership = true
+	ca := newTestChainAuth(t, ctx, spaceContract)
+	defer ca.Close()
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+	var wallets []common.Address
+	for i := range 5 {
+		wallets = append(wallets, common.BigToAddress(big.NewInt(int64(0x100+i))))
+	}
+	args := NewChainAuthArgsForSpace(spaceId, wallets[0].Hex(), PermissionRead)
+
+	// The wallets are checked in a single call.
+	denial, _, err := ca.checkWalletsMembership(ctx, cfg, args, wallets)
+	require.NoError(t, err)
+	require.Equal(t, EntitlementResultReason_MEMBERSHIP, denial.Reason())
+	require.Equal(t, 1, spaceContract.callCount("GetMembershipStatusBatch"))
+	require.Zero(t, spaceContract.callCount("GetMembershipStatus"))
+
+	// The statuses are cached per wallet, only the wallets that are not cached are fetched.
+	denial, _, err = ca.checkWalletsMembership(ctx, cfg, args, append(wallets, member))
+	require.NoError(t, err)
+	require.Nil(t, denial)
+	require.Equal(t, 2, spaceContract.callCount("GetMembershipStatusBatch"))
+	require.Equal(t, 5.0, testutil.ToFloat64(ca.membershipCacheHit))
+	status, err := ca.GetMembershipStatus(ctx, cfg, spaceId, member)
+	require.NoError(t, err)
+	require.True(t, status.IsMember)
+	require.Zero(t, spaceContract.callCount("GetMembershipStatus"))
+
+	// Without batch support the wallets are checked one by one.
+	spaceContract.batchMembership = false
+	ca.membershipCache.flush()
+	denial, _, err = ca.checkWalletsMembership(ctx, cfg, args, wallets)
+	require.NoError(t, err)
+	require.Equal(t, EntitlementResultReason_MEMBERSHIP, denial.Reason())
+	require.Equal(t, 2, spaceContract.callCount("GetMembershipStatusBatch"))
+	require.Equal(t, len(wallets), spaceContract.callCount("GetMembershipStatus"))
+}
+
+func TestDenialReasons(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	alice := common.HexToAddress("0xa11ce")
+	churned := common.HexToAddress("0xc4")
+	stranger := common.HexToAddress("0x5")
+	ca := newTestChainAuth(t, ctx, &expiringSpaceContract{
+		fakeSpaceContract: newFakeSpaceContract(common.HexToAddress("0x0e"), alice),
+		expired:           map[common.Address]bool{churned: true},
+	})
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+
+	for _, principal := range []common.Address{alice, churned, stranger} {
+		for range 2 {
+			_, err := ca.IsEntitled(ctx, cfg, NewChainAuthArgsForSpace(spaceId, principal.Hex(), PermissionRead))
+			require.NoError(t, err)
+		}
+	}
+
+	// Denials are counted once when computed, cached denials are not counted again.
+	require.Equal(t, 2, testutil.CollectAndCount(ca.denialReasons))
+	require.Equal(t, 1.0, testutil.ToFloat64(ca.denialReasons.WithLabelValues("MEMBERSHIP_EXPIRED")))
+	require.Equal(t, 1.0, testutil.ToFloat64(ca.denialReasons.WithLabelValues("MEMBERSHIP")))
+
+	// The cache lookups are broken down by the reason of the cached denial.
+	for _, result := range []string{"hit", "miss"} {
+		for reason, count := range map[string]float64{"NONE": 1, "MEMBERSHIP": 1, "MEMBERSHIP_EXPIRED": 1} {
+			require.Equal(t, count,
+				testutil.ToFloat64(ca.cacheCounters.WithLabelValues("isEntitled", result, reason)), result, reason)
+		}
+	}
+
+	// Evaluations bypassing the cache are not counted.
+	args := NewChainAuthArgsForSpace(spaceId, stranger.Hex(), PermissionRead)
+	_, err := ca.checkEntitlement(withoutCache(ctx), cfg, args)
+	require.NoError(t, err)
+	require.Equal(t, 1.0, testutil.ToFloat64(ca.denialReasons.WithLabelValues("MEMBERSHIP")))
+}
+
+// blockingLinkedWalletsEvaluator resolves wallets to themselves once released, the first lookup fails when
+// its context is cancelled before.
+type blockingLinkedWalletsEvaluator struct {
+	started chan struct{}
+	release chan struct{}
+	calls   atomic.Int32
+}
+
+func (e *blockingLinkedWalletsEvaluator) GetLinkedWallets(
+	ctx context.Context,
+	wallet common.Address,
+	_ int,
+	_ *base.WalletLink,
+	_ *prometheus.HistogramVec,
+	_ *infra.StatusCounterVec,
+	_ *infra.StatusCounterVec,
+) ([]common.Address, error) {
+	if e.calls.Add(1) == 1 {
+		close(e.started)
+		select {
+		case <-e.release:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	return []common.Address{wallet}, nil
+}
+
+func TestLinkedWalletLookupsAreCollapsed(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	bob := common.HexToAddress("0xb0b")
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+	walletLink, err := base.NewWalletLink(common.HexToAddress("0xabc"), &fakeWalletLinkBackend{t: t})
+	require.NoError(t, err)
+
+	newCa := func() (*chainAuth, *blockingLinkedWalletsEvaluator) {
+		ca := newTestChainAuth(t, ctx, newFakeSpaceContract(common.HexToAddress("0x0e"), bob))
+		evaluator := &blockingLinkedWalletsEvaluator{started: make(chan struct{}), release: make(chan struct{})}
+		ca.walletResolver = &WalletResolver{evaluator: evaluator, walletLink: walletLink}
+		return ca, evaluator
+	}
+
+	// Read checks bust the linked wallet cache, concurrent misses still share a single lookup.
+	ca, evaluator := newCa()
+	const callers = 10
+	var wg sync.WaitGroup
+	for range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wallets, err := ca.getLinkedWallets(ctx, cfg, NewChainAuthArgsForSpace(spaceId, bob.Hex(), PermissionRead))
+			require.NoError(t, err)
+			require.Equal(t, []common.Address{bob}, wallets)
+		}()
+	}
+	<-evaluator.started
+	time.Sleep(50 * time.Millisecond)
+	close(evaluator.release)
+	wg.Wait()
+
+	require.EqualValues(t, 1, evaluator.calls.Load())
+	collapsed := testutil.ToFloat64(ca.linkedWalletCollapsed)
+	coalesced := testutil.ToFloat64(ca.linkedWalletCache.coalesced)
+	require.Positive(t, collapsed)
+	require.Equal(t, float64(callers-1), collapsed+coalesced)
+
+	// The shared result is cached.
+	wallets, err := ca.getLinkedWallets(ctx, cfg, NewChainAuthArgsForSpace(spaceId, bob.Hex(), PermissionWrite))
+	require.NoError(t, err)
+	require.Equal(t, []common.Address{bob}, wallets)
+	require.EqualValues(t, 1, evaluator.calls.Load())
+
+	// Callers that shared a lookup the first caller gave up on make their own.
+	ca, evaluator = newCa()
+	leaderCtx, cancelLeader := context.WithCancel(ctx)
+	leaderDone := make(chan error)
+	go func() {
+		_, err := ca.getLinkedWalletsUncached(leaderCtx, cfg, newArgsForLinkedWallets(bob))
+		leaderDone <- err
+	}()
+	<-evaluator.started
+	followerDone := make(chan CacheResult)
+	go func() {
+		result, err := ca.getLinkedWalletsUncached(ctx, cfg, newArgsForLinkedWallets(bob))
+		require.NoError(t, err)
+		followerDone <- result
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancelLeader()
+	require.ErrorIs(t, <-leaderDone, context.Canceled)
+	result := <-followerDone
+	require.Equal(t, []common.Address{bob}, result.(*linkedWalletCacheValue).wallets)
+	require.EqualValues(t, 2, evaluator.calls.Load())
+}
+
+func TestGetMembershipStatus(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	alice := common.HexToAddress("0xa11ce")
+	bob := common.HexToAddress("0xb0b")
+	spaceContract := newFakeSpaceContract(common.HexToAddress("0x0e"), alice)
+	ca := newTestChainAuth(t, ctx, spaceContract)
+	var chainAuth ChainAuth = ca
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+
+	// The status of a membership with tokens and an expiry, as reported by the space contract.
+	expiry := time.Now().Add(time.Hour).Unix()
+	ca.membershipCache.positiveCache.Add(
+		*ca.membershipCache.withGeneration(newArgsForIsSpaceMember(spaceId, alice)),
+		&timestampedCacheValue{
+			result: &membershipStatusCacheResult{status: &MembershipStatus{
+				IsMember:   true,
+				TokenIds:   []*big.Int{big.NewInt(7)},
+				ExpiryTime: big.NewInt(expiry),
+			}},
+			timestamp: time.Now(),
+		},
+	)
+	status, err := chainAuth.GetMembershipStatus(ctx, cfg, spaceId, alice)
+	require.NoError(t, err)
+	require.True(t, status.IsMember)
+	require.False(t, status.IsExpired)
+	require.Equal(t, []*big.Int{big.NewInt(7)}, status.TokenIds)
+	require.Equal(t, big.NewInt(expiry), status.ExpiryTime)
+	require.Zero(t, spaceContract.callCount("GetMembershipStatus"))
+
+	// Callers can't change the cached status.
+	status.TokenIds[0].SetInt64(8)
+	status.ExpiryTime.SetInt64(0)
+	status, err = chainAuth.GetMembershipStatus(ctx, cfg, spaceId, alice)
+	require.NoError(t, err)
+	require.Equal(t, []*big.Int{big.NewInt(7)}, status.TokenIds)
+	require.Equal(t, big.NewInt(expiry), status.ExpiryTime)
+
+	// Non-members are looked up on the chain.
+	status, err = chainAuth.GetMembershipStatus(ctx, cfg, spaceId, bob)
+	require.NoError(t, err)
+	require.False(t, status.IsMember)
+	require.Equal(t, 1, spaceContract.callCount("GetMembershipStatus"))
+
+	// A cached value of the wrong type is an error rather than a silent contract call.
+	carol := common.HexToAddress("0xca401")
+	ca.membershipCache.positiveCache.Add(
+		*ca.membershipCache.withGeneration(newArgsForIsSpaceMember(spaceId, carol)),
+		&timestampedCacheValue{
+			result:    boolCacheResult{isAllowed: true, reason: EntitlementResultReason_NONE},
+			timestamp: time.Now(),
+		},
+	)
+	_, err = chainAuth.GetMembershipStatus(ctx, cfg, spaceId, carol)
+	require.Error(t, err)
+	require.Equal(t, Err_INTERNAL, AsRiverError(err).Code)
+	require.Equal(t, 1, spaceContract.callCount("GetMembershipStatus"))
+}
+
+func TestFlushAllCaches(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	bob := common.HexToAddress("0xb0b")
+	spaceContract := newFakeSpaceContract(common.HexToAddress("0x0e"), bob)
+	ca := newTestChainAuth(t, ctx, spaceContract)
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+	args := NewChainAuthArgsForSpace(spaceId, bob.Hex(), PermissionWrite)
+
+	for range 2 {
+		result, err := ca.IsEntitled(ctx, cfg, args)
+		require.NoError(t, err)
+		require.True(t, result.IsEntitled())
+	}
+	for range 2 {
+		banned, err := ca.IsBanned(ctx, cfg, spaceId, bob)
+		require.NoError(t, err)
+		require.False(t, banned)
+	}
+	require.Positive(t, testutil.ToFloat64(ca.isSpaceEnabledCacheMiss))
+	require.Positive(t, testutil.ToFloat64(ca.banCacheHit))
+	calls := spaceContract.callCount("GetMembershipStatus")
+
+	ca.FlushAllCaches()
+
+	for _, ec := range []*entitlementCache{
+		ca.entitlementCache,
+		ca.membershipCache,
+		ca.entitlementManagerCache,
+		ca.linkedWalletCache,
+	} {
+		require.Zero(t, ec.positiveCache.Len())
+		require.Zero(t, ec.negativeCache.Len())
+	}
+	for _, counter := range []prometheus.Counter{
+		ca.isSpaceEnabledCacheMiss,
+		ca.membershipCacheMiss,
+		ca.entitlementCache.coalesced,
+	} {
+		require.Zero(t, testutil.ToFloat64(counter))
+	}
+
+	// The next check is computed from the chain again and counted by the reset counters.
+	result, err := ca.IsEntitled(ctx, cfg, args)
+	require.NoError(t, err)
+	require.True(t, result.IsEntitled())
+	require.Equal(t, calls+1, spaceContract.callCount("GetMembershipStatus"))
+	require.Zero(t, testutil.ToFloat64(ca.banCacheHit))
+	require.Equal(t, float64(1), testutil.ToFloat64(ca.isSpaceEnabledCacheMiss))
+	require.Equal(t, float64(1), testutil.ToFloat64(ca.cacheCounters.WithLabelValues("isSpaceEnabled", "miss", "NONE")))
+}
+
+func TestGetLinkedWallets(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	bob := common.HexToAddress("0xb0b")
+	rootKey := common.HexToAddress("0x1")
+	hot1 := common.HexToAddress("0x2")
+	hot2 := common.HexToAddress("0x3")
+	ca := newTestChainAuth(t, ctx, newFakeSpaceContract(common.HexToAddress("0x0e")))
+
+	// Without a wallet link contract the principal is only linked to itself.
+	wallets, err := ca.GetLinkedWallets(ctx, cfg, bob, LinkedWalletsOpts{})
+	require.NoError(t, err)
+	require.Equal(t, []common.Address{bob}, wallets)
+	wallets, err = ca.GetLinkedWallets(ctx, cfg, bob, LinkedWalletsOpts{ExcludePrincipal: true})
+	require.NoError(t, err)
+	require.Empty(t, wallets)
+
+	walletLink, err := base.NewWalletLink(common.HexToAddress("0xabc"), &fakeWalletLinkBackend{t: t})
+	require.NoError(t, err)
+	evaluator := &fakeLinkedWalletsEvaluator{wallets: map[common.Address][]common.Address{
+		rootKey: {hot2, hot1, hot2, rootKey},
+		hot2:    {hot2, rootKey, hot1},
+	}}
+	ca.walletResolver = &WalletResolver{evaluator: evaluator, walletLink: walletLink}
+
+	// The principal comes first, followed by the other wallets by address, whatever the order they were
+	// linked in.
+	wallets, err = ca.GetLinkedWallets(ctx, cfg, rootKey, LinkedWalletsOpts{})
+	require.NoError(t, err)
+	require.Equal(t, []common.Address{rootKey, hot1, hot2}, wallets)
+	wallets, err = ca.GetLinkedWallets(ctx, cfg, hot2, LinkedWalletsOpts{})
+	require.NoError(t, err)
+	require.Equal(t, []common.Address{hot2, rootKey, hot1}, wallets)
+	wallets, err = ca.GetLinkedWallets(ctx, cfg, hot2, LinkedWalletsOpts{ExcludePrincipal: true})
+	require.NoError(t, err)
+	require.Equal(t, []common.Address{rootKey, hot1}, wallets)
+
+	// Callers own the returned wallets.
+	wallets[0] = bob
+	writeArgs := func(principal common.Address) *ChainAuthArgs {
+		return NewChainAuthArgsForSpace(shared.StreamId{}, principal.Hex(), PermissionWrite)
+	}
+	cached, err := ca.getLinkedWallets(ctx, cfg, writeArgs(hot2))
+	require.NoError(t, err)
+	require.Equal(t, []common.Address{hot2, rootKey, hot1}, cached)
+
+	// The wallets are looked up again, the cache serves the fresh wallets to subsequent checks.
+	evaluator.wallets[rootKey] = []common.Address{rootKey, hot1}
+	wallets, err = ca.GetLinkedWallets(ctx, cfg, rootKey, LinkedWalletsOpts{})
+	require.NoError(t, err)
+	require.Equal(t, []common.Address{rootKey, hot1}, wallets)
+	evaluator.wallets[rootKey] = nil
+	cached, err = ca.getLinkedWallets(ctx, cfg, writeArgs(rootKey))
+	require.NoError(t, err)
+	require.Equal(t, []common.Address{rootKey, hot1}, cached)
+}
+
+func TestChainAuthArgsBuilders(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	alice := common.HexToAddress("0xa11ce")
+	bob := common.HexToAddress("0xb0b")
+	carol := common.HexToAddress("0xca201")
+	spaceContract := newFakeSpaceContract(common.HexToAddress("0x0e"), alice)
+	spaceContract.members[bob] = true
+	ca := newTestChainAuth(t, ctx, spaceContract)
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+
+	// The builders return copies, the args they are called on are unchanged.
+	args := NewChainAuthArgsForSpace(spaceId, bob.Hex(), PermissionRead)
+	built := args.WithPermission(PermissionWrite).WithLinkedWallets([]common.Address{bob, alice}).WithChainId(0)
+	require.Equal(t, PermissionRead, args.permission)
+	require.False(t, args.hasPreFetchedWallets)
+	require.Equal(t, PermissionWrite, built.permission)
+
+	result, err := ca.IsEntitled(ctx, cfg, built)
+	require.NoError(t, err)
+	require.True(t, result.IsEntitled())
+	require.Equal(t, alice, DetailsOf(result).SatisfiedBy)
+
+	// A built-in permission replaces an app-defined one.
+	custom := NewChainAuthArgsForCustomPermission(spaceId, shared.StreamId{}, bob.Hex(), "CAN_MINT_NFT")
+	require.Empty(t, custom.WithPermission(PermissionWrite).customPermission)
+	require.Equal(t, "CAN_MINT_NFT", custom.customPermission)
+
+	linked := NewChainAuthArgsForIsWalletLinked(bob.Bytes(), carol.Bytes()).WithLinkedWallets([]common.Address{bob, alice})
+	result, err = ca.IsEntitled(ctx, cfg, linked)
+	require.NoError(t, err)
+	require.False(t, result.IsEntitled())
+	result, err = ca.IsEntitled(ctx, cfg, linked.WithWalletAddress(alice))
+	require.NoError(t, err)
+	require.True(t, result.IsEntitled())
+}
+
+// perPermissionSpaceContract entitles users per permission, in the space and its channels.
+type perPermissionSpaceContract struct {
+	*fakeSpaceContract
+
+	entitled map[Permission][]common.Address
+	fetched  []Permission
+}
+
+func (sc *perPermissionSpaceContract) entitlementsFor(permission Permission) []types.Entitlement {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.fetched = append(sc.fetched, permission)
+	return []types.Entitlement{{
+		EntitlementType: types.ModuleTypeUserEntitlement,
+		UserEntitlement: sc.entitled[permission],
+	}}
+}
+
+func (sc *perPermissionSpaceContract) GetSpaceEntitlementsForPermission(
+	ctx context.Context,
+	spaceId shared.StreamId,
+	permission Permission,
+) ([]types.Entitlement, common.Address, error) {
+	return sc.entitlementsFor(permission), sc.owner, nil
+}
+
+func (sc *perPermissionSpaceContract) GetChannelEntitlementsForPermission(
+	ctx context.Context,
+	spaceId shared.StreamId,
+	channelId shared.StreamId,
+	permission Permission,
+) ([]types.Entitlement, common.Address, error) {
+	return sc.entitlementsFor(permission), sc.owner, nil
+}
+
+func TestIsEntitledToSeveralPermissions(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	both := common.HexToAddress("0xb0")
+	readOnly := common.HexToAddress("0x1e")
+	writeOnly := common.HexToAddress("0x2e")
+	neither := common.HexToAddress("0x0a")
+	newSpaceContract := func() *perPermissionSpaceContract {
+		return &perPermissionSpaceContract{
+			fakeSpaceContract: newFakeSpaceContract(common.HexToAddress("0x0e"), both, readOnly, writeOnly, neither),
+			entitled: map[Permission][]common.Address{
+				PermissionRead:  {both, readOnly},
+				PermissionWrite: {both, writeOnly},
+			},
+		}
+	}
+	spaceContract := newSpaceContract()
+	ca := newTestChainAuth(t, ctx, spaceContract)
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+	channelId := testutils.MakeChannelId(spaceId)
+
+	for _, tc := range []struct {
+		principal common.Address
+		mode      PermissionMode
+		entitled  bool
+	}{
+		{both, RequireAll, true},
+		{readOnly, RequireAll, false},
+		{writeOnly, RequireAll, false},
+		{neither, RequireAll, false},
+		{both, RequireAny, true},
+		{readOnly, RequireAny, true},
+		{writeOnly, RequireAny, true},
+		{neither, RequireAny, false},
+	} {
+		for _, args := range []*ChainAuthArgs{
+			NewChainAuthArgsForSpace(spaceId, tc.principal.Hex(), PermissionRead),
+			NewChainAuthArgsForChannel(spaceId, channelId, tc.principal.Hex(), PermissionRead),
+		} {
+			args = args.WithPermissions(tc.mode, PermissionRead, PermissionWrite)
+			result, err := ca.IsEntitled(ctx, cfg, args)
+			require.NoError(t, err)
+			require.Equal(t, tc.entitled, result.IsEntitled(), args)
+			if !tc.entitled {
+				reason := EntitlementResultReason_SPACE_ENTITLEMENTS
+				if args.kind == chainAuthKindChannel {
+					reason = EntitlementResultReason_CHANNEL_ENTITLEMENTS
+				}
+				require.Equal(t, reason, result.Reason(), args)
+			}
+		}
+	}
+
+	// The results of the permission set don't collide with those of its single permissions.
+	single := NewChainAuthArgsForSpace(spaceId, writeOnly.Hex(), PermissionRead)
+	result, err := ca.IsEntitled(ctx, cfg, single)
+	require.NoError(t, err)
+	require.False(t, result.IsEntitled())
+	result, err = ca.IsEntitled(ctx, cfg, single.WithPermissions(RequireAny, PermissionRead, PermissionWrite))
+	require.NoError(t, err)
+	require.True(t, result.IsEntitled())
+	require.True(t, DetailsOf(result).FromCache)
+
+	// The evaluation stops at the first permission that decides the check.
+	for _, tc := range []struct {
+		principal common.Address
+		mode      PermissionMode
+	}{
+		{writeOnly, RequireAll},
+		{readOnly, RequireAny},
+	} {
+		spaceContract := newSpaceContract()
+		ca := newTestChainAuth(t, ctx, spaceContract)
+		args := NewChainAuthArgsForSpace(spaceId, tc.principal.Hex(), PermissionRead).
+			WithPermissions(tc.mode, PermissionRead, PermissionWrite)
+		_, err := ca.IsEntitled(ctx, cfg, args)
+		require.NoError(t, err)
+		require.Equal(t, []Permission{PermissionRead}, spaceContract.fetched, tc)
+	}
+
+	// Only space and channel checks hold several permissions.
+	args := NewChainAuthArgsForApp(spaceId, shared.StreamId{}, both, PermissionRead).
+		WithPermissions(RequireAll, PermissionRead, PermissionWrite)
+	_, err = ca.IsEntitled(ctx, cfg, args)
+	require.Equal(t, Err_INVALID_ARGUMENT, AsRiverError(err).Code)
+}
+
+// disabledStreamsSpaceContract disables the spaces and channels in disabled, the spaces in missing don't exist.
+type disabledStreamsSpaceContract struct {
+	*fakeSpaceContract
+
+	disabled map[shared.StreamId]bool
+	missing  map[shared.StreamId]bool
+}
+
+func (sc *disabledStreamsSpaceContract) IsSpaceDisabled(ctx context.Context, spaceId shared.StreamId) (bool, error) {
+	sc.called("IsSpaceDisabled")
+	if sc.missing[spaceId] {
+		return false, RiverError(Err_NOT_FOUND, "Space not found")
+	}
+	return sc.disabled[spaceId], nil
+}
+
+func (sc *disabledStreamsSpaceContract) IsChannelDisabled(
+	ctx context.Context,
+	spaceId shared.StreamId,
+	channelId shared.StreamId,
+) (bool, error) {
+	sc.called("IsChannelDisabled")
+	if sc.missing[spaceId] {
+		return false, RiverError(Err_NOT_FOUND, "Space not found")
+	}
+	return sc.disabled[channelId], nil
+}
+
+func TestIsStreamEnabled(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	alice := common.HexToAddress("0xa11ce")
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+	disabledSpaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+	channelId := testutils.MakeChannelId(spaceId)
+	disabledChannelId := testutils.MakeChannelId(spaceId)
+	spaceContract := &disabledStreamsSpaceContract{
+		fakeSpaceContract: newFakeSpaceContract(common.HexToAddress("0x0e"), alice),
+		disabled:          map[shared.StreamId]bool{disabledSpaceId: true, disabledChannelId: true},
+	}
+	ca := newTestChainAuth(t, ctx, spaceContract)
+
+	result, err := ca.IsSpaceEnabled(ctx, cfg, spaceId)
+	require.NoError(t, err)
+	require.True(t, result.Enabled)
+	require.Equal(t, EntitlementResultReason_NONE, result.Reason)
+	require.False(t, result.FromCache)
+	require.False(t, result.CachedAt.IsZero())
+	cachedAt := result.CachedAt
+
+	// Repeated calls are served from the cache.
+	result, err = ca.IsSpaceEnabled(ctx, cfg, spaceId)
+	require.NoError(t, err)
+	require.True(t, result.Enabled)
+	require.True(t, result.FromCache)
+	require.Equal(t, cachedAt, result.CachedAt)
+	require.Equal(t, 1, spaceContract.callCount("IsSpaceDisabled"))
+
+	// The cache is shared with the entitlement checks of the space.
+	allowed, err := ca.IsEntitled(ctx, cfg, NewChainAuthArgsForSpace(spaceId, alice.Hex(), PermissionRead))
+	require.NoError(t, err)
+	require.True(t, allowed.IsEntitled())
+	require.Equal(t, 1, spaceContract.callCount("IsSpaceDisabled"))
+
+	// A forced refresh reads the chain again.
+	result, err = ca.IsSpaceEnabled(ContextWithForceRefresh(ctx), cfg, spaceId)
+	require.NoError(t, err)
+	require.False(t, result.FromCache)
+	require.Equal(t, 2, spaceContract.callCount("IsSpaceDisabled"))
+
+	result, err = ca.IsSpaceEnabled(ctx, cfg, disabledSpaceId)
+	require.NoError(t, err)
+	require.False(t, result.Enabled)
+	require.Equal(t, EntitlementResultReason_SPACE_DISABLED, result.Reason)
+
+	result, err = ca.IsChannelEnabled(ctx, cfg, spaceId, channelId)
+	require.NoError(t, err)
+	require.True(t, result.Enabled)
+	require.False(t, result.FromCache)
+	result, err = ca.IsChannelEnabled(ctx, cfg, spaceId, channelId)
+	require.NoError(t, err)
+	require.True(t, result.FromCache)
+	require.Equal(t, 1, spaceContract.callCount("IsChannelDisabled"))
+
+	for range 2 {
+		result, err = ca.IsChannelEnabled(ctx, cfg, spaceId, disabledChannelId)
+		require.NoError(t, err)
+		require.False(t, result.Enabled)
+		require.Equal(t, EntitlementResultReason_CHANNEL_DISABLED, result.Reason)
+	}
+	require.True(t, result.FromCache)
+	require.Equal(t, 2, spaceContract.callCount("IsChannelDisabled"))
+}
+
+func TestIsStreamEnabledSpaceNotFound(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	alice := common.HexToAddress("0xa11ce")
+	missingSpaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+	channelId := testutils.MakeChannelId(missingSpaceId)
+	spaceContract := &disabledStreamsSpaceContract{
+		fakeSpaceContract: newFakeSpaceContract(common.HexToAddress("0x0e"), alice),
+		missing:           map[shared.StreamId]bool{missingSpaceId: true},
+	}
+	ca := newTestChainAuth(t, ctx, spaceContract)
+
+	// A space that doesn't exist is told apart from a disabled space.
+	result, err := ca.IsSpaceEnabled(ctx, cfg, missingSpaceId)
+	require.NoError(t, err)
+	require.False(t, result.Enabled)
+	require.Equal(t, EntitlementResultReason_SPACE_NOT_FOUND, result.Reason)
+
+	result, err = ca.IsChannelEnabled(ctx, cfg, missingSpaceId, channelId)
+	require.NoError(t, err)
+	require.False(t, result.Enabled)
+	require.Equal(t, EntitlementResultReason_SPACE_NOT_FOUND, result.Reason)
+
+	entitled, err := ca.IsEntitled(ctx, cfg, NewChainAuthArgsForSpace(missingSpaceId, alice.Hex(), PermissionRead))
+	require.NoError(t, err)
+	require.False(t, entitled.IsEntitled())
+	require.Equal(t, EntitlementResultReason_SPACE_NOT_FOUND, entitled.Reason())
+
+	entitled, err = ca.IsEntitled(
+		ctx,
+		cfg,
+		NewChainAuthArgsForChannel(missingSpaceId, channelId, alice.Hex(), PermissionRead),
+	)
+	require.NoError(t, err)
+	require.False(t, entitled.IsEntitled())
+	require.Equal(t, EntitlementResultReason_SPACE_NOT_FOUND, entitled.Reason())
+
+	// The denial is cached like the result of a disabled space.
+	require.Equal(t, 1, spaceContract.callCount("IsSpaceDisabled"))
+}
+
+func TestSpaceNotFoundError(t *testing.T) {
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+	err := spaceNotFoundError(fmt.Errorf("call: %w", bind.ErrNoCode), spaceId)
+	require.True(t, IsRiverErrorCode(err, Err_NOT_FOUND))
+
+	other := errors.New("connection refused")
+	require.Equal(t, other, spaceNotFoundError(other, spaceId))
+}
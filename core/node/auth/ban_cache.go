@@ -0,0 +1,253 @@
+package auth
+
+import (
+	"context"
+	"encoding/gob"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	lru "github.com/hashicorp/golang-lru/arc/v2"
+
+	"github.com/towns-protocol/towns/core/config"
+	. "github.com/towns-protocol/towns/core/node/base"
+	"github.com/towns-protocol/towns/core/node/logging"
+	"github.com/towns-protocol/towns/core/node/protocol"
+	"github.com/towns-protocol/towns/core/node/shared"
+)
+
+// DEFAULT_BAN_CACHE_TTL is the default time the wallets banned from a space are cached for.
+const DEFAULT_BAN_CACHE_TTL = 15 * time.Second
+
+// bannedWalletsCacheResult is the set of wallets banned from a space.
+type bannedWalletsCacheResult struct {
+	wallets map[common.Address]struct{}
+}
+
+// Ban lists are always retained for the positive cache TTL, see newBanCache.
+func (b *bannedWalletsCacheResult) IsAllowed() bool {
+	return true
+}
+
+func (b *bannedWalletsCacheResult) Reason() EntitlementResultReason {
+	return EntitlementResultReason_NONE
+}
+
+// isBanned returns true if any of the wallets is banned.
+func (b *bannedWalletsCacheResult) isBanned(wallets []common.Address) bool {
+	for _, wallet := range wallets {
+		if _, banned := b.wallets[wallet]; banned {
+			return true
+		}
+	}
+	return false
+}
+
+// newBanCache returns the cache of the wallets banned from each space. Ban lists change rarely, so they are
+// fetched once for all the members of a space and kept for cfg.BanCacheTTL, or until a ban or unban event
+// of the space invalidates them.
+func newBanCache(ctx context.Context, cfg *config.ChainConfig) (*entitlementCache, error) {
+	log := logging.FromCtx(ctx)
+
+	positiveCacheSize := 10000
+	if cfg.PositiveEntitlementCacheSize > 0 {
+		positiveCacheSize = cfg.PositiveEntitlementCacheSize
+	}
+	positiveCache, err := lru.NewARC[ChainAuthArgs, entitlementCacheValue](positiveCacheSize)
+	if err != nil {
+		log.Errorw("error creating auth_impl ban positive cache", "error", err)
+		return nil, WrapRiverError(protocol.Err_CANNOT_CONNECT, err)
+	}
+
+	// Ban lists are never negative results, the negative cache is not used.
+	negativeCache, err := lru.NewARC[ChainAuthArgs, entitlementCacheValue](1)
+	if err != nil {
+		log.Errorw("error creating auth_impl ban negative cache", "error", err)
+		return nil, WrapRiverError(protocol.Err_CANNOT_CONNECT, err)
+	}
+
+	ttl := DEFAULT_BAN_CACHE_TTL
+	if cfg.BanCacheTTL > 0 {
+		ttl = cfg.BanCacheTTL
+	}
+
+	return &entitlementCache{
+		positiveCache:    positiveCache,
+		negativeCache:    negativeCache,
+		positiveCacheTTL: ttl,
+		negativeCacheTTL: ttl,
+	}, nil
+}
+
+// banListDigests are the digests of the ban lists last fetched for each space, and the times they last
+// changed. They outlive the cached lists, so that the results evaluated with a list that changed since can be
+// told apart, see isBanListNewer. They are persisted with the caches, if wal is set, so that this holds for the
+// results restored after a restart as well.
+type banListDigests struct {
+	digests *lru.ARCCache[banListKey, banListDigest]
+	wal     *cacheWal
+}
+
+type banListKey struct {
+	spaceId shared.StreamId
+	chainId uint64
+}
+
+type banListDigest struct {
+	digest    common.Hash
+	changedAt time.Time
+}
+
+func newBanListDigests(cfg *config.ChainConfig) (*banListDigests, error) {
+	size := 10000
+	if cfg.PositiveEntitlementCacheSize > 0 {
+		size = cfg.PositiveEntitlementCacheSize
+	}
+	digests, err := lru.NewARC[banListKey, banListDigest](size)
+	if err != nil {
+		return nil, WrapRiverError(protocol.Err_CANNOT_CONNECT, err)
+	}
+	return &banListDigests{digests: digests}, nil
+}
+
+// record records the ban list of the space fetched at now. Lists fetched for the first time are not recorded as
+// changed, lists that differ from the digest restored from disk are.
+func (d *banListDigests) record(spaceId shared.StreamId, chainId uint64, wallets []common.Address, now time.Time) {
+	key := banListKey{spaceId: spaceId, chainId: chainId}
+	digest := banListDigest{digest: WalletSetDigest(wallets)}
+	prev, ok := d.digests.Peek(key)
+	if ok && prev.digest == digest.digest {
+		return
+	}
+	if ok {
+		digest.changedAt = now
+	}
+	d.digests.Add(key, digest)
+	if d.wal != nil {
+		d.wal.appendBanListDigest(key, digest)
+	}
+}
+
+// restore adds a digest read from the write-ahead log.
+func (d *banListDigests) restore(key banListKey, digest banListDigest) {
+	d.digests.Add(key, digest)
+}
+
+// snapshot encodes the digests of the ban lists.
+func (d *banListDigests) snapshot(encoder *gob.Encoder) error {
+	for _, key := range d.digests.Keys() {
+		digest, ok := d.digests.Peek(key)
+		if !ok {
+			continue
+		}
+		if err := encoder.Encode(newCacheWalBanListDigestRecord(key, digest)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// changedAt returns the time the ban list of the space last changed, zero if it is not known to have changed.
+func (d *banListDigests) changedAt(spaceId shared.StreamId, chainId uint64) time.Time {
+	prev, _ := d.digests.Peek(banListKey{spaceId: spaceId, chainId: chainId})
+	return prev.changedAt
+}
+
+// Used as a cache key for the wallets banned from a space, which are shared by all its members.
+func newArgsForBannedWallets(spaceId shared.StreamId, chainId uint64) *ChainAuthArgs {
+	return &ChainAuthArgs{
+		kind:    chainAuthKindBannedWallets,
+		spaceId: spaceId,
+		chainId: chainId,
+	}
+}
+
+func (ca *chainAuth) getBannedWalletsUncached(
+	ctx context.Context,
+	_ *config.Config,
+	args *ChainAuthArgs,
+) (CacheResult, error) {
+	defer traceStage(ctx, checkStageBanList)()
+
+	spaceContract, err := ca.spaceContractFor(args.chainId)
+	if err != nil {
+		return nil, err
+	}
+	banned, err := spaceContract.GetBannedWallets(ctx, args.spaceId)
+	if err != nil {
+		return nil, err
+	}
+	// Lists read apart from the caches, such as by dual reads, are not served and don't invalidate cached results.
+	if !isCacheBypassed(ctx) {
+		ca.banListDigests.record(args.spaceId, args.chainId, banned, ca.clock.Now())
+	}
+	wallets := make(map[common.Address]struct{}, len(banned))
+	for _, wallet := range banned {
+		wallets[wallet] = struct{}{}
+	}
+	return &bannedWalletsCacheResult{wallets: wallets}, nil
+}
+
+// getBannedWallets returns the wallets banned from the space on the given chain from the ban cache.
+func (ca *chainAuth) getBannedWallets(
+	ctx context.Context,
+	spaceId shared.StreamId,
+	chainId uint64,
+) (*bannedWalletsCacheResult, error) {
+	result, cacheHit, err := ca.banCache.executeUsingCache(
+		ctx,
+		nil,
+		newArgsForBannedWallets(spaceId, chainId),
+		ca.getBannedWalletsUncached,
+	)
+	if err != nil {
+		return nil, AsRiverError(err).Func("getBannedWallets").Tag("spaceId", spaceId)
+	}
+
+	if cacheHit {
+		ca.banCacheHit.Inc()
+	} else {
+		ca.banCacheMiss.Inc()
+	}
+
+	return result.(*timestampedCacheValue).Result().(*bannedWalletsCacheResult), nil
+}
+
+// executeCheckUsingCache returns the result of the check of args from cache like executeUsingCache. Cached
+// results evaluated before the ban list of the space changed are evaluated again, see isBanListNewer.
+func (ca *chainAuth) executeCheckUsingCache(
+	ctx context.Context,
+	cfg *config.Config,
+	cache *entitlementCache,
+	args *ChainAuthArgs,
+	onMiss func(context.Context, *config.Config, *ChainAuthArgs) (CacheResult, error),
+) (CacheResult, bool, error) {
+	result, cacheHit, err := cache.executeUsingCache(ctx, cfg, args, onMiss)
+	if err != nil || !cacheHit || !ca.isBanListNewer(ctx, args, result.(*timestampedCacheValue).cachedAt()) {
+		return result, cacheHit, err
+	}
+	cache.bust(args)
+	return cache.executeUsingCache(ctx, cfg, args, onMiss)
+}
+
+// isBanListNewer fetches the ban list of the space of args if the cached list expired, and returns true if the list
+// changed after cachedAt. Cached results of args evaluated before are evaluated again, so that bans and unbans
+// without an event are picked up once the cached list expires, like IsBanned does. Failures are ignored, the
+// cached result is served.
+func (ca *chainAuth) isBanListNewer(ctx context.Context, args *ChainAuthArgs, cachedAt time.Time) bool {
+	if isCacheBypassed(ctx) {
+		return false
+	}
+	switch args.kind {
+	case chainAuthKindSpace, chainAuthKindChannel, chainAuthKindChannelModerator:
+	default:
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Millisecond*time.Duration(ca.contractCallsTimeoutMs))
+	defer cancel()
+	if _, err := ca.getBannedWallets(ctx, args.spaceId, args.chainId); err != nil {
+		logging.FromCtx(ctx).Warnw("Failed to refresh the ban list", "spaceId", args.spaceId, "error", err)
+		return false
+	}
+	return ca.banListDigests.changedAt(args.spaceId, args.chainId).After(cachedAt)
+}
@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+
+	"github.com/towns-protocol/towns/core/config"
+	"github.com/towns-protocol/towns/core/node/base/test"
+	"github.com/towns-protocol/towns/core/node/shared"
+	"github.com/towns-protocol/towns/core/node/testutils"
+)
+
+func TestBanCache(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	alice := common.HexToAddress("0xa11ce")
+	bob := common.HexToAddress("0xb0b")
+	spaceContract := newFakeSpaceContract(common.HexToAddress("0x0e"), alice, bob)
+	spaceContract.banned[bob] = true
+	ca := newTestChainAuth(t, ctx, spaceContract)
+	defer ca.Close()
+	clock := newFakeClock()
+	ca.setClock(clock)
+	require.Equal(t, DEFAULT_BAN_CACHE_TTL, ca.banCache.positiveCacheTTL)
+
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+	isBanned := func(wallets ...common.Address) bool {
+		bannedWallets, err := ca.getBannedWallets(ctx, spaceId, 0)
+		require.NoError(t, err)
+		return bannedWallets.isBanned(wallets)
+	}
+
+	require.False(t, isBanned(alice))
+	require.True(t, isBanned(alice, bob))
+	require.Equal(t, 1, spaceContract.callCount("GetBannedWallets"))
+
+	// New bans are visible once the cached list is invalidated.
+	spaceContract.mu.Lock()
+	spaceContract.banned[alice] = true
+	spaceContract.mu.Unlock()
+	require.False(t, isBanned(alice))
+	ca.InvalidateCacheForSpace(spaceId)
+	require.True(t, isBanned(alice))
+	require.Equal(t, 2, spaceContract.callCount("GetBannedWallets"))
+
+	// Or once the TTL elapsed.
+	spaceContract.mu.Lock()
+	delete(spaceContract.banned, alice)
+	spaceContract.mu.Unlock()
+	clock.advance(2 * DEFAULT_BAN_CACHE_TTL)
+	require.False(t, isBanned(alice))
+	require.Equal(t, 3, spaceContract.callCount("GetBannedWallets"))
+}
+
+func TestIsBannedAfterBanListExpires(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	alice := common.HexToAddress("0xa11ce")
+	bob := common.HexToAddress("0xb0b")
+	spaceContract := newFakeSpaceContract(common.HexToAddress("0x0e"), alice, bob)
+	ca := newTestChainAuth(t, ctx, spaceContract)
+	defer ca.Close()
+	clock := newFakeClock()
+	ca.setClock(clock)
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+
+	isBanned := func(principal common.Address) bool {
+		isBanned, err := ca.IsBanned(ctx, cfg, spaceId, principal)
+		require.NoError(t, err)
+		return isBanned
+	}
+	isEntitled := func(principal common.Address) bool {
+		result, err := ca.IsEntitled(ctx, cfg, NewChainAuthArgsForSpace(spaceId, principal.Hex(), PermissionWrite))
+		require.NoError(t, err)
+		return result.IsEntitled()
+	}
+
+	for _, principal := range []common.Address{alice, bob} {
+		require.True(t, isEntitled(principal))
+		require.False(t, isBanned(principal))
+	}
+
+	// Bans without an event are picked up by both checks once the cached ban list expires, though the results
+	// of the entitlement checks are cached for longer.
+	spaceContract.mu.Lock()
+	spaceContract.banned[alice] = true
+	spaceContract.banned[bob] = true
+	spaceContract.mu.Unlock()
+	clock.advance(2 * DEFAULT_BAN_CACHE_TTL)
+
+	require.False(t, isEntitled(alice))
+	require.True(t, isBanned(alice))
+	require.True(t, isBanned(bob))
+	require.False(t, isEntitled(bob))
+}
+
+func TestBanCacheTTL(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	banCache, err := newBanCache(ctx, &config.ChainConfig{BanCacheTTL: time.Minute})
+	require.NoError(t, err)
+	require.Equal(t, time.Minute, banCache.positiveCacheTTL)
+}
@@ -2,6 +2,8 @@ package auth
 
 import (
 	"context"
+	"maps"
+	"slices"
 	"sync"
 	"time"
 
@@ -16,6 +18,8 @@ import (
 
 type Banning interface {
 	IsBanned(ctx context.Context, wallets []common.Address) (bool, error)
+	// GetBannedWallets returns the owners of the banned tokens of the space, read from the contract.
+	GetBannedWallets(ctx context.Context) ([]common.Address, error)
 }
 
 type bannedAddressCache struct {
@@ -68,29 +72,56 @@ type banning struct {
 }
 
 func (b *banning) IsBanned(ctx context.Context, wallets []common.Address) (bool, error) {
+	// Reads pinned to a block, and reads that bypass the caches, don't use the cache of the latest banned
+	// addresses.
+	if _, ok := chainStateFromCtx(ctx); ok || isCacheBypassed(ctx) {
+		bannedAddresses, err := b.bannedAddresses(callOpts(ctx))
+		if err != nil {
+			return false, err
+		}
+		for _, wallet := range wallets {
+			if _, banned := bannedAddresses[wallet]; banned {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
 	return b.bannedAddressCache.IsBanned(wallets, func() (map[common.Address]struct{}, error) {
-		bannedTokens, err := b.contract.Banned(nil)
+		return b.bannedAddresses(nil)
+	})
+}
+
+func (b *banning) GetBannedWallets(ctx context.Context) ([]common.Address, error) {
+	bannedAddresses, err := b.bannedAddresses(callOpts(ctx))
+	if err != nil {
+		return nil, AsRiverError(err).Func("GetBannedWallets")
+	}
+	return slices.SortedFunc(maps.Keys(bannedAddresses), common.Address.Cmp), nil
+}
+
+// bannedAddresses reads the owners of the banned tokens from the contract.
+func (b *banning) bannedAddresses(opts *bind.CallOpts) (map[common.Address]struct{}, error) {
+	bannedTokens, err := b.contract.Banned(opts)
+	if err != nil {
+		return nil, WrapRiverError(Err_CANNOT_CALL_CONTRACT, err).
+			Func("IsBanned").
+			Message("Failed to get banned token ids")
+	}
+	bannedAddresses := map[common.Address]struct{}{}
+	for _, token := range bannedTokens {
+		tokenOwnership, err := b.tokenContract.ExplicitOwnershipOf(opts, token)
 		if err != nil {
 			return nil, WrapRiverError(Err_CANNOT_CALL_CONTRACT, err).
 				Func("IsBanned").
-				Message("Failed to get banned token ids")
+				Message("Failed to get owner of banned token")
 		}
-		bannedAddresses := map[common.Address]struct{}{}
-		for _, token := range bannedTokens {
-			tokenOwnership, err := b.tokenContract.ExplicitOwnershipOf(nil, token)
-			if err != nil {
-				return nil, WrapRiverError(Err_CANNOT_CALL_CONTRACT, err).
-					Func("IsBanned").
-					Message("Failed to get owner of banned token")
-			}
-			// Ignore burned tokens or any response that indicates a token id out of bounds
-			zeroAddress := common.Address{}
-			if !tokenOwnership.Burned && tokenOwnership.Addr != zeroAddress {
-				bannedAddresses[tokenOwnership.Addr] = struct{}{}
-			}
+		// Ignore burned tokens or any response that indicates a token id out of bounds
+		zeroAddress := common.Address{}
+		if !tokenOwnership.Burned && tokenOwnership.Addr != zeroAddress {
+			bannedAddresses[tokenOwnership.Addr] = struct{}{}
 		}
-		return bannedAddresses, nil
-	})
+	}
+	return bannedAddresses, nil
 }
 
 func NewBanning(
@@ -0,0 +1,187 @@
+package auth
+
+import (
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	. "github.com/towns-protocol/towns/core/node/base"
+	. "github.com/towns-protocol/towns/core/node/protocol"
+	"github.com/towns-protocol/towns/core/node/shared"
+)
+
+const (
+	// maxCacheInvalidationRecords is the number of the latest applied cache invalidations kept for the audit trail.
+	maxCacheInvalidationRecords = 100
+	// maxCacheInvalidationKeys is the number of the idempotency keys of the latest applied cache invalidations
+	// that are kept.
+	maxCacheInvalidationKeys = 10_000
+	// cacheInvalidationKeyTTL is how long the idempotency keys of applied cache invalidations are kept. Requests
+	// with a key that is no longer kept are older than the last applied version and refused.
+	cacheInvalidationKeyTTL = 24 * time.Hour
+)
+
+// CacheInvalidator is implemented by ChainAuth implementations that let operators invalidate their caches.
+type CacheInvalidator interface {
+	// InvalidateCaches removes the cache entries in the scope of req. Requests are applied once per idempotency
+	// key, repeated requests return the record of the first.
+	InvalidateCaches(req CacheInvalidationRequest) (CacheInvalidationRecord, error)
+	// CacheInvalidations returns the records of the latest applied invalidations, the latest first.
+	CacheInvalidations() []CacheInvalidationRecord
+}
+
+var _ CacheInvalidator = (*chainAuth)(nil)
+
+// CacheInvalidationRequest invalidates the cache entries of a space, or those of a principal in a space.
+type CacheInvalidationRequest struct {
+	// IdempotencyKey identifies the request, a request with the key of an applied invalidation is not applied
+	// again.
+	IdempotencyKey string
+	// Version orders the invalidations, it must be greater than the version of the last applied invalidation.
+	// Of several requests with the same version, only the first is applied.
+	Version uint64
+	// Actor is who requested the invalidation, it is required.
+	Actor   string
+	SpaceId shared.StreamId
+	// Principal limits the invalidation to the entries of the principal and its linked wallets, see
+	// CacheDumpFilter. All entries of the space are invalidated if it is not set.
+	Principal common.Address
+}
+
+// CacheInvalidationRecord is the audit record of an applied cache invalidation.
+type CacheInvalidationRecord struct {
+	IdempotencyKey string          `json:"idempotencyKey"`
+	Version        uint64          `json:"version"`
+	Actor          string          `json:"actor,omitempty"`
+	SpaceId        shared.StreamId `json:"spaceId"`
+	Principal      common.Address  `json:"principal"`
+	// Entries is the number of cache entries that were removed.
+	Entries   int       `json:"entries"`
+	AppliedAt time.Time `json:"appliedAt"`
+}
+
+// cacheInvalidations serializes the cache invalidations and keeps the records of the latest.
+type cacheInvalidations struct {
+	mu sync.Mutex
+	// version is the version of the last applied invalidation.
+	version uint64
+	// records are the latest applied invalidations, the oldest first.
+	records []CacheInvalidationRecord
+	// byKey are the applied invalidations by idempotency key, kept longer than records so replays of requests
+	// return their record. keys are the keys in the order they were applied.
+	byKey map[string]CacheInvalidationRecord
+	keys  []string
+}
+
+func newCacheInvalidations() *cacheInvalidations {
+	return &cacheInvalidations{byKey: make(map[string]CacheInvalidationRecord)}
+}
+
+// add keeps record, dropping the oldest record if the maximum number of records is kept. Its idempotency key is
+// kept for cacheInvalidationKeyTTL, see expireKeys.
+func (l *cacheInvalidations) add(record CacheInvalidationRecord) {
+	if len(l.records) == maxCacheInvalidationRecords {
+		l.records = slices.Delete(l.records, 0, 1)
+	}
+	l.records = append(l.records, record)
+	l.byKey[record.IdempotencyKey] = record
+	l.keys = append(l.keys, record.IdempotencyKey)
+	l.version = record.Version
+	l.expireKeys(record.AppliedAt)
+}
+
+// expireKeys drops the idempotency keys applied more than cacheInvalidationKeyTTL before now, and the oldest keys
+// over maxCacheInvalidationKeys.
+func (l *cacheInvalidations) expireKeys(now time.Time) {
+	expired := 0
+	for _, key := range l.keys {
+		if len(l.keys)-expired <= maxCacheInvalidationKeys && now.Sub(l.byKey[key].AppliedAt) <= cacheInvalidationKeyTTL {
+			break
+		}
+		delete(l.byKey, key)
+		expired++
+	}
+	l.keys = slices.Delete(l.keys, 0, expired)
+}
+
+// InvalidateCaches removes the entries of the space of req, or of its principal, from all entitlement caches.
+// If the whole space is invalidated, the results of the computations in flight are not served either, see
+// InvalidateCacheForSpace. Entries of a principal may be written back by such computations.
+func (ca *chainAuth) InvalidateCaches(req CacheInvalidationRequest) (CacheInvalidationRecord, error) {
+	if req.IdempotencyKey == "" {
+		return CacheInvalidationRecord{}, RiverError(Err_INVALID_ARGUMENT, "Idempotency key is not set").
+			Func("InvalidateCaches")
+	}
+	if req.Actor == "" {
+		return CacheInvalidationRecord{}, RiverError(Err_INVALID_ARGUMENT, "Actor is not set").
+			Func("InvalidateCaches")
+	}
+	if err := validateSpaceId(req.SpaceId); err != nil {
+		return CacheInvalidationRecord{}, AsRiverError(err).Func("InvalidateCaches")
+	}
+
+	l := ca.invalidations
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.expireKeys(ca.clock.Now())
+	if record, ok := l.byKey[req.IdempotencyKey]; ok {
+		if record.Version != req.Version || record.SpaceId != req.SpaceId || record.Principal != req.Principal {
+			return CacheInvalidationRecord{}, RiverError(
+				Err_INVALID_ARGUMENT,
+				"Idempotency key was used for another cache invalidation",
+				"idempotencyKey", req.IdempotencyKey,
+			).Func("InvalidateCaches")
+		}
+		return record, nil
+	}
+	if req.Version <= l.version {
+		return CacheInvalidationRecord{}, RiverError(
+			Err_FAILED_PRECONDITION,
+			"Cache invalidation version is not newer than the last applied version",
+			"version", req.Version,
+			"lastVersion", l.version,
+		).Func("InvalidateCaches")
+	}
+
+	if req.Principal == (common.Address{}) {
+		ca.InvalidateCacheForSpace(req.SpaceId)
+	}
+	entries := 0
+	matches := ca.cacheEntryMatcher(req.SpaceId, req.Principal)
+	for _, named := range ca.namedCaches() {
+		ec := named.cache
+		for _, keys := range [][]ChainAuthArgs{ec.positiveCache.Keys(), ec.negativeCache.Keys()} {
+			for _, key := range keys {
+				if matches(&key) {
+					ec.remove(key)
+					entries++
+				}
+			}
+		}
+	}
+
+	record := CacheInvalidationRecord{
+		IdempotencyKey: req.IdempotencyKey,
+		Version:        req.Version,
+		Actor:          req.Actor,
+		SpaceId:        req.SpaceId,
+		Principal:      req.Principal,
+		Entries:        entries,
+		AppliedAt:      ca.clock.Now(),
+	}
+	l.add(record)
+	return record, nil
+}
+
+// CacheInvalidations returns the records of the latest applied cache invalidations, the latest first.
+func (ca *chainAuth) CacheInvalidations() []CacheInvalidationRecord {
+	l := ca.invalidations
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	records := slices.Clone(l.records)
+	slices.Reverse(records)
+	return records
+}
@@ -0,0 +1,158 @@
+package auth
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+
+	"github.com/towns-protocol/towns/core/config"
+	. "github.com/towns-protocol/towns/core/node/base"
+	"github.com/towns-protocol/towns/core/node/base/test"
+	. "github.com/towns-protocol/towns/core/node/protocol"
+	"github.com/towns-protocol/towns/core/node/shared"
+	"github.com/towns-protocol/towns/core/node/testutils"
+)
+
+func TestInvalidateCaches(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	alice := common.HexToAddress("0xa11ce")
+	bob := common.HexToAddress("0xb0b")
+	ca := newTestChainAuth(t, ctx, newFakeSpaceContract(common.HexToAddress("0x0e"), alice, bob))
+	clock := newFakeClock()
+	ca.setClock(clock)
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+
+	check := func(principal common.Address) {
+		result, err := ca.IsEntitled(ctx, cfg, NewChainAuthArgsForSpace(spaceId, principal.Hex(), PermissionWrite))
+		require.NoError(t, err)
+		require.True(t, result.IsEntitled())
+	}
+	entries := func(principal common.Address) int {
+		return len(ca.DumpCache(CacheDumpFilter{SpaceId: spaceId, Principal: principal}).Entries)
+	}
+	check(alice)
+	check(bob)
+	aliceEntries, bobEntries := entries(alice), entries(bob)
+	require.NotZero(t, aliceEntries)
+	require.NotZero(t, bobEntries)
+
+	aliceReq := CacheInvalidationRequest{
+		IdempotencyKey: "alice",
+		Version:        1,
+		Actor:          "operator",
+		SpaceId:        spaceId,
+		Principal:      alice,
+	}
+	record, err := ca.InvalidateCaches(aliceReq)
+	require.NoError(t, err)
+	require.Equal(t, aliceEntries, record.Entries)
+	require.Zero(t, entries(alice))
+	require.Equal(t, bobEntries, entries(bob))
+
+	// Replays return the original record without invalidating the entries cached since.
+	check(alice)
+	replayed, err := ca.InvalidateCaches(aliceReq)
+	require.NoError(t, err)
+	require.Equal(t, record, replayed)
+	require.Equal(t, aliceEntries, entries(alice))
+
+	otherReq := aliceReq
+	otherReq.Principal = bob
+	_, err = ca.InvalidateCaches(otherReq)
+	require.Equal(t, Err_INVALID_ARGUMENT, AsRiverError(err).Code)
+
+	_, err = ca.InvalidateCaches(CacheInvalidationRequest{
+		IdempotencyKey: "stale",
+		Version:        1,
+		Actor:          "operator",
+		SpaceId:        spaceId,
+	})
+	require.Equal(t, Err_FAILED_PRECONDITION, AsRiverError(err).Code)
+
+	// Of the concurrent requests with the same version, a single one is applied.
+	spaceEntries := len(ca.DumpCache(CacheDumpFilter{SpaceId: spaceId}).Entries)
+	var wg sync.WaitGroup
+	errs := make([]error, 10)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = ca.InvalidateCaches(CacheInvalidationRequest{
+				IdempotencyKey: fmt.Sprintf("space-%d", i),
+				Version:        2,
+				Actor:          "operator",
+				SpaceId:        spaceId,
+			})
+		}()
+	}
+	wg.Wait()
+	applied := 0
+	for _, err := range errs {
+		if err == nil {
+			applied++
+		} else {
+			require.Equal(t, Err_FAILED_PRECONDITION, AsRiverError(err).Code)
+		}
+	}
+	require.Equal(t, 1, applied)
+	require.Empty(t, ca.DumpCache(CacheDumpFilter{SpaceId: spaceId}).Entries)
+
+	records := ca.CacheInvalidations()
+	require.Len(t, records, 2)
+	require.Equal(t, uint64(2), records[0].Version)
+	require.Equal(t, spaceId, records[0].SpaceId)
+	require.Equal(t, common.Address{}, records[0].Principal)
+	require.Equal(t, spaceEntries, records[0].Entries)
+	require.Equal(t, record, records[1])
+	require.Equal(t, "operator", records[1].Actor)
+	require.Equal(t, alice, records[1].Principal)
+
+	// Keys are kept once their record is dropped from the audit trail, replays still return their record.
+	for i := range maxCacheInvalidationRecords {
+		_, err := ca.InvalidateCaches(CacheInvalidationRequest{
+			IdempotencyKey: fmt.Sprintf("fill-%d", i),
+			Version:        uint64(3 + i),
+			Actor:          "operator",
+			SpaceId:        spaceId,
+		})
+		require.NoError(t, err)
+	}
+	require.Len(t, ca.CacheInvalidations(), maxCacheInvalidationRecords)
+	require.NotContains(t, ca.CacheInvalidations(), record)
+	replayed, err = ca.InvalidateCaches(aliceReq)
+	require.NoError(t, err)
+	require.Equal(t, record, replayed)
+
+	// Once the key expired, it is refused as its version is not newer than the last applied.
+	clock.advance(cacheInvalidationKeyTTL + time.Second)
+	_, err = ca.InvalidateCaches(aliceReq)
+	require.Equal(t, Err_FAILED_PRECONDITION, AsRiverError(err).Code)
+
+	_, err = ca.InvalidateCaches(CacheInvalidationRequest{Version: 1000, Actor: "operator", SpaceId: spaceId})
+	require.Equal(t, Err_INVALID_ARGUMENT, AsRiverError(err).Code)
+
+	_, err = ca.InvalidateCaches(CacheInvalidationRequest{IdempotencyKey: "anonymous", Version: 1000, SpaceId: spaceId})
+	require.Equal(t, Err_INVALID_ARGUMENT, AsRiverError(err).Code)
+}
+
+func TestCacheInvalidationKeysBound(t *testing.T) {
+	l := newCacheInvalidations()
+	now := time.Unix(1_700_000_000, 0)
+	for i := range maxCacheInvalidationKeys + 1 {
+		l.add(CacheInvalidationRecord{IdempotencyKey: fmt.Sprintf("key-%d", i), Version: uint64(i + 1), AppliedAt: now})
+	}
+
+	// The oldest key is dropped once too many are kept.
+	require.Len(t, l.byKey, maxCacheInvalidationKeys)
+	require.Len(t, l.keys, maxCacheInvalidationKeys)
+	require.NotContains(t, l.byKey, "key-0")
+	require.Contains(t, l.byKey, "key-1")
+	require.Len(t, l.records, maxCacheInvalidationRecords)
+}
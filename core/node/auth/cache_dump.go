@@ -0,0 +1,257 @@
+package auth
+
+import (
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	ethCrypto "github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/towns-protocol/towns/core/node/shared"
+)
+
+// maxCacheDumpEntries caps the number of entries returned by a single dump.
+const maxCacheDumpEntries = 10000
+
+// CacheDumper is implemented by ChainAuth implementations that can report the contents of their caches.
+type CacheDumper interface {
+	// DumpCache returns a snapshot of the cache entries matching filter.
+	DumpCache(filter CacheDumpFilter) CacheDump
+}
+
+var _ CacheDumper = (*chainAuth)(nil)
+
+// CacheDumpFilter selects the entries of a cache dump. Zero fields match all entries.
+type CacheDumpFilter struct {
+	SpaceId shared.StreamId
+	// Principal matches the entries keyed by the principal or by one of its linked wallets, as far as they
+	// are known to the linked wallet cache.
+	Principal common.Address
+	// RedactAddresses replaces the wallet addresses in the dump with a digest, so entries of the same wallet
+	// can be correlated without revealing it.
+	RedactAddresses bool
+}
+
+// CacheDump is a snapshot of the entries of the entitlement caches.
+type CacheDump struct {
+	Timestamp time.Time        `json:"timestamp"`
+	Entries   []CacheDumpEntry `json:"entries"`
+	// Truncated is true if more entries matched the filter than a single dump returns.
+	Truncated bool `json:"truncated"`
+}
+
+// CacheDumpEntry is a single cache entry, addresses are hex encoded or redacted, see CacheDumpFilter.
+type CacheDumpEntry struct {
+	Cache string `json:"cache"`
+	// Negative is true if the entry is stored in the cache of negative results, which have a shorter TTL.
+	Negative bool `json:"negative"`
+
+	Kind             string          `json:"kind"`
+	SpaceId          shared.StreamId `json:"spaceId"`
+	ChannelId        shared.StreamId `json:"channelId"`
+	Principal        string          `json:"principal,omitempty"`
+	WalletAddress    string          `json:"walletAddress,omitempty"`
+	Permission       string          `json:"permission,omitempty"`
+	CustomPermission string          `json:"customPermission,omitempty"`
+	Permissions      []string        `json:"permissions,omitempty"`
+	PermissionMode   string          `json:"permissionMode,omitempty"`
+	LinkedWallets    []string        `json:"linkedWallets,omitempty"`
+	Generation       uint64          `json:"generation"`
+	ChainId          uint64          `json:"chainId,omitempty"`
+
+	Allowed bool   `json:"allowed"`
+	Reason  string `json:"reason"`
+	// Value holds the details of the cached result that depend on its type, such as the membership status
+	// or the linked wallets.
+	Value map[string]any `json:"value,omitempty"`
+
+	StoredAt  time.Time `json:"storedAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	// Expired is true if the entry is no longer served, because its TTL elapsed or the space was invalidated
+	// since it was stored. Such entries are removed lazily.
+	Expired bool `json:"expired"`
+}
+
+// DumpCache returns the entries of the entitlement caches matching filter. It doesn't change the recency of
+// the entries.
+func (ca *chainAuth) DumpCache(filter CacheDumpFilter) CacheDump {
+	dump := CacheDump{Timestamp: time.Now(), Entries: []CacheDumpEntry{}}
+
+	matches := ca.cacheEntryMatcher(filter.SpaceId, filter.Principal)
+	for _, named := range ca.namedCaches() {
+		ec := named.cache
+		for _, negative := range []bool{false, true} {
+			cache, ttl := ec.positiveCache, ec.positiveCacheTTL
+			if negative {
+				cache, ttl = ec.negativeCache, ec.negativeCacheTTL
+			}
+			for _, key := range cache.Keys() {
+				if !matches(&key) {
+					continue
+				}
+				val, ok := cache.Peek(key)
+				if !ok {
+					continue
+				}
+				if len(dump.Entries) >= maxCacheDumpEntries {
+					dump.Truncated = true
+					return dump
+				}
+				entry := newCacheDumpEntry(named.name, negative, key, val, ttl, filter.RedactAddresses)
+				entry.Expired = !isFresh(val, ttl, ec.now()) || (ec.generations != nil && !ec.generations.isCurrent(&key))
+				dump.Entries = append(dump.Entries, entry)
+			}
+		}
+	}
+	return dump
+}
+
+// namedCache is an entitlement cache along with the name it is reported under.
+type namedCache struct {
+	name  string
+	cache *entitlementCache
+}
+
+func (ca *chainAuth) namedCaches() []namedCache {
+	return []namedCache{
+		{"entitlement", ca.entitlementCache},
+		{"membership", ca.membershipCache},
+		{"entitlementManager", ca.entitlementManagerCache},
+		{"linkedWallet", ca.linkedWalletCache},
+		{"banList", ca.banCache},
+		{"app", ca.appCache},
+	}
+}
+
+// cacheEntryMatcher returns a function that matches the cache keys of the space and of the principal, including
+// its linked wallets as far as they are known to the linked wallet cache. Zero values match all keys.
+func (ca *chainAuth) cacheEntryMatcher(
+	spaceId shared.StreamId,
+	principal common.Address,
+) func(key *ChainAuthArgs) bool {
+	principals := map[common.Address]bool{}
+	if principal != (common.Address{}) {
+		principals[principal] = true
+		if val, ok := ca.linkedWalletCache.positiveCache.Peek(*newArgsForLinkedWallets(principal)); ok {
+			if tsVal, ok := val.(*timestampedCacheValue); ok {
+				if linked, ok := tsVal.result.(*linkedWalletCacheValue); ok {
+					for _, wallet := range linked.wallets {
+						principals[wallet] = true
+					}
+				}
+			}
+		}
+	}
+	return func(key *ChainAuthArgs) bool {
+		if spaceId != (shared.StreamId{}) && key.spaceId != spaceId {
+			return false
+		}
+		return len(principals) == 0 || principals[key.principal] || principals[key.walletAddress]
+	}
+}
+
+func newCacheDumpEntry(
+	cache string,
+	negative bool,
+	key ChainAuthArgs,
+	val entitlementCacheValue,
+	ttl time.Duration,
+	redact bool,
+) CacheDumpEntry {
+	address := func(addr common.Address) string {
+		if addr == (common.Address{}) {
+			return ""
+		}
+		if redact {
+			return redactAddress(addr)
+		}
+		return addr.Hex()
+	}
+	addresses := func(addrs []common.Address) []string {
+		ret := make([]string, len(addrs))
+		for i, addr := range addrs {
+			ret[i] = address(addr)
+		}
+		return ret
+	}
+
+	entry := CacheDumpEntry{
+		Cache:            cache,
+		Negative:         negative,
+		Kind:             key.kind.String(),
+		SpaceId:          key.spaceId,
+		ChannelId:        key.channelId,
+		Principal:        address(key.principal),
+		WalletAddress:    address(key.walletAddress),
+		CustomPermission: key.customPermission,
+		Generation:       key.generation,
+		ChainId:          key.chainId,
+		Allowed:          val.IsAllowed(),
+		Reason:           val.Reason().String(),
+		StoredAt:         val.GetTimestamp(),
+	}
+	if key.kind == chainAuthKindSpace || key.kind == chainAuthKindChannel || key.kind == chainAuthKindChannelModerator ||
+		key.kind == chainAuthKindApp {
+		entry.Permission = key.permission.String()
+	}
+	if key.permissions != "" {
+		entry.Permission = ""
+		for _, permission := range deserializePermissions(key.permissions) {
+			entry.Permissions = append(entry.Permissions, permission.String())
+		}
+		entry.PermissionMode = key.permissionMode.String()
+	}
+	if key.hasPreFetchedWallets {
+		entry.LinkedWallets = addresses(deserializeWallets(key.preFetchedWallets))
+	} else if key.linkedWallets != "" {
+		entry.LinkedWallets = addresses(deserializeWallets(key.linkedWallets))
+	}
+
+	tsVal, ok := val.(*timestampedCacheValue)
+	if !ok {
+		entry.ExpiresAt = entry.StoredAt.Add(ttl)
+		return entry
+	}
+	entry.ExpiresAt = tsVal.timestamp.Add(ttl + tsVal.ttlJitter)
+	if !tsVal.expiresAt.IsZero() && tsVal.expiresAt.Before(entry.ExpiresAt) {
+		entry.ExpiresAt = tsVal.expiresAt
+	}
+
+	switch result := tsVal.result.(type) {
+	case *membershipStatusCacheResult:
+		if status := result.status; status != nil {
+			entry.Value = map[string]any{
+				"isMember":   status.IsMember,
+				"isExpired":  status.IsExpired,
+				"expiryTime": status.ExpiryTime,
+				"expiredAt":  status.ExpiredAt,
+			}
+		}
+	case *linkedWalletCacheValue:
+		entry.Value = map[string]any{"wallets": addresses(result.wallets)}
+	case *bannedWalletsCacheResult:
+		wallets := slices.SortedFunc(maps.Keys(result.wallets), common.Address.Cmp)
+		entry.Value = map[string]any{"wallets": addresses(wallets)}
+	case *walletSetCacheResult:
+		entry.Value = map[string]any{"walletSetDigest": result.walletSetDigest}
+		if !result.dataCachedAt.IsZero() {
+			entry.Value["dataCachedAt"] = result.dataCachedAt
+		}
+	case *entitlementCacheResult:
+		types := make([]string, len(result.entitlementData))
+		for i, entitlement := range result.entitlementData {
+			types[i] = entitlement.EntitlementType
+		}
+		entry.Value = map[string]any{
+			"owner":            address(result.owner),
+			"entitlementTypes": types,
+		}
+	}
+	return entry
+}
+
+// redactAddress returns a digest of addr that identifies it within dumps without revealing it.
+func redactAddress(addr common.Address) string {
+	return "redacted:" + common.Bytes2Hex(ethCrypto.Keccak256(addr.Bytes())[:8])
+}
@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+
+	"github.com/towns-protocol/towns/core/config"
+	"github.com/towns-protocol/towns/core/node/base/test"
+	"github.com/towns-protocol/towns/core/node/shared"
+	"github.com/towns-protocol/towns/core/node/testutils"
+)
+
+func TestDumpCache(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	alice := common.HexToAddress("0xa11ce")
+	bob := common.HexToAddress("0xb0b")
+	bobHot := common.HexToAddress("0xb0b1")
+	spaceContract := newFakeSpaceContract(common.HexToAddress("0x0e"), alice, bob)
+	ca := newTestChainAuth(t, ctx, spaceContract)
+	space1 := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+	space2 := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+
+	for _, args := range []*ChainAuthArgs{
+		NewChainAuthArgsForSpace(space1, bob.Hex(), PermissionWrite),
+		NewChainAuthArgsForSpace(space2, bob.Hex(), PermissionWrite),
+		NewChainAuthArgsForSpace(space1, alice.Hex(), PermissionWrite),
+	} {
+		result, err := ca.IsEntitled(ctx, cfg, args)
+		require.NoError(t, err)
+		require.True(t, result.IsEntitled())
+	}
+	result, err := ca.IsEntitled(ctx, cfg, NewChainAuthArgsForIsSpaceMember(space1, bobHot.Hex()))
+	require.NoError(t, err)
+	require.False(t, result.IsEntitled())
+
+	// bob has a linked wallet, which is not a member of the space.
+	ca.linkedWalletCache.positiveCache.Add(*newArgsForLinkedWallets(bob), &timestampedCacheValue{
+		result:    &linkedWalletCacheValue{wallets: []common.Address{bob, bobHot}},
+		timestamp: time.Now(),
+	})
+
+	find := func(dump CacheDump, cache string, spaceId shared.StreamId, principal string) *CacheDumpEntry {
+		for i, entry := range dump.Entries {
+			if entry.Cache == cache && entry.SpaceId == spaceId && entry.Principal == principal {
+				return &dump.Entries[i]
+			}
+		}
+		return nil
+	}
+
+	// The entries of bob in space1, including the membership of his linked wallet.
+	dump := ca.DumpCache(CacheDumpFilter{SpaceId: space1, Principal: bob})
+	require.False(t, dump.Truncated)
+	for _, entry := range dump.Entries {
+		require.Equal(t, space1, entry.SpaceId)
+		require.Contains(t, []string{bob.Hex(), bobHot.Hex()}, entry.Principal)
+	}
+
+	entitlement := find(dump, "entitlement", space1, bob.Hex())
+	require.NotNil(t, entitlement)
+	require.Equal(t, "space", entitlement.Kind)
+	require.Equal(t, PermissionWrite.String(), entitlement.Permission)
+	require.True(t, entitlement.Allowed)
+	require.False(t, entitlement.Negative)
+	require.False(t, entitlement.Expired)
+	require.Equal(t, []string{bob.Hex()}, entitlement.LinkedWallets)
+	require.False(t, entitlement.StoredAt.IsZero())
+	require.True(t, entitlement.ExpiresAt.After(entitlement.StoredAt))
+
+	membership := find(dump, "membership", space1, bob.Hex())
+	require.NotNil(t, membership)
+	require.True(t, membership.Allowed)
+	require.Equal(t, true, membership.Value["isMember"])
+
+	hotMembership := find(dump, "membership", space1, bobHot.Hex())
+	require.NotNil(t, hotMembership)
+	require.False(t, hotMembership.Allowed)
+	require.True(t, hotMembership.Negative)
+	require.Equal(t, EntitlementResultReason_MEMBERSHIP.String(), hotMembership.Reason)
+
+	// Filtering by principal only returns the entries of bob in both spaces, and his linked wallets.
+	dump = ca.DumpCache(CacheDumpFilter{Principal: bob})
+	require.NotNil(t, find(dump, "entitlement", space2, bob.Hex()))
+	require.NotNil(t, find(dump, "linkedWallet", shared.StreamId{}, bob.Hex()))
+	require.Nil(t, find(dump, "entitlement", space1, alice.Hex()))
+
+	// Filtering by space only returns the entries of all principals in the space.
+	dump = ca.DumpCache(CacheDumpFilter{SpaceId: space1})
+	require.NotNil(t, find(dump, "entitlement", space1, alice.Hex()))
+	require.NotNil(t, find(dump, "entitlement", space1, bob.Hex()))
+	require.Nil(t, find(dump, "entitlement", space2, bob.Hex()))
+
+	// Redacted dumps don't contain the addresses, but entries of the same address can still be correlated.
+	dump = ca.DumpCache(CacheDumpFilter{SpaceId: space1, RedactAddresses: true})
+	data, err := json.Marshal(dump)
+	require.NoError(t, err)
+	for _, addr := range []common.Address{alice, bob, bobHot} {
+		require.NotContains(t, string(data), addr.Hex())
+		require.NotContains(t, string(data), addr.Hex()[2:])
+	}
+	entitlement = find(dump, "entitlement", space1, redactAddress(bob))
+	require.NotNil(t, entitlement)
+	require.Equal(t, []string{redactAddress(bob)}, entitlement.LinkedWallets)
+	require.NotNil(t, find(dump, "membership", space1, redactAddress(bob)))
+}
@@ -0,0 +1,281 @@
+package auth
+
+import (
+	"context"
+	"math"
+	"reflect"
+	runtimeMetrics "runtime/metrics"
+	"time"
+	"unsafe"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/towns-protocol/towns/core/config"
+	"github.com/towns-protocol/towns/core/node/infra"
+	"github.com/towns-protocol/towns/core/node/logging"
+)
+
+const (
+	DEFAULT_CACHE_MEMORY_RECONCILE_INTERVAL = 5 * time.Minute
+	DEFAULT_CACHE_MEMORY_SAMPLE_SIZE        = 100
+	DEFAULT_CACHE_MEMORY_DRIFT_TOLERANCE    = 0.25
+
+	heapObjectsMetric = "/memory/classes/heap/objects:bytes"
+)
+
+// cacheMemory reports the memory held by the entries of the entitlement caches. The size of the entries is
+// accounted for as they are inserted and evicted with the size functions of their types, see cacheResultSize,
+// and periodically reconciled with a deep measurement of a sample of the entries, so that size functions
+// that drift from the actual layout of the entries are detected. The sampled figures are also reported as a
+// share of the live heap objects reported by the Go runtime, to compare nodes.
+type cacheMemory struct {
+	caches     cacheMemoryCaches
+	interval   time.Duration
+	sampleSize int
+	tolerance  float64
+
+	accounted *prometheus.GaugeVec
+	sampled   *prometheus.GaugeVec
+	drift     *prometheus.CounterVec
+	heapShare prometheus.Gauge
+}
+
+// cacheMemoryCaches maps the name a cache is reported under to the cache.
+type cacheMemoryCaches map[string]*entitlementCache
+
+// newCacheMemory accounts for the memory held by the entries of caches by name, the caches without a size
+// limiter get one without a cap.
+func newCacheMemory(
+	cfg *config.ChainConfig,
+	metrics infra.MetricsFactory,
+	caches cacheMemoryCaches,
+) *cacheMemory {
+	m := &cacheMemory{
+		caches:     caches,
+		interval:   DEFAULT_CACHE_MEMORY_RECONCILE_INTERVAL,
+		sampleSize: DEFAULT_CACHE_MEMORY_SAMPLE_SIZE,
+		tolerance:  DEFAULT_CACHE_MEMORY_DRIFT_TOLERANCE,
+		accounted: metrics.NewGaugeVecEx(
+			"entitlement_cache_accounted_bytes",
+			"Memory held by the entries of the entitlement caches, accounted for as they are inserted and evicted",
+			"cache",
+		),
+		sampled: metrics.NewGaugeVecEx(
+			"entitlement_cache_sampled_bytes",
+			"Memory held by the entries of the entitlement caches, estimated from a deep measurement of a sample",
+			"cache",
+		),
+		drift: metrics.NewCounterVecEx(
+			"entitlement_cache_memory_drift",
+			"Reconciliations whose accounted and sampled memory of an entitlement cache differ past the tolerance",
+			"cache",
+		),
+		heapShare: metrics.NewGaugeEx(
+			"entitlement_cache_heap_share",
+			"Fraction of the live heap objects reported by the Go runtime held by the entitlement caches",
+		),
+	}
+	if cfg.EntitlementCacheMemoryReconcileInterval != 0 {
+		m.interval = cfg.EntitlementCacheMemoryReconcileInterval
+	}
+	if cfg.EntitlementCacheMemorySampleSize > 0 {
+		m.sampleSize = cfg.EntitlementCacheMemorySampleSize
+	}
+	if cfg.EntitlementCacheMemoryDriftTolerance > 0 {
+		m.tolerance = cfg.EntitlementCacheMemoryDriftTolerance
+	}
+	for name, ec := range caches {
+		if ec.sizeLimiter == nil {
+			ec.sizeLimiter = newCacheSizeLimiter(cacheResultSize, 0, 0, nil)
+		}
+		ec.sizeLimiter.accounted = m.accounted.WithLabelValues(name)
+	}
+	return m
+}
+
+// run reconciles the accounted memory of the caches every interval until ctx is done.
+func (m *cacheMemory) run(ctx context.Context) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.reconcile(ctx)
+		}
+	}
+}
+
+// reconcile reports the sampled memory of the caches and counts those whose accounted memory drifted from it.
+func (m *cacheMemory) reconcile(ctx context.Context) {
+	var sampledTotal float64
+	for name, ec := range m.caches {
+		accounted, sampled := ec.sizeLimiter.sample(ec, m.sampleSize)
+		m.sampled.WithLabelValues(name).Set(sampled)
+		sampledTotal += sampled
+		if sampled > 0 && math.Abs(float64(accounted)-sampled) > m.tolerance*sampled {
+			m.drift.WithLabelValues(name).Inc()
+			logging.FromCtx(ctx).Warnw(
+				"Accounted memory of the entitlement cache drifted from its sampled measurement",
+				"cache", name,
+				"accountedBytes", accounted,
+				"sampledBytes", int64(sampled),
+			)
+		}
+	}
+
+	samples := []runtimeMetrics.Sample{{Name: heapObjectsMetric}}
+	runtimeMetrics.Read(samples)
+	if samples[0].Value.Kind() == runtimeMetrics.KindUint64 && samples[0].Value.Uint64() > 0 {
+		m.heapShare.Set(sampledTotal / float64(samples[0].Value.Uint64()))
+	}
+}
+
+// sample measures up to n of the entries of ec and returns the accounted memory of ec along with the memory
+// estimated from the ratio of the measured to the accounted size of the sampled entries. Entries the ARC
+// caches evicted but the accounting hasn't dropped yet hold no memory.
+func (l *cacheSizeLimiter) sample(ec *entitlementCache, n int) (accounted int64, sampled float64) {
+	type sampledEntry struct {
+		key  ChainAuthArgs
+		size int
+	}
+	l.mu.Lock()
+	accounted = l.total
+	entries := make([]sampledEntry, 0, min(n, len(l.entries)))
+	for key, entry := range l.entries {
+		if len(entries) == n {
+			break
+		}
+		entries = append(entries, sampledEntry{key, entry.size})
+	}
+	l.mu.Unlock()
+
+	var accountedSample, measuredSample int
+	for _, entry := range entries {
+		accountedSample += entry.size
+		val, ok := ec.positiveCache.Peek(entry.key)
+		if !ok {
+			val, ok = ec.negativeCache.Peek(entry.key)
+		}
+		if ok {
+			measuredSample += measuredEntrySize(&entry.key, val)
+		}
+	}
+	if accountedSample == 0 {
+		return accounted, float64(accounted)
+	}
+	return accounted, float64(accounted) * float64(measuredSample) / float64(accountedSample)
+}
+
+// measuredEntrySize measures the memory held by a cache entry by walking the memory reachable from its key
+// and value, along with the same ARC bookkeeping overhead as the accounting.
+func measuredEntrySize(key *ChainAuthArgs, val entitlementCacheValue) int {
+	seen := map[uintptr]struct{}{}
+	return int(unsafe.Sizeof(*key)) + reachableSize(reflect.ValueOf(key).Elem(), seen) +
+		reachableSize(reflect.ValueOf(&val).Elem(), seen) + arcEntryOverhead
+}
+
+var timeType = reflect.TypeFor[time.Time]()
+
+// reachableSize returns the memory reachable from v outside of v itself, counting the memory reachable
+// through several references once. The locations of times are shared and not counted.
+func reachableSize(v reflect.Value, seen map[uintptr]struct{}) int {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() || !visit(v.Pointer(), seen) {
+			return 0
+		}
+		return int(v.Type().Elem().Size()) + reachableSize(v.Elem(), seen)
+	case reflect.Interface:
+		if v.IsNil() {
+			return 0
+		}
+		elem := v.Elem()
+		switch elem.Kind() {
+		case reflect.Pointer, reflect.Map:
+			return reachableSize(elem, seen)
+		default:
+			// Other values are boxed in their own allocation.
+			return int(elem.Type().Size()) + reachableSize(elem, seen)
+		}
+	case reflect.String:
+		if v.Len() == 0 || !visit(uintptr(unsafe.Pointer(unsafe.StringData(v.String()))), seen) {
+			return 0
+		}
+		return v.Len()
+	case reflect.Slice:
+		if v.IsNil() || v.Cap() == 0 || !visit(v.Pointer(), seen) {
+			return 0
+		}
+		size := v.Cap() * int(v.Type().Elem().Size())
+		if hasReferences(v.Type().Elem()) {
+			for i := range v.Len() {
+				size += reachableSize(v.Index(i), seen)
+			}
+		}
+		return size
+	case reflect.Array:
+		size := 0
+		if hasReferences(v.Type().Elem()) {
+			for i := range v.Len() {
+				size += reachableSize(v.Index(i), seen)
+			}
+		}
+		return size
+	case reflect.Struct:
+		if v.Type() == timeType {
+			return 0
+		}
+		size := 0
+		for i := range v.NumField() {
+			size += reachableSize(v.Field(i), seen)
+		}
+		return size
+	case reflect.Map:
+		if v.IsNil() || !visit(v.Pointer(), seen) {
+			return 0
+		}
+		size := mapSize(v.Len(), int(v.Type().Key().Size()+v.Type().Elem().Size()))
+		if hasReferences(v.Type().Key()) || hasReferences(v.Type().Elem()) {
+			iter := v.MapRange()
+			for iter.Next() {
+				size += reachableSize(iter.Key(), seen) + reachableSize(iter.Value(), seen)
+			}
+		}
+		return size
+	default:
+		return 0
+	}
+}
+
+// visit marks the memory at p as seen and returns true if it wasn't already.
+func visit(p uintptr, seen map[uintptr]struct{}) bool {
+	if _, ok := seen[p]; ok {
+		return false
+	}
+	seen[p] = struct{}{}
+	return true
+}
+
+// hasReferences returns true if values of t may reference memory outside of themselves.
+func hasReferences(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Pointer, reflect.Interface, reflect.String, reflect.Slice, reflect.Map:
+		return true
+	case reflect.Array:
+		return hasReferences(t.Elem())
+	case reflect.Struct:
+		if t == timeType {
+			return false
+		}
+		for i := range t.NumField() {
+			if hasReferences(t.Field(i).Type) {
+				return true
+			}
+		}
+		return false
+	default:
+		return false
+	}
+}
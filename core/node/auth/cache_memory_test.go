@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"context"
+	"math/big"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/towns-protocol/towns/core/config"
+	"github.com/towns-protocol/towns/core/node/base/test"
+	"github.com/towns-protocol/towns/core/node/infra"
+	"github.com/towns-protocol/towns/core/node/shared"
+	"github.com/towns-protocol/towns/core/xchain/entitlement"
+)
+
+// randomCacheResult returns a result of one of the types cached by chainAuth, with payloads of random sizes.
+func randomCacheResult(r *rand.Rand) CacheResult {
+	addresses := func() []common.Address {
+		ret := make([]common.Address, r.IntN(20))
+		for i := range ret {
+			ret[i] = common.BigToAddress(big.NewInt(r.Int64()))
+		}
+		return ret
+	}
+	switch r.IntN(7) {
+	case 0:
+		return boolCacheResult{isAllowed: r.IntN(2) == 0, reason: EntitlementResultReason_MEMBERSHIP}
+	case 1:
+		return &walletSetCacheResult{CacheResult: boolCacheResult{isAllowed: true}}
+	case 2:
+		return &ruleDenialCacheResult{
+			boolCacheResult: boolCacheResult{reason: EntitlementResultReason_SPACE_ENTITLEMENTS},
+			ruleDenial:      &entitlement.RuleDenial{ChainId: big.NewInt(1), Threshold: big.NewInt(r.Int64())},
+		}
+	case 3:
+		status := &MembershipStatus{IsMember: true, ExpiryTime: big.NewInt(r.Int64())}
+		for range r.IntN(5) {
+			status.TokenIds = append(status.TokenIds, big.NewInt(r.Int64()))
+		}
+		return &membershipStatusCacheResult{status: status}
+	case 4:
+		return &linkedWalletCacheValue{wallets: addresses()}
+	case 5:
+		wallets := map[common.Address]struct{}{}
+		for _, wallet := range addresses() {
+			wallets[wallet] = struct{}{}
+		}
+		return &bannedWalletsCacheResult{wallets: wallets}
+	default:
+		return &entitlementCacheResult{
+			allowed:         true,
+			entitlementData: syntheticRuleEntitlements(1+r.IntN(16), r.IntN(512)),
+		}
+	}
+}
+
+// measuredCacheSize measures all the entries of ec.
+func measuredCacheSize(ec *entitlementCache) int64 {
+	var total int64
+	for _, cache := range []interface {
+		Keys() []ChainAuthArgs
+		Peek(ChainAuthArgs) (entitlementCacheValue, bool)
+	}{ec.positiveCache, ec.negativeCache} {
+		for _, key := range cache.Keys() {
+			if val, ok := cache.Peek(key); ok {
+				total += int64(measuredEntrySize(&key, val))
+			}
+		}
+	}
+	return total
+}
+
+func TestCacheMemoryAccounting(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	chainCfg := &config.ChainConfig{PositiveEntitlementCacheSize: 512, NegativeEntitlementCacheSize: 256}
+	ec, err := newEntitlementCache(ctx, chainCfg, nil)
+	require.NoError(t, err)
+	memory := newCacheMemory(
+		chainCfg,
+		infra.NewMetricsFactory(prometheus.NewRegistry(), "", ""),
+		cacheMemoryCaches{"entitlement": ec},
+	)
+
+	r := rand.New(rand.NewPCG(1, 2))
+	keys := make([]*ChainAuthArgs, 2000)
+	for i := range keys {
+		principal := common.BigToAddress(big.NewInt(int64(i)))
+		spaceId := shared.SpaceIdFromAddress(common.BigToAddress(big.NewInt(int64(i % 7))))
+		keys[i] = NewChainAuthArgsForSpace(spaceId, principal.Hex(), PermissionRead)
+		if i%3 == 0 {
+			keys[i] = keys[i].WithLinkedWallets([]common.Address{principal, common.BigToAddress(big.NewInt(r.Int64()))})
+		}
+	}
+
+	// Inserts, evictions by the ARC caches and removals keep the accounted memory within the tolerance of the
+	// measured memory of the entries.
+	for i := range 10000 {
+		key := keys[r.IntN(len(keys))]
+		if r.IntN(5) == 0 {
+			ec.bust(key)
+		} else {
+			result := randomCacheResult(r)
+			_, _, err := ec.executeUsingCache(
+				withForceRefresh(ctx),
+				cfg,
+				key,
+				func(context.Context, *config.Config, *ChainAuthArgs) (CacheResult, error) {
+					return result, nil
+				},
+			)
+			require.NoError(t, err)
+		}
+		if i%500 == 499 {
+			measured := measuredCacheSize(ec)
+			require.InEpsilon(t, measured, ec.sizeLimiter.total, 0.1, "after %d operations", i+1)
+		}
+	}
+	require.Equal(t, float64(ec.sizeLimiter.total), testutil.ToFloat64(memory.accounted.WithLabelValues("entitlement")))
+
+	// The sampled figure of a cache sampled whole is its measured memory.
+	memory.sampleSize = len(keys)
+	memory.reconcile(ctx)
+	require.InEpsilon(
+		t,
+		measuredCacheSize(ec),
+		testutil.ToFloat64(memory.sampled.WithLabelValues("entitlement")),
+		0.1,
+	)
+	require.Zero(t, testutil.ToFloat64(memory.drift.WithLabelValues("entitlement")))
+	require.Greater(t, testutil.ToFloat64(memory.heapShare), float64(0))
+
+	// A size function that misses the payloads of the entries is detected by the reconciliation.
+	ec.sizeLimiter.sizeOf = func(CacheResult) int { return 0 }
+	ec.flush()
+	for _, key := range keys[:50] {
+		_, _, err := ec.executeUsingCache(
+			ctx,
+			cfg,
+			key,
+			func(context.Context, *config.Config, *ChainAuthArgs) (CacheResult, error) {
+				return &entitlementCacheResult{allowed: true, entitlementData: syntheticRuleEntitlements(16, 1024)}, nil
+			},
+		)
+		require.NoError(t, err)
+	}
+	memory.reconcile(ctx)
+	require.Equal(t, float64(1), testutil.ToFloat64(memory.drift.WithLabelValues("entitlement")))
+}
@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+
+	"github.com/towns-protocol/towns/core/config"
+	"github.com/towns-protocol/towns/core/node/base/test"
+	"github.com/towns-protocol/towns/core/node/shared"
+	"github.com/towns-protocol/towns/core/node/testutils"
+)
+
+// hangingSpaceContract delays membership lookups until the delay passes or the context of the call is done.
+type hangingSpaceContract struct {
+	*fakeSpaceContract
+
+	delay time.Duration
+}
+
+func (sc *hangingSpaceContract) GetMembershipStatus(
+	ctx context.Context,
+	spaceId shared.StreamId,
+	user common.Address,
+) (*MembershipStatus, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(sc.delay):
+		return sc.fakeSpaceContract.GetMembershipStatus(ctx, spaceId, user)
+	}
+}
+
+func TestCallTimeout(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	alice := common.HexToAddress("0xa11ce")
+	spaceContract := &hangingSpaceContract{
+		fakeSpaceContract: newFakeSpaceContract(common.HexToAddress("0x0e"), alice),
+		delay:             300 * time.Millisecond,
+	}
+	ca := newTestChainAuth(t, ctx, spaceContract)
+	defer ca.Close()
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+	args := NewChainAuthArgsForSpace(spaceId, alice.Hex(), PermissionRead)
+	require.Greater(t, time.Duration(ca.contractCallsTimeoutMs)*time.Millisecond, spaceContract.delay)
+
+	// A short timeout aborts the slow membership lookup the contract calls timeout waits for.
+	start := time.Now()
+	_, err := ca.IsEntitled(ctx, cfg, args.WithTimeout(20*time.Millisecond))
+	require.Error(t, err)
+	require.Less(t, time.Since(start), spaceContract.delay)
+
+	// The ceiling caps long timeouts.
+	ca.maxCallTimeout = 20 * time.Millisecond
+	start = time.Now()
+	_, err = ca.IsEntitled(ctx, cfg, args.WithTimeout(time.Hour))
+	require.Error(t, err)
+	require.Less(t, time.Since(start), spaceContract.delay)
+
+	result, err := ca.IsEntitled(ctx, cfg, args)
+	require.NoError(t, err)
+	require.True(t, result.IsEntitled())
+
+	// The timeout is not part of the cache key.
+	result, err = ca.IsEntitled(ctx, cfg, args.WithTimeout(20*time.Millisecond))
+	require.NoError(t, err)
+	require.True(t, result.IsEntitled())
+	require.True(t, DetailsOf(result).FromCache)
+}
@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	. "github.com/towns-protocol/towns/core/node/base"
+	"github.com/towns-protocol/towns/core/node/logging"
+)
+
+// DEFAULT_SLOW_CHECK_THRESHOLD is the default duration past which IsEntitled checks are logged with the
+// time spent in each stage.
+const DEFAULT_SLOW_CHECK_THRESHOLD = time.Second
+
+// Stages of an entitlement check timed by checkTrace.
+const (
+	checkStageComputeWait    = "computeWait"
+	checkStageStreamEnabled  = "streamEnabled"
+	checkStageLinkedWallets  = "linkedWallets"
+	checkStageMembership     = "membership"
+	checkStageBanList        = "banList"
+	checkStageEntitlements   = "entitlementFetch"
+	checkStageRuleEvaluation = "ruleEvaluation"
+	checkStagePolicyHooks    = "policyHooks"
+)
+
+// checkTrace correlates the work done for a single IsEntitled check. Its id is added to the logger of the
+// context of the check, so that the log lines of the nested contract calls share it, and it accumulates the
+// time spent in each stage of the check. Stages running concurrently, e.g. the membership calls of several
+// wallets, are added up.
+type checkTrace struct {
+	id    string
+	start time.Time
+
+	mu     sync.Mutex
+	stages map[string]time.Duration
+}
+
+type checkTraceCtxKey struct{}
+
+// withCheckTrace returns a context carrying a new checkTrace and a logger tagged with its id.
+func withCheckTrace(ctx context.Context) (context.Context, *checkTrace) {
+	trace := &checkTrace{
+		id:     GenShortNanoid(),
+		start:  time.Now(),
+		stages: make(map[string]time.Duration),
+	}
+	ctx = logging.CtxWithLog(ctx, logging.FromCtx(ctx).With("entitlementCheckId", trace.id))
+	return context.WithValue(ctx, checkTraceCtxKey{}, trace), trace
+}
+
+// traceStage starts timing stage for the check of ctx and returns the function that stops it. It does nothing
+// if ctx has no checkTrace, e.g. for cache warming.
+func traceStage(ctx context.Context, stage string) func() {
+	trace, ok := ctx.Value(checkTraceCtxKey{}).(*checkTrace)
+	if !ok {
+		return func() {}
+	}
+	start := time.Now()
+	return func() {
+		elapsed := time.Since(start)
+		trace.mu.Lock()
+		trace.stages[stage] += elapsed
+		trace.mu.Unlock()
+	}
+}
+
+// logIfSlow logs the time spent in each stage if the check took longer than threshold.
+func (t *checkTrace) logIfSlow(ctx context.Context, threshold time.Duration) {
+	total := time.Since(t.start)
+	if total <= threshold {
+		return
+	}
+
+	t.mu.Lock()
+	stages := make([]string, 0, len(t.stages))
+	for stage := range t.stages {
+		stages = append(stages, stage)
+	}
+	slices.Sort(stages)
+	keysAndValues := []any{"total", total, "threshold", threshold}
+	for _, stage := range stages {
+		keysAndValues = append(keysAndValues, stage, t.stages[stage])
+	}
+	t.mu.Unlock()
+
+	logging.FromCtx(ctx).Warnw("Slow entitlement check", keysAndValues...)
+}
@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/towns-protocol/towns/core/config"
+	"github.com/towns-protocol/towns/core/node/base/test"
+	"github.com/towns-protocol/towns/core/node/logging"
+	"github.com/towns-protocol/towns/core/node/shared"
+	"github.com/towns-protocol/towns/core/node/testutils"
+)
+
+func TestCheckTrace(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	core, logs := observer.New(zapcore.DebugLevel)
+	logger := zap.New(core)
+	sugar := logger.Sugar()
+	ctx = logging.CtxWithLog(ctx, &logging.Log{
+		RootLogger: logger,
+		Default:    sugar,
+		Miniblock:  sugar,
+		Rpc:        sugar,
+	})
+
+	cfg := &config.Config{}
+	alice := common.HexToAddress("0xa11ce")
+	ca := newTestChainAuth(t, ctx, newFakeSpaceContract(common.HexToAddress("0x0e"), alice))
+	defer ca.Close()
+	require.Equal(t, DEFAULT_SLOW_CHECK_THRESHOLD, ca.slowCheckThreshold)
+
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+	checkIds := func() map[any]bool {
+		ids := make(map[any]bool)
+		for _, entry := range logs.TakeAll() {
+			if id, ok := entry.ContextMap()["entitlementCheckId"]; ok {
+				ids[id] = true
+			}
+		}
+		return ids
+	}
+
+	// All the log lines of a check share its id, and fast checks don't log a summary.
+	result, err := ca.IsEntitled(ctx, cfg, NewChainAuthArgsForSpace(spaceId, alice.Hex(), PermissionRead))
+	require.NoError(t, err)
+	require.True(t, result.IsEntitled())
+	require.Equal(t, 0, logs.FilterMessage("Slow entitlement check").Len())
+	require.Len(t, checkIds(), 1)
+
+	// Checks taking longer than the threshold log the time spent in each stage.
+	ca.slowCheckThreshold = time.Nanosecond
+	_, err = ca.IsEntitled(ctx, cfg, NewChainAuthArgsForSpace(spaceId, alice.Hex(), PermissionWrite))
+	require.NoError(t, err)
+	slow := logs.FilterMessage("Slow entitlement check").All()
+	require.Len(t, slow, 1)
+	fields := slow[0].ContextMap()
+	require.Contains(t, fields, "entitlementCheckId")
+	require.Contains(t, fields, "total")
+	require.Contains(t, fields, checkStageEntitlements)
+	require.Contains(t, fields, checkStageRuleEvaluation)
+	require.Contains(t, fields, checkStagePolicyHooks)
+	require.Len(t, checkIds(), 1)
+}
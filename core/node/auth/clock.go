@@ -0,0 +1,27 @@
+package auth
+
+import "time"
+
+// Clock tells the time the caches of chainAuth expire their entries and memberships at, tests replace it to
+// control the expiry without waiting.
+type Clock interface {
+	Now() time.Time
+}
+
+// realClock is the system clock.
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// setClock makes ca and its caches read the time from clock, the system clock if nil.
+func (ca *chainAuth) setClock(clock Clock) {
+	if clock == nil {
+		clock = realClock{}
+	}
+	ca.clock = clock
+	for _, ec := range ca.caches() {
+		ec.clock = clock
+	}
+}
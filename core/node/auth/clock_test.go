@@ -0,0 +1,188 @@
+package auth
+
+import (
+	"context"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/towns-protocol/towns/core/config"
+	"github.com/towns-protocol/towns/core/node/base/test"
+	"github.com/towns-protocol/towns/core/node/crypto"
+	"github.com/towns-protocol/towns/core/node/infra"
+	"github.com/towns-protocol/towns/core/node/shared"
+	"github.com/towns-protocol/towns/core/node/testutils"
+)
+
+// fakeClock is a clock that only moves when advanced.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Unix(1_700_000_000, 0)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestCacheExpiryFollowsClock(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	clock := newFakeClock()
+	c, err := newEntitlementCache(ctx, &config.ChainConfig{
+		PositiveEntitlementCacheTTLSeconds: 100,
+		NegativeEntitlementCacheTTLSeconds: 10,
+	}, nil)
+	require.NoError(t, err)
+	c.clock = clock
+
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+	calls := 0
+	execute := func(principal string, allowed bool) bool {
+		_, cacheHit, err := c.executeUsingCache(
+			ctx,
+			cfg,
+			NewChainAuthArgsForSpace(spaceId, principal, PermissionRead),
+			func(context.Context, *config.Config, *ChainAuthArgs) (CacheResult, error) {
+				calls++
+				return &simpleCacheResult{allowed: allowed}, nil
+			},
+		)
+		require.NoError(t, err)
+		return cacheHit
+	}
+
+	// Allowed and denied results expire after their own TTLs.
+	require.False(t, execute("1", true))
+	require.False(t, execute("2", false))
+	clock.advance(9 * time.Second)
+	require.True(t, execute("1", true))
+	require.True(t, execute("2", false))
+	clock.advance(time.Second)
+	require.True(t, execute("1", true))
+	require.False(t, execute("2", false))
+	clock.advance(90 * time.Second)
+	require.False(t, execute("1", true))
+	require.Equal(t, 4, calls)
+
+	// The jitter of an entry moves its expiry by up to the given percent of the TTL.
+	c.setExpiryJitter(10)
+	for i := range 20 {
+		principal := common.BigToAddress(big.NewInt(int64(100 + i))).Hex()
+		args := NewChainAuthArgsForSpace(spaceId, principal, PermissionRead)
+		require.False(t, execute(principal, true))
+		val, ok := c.positiveCache.Peek(*c.withGeneration(args))
+		require.True(t, ok)
+		jitter := val.(*timestampedCacheValue).ttlJitter
+		require.LessOrEqual(t, jitter.Abs(), 10*time.Second)
+
+		expiry := clock.Now().Add(c.positiveCacheTTL + jitter)
+		require.True(t, isFresh(val, c.positiveCacheTTL, expiry.Add(-time.Nanosecond)))
+		require.False(t, isFresh(val, c.positiveCacheTTL, expiry))
+	}
+}
+
+// clockMembershipSpaceContract expires the memberships of expiringMembershipSpaceContract by the time of clock.
+type clockMembershipSpaceContract struct {
+	*expiringMembershipSpaceContract
+
+	clock Clock
+}
+
+func (sc *clockMembershipSpaceContract) GetMembershipStatus(
+	ctx context.Context,
+	spaceId shared.StreamId,
+	user common.Address,
+) (*MembershipStatus, error) {
+	status, err := sc.expiringMembershipSpaceContract.GetMembershipStatus(ctx, spaceId, user)
+	if err == nil && status.IsMember {
+		status.IsExpired = sc.clock.Now().Unix() >= sc.expiries[user]
+	}
+	return status, err
+}
+
+func TestMembershipExpiryFollowsClock(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	alice := common.HexToAddress("0xa11ce")
+	clock := newFakeClock()
+	expiry := clock.Now().Add(time.Minute)
+	spaceContract := &clockMembershipSpaceContract{
+		expiringMembershipSpaceContract: &expiringMembershipSpaceContract{
+			fakeSpaceContract: newFakeSpaceContract(common.HexToAddress("0x0e"), alice),
+			expiries:          map[common.Address]int64{alice: expiry.Unix()},
+		},
+		clock: clock,
+	}
+	ca := newTestChainAuth(t, ctx, spaceContract)
+	defer ca.Close()
+	ca.setClock(clock)
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+	args := NewChainAuthArgsForSpace(spaceId, alice.Hex(), PermissionRead)
+
+	result, err := ca.IsEntitled(ctx, cfg, args)
+	require.NoError(t, err)
+	require.True(t, result.IsEntitled())
+	require.True(t, expiry.Equal(DetailsOf(result).ValidUntil))
+
+	// The membership is served from the cache until it expires, then the check sees it expired.
+	clock.advance(59 * time.Second)
+	result, err = ca.IsEntitled(ctx, cfg, args)
+	require.NoError(t, err)
+	require.True(t, result.IsEntitled())
+	require.True(t, DetailsOf(result).FromCache)
+
+	clock.advance(time.Second)
+	result, err = ca.IsEntitled(ctx, cfg, args)
+	require.NoError(t, err)
+	require.False(t, result.IsEntitled())
+	require.Equal(t, EntitlementResultReason_MEMBERSHIP_EXPIRED, result.Reason())
+}
+
+func TestNewChainAuthWithClock(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	clock := newFakeClock()
+	ca, err := NewChainAuth(
+		ctx,
+		&crypto.Blockchain{Client: &fakeChainIdClient{}, Config: &config.ChainConfig{}},
+		nil,
+		nil,
+		&config.ContractConfig{},
+		0,
+		0,
+		0,
+		0,
+		nil,
+		infra.NewMetricsFactory(prometheus.NewRegistry(), "", ""),
+		WithClock(clock),
+	)
+	require.NoError(t, err)
+	defer ca.Close()
+
+	require.Same(t, clock, ca.clock)
+	for _, ec := range ca.caches() {
+		require.Same(t, clock, ec.clock)
+	}
+}
@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"context"
+	"errors"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sync/semaphore"
+
+	. "github.com/towns-protocol/towns/core/node/base"
+	"github.com/towns-protocol/towns/core/node/infra"
+	. "github.com/towns-protocol/towns/core/node/protocol"
+)
+
+const DEFAULT_MAX_CONCURRENT_UNCACHED_CHECKS = 64
+
+// computeLimiter bounds the number of entitlement checks computed concurrently on cache misses. Each check
+// fans out into contract calls per linked wallet, so a storm of misses, e.g. after a big space is invalidated,
+// would otherwise get the node throttled by its RPC providers.
+type computeLimiter struct {
+	limit int
+	sem   *semaphore.Weighted
+
+	// inflight is the number of checks being computed, waits counts the checks that had to wait for a slot.
+	inflight prometheus.Gauge
+	waits    prometheus.Counter
+}
+
+func newComputeLimiter(limit int, metrics infra.MetricsFactory) *computeLimiter {
+	if limit <= 0 {
+		limit = DEFAULT_MAX_CONCURRENT_UNCACHED_CHECKS
+	}
+	return &computeLimiter{
+		limit: limit,
+		sem:   semaphore.NewWeighted(int64(limit)),
+		inflight: metrics.NewGaugeEx(
+			"entitlement_uncached_checks_inflight", "Entitlement checks being computed on cache misses"),
+		waits: metrics.NewCounterEx(
+			"entitlement_uncached_check_waits", "Entitlement checks that waited for a computation slot"),
+	}
+}
+
+// acquire reserves a computation slot, waiting until one is released or ctx is done. Returns
+// Err_RESOURCE_EXHAUSTED if no slot became available before the deadline of ctx.
+func (l *computeLimiter) acquire(ctx context.Context) error {
+	if !l.sem.TryAcquire(1) {
+		l.waits.Inc()
+		if err := l.sem.Acquire(ctx, 1); err != nil {
+			if errors.Is(err, context.Canceled) {
+				return AsRiverError(err)
+			}
+			return RiverErrorWithBase(
+				Err_RESOURCE_EXHAUSTED,
+				"Too many concurrent uncached entitlement checks, no slot became available before the deadline",
+				err,
+			).Tag("limit", l.limit)
+		}
+	}
+	l.inflight.Inc()
+	return nil
+}
+
+func (l *computeLimiter) release() {
+	l.inflight.Dec()
+	l.sem.Release(1)
+}
@@ -0,0 +1,221 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/towns-protocol/towns/core/config"
+	. "github.com/towns-protocol/towns/core/node/base"
+	"github.com/towns-protocol/towns/core/node/base/test"
+	"github.com/towns-protocol/towns/core/node/crypto"
+	"github.com/towns-protocol/towns/core/node/infra"
+	. "github.com/towns-protocol/towns/core/node/protocol"
+	"github.com/towns-protocol/towns/core/node/shared"
+	"github.com/towns-protocol/towns/core/node/testutils"
+)
+
+// slowSpaceContract delays membership lookups and records how many run concurrently.
+type slowSpaceContract struct {
+	*fakeSpaceContract
+
+	delay   time.Duration
+	running atomic.Int32
+	peak    atomic.Int32
+}
+
+func (sc *slowSpaceContract) GetMembershipStatus(
+	ctx context.Context,
+	spaceId shared.StreamId,
+	user common.Address,
+) (*MembershipStatus, error) {
+	running := sc.running.Add(1)
+	defer sc.running.Add(-1)
+	for {
+		peak := sc.peak.Load()
+		if running <= peak || sc.peak.CompareAndSwap(peak, running) {
+			break
+		}
+	}
+	time.Sleep(sc.delay)
+	return sc.fakeSpaceContract.GetMembershipStatus(ctx, spaceId, user)
+}
+
+func TestUncachedChecksAreBounded(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	const limit = 8
+	const principals = 200
+	var entitled []common.Address
+	for i := range principals {
+		entitled = append(entitled, common.HexToAddress(fmt.Sprintf("0x%x", i+1)))
+	}
+	spaceContract := &slowSpaceContract{
+		fakeSpaceContract: newFakeSpaceContract(common.HexToAddress("0x0e"), entitled...),
+		delay:             5 * time.Millisecond,
+	}
+	ca, err := newChainAuth(
+		ctx,
+		&crypto.Blockchain{Config: &config.ChainConfig{EntitlementMaxConcurrentChecks: limit}},
+		nil,
+		spaceContract,
+		nil,
+		nil,
+		0,
+		0,
+		0,
+		0,
+		nil,
+		infra.NewMetricsFactory(prometheus.NewRegistry(), "", ""),
+	)
+	require.NoError(t, err)
+
+	// A storm of misses for distinct principals is computed at most limit at a time.
+	cfg := &config.Config{}
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+	var wg sync.WaitGroup
+	for _, principal := range entitled {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := ca.IsEntitled(ctx, cfg, NewChainAuthArgsForSpace(spaceId, principal.Hex(), PermissionRead))
+			require.NoError(t, err)
+			require.True(t, result.IsEntitled())
+		}()
+	}
+	wg.Wait()
+
+	require.LessOrEqual(t, spaceContract.peak.Load(), int32(limit))
+	require.Equal(t, principals, spaceContract.callCount("GetMembershipStatus"))
+	require.Positive(t, testutil.ToFloat64(ca.computeLimiter.waits))
+	require.Zero(t, testutil.ToFloat64(ca.computeLimiter.inflight))
+
+	// Checks that can't get a slot before their deadline fail with RESOURCE_EXHAUSTED.
+	require.NoError(t, ca.computeLimiter.sem.Acquire(ctx, limit))
+	deadlineCtx, deadlineCancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer deadlineCancel()
+	_, err = ca.IsEntitled(deadlineCtx, cfg, NewChainAuthArgsForSpace(spaceId, "0xdead", PermissionRead))
+	require.Equal(t, Err_RESOURCE_EXHAUSTED, AsRiverError(err).Code)
+	ca.computeLimiter.sem.Release(limit)
+}
+
+// startedSpaceContract records the order in which membership lookups start. Lookups of non-members take
+// delay unless their context is cancelled.
+type startedSpaceContract struct {
+	*fakeSpaceContract
+
+	delay   time.Duration
+	mu      sync.Mutex
+	started []common.Address
+}
+
+func (sc *startedSpaceContract) GetMembershipStatus(
+	ctx context.Context,
+	spaceId shared.StreamId,
+	user common.Address,
+) (*MembershipStatus, error) {
+	sc.mu.Lock()
+	sc.started = append(sc.started, user)
+	sc.mu.Unlock()
+	status, err := sc.fakeSpaceContract.GetMembershipStatus(ctx, spaceId, user)
+	if err != nil || status.IsMember {
+		return status, err
+	}
+	select {
+	case <-time.After(sc.delay):
+		return status, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func TestMembershipChecksAreBounded(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	const limit = 3
+	newCa := func(spaceContract SpaceContract) *chainAuth {
+		ca, err := newChainAuth(
+			ctx,
+			&crypto.Blockchain{Config: &config.ChainConfig{}},
+			nil,
+			spaceContract,
+			nil,
+			nil,
+			0,
+			0,
+			limit,
+			0,
+			nil,
+			infra.NewMetricsFactory(prometheus.NewRegistry(), "", ""),
+		)
+		require.NoError(t, err)
+		return ca
+	}
+
+	// Membership lookups of concurrent checks share the limit.
+	cfg := &config.Config{}
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+	spaceContract := &slowSpaceContract{
+		fakeSpaceContract: newFakeSpaceContract(common.HexToAddress("0x0e")),
+		delay:             5 * time.Millisecond,
+	}
+	ca := newCa(spaceContract)
+	var wg sync.WaitGroup
+	for i := range 10 {
+		wallets := make([]common.Address, DEFAULT_MAX_WALLETS)
+		for j := range wallets {
+			wallets[j] = common.BytesToAddress([]byte{0x20, byte(i), byte(j)})
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, err := ca.IsEntitled(ctx, cfg, NewChainAuthArgsForSpaceWithWallets(spaceId, wallets, PermissionRead))
+			require.NoError(t, err)
+			require.False(t, result.IsEntitled())
+		}()
+	}
+	wg.Wait()
+	require.LessOrEqual(t, spaceContract.peak.Load(), int32(limit))
+	require.Equal(t, 10*DEFAULT_MAX_WALLETS, spaceContract.callCount("GetMembershipStatus"))
+
+	// Lookups waiting for a slot are abandoned once a linked wallet is found to be a member.
+	alice := common.HexToAddress("0xa11ce")
+	startedContract := &startedSpaceContract{
+		fakeSpaceContract: newFakeSpaceContract(common.HexToAddress("0x0e"), alice),
+		delay:             20 * time.Millisecond,
+	}
+	ca = newCa(startedContract)
+	wallets := []common.Address{alice}
+	for i := range DEFAULT_MAX_WALLETS - 1 {
+		wallets = append(wallets, common.BytesToAddress([]byte{0x30, byte(i)}))
+	}
+	result, err := ca.IsEntitled(ctx, cfg, NewChainAuthArgsForSpaceWithWallets(spaceId, wallets, PermissionRead))
+	require.NoError(t, err)
+	require.True(t, result.IsEntitled())
+	require.Eventually(t, func() bool {
+		if !ca.membershipChecks.TryAcquire(limit) {
+			return false
+		}
+		ca.membershipChecks.Release(limit)
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Waiters may be handed the slots released before the other lookups are cancelled, but lookups don't
+	// keep starting after that.
+	startedContract.mu.Lock()
+	defer startedContract.mu.Unlock()
+	memberIdx := slices.Index(startedContract.started, alice)
+	require.GreaterOrEqual(t, memberIdx, 0)
+	require.LessOrEqual(t, len(startedContract.started)-memberIdx-1, limit)
+}
@@ -0,0 +1,145 @@
+package auth
+
+import (
+	"context"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/towns-protocol/towns/core/config"
+	"github.com/towns-protocol/towns/core/node/infra"
+	"github.com/towns-protocol/towns/core/node/logging"
+)
+
+const DEFAULT_DENIAL_HOOK_QUEUE_SIZE = 1000
+
+// DenialHook is called with every entitlement check IsEntitled denies, whether the denial was served from
+// the caches or not, e.g. to feed audit and abuse detection. Hooks are called asynchronously, in
+// registration order, on a single background goroutine: a slow hook delays the hooks of later denials, which
+// are dropped once the queue is full, but never the checks. The context carries the values of the context of
+// the check, it isn't cancelled when the check returns.
+type DenialHook func(ctx context.Context, args *ChainAuthArgs, reason EntitlementResultReason)
+
+type denial struct {
+	ctx    context.Context
+	args   ChainAuthArgs
+	reason EntitlementResultReason
+}
+
+// denialHooks delivers the denials of chainAuth to the registered hooks through a bounded queue, denials
+// that don't fit in the queue are dropped and counted.
+type denialHooks struct {
+	// start runs the delivery in a background goroutine, see chainAuth.startWorker.
+	start func(ctx context.Context, f func(ctx context.Context)) error
+
+	mu      sync.Mutex
+	hooks   atomic.Pointer[[]DenialHook]
+	started bool
+	queue   chan denial
+
+	// dropped counts the denials dropped because the queue was full.
+	dropped prometheus.Counter
+}
+
+func newDenialHooks(
+	cfg *config.ChainConfig,
+	metrics infra.MetricsFactory,
+	start func(ctx context.Context, f func(ctx context.Context)) error,
+) *denialHooks {
+	queueSize := DEFAULT_DENIAL_HOOK_QUEUE_SIZE
+	if cfg.EntitlementDenialHookQueueSize > 0 {
+		queueSize = cfg.EntitlementDenialHookQueueSize
+	}
+	return &denialHooks{
+		start: start,
+		queue: make(chan denial, queueSize),
+		dropped: metrics.NewCounterEx(
+			"entitlement_denial_hook_dropped",
+			"Entitlement denials not delivered to the denial hooks because their queue was full",
+		),
+	}
+}
+
+// add registers hook and starts the delivery of the denials with the first hook.
+func (d *denialHooks) add(ctx context.Context, hook DenialHook) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.started {
+		if err := d.start(ctx, d.deliver); err != nil {
+			return err
+		}
+		d.started = true
+	}
+	var hooks []DenialHook
+	if current := d.hooks.Load(); current != nil {
+		hooks = append(hooks, *current...)
+	}
+	hooks = append(hooks, hook)
+	d.hooks.Store(&hooks)
+	return nil
+}
+
+// notify queues the denial of args for the hooks, without blocking. It is a no-op without hooks.
+func (d *denialHooks) notify(ctx context.Context, args *ChainAuthArgs, reason EntitlementResultReason) {
+	if d.hooks.Load() == nil {
+		return
+	}
+	// args belongs to the caller, the hooks get a copy.
+	select {
+	case d.queue <- denial{ctx: context.WithoutCancel(ctx), args: *args, reason: reason}:
+	default:
+		d.dropped.Inc()
+	}
+}
+
+// deliver calls the hooks with the queued denials until ctx is done.
+func (d *denialHooks) deliver(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case denial := <-d.queue:
+			for _, hook := range *d.hooks.Load() {
+				d.run(hook, &denial)
+			}
+		}
+	}
+}
+
+// run calls a single hook, a panicking hook is logged and doesn't stop the delivery.
+func (d *denialHooks) run(hook DenialHook, denial *denial) {
+	defer func() {
+		if r := recover(); r != nil {
+			logging.FromCtx(denial.ctx).Warnw("Entitlement denial hook panicked", "args", &denial.args, "panic", r)
+		}
+	}()
+	hook(denial.ctx, &denial.args, denial.reason)
+}
+
+// RegisterDenialHook registers a hook called with the entitlement checks IsEntitled denies, see DenialHook.
+// Returns an error if chainAuth is closed.
+func (ca *chainAuth) RegisterDenialHook(hook DenialHook) error {
+	return ca.denialHooks.add(ca.closeCtx, hook)
+}
+
+// NewSampledDenialLogHook returns a denial hook that logs the given fraction of the denials at info level,
+// with the principal, the space, the channel, the permission and the reason of the denial.
+func NewSampledDenialLogHook(sampleRate float64) DenialHook {
+	return func(ctx context.Context, args *ChainAuthArgs, reason EntitlementResultReason) {
+		if sampleRate <= 0 || (sampleRate < 1 && rand.Float64() >= sampleRate) {
+			return
+		}
+		logging.FromCtx(ctx).Infow(
+			"Entitlement denied",
+			"kind", args.kind,
+			"principal", args.principal,
+			"spaceId", args.spaceId,
+			"channelId", args.channelId,
+			"permission", args.permission,
+			"reason", reason,
+			"sampleRate", sampleRate,
+		)
+	}
+}
@@ -0,0 +1,146 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/towns-protocol/towns/core/config"
+	"github.com/towns-protocol/towns/core/node/base/test"
+	"github.com/towns-protocol/towns/core/node/infra"
+	"github.com/towns-protocol/towns/core/node/logging"
+	"github.com/towns-protocol/towns/core/node/shared"
+	"github.com/towns-protocol/towns/core/node/testutils"
+)
+
+type deliveredDenial struct {
+	principal common.Address
+	reason    EntitlementResultReason
+}
+
+func TestDenialHooks(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	alice := common.HexToAddress("0xa11ce")
+	bob := common.HexToAddress("0xb0b")
+	ca := newTestChainAuth(t, ctx, newFakeSpaceContract(common.HexToAddress("0x0e"), alice))
+	defer ca.Close()
+	obs := &recordingObserver{memberships: map[common.Address][]bool{}}
+	ca.SetObserver(obs)
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+
+	denials := make(chan deliveredDenial, 10)
+	require.NoError(t, ca.RegisterDenialHook(func(_ context.Context, _ *ChainAuthArgs, _ EntitlementResultReason) {
+		panic("a failing hook doesn't stop the delivery")
+	}))
+	require.NoError(t, ca.RegisterDenialHook(func(_ context.Context, args *ChainAuthArgs, r EntitlementResultReason) {
+		denials <- deliveredDenial{args.Principal(), r}
+	}))
+	next := func() deliveredDenial {
+		select {
+		case d := <-denials:
+			return d
+		case <-time.After(5 * time.Second):
+			t.Fatal("denial not delivered")
+			return deliveredDenial{}
+		}
+	}
+
+	// Allowed checks are not delivered, the denials are delivered in order whether they were served from the
+	// cache or not.
+	result, err := ca.IsEntitled(ctx, cfg, NewChainAuthArgsForSpace(spaceId, alice.Hex(), PermissionRead))
+	require.NoError(t, err)
+	require.True(t, result.IsEntitled())
+	for range 2 {
+		result, err = ca.IsEntitled(ctx, cfg, NewChainAuthArgsForSpace(spaceId, bob.Hex(), PermissionRead))
+		require.NoError(t, err)
+		require.False(t, result.IsEntitled())
+		require.Equal(t, deliveredDenial{bob, EntitlementResultReason_MEMBERSHIP}, next())
+	}
+	require.Empty(t, denials)
+	require.Equal(t, []bool{false, false, true}, obs.evaluations)
+}
+
+func TestDenialHooksDropOnOverflow(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	bob := common.HexToAddress("0xb0b")
+	ca := newTestChainAuth(t, ctx, newFakeSpaceContract(common.HexToAddress("0x0e")))
+	defer ca.Close()
+	ca.denialHooks = newDenialHooks(
+		&config.ChainConfig{EntitlementDenialHookQueueSize: 1},
+		infra.NewMetricsFactory(prometheus.NewRegistry(), "", ""),
+		ca.startWorker,
+	)
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+	args := NewChainAuthArgsForSpace(spaceId, bob.Hex(), PermissionRead)
+
+	// Without hooks the denials are not queued.
+	_, err := ca.IsEntitled(ctx, cfg, args)
+	require.NoError(t, err)
+	require.Empty(t, ca.denialHooks.queue)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	require.NoError(t, ca.RegisterDenialHook(func(context.Context, *ChainAuthArgs, EntitlementResultReason) {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-release
+	}))
+
+	// A blocked hook never blocks the checks: the denials that don't fit in the queue are dropped.
+	_, err = ca.IsEntitled(ctx, cfg, args)
+	require.NoError(t, err)
+	<-started
+	for range 3 {
+		result, err := ca.IsEntitled(ctx, cfg, args)
+		require.NoError(t, err)
+		require.False(t, result.IsEntitled())
+	}
+	require.Equal(t, float64(2), testutil.ToFloat64(ca.denialHooks.dropped))
+}
+
+func TestSampledDenialLogHook(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	core, logs := observer.New(zapcore.InfoLevel)
+	logger := zap.New(core)
+	sugar := logger.Sugar()
+	ctx = logging.CtxWithLog(ctx, &logging.Log{
+		RootLogger: logger,
+		Default:    sugar,
+		Miniblock:  sugar,
+		Rpc:        sugar,
+	})
+
+	bob := common.HexToAddress("0xb0b")
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+	channelId := testutils.MakeChannelId(spaceId)
+	args := NewChainAuthArgsForChannel(spaceId, channelId, bob.Hex(), PermissionWrite)
+
+	NewSampledDenialLogHook(0)(ctx, args, EntitlementResultReason_BANNED)
+	require.Zero(t, logs.Len())
+
+	NewSampledDenialLogHook(1)(ctx, args, EntitlementResultReason_BANNED)
+	entries := logs.FilterMessage("Entitlement denied").AllUntimed()
+	require.Len(t, entries, 1)
+	fields := entries[0].ContextMap()
+	require.Equal(t, "BANNED", fields["reason"])
+	require.Equal(t, channelId.String(), fields["channelId"])
+}
@@ -0,0 +1,32 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/towns-protocol/towns/core/config"
+	. "github.com/towns-protocol/towns/core/node/base"
+)
+
+// EntitlementDryRunner evaluates entitlement checks for administrative flows that need an authoritative answer
+// and must not change what the checks of users are served.
+type EntitlementDryRunner interface {
+	// DryRunIsEntitled evaluates the check of args like IsEntitled without the caches.
+	DryRunIsEntitled(ctx context.Context, cfg *config.Config, args *ChainAuthArgs) (IsEntitledResult, error)
+}
+
+var _ EntitlementDryRunner = (*chainAuth)(nil)
+
+// DryRunIsEntitled evaluates the check of args like IsEntitled, reading the linked wallets, the memberships,
+// the bans and the entitlements from the chain. None of the caches is read or updated, so the result is never
+// served from a cache and the checks of users are served the same results before and after it.
+func (ca *chainAuth) DryRunIsEntitled(
+	ctx context.Context,
+	cfg *config.Config,
+	args *ChainAuthArgs,
+) (IsEntitledResult, error) {
+	result, err := ca.IsEntitled(withoutCache(ctx), cfg, args)
+	if err != nil {
+		return nil, AsRiverError(err).Func("DryRunIsEntitled")
+	}
+	return result, nil
+}
@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+
+	"github.com/towns-protocol/towns/core/config"
+	"github.com/towns-protocol/towns/core/contracts/base"
+	"github.com/towns-protocol/towns/core/node/base/test"
+	"github.com/towns-protocol/towns/core/node/shared"
+	"github.com/towns-protocol/towns/core/node/testutils"
+)
+
+func TestDryRunIsEntitled(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	alice := common.HexToAddress("0xa11ce")
+	linked := common.HexToAddress("0x11")
+	spaceContract := newFakeSpaceContract(common.HexToAddress("0x0e"), alice)
+	ca := newTestChainAuth(t, ctx, spaceContract)
+	defer ca.Close()
+	walletLink, err := base.NewWalletLink(
+		common.HexToAddress("0xabc"),
+		&fakeWalletLinkBackend{t: t, walletsByRootKey: map[common.Address][]common.Address{alice: {linked}}},
+	)
+	require.NoError(t, err)
+	ca.walletResolver = &WalletResolver{
+		evaluator:  &fakeLinkedWalletsEvaluator{wallets: map[common.Address][]common.Address{alice: {alice, linked}}},
+		walletLink: walletLink,
+	}
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+	channelId := testutils.MakeChannelId(spaceId)
+	// Read checks look up fresh linked wallets, which busts their cached value for IsEntitled.
+	args := NewChainAuthArgsForChannel(spaceId, channelId, alice.Hex(), PermissionRead)
+
+	cachedEntries := func() int {
+		entries := 0
+		for _, ec := range ca.caches() {
+			entries += ec.positiveCache.Len() + ec.negativeCache.Len()
+		}
+		return entries
+	}
+
+	// Dry runs read the chain every time and leave the caches empty.
+	var reads []int
+	for range 2 {
+		result, err := ca.DryRunIsEntitled(ctx, cfg, args)
+		require.NoError(t, err)
+		require.True(t, result.IsEntitled())
+		require.False(t, DetailsOf(result).FromCache)
+		reads = append(reads, spaceContract.callCount("GetMembershipStatus"))
+	}
+	require.NotZero(t, reads[0])
+	require.Greater(t, reads[1], reads[0])
+	require.Zero(t, cachedEntries())
+
+	// Dry runs neither serve nor change the results cached for IsEntitled.
+	result, err := ca.IsEntitled(ctx, cfg, args)
+	require.NoError(t, err)
+	require.True(t, result.IsEntitled())
+	cached := cachedEntries()
+	require.NotZero(t, cached)
+
+	spaceContract.mu.Lock()
+	delete(spaceContract.members, alice)
+	spaceContract.mu.Unlock()
+	result, err = ca.DryRunIsEntitled(ctx, cfg, args)
+	require.NoError(t, err)
+	require.False(t, result.IsEntitled())
+	require.Equal(t, EntitlementResultReason_MEMBERSHIP, result.Reason())
+	require.Equal(t, cached, cachedEntries())
+
+	result, err = ca.IsEntitled(ctx, cfg, args)
+	require.NoError(t, err)
+	require.True(t, result.IsEntitled())
+	require.True(t, DetailsOf(result).FromCache)
+}
@@ -0,0 +1,170 @@
+package auth
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sync/semaphore"
+	"golang.org/x/time/rate"
+
+	"github.com/towns-protocol/towns/core/config"
+	"github.com/towns-protocol/towns/core/node/infra"
+	"github.com/towns-protocol/towns/core/node/logging"
+)
+
+const (
+	DEFAULT_DUAL_READ_CONCURRENCY    = 4
+	DEFAULT_DUAL_READ_MAX_PER_SECOND = 10
+)
+
+// dualReader samples entitlement checks served from the cache and evaluates them again in the background,
+// without using or changing the caches, to report cached decisions that disagree with the chain. The served
+// result is never affected.
+type dualReader struct {
+	sampleRate float64
+	// concurrency and limiter bound the load the background evaluations put on the chain.
+	concurrency *semaphore.Weighted
+	limiter     *rate.Limiter
+	// results counts sampled checks by outcome: agreed, disagreed, failed or dropped.
+	results *prometheus.CounterVec
+	// disagreements counts disagreeing checks by the transition from the cached to the fresh reason.
+	disagreements *prometheus.CounterVec
+}
+
+func newDualReader(cfg *config.ChainConfig, metrics infra.MetricsFactory) *dualReader {
+	concurrency := DEFAULT_DUAL_READ_CONCURRENCY
+	if cfg.EntitlementDualReadConcurrency > 0 {
+		concurrency = cfg.EntitlementDualReadConcurrency
+	}
+	maxPerSecond := float64(DEFAULT_DUAL_READ_MAX_PER_SECOND)
+	if cfg.EntitlementDualReadMaxPerSecond > 0 {
+		maxPerSecond = cfg.EntitlementDualReadMaxPerSecond
+	}
+
+	return &dualReader{
+		sampleRate:  cfg.EntitlementDualReadSampleRate,
+		concurrency: semaphore.NewWeighted(int64(concurrency)),
+		limiter:     rate.NewLimiter(rate.Limit(maxPerSecond), concurrency),
+		results: metrics.NewCounterVecEx(
+			"entitlement_dual_reads", "Cached entitlement decisions evaluated again by outcome", "result"),
+		disagreements: metrics.NewCounterVecEx(
+			"entitlement_dual_read_disagreements",
+			"Cached entitlement decisions that disagree with a fresh evaluation",
+			"transition",
+		),
+	}
+}
+
+func (dr *dualReader) enabled() bool {
+	return dr != nil && dr.sampleRate > 0
+}
+
+func (dr *dualReader) sample() bool {
+	return dr.enabled() && rand.Float64() < dr.sampleRate
+}
+
+// acquire reserves the budget for a background evaluation, returns false if the sample must be dropped.
+func (dr *dualReader) acquire() bool {
+	if !dr.concurrency.TryAcquire(1) {
+		return false
+	}
+	if !dr.limiter.Allow() {
+		dr.concurrency.Release(1)
+		return false
+	}
+	return true
+}
+
+func (dr *dualReader) release() {
+	dr.concurrency.Release(1)
+}
+
+// dualReadDecision is the trace of an entitlement decision that is logged when the decisions disagree.
+type dualReadDecision struct {
+	Allowed         bool          `json:"allowed"`
+	Reason          string        `json:"reason"`
+	WalletSetDigest common.Hash   `json:"walletSetDigest"`
+	EvaluatedAt     time.Time     `json:"evaluatedAt"`
+	Duration        time.Duration `json:"duration,omitempty"`
+}
+
+func newDualReadDecision(result CacheResult, evaluatedAt time.Time) dualReadDecision {
+	decision := dualReadDecision{
+		Allowed:     result.IsAllowed(),
+		Reason:      result.Reason().String(),
+		EvaluatedAt: evaluatedAt,
+	}
+	if walletSet, ok := result.(*walletSetCacheResult); ok {
+		decision.WalletSetDigest = walletSet.walletSetDigest
+	}
+	return decision
+}
+
+// startDualRead evaluates args again in the background if the budget allows it and reports whether the
+// fresh decision agrees with the cached one.
+func (ca *chainAuth) startDualRead(
+	ctx context.Context,
+	cfg *config.Config,
+	args *ChainAuthArgs,
+	cached *timestampedCacheValue,
+) {
+	dr := ca.dualReader
+	if !dr.acquire() {
+		dr.results.WithLabelValues("dropped").Inc()
+		return
+	}
+
+	// The evaluation outlives the request it was sampled from and runs after more important background work.
+	// It resolves its data again rather than reusing the data of a batch it was sampled from.
+	ca.workQueue.submit(withoutPermissionsBatch(context.WithoutCancel(ctx)), &workTask{
+		priority: workPriorityAudit,
+		spaceId:  args.spaceId,
+		run: func(ctx context.Context) {
+			defer dr.release()
+			ca.dualRead(ctx, cfg, args, cached)
+		},
+		dropped: func() {
+			dr.release()
+			dr.results.WithLabelValues("dropped").Inc()
+		},
+	})
+}
+
+func (ca *chainAuth) dualRead(
+	ctx context.Context,
+	cfg *config.Config,
+	args *ChainAuthArgs,
+	cached *timestampedCacheValue,
+) {
+	log := logging.FromCtx(ctx)
+	dr := ca.dualReader
+
+	start := time.Now()
+	fresh, err := ca.checkEntitlement(withoutCache(ctx), cfg, args)
+	if err != nil {
+		dr.results.WithLabelValues("failed").Inc()
+		log.Debugw("Failed to evaluate sampled entitlement check", "args", args, "error", err)
+		return
+	}
+
+	cachedDecision := newDualReadDecision(cached.Result(), cached.GetTimestamp())
+	freshDecision := newDualReadDecision(fresh, start)
+	freshDecision.Duration = time.Since(start)
+
+	if cachedDecision.Allowed == freshDecision.Allowed && cachedDecision.Reason == freshDecision.Reason {
+		dr.results.WithLabelValues("agreed").Inc()
+		return
+	}
+
+	dr.results.WithLabelValues("disagreed").Inc()
+	dr.disagreements.WithLabelValues(cachedDecision.Reason + "->" + freshDecision.Reason).Inc()
+	log.Warnw(
+		"Cached entitlement decision disagrees with fresh evaluation",
+		"args", args,
+		"cached", cachedDecision,
+		"fresh", freshDecision,
+	)
+}
@@ -0,0 +1,95 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/towns-protocol/towns/core/config"
+	"github.com/towns-protocol/towns/core/node/base/test"
+	"github.com/towns-protocol/towns/core/node/infra"
+	"github.com/towns-protocol/towns/core/node/shared"
+	"github.com/towns-protocol/towns/core/node/testutils"
+)
+
+func TestDualRead(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	bob := common.HexToAddress("0xb0b")
+	spaceContract := newFakeSpaceContract(common.HexToAddress("0x0e"), bob)
+	ca := newTestChainAuth(t, ctx, spaceContract)
+	ca.dualReader = newDualReader(
+		&config.ChainConfig{
+			EntitlementDualReadSampleRate:   1,
+			EntitlementDualReadConcurrency:  1,
+			EntitlementDualReadMaxPerSecond: 1000,
+		},
+		infra.NewMetricsFactory(prometheus.NewRegistry(), "", ""),
+	)
+	results := ca.dualReader.results
+
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+	args := NewChainAuthArgsForSpace(spaceId, bob.Hex(), PermissionWrite)
+
+	// Cache misses are not sampled.
+	result, err := ca.IsEntitled(ctx, cfg, args)
+	require.NoError(t, err)
+	require.True(t, result.IsEntitled())
+	require.Zero(t, testutil.CollectAndCount(results))
+
+	// Cache hits that match the chain agree.
+	result, err = ca.IsEntitled(ctx, cfg, args)
+	require.NoError(t, err)
+	require.True(t, result.IsEntitled())
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(results.WithLabelValues("agreed")) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cacheSizes := func() []int {
+		var sizes []int
+		for _, c := range []*entitlementCache{
+			ca.entitlementCache, ca.membershipCache, ca.entitlementManagerCache, ca.linkedWalletCache,
+		} {
+			sizes = append(sizes, c.positiveCache.Len(), c.negativeCache.Len())
+		}
+		return sizes
+	}
+	sizes := cacheSizes()
+
+	// The ban is reported as a disagreement, the cached allow is still served.
+	spaceContract.mu.Lock()
+	spaceContract.banned[bob] = true
+	spaceContract.mu.Unlock()
+
+	result, err = ca.IsEntitled(ctx, cfg, args)
+	require.NoError(t, err)
+	require.True(t, result.IsEntitled())
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(results.WithLabelValues("disagreed")) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, 1, testutil.CollectAndCount(ca.dualReader.disagreements))
+	require.Equal(t, 1.0, testutil.ToFloat64(ca.dualReader.disagreements.WithLabelValues("NONE->BANNED")))
+
+	// The fresh evaluation didn't change the caches.
+	require.Equal(t, sizes, cacheSizes())
+	calls := spaceContract.callCount("GetBannedWallets")
+	ca.dualReader.sampleRate = 0
+	result, err = ca.IsEntitled(ctx, cfg, args)
+	require.NoError(t, err)
+	require.True(t, result.IsEntitled())
+	require.Equal(t, calls, spaceContract.callCount("GetBannedWallets"))
+
+	// Samples over the concurrency budget are dropped.
+	ca.dualReader.sampleRate = 1
+	require.True(t, ca.dualReader.concurrency.TryAcquire(1))
+	_, err = ca.IsEntitled(ctx, cfg, args)
+	require.NoError(t, err)
+	require.Equal(t, 1.0, testutil.ToFloat64(results.WithLabelValues("dropped")))
+	ca.dualReader.release()
+}
@@ -0,0 +1,293 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/towns-protocol/towns/core/config"
+	"github.com/towns-protocol/towns/core/contracts/base"
+	"github.com/towns-protocol/towns/core/contracts/river"
+	"github.com/towns-protocol/towns/core/contracts/types"
+	. "github.com/towns-protocol/towns/core/node/base"
+	"github.com/towns-protocol/towns/core/node/base/test"
+	"github.com/towns-protocol/towns/core/node/crypto"
+	"github.com/towns-protocol/towns/core/node/infra"
+	. "github.com/towns-protocol/towns/core/node/protocol"
+	"github.com/towns-protocol/towns/core/node/shared"
+	"github.com/towns-protocol/towns/core/node/testutils"
+	"github.com/towns-protocol/towns/core/xchain/entitlement"
+)
+
+// policyScenario is a scenario of testdata/entitlement_policy.json: the state of a space or channel and the
+// outcome the documented IsEntitled algorithm gives for it. Wallets are named: the principal, the wallet
+// linked to it, an unrelated wallet and the everyone address.
+type policyScenario struct {
+	Name string `json:"name"`
+	// Step is the step of the IsEntitled algorithm the scenario covers, e.g. 6A.2.
+	Step string `json:"step"`
+	// Target is the space or the channel of the check.
+	Target             string   `json:"target"`
+	Disabled           bool     `json:"disabled"`
+	NotFound           bool     `json:"notFound"`
+	LinkedWalletsLimit int      `json:"linkedWalletsLimit"`
+	Members            []string `json:"members"`
+	Expired            []string `json:"expired"`
+	Banned             []string `json:"banned"`
+	// Owner is the owner of the space or channel, a wallet unrelated to the principal if empty.
+	Owner string `json:"owner"`
+	// Entitlements are user entitlements of the named wallets, or rule entitlements that the wallets
+	// satisfy or not.
+	Entitlements []struct {
+		Users []string `json:"users"`
+		Rule  *bool    `json:"rule"`
+	} `json:"entitlements"`
+	Allowed bool   `json:"allowed"`
+	Reason  string `json:"reason"`
+	// Error is the code of the error the check fails with.
+	Error string `json:"error"`
+}
+
+// policySpaceContract serves the state of a policyScenario.
+type policySpaceContract struct {
+	*fakeSpaceContract
+
+	disabled bool
+	notFound bool
+	expired  map[common.Address]bool
+}
+
+func (sc *policySpaceContract) IsSpaceDisabled(ctx context.Context, spaceId shared.StreamId) (bool, error) {
+	if sc.notFound {
+		return false, RiverError(Err_NOT_FOUND, "Space not found")
+	}
+	return sc.disabled, nil
+}
+
+func (sc *policySpaceContract) IsChannelDisabled(
+	ctx context.Context,
+	spaceId shared.StreamId,
+	channelId shared.StreamId,
+) (bool, error) {
+	if sc.notFound {
+		return false, RiverError(Err_NOT_FOUND, "Space not found")
+	}
+	return sc.disabled, nil
+}
+
+func (sc *policySpaceContract) GetMembershipStatus(
+	ctx context.Context,
+	spaceId shared.StreamId,
+	user common.Address,
+) (*MembershipStatus, error) {
+	if sc.expired[user] {
+		return &MembershipStatus{IsMember: true, IsExpired: true}, nil
+	}
+	return sc.fakeSpaceContract.GetMembershipStatus(ctx, spaceId, user)
+}
+
+// staticOnChainConfig serves the same settings on every block.
+type staticOnChainConfig struct {
+	settings *crypto.OnChainSettings
+}
+
+func (c *staticOnChainConfig) ActiveBlock() crypto.BlockNumber { return 0 }
+func (c *staticOnChainConfig) Get() *crypto.OnChainSettings    { return c.settings }
+func (c *staticOnChainConfig) GetOnBlock(crypto.BlockNumber) *crypto.OnChainSettings {
+	return c.settings
+}
+
+func (c *staticOnChainConfig) All() []*crypto.OnChainSettings {
+	return []*crypto.OnChainSettings{c.settings}
+}
+
+func (c *staticOnChainConfig) LastAppliedEvent() *river.RiverConfigV1ConfigurationChanged { return nil }
+
+// mockRule returns a rule entitlement with a single mock check that passes or fails without a chain.
+func mockRule(t *testing.T, pass bool) types.Entitlement {
+	params, err := (&types.ThresholdParams{Threshold: big.NewInt(0)}).AbiEncode()
+	require.NoError(t, err)
+	// Mock checks pass on any chain but 0.
+	chainId := big.NewInt(0)
+	if pass {
+		chainId = big.NewInt(1)
+	}
+	return types.Entitlement{
+		EntitlementType: types.ModuleTypeRuleEntitlementV2,
+		RuleEntitlementV2: &base.IRuleEntitlementBaseRuleDataV2{
+			Operations: []base.IRuleEntitlementBaseOperation{{OpType: uint8(types.CHECK), Index: 0}},
+			CheckOperations: []base.IRuleEntitlementBaseCheckOperationV2{
+				{OpType: uint8(types.MOCK), ChainId: chainId, Params: params},
+			},
+		},
+	}
+}
+
+// documentedPolicySteps returns the steps of the IsEntitled algorithm documented on the ChainAuth interface,
+// the nested steps are prefixed with the step they belong to, e.g. 6A.2.
+func documentedPolicySteps(t *testing.T) []string {
+	source, err := os.ReadFile("auth_impl.go")
+	require.NoError(t, err)
+	_, doc, found := strings.Cut(string(source), "IsEntitled algorithm")
+	require.True(t, found)
+	doc, _, found = strings.Cut(doc, "*/")
+	require.True(t, found)
+
+	stepRe := regexp.MustCompile(`^(\t\t\t?)(\d+[A-Z]?)\. `)
+	var steps []string
+	var parent string
+	for _, line := range strings.Split(doc, "\n") {
+		m := stepRe.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		if len(m[1]) == 2 {
+			parent = m[2]
+			steps = append(steps, parent)
+		} else {
+			steps = append(steps, parent+"."+m[2])
+		}
+	}
+	require.NotEmpty(t, steps)
+	return steps
+}
+
+// TestEntitlementPolicyConformance runs the scenarios of testdata/entitlement_policy.json against chainAuth,
+// it fails if the implementation diverges from the documented IsEntitled algorithm or a documented step has no
+// scenario.
+func TestEntitlementPolicyConformance(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	data, err := os.ReadFile("testdata/entitlement_policy.json")
+	require.NoError(t, err)
+	var scenarios []policyScenario
+	require.NoError(t, json.Unmarshal(data, &scenarios))
+
+	steps := documentedPolicySteps(t)
+	covered := map[string]bool{}
+	for _, scenario := range scenarios {
+		require.Contains(t, steps, scenario.Step, "scenario %q covers an undocumented step", scenario.Name)
+		covered[scenario.Step] = true
+		// Steps with nested steps are covered by the scenarios of their nested steps.
+		parent, _, _ := strings.Cut(scenario.Step, ".")
+		covered[parent] = true
+	}
+	for _, step := range steps {
+		require.True(t, covered[step], "no scenario covers step %s", step)
+	}
+
+	evaluator, err := entitlement.NewEvaluatorFromConfig(
+		ctx,
+		&config.Config{},
+		&staticOnChainConfig{settings: crypto.DefaultOnChainSettings()},
+		infra.NewMetricsFactory(prometheus.NewRegistry(), "", ""),
+		nil,
+	)
+	require.NoError(t, err)
+
+	cfg := &config.Config{}
+	principal := common.HexToAddress("0x9a")
+	wallets := map[string]common.Address{
+		"principal": principal,
+		"linked":    common.HexToAddress("0x11"),
+		"other":     common.HexToAddress("0x0f"),
+		"everyone":  everyone,
+	}
+	walletsOf := func(names []string) []common.Address {
+		var ret []common.Address
+		for _, name := range names {
+			wallet, ok := wallets[name]
+			require.True(t, ok, "unknown wallet %q", name)
+			ret = append(ret, wallet)
+		}
+		return ret
+	}
+
+	for _, scenario := range scenarios {
+		t.Run(scenario.Step+" "+scenario.Name, func(t *testing.T) {
+			owner := common.HexToAddress("0x0e")
+			if scenario.Owner != "" {
+				owner = walletsOf([]string{scenario.Owner})[0]
+			}
+			spaceContract := &policySpaceContract{
+				fakeSpaceContract: newFakeSpaceContract(owner),
+				disabled:          scenario.Disabled,
+				notFound:          scenario.NotFound,
+				expired:           map[common.Address]bool{},
+			}
+			spaceContract.members = map[common.Address]bool{}
+			for _, wallet := range walletsOf(scenario.Members) {
+				spaceContract.members[wallet] = true
+			}
+			for _, wallet := range walletsOf(scenario.Expired) {
+				spaceContract.expired[wallet] = true
+			}
+			for _, wallet := range walletsOf(scenario.Banned) {
+				spaceContract.banned[wallet] = true
+			}
+			spaceContract.entitlements = nil
+			for _, ent := range scenario.Entitlements {
+				if ent.Rule != nil {
+					spaceContract.entitlements = append(spaceContract.entitlements, mockRule(t, *ent.Rule))
+				} else {
+					spaceContract.entitlements = append(spaceContract.entitlements, types.Entitlement{
+						EntitlementType: types.ModuleTypeUserEntitlement,
+						UserEntitlement: walletsOf(ent.Users),
+					})
+				}
+			}
+
+			ca := newTestChainAuth(t, ctx, spaceContract)
+			ca.evaluator = evaluator
+			walletLink, err := base.NewWalletLink(common.HexToAddress("0xabc"), &fakeWalletLinkBackend{t: t})
+			require.NoError(t, err)
+			linkedWallets := &fakeLinkedWalletsEvaluator{
+				wallets: map[common.Address][]common.Address{principal: walletsOf([]string{"principal", "linked"})},
+			}
+			ca.walletResolver = &WalletResolver{evaluator: linkedWallets, walletLink: walletLink}
+			if scenario.LinkedWalletsLimit > 0 {
+				ca.SetLinkedWalletsLimit(scenario.LinkedWalletsLimit)
+			}
+
+			spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+			channelId := testutils.MakeChannelId(spaceId)
+			var args *ChainAuthArgs
+			switch scenario.Target {
+			case "space":
+				args = NewChainAuthArgsForSpace(spaceId, principal.Hex(), PermissionWrite)
+			case "channel":
+				args = NewChainAuthArgsForChannel(spaceId, channelId, principal.Hex(), PermissionWrite)
+			default:
+				t.Fatalf("unknown target %q", scenario.Target)
+			}
+
+			result, err := ca.IsEntitled(ctx, cfg, args)
+			if scenario.Error != "" {
+				require.Error(t, err)
+				require.Equal(t, scenario.Error, AsRiverError(err).Code.String())
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, scenario.Allowed, result.IsEntitled())
+			if !scenario.Allowed {
+				require.Equal(t, scenario.Reason, result.Reason().String())
+			}
+
+			// 1. The result of the check is served from the cache afterwards.
+			cached, err := ca.IsEntitled(ctx, cfg, args)
+			require.NoError(t, err)
+			require.True(t, DetailsOf(cached).FromCache)
+			require.Equal(t, result.IsEntitled(), cached.IsEntitled())
+			require.Equal(t, result.Reason(), cached.Reason())
+		})
+	}
+}
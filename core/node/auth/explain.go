@@ -0,0 +1,412 @@
+package auth
+
+import (
+	"context"
+	"math/big"
+	"slices"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/towns-protocol/towns/core/config"
+	"github.com/towns-protocol/towns/core/contracts/base"
+	"github.com/towns-protocol/towns/core/contracts/types"
+	. "github.com/towns-protocol/towns/core/node/base"
+	. "github.com/towns-protocol/towns/core/node/protocol"
+	"github.com/towns-protocol/towns/core/xchain/entitlement"
+)
+
+// EntitlementExplanation is the trace of an entitlement check returned by ExplainEntitlement. The steps of
+// the check are explained in the order IsEntitled runs them, up to the step that decided the check, the
+// fields of the later steps are left empty.
+type EntitlementExplanation struct {
+	Allowed bool `json:"allowed"`
+	// Reason is the reason of the decision, see IsEntitledResult.Reason.
+	Reason EntitlementResultReason `json:"reason"`
+	// ReasonChain is the on-chain decision followed by the verdicts of the policy hooks.
+	ReasonChain []ReasonChainStep `json:"reasonChain"`
+	// DeniedAt is the step of the check that denied it, named like the stages of slow check logs: streamEnabled,
+	// linkedWallets, membership, banList, ruleEvaluation or policyHooks. Empty if the check is allowed.
+	DeniedAt string `json:"deniedAt,omitempty"`
+
+	// StreamEnabled is false if the space or the channel is disabled.
+	StreamEnabled bool `json:"streamEnabled"`
+	// Wallets are the wallets linked to the principal, including the principal.
+	Wallets []common.Address `json:"wallets,omitempty"`
+	// Memberships are the membership statuses of the wallets, in the order of the wallets.
+	Memberships []WalletMembershipExplanation `json:"memberships,omitempty"`
+	// Members are the wallets that are members of the space, ExpiredMembers the wallets whose membership
+	// expired.
+	Members        []common.Address `json:"members,omitempty"`
+	ExpiredMembers []common.Address `json:"expiredMembers,omitempty"`
+	// Owner is the owner of the space, IsOwner is true if it is one of the wallets.
+	Owner   common.Address `json:"owner"`
+	IsOwner bool           `json:"isOwner"`
+	// Banned are the wallets that are banned from the space.
+	Banned []common.Address `json:"banned,omitempty"`
+	// Entitlements explains the evaluation of each entitlement of the space, or of the channel, for the
+	// permission.
+	Entitlements []EntitlementModuleExplanation `json:"entitlements,omitempty"`
+	// RuleDenial is the unsatisfied check of the first rule entitlement that denied the wallets.
+	RuleDenial *entitlement.RuleDenial `json:"ruleDenial,omitempty"`
+}
+
+// WalletMembershipExplanation is the membership status of a wallet in the space.
+type WalletMembershipExplanation struct {
+	Wallet    common.Address `json:"wallet"`
+	IsMember  bool           `json:"isMember"`
+	IsExpired bool           `json:"isExpired"`
+	// ExpiryTime is the expiry time of the furthest non-expired token, 0 if it never expires.
+	ExpiryTime *big.Int `json:"expiryTime,omitempty"`
+	// ExpiredAt is when the membership expired if all the tokens are expired.
+	ExpiredAt *big.Int `json:"expiredAt,omitempty"`
+	// Error is the error checking the membership of the wallet.
+	Error string `json:"error,omitempty"`
+}
+
+// EntitlementModuleExplanation explains the evaluation of an entitlement against the wallets of the principal.
+type EntitlementModuleExplanation struct {
+	Type string `json:"type"`
+	// Allowed is true if the entitlement entitles the wallets. Rules may be satisfied by the combined
+	// balances of the wallets without being satisfied by any single wallet.
+	Allowed bool `json:"allowed"`
+	// Everyone is true for user entitlements granting everyone.
+	Everyone bool `json:"everyone,omitempty"`
+	// Wallets are the wallets that satisfy the entitlement on their own.
+	Wallets []common.Address `json:"wallets,omitempty"`
+	// RuleDenial is the unsatisfied check of a rule entitlement that doesn't entitle the wallets.
+	RuleDenial *entitlement.RuleDenial `json:"ruleDenial,omitempty"`
+	// Rule is the outcome of each operation of a rule entitlement against the wallets combined.
+	Rule *entitlement.RuleTrace `json:"rule,omitempty"`
+	// Error is the error evaluating the entitlement, IsEntitled fails if no other entitlement entitles the
+	// wallets.
+	Error string `json:"error,omitempty"`
+}
+
+// ExplainOpts are the options of ExplainEntitlement.
+type ExplainOpts struct {
+	// Cached explains the check from the cached data where there is some, which is cheaper and shows the data
+	// IsEntitled decided from rather than the current chain state. The caches are bypassed by default.
+	Cached bool
+}
+
+// ExplainEntitlement runs the check of args like IsEntitled does and returns how it was decided. Unless
+// opts.Cached is set it bypasses the caches, so the explanation is computed from fresh chain data. It evaluates
+// all entitlements and all rules against each wallet, which makes it much more expensive than IsEntitled. It
+// is meant for operators debugging access decisions and must not be called on the hot path.
+func (ca *chainAuth) ExplainEntitlement(
+	ctx context.Context,
+	cfg *config.Config,
+	args *ChainAuthArgs,
+	opts ExplainOpts,
+) (*EntitlementExplanation, error) {
+	if !opts.Cached {
+		ctx = withoutCache(ctx)
+	}
+	ctx, args = args.withoutCallOptions(ctx)
+
+	explanation, err := ca.explainOnChain(ctx, cfg, args)
+	if err != nil {
+		return nil, AsRiverError(err).Func("ExplainEntitlement")
+	}
+
+	ret := &isEntitledResult{
+		isAllowed:  explanation.Allowed,
+		reason:     explanation.Reason,
+		ruleDenial: explanation.RuleDenial,
+	}
+	ret.reasonChain = []ReasonChainStep{{
+		Source:  ReasonChainSourceChain,
+		Outcome: PolicyOutcomeDeny,
+		Reason:  ret.reason.String(),
+	}}
+	if ret.isAllowed {
+		ret.reasonChain[0].Outcome = PolicyOutcomeAllow
+	}
+	if err := ca.policyHooks.apply(ctx, args, ret); err != nil {
+		return nil, AsRiverError(err).Func("ExplainEntitlement")
+	}
+	if ret.isAllowed {
+		explanation.DeniedAt = ""
+	} else if explanation.Allowed {
+		explanation.DeniedAt = checkStagePolicyHooks
+	}
+	explanation.Allowed = ret.isAllowed
+	explanation.Reason = ret.reason
+	explanation.ReasonChain = ret.reasonChain
+	return explanation, nil
+}
+
+// explainOnChain explains the on-chain decision of args, following checkEntitlement.
+func (ca *chainAuth) explainOnChain(
+	ctx context.Context,
+	cfg *config.Config,
+	args *ChainAuthArgs,
+) (*EntitlementExplanation, error) {
+	explanation := &EntitlementExplanation{}
+
+	if args.permissions != "" {
+		return nil, RiverError(Err_INVALID_ARGUMENT, "Checks of several permissions can't be explained")
+	}
+
+	isEnabled, reason, err := ca.checkStreamIsEnabled(ctx, cfg, args)
+	if err != nil {
+		return nil, err
+	}
+	explanation.StreamEnabled = isEnabled
+	if !isEnabled {
+		explanation.Reason = reason
+		explanation.DeniedAt = checkStageStreamEnabled
+		return explanation, nil
+	}
+
+	if args.kind == chainAuthKindApp {
+		result, err := ca.checkAppEntitlement(ctx, args)
+		if err != nil {
+			return nil, err
+		}
+		explanation.Allowed = result.IsAllowed()
+		if !explanation.Allowed {
+			explanation.Reason = result.Reason()
+			explanation.DeniedAt = checkStageEntitlements
+		}
+		return explanation, nil
+	}
+
+	// The linked wallets are looked up again without busting the cached ones.
+	wallets := deserializeWallets(args.preFetchedWallets)
+	if !args.hasPreFetchedWallets {
+		if wallets, err = ca.getLinkedWalletsOf(ctx, cfg, args.principal, false); err != nil {
+			return nil, err
+		}
+	}
+	explanation.Wallets = slices.Clone(wallets)
+
+	if args.kind == chainAuthKindIsWalletLinked {
+		explanation.Allowed = slices.Contains(wallets, args.walletAddress)
+		if !explanation.Allowed {
+			explanation.Reason = EntitlementResultReason_WALLET_NOT_LINKED
+			explanation.DeniedAt = checkStageLinkedWallets
+		}
+		return explanation, nil
+	}
+
+	if limit := ca.linkedWalletsLimit.forArgs(args); !ca.linkedWalletsLimit.check(args.principal, len(wallets), limit) {
+		return nil, RiverError(Err_LINKED_WALLETS_LIMIT_EXCEEDED,
+			"too many wallets linked to the root key",
+			"rootKey", args.principal, "wallets", len(wallets), "limit", limit)
+	}
+
+	if err := ca.explainMembership(ctx, cfg, args, explanation); err != nil {
+		return nil, err
+	}
+	if explanation.Reason != EntitlementResultReason_NONE {
+		return explanation, nil
+	}
+	if args.kind == chainAuthKindIsSpaceMember {
+		explanation.Allowed = true
+		return explanation, nil
+	}
+
+	if err := ca.explainEntitlements(ctx, cfg, args, explanation); err != nil {
+		return nil, err
+	}
+	return explanation, nil
+}
+
+// explainMembership checks the membership of each wallet, it sets the reason of the explanation if none of
+// the wallets is a member whose membership didn't expire. Like checkWalletsMembership, it fails if a check
+// failed and none of the wallets is a member.
+func (ca *chainAuth) explainMembership(
+	ctx context.Context,
+	cfg *config.Config,
+	args *ChainAuthArgs,
+	explanation *EntitlementExplanation,
+) error {
+	var membershipErr error
+	for _, wallet := range explanation.Wallets {
+		memberArgs := newArgsForIsSpaceMember(args.spaceId, wallet)
+		memberArgs.chainId = args.chainId
+		status, err := ca.getMembershipStatus(ctx, cfg, memberArgs)
+		if err != nil {
+			if membershipErr == nil {
+				membershipErr = err
+			}
+			explanation.Memberships = append(explanation.Memberships, WalletMembershipExplanation{
+				Wallet: wallet,
+				Error:  err.Error(),
+			})
+			continue
+		}
+		explanation.Memberships = append(explanation.Memberships, WalletMembershipExplanation{
+			Wallet:     wallet,
+			IsMember:   status.IsMember,
+			IsExpired:  status.IsExpired,
+			ExpiryTime: status.ExpiryTime,
+			ExpiredAt:  status.ExpiredAt,
+		})
+		if status.IsMember && status.IsExpired {
+			explanation.ExpiredMembers = append(explanation.ExpiredMembers, wallet)
+		} else if status.IsMember {
+			explanation.Members = append(explanation.Members, wallet)
+		}
+	}
+
+	switch {
+	case len(explanation.Members) > 0:
+		return nil
+	case len(explanation.ExpiredMembers) > 0:
+		explanation.Reason = EntitlementResultReason_MEMBERSHIP_EXPIRED
+		explanation.DeniedAt = checkStageMembership
+		return nil
+	case membershipErr != nil:
+		return AsRiverError(membershipErr, Err_CANNOT_CHECK_ENTITLEMENTS).
+			Message("Error(s) evaluating user space membership")
+	default:
+		explanation.Reason = EntitlementResultReason_MEMBERSHIP
+		explanation.DeniedAt = checkStageMembership
+		return nil
+	}
+}
+
+// explainEntitlements explains the evaluation of the entitlements of the space or the channel of args against
+// the wallets of the explanation, following evaluateWithEntitlements.
+func (ca *chainAuth) explainEntitlements(
+	ctx context.Context,
+	cfg *config.Config,
+	args *ChainAuthArgs,
+	explanation *EntitlementExplanation,
+) error {
+	denialReason := EntitlementResultReason_SPACE_ENTITLEMENTS
+	if args.kind == chainAuthKindChannelModerator {
+		args = args.asChannelCheck()
+		denialReason = EntitlementResultReason_NOT_MODERATOR
+	} else if args.kind == chainAuthKindChannel {
+		denialReason = EntitlementResultReason_CHANNEL_ENTITLEMENTS
+	}
+	var entitlementData *entitlementCacheResult
+	if args.kind == chainAuthKindChannel {
+		result, _, err := ca.entitlementManagerCache.executeUsingCache(
+			ctx,
+			cfg,
+			newArgsForEntitlementManager(args),
+			ca.getChannelEntitlementsForPermissionUncached,
+		)
+		if err != nil {
+			return AsRiverError(err).Message("Failed to get channel entitlements")
+		}
+		entitlementData = result.(*timestampedCacheValue).Result().(*entitlementCacheResult)
+	} else {
+		var err error
+		if entitlementData, err = ca.getSpaceEntitlements(ctx, cfg, args); err != nil {
+			return err
+		}
+	}
+
+	wallets := explanation.Wallets
+	explanation.Owner = entitlementData.owner
+	explanation.IsOwner = slices.Contains(wallets, entitlementData.owner)
+	if explanation.IsOwner {
+		explanation.Allowed = true
+		return nil
+	}
+
+	bannedWallets, err := ca.getBannedWallets(ctx, args.spaceId, args.chainId)
+	if err != nil {
+		return err
+	}
+	for _, wallet := range wallets {
+		if bannedWallets.isBanned([]common.Address{wallet}) {
+			explanation.Banned = append(explanation.Banned, wallet)
+		}
+	}
+	if len(explanation.Banned) > 0 {
+		explanation.Reason = EntitlementResultReason_BANNED
+		explanation.DeniedAt = checkStageBanList
+		return nil
+	}
+
+	evaluator, err := ca.evaluatorFor(args.chainId)
+	if err != nil {
+		return err
+	}
+	everyone := grantsEveryone(entitlementData.entitlementData)
+	for _, ent := range entitlementData.entitlementData {
+		// The rules are not evaluated when everyone is entitled, neither are they here.
+		if everyone && ent.EntitlementType != types.ModuleTypeUserEntitlement {
+			continue
+		}
+		module := ca.explainEntitlement(ctx, evaluator, ent, wallets)
+		explanation.Entitlements = append(explanation.Entitlements, module)
+		explanation.Allowed = explanation.Allowed || module.Allowed
+		if explanation.RuleDenial == nil && module.RuleDenial != nil {
+			explanation.RuleDenial = module.RuleDenial
+		}
+	}
+	if explanation.Allowed {
+		explanation.RuleDenial = nil
+	} else {
+		explanation.Reason = denialReason
+		explanation.DeniedAt = checkStageRuleEvaluation
+	}
+	return nil
+}
+
+// explainEntitlement evaluates the entitlement against the wallets combined and against each wallet with the
+// evaluator of the chain of the space.
+func (ca *chainAuth) explainEntitlement(
+	ctx context.Context,
+	evaluator *entitlement.Evaluator,
+	ent types.Entitlement,
+	wallets []common.Address,
+) EntitlementModuleExplanation {
+	module := EntitlementModuleExplanation{Type: ent.EntitlementType}
+
+	var ruleData *base.IRuleEntitlementBaseRuleDataV2
+	switch ent.EntitlementType {
+	case types.ModuleTypeUserEntitlement:
+		module.Everyone = slices.Contains(ent.UserEntitlement, everyone)
+		for _, wallet := range wallets {
+			if slices.Contains(ent.UserEntitlement, wallet) {
+				module.Wallets = append(module.Wallets, wallet)
+			}
+		}
+		module.Allowed = module.Everyone || len(module.Wallets) > 0
+		return module
+	case types.ModuleTypeRuleEntitlement:
+		reV2, err := types.ConvertV1RuleDataToV2(ctx, ent.RuleEntitlement)
+		if err != nil {
+			module.Error = err.Error()
+			return module
+		}
+		ruleData = reV2
+	case types.ModuleTypeRuleEntitlementV2:
+		ruleData = ent.RuleEntitlementV2
+	default:
+		module.Error = "invalid entitlement type"
+		return module
+	}
+
+	allowed, denial, err := evaluator.EvaluateRuleDataWithDenial(ctx, wallets, ruleData)
+	if err != nil {
+		module.Error = err.Error()
+		return module
+	}
+	module.Allowed = allowed
+	if !allowed {
+		module.RuleDenial = denial
+	}
+	if module.Rule, err = evaluator.ExplainRuleData(ctx, wallets, ruleData); err != nil {
+		module.Error = err.Error()
+	}
+	for _, wallet := range wallets {
+		allowed, _, err := evaluator.EvaluateRuleDataWithDenial(ctx, []common.Address{wallet}, ruleData)
+		if err != nil {
+			module.Error = err.Error()
+			continue
+		}
+		if allowed {
+			module.Wallets = append(module.Wallets, wallet)
+		}
+	}
+	return module
+}
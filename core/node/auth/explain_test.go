@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+
+	"github.com/towns-protocol/towns/core/config"
+	"github.com/towns-protocol/towns/core/contracts/types"
+	"github.com/towns-protocol/towns/core/node/base/test"
+	"github.com/towns-protocol/towns/core/node/shared"
+	"github.com/towns-protocol/towns/core/node/testutils"
+)
+
+func TestExplainEntitlement(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	owner := common.HexToAddress("0x0e")
+	alice := common.HexToAddress("0xa11ce")
+	bob := common.HexToAddress("0xb0b")
+	carol := common.HexToAddress("0xca201")
+	mallory := common.HexToAddress("0x3a11")
+	spaceContract := newFakeSpaceContract(owner, alice, bob, carol)
+	spaceContract.banned[carol] = true
+	ca := newTestChainAuth(t, ctx, spaceContract)
+	defer ca.Close()
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+
+	explain := func(principal common.Address) *EntitlementExplanation {
+		explanation, err := ca.ExplainEntitlement(
+			ctx, cfg, NewChainAuthArgsForSpace(spaceId, principal.Hex(), PermissionWrite), ExplainOpts{})
+		require.NoError(t, err)
+		return explanation
+	}
+
+	// Allowed checks report the wallets that satisfied each entitlement.
+	explanation := explain(bob)
+	require.True(t, explanation.Allowed)
+	require.Equal(t, EntitlementResultReason_NONE, explanation.Reason)
+	require.True(t, explanation.StreamEnabled)
+	require.Equal(t, []common.Address{bob}, explanation.Wallets)
+	require.Equal(t, []common.Address{bob}, explanation.Members)
+	require.Equal(t, owner, explanation.Owner)
+	require.False(t, explanation.IsOwner)
+	require.Empty(t, explanation.Banned)
+	require.Equal(t, []EntitlementModuleExplanation{{
+		Type:    types.ModuleTypeUserEntitlement,
+		Allowed: true,
+		Wallets: []common.Address{bob},
+	}}, explanation.Entitlements)
+	require.Len(t, explanation.ReasonChain, 1)
+	require.Equal(t, PolicyOutcomeAllow, explanation.ReasonChain[0].Outcome)
+
+	// Denials report the step that denied the check, the later steps are not explained.
+	explanation = explain(mallory)
+	require.False(t, explanation.Allowed)
+	require.Equal(t, EntitlementResultReason_MEMBERSHIP, explanation.Reason)
+	require.Empty(t, explanation.Members)
+	require.Empty(t, explanation.Entitlements)
+
+	explanation = explain(carol)
+	require.False(t, explanation.Allowed)
+	require.Equal(t, EntitlementResultReason_BANNED, explanation.Reason)
+	require.Equal(t, []common.Address{carol}, explanation.Banned)
+	require.Empty(t, explanation.Entitlements)
+
+	explanation = explain(owner)
+	require.True(t, explanation.Allowed)
+	require.True(t, explanation.IsOwner)
+
+	// Explanations are computed from fresh data and don't change the caches.
+	result, err := ca.IsEntitled(ctx, cfg, NewChainAuthArgsForSpace(spaceId, alice.Hex(), PermissionWrite))
+	require.NoError(t, err)
+	require.True(t, result.IsEntitled())
+	spaceContract.entitlements = []types.Entitlement{
+		{EntitlementType: types.ModuleTypeUserEntitlement, UserEntitlement: []common.Address{bob}},
+	}
+
+	explanation = explain(alice)
+	require.False(t, explanation.Allowed)
+	require.Equal(t, EntitlementResultReason_SPACE_ENTITLEMENTS, explanation.Reason)
+	require.Equal(t, []EntitlementModuleExplanation{{Type: types.ModuleTypeUserEntitlement}}, explanation.Entitlements)
+
+	result, err = ca.IsEntitled(ctx, cfg, NewChainAuthArgsForSpace(spaceId, alice.Hex(), PermissionWrite))
+	require.NoError(t, err)
+	require.True(t, result.IsEntitled())
+	require.True(t, DetailsOf(result).FromCache)
+
+	// Cached explanations are computed from the data IsEntitled decided from.
+	explanation, err = ca.ExplainEntitlement(
+		ctx, cfg, NewChainAuthArgsForSpace(spaceId, alice.Hex(), PermissionWrite), ExplainOpts{Cached: true})
+	require.NoError(t, err)
+	require.True(t, explanation.Allowed)
+	require.Empty(t, explanation.DeniedAt)
+}
+
+func TestExplainEntitlementDeniedAt(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	owner := common.HexToAddress("0x0e")
+	alice := common.HexToAddress("0xa11ce")
+	bob := common.HexToAddress("0xb0b")
+	carol := common.HexToAddress("0xca201")
+	dave := common.HexToAddress("0xda4e")
+	erin := common.HexToAddress("0xe41")
+	mallory := common.HexToAddress("0x3a11")
+	spaceContract := &channelsSpaceContract{
+		fakeSpaceContract: newFakeSpaceContract(owner, alice, bob, carol),
+		disabled:          map[shared.StreamId]bool{},
+	}
+	spaceContract.banned[carol] = true
+	spaceContract.members[erin] = true
+	ca := newTestChainAuth(t, ctx, &expiringSpaceContract{
+		fakeSpaceContract: spaceContract.fakeSpaceContract,
+		expired:           map[common.Address]bool{dave: true},
+	})
+	defer ca.Close()
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+
+	denyList, err := NewDenyListPolicyHook(&config.EntitlementDenyListConfig{Principals: []string{bob.Hex()}})
+	require.NoError(t, err)
+	ca.AddPolicyHook(denyList)
+
+	space := func(principal common.Address) *ChainAuthArgs {
+		return NewChainAuthArgsForSpace(spaceId, principal.Hex(), PermissionWrite)
+	}
+	testCases := map[string]struct {
+		args     *ChainAuthArgs
+		reason   EntitlementResultReason
+		deniedAt string
+	}{
+		"allowed": {space(alice), EntitlementResultReason_NONE, ""},
+		"wallet not linked": {
+			NewChainAuthArgsForIsWalletLinked(alice.Bytes(), bob.Bytes()),
+			EntitlementResultReason_WALLET_NOT_LINKED,
+			checkStageLinkedWallets,
+		},
+		"not a member":       {space(mallory), EntitlementResultReason_MEMBERSHIP, checkStageMembership},
+		"expired membership": {space(dave), EntitlementResultReason_MEMBERSHIP_EXPIRED, checkStageMembership},
+		"banned":             {space(carol), EntitlementResultReason_BANNED, checkStageBanList},
+		"not entitled":       {space(erin), EntitlementResultReason_SPACE_ENTITLEMENTS, checkStageRuleEvaluation},
+		"denied by a hook":   {space(bob), EntitlementResultReason_POLICY_DENIED, checkStagePolicyHooks},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			explanation, err := ca.ExplainEntitlement(ctx, cfg, tc.args, ExplainOpts{})
+			require.NoError(t, err)
+			require.Equal(t, tc.deniedAt == "", explanation.Allowed)
+			require.Equal(t, tc.reason, explanation.Reason)
+			require.Equal(t, tc.deniedAt, explanation.DeniedAt)
+		})
+	}
+
+	// The membership of each wallet is explained.
+	explanation, err := ca.ExplainEntitlement(ctx, cfg, space(dave), ExplainOpts{})
+	require.NoError(t, err)
+	require.Equal(t, []WalletMembershipExplanation{{Wallet: dave, IsMember: true, IsExpired: true}},
+		explanation.Memberships)
+
+	// Disabled channels are denied before the wallets are looked up.
+	channelId := testutils.MakeChannelId(spaceId)
+	spaceContract.disabled[channelId] = true
+	channelCa := newTestChainAuth(t, ctx, spaceContract)
+	defer channelCa.Close()
+	explanation, err = channelCa.ExplainEntitlement(
+		ctx, cfg, NewChainAuthArgsForChannel(spaceId, channelId, alice.Hex(), PermissionWrite), ExplainOpts{})
+	require.NoError(t, err)
+	require.False(t, explanation.Allowed)
+	require.Equal(t, EntitlementResultReason_CHANNEL_DISABLED, explanation.Reason)
+	require.Equal(t, checkStageStreamEnabled, explanation.DeniedAt)
+	require.Empty(t, explanation.Wallets)
+}
@@ -2,9 +2,15 @@ package auth
 
 import (
 	"context"
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
 
 	"github.com/towns-protocol/towns/core/config"
+	"github.com/towns-protocol/towns/core/contracts/types"
 	"github.com/towns-protocol/towns/core/node/protocol"
+	"github.com/towns-protocol/towns/core/node/shared"
 )
 
 // This checkers always returns true, used for some testing scenarios.
@@ -27,6 +33,73 @@ func (a *fakeChainAuth) IsEntitled(
 	}, nil
 }
 
+func (a *fakeChainAuth) IsEntitledToPermissions(
+	ctx context.Context,
+	cfg *config.Config,
+	spaceId shared.StreamId,
+	channelId shared.StreamId,
+	userId string,
+	permissions []Permission,
+) (map[Permission]IsEntitledResult, error) {
+	results := make(map[Permission]IsEntitledResult, len(permissions))
+	for _, permission := range permissions {
+		results[permission] = &isEntitledResult{
+			isAllowed: true,
+			reason:    EntitlementResultReason_NONE,
+		}
+	}
+	return results, nil
+}
+
+func (a *fakeChainAuth) IsEntitledToChannels(
+	ctx context.Context,
+	cfg *config.Config,
+	spaceId shared.StreamId,
+	channelIds []shared.StreamId,
+	userId string,
+	permission Permission,
+) (map[shared.StreamId]IsEntitledResult, error) {
+	results := make(map[shared.StreamId]IsEntitledResult, len(channelIds))
+	for _, channelId := range channelIds {
+		results[channelId] = &isEntitledResult{
+			isAllowed: true,
+			reason:    EntitlementResultReason_NONE,
+		}
+	}
+	return results, nil
+}
+
+func (a *fakeChainAuth) CheckEntitlementsForPrincipals(
+	ctx context.Context,
+	cfg *config.Config,
+	spaceId shared.StreamId,
+	principals []common.Address,
+	permission Permission,
+	opts PrincipalsCheckOpts,
+) (map[common.Address]IsEntitledResult, error) {
+	results := make(map[common.Address]IsEntitledResult, len(principals))
+	for _, principal := range principals {
+		results[principal] = &isEntitledResult{
+			isAllowed: true,
+			reason:    EntitlementResultReason_NONE,
+		}
+	}
+	return results, nil
+}
+
+func (a *fakeChainAuth) ExplainEntitlement(
+	ctx context.Context,
+	cfg *config.Config,
+	args *ChainAuthArgs,
+	opts ExplainOpts,
+) (*EntitlementExplanation, error) {
+	return &EntitlementExplanation{
+		Allowed:       true,
+		Reason:        EntitlementResultReason_NONE,
+		StreamEnabled: true,
+	}, nil
+}
+
 func (a *fakeChainAuth) VerifyReceipt(
 	ctx context.Context,
 	cfg *config.Config,
@@ -34,3 +107,114 @@ func (a *fakeChainAuth) VerifyReceipt(
 ) (bool, error) {
 	return true, nil
 }
+
+func (a *fakeChainAuth) VerifyWalletLink(
+	ctx context.Context,
+	cfg *config.Config,
+	rootKey common.Address,
+	wallet common.Address,
+	signature []byte,
+) (bool, error) {
+	return true, nil
+}
+
+func (a *fakeChainAuth) IsBanned(
+	ctx context.Context,
+	cfg *config.Config,
+	spaceId shared.StreamId,
+	principal common.Address,
+) (bool, error) {
+	return false, nil
+}
+
+func (a *fakeChainAuth) GetChannelEntitlements(
+	ctx context.Context,
+	cfg *config.Config,
+	spaceId shared.StreamId,
+	channelId shared.StreamId,
+	permission Permission,
+) ([]types.Entitlement, common.Address, error) {
+	return nil, common.Address{}, nil
+}
+
+func (a *fakeChainAuth) GetSpaceOwner(
+	ctx context.Context,
+	cfg *config.Config,
+	spaceId shared.StreamId,
+) (common.Address, error) {
+	return common.Address{}, nil
+}
+
+func (a *fakeChainAuth) IsSpaceEnabled(
+	ctx context.Context,
+	cfg *config.Config,
+	spaceId shared.StreamId,
+) (*StreamEnabledResult, error) {
+	return &StreamEnabledResult{Enabled: true, Reason: EntitlementResultReason_NONE}, nil
+}
+
+func (a *fakeChainAuth) IsChannelEnabled(
+	ctx context.Context,
+	cfg *config.Config,
+	spaceId shared.StreamId,
+	channelId shared.StreamId,
+) (*StreamEnabledResult, error) {
+	return &StreamEnabledResult{Enabled: true, Reason: EntitlementResultReason_NONE}, nil
+}
+
+func (a *fakeChainAuth) IsSpaceGated(
+	ctx context.Context,
+	cfg *config.Config,
+	spaceId shared.StreamId,
+	permission Permission,
+) (bool, error) {
+	return false, nil
+}
+
+func (a *fakeChainAuth) GetMembershipStatus(
+	ctx context.Context,
+	cfg *config.Config,
+	spaceId shared.StreamId,
+	principal common.Address,
+) (*MembershipStatus, error) {
+	return &MembershipStatus{
+		IsMember:   true,
+		IsExpired:  false,
+		TokenIds:   []*big.Int{},
+		ExpiryTime: big.NewInt(0),
+	}, nil
+}
+
+func (a *fakeChainAuth) GetMembershipExpiry(
+	ctx context.Context,
+	cfg *config.Config,
+	spaceId shared.StreamId,
+	principal common.Address,
+) (time.Time, error) {
+	return time.Time{}, nil
+}
+
+func (a *fakeChainAuth) ListSpaceMembers(
+	ctx context.Context,
+	cfg *config.Config,
+	spaceId shared.StreamId,
+	page int,
+	pageSize int,
+) ([]common.Address, error) {
+	if page > 0 {
+		return nil, ErrNoMoreSpaceMembers
+	}
+	return nil, nil
+}
+
+func (a *fakeChainAuth) GetLinkedWallets(
+	ctx context.Context,
+	cfg *config.Config,
+	principal common.Address,
+	opts LinkedWalletsOpts,
+) ([]common.Address, error) {
+	if opts.ExcludePrincipal {
+		return []common.Address{}, nil
+	}
+	return []common.Address{principal}, nil
+}
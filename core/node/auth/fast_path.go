@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/towns-protocol/towns/core/config"
+	. "github.com/towns-protocol/towns/core/node/base"
+	"github.com/towns-protocol/towns/core/node/infra"
+	. "github.com/towns-protocol/towns/core/node/protocol"
+)
+
+// DEFAULT_FAST_PATH_TIMEOUT is the default timeout of the IsWalletLinked and IsSpaceMember checks.
+const DEFAULT_FAST_PATH_TIMEOUT = 2 * time.Second
+
+// Outcomes of fast path checks, see fastPathChecks.
+const (
+	fastPathOutcomeAllowed = "allowed"
+	fastPathOutcomeDenied  = "denied"
+	fastPathOutcomeTimeout = "timeout"
+	fastPathOutcomeError   = "error"
+)
+
+// fastPathChecks bounds and reports the checks of the kinds that only resolve linked wallets or memberships,
+// IsWalletLinked and IsSpaceMember. They make a few contract calls rather than evaluating entitlements, so
+// they get a shorter timeout than the space and channel checks and are reported apart from them.
+type fastPathChecks struct {
+	timeout time.Duration
+
+	durations *prometheus.HistogramVec
+	outcomes  *prometheus.CounterVec
+}
+
+func newFastPathChecks(cfg *config.ChainConfig, metrics infra.MetricsFactory) *fastPathChecks {
+	timeout := DEFAULT_FAST_PATH_TIMEOUT
+	if cfg.EntitlementFastPathTimeout > 0 {
+		timeout = cfg.EntitlementFastPathTimeout
+	}
+	return &fastPathChecks{
+		timeout: timeout,
+		durations: metrics.NewHistogramVecEx(
+			"entitlement_fast_path_duration_seconds",
+			"Duration of IsWalletLinked and IsSpaceMember checks in seconds by kind, including cache hits",
+			prometheus.DefBuckets,
+			"kind",
+		),
+		outcomes: metrics.NewCounterVecEx(
+			"entitlement_fast_path_checks",
+			"IsWalletLinked and IsSpaceMember checks by kind and outcome",
+			"kind",
+			"outcome",
+		),
+	}
+}
+
+func isFastPathKind(kind chainAuthKind) bool {
+	return kind == chainAuthKindIsWalletLinked || kind == chainAuthKindIsSpaceMember
+}
+
+// timeoutFor returns the timeout of the check of args, defaultTimeout if it isn't a fast path check.
+func (f *fastPathChecks) timeoutFor(args *ChainAuthArgs, defaultTimeout time.Duration) time.Duration {
+	if isFastPathKind(args.kind) {
+		return f.timeout
+	}
+	return defaultTimeout
+}
+
+// observe reports the duration and outcome of the check of args if it is a fast path check.
+func (f *fastPathChecks) observe(args *ChainAuthArgs, allowed bool, err error, duration time.Duration) {
+	if !isFastPathKind(args.kind) {
+		return
+	}
+	outcome := fastPathOutcomeDenied
+	switch {
+	case errors.Is(err, context.DeadlineExceeded) || IsRiverErrorCode(err, Err_DEADLINE_EXCEEDED):
+		outcome = fastPathOutcomeTimeout
+	case err != nil:
+		outcome = fastPathOutcomeError
+	case allowed:
+		outcome = fastPathOutcomeAllowed
+	}
+	kind := args.kind.String()
+	f.durations.WithLabelValues(kind).Observe(duration.Seconds())
+	f.outcomes.WithLabelValues(kind, outcome).Inc()
+}
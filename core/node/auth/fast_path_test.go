@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/towns-protocol/towns/core/config"
+	"github.com/towns-protocol/towns/core/contracts/base"
+	. "github.com/towns-protocol/towns/core/node/base"
+	"github.com/towns-protocol/towns/core/node/base/test"
+	"github.com/towns-protocol/towns/core/node/shared"
+	"github.com/towns-protocol/towns/core/node/testutils"
+)
+
+func TestFastPathChecks(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	alice := common.HexToAddress("0xa11ce")
+	bob := common.HexToAddress("0xb0b")
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+	ca := newTestChainAuth(t, ctx, newFakeSpaceContract(common.HexToAddress("0x0e"), alice))
+	outcomes := func(kind chainAuthKind, outcome string) int {
+		return int(testutil.ToFloat64(ca.fastPaths.outcomes.WithLabelValues(kind.String(), outcome)))
+	}
+
+	result, err := ca.IsEntitled(ctx, cfg, NewChainAuthArgsForIsSpaceMember(spaceId, alice.Hex()))
+	require.NoError(t, err)
+	require.True(t, result.IsEntitled())
+	result, err = ca.IsEntitled(ctx, cfg, NewChainAuthArgsForIsSpaceMember(spaceId, bob.Hex()))
+	require.NoError(t, err)
+	require.False(t, result.IsEntitled())
+	require.Equal(t, 1, outcomes(chainAuthKindIsSpaceMember, fastPathOutcomeAllowed))
+	require.Equal(t, 1, outcomes(chainAuthKindIsSpaceMember, fastPathOutcomeDenied))
+
+	// The space and channel checks are not reported as fast paths.
+	_, err = ca.IsEntitled(ctx, cfg, NewChainAuthArgsForSpace(spaceId, alice.Hex(), PermissionRead))
+	require.NoError(t, err)
+	require.Equal(t, 1, testutil.CollectAndCount(ca.fastPaths.durations))
+	require.Equal(t, 2, testutil.CollectAndCount(ca.fastPaths.outcomes))
+
+	// A hung wallet link read aborts at the deadline of the fast path rather than at the contract calls timeout.
+	require.Equal(t, DEFAULT_FAST_PATH_TIMEOUT, ca.fastPaths.timeout)
+	require.Greater(t, time.Duration(ca.contractCallsTimeoutMs)*time.Millisecond, 2*DEFAULT_FAST_PATH_TIMEOUT)
+	ca.fastPaths.timeout = 100 * time.Millisecond
+	walletLink, err := base.NewWalletLink(common.HexToAddress("0xabc"), &fakeWalletLinkBackend{t: t})
+	require.NoError(t, err)
+	evaluator := &blockingLinkedWalletsEvaluator{started: make(chan struct{}), release: make(chan struct{})}
+	ca.walletResolver = &WalletResolver{evaluator: evaluator, walletLink: walletLink}
+
+	start := time.Now()
+	_, err = ca.IsEntitled(ctx, cfg, NewChainAuthArgsForIsWalletLinked(alice.Bytes(), bob.Bytes()))
+	elapsed := time.Since(start)
+	require.Error(t, err)
+	require.GreaterOrEqual(t, elapsed, ca.fastPaths.timeout)
+	require.Less(t, elapsed, DEFAULT_FAST_PATH_TIMEOUT)
+	require.Equal(t, 1, outcomes(chainAuthKindIsWalletLinked, fastPathOutcomeTimeout), AsRiverError(err))
+}
@@ -0,0 +1,370 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sync/semaphore"
+
+	"github.com/towns-protocol/towns/core/config"
+	"github.com/towns-protocol/towns/core/contracts/types"
+	"github.com/towns-protocol/towns/core/node/crypto"
+	"github.com/towns-protocol/towns/core/node/infra"
+	"github.com/towns-protocol/towns/core/node/logging"
+	"github.com/towns-protocol/towns/core/node/shared"
+)
+
+const (
+	DEFAULT_JOIN_PREWARM_CONCURRENCY = 4
+	DEFAULT_JOIN_PREWARM_MAX_CHECKS  = 10
+	DEFAULT_JOIN_PREWARM_TIMEOUT     = 10 * time.Second
+	// joinPrewarmMaxPending caps the joins waiting for the block they were seen in to complete.
+	joinPrewarmMaxPending = 1000
+	// joinFirstActionWindow is the time after a join during which checks of the new member count as first
+	// actions, and joinFirstActionMaxTracked caps the number of joins tracked at once.
+	joinFirstActionWindow     = time.Minute
+	joinFirstActionMaxTracked = 10000
+)
+
+// joinPrewarmer resolves the entitlements a user needs right after joining a space, such as reading and
+// writing the default channels, so that the first actions of new members are served from warm caches.
+// Pre-warming runs on the work queue of chainAuth at the prefetch priority, and is bounded by a cap on the
+// joins being pre-warmed and a per-join budget of checks. Joins over the cap, or dropped by the work queue,
+// are not pre-warmed, as pre-warming is only an optimization.
+type joinPrewarmer struct {
+	enabled     bool
+	concurrency *semaphore.Weighted
+	maxChecks   int
+	timeout     time.Duration
+
+	mu sync.Mutex
+	// pending are the joins seen in blocks whose invalidations are not applied yet.
+	pending []pendingJoin
+	// recentJoins tracks the actions new members performed since they joined to report whether they hit
+	// the caches.
+	recentJoins map[recentJoinKey]*recentJoin
+
+	prewarms     *prometheus.CounterVec
+	firstActions *prometheus.CounterVec
+}
+
+type pendingJoin struct {
+	blockNum   crypto.BlockNumber
+	spaceId    shared.StreamId
+	principals []common.Address
+}
+
+type recentJoinKey struct {
+	spaceId   shared.StreamId
+	principal common.Address
+}
+
+type recentJoin struct {
+	joinedAt time.Time
+	actions  map[joinActionKey]struct{}
+}
+
+func (j *recentJoin) isExpired(now time.Time) bool {
+	return now.Sub(j.joinedAt) > joinFirstActionWindow
+}
+
+// joinActionKey identifies the distinct checks of a new member, repeated checks only count once.
+type joinActionKey struct {
+	kind             chainAuthKind
+	channelId        shared.StreamId
+	permission       Permission
+	customPermission string
+	permissions      string
+	permissionMode   PermissionMode
+}
+
+func newJoinPrewarmer(cfg *config.ChainConfig, metrics infra.MetricsFactory) *joinPrewarmer {
+	concurrency := DEFAULT_JOIN_PREWARM_CONCURRENCY
+	if cfg.EntitlementJoinPrewarmConcurrency > 0 {
+		concurrency = cfg.EntitlementJoinPrewarmConcurrency
+	}
+	maxChecks := DEFAULT_JOIN_PREWARM_MAX_CHECKS
+	if cfg.EntitlementJoinPrewarmMaxChecks > 0 {
+		maxChecks = cfg.EntitlementJoinPrewarmMaxChecks
+	}
+	timeout := DEFAULT_JOIN_PREWARM_TIMEOUT
+	if cfg.EntitlementJoinPrewarmTimeout > 0 {
+		timeout = cfg.EntitlementJoinPrewarmTimeout
+	}
+
+	return &joinPrewarmer{
+		enabled:     !cfg.DisableEntitlementJoinPrewarm,
+		concurrency: semaphore.NewWeighted(int64(concurrency)),
+		maxChecks:   maxChecks,
+		timeout:     timeout,
+		recentJoins: make(map[recentJoinKey]*recentJoin),
+		prewarms: metrics.NewCounterVecEx(
+			"entitlement_join_prewarms", "Entitlement caches pre-warmed for new space members by outcome", "result"),
+		firstActions: metrics.NewCounterVecEx(
+			"entitlement_join_first_actions",
+			"Distinct entitlement checks of new space members shortly after joining by cache result",
+			"result",
+		),
+	}
+}
+
+// onJoin starts tracking the first actions of the principals in the space. Joins that are already tracked
+// keep the actions seen so far. Expired joins are removed once the tracking limit is reached, joins over the
+// limit are not tracked.
+func (jp *joinPrewarmer) onJoin(spaceId shared.StreamId, principals []common.Address) {
+	jp.mu.Lock()
+	defer jp.mu.Unlock()
+
+	now := time.Now()
+	for _, principal := range principals {
+		key := recentJoinKey{spaceId: spaceId, principal: principal}
+		if join, ok := jp.recentJoins[key]; ok && !join.isExpired(now) {
+			continue
+		}
+		if len(jp.recentJoins) >= joinFirstActionMaxTracked {
+			for key, join := range jp.recentJoins {
+				if join.isExpired(now) {
+					delete(jp.recentJoins, key)
+				}
+			}
+			if len(jp.recentJoins) >= joinFirstActionMaxTracked {
+				return
+			}
+		}
+		jp.recentJoins[key] = &recentJoin{joinedAt: now, actions: make(map[joinActionKey]struct{})}
+	}
+}
+
+// recordAction reports whether a check of a new member was served from the cache, the first time the member
+// performs it after joining.
+func (jp *joinPrewarmer) recordAction(args *ChainAuthArgs, cacheHit bool) {
+	if args.principal == (common.Address{}) {
+		return
+	}
+
+	key := recentJoinKey{spaceId: args.spaceId, principal: args.principal}
+	jp.mu.Lock()
+	join, ok := jp.recentJoins[key]
+	if !ok {
+		jp.mu.Unlock()
+		return
+	}
+	if join.isExpired(time.Now()) {
+		delete(jp.recentJoins, key)
+		jp.mu.Unlock()
+		return
+	}
+	action := joinActionKey{
+		kind:             args.kind,
+		channelId:        args.channelId,
+		permission:       args.permission,
+		customPermission: args.customPermission,
+		permissions:      args.permissions,
+		permissionMode:   args.permissionMode,
+	}
+	_, seen := join.actions[action]
+	join.actions[action] = struct{}{}
+	jp.mu.Unlock()
+
+	if seen {
+		return
+	}
+	if cacheHit {
+		jp.firstActions.WithLabelValues("hit").Inc()
+	} else {
+		jp.firstActions.WithLabelValues("miss").Inc()
+	}
+}
+
+// deferJoin queues a join until the invalidations of the block it was seen in are applied, as entries warmed
+// before would be busted. Returns false if too many joins are pending.
+func (jp *joinPrewarmer) deferJoin(join pendingJoin) bool {
+	jp.mu.Lock()
+	defer jp.mu.Unlock()
+	if len(jp.pending) >= joinPrewarmMaxPending {
+		return false
+	}
+	jp.pending = append(jp.pending, join)
+	return true
+}
+
+// takeReady removes and returns the pending joins seen in blocks up to blockNum.
+func (jp *joinPrewarmer) takeReady(blockNum crypto.BlockNumber) []pendingJoin {
+	jp.mu.Lock()
+	defer jp.mu.Unlock()
+	var ready []pendingJoin
+	pending := jp.pending[:0]
+	for _, join := range jp.pending {
+		if join.blockNum <= blockNum {
+			ready = append(ready, join)
+		} else {
+			pending = append(pending, join)
+		}
+	}
+	jp.pending = pending
+	return ready
+}
+
+// prewarmBudget is the number of checks a single join may still perform.
+type prewarmBudget struct {
+	remaining int
+}
+
+func (b *prewarmBudget) take(n int) bool {
+	if b.remaining < n {
+		return false
+	}
+	b.remaining -= n
+	return true
+}
+
+// onMemberJoined tracks the first actions of users that joined the space and pre-warms their entitlements.
+// blockNum is the block the join was seen in, pre-warming waits for the invalidations of that block to be
+// applied. It is zero, or there is no chain monitor, if the invalidations were applied right away.
+func (ca *chainAuth) onMemberJoined(
+	ctx context.Context,
+	spaceId shared.StreamId,
+	blockNum crypto.BlockNumber,
+	principals []common.Address,
+) {
+	jp := ca.joinPrewarmer
+	jp.onJoin(spaceId, principals)
+	if !jp.enabled || len(principals) == 0 {
+		return
+	}
+
+	if ca.blockchain.ChainMonitor == nil || blockNum == 0 {
+		ca.startJoinPrewarms(ctx, spaceId, principals)
+		return
+	}
+	if !jp.deferJoin(pendingJoin{blockNum: blockNum, spaceId: spaceId, principals: principals}) {
+		jp.prewarms.WithLabelValues("dropped").Add(float64(len(principals)))
+	}
+}
+
+// onPrewarmBlock starts pre-warming the joins seen in blocks up to blockNum, once their invalidations
+// are applied.
+func (ca *chainAuth) onPrewarmBlock(ctx context.Context, blockNum crypto.BlockNumber) {
+	// Pending joins are kept while chainAuth is read-only and pre-warmed on the first block after it.
+	if ca.readOnly.active() {
+		return
+	}
+	for _, join := range ca.joinPrewarmer.takeReady(blockNum) {
+		ca.startJoinPrewarms(ctx, join.spaceId, join.principals)
+	}
+}
+
+func (ca *chainAuth) startJoinPrewarms(ctx context.Context, spaceId shared.StreamId, principals []common.Address) {
+	jp := ca.joinPrewarmer
+	for _, principal := range principals {
+		if !jp.concurrency.TryAcquire(1) {
+			jp.prewarms.WithLabelValues("dropped").Inc()
+			continue
+		}
+		// Pre-warming outlives the request or event that triggered it.
+		ca.workQueue.submit(context.WithoutCancel(ctx), &workTask{
+			priority: workPriorityPrefetch,
+			spaceId:  spaceId,
+			deadline: time.Now().Add(jp.timeout),
+			run: func(ctx context.Context) {
+				defer jp.concurrency.Release(1)
+				ca.prewarmJoin(ctx, spaceId, principal)
+			},
+			dropped: func() {
+				jp.concurrency.Release(1)
+				jp.prewarms.WithLabelValues("dropped").Inc()
+			},
+		})
+	}
+}
+
+// prewarmJoin resolves the membership and linked wallets of the principal and whether it can read and write
+// the space and its default channels, starting with the general channel, until the budget is spent. The
+// deadline of ctx is the pre-warm timeout set when the join was queued.
+func (ca *chainAuth) prewarmJoin(ctx context.Context, spaceId shared.StreamId, principal common.Address) {
+	jp := ca.joinPrewarmer
+	log := logging.FromCtx(ctx).With("spaceId", spaceId, "principal", principal)
+
+	budget := &prewarmBudget{remaining: jp.maxChecks}
+	userId := principal.Hex()
+
+	check := func(args *ChainAuthArgs) error {
+		_, _, err := ca.entitlementCache.executeUsingCache(ctx, nil, args, ca.checkEntitlement)
+		return err
+	}
+	checkReadWrite := func(channelId shared.StreamId) error {
+		for _, permission := range warmedPermissions {
+			args := NewChainAuthArgsForSpace(spaceId, userId, permission)
+			if channelId != (shared.StreamId{}) {
+				args = NewChainAuthArgsForChannel(spaceId, channelId, userId, permission)
+			}
+			if err := check(args); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	err := func() error {
+		if !budget.take(1) {
+			return nil
+		}
+		if err := check(NewChainAuthArgsForIsSpaceMember(spaceId, userId)); err != nil {
+			return err
+		}
+
+		if !budget.take(len(warmedPermissions)) {
+			return nil
+		}
+		if err := checkReadWrite(shared.StreamId{}); err != nil {
+			return err
+		}
+
+		general, err := shared.MakeDefaultChannelId(spaceId)
+		if err != nil {
+			return err
+		}
+		if !budget.take(len(warmedPermissions)) {
+			return nil
+		}
+		if err := checkReadWrite(general); err != nil {
+			return err
+		}
+
+		if !budget.take(1) {
+			return nil
+		}
+		channels, err := retryRpc(
+			ctx,
+			ca.rpcRetry,
+			"GetChannels",
+			func(ctx context.Context) ([]types.BaseChannel, error) {
+				return ca.spaceContract.GetChannels(ctx, spaceId)
+			},
+		)
+		if err != nil {
+			return err
+		}
+		for _, channel := range channels {
+			if channel.Disabled || channel.Id == general {
+				continue
+			}
+			if !budget.take(len(warmedPermissions)) {
+				return nil
+			}
+			if err := checkReadWrite(channel.Id); err != nil {
+				return err
+			}
+		}
+		return nil
+	}()
+	if err != nil {
+		jp.prewarms.WithLabelValues("failed").Inc()
+		log.Debugw("Failed to pre-warm entitlement caches for new space member", "error", err)
+		return
+	}
+	jp.prewarms.WithLabelValues("warmed").Inc()
+}
@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/towns-protocol/towns/core/config"
+	"github.com/towns-protocol/towns/core/contracts/types"
+	"github.com/towns-protocol/towns/core/node/base/test"
+	"github.com/towns-protocol/towns/core/node/crypto"
+	"github.com/towns-protocol/towns/core/node/infra"
+	"github.com/towns-protocol/towns/core/node/shared"
+	"github.com/towns-protocol/towns/core/node/testutils"
+)
+
+func TestJoinPrewarm(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	bob := common.HexToAddress("0xb0b")
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+	general, err := shared.MakeDefaultChannelId(spaceId)
+	require.NoError(t, err)
+	random := testutils.MakeChannelId(spaceId)
+	disabled := testutils.MakeChannelId(spaceId)
+
+	// firstActions joins bob to the space and performs his first actions, returns the number of distinct
+	// actions that were served from the cache and the number that were not.
+	firstActions := func(chainCfg *config.ChainConfig) (*chainAuth, *fakeSpaceContract, float64, float64) {
+		spaceContract := newFakeSpaceContract(common.HexToAddress("0x0e"), bob)
+		spaceContract.channels = []types.BaseChannel{
+			{Id: general},
+			{Id: random},
+			{Id: disabled, Disabled: true},
+		}
+		ca, err := newChainAuth(
+			ctx,
+			&crypto.Blockchain{Config: chainCfg},
+			nil,
+			spaceContract,
+			nil,
+			nil,
+			0,
+			0,
+			0,
+			0,
+			nil,
+			infra.NewMetricsFactory(prometheus.NewRegistry(), "", ""),
+		)
+		require.NoError(t, err)
+
+		ca.onSpaceEvent(ctx, SpaceEvent{
+			Type:      SpaceEventType_MEMBERSHIP_CHANGED,
+			SpaceId:   spaceId,
+			BlockNum:  1,
+			Addresses: []common.Address{bob},
+		})
+		if !chainCfg.DisableEntitlementJoinPrewarm {
+			require.Eventually(t, func() bool {
+				return testutil.ToFloat64(ca.joinPrewarmer.prewarms.WithLabelValues("warmed")) == 1
+			}, 5*time.Second, 10*time.Millisecond)
+		}
+
+		for _, args := range []*ChainAuthArgs{
+			NewChainAuthArgsForSpace(spaceId, bob.Hex(), PermissionRead),
+			NewChainAuthArgsForChannel(spaceId, general, bob.Hex(), PermissionRead),
+			NewChainAuthArgsForChannel(spaceId, general, bob.Hex(), PermissionWrite),
+			NewChainAuthArgsForChannel(spaceId, random, bob.Hex(), PermissionRead),
+			// Repeated actions only count once.
+			NewChainAuthArgsForChannel(spaceId, general, bob.Hex(), PermissionWrite),
+		} {
+			result, err := ca.IsEntitled(ctx, cfg, args)
+			require.NoError(t, err)
+			require.True(t, result.IsEntitled())
+		}
+
+		// Checks of members that didn't just join are not counted.
+		_, err = ca.IsEntitled(ctx, cfg, NewChainAuthArgsForSpace(spaceId, "0x0e", PermissionRead))
+		require.NoError(t, err)
+
+		actions := ca.joinPrewarmer.firstActions
+		return ca, spaceContract,
+			testutil.ToFloat64(actions.WithLabelValues("hit")),
+			testutil.ToFloat64(actions.WithLabelValues("miss"))
+	}
+
+	// Without pre-warming, all first actions hit cold caches.
+	_, spaceContract, hits, misses := firstActions(&config.ChainConfig{DisableEntitlementJoinPrewarm: true})
+	require.Zero(t, hits)
+	require.Equal(t, 4.0, misses)
+	require.Zero(t, spaceContract.callCount("GetChannels"))
+
+	// With pre-warming, all first actions are served from the cache.
+	ca, spaceContract, hits, misses := firstActions(&config.ChainConfig{})
+	require.Equal(t, 4.0, hits)
+	require.Zero(t, misses)
+	require.Equal(t, 1, spaceContract.callCount("GetChannels"))
+	require.Zero(t, testutil.ToFloat64(ca.joinPrewarmer.prewarms.WithLabelValues("failed")))
+
+	// The budget of a join bounds the channels that are warmed: the membership, the space and the general
+	// channel fit in 5 checks, the other channels don't.
+	_, spaceContract, hits, misses = firstActions(&config.ChainConfig{EntitlementJoinPrewarmMaxChecks: 5})
+	require.Equal(t, 3.0, hits)
+	require.Equal(t, 1.0, misses)
+	require.Zero(t, spaceContract.callCount("GetChannels"))
+}
+
+func TestJoinPrewarmWaitsForBlock(t *testing.T) {
+	jp := newJoinPrewarmer(&config.ChainConfig{}, infra.NewMetricsFactory(prometheus.NewRegistry(), "", ""))
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+
+	for _, blockNum := range []crypto.BlockNumber{3, 1, 2} {
+		require.True(t, jp.deferJoin(pendingJoin{blockNum: blockNum, spaceId: spaceId}))
+	}
+	require.Empty(t, jp.takeReady(0))
+
+	ready := jp.takeReady(2)
+	require.Len(t, ready, 2)
+	require.Equal(t, crypto.BlockNumber(1), ready[0].blockNum)
+	require.Equal(t, crypto.BlockNumber(2), ready[1].blockNum)
+
+	ready = jp.takeReady(5)
+	require.Len(t, ready, 1)
+	require.Equal(t, crypto.BlockNumber(3), ready[0].blockNum)
+	require.Empty(t, jp.takeReady(5))
+}
@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	. "github.com/towns-protocol/towns/core/node/base"
+	"github.com/towns-protocol/towns/core/node/logging"
+	. "github.com/towns-protocol/towns/core/node/protocol"
+	"github.com/towns-protocol/towns/core/xchain/entitlement"
+)
+
+// DEFAULT_LINKED_WALLETS_FALLBACK_TTL is the default time the linked wallets read from the base chain only, and
+// the decisions made with them, are cached.
+const DEFAULT_LINKED_WALLETS_FALLBACK_TTL = 30 * time.Second
+
+// resolveLinkedWallets resolves the wallets linked to the principal. If the cross-chain evaluator fails with a
+// transient error, the wallets are read from the wallet link contract on the base chain alone, which answers
+// correctly for the users without mainnet delegations. Such wallets are cached for a shorter time, see
+// linkedWalletCacheValue.baseChainOnlyUntil.
+//
+// The lookup stops as soon as the principal has more wallets than the highest linked wallets limit, and fails with
+// Err_LINKED_WALLETS_LIMIT_EXCEEDED without materializing the wallets.
+func (ca *chainAuth) resolveLinkedWallets(
+	ctx context.Context,
+	principal common.Address,
+) (*linkedWalletCacheValue, error) {
+	limit := ca.linkedWalletsLimit.lookupLimit()
+	wallets, err := ca.walletResolver.LinkedWallets(ctx, principal, limit)
+	if err == nil {
+		return &linkedWalletCacheValue{wallets: wallets}, nil
+	}
+	if errors.Is(err, entitlement.ErrTooManyLinkedWallets) {
+		return nil, ca.linkedWalletsOverflow(principal, limit)
+	}
+	if !isRetryableRpcError(ctx, err) {
+		return nil, err
+	}
+
+	log := logging.FromCtx(ctx)
+	wallets, fallbackErr := ca.walletResolver.BaseChainLinkedWallets(ctx, principal, limit)
+	if errors.Is(fallbackErr, entitlement.ErrTooManyLinkedWallets) {
+		return nil, ca.linkedWalletsOverflow(principal, limit)
+	}
+	if fallbackErr != nil {
+		ca.linkedWalletsFallbacks.WithLabelValues("failed").Inc()
+		log.Warnw("Failed to read linked wallets from the base chain after the evaluator failed",
+			"wallet", principal, "evaluatorError", err, "error", fallbackErr)
+		return nil, err
+	}
+	ca.linkedWalletsFallbacks.WithLabelValues("succeeded").Inc()
+	log.Warnw("Read linked wallets from the base chain only, the evaluator failed",
+		"wallet", principal, "error", err)
+	return &linkedWalletCacheValue{
+		wallets:            wallets,
+		baseChainOnlyUntil: ca.clock.Now().Add(ca.walletsFallbackTTL),
+	}, nil
+}
+
+// linkedWalletsOverflow records that the principal exceeds the linked wallets limit and returns the error of the
+// lookup. The error is not cached, raising the limit takes effect with the next lookup.
+func (ca *chainAuth) linkedWalletsOverflow(principal common.Address, limit int) error {
+	ca.linkedWalletsLimit.check(principal, limit+1, limit)
+	return RiverError(Err_LINKED_WALLETS_LIMIT_EXCEEDED,
+		"too many wallets linked to the root key", "rootKey", principal, "limit", limit)
+}
@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/towns-protocol/towns/core/config"
+	"github.com/towns-protocol/towns/core/contracts/base"
+	"github.com/towns-protocol/towns/core/node/base/test"
+	"github.com/towns-protocol/towns/core/node/infra"
+	"github.com/towns-protocol/towns/core/node/shared"
+	"github.com/towns-protocol/towns/core/node/testutils"
+)
+
+// failingLinkedWalletsEvaluator fails all linked wallet lookups with err.
+type failingLinkedWalletsEvaluator struct {
+	err error
+}
+
+func (e *failingLinkedWalletsEvaluator) GetLinkedWallets(
+	_ context.Context,
+	_ common.Address,
+	_ int,
+	_ *base.WalletLink,
+	_ *prometheus.HistogramVec,
+	_ *infra.StatusCounterVec,
+	_ *infra.StatusCounterVec,
+) ([]common.Address, error) {
+	return nil, e.err
+}
+
+func TestLinkedWalletsFallback(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	rootKey := common.HexToAddress("0x5007")
+	linked := common.HexToAddress("0x11e4")
+	spaceContract := newFakeSpaceContract(common.HexToAddress("0x0e"), linked)
+	ca := newTestChainAuth(t, ctx, spaceContract)
+	defer ca.Close()
+	require.Equal(t, DEFAULT_LINKED_WALLETS_FALLBACK_TTL, ca.walletsFallbackTTL)
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+
+	backend := &fakeWalletLinkBackend{
+		t:                t,
+		walletsByRootKey: map[common.Address][]common.Address{rootKey: {linked}},
+	}
+	walletLink, err := base.NewWalletLink(common.HexToAddress("0xabc"), backend)
+	require.NoError(t, err)
+	evaluator := &failingLinkedWalletsEvaluator{err: syscall.ECONNREFUSED}
+	ca.walletResolver = &WalletResolver{evaluator: evaluator, walletLink: walletLink}
+	args := NewChainAuthArgsForSpace(spaceId, rootKey.Hex(), PermissionWrite)
+
+	// With the evaluator down the wallets are read from the base chain, and the results made with them are
+	// cached for a shorter time.
+	before := time.Now()
+	result, err := ca.IsEntitled(ctx, cfg, args)
+	require.NoError(t, err)
+	require.True(t, result.IsEntitled())
+	require.True(t, DetailsOf(result).BaseChainOnlyWallets)
+	require.Equal(t, 1.0, testutil.ToFloat64(ca.linkedWalletsFallbacks.WithLabelValues("succeeded")))
+
+	for _, lookup := range []struct {
+		cache *entitlementCache
+		key   *ChainAuthArgs
+	}{
+		{ca.linkedWalletCache, newArgsForLinkedWallets(rootKey)},
+		{ca.entitlementCache, args},
+	} {
+		val, ok := lookup.cache.lookup(ctx, lookup.key)
+		require.True(t, ok)
+		expiresAt := val.(*timestampedCacheValue).expiresAt
+		require.False(t, expiresAt.Before(before.Add(DEFAULT_LINKED_WALLETS_FALLBACK_TTL)))
+		require.False(t, expiresAt.After(time.Now().Add(DEFAULT_LINKED_WALLETS_FALLBACK_TTL)))
+	}
+
+	result, err = ca.IsEntitled(ctx, cfg, args)
+	require.NoError(t, err)
+	require.True(t, DetailsOf(result).BaseChainOnlyWallets)
+	require.True(t, DetailsOf(result).FromCache)
+
+	// Errors that are not transient don't fall back.
+	uncached := withoutCache(ctx)
+	evaluator.err = errors.New("execution reverted")
+	_, err = ca.IsEntitled(uncached, cfg, args)
+	require.Error(t, err)
+	require.Equal(t, 1.0, testutil.ToFloat64(ca.linkedWalletsFallbacks.WithLabelValues("succeeded")))
+
+	// The check fails if the base chain is down as well.
+	evaluator.err = syscall.ECONNREFUSED
+	backend.err = syscall.ECONNREFUSED
+	_, err = ca.IsEntitled(uncached, cfg, args)
+	require.Error(t, err)
+	require.Equal(t, 1.0, testutil.ToFloat64(ca.linkedWalletsFallbacks.WithLabelValues("failed")))
+}
@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"maps"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/prometheus/client_golang/prometheus"
+
+	. "github.com/towns-protocol/towns/core/node/base"
+	. "github.com/towns-protocol/towns/core/node/protocol"
+)
+
+// linkedWalletsLimit holds the maximum number of linked wallets that are evaluated for a principal.
+//
+// The limit can be changed at runtime. Lowering it does not invalidate the caches: allows that were cached
+// while the principal was within the old limit are honored until they expire, and evaluations after that
+// enforce the new limit. Checks that fail because of the limit are never cached, so raising the limit takes
+// effect with the next check.
+//
+// Checks of the permissions in byPermission are evaluated against their own limit instead, see forArgs. Linked
+// wallets are looked up up to the highest of the limits, see lookupLimit.
+type linkedWalletsLimit struct {
+	limit        atomic.Int64
+	byPermission map[Permission]int
+
+	// overLimit holds the principals that exceeded the current limit in their most recent check.
+	mu        sync.Mutex
+	overLimit map[common.Address]struct{}
+	gauge     prometheus.Gauge
+}
+
+func newLinkedWalletsLimit(limit int, byPermission map[Permission]int, gauge prometheus.Gauge) *linkedWalletsLimit {
+	l := &linkedWalletsLimit{
+		byPermission: byPermission,
+		overLimit:    make(map[common.Address]struct{}),
+		gauge:        gauge,
+	}
+	l.set(limit)
+	return l
+}
+
+func (l *linkedWalletsLimit) get() int {
+	return int(l.limit.Load())
+}
+
+// set changes the limit, values <= 0 restore the default. Principals are tracked as over the limit again once
+// they are checked against the new limit.
+func (l *linkedWalletsLimit) set(limit int) {
+	if limit <= 0 {
+		limit = DEFAULT_MAX_WALLETS
+	}
+	if int(l.limit.Swap(int64(limit))) == limit {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	clear(l.overLimit)
+	l.gauge.Set(0)
+}
+
+// lookupLimit returns the number of linked wallets looked up for a principal, the highest of the global limit
+// and the limits of the permissions. The wallets are then evaluated against the limit of each check.
+func (l *linkedWalletsLimit) lookupLimit() int {
+	limit := l.get()
+	for _, permissionLimit := range l.byPermission {
+		limit = max(limit, permissionLimit)
+	}
+	return limit
+}
+
+// forArgs returns the limit of the check of args, the limit of its permission or the global limit if the
+// permission has none. Checks of several permissions get the lowest limit of their permissions.
+func (l *linkedWalletsLimit) forArgs(args *ChainAuthArgs) int {
+	permissions := []Permission{args.permission}
+	if args.permissions != "" {
+		permissions = deserializePermissions(args.permissions)
+	}
+	limit := 0
+	for _, permission := range permissions {
+		permissionLimit, ok := l.byPermission[permission]
+		if !ok {
+			permissionLimit = l.get()
+		}
+		if limit == 0 || permissionLimit < limit {
+			limit = permissionLimit
+		}
+	}
+	return limit
+}
+
+// check returns false if the principal has more wallets than limit and records the outcome. Wallet sets that
+// are not associated with a principal are not tracked.
+func (l *linkedWalletsLimit) check(principal common.Address, wallets int, limit int) bool {
+	ok := wallets <= limit
+	if principal == (common.Address{}) {
+		return ok
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if ok {
+		delete(l.overLimit, principal)
+	} else {
+		l.overLimit[principal] = struct{}{}
+	}
+	l.gauge.Set(float64(len(l.overLimit)))
+	return ok
+}
+
+// parseLinkedWalletsLimitByPermission parses config.Config.LinkedWalletsLimitByPermission.
+func parseLinkedWalletsLimitByPermission(limits map[string]int) (map[Permission]int, error) {
+	if len(limits) == 0 {
+		return nil, nil
+	}
+	ret := make(map[Permission]int, len(limits))
+	for _, name := range slices.Sorted(maps.Keys(limits)) {
+		permission, ok := ParsePermission(name)
+		if !ok {
+			return nil, RiverError(Err_BAD_CONFIG, "Unknown permission in linked wallets limits", "permission", name)
+		}
+		if limits[name] <= 0 {
+			return nil, RiverError(Err_BAD_CONFIG, "Linked wallets limit must be positive",
+				"permission", name, "limit", limits[name])
+		}
+		ret[permission] = limits[name]
+	}
+	return ret, nil
+}
+
+// SetLinkedWalletsLimit changes the maximum number of linked wallets evaluated for a principal.
+// Cached allows remain valid until they expire, new evaluations enforce the new limit.
+func (ca *chainAuth) SetLinkedWalletsLimit(limit int) {
+	ca.linkedWalletsLimit.set(limit)
+}
@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/towns-protocol/towns/core/config"
+	. "github.com/towns-protocol/towns/core/node/base"
+	"github.com/towns-protocol/towns/core/node/crypto"
+	. "github.com/towns-protocol/towns/core/node/protocol"
+	"github.com/towns-protocol/towns/core/xchain/entitlement"
+)
+
+// Spaces live on the default chain of chainAuth unless the args of a check name another chain, see
+// ChainAuthArgs.WithChainId. Space contracts are read and rule entitlements are evaluated through the chain of
+// the space, linked wallets are always read from the default chain.
+
+// EntitlementChain is a chain besides the default chain of chainAuth that spaces live on.
+type EntitlementChain struct {
+	// Blockchain is the client of the chain, it must serve the chain it is registered for.
+	Blockchain *crypto.Blockchain
+	// Evaluator evaluates the rule entitlements of the spaces of the chain. The evaluator of the default chain
+	// is used if nil.
+	Evaluator *entitlement.Evaluator
+}
+
+// entitlementChain is a chain the checks of chainAuth are evaluated on.
+type entitlementChain struct {
+	blockchain    *crypto.Blockchain
+	spaceContract SpaceContract
+	evaluator     *entitlement.Evaluator
+}
+
+// newEntitlementChains validates the additional chains of chainAuth and returns them along with their space
+// contracts. Each chain must have a live client that serves the chain it is registered for. Chains without an
+// evaluator of their own get evaluator.
+func newEntitlementChains(
+	ctx context.Context,
+	architectCfg *config.ContractConfig,
+	chains map[uint64]*EntitlementChain,
+	evaluator *entitlement.Evaluator,
+) (map[uint64]*entitlementChain, error) {
+	if err := validateChains(ctx, chains); err != nil {
+		return nil, err
+	}
+
+	ret := make(map[uint64]*entitlementChain, len(chains))
+	for chainId, chain := range chains {
+		spaceContract, err := NewSpaceContractV3(ctx, architectCfg, chain.Blockchain.Config, chain.Blockchain.Client)
+		if err != nil {
+			return nil, AsRiverError(err).Tag("chainId", chainId)
+		}
+		ret[chainId] = &entitlementChain{
+			blockchain:    chain.Blockchain,
+			spaceContract: spaceContract,
+			evaluator:     evaluator,
+		}
+		if chain.Evaluator != nil {
+			ret[chainId].evaluator = chain.Evaluator
+		}
+	}
+	return ret, nil
+}
+
+func validateChains(ctx context.Context, chains map[uint64]*EntitlementChain) error {
+	for chainId, chain := range chains {
+		if chain == nil || chain.Blockchain == nil || chain.Blockchain.Client == nil || chain.Blockchain.Config == nil {
+			return RiverError(Err_BAD_CONFIG, "Entitlement chain has no client", "chainId", chainId).
+				Func("validateChains")
+		}
+		clientChainId, err := chain.Blockchain.Client.ChainID(ctx)
+		if err != nil {
+			return AsRiverError(err, Err_BAD_CONFIG).
+				Tag("chainId", chainId).
+				Func("validateChains")
+		}
+		if clientChainId.Uint64() != chainId {
+			return RiverError(
+				Err_BAD_CONFIG,
+				"Entitlement chain client serves another chain",
+				"chainId", chainId,
+				"clientChainId", clientChainId,
+			).Func("validateChains")
+		}
+	}
+	return nil
+}
+
+// chainFor returns the additional chain the checks of spaces of the given chain are evaluated on, nil for the
+// default chain, which chainId 0 names as well.
+func (ca *chainAuth) chainFor(chainId uint64) (*entitlementChain, error) {
+	if chainId == 0 {
+		return nil, nil
+	}
+	if chain, ok := ca.chains[chainId]; ok {
+		return chain, nil
+	}
+	if ca.blockchain.ChainId != nil && ca.blockchain.ChainId.Uint64() == chainId {
+		return nil, nil
+	}
+	return nil, RiverError(Err_INVALID_ARGUMENT, "Unknown entitlement chain", "chainId", chainId)
+}
+
+// spaceContractFor returns the space contract of the given chain, the default chain if chainId is 0.
+func (ca *chainAuth) spaceContractFor(chainId uint64) (SpaceContract, error) {
+	chain, err := ca.chainFor(chainId)
+	if err != nil {
+		return nil, err
+	}
+	if chain == nil {
+		return ca.spaceContract, nil
+	}
+	return chain.spaceContract, nil
+}
+
+// evaluatorFor returns the evaluator of the rule entitlements of the given chain, the default chain if chainId
+// is 0.
+func (ca *chainAuth) evaluatorFor(chainId uint64) (*entitlement.Evaluator, error) {
+	chain, err := ca.chainFor(chainId)
+	if err != nil {
+		return nil, err
+	}
+	if chain == nil {
+		return ca.evaluator, nil
+	}
+	return chain.evaluator, nil
+}
+
+// blockchainFor returns the client of the given chain, the default chain if chainId is 0.
+func (ca *chainAuth) blockchainFor(chainId uint64) (*crypto.Blockchain, error) {
+	chain, err := ca.chainFor(chainId)
+	if err != nil {
+		return nil, err
+	}
+	if chain == nil {
+		return ca.blockchain, nil
+	}
+	return chain.blockchain, nil
+}
@@ -0,0 +1,184 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/towns-protocol/towns/core/config"
+	. "github.com/towns-protocol/towns/core/node/base"
+	"github.com/towns-protocol/towns/core/node/base/test"
+	"github.com/towns-protocol/towns/core/node/crypto"
+	"github.com/towns-protocol/towns/core/node/infra"
+	. "github.com/towns-protocol/towns/core/node/protocol"
+	"github.com/towns-protocol/towns/core/node/shared"
+	"github.com/towns-protocol/towns/core/node/testutils"
+	"github.com/towns-protocol/towns/core/xchain/entitlement"
+)
+
+// fakeChainIdClient serves the chain id of a chain, or fails with err if set.
+type fakeChainIdClient struct {
+	crypto.BlockchainClient
+
+	chainId uint64
+	err     error
+}
+
+func (c *fakeChainIdClient) ChainID(context.Context) (*big.Int, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	return new(big.Int).SetUint64(c.chainId), nil
+}
+
+func TestMultiChainEntitlements(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	alice := common.HexToAddress("0xa11ce")
+	bob := common.HexToAddress("0xb0b")
+	defaultContract := newFakeSpaceContract(common.HexToAddress("0x0e"), alice)
+	otherContract := newFakeSpaceContract(common.HexToAddress("0x0e"), bob)
+	ca, err := newChainAuth(
+		ctx,
+		&crypto.Blockchain{ChainId: big.NewInt(8453), Config: &config.ChainConfig{}},
+		nil,
+		defaultContract,
+		map[uint64]*entitlementChain{10: {spaceContract: otherContract}},
+		nil,
+		0,
+		0,
+		0,
+		0,
+		nil,
+		infra.NewMetricsFactory(prometheus.NewRegistry(), "", ""),
+	)
+	require.NoError(t, err)
+	defer ca.Close()
+
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+	for _, tc := range []struct {
+		principal common.Address
+		chainId   uint64
+		entitled  bool
+	}{
+		{alice, 0, true},
+		{alice, 8453, true},
+		{bob, 0, false},
+		{alice, 10, false},
+		{bob, 10, true},
+	} {
+		args := NewChainAuthArgsForSpace(spaceId, tc.principal.Hex(), PermissionWrite).WithChainId(tc.chainId)
+		result, err := ca.IsEntitled(ctx, cfg, args)
+		require.NoError(t, err)
+		require.Equal(t, tc.entitled, result.IsEntitled(), tc)
+	}
+
+	// The space data is cached per chain: chain 10 was read once, through its own contract.
+	require.Equal(t, 1, otherContract.callCount("GetSpaceEntitlementsForPermission"))
+	require.Equal(t, 1, otherContract.callCount("IsSpaceDisabled"))
+
+	// Checks on chains chainAuth wasn't constructed with fail.
+	_, err = ca.IsEntitled(
+		ctx,
+		cfg,
+		NewChainAuthArgsForSpace(spaceId, alice.Hex(), PermissionWrite).WithChainId(1),
+	)
+	require.Equal(t, Err_INVALID_ARGUMENT, AsRiverError(err).Code)
+}
+
+func TestValidateChains(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	newChain := func(client crypto.BlockchainClient) *EntitlementChain {
+		return &EntitlementChain{Blockchain: &crypto.Blockchain{Client: client, Config: &config.ChainConfig{}}}
+	}
+
+	require.NoError(t, validateChains(ctx, nil))
+	require.NoError(t, validateChains(ctx, map[uint64]*EntitlementChain{
+		1:  newChain(&fakeChainIdClient{chainId: 1}),
+		10: newChain(&fakeChainIdClient{chainId: 10}),
+	}))
+
+	for name, chains := range map[string]map[uint64]*EntitlementChain{
+		"missing chain":  {1: nil},
+		"missing client": {1: newChain(nil)},
+		"unreachable":    {1: newChain(&fakeChainIdClient{err: errors.New("connection refused")})},
+		"wrong chain":    {1: newChain(&fakeChainIdClient{chainId: 10})},
+	} {
+		t.Run(name, func(t *testing.T) {
+			require.Equal(t, Err_BAD_CONFIG, AsRiverError(validateChains(ctx, chains)).Code)
+		})
+	}
+}
+
+func TestNewChainAuthWithChains(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	newChainAuth := func(chains map[uint64]*EntitlementChain) (*chainAuth, error) {
+		return NewChainAuth(
+			ctx,
+			&crypto.Blockchain{
+				ChainId: big.NewInt(8453),
+				Client:  &fakeChainIdClient{chainId: 8453},
+				Config:  &config.ChainConfig{},
+			},
+			chains,
+			&entitlement.Evaluator{},
+			&config.ContractConfig{},
+			0,
+			0,
+			0,
+			0,
+			nil,
+			infra.NewMetricsFactory(prometheus.NewRegistry(), "", ""),
+		)
+	}
+
+	optimism := &crypto.Blockchain{Client: &fakeChainIdClient{chainId: 10}, Config: &config.ChainConfig{}}
+	arbitrum := &crypto.Blockchain{Client: &fakeChainIdClient{chainId: 42161}, Config: &config.ChainConfig{}}
+	arbitrumEvaluator := &entitlement.Evaluator{}
+	ca, err := newChainAuth(map[uint64]*EntitlementChain{
+		10:    {Blockchain: optimism},
+		42161: {Blockchain: arbitrum, Evaluator: arbitrumEvaluator},
+	})
+	require.NoError(t, err)
+	defer ca.Close()
+
+	// Each chain reads its space contract and evaluates its rules through its own client and evaluator, the
+	// default chain is named by its id or 0.
+	for chainId, want := range map[uint64]struct {
+		blockchain *crypto.Blockchain
+		evaluator  *entitlement.Evaluator
+	}{
+		0:     {ca.blockchain, ca.evaluator},
+		8453:  {ca.blockchain, ca.evaluator},
+		10:    {optimism, ca.evaluator},
+		42161: {arbitrum, arbitrumEvaluator},
+	} {
+		blockchain, err := ca.blockchainFor(chainId)
+		require.NoError(t, err)
+		require.Same(t, want.blockchain, blockchain, chainId)
+		evaluator, err := ca.evaluatorFor(chainId)
+		require.NoError(t, err)
+		require.Same(t, want.evaluator, evaluator, chainId)
+		spaceContract, err := ca.spaceContractFor(chainId)
+		require.NoError(t, err)
+		require.Equal(t, want.blockchain.Client, spaceContract.(*SpaceContractV3).backend, chainId)
+	}
+
+	_, err = ca.spaceContractFor(1)
+	require.Equal(t, Err_INVALID_ARGUMENT, AsRiverError(err).Code)
+
+	// Chains whose client serves another chain are refused at construction.
+	_, err = newChainAuth(map[uint64]*EntitlementChain{1: {Blockchain: optimism}})
+	require.Equal(t, Err_BAD_CONFIG, AsRiverError(err).Code)
+}
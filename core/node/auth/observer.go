@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/towns-protocol/towns/core/node/shared"
+)
+
+// EntitlementObserver observes the internal decisions of chainAuth, e.g. for tests to check which wallets were
+// evaluated and which decisions were served from the caches without mocking its internals. The methods are
+// called synchronously, possibly concurrently, on the path of the checks and must return quickly. The wallets,
+// statuses, args and results they are given are shared with chainAuth and must not be modified or retained.
+//
+// Embed NopEntitlementObserver to observe only some of the decisions.
+type EntitlementObserver interface {
+	// OnLinkedWalletsFetched is called with the linked wallets of the principal, including the principal, each
+	// time they are looked up.
+	OnLinkedWalletsFetched(ctx context.Context, principal common.Address, wallets []common.Address, cacheHit bool)
+	// OnMembershipChecked is called with the membership status of each wallet checked for membership in a space.
+	OnMembershipChecked(
+		ctx context.Context,
+		spaceId shared.StreamId,
+		wallet common.Address,
+		status *MembershipStatus,
+		cacheHit bool,
+	)
+	// OnEntitlementEvaluated is called with the result of each IsEntitled check that didn't fail, after the
+	// policy hooks ran.
+	OnEntitlementEvaluated(ctx context.Context, args *ChainAuthArgs, result IsEntitledResult, cacheHit bool)
+}
+
+// NopEntitlementObserver is an EntitlementObserver that ignores all decisions.
+type NopEntitlementObserver struct{}
+
+var _ EntitlementObserver = NopEntitlementObserver{}
+
+func (NopEntitlementObserver) OnLinkedWalletsFetched(context.Context, common.Address, []common.Address, bool) {
+}
+
+func (NopEntitlementObserver) OnMembershipChecked(
+	context.Context,
+	shared.StreamId,
+	common.Address,
+	*MembershipStatus,
+	bool,
+) {
+}
+
+func (NopEntitlementObserver) OnEntitlementEvaluated(context.Context, *ChainAuthArgs, IsEntitledResult, bool) {
+}
+
+// entitlementObserver holds the observer of chainAuth, if any. Without an observer the decisions cost a single
+// atomic load.
+type entitlementObserver struct {
+	observer atomic.Pointer[EntitlementObserver]
+}
+
+func (o *entitlementObserver) get() EntitlementObserver {
+	if obs := o.observer.Load(); obs != nil {
+		return *obs
+	}
+	return nil
+}
+
+func (o *entitlementObserver) linkedWalletsFetched(
+	ctx context.Context,
+	principal common.Address,
+	wallets []common.Address,
+	cacheHit bool,
+) {
+	if obs := o.get(); obs != nil {
+		obs.OnLinkedWalletsFetched(ctx, principal, wallets, cacheHit)
+	}
+}
+
+func (o *entitlementObserver) membershipChecked(
+	ctx context.Context,
+	spaceId shared.StreamId,
+	wallet common.Address,
+	status *MembershipStatus,
+	cacheHit bool,
+) {
+	if obs := o.get(); obs != nil {
+		obs.OnMembershipChecked(ctx, spaceId, wallet, status, cacheHit)
+	}
+}
+
+func (o *entitlementObserver) entitlementEvaluated(
+	ctx context.Context,
+	args *ChainAuthArgs,
+	result IsEntitledResult,
+	cacheHit bool,
+) {
+	if obs := o.get(); obs != nil {
+		obs.OnEntitlementEvaluated(ctx, args, result, cacheHit)
+	}
+}
+
+// SetObserver sets the observer of the internal decisions of chainAuth, replacing the previous one. A nil
+// observer removes it. It is safe to call concurrently with the checks, which see either observer.
+func (ca *chainAuth) SetObserver(obs EntitlementObserver) {
+	if obs == nil {
+		ca.observer.observer.Store(nil)
+		return
+	}
+	ca.observer.observer.Store(&obs)
+}
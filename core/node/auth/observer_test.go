@@ -0,0 +1,120 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+
+	"github.com/towns-protocol/towns/core/config"
+	"github.com/towns-protocol/towns/core/contracts/base"
+	"github.com/towns-protocol/towns/core/node/base/test"
+	"github.com/towns-protocol/towns/core/node/shared"
+	"github.com/towns-protocol/towns/core/node/testutils"
+)
+
+// recordingObserver records the decisions it observes.
+type recordingObserver struct {
+	mu            sync.Mutex
+	linkedWallets [][]common.Address
+	memberships   map[common.Address][]bool
+	evaluations   []bool
+}
+
+func (o *recordingObserver) OnLinkedWalletsFetched(
+	_ context.Context,
+	_ common.Address,
+	wallets []common.Address,
+	_ bool,
+) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.linkedWallets = append(o.linkedWallets, append([]common.Address(nil), wallets...))
+}
+
+func (o *recordingObserver) OnMembershipChecked(
+	_ context.Context,
+	_ shared.StreamId,
+	wallet common.Address,
+	status *MembershipStatus,
+	cacheHit bool,
+) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.memberships[wallet] = append(o.memberships[wallet], cacheHit)
+}
+
+func (o *recordingObserver) OnEntitlementEvaluated(
+	_ context.Context,
+	_ *ChainAuthArgs,
+	_ IsEntitledResult,
+	cacheHit bool,
+) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.evaluations = append(o.evaluations, cacheHit)
+}
+
+// evaluationCounter observes only the entitlement checks.
+type evaluationCounter struct {
+	NopEntitlementObserver
+
+	count int
+}
+
+func (c *evaluationCounter) OnEntitlementEvaluated(context.Context, *ChainAuthArgs, IsEntitledResult, bool) {
+	c.count++
+}
+
+func TestEntitlementObserver(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	principal := common.HexToAddress("0x9a")
+	linked := common.HexToAddress("0x11")
+	spaceContract := newFakeSpaceContract(common.HexToAddress("0x0e"), linked)
+	ca := newTestChainAuth(t, ctx, spaceContract)
+	walletLink, err := base.NewWalletLink(common.HexToAddress("0xabc"), &fakeWalletLinkBackend{t: t})
+	require.NoError(t, err)
+	evaluator := &fakeLinkedWalletsEvaluator{
+		wallets: map[common.Address][]common.Address{principal: {principal, linked}},
+	}
+	ca.walletResolver = &WalletResolver{evaluator: evaluator, walletLink: walletLink}
+	obs := &recordingObserver{memberships: map[common.Address][]bool{}}
+	ca.SetObserver(obs)
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+	args := NewChainAuthArgsForSpace(spaceId, principal.Hex(), PermissionWrite)
+
+	result, err := ca.IsEntitled(ctx, cfg, args)
+	require.NoError(t, err)
+	require.True(t, result.IsEntitled())
+	result, err = ca.IsEntitled(ctx, cfg, args)
+	require.NoError(t, err)
+	require.True(t, result.IsEntitled())
+
+	// The wallets are fetched and checked once, the second check is served from the cache.
+	require.Equal(t, [][]common.Address{{principal, linked}}, obs.linkedWallets)
+	require.Equal(t, []bool{false}, obs.memberships[linked])
+	require.Equal(t, []bool{false, true}, obs.evaluations)
+
+	// The membership status served by GetMembershipStatus is observed as a cache hit.
+	_, err = ca.GetMembershipStatus(ctx, cfg, spaceId, linked)
+	require.NoError(t, err)
+	require.Equal(t, []bool{false, true}, obs.memberships[linked])
+
+	// Observers may observe only some decisions, and can be removed.
+	counter := &evaluationCounter{}
+	ca.SetObserver(counter)
+	_, err = ca.IsEntitled(ctx, cfg, args)
+	require.NoError(t, err)
+	require.Equal(t, 1, counter.count)
+
+	ca.SetObserver(nil)
+	_, err = ca.IsEntitled(ctx, cfg, args)
+	require.NoError(t, err)
+	require.Equal(t, 1, counter.count)
+	require.Len(t, obs.evaluations, 2)
+}
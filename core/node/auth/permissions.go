@@ -1,5 +1,10 @@
 package auth
 
+import (
+	"strconv"
+	"strings"
+)
+
 type Permission int
 
 const (
@@ -14,6 +19,8 @@ const (
 	PermissionAddRemoveChannels
 	PermissionModifySpaceSettings
 	PermissionReact
+	// PermissionModifyChannel is held by the moderators of a channel, see NewChainAuthArgsForIsChannelModerator.
+	PermissionModifyChannel
 )
 
 func (p Permission) String() string {
@@ -40,8 +47,69 @@ func (p Permission) String() string {
 		return "ModifySpaceSettings"
 	case PermissionReact:
 		return "React"
+	case PermissionModifyChannel:
+		return "ModifyChannel"
 
 	default:
 		return "Unknown"
 	}
 }
+
+// ParsePermission returns the built-in permission named name, as returned by Permission.String, ignoring case.
+func ParsePermission(name string) (Permission, bool) {
+	for p := PermissionRead; p <= PermissionModifyChannel; p++ {
+		if strings.EqualFold(p.String(), name) {
+			return p, true
+		}
+	}
+	return PermissionUndefined, false
+}
+
+// PermissionMode tells how the permissions of a check created with ChainAuthArgs.WithPermissions combine.
+type PermissionMode int
+
+const (
+	// RequireAll allows the check if the principal holds all the permissions.
+	RequireAll PermissionMode = iota
+	// RequireAny allows the check if the principal holds at least one of the permissions.
+	RequireAny
+)
+
+func (m PermissionMode) String() string {
+	switch m {
+	case RequireAll:
+		return "RequireAll"
+	case RequireAny:
+		return "RequireAny"
+	default:
+		return "Unknown"
+	}
+}
+
+// serializePermissions serializes permissions to comply with the cache key constraints.
+func serializePermissions(permissions []Permission) string {
+	var b strings.Builder
+	for i, p := range permissions {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(strconv.Itoa(int(p)))
+	}
+	return b.String()
+}
+
+func deserializePermissions(serialized string) []Permission {
+	if serialized == "" {
+		return nil
+	}
+	fields := strings.Split(serialized, ",")
+	permissions := make([]Permission, 0, len(fields))
+	for _, field := range fields {
+		p, err := strconv.Atoi(field)
+		if err != nil {
+			continue
+		}
+		permissions = append(permissions, Permission(p))
+	}
+	return permissions
+}
@@ -0,0 +1,410 @@
+package auth
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"golang.org/x/sync/semaphore"
+
+	"github.com/towns-protocol/towns/core/config"
+	. "github.com/towns-protocol/towns/core/node/base"
+	"github.com/towns-protocol/towns/core/node/shared"
+)
+
+const DEFAULT_PRINCIPALS_CHECK_CONCURRENCY = 10
+
+// PrincipalsCheckOpts are the options of ChainAuth.CheckEntitlementsForPrincipals.
+type PrincipalsCheckOpts struct {
+	// Concurrency caps the principals checked at once. If unset or <= 0, 10 is used.
+	Concurrency int
+	// PrincipalTimeout bounds the check of each principal, so that a principal with many linked wallets or
+	// slow chain calls doesn't stall the batch. Principals whose check times out fail without failing the
+	// others. If unset or <= 0, the checks are only bounded by the context of the batch.
+	PrincipalTimeout time.Duration
+}
+
+func (o PrincipalsCheckOpts) getConcurrency() int {
+	if o.Concurrency <= 0 {
+		return DEFAULT_PRINCIPALS_CHECK_CONCURRENCY
+	}
+	return o.Concurrency
+}
+
+// PermissionErrors holds the errors of the permissions IsEntitledToPermissions failed to check.
+type PermissionErrors map[Permission]error
+
+func (e PermissionErrors) Error() string {
+	return formatBatchErrors(e, cmp.Compare[Permission], Permission.String)
+}
+
+func (e PermissionErrors) Unwrap() []error {
+	return unwrapBatchErrors(e)
+}
+
+// ChannelErrors holds the errors of the channels IsEntitledToChannels failed to check.
+type ChannelErrors map[shared.StreamId]error
+
+func (e ChannelErrors) Error() string {
+	return formatBatchErrors(e, shared.StreamId.Compare, shared.StreamId.String)
+}
+
+func (e ChannelErrors) Unwrap() []error {
+	return unwrapBatchErrors(e)
+}
+
+// PrincipalErrors holds the errors of the principals CheckEntitlementsForPrincipals failed to check.
+type PrincipalErrors map[common.Address]error
+
+func (e PrincipalErrors) Error() string {
+	return formatBatchErrors(e, common.Address.Cmp, common.Address.Hex)
+}
+
+func (e PrincipalErrors) Unwrap() []error {
+	return unwrapBatchErrors(e)
+}
+
+// formatBatchErrors formats the errors of a batch sorted by key.
+func formatBatchErrors[K comparable](errs map[K]error, compare func(K, K) int, name func(K) string) string {
+	keys := make([]K, 0, len(errs))
+	for key := range errs {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, compare)
+
+	var sb strings.Builder
+	for i, key := range keys {
+		if i > 0 {
+			sb.WriteString("; ")
+		}
+		sb.WriteString(name(key))
+		sb.WriteString(": ")
+		sb.WriteString(errs[key].Error())
+	}
+	return sb.String()
+}
+
+func unwrapBatchErrors[K comparable](errs map[K]error) []error {
+	ret := make([]error, 0, len(errs))
+	for _, err := range errs {
+		ret = append(ret, err)
+	}
+	return ret
+}
+
+type permissionsBatchCtxKey struct{}
+
+// permissionsBatch holds the data shared by the checks of IsEntitledToPermissions and IsEntitledToChannels. The
+// linked wallets, membership and ban status of the principal don't depend on the permission or the channel, so
+// checks that miss the cache resolve them once for the whole batch. Checks served from the cache don't resolve
+// them at all.
+type permissionsBatch struct {
+	// freshWallets is set if a check of the batch requires fresh linked wallets, see getLinkedWallets.
+	freshWallets bool
+
+	walletsOnce sync.Once
+	wallets     *linkedWalletCacheValue
+	walletsErr  error
+
+	membershipOnce sync.Once
+	// membershipDenial is nil if the principal is a member of the space whose membership didn't expire, the
+	// membership expires at membershipValidUntil then.
+	membershipDenial     CacheResult
+	membershipValidUntil time.Time
+	membershipErr        error
+
+	bannedOnce sync.Once
+	banned     bool
+	bannedErr  error
+}
+
+func permissionsBatchFromCtx(ctx context.Context) *permissionsBatch {
+	batch, _ := ctx.Value(permissionsBatchCtxKey{}).(*permissionsBatch)
+	return batch
+}
+
+// withoutPermissionsBatch returns a context in which the data of the batches of ctx is resolved again, for work
+// that outlives the batches.
+func withoutPermissionsBatch(ctx context.Context) context.Context {
+	if permissionsBatchFromCtx(ctx) != nil {
+		ctx = context.WithValue(ctx, permissionsBatchCtxKey{}, (*permissionsBatch)(nil))
+	}
+	if ctx.Value(principalsBatchCtxKey{}) != nil {
+		ctx = context.WithValue(ctx, principalsBatchCtxKey{}, (*principalsBatch)(nil))
+	}
+	return ctx
+}
+
+type principalsBatchCtxKey struct{}
+
+// principalsBatch holds the data shared by the checks of CheckEntitlementsForPrincipals. The entitlements of
+// the space and the wallets banned from it don't depend on the principal, so they are read once for the whole
+// batch, even if the caches expire while the principals are checked.
+type principalsBatch struct {
+	spaceId       shared.StreamId
+	chainId       uint64
+	permission    Permission
+	entitlements  *entitlementCacheResult
+	bannedWallets *bannedWalletsCacheResult
+}
+
+// principalsBatchFromCtx returns the principals batch of ctx if it has one for the space.
+func principalsBatchFromCtx(ctx context.Context, spaceId shared.StreamId, chainId uint64) *principalsBatch {
+	batch, _ := ctx.Value(principalsBatchCtxKey{}).(*principalsBatch)
+	if batch == nil || batch.spaceId != spaceId || batch.chainId != chainId {
+		return nil
+	}
+	return batch
+}
+
+// IsEntitledToPermissions checks the permissions of the user in the space, or in the channel if channelId is
+// set, see ChainAuth.
+func (ca *chainAuth) IsEntitledToPermissions(
+	ctx context.Context,
+	cfg *config.Config,
+	spaceId shared.StreamId,
+	channelId shared.StreamId,
+	userId string,
+	permissions []Permission,
+) (map[Permission]IsEntitledResult, error) {
+	checks := make(map[Permission]*ChainAuthArgs, len(permissions))
+	for _, permission := range permissions {
+		if channelId != (shared.StreamId{}) {
+			checks[permission] = NewChainAuthArgsForChannel(spaceId, channelId, userId, permission)
+		} else {
+			checks[permission] = NewChainAuthArgsForSpace(spaceId, userId, permission)
+		}
+	}
+
+	batch := &permissionsBatch{freshWallets: slices.Contains(permissions, PermissionRead)}
+	results, errs := isEntitledBatch(ctx, ca, cfg, batch, checks)
+	if errs != nil {
+		return results, PermissionErrors(errs)
+	}
+	return results, nil
+}
+
+// IsEntitledToChannels checks the permission of the user in each of the channels of the space, see ChainAuth.
+func (ca *chainAuth) IsEntitledToChannels(
+	ctx context.Context,
+	cfg *config.Config,
+	spaceId shared.StreamId,
+	channelIds []shared.StreamId,
+	userId string,
+	permission Permission,
+) (map[shared.StreamId]IsEntitledResult, error) {
+	checks := make(map[shared.StreamId]*ChainAuthArgs, len(channelIds))
+	for _, channelId := range channelIds {
+		checks[channelId] = NewChainAuthArgsForChannel(spaceId, channelId, userId, permission)
+	}
+
+	batch := &permissionsBatch{freshWallets: permission == PermissionRead}
+	results, errs := isEntitledBatch(ctx, ca, cfg, batch, checks)
+	if errs != nil {
+		return results, ChannelErrors(errs)
+	}
+	return results, nil
+}
+
+// CheckEntitlementsForPrincipals checks the permission of each of the principals in the space, see ChainAuth.
+func (ca *chainAuth) CheckEntitlementsForPrincipals(
+	ctx context.Context,
+	cfg *config.Config,
+	spaceId shared.StreamId,
+	principals []common.Address,
+	permission Permission,
+	opts PrincipalsCheckOpts,
+) (map[common.Address]IsEntitledResult, error) {
+	args := NewChainAuthArgsForSpace(spaceId, "", permission)
+	entitlements, err := ca.getSpaceEntitlements(ctx, cfg, args)
+	if err != nil {
+		return nil, AsRiverError(err).Func("CheckEntitlementsForPrincipals")
+	}
+	bannedWallets, err := ca.getBannedWallets(ctx, spaceId, args.chainId)
+	if err != nil {
+		return nil, AsRiverError(err).Func("CheckEntitlementsForPrincipals")
+	}
+	batchCtx := context.WithValue(ctx, principalsBatchCtxKey{}, &principalsBatch{
+		spaceId:       spaceId,
+		chainId:       args.chainId,
+		permission:    permission,
+		entitlements:  entitlements,
+		bannedWallets: bannedWallets,
+	})
+
+	type check struct {
+		result IsEntitledResult
+		err    error
+	}
+	done := make(map[common.Address]*check, len(principals))
+	checks := semaphore.NewWeighted(int64(opts.getConcurrency()))
+	var wg sync.WaitGroup
+	for _, principal := range principals {
+		if _, ok := done[principal]; ok {
+			continue
+		}
+		c := &check{}
+		done[principal] = c
+		if err := checks.Acquire(ctx, 1); err != nil {
+			c.err = AsRiverError(err).Func("CheckEntitlementsForPrincipals")
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer checks.Release(1)
+			c.result, c.err = ca.checkPrincipal(batchCtx, cfg, spaceId, principal, permission, opts.PrincipalTimeout)
+		}()
+	}
+	wg.Wait()
+
+	results := make(map[common.Address]IsEntitledResult, len(done))
+	var errs PrincipalErrors
+	for principal, c := range done {
+		if c.err != nil {
+			if errs == nil {
+				errs = make(PrincipalErrors)
+			}
+			errs[principal] = c.err
+			continue
+		}
+		results[principal] = c.result
+	}
+	if errs != nil {
+		return results, errs
+	}
+	return results, nil
+}
+
+// checkPrincipal checks the permission of a principal of a CheckEntitlementsForPrincipals batch within timeout,
+// if set. The linked wallets of the principal are resolved once for the check and served from the cache.
+func (ca *chainAuth) checkPrincipal(
+	ctx context.Context,
+	cfg *config.Config,
+	spaceId shared.StreamId,
+	principal common.Address,
+	permission Permission,
+	timeout time.Duration,
+) (IsEntitledResult, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	ctx = context.WithValue(ctx, permissionsBatchCtxKey{}, &permissionsBatch{})
+	return ca.IsEntitled(ctx, cfg, NewChainAuthArgsForSpace(spaceId, principal.Hex(), permission))
+}
+
+// isEntitledBatch runs the checks of a batch concurrently. It returns the results of the checks that succeeded
+// and the errors of the others, nil if all checks succeeded.
+func isEntitledBatch[K comparable](
+	ctx context.Context,
+	ca *chainAuth,
+	cfg *config.Config,
+	batch *permissionsBatch,
+	checks map[K]*ChainAuthArgs,
+) (map[K]IsEntitledResult, map[K]error) {
+	batchCtx := context.WithValue(ctx, permissionsBatchCtxKey{}, batch)
+
+	type check struct {
+		result IsEntitledResult
+		err    error
+	}
+	done := make(map[K]*check, len(checks))
+	var wg sync.WaitGroup
+	for key, args := range checks {
+		c := &check{}
+		done[key] = c
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.result, c.err = ca.IsEntitled(batchCtx, cfg, args)
+		}()
+	}
+	wg.Wait()
+
+	results := make(map[K]IsEntitledResult, len(done))
+	var errs map[K]error
+	for key, c := range done {
+		if c.err != nil {
+			if errs == nil {
+				errs = make(map[K]error)
+			}
+			errs[key] = c.err
+			continue
+		}
+		results[key] = c.result
+	}
+	return results, errs
+}
+
+// batchLinkedWallets returns the linked wallets of the principal of the batch of ctx, resolving them on the
+// first call. ok is false if ctx has no batch.
+func (ca *chainAuth) batchLinkedWallets(
+	ctx context.Context,
+	cfg *config.Config,
+	principal common.Address,
+) (wallets []common.Address, ok bool, err error) {
+	batch := permissionsBatchFromCtx(ctx)
+	if batch == nil {
+		return nil, false, nil
+	}
+	batch.walletsOnce.Do(func() {
+		batch.wallets, batch.walletsErr = ca.linkedWalletsOf(ctx, cfg, principal, batch.freshWallets)
+	})
+	if batch.walletsErr != nil {
+		return nil, true, batch.walletsErr
+	}
+	recordBaseChainOnlyWallets(ctx, batch.wallets.baseChainOnlyUntil)
+	return batch.wallets.wallets, true, nil
+}
+
+// checkWalletsMembershipOnce is checkWalletsMembership, evaluated once per batch if ctx has one.
+func (ca *chainAuth) checkWalletsMembershipOnce(
+	ctx context.Context,
+	cfg *config.Config,
+	args *ChainAuthArgs,
+	wallets []common.Address,
+) (CacheResult, time.Time, error) {
+	batch := permissionsBatchFromCtx(ctx)
+	if batch == nil {
+		return ca.checkWalletsMembership(ctx, cfg, args, wallets)
+	}
+	batch.membershipOnce.Do(func() {
+		batch.membershipDenial, batch.membershipValidUntil, batch.membershipErr = ca.checkWalletsMembership(
+			ctx, cfg, args, wallets)
+	})
+	return batch.membershipDenial, batch.membershipValidUntil, batch.membershipErr
+}
+
+// areWalletsBanned returns true if any of the wallets is banned from the space of args, it is evaluated once
+// per batch if ctx has one.
+func (ca *chainAuth) areWalletsBanned(
+	ctx context.Context,
+	args *ChainAuthArgs,
+	wallets []common.Address,
+) (bool, error) {
+	isBanned := func() (bool, error) {
+		if batch := principalsBatchFromCtx(ctx, args.spaceId, args.chainId); batch != nil {
+			return batch.bannedWallets.isBanned(wallets), nil
+		}
+		bannedWallets, err := ca.getBannedWallets(ctx, args.spaceId, args.chainId)
+		if err != nil {
+			return false, err
+		}
+		return bannedWallets.isBanned(wallets), nil
+	}
+
+	batch := permissionsBatchFromCtx(ctx)
+	if batch == nil {
+		return isBanned()
+	}
+	batch.bannedOnce.Do(func() {
+		batch.banned, batch.bannedErr = isBanned()
+	})
+	return batch.banned, batch.bannedErr
+}
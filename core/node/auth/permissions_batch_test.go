@@ -0,0 +1,322 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+
+	"github.com/towns-protocol/towns/core/config"
+	"github.com/towns-protocol/towns/core/contracts/base"
+	"github.com/towns-protocol/towns/core/contracts/types"
+	. "github.com/towns-protocol/towns/core/node/base"
+	"github.com/towns-protocol/towns/core/node/base/test"
+	. "github.com/towns-protocol/towns/core/node/protocol"
+	"github.com/towns-protocol/towns/core/node/shared"
+	"github.com/towns-protocol/towns/core/node/testutils"
+)
+
+// failingPermissionSpaceContract fails to read the space entitlements of a single permission.
+type failingPermissionSpaceContract struct {
+	*fakeSpaceContract
+	failing Permission
+}
+
+func (sc *failingPermissionSpaceContract) GetSpaceEntitlementsForPermission(
+	ctx context.Context,
+	spaceId shared.StreamId,
+	permission Permission,
+) ([]types.Entitlement, common.Address, error) {
+	if permission == sc.failing {
+		return nil, common.Address{}, errors.New("entitlements unavailable")
+	}
+	return sc.fakeSpaceContract.GetSpaceEntitlementsForPermission(ctx, spaceId, permission)
+}
+
+func TestIsEntitledToPermissions(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	bob := common.HexToAddress("0xb0b")
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+	walletLink, err := base.NewWalletLink(common.HexToAddress("0xabc"), &fakeWalletLinkBackend{t: t})
+	require.NoError(t, err)
+	permissions := []Permission{PermissionRead, PermissionWrite, PermissionReact, PermissionRedact}
+
+	newCa := func(sc SpaceContract) (*chainAuth, *blockingLinkedWalletsEvaluator) {
+		ca := newTestChainAuth(t, ctx, sc)
+		release := make(chan struct{})
+		close(release)
+		evaluator := &blockingLinkedWalletsEvaluator{started: make(chan struct{}), release: release}
+		ca.walletResolver = &WalletResolver{evaluator: evaluator, walletLink: walletLink}
+		return ca, evaluator
+	}
+
+	// The linked wallets, membership and ban status are resolved once for the whole batch.
+	spaceContract := newFakeSpaceContract(common.HexToAddress("0x0e"), bob)
+	ca, evaluator := newCa(spaceContract)
+	results, err := ca.IsEntitledToPermissions(ctx, cfg, spaceId, shared.StreamId{}, bob.Hex(), permissions)
+	require.NoError(t, err)
+	require.Len(t, results, len(permissions))
+	for _, permission := range permissions {
+		require.True(t, results[permission].IsEntitled(), permission)
+		require.Equal(t, WalletSetDigest([]common.Address{bob}), DetailsOf(results[permission]).WalletSetDigest)
+	}
+	require.EqualValues(t, 1, evaluator.calls.Load())
+	require.Equal(t, 1, spaceContract.callCount("GetMembershipStatus"))
+	require.Equal(t, 1, spaceContract.callCount("GetBannedWallets"))
+
+	// The results are cached under the keys of IsEntitled, and batches are served from the cache.
+	for _, permission := range permissions {
+		result, err := ca.IsEntitled(ctx, cfg, NewChainAuthArgsForSpace(spaceId, bob.Hex(), permission))
+		require.NoError(t, err)
+		require.True(t, result.IsEntitled())
+		require.True(t, DetailsOf(result).FromCache)
+	}
+	results, err = ca.IsEntitledToPermissions(ctx, cfg, spaceId, shared.StreamId{}, bob.Hex(), permissions)
+	require.NoError(t, err)
+	require.True(t, DetailsOf(results[PermissionWrite]).FromCache)
+	require.EqualValues(t, 1, evaluator.calls.Load())
+	require.Equal(t, 1, spaceContract.callCount("GetBannedWallets"))
+
+	// Failures are reported per permission, the other permissions are still checked.
+	failing := &failingPermissionSpaceContract{
+		fakeSpaceContract: newFakeSpaceContract(common.HexToAddress("0x0e"), bob),
+		failing:           PermissionReact,
+	}
+	ca, _ = newCa(failing)
+	results, err = ca.IsEntitledToPermissions(ctx, cfg, spaceId, shared.StreamId{}, bob.Hex(), permissions)
+	var permissionErrors PermissionErrors
+	require.ErrorAs(t, err, &permissionErrors)
+	require.Len(t, permissionErrors, 1)
+	require.Contains(t, permissionErrors, PermissionReact)
+	require.Len(t, results, len(permissions)-1)
+	require.NotContains(t, results, PermissionReact)
+	require.True(t, results[PermissionWrite].IsEntitled())
+
+	// Batches of users that are not members are denied without evaluating the entitlements.
+	alice := common.HexToAddress("0xa11ce")
+	spaceContract = newFakeSpaceContract(common.HexToAddress("0x0e"), bob)
+	ca, _ = newCa(spaceContract)
+	results, err = ca.IsEntitledToPermissions(ctx, cfg, spaceId, shared.StreamId{}, alice.Hex(), permissions)
+	require.NoError(t, err)
+	for _, permission := range permissions {
+		require.False(t, results[permission].IsEntitled())
+		require.Equal(t, EntitlementResultReason_MEMBERSHIP, results[permission].Reason())
+	}
+	require.Equal(t, 1, spaceContract.callCount("GetMembershipStatus"))
+	require.Zero(t, spaceContract.callCount("GetBannedWallets"))
+}
+
+// channelsSpaceContract serves distinct entitlements per channel, channels without entitlements fail.
+type channelsSpaceContract struct {
+	*fakeSpaceContract
+	channelEntitlements map[shared.StreamId][]types.Entitlement
+	disabled            map[shared.StreamId]bool
+}
+
+func (sc *channelsSpaceContract) IsChannelDisabled(
+	ctx context.Context,
+	spaceId shared.StreamId,
+	channelId shared.StreamId,
+) (bool, error) {
+	sc.called("IsChannelDisabled")
+	return sc.disabled[channelId], nil
+}
+
+func (sc *channelsSpaceContract) GetChannelEntitlementsForPermission(
+	ctx context.Context,
+	spaceId shared.StreamId,
+	channelId shared.StreamId,
+	permission Permission,
+) ([]types.Entitlement, common.Address, error) {
+	sc.called("GetChannelEntitlementsForPermission")
+	entitlements, ok := sc.channelEntitlements[channelId]
+	if !ok {
+		return nil, common.Address{}, RiverError(Err_CANNOT_CALL_CONTRACT, "channel entitlements unavailable")
+	}
+	return entitlements, sc.owner, nil
+}
+
+func TestIsEntitledToChannels(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	alice := common.HexToAddress("0xa11ce")
+	bob := common.HexToAddress("0xb0b")
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+	open := testutils.MakeChannelId(spaceId)
+	restricted := testutils.MakeChannelId(spaceId)
+	disabled := testutils.MakeChannelId(spaceId)
+	failing := testutils.MakeChannelId(spaceId)
+	userEntitlement := func(users ...common.Address) []types.Entitlement {
+		return []types.Entitlement{{EntitlementType: types.ModuleTypeUserEntitlement, UserEntitlement: users}}
+	}
+	spaceContract := &channelsSpaceContract{
+		fakeSpaceContract: newFakeSpaceContract(common.HexToAddress("0x0e"), alice, bob),
+		channelEntitlements: map[shared.StreamId][]types.Entitlement{
+			open:       userEntitlement(alice, bob),
+			restricted: userEntitlement(alice),
+			disabled:   userEntitlement(alice, bob),
+		},
+		disabled: map[shared.StreamId]bool{disabled: true},
+	}
+	walletLink, err := base.NewWalletLink(common.HexToAddress("0xabc"), &fakeWalletLinkBackend{t: t})
+	require.NoError(t, err)
+	ca := newTestChainAuth(t, ctx, spaceContract)
+	release := make(chan struct{})
+	close(release)
+	evaluator := &blockingLinkedWalletsEvaluator{started: make(chan struct{}), release: release}
+	ca.walletResolver = &WalletResolver{evaluator: evaluator, walletLink: walletLink}
+
+	channelIds := []shared.StreamId{open, restricted, disabled, failing}
+	results, err := ca.IsEntitledToChannels(ctx, cfg, spaceId, channelIds, bob.Hex(), PermissionRead)
+	var channelErrors ChannelErrors
+	require.ErrorAs(t, err, &channelErrors)
+	require.Len(t, channelErrors, 1)
+	require.Equal(t, Err_CANNOT_CALL_CONTRACT, AsRiverError(channelErrors[failing]).Code)
+	require.Len(t, results, 3)
+	require.True(t, results[open].IsEntitled())
+	require.False(t, results[restricted].IsEntitled())
+	require.Equal(t, EntitlementResultReason_CHANNEL_ENTITLEMENTS, results[restricted].Reason())
+	require.False(t, results[disabled].IsEntitled())
+	require.Equal(t, EntitlementResultReason_CHANNEL_DISABLED, results[disabled].Reason())
+
+	// The linked wallets, membership and ban status are resolved once for all channels.
+	require.EqualValues(t, 1, evaluator.calls.Load())
+	require.Equal(t, 1, spaceContract.callCount("GetMembershipStatus"))
+	require.Equal(t, 1, spaceContract.callCount("GetBannedWallets"))
+
+	// The results are cached under the keys of IsEntitled.
+	for _, channelId := range []shared.StreamId{open, restricted, disabled} {
+		result, err := ca.IsEntitled(ctx, cfg, NewChainAuthArgsForChannel(spaceId, channelId, bob.Hex(), PermissionRead))
+		require.NoError(t, err)
+		require.True(t, DetailsOf(result).FromCache)
+		require.Equal(t, results[channelId].IsEntitled(), result.IsEntitled())
+	}
+}
+
+// slowMemberSpaceContract doesn't answer membership checks of a single wallet until they are cancelled.
+type slowMemberSpaceContract struct {
+	*fakeSpaceContract
+	slow common.Address
+}
+
+func (sc *slowMemberSpaceContract) GetMembershipStatus(
+	ctx context.Context,
+	spaceId shared.StreamId,
+	user common.Address,
+) (*MembershipStatus, error) {
+	if user == sc.slow {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return sc.fakeSpaceContract.GetMembershipStatus(ctx, spaceId, user)
+}
+
+func TestCheckEntitlementsForPrincipals(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+	walletLink, err := base.NewWalletLink(common.HexToAddress("0xabc"), &fakeWalletLinkBackend{t: t})
+	require.NoError(t, err)
+	members := make([]common.Address, 20)
+	for i := range members {
+		members[i] = common.BigToAddress(big.NewInt(int64(0x1000 + i)))
+	}
+
+	newCa := func(sc SpaceContract) (*chainAuth, *blockingLinkedWalletsEvaluator) {
+		ca := newTestChainAuth(t, ctx, sc)
+		release := make(chan struct{})
+		close(release)
+		evaluator := &blockingLinkedWalletsEvaluator{started: make(chan struct{}), release: release}
+		ca.walletResolver = &WalletResolver{evaluator: evaluator, walletLink: walletLink}
+		return ca, evaluator
+	}
+	totalCalls := func(sc *fakeSpaceContract) int {
+		sc.mu.Lock()
+		defer sc.mu.Unlock()
+		total := 0
+		for _, calls := range sc.calls {
+			total += calls
+		}
+		return total
+	}
+	scrub := func(principals []common.Address) (*fakeSpaceContract, map[common.Address]IsEntitledResult) {
+		spaceContract := newFakeSpaceContract(common.HexToAddress("0x0e"), principals...)
+		ca, _ := newCa(spaceContract)
+		defer ca.Close()
+		results, err := ca.CheckEntitlementsForPrincipals(
+			ctx, cfg, spaceId, principals, PermissionRead, PrincipalsCheckOpts{Concurrency: 4})
+		require.NoError(t, err)
+		require.Len(t, results, len(principals))
+		for _, principal := range principals {
+			require.True(t, results[principal].IsEntitled())
+		}
+		return spaceContract, results
+	}
+
+	// The calls for the space are made once for the whole batch, so the calls grow sub-linearly with the
+	// number of principals.
+	single, _ := scrub(members[:1])
+	batch, _ := scrub(members)
+	for _, name := range []string{"IsSpaceDisabled", "GetSpaceEntitlementsForPermission", "GetBannedWallets"} {
+		require.Equal(t, 1, batch.callCount(name), name)
+	}
+	require.Equal(t, len(members), batch.callCount("GetMembershipStatus"))
+	require.Less(t, totalCalls(batch), len(members)*totalCalls(single))
+
+	// Each principal gets its own result and reason, and the linked wallets are not busted for Read checks.
+	carol := common.HexToAddress("0xca201")
+	mallory := common.HexToAddress("0x3a11")
+	spaceContract := newFakeSpaceContract(common.HexToAddress("0x0e"), append(members, carol)...)
+	spaceContract.banned[carol] = true
+	ca, evaluator := newCa(spaceContract)
+	defer ca.Close()
+	principals := append([]common.Address{carol, mallory}, members...)
+	results, err := ca.CheckEntitlementsForPrincipals(ctx, cfg, spaceId, principals, PermissionRead, PrincipalsCheckOpts{})
+	require.NoError(t, err)
+	require.Len(t, results, len(principals))
+	require.False(t, results[carol].IsEntitled())
+	require.Equal(t, EntitlementResultReason_BANNED, results[carol].Reason())
+	require.False(t, results[mallory].IsEntitled())
+	require.Equal(t, EntitlementResultReason_MEMBERSHIP, results[mallory].Reason())
+	require.True(t, results[members[0]].IsEntitled())
+	require.EqualValues(t, len(principals), evaluator.calls.Load())
+
+	ca.entitlementCache.positiveCache.Purge()
+	ca.entitlementCache.negativeCache.Purge()
+	_, err = ca.CheckEntitlementsForPrincipals(ctx, cfg, spaceId, principals, PermissionRead, PrincipalsCheckOpts{})
+	require.NoError(t, err)
+	require.EqualValues(t, len(principals), evaluator.calls.Load())
+
+	// A principal whose check times out fails alone.
+	slow := &slowMemberSpaceContract{
+		fakeSpaceContract: newFakeSpaceContract(common.HexToAddress("0x0e"), members...),
+		slow:              members[0],
+	}
+	ca, _ = newCa(slow)
+	defer ca.Close()
+	results, err = ca.CheckEntitlementsForPrincipals(
+		ctx,
+		cfg,
+		spaceId,
+		members,
+		PermissionRead,
+		PrincipalsCheckOpts{Concurrency: 2, PrincipalTimeout: 100 * time.Millisecond},
+	)
+	var principalErrors PrincipalErrors
+	require.ErrorAs(t, err, &principalErrors)
+	require.Len(t, principalErrors, 1)
+	require.Contains(t, principalErrors, members[0])
+	require.Len(t, results, len(members)-1)
+	require.True(t, results[members[1]].IsEntitled())
+}
@@ -0,0 +1,226 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/towns-protocol/towns/core/config"
+	. "github.com/towns-protocol/towns/core/node/base"
+	"github.com/towns-protocol/towns/core/node/infra"
+	"github.com/towns-protocol/towns/core/node/logging"
+	. "github.com/towns-protocol/towns/core/node/protocol"
+	"github.com/towns-protocol/towns/core/node/shared"
+)
+
+const DEFAULT_POLICY_HOOK_TIMEOUT = 50 * time.Millisecond
+
+// PolicyHook layers operator-specific policy on top of the on-chain entitlements, e.g. legal geo-blocks or
+// emergency mutes. Hooks can only deny checks the chain allows, never grant checks the chain denies.
+type PolicyHook interface {
+	// Name identifies the hook in the reason chain, the audit records and the metrics.
+	Name() string
+	// Evaluate returns the verdict of the hook on a check the chain allows. It must return once ctx is done,
+	// its verdict is ignored past the hook timeout.
+	Evaluate(ctx context.Context, args *ChainAuthArgs, decision IsEntitledResult) (PolicyVerdict, error)
+}
+
+// PolicyVerdict is the verdict of a PolicyHook on a check.
+type PolicyVerdict struct {
+	Deny bool
+	// Reason explains a denial, it is recorded in the reason chain of the result.
+	Reason string
+}
+
+type PolicyOutcome string
+
+const (
+	PolicyOutcomeAllow   PolicyOutcome = "allow"
+	PolicyOutcomeDeny    PolicyOutcome = "deny"
+	PolicyOutcomeTimeout PolicyOutcome = "timeout"
+	PolicyOutcomeError   PolicyOutcome = "error"
+)
+
+// ReasonChainStep is a step of an entitlement decision, see IsEntitledResult.ReasonChain.
+type ReasonChainStep struct {
+	// Source is ReasonChainSourceChain for the on-chain decision, the name of the policy hook otherwise.
+	Source  string        `json:"source"`
+	Outcome PolicyOutcome `json:"outcome"`
+	Reason  string        `json:"reason,omitempty"`
+}
+
+// ReasonChainSourceChain is the source of the on-chain step of reason chains.
+const ReasonChainSourceChain = "chain"
+
+// policyHooks runs the policy hooks registered on chainAuth in registration order. Hooks are run on every
+// check the chain allows, whether it was served from the caches or not, so policy changes apply right away
+// and the cached on-chain decisions are never affected by them. A hook that times out or fails leaves the
+// decision unchanged: a slow hook must not deny all checks of the node.
+type policyHooks struct {
+	timeout time.Duration
+
+	mu    sync.Mutex
+	hooks atomic.Pointer[[]PolicyHook]
+
+	// verdicts counts the verdicts of the hooks by hook and outcome.
+	verdicts *prometheus.CounterVec
+}
+
+func newPolicyHooks(cfg *config.ChainConfig, metrics infra.MetricsFactory) *policyHooks {
+	timeout := DEFAULT_POLICY_HOOK_TIMEOUT
+	if cfg.EntitlementPolicyHookTimeout > 0 {
+		timeout = cfg.EntitlementPolicyHookTimeout
+	}
+	return &policyHooks{
+		timeout: timeout,
+		verdicts: metrics.NewCounterVecEx(
+			"entitlement_policy_hook_verdicts",
+			"Verdicts of the entitlement policy hooks by hook and outcome",
+			"hook",
+			"outcome",
+		),
+	}
+}
+
+func (p *policyHooks) add(hook PolicyHook) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var hooks []PolicyHook
+	if current := p.hooks.Load(); current != nil {
+		hooks = append(hooks, *current...)
+	}
+	hooks = append(hooks, hook)
+	p.hooks.Store(&hooks)
+}
+
+// apply runs the hooks on the on-chain decision of result and records their verdicts in the reason chain of
+// result. The first hook that denies the check stops the chain.
+func (p *policyHooks) apply(ctx context.Context, args *ChainAuthArgs, result *isEntitledResult) error {
+	hooks := p.hooks.Load()
+	if hooks == nil || !result.isAllowed {
+		return nil
+	}
+
+	for _, hook := range *hooks {
+		step, err := p.run(ctx, hook, args, result)
+		if err != nil {
+			return err
+		}
+		p.verdicts.WithLabelValues(step.Source, string(step.Outcome)).Inc()
+		result.reasonChain = append(result.reasonChain, step)
+		if step.Outcome == PolicyOutcomeDeny {
+			result.isAllowed = false
+			result.reason = EntitlementResultReason_POLICY_DENIED
+			return nil
+		}
+	}
+	return nil
+}
+
+// run evaluates a single hook within the hook timeout. It returns an error only if ctx is done.
+func (p *policyHooks) run(
+	ctx context.Context,
+	hook PolicyHook,
+	args *ChainAuthArgs,
+	decision IsEntitledResult,
+) (ReasonChainStep, error) {
+	step := ReasonChainStep{Source: hook.Name(), Outcome: PolicyOutcomeAllow}
+
+	hookCtx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	type evaluation struct {
+		verdict PolicyVerdict
+		err     error
+	}
+	done := make(chan evaluation, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- evaluation{err: fmt.Errorf("policy hook panicked: %v", r)}
+			}
+		}()
+		verdict, err := hook.Evaluate(hookCtx, args, decision)
+		done <- evaluation{verdict, err}
+	}()
+
+	select {
+	case eval := <-done:
+		if eval.err != nil {
+			logging.FromCtx(ctx).Warnw("Entitlement policy hook failed", "hook", step.Source, "args", args,
+				"error", eval.err)
+			step.Outcome = PolicyOutcomeError
+			step.Reason = eval.err.Error()
+		} else if eval.verdict.Deny {
+			step.Outcome = PolicyOutcomeDeny
+			step.Reason = eval.verdict.Reason
+		}
+	case <-hookCtx.Done():
+		if ctx.Err() != nil {
+			return step, AsRiverError(ctx.Err()).Tag("hook", step.Source)
+		}
+		logging.FromCtx(ctx).Warnw("Entitlement policy hook timed out", "hook", step.Source, "args", args,
+			"timeout", p.timeout)
+		step.Outcome = PolicyOutcomeTimeout
+	}
+	return step, nil
+}
+
+// AddPolicyHook registers a policy hook that runs after the hooks registered before it, see PolicyHook.
+func (ca *chainAuth) AddPolicyHook(hook PolicyHook) {
+	ca.policyHooks.add(hook)
+}
+
+// denyListPolicyHook denies the checks of the principals and spaces of a static deny-list.
+type denyListPolicyHook struct {
+	principals map[common.Address]struct{}
+	spaces     map[shared.StreamId]struct{}
+}
+
+var _ PolicyHook = (*denyListPolicyHook)(nil)
+
+// NewDenyListPolicyHook returns a policy hook that denies the checks of the principals and in the spaces of
+// the deny-list.
+func NewDenyListPolicyHook(cfg *config.EntitlementDenyListConfig) (PolicyHook, error) {
+	hook := &denyListPolicyHook{
+		principals: make(map[common.Address]struct{}, len(cfg.Principals)),
+		spaces:     make(map[shared.StreamId]struct{}, len(cfg.Spaces)),
+	}
+	for _, principal := range cfg.Principals {
+		if !common.IsHexAddress(principal) {
+			return nil, RiverError(Err_BAD_CONFIG, "Invalid principal in entitlement deny-list", "principal", principal)
+		}
+		hook.principals[common.HexToAddress(principal)] = struct{}{}
+	}
+	for _, space := range cfg.Spaces {
+		spaceId, err := shared.StreamIdFromString(space)
+		if err != nil || spaceId.Type() != shared.STREAM_SPACE_BIN {
+			return nil, RiverError(Err_BAD_CONFIG, "Invalid space in entitlement deny-list", "space", space)
+		}
+		hook.spaces[spaceId] = struct{}{}
+	}
+	return hook, nil
+}
+
+func (h *denyListPolicyHook) Name() string {
+	return "deny_list"
+}
+
+func (h *denyListPolicyHook) Evaluate(
+	_ context.Context,
+	args *ChainAuthArgs,
+	_ IsEntitledResult,
+) (PolicyVerdict, error) {
+	if _, ok := h.principals[args.principal]; ok {
+		return PolicyVerdict{Deny: true, Reason: "principal is deny-listed"}, nil
+	}
+	if _, ok := h.spaces[args.spaceId]; ok {
+		return PolicyVerdict{Deny: true, Reason: "space is deny-listed"}, nil
+	}
+	return PolicyVerdict{}, nil
+}
@@ -0,0 +1,189 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/towns-protocol/towns/core/config"
+	"github.com/towns-protocol/towns/core/node/base/test"
+	"github.com/towns-protocol/towns/core/node/crypto"
+	"github.com/towns-protocol/towns/core/node/infra"
+	"github.com/towns-protocol/towns/core/node/shared"
+	"github.com/towns-protocol/towns/core/node/testutils"
+)
+
+// fakePolicyHook records its calls in calls and returns verdict, after blocking until ctx is done if block
+// is set.
+type fakePolicyHook struct {
+	name    string
+	verdict PolicyVerdict
+	block   bool
+	calls   *[]string
+	mu      *sync.Mutex
+}
+
+func (h *fakePolicyHook) Name() string {
+	return h.name
+}
+
+func (h *fakePolicyHook) Evaluate(
+	ctx context.Context,
+	_ *ChainAuthArgs,
+	_ IsEntitledResult,
+) (PolicyVerdict, error) {
+	h.mu.Lock()
+	*h.calls = append(*h.calls, h.name)
+	h.mu.Unlock()
+	if h.block {
+		<-ctx.Done()
+		return PolicyVerdict{}, ctx.Err()
+	}
+	return h.verdict, nil
+}
+
+func TestPolicyHooks(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	alice := common.HexToAddress("0xa11ce")
+	bob := common.HexToAddress("0xb0b")
+	ca := newTestChainAuth(t, ctx, newFakeSpaceContract(common.HexToAddress("0x0e"), alice))
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+	aliceArgs := NewChainAuthArgsForSpace(spaceId, alice.Hex(), PermissionWrite)
+
+	var mu sync.Mutex
+	var calls []string
+	newHook := func(name string, verdict PolicyVerdict, block bool) *fakePolicyHook {
+		return &fakePolicyHook{name: name, verdict: verdict, block: block, calls: &calls, mu: &mu}
+	}
+	takeCalls := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		ret := calls
+		calls = nil
+		return ret
+	}
+
+	// Without hooks the reason chain only has the on-chain decision.
+	result, err := ca.IsEntitled(ctx, cfg, aliceArgs)
+	require.NoError(t, err)
+	require.True(t, result.IsEntitled())
+	require.Equal(t, []ReasonChainStep{{Source: ReasonChainSourceChain, Outcome: PolicyOutcomeAllow, Reason: "NONE"}},
+		DetailsOf(result).ReasonChain)
+
+	// Hooks run in registration order, a slow hook is cut off and leaves the decision unchanged.
+	ca.policyHooks.timeout = 20 * time.Millisecond
+	ca.AddPolicyHook(newHook("first", PolicyVerdict{}, false))
+	ca.AddPolicyHook(newHook("slow", PolicyVerdict{}, true))
+	start := time.Now()
+	result, err = ca.IsEntitled(ctx, cfg, aliceArgs)
+	require.NoError(t, err)
+	require.Less(t, time.Since(start), time.Second)
+	require.True(t, result.IsEntitled())
+	require.Equal(t, []string{"first", "slow"}, takeCalls())
+	require.Equal(t, []ReasonChainStep{
+		{Source: ReasonChainSourceChain, Outcome: PolicyOutcomeAllow, Reason: "NONE"},
+		{Source: "first", Outcome: PolicyOutcomeAllow},
+		{Source: "slow", Outcome: PolicyOutcomeTimeout},
+	}, DetailsOf(result).ReasonChain)
+	require.Equal(t, 1.0, testutil.ToFloat64(ca.policyHooks.verdicts.WithLabelValues("slow", "timeout")))
+
+	// The first denial stops the chain, the on-chain decision stays cached.
+	ca.AddPolicyHook(newHook("mute", PolicyVerdict{Deny: true, Reason: "muted"}, false))
+	ca.AddPolicyHook(newHook("last", PolicyVerdict{}, false))
+	result, err = ca.IsEntitled(ctx, cfg, aliceArgs)
+	require.NoError(t, err)
+	require.False(t, result.IsEntitled())
+	require.Equal(t, EntitlementResultReason_POLICY_DENIED, result.Reason())
+	require.True(t, DetailsOf(result).FromCache)
+	require.Equal(t, []string{"first", "slow", "mute"}, takeCalls())
+	require.Equal(t, ReasonChainStep{Source: "mute", Outcome: PolicyOutcomeDeny, Reason: "muted"},
+		DetailsOf(result).ReasonChain[3])
+	require.Len(t, DetailsOf(result).ReasonChain, 4)
+	require.True(t, ca.entitlementCache.positiveCache.Contains(*ca.entitlementCache.withGeneration(aliceArgs)))
+
+	// The verdicts are recorded in the audit record.
+	sink := &fakeAuditSink{}
+	_, err = ca.CheckEntitlementWithAuditLog(ctx, cfg, aliceArgs, sink)
+	require.NoError(t, err)
+	require.Len(t, sink.records, 1)
+	require.Equal(t, AuditDecisionDeny, sink.records[0].Decision)
+	require.Equal(t, EntitlementResultReason_POLICY_DENIED, sink.records[0].Reason)
+	require.Equal(t, "mute", sink.records[0].ReasonChain[3].Source)
+	takeCalls()
+
+	// Hooks never grant: they don't run on checks the chain denies.
+	result, err = ca.IsEntitled(ctx, cfg, NewChainAuthArgsForSpace(spaceId, bob.Hex(), PermissionWrite))
+	require.NoError(t, err)
+	require.False(t, result.IsEntitled())
+	require.Empty(t, takeCalls())
+	require.Len(t, DetailsOf(result).ReasonChain, 1)
+	require.Equal(t, PolicyOutcomeDeny, DetailsOf(result).ReasonChain[0].Outcome)
+}
+
+func TestDenyListPolicyHook(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	alice := common.HexToAddress("0xa11ce")
+	bob := common.HexToAddress("0xb0b")
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+	blockedSpaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+
+	newChainAuthWithDenyList := func(denyList config.EntitlementDenyListConfig) (*chainAuth, error) {
+		return newChainAuth(
+			ctx,
+			&crypto.Blockchain{Config: &config.ChainConfig{EntitlementDenyList: denyList}},
+			nil,
+			newFakeSpaceContract(common.HexToAddress("0x0e"), alice, bob),
+			nil,
+			nil,
+			0,
+			0,
+			0,
+			0,
+			nil,
+			infra.NewMetricsFactory(prometheus.NewRegistry(), "", ""),
+		)
+	}
+
+	ca, err := newChainAuthWithDenyList(config.EntitlementDenyListConfig{
+		Principals: []string{bob.Hex()},
+		Spaces:     []string{blockedSpaceId.String()},
+	})
+	require.NoError(t, err)
+	defer ca.Close()
+
+	for _, tc := range []struct {
+		principal common.Address
+		spaceId   shared.StreamId
+		entitled  bool
+	}{
+		{alice, spaceId, true},
+		{bob, spaceId, false},
+		{alice, blockedSpaceId, false},
+	} {
+		result, err := ca.IsEntitled(ctx, cfg, NewChainAuthArgsForSpace(tc.spaceId, tc.principal.Hex(), PermissionRead))
+		require.NoError(t, err)
+		require.Equal(t, tc.entitled, result.IsEntitled(), tc)
+		if !tc.entitled {
+			require.Equal(t, EntitlementResultReason_POLICY_DENIED, result.Reason())
+			require.Equal(t, "deny_list", DetailsOf(result).ReasonChain[1].Source)
+		}
+	}
+
+	// Invalid deny-lists fail the construction.
+	_, err = newChainAuthWithDenyList(config.EntitlementDenyListConfig{Principals: []string{"bob"}})
+	require.Error(t, err)
+	_, err = newChainAuthWithDenyList(config.EntitlementDenyListConfig{Spaces: []string{alice.Hex()}})
+	require.Error(t, err)
+}
@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"encoding/hex"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/common"
+	ethCrypto "github.com/ethereum/go-ethereum/crypto"
+)
+
+// Uncached entitlement checks are on the hot path of busy nodes, so the scratch objects that don't outlive
+// a check are pooled to reduce the pressure on the garbage collector. Results and errors are stored in the
+// caches or returned to the caller and are not pooled.
+
+// chainAuthArgsPool pools the copies of ChainAuthArgs that carry the linked wallets of the principal while
+// a check is evaluated.
+type chainAuthArgsPool struct {
+	pool sync.Pool
+	// outstanding is the number of args taken from the pool and not returned yet.
+	outstanding atomic.Int64
+}
+
+func newChainAuthArgsPool() *chainAuthArgsPool {
+	return &chainAuthArgsPool{pool: sync.Pool{New: func() any { return &ChainAuthArgs{} }}}
+}
+
+// withLinkedWallets returns a copy of args with the given linked wallets. The copy must be returned with put
+// once the check is done and must not be retained past it, e.g. by goroutines that outlive the check. Cache
+// keys are stored by value, so storing the copy in a cache doesn't retain it.
+func (p *chainAuthArgsPool) withLinkedWallets(args *ChainAuthArgs, linkedWallets []common.Address) *ChainAuthArgs {
+	ret := p.pool.Get().(*ChainAuthArgs)
+	p.outstanding.Add(1)
+	*ret = *args
+	ret.linkedWallets = serializeWallets(linkedWallets)
+	return ret
+}
+
+// put clears args, so no data of a check is visible to the next one, and returns it to the pool.
+func (p *chainAuthArgsPool) put(args *ChainAuthArgs) {
+	*args = ChainAuthArgs{}
+	p.outstanding.Add(-1)
+	p.pool.Put(args)
+}
+
+// walletScratchMaxPooledWallets bounds the wallet sets whose scratch buffers are returned to the pool, so
+// that a rare large set doesn't pin memory.
+const walletScratchMaxPooledWallets = 64
+
+// walletScratch holds the buffers needed to hash and serialize wallet sets, see WalletSetDigest and
+// serializeWallets.
+type walletScratch struct {
+	wallets []common.Address
+	data    []byte
+	hasher  ethCrypto.KeccakState
+	digest  common.Hash
+}
+
+var walletScratchPool = sync.Pool{
+	New: func() any {
+		return &walletScratch{hasher: ethCrypto.NewKeccakState()}
+	},
+}
+
+func getWalletScratch() *walletScratch {
+	return walletScratchPool.Get().(*walletScratch)
+}
+
+// put returns the scratch to the pool unless it was used for a large wallet set.
+func (s *walletScratch) put(numWallets int) {
+	if numWallets <= walletScratchMaxPooledWallets {
+		walletScratchPool.Put(s)
+	}
+}
+
+// hash returns the keccak256 hash of data.
+func (s *walletScratch) hash(data []byte) common.Hash {
+	s.hasher.Reset()
+	_, _ = s.hasher.Write(data)
+	_, _ = s.hasher.Read(s.digest[:])
+	return s.digest
+}
+
+// appendHex appends the EIP-55 checksummed hex encoding of addr to dst, it is the same as addr.Hex() without
+// allocating a hasher for every address.
+func (s *walletScratch) appendHex(dst []byte, addr *common.Address) []byte {
+	dst = append(dst, "0x"...)
+	start := len(dst)
+	dst = hex.AppendEncode(dst, addr[:])
+	checksum := s.hash(dst[start:])
+	for i := start; i < len(dst); i++ {
+		nibble := checksum[(i-start)/2]
+		if (i-start)%2 == 0 {
+			nibble >>= 4
+		} else {
+			nibble &= 0xf
+		}
+		if dst[i] > '9' && nibble > 7 {
+			dst[i] -= 'a' - 'A'
+		}
+	}
+	return dst
+}
@@ -0,0 +1,263 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	ethCrypto "github.com/ethereum/go-ethereum/crypto"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/towns-protocol/towns/core/config"
+	"github.com/towns-protocol/towns/core/node/base/test"
+	"github.com/towns-protocol/towns/core/node/crypto"
+	"github.com/towns-protocol/towns/core/node/infra"
+	"github.com/towns-protocol/towns/core/node/shared"
+	"github.com/towns-protocol/towns/core/node/testutils"
+)
+
+// walletSetDigestUnpooled is WalletSetDigest without the pooled scratch buffers.
+func walletSetDigestUnpooled(wallets []common.Address) common.Hash {
+	sorted := slices.Clone(wallets)
+	slices.SortFunc(sorted, func(a, b common.Address) int {
+		return a.Cmp(b)
+	})
+	sorted = slices.Compact(sorted)
+
+	data := make([]byte, 0, len(sorted)*common.AddressLength)
+	for _, wallet := range sorted {
+		data = append(data, wallet.Bytes()...)
+	}
+	return ethCrypto.Keccak256Hash(data)
+}
+
+// serializeWalletsUnpooled is serializeWallets without the pooled scratch buffers.
+func serializeWalletsUnpooled(wallets []common.Address) string {
+	hexWallets := make([]string, len(wallets))
+	for i, wallet := range wallets {
+		hexWallets[i] = wallet.Hex()
+	}
+	return strings.Join(hexWallets, ",")
+}
+
+func testWallets(prefix byte, n int) []common.Address {
+	wallets := make([]common.Address, n)
+	for i := range wallets {
+		wallets[i] = common.BytesToAddress([]byte{prefix, byte(i >> 8), byte(i)})
+	}
+	return wallets
+}
+
+func TestWalletSetDigestPooled(t *testing.T) {
+	sets := [][]common.Address{
+		nil,
+		testWallets(0x10, 1),
+		testWallets(0x20, 10),
+		append(testWallets(0x30, 3), testWallets(0x30, 3)...),
+		testWallets(0x40, walletScratchMaxPooledWallets+1),
+	}
+
+	// Concurrent digests of different sets don't see each other's buffers.
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				for _, wallets := range sets {
+					require.Equal(t, walletSetDigestUnpooled(wallets), WalletSetDigest(wallets))
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Serialized wallets keep the checksummed encoding of cache keys stored before the buffers were pooled.
+	for _, wallets := range sets {
+		require.Equal(t, serializeWalletsUnpooled(wallets), serializeWallets(wallets))
+	}
+	for range 1000 {
+		var address common.Address
+		_, _ = rand.Read(address[:])
+		require.Equal(t, address.Hex(), serializeWallets([]common.Address{address}))
+	}
+
+	// The digest doesn't reorder the wallets of the caller.
+	wallets := []common.Address{common.HexToAddress("0x2"), common.HexToAddress("0x1")}
+	WalletSetDigest(wallets)
+	require.Equal(t, common.HexToAddress("0x2"), wallets[0])
+}
+
+func TestPooledArgsDontLeakAcrossChecks(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	entitled := testWallets(0x50, 50)
+	spaceContract := newFakeSpaceContract(common.HexToAddress("0x0e"), entitled...)
+	ca := newTestChainAuth(t, ctx, spaceContract)
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+
+	// Concurrent checks of different principals, entitled or not, only see their own wallets.
+	var wg sync.WaitGroup
+	for i, principal := range append(entitled, testWallets(0x60, 50)...) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			wallets := []common.Address{principal}
+			args := NewChainAuthArgsForSpaceWithWallets(spaceId, wallets, PermissionWrite)
+			result, err := ca.IsEntitled(withoutCache(ctx), cfg, args)
+			require.NoError(t, err)
+			require.Equal(t, i < len(entitled), result.IsEntitled(), principal)
+			require.Equal(t, WalletSetDigest(wallets), DetailsOf(result).WalletSetDigest)
+		}()
+	}
+	wg.Wait()
+	require.Zero(t, ca.argsPool.outstanding.Load())
+
+	// Denied and failed checks return their args too.
+	_, err := ca.IsEntitled(
+		ctx,
+		cfg,
+		NewChainAuthArgsForSpaceWithWallets(spaceId, testWallets(0x70, 1), PermissionWrite),
+	)
+	require.NoError(t, err)
+	cancelledCtx, cancelChecks := context.WithCancel(ctx)
+	cancelChecks()
+	_, err = ca.IsEntitled(
+		cancelledCtx,
+		cfg,
+		NewChainAuthArgsForSpaceWithWallets(spaceId, testWallets(0x80, 3), PermissionWrite),
+	)
+	require.Error(t, err)
+	require.Zero(t, ca.argsPool.outstanding.Load())
+
+	// Returned args are cleared.
+	args := ca.argsPool.withLinkedWallets(NewChainAuthArgsForSpace(spaceId, entitled[0].Hex(), PermissionRead), entitled)
+	require.NotEmpty(t, args.linkedWallets)
+	ca.argsPool.put(args)
+	require.Equal(t, ChainAuthArgs{}, *args)
+}
+
+func TestAllocSampler(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	sampleCount := func(registry *prometheus.Registry, name string) uint64 {
+		families, err := registry.Gather()
+		require.NoError(t, err)
+		for _, family := range families {
+			if family.GetName() == name {
+				return family.GetMetric()[0].GetHistogram().GetSampleCount()
+			}
+		}
+		return 0
+	}
+
+	cfg := &config.Config{}
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+	for _, sampleRate := range []float64{0, 1} {
+		registry := prometheus.NewRegistry()
+		ca, err := newChainAuth(
+			ctx,
+			&crypto.Blockchain{Config: &config.ChainConfig{EntitlementAllocSampleRate: sampleRate}},
+			nil,
+			newFakeSpaceContract(common.HexToAddress("0x0e")),
+			nil,
+			nil,
+			0,
+			0,
+			0,
+			0,
+			nil,
+			infra.NewMetricsFactory(registry, "", ""),
+		)
+		require.NoError(t, err)
+
+		// Only uncached checks are sampled.
+		for range 3 {
+			_, err = ca.IsEntitled(ctx, cfg, NewChainAuthArgsForSpace(spaceId, "0x0e", PermissionRead))
+			require.NoError(t, err)
+		}
+		expected := uint64(sampleRate)
+		require.Equal(t, expected, sampleCount(registry, "entitlement_check_alloc_bytes"), sampleRate)
+		require.Equal(t, expected, sampleCount(registry, "entitlement_check_alloc_objects"), sampleRate)
+	}
+}
+
+func BenchmarkWalletSetDigest(b *testing.B) {
+	wallets := testWallets(0x10, DEFAULT_MAX_WALLETS)
+	b.Run("pooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for range b.N {
+			WalletSetDigest(wallets)
+		}
+	})
+	b.Run("unpooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for range b.N {
+			walletSetDigestUnpooled(wallets)
+		}
+	})
+}
+
+func BenchmarkLinkedWalletsArgs(b *testing.B) {
+	wallets := testWallets(0x10, DEFAULT_MAX_WALLETS)
+	args := NewChainAuthArgsForSpace(testutils.FakeStreamId(shared.STREAM_SPACE_BIN), "0x1", PermissionRead)
+	pool := newChainAuthArgsPool()
+	b.Run("pooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for range b.N {
+			pool.put(pool.withLinkedWallets(args, wallets))
+		}
+	})
+	b.Run("unpooled", func(b *testing.B) {
+		b.ReportAllocs()
+		var ret *ChainAuthArgs
+		for range b.N {
+			ret = new(ChainAuthArgs)
+			*ret = *args
+			ret.linkedWallets = serializeWalletsUnpooled(wallets)
+		}
+		_ = ret
+	})
+}
+
+func BenchmarkUncachedEntitlementCheck(b *testing.B) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	wallets := testWallets(0x10, DEFAULT_MAX_WALLETS)
+	ca, err := newChainAuth(
+		ctx,
+		&crypto.Blockchain{Config: &config.ChainConfig{}},
+		nil,
+		newFakeSpaceContract(common.HexToAddress("0x0e"), wallets[len(wallets)-1]),
+		nil,
+		nil,
+		0,
+		0,
+		0,
+		0,
+		nil,
+		infra.NewMetricsFactory(prometheus.NewRegistry(), "", ""),
+	)
+	require.NoError(b, err)
+	args := NewChainAuthArgsForSpaceWithWallets(testutils.FakeStreamId(shared.STREAM_SPACE_BIN), wallets, PermissionWrite)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for range b.N {
+		result, err := ca.IsEntitled(withoutCache(ctx), cfg, args)
+		if err != nil || !result.IsEntitled() {
+			b.Fatal(fmt.Sprint("unexpected result ", result, err))
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package auth
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	. "github.com/towns-protocol/towns/core/node/base"
+	"github.com/towns-protocol/towns/core/node/infra"
+	. "github.com/towns-protocol/towns/core/node/protocol"
+)
+
+const (
+	// MaxReadOnlyDuration bounds a single read-only window, so a forgotten maintenance window doesn't keep the
+	// node from reading the chain indefinitely.
+	MaxReadOnlyDuration = 24 * time.Hour
+	// readOnlyMaxBufferedSpaceEvents caps the space events buffered per subscription while chainAuth is
+	// read-only, see watchSpaceEvents.
+	readOnlyMaxBufferedSpaceEvents = 1000
+)
+
+// ReadOnlyController is implemented by ChainAuth implementations that can stop reading the chain during
+// maintenance windows of the chain.
+type ReadOnlyController interface {
+	// SetReadOnly serves entitlement checks from the caches only for the given duration, a duration of 0
+	// leaves read-only mode. Checks that miss the caches fail with Err_UNAVAILABLE while read-only.
+	SetReadOnly(duration time.Duration) error
+	// ReadOnlyUntil returns the end of the current read-only window, zero if chainAuth is not read-only.
+	ReadOnlyUntil() time.Time
+}
+
+var _ ReadOnlyController = (*chainAuth)(nil)
+
+// readOnlyMode tracks the read-only window of chainAuth. The window expires on its own, there is no need to
+// leave read-only mode explicitly.
+type readOnlyMode struct {
+	// until is the end of the window in unix nanoseconds, it is read without locking on every cache miss.
+	until atomic.Int64
+
+	mu sync.Mutex
+	// ended is closed when the current window ends, nil if chainAuth is not read-only.
+	ended chan struct{}
+	timer *time.Timer
+
+	refused        *prometheus.CounterVec
+	bufferedEvents prometheus.Counter
+}
+
+func newReadOnlyMode(metrics infra.MetricsFactory) *readOnlyMode {
+	m := &readOnlyMode{
+		refused: metrics.NewCounterVecEx(
+			"entitlement_read_only_refused",
+			"Chain reads refused because chainAuth is read-only",
+			"op",
+		),
+		bufferedEvents: metrics.NewCounterEx(
+			"entitlement_read_only_buffered_space_events",
+			"Space events buffered until chainAuth leaves read-only mode",
+		),
+	}
+	metrics.NewGaugeFunc(
+		prometheus.GaugeOpts{
+			Name: "entitlement_read_only",
+			Help: "1 if chainAuth serves entitlement checks from the caches only, 0 otherwise",
+		},
+		func() float64 {
+			if m.active() {
+				return 1
+			}
+			return 0
+		},
+	)
+	return m
+}
+
+func (m *readOnlyMode) active() bool {
+	return m != nil && time.Now().UnixNano() < m.until.Load()
+}
+
+// check returns an error if chainAuth is read-only, op identifies the refused read in the metrics.
+func (m *readOnlyMode) check(op string) error {
+	if !m.active() {
+		return nil
+	}
+	m.refused.WithLabelValues(op).Inc()
+	return RiverError(Err_UNAVAILABLE, "Chain reads are paused for maintenance").
+		Tag("reason", EntitlementResultReason_MAINTENANCE).
+		Tag("until", time.Unix(0, m.until.Load()))
+}
+
+func (m *readOnlyMode) set(duration time.Duration) error {
+	if duration < 0 || duration > MaxReadOnlyDuration {
+		return RiverError(Err_INVALID_ARGUMENT, "Invalid read-only duration").
+			Tag("duration", duration).
+			Tag("max", MaxReadOnlyDuration)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.timer != nil {
+		m.timer.Stop()
+		m.timer = nil
+	}
+	if duration == 0 {
+		m.until.Store(0)
+		m.end()
+		return nil
+	}
+
+	m.until.Store(time.Now().Add(duration).UnixNano())
+	if m.ended == nil {
+		m.ended = make(chan struct{})
+	}
+	m.timer = time.AfterFunc(duration, m.expire)
+	return nil
+}
+
+// expire ends the window when its timer fires, unless the window was extended in the meantime.
+func (m *readOnlyMode) expire() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.active() {
+		m.end()
+	}
+}
+
+// end closes the channel of the current window, m.mu must be held.
+func (m *readOnlyMode) end() {
+	if m.ended != nil {
+		close(m.ended)
+		m.ended = nil
+	}
+}
+
+// endedCh returns a channel that is closed when the current window ends, nil if chainAuth is not read-only.
+func (m *readOnlyMode) endedCh() <-chan struct{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.active() {
+		return nil
+	}
+	return m.ended
+}
+
+// bufferSpaceEvent appends event to the events buffered while chainAuth is read-only. If the buffer is full,
+// the buffered events are replaced by a single event that invalidates the whole space.
+func (m *readOnlyMode) bufferSpaceEvent(buffered []SpaceEvent, event SpaceEvent) []SpaceEvent {
+	m.bufferedEvents.Inc()
+	if len(buffered) < readOnlyMaxBufferedSpaceEvents {
+		return append(buffered, event)
+	}
+	return append(buffered[:0], SpaceEvent{
+		Type:     SpaceEventType_UNKNOWN,
+		SpaceId:  event.SpaceId,
+		BlockNum: event.BlockNum,
+	})
+}
+
+func (m *readOnlyMode) close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.timer != nil {
+		m.timer.Stop()
+		m.timer = nil
+	}
+}
+
+// SetReadOnly serves entitlement checks from the caches only for the given duration, see ReadOnlyController.
+// While read-only, cache misses fail fast instead of reading the chain, background refreshes such as join
+// pre-warming and dual reads are paused, and space events are buffered, so cached results stay available, and
+// applied once the window ends.
+func (ca *chainAuth) SetReadOnly(duration time.Duration) error {
+	if err := ca.readOnly.set(duration); err != nil {
+		return AsRiverError(err).Func("SetReadOnly")
+	}
+	return nil
+}
+
+func (ca *chainAuth) ReadOnlyUntil() time.Time {
+	if !ca.readOnly.active() {
+		return time.Time{}
+	}
+	return time.Unix(0, ca.readOnly.until.Load())
+}
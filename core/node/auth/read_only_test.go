@@ -0,0 +1,207 @@
+package auth
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	ethTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/towns-protocol/towns/core/config"
+	"github.com/towns-protocol/towns/core/contracts/base"
+	. "github.com/towns-protocol/towns/core/node/base"
+	"github.com/towns-protocol/towns/core/node/base/test"
+	"github.com/towns-protocol/towns/core/node/crypto"
+	"github.com/towns-protocol/towns/core/node/infra"
+	. "github.com/towns-protocol/towns/core/node/protocol"
+	"github.com/towns-protocol/towns/core/node/shared"
+	"github.com/towns-protocol/towns/core/node/testutils"
+)
+
+func TestReadOnlyMode(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	alice := common.HexToAddress("0xa11ce")
+	bob := common.HexToAddress("0xb0b")
+	spaceContract := newFakeSpaceContract(common.HexToAddress("0x0e"), alice, bob)
+	ca := newTestChainAuth(t, ctx, spaceContract)
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+	aliceArgs := NewChainAuthArgsForSpace(spaceId, alice.Hex(), PermissionWrite)
+	bobArgs := NewChainAuthArgsForSpace(spaceId, bob.Hex(), PermissionWrite)
+
+	result, err := ca.IsEntitled(ctx, cfg, aliceArgs)
+	require.NoError(t, err)
+	require.True(t, result.IsEntitled())
+	require.True(t, ca.ReadOnlyUntil().IsZero())
+
+	// Toggle read-only mode while checks are running: cached results are always served, misses either fail
+	// fast or are computed, but are never denied because of the mode.
+	var stop atomic.Bool
+	var refused, computed atomic.Int32
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; !stop.Load(); j++ {
+				result, err := ca.IsEntitled(ctx, cfg, aliceArgs)
+				require.NoError(t, err)
+				require.True(t, result.IsEntitled())
+
+				principal := common.BigToAddress(common.Big256).Hex()
+				if (i+j)%4 == 0 {
+					principal = bob.Hex()
+				}
+				args := NewChainAuthArgsForSpace(spaceId, principal, PermissionWrite)
+				result, err = ca.IsEntitled(withoutCache(ctx), cfg, args)
+				if err != nil {
+					require.Equal(t, Err_UNAVAILABLE, AsRiverError(err).Code)
+					require.Equal(t, EntitlementResultReason_MAINTENANCE, AsRiverError(err).GetTag("reason"))
+					refused.Add(1)
+				} else {
+					require.Equal(t, principal == bob.Hex(), result.IsEntitled())
+					computed.Add(1)
+				}
+			}
+		}()
+	}
+	for range 5 {
+		require.NoError(t, ca.SetReadOnly(time.Hour))
+		time.Sleep(10 * time.Millisecond)
+		require.NoError(t, ca.SetReadOnly(0))
+		time.Sleep(10 * time.Millisecond)
+	}
+	stop.Store(true)
+	wg.Wait()
+	require.Positive(t, refused.Load())
+	require.Positive(t, computed.Load())
+
+	// Refused misses are not cached and don't read the chain.
+	require.NoError(t, ca.SetReadOnly(time.Hour))
+	require.WithinDuration(t, time.Now().Add(time.Hour), ca.ReadOnlyUntil(), time.Minute)
+	calls := spaceContract.callCount("GetMembershipStatus")
+	refusedBefore := testutil.ToFloat64(ca.readOnly.refused.WithLabelValues("entitlement"))
+	_, err = ca.IsEntitled(ctx, cfg, bobArgs)
+	require.Equal(t, Err_UNAVAILABLE, AsRiverError(err).Code)
+	_, err = ca.IsEntitled(ctx, cfg, bobArgs.WithForceRefresh())
+	require.Equal(t, Err_UNAVAILABLE, AsRiverError(err).Code)
+	require.Equal(t, calls, spaceContract.callCount("GetMembershipStatus"))
+	require.Equal(t, refusedBefore+2, testutil.ToFloat64(ca.readOnly.refused.WithLabelValues("entitlement")))
+	require.False(t, ca.entitlementCache.negativeCache.Contains(*ca.entitlementCache.withGeneration(bobArgs)))
+	_, err = ca.VerifyReceipt(ctx, cfg, &BlockchainTransactionReceipt{})
+	require.Equal(t, Err_UNAVAILABLE, AsRiverError(err).Code)
+
+	result, err = ca.IsEntitled(ctx, cfg, aliceArgs)
+	require.NoError(t, err)
+	require.True(t, result.IsEntitled())
+
+	// The window expires on its own.
+	require.NoError(t, ca.SetReadOnly(50*time.Millisecond))
+	ended := ca.readOnly.endedCh()
+	require.NotNil(t, ended)
+	<-ended
+	require.True(t, ca.ReadOnlyUntil().IsZero())
+	result, err = ca.IsEntitled(ctx, cfg, bobArgs)
+	require.NoError(t, err)
+	require.True(t, result.IsEntitled())
+
+	// Windows must be bounded.
+	require.Error(t, ca.SetReadOnly(MaxReadOnlyDuration+time.Second))
+	require.Error(t, ca.SetReadOnly(-time.Second))
+	require.True(t, ca.ReadOnlyUntil().IsZero())
+}
+
+func TestReadOnlyBuffersSpaceEvents(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	rolesAbi, err := base.IRolesMetaData.GetAbi()
+	require.NoError(t, err)
+
+	cfg := &config.Config{}
+	alice := common.HexToAddress("0xa11ce")
+	client := &fakeLogsClient{}
+	registry := prometheus.NewRegistry()
+	ca, err := newChainAuth(
+		ctx,
+		&crypto.Blockchain{Config: &config.ChainConfig{}, Client: client},
+		nil,
+		newFakeSpaceContract(common.HexToAddress("0x0e"), alice),
+		nil,
+		nil,
+		0,
+		0,
+		0,
+		0,
+		nil,
+		infra.NewMetricsFactory(registry, "", ""),
+	)
+	require.NoError(t, err)
+	defer ca.Close()
+
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+	spaceAddress, err := shared.AddressFromSpaceId(spaceId)
+	require.NoError(t, err)
+	events := make(chan SpaceEvent, 10)
+	require.NoError(t, ca.WatchSpaceEvents(ctx, spaceId, events))
+
+	aliceArgs := NewChainAuthArgsForSpace(spaceId, alice.Hex(), PermissionWrite)
+	_, err = ca.IsEntitled(ctx, cfg, aliceArgs)
+	require.NoError(t, err)
+
+	// Role changes are buffered while read-only, the cached result keeps being served.
+	require.NoError(t, ca.SetReadOnly(time.Hour))
+	for i := range 3 {
+		client.send(ethTypes.Log{
+			Address: spaceAddress,
+			Topics: []common.Hash{
+				rolesAbi.Events["RoleUpdated"].ID,
+				common.BytesToHash(alice.Bytes()),
+				common.BigToHash(common.Big3),
+			},
+			BlockNumber: uint64(10 + i),
+		})
+	}
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(ca.readOnly.bufferedEvents) == 3
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Empty(t, events)
+	result, err := ca.IsEntitled(ctx, cfg, aliceArgs)
+	require.NoError(t, err)
+	require.True(t, result.IsEntitled())
+	require.Zero(t, testutil.ToFloat64(ca.readOnly.refused.WithLabelValues("entitlement")))
+
+	// Extending the window keeps the events buffered.
+	require.NoError(t, ca.SetReadOnly(time.Hour))
+	require.Never(t, func() bool { return len(events) > 0 }, 50*time.Millisecond, 10*time.Millisecond)
+
+	// The buffered events are applied in order once read-only mode ends.
+	require.NoError(t, ca.SetReadOnly(0))
+	for i := range 3 {
+		event := <-events
+		require.Equal(t, SpaceEventType_ROLES_CHANGED, event.Type)
+		require.Equal(t, crypto.BlockNumber(10+i), event.BlockNum)
+	}
+	require.False(t, ca.entitlementCache.positiveCache.Contains(*aliceArgs))
+
+	// The buffer is bounded: once full, the buffered events collapse into a single space-wide event.
+	var buffered []SpaceEvent
+	for i := range readOnlyMaxBufferedSpaceEvents + 1 {
+		buffered = ca.readOnly.bufferSpaceEvent(
+			buffered,
+			SpaceEvent{Type: SpaceEventType_ROLES_CHANGED, SpaceId: spaceId, BlockNum: crypto.BlockNumber(i)},
+		)
+	}
+	require.Equal(t, []SpaceEvent{{
+		Type:     SpaceEventType_UNKNOWN,
+		SpaceId:  spaceId,
+		BlockNum: readOnlyMaxBufferedSpaceEvents,
+	}}, buffered)
+}
@@ -0,0 +1,248 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	ethTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/prometheus/client_golang/prometheus"
+
+	. "github.com/towns-protocol/towns/core/node/base"
+	"github.com/towns-protocol/towns/core/node/crypto"
+	"github.com/towns-protocol/towns/core/node/infra"
+	. "github.com/towns-protocol/towns/core/node/protocol"
+	"github.com/towns-protocol/towns/core/xchain/entitlement"
+)
+
+// blockchainClients is implemented by entitlement.Evaluator.
+type blockchainClients interface {
+	GetClient(chainId uint64) (crypto.BlockchainClient, error)
+}
+
+// VerifiedTransaction is the on-chain transaction of a verified receipt.
+type VerifiedTransaction struct {
+	To   common.Address
+	From common.Address
+	Logs []*ethTypes.Log
+}
+
+// ReceiptVerifier checks that transaction receipts uploaded by clients match the transactions on chain.
+// It does not depend on the space contract, so it can be used by the xchain node as well as by chainAuth.
+type ReceiptVerifier struct {
+	clients blockchainClients
+	// retry is applied to the chain calls, a single attempt is made if not set.
+	retry rpcRetryPolicy
+	// metrics are not reported if not set.
+	metrics *receiptMetrics
+}
+
+// Outcomes of receipt verifications, see receiptMetrics.
+const (
+	receiptOutcomeSuccess                   = "success"
+	receiptOutcomeNotFound                  = "not_found"
+	receiptOutcomeBlockMismatch             = "block_mismatch"
+	receiptOutcomeLogMismatch               = "log_mismatch"
+	receiptOutcomeAddressMismatch           = "address_mismatch"
+	receiptOutcomePending                   = "pending"
+	receiptOutcomeInsufficientConfirmations = "insufficient_confirmations"
+	receiptOutcomeRpcError                  = "rpc_error"
+)
+
+// receiptMetrics reports the latency and outcome of receipt verifications.
+type receiptMetrics struct {
+	duration prometheus.Histogram
+	outcomes *prometheus.CounterVec
+}
+
+func newReceiptMetrics(metrics infra.MetricsFactory) *receiptMetrics {
+	return &receiptMetrics{
+		duration: metrics.NewHistogramEx(
+			"entitlement_receipt_verification_duration_seconds",
+			"Duration of transaction receipt verifications in seconds, including all chain calls",
+			prometheus.DefBuckets,
+		),
+		outcomes: metrics.NewCounterVecEx(
+			"entitlement_receipt_verifications",
+			"Transaction receipt verifications by outcome",
+			"outcome",
+		),
+	}
+}
+
+func (m *receiptMetrics) observe(outcome string, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.duration.Observe(duration.Seconds())
+	m.outcomes.WithLabelValues(outcome).Inc()
+}
+
+// NewReceiptVerifier creates a ReceiptVerifier that fetches transactions with the clients of the evaluator.
+// Transactions and their confirmations are read from the chain of the receipt.
+func NewReceiptVerifier(evaluator *entitlement.Evaluator) *ReceiptVerifier {
+	return &ReceiptVerifier{clients: evaluator}
+}
+
+// Verify returns the on-chain transaction of the receipt if the receipt matches it exactly and the transaction
+// has been confirmed. An Err_PERMISSION_DENIED error is returned if the receipt doesn't match.
+func (v *ReceiptVerifier) Verify(
+	ctx context.Context,
+	userReceipt *BlockchainTransactionReceipt,
+) (*VerifiedTransaction, error) {
+	start := time.Now()
+	tx, outcome, err := v.verify(ctx, userReceipt)
+	v.metrics.observe(outcome, time.Since(start))
+	return tx, err
+}
+
+// verify implements Verify and returns the outcome of the verification for the metrics.
+func (v *ReceiptVerifier) verify(
+	ctx context.Context,
+	userReceipt *BlockchainTransactionReceipt,
+) (*VerifiedTransaction, string, error) {
+	client, err := v.clients.GetClient(userReceipt.GetChainId())
+	if err != nil {
+		return nil, receiptOutcomeRpcError, err
+	}
+	txHash := common.BytesToHash(userReceipt.GetTransactionHash())
+	chainReceipt, err := retryRpc(
+		ctx,
+		v.retry,
+		"TransactionReceipt",
+		func(ctx context.Context) (*ethTypes.Receipt, error) {
+			return client.TransactionReceipt(ctx, txHash)
+		},
+	)
+	if err != nil {
+		if errors.Is(err, ethereum.NotFound) {
+			return nil, receiptOutcomeNotFound, RiverError(
+				Err_PERMISSION_DENIED, "Transaction receipt not found", "txHash", txHash.Hex())
+		}
+		return nil, receiptOutcomeRpcError, AsRiverError(err, Err_DOWNSTREAM_NETWORK_ERROR)
+	}
+
+	// Check if the block number matches:
+	if chainReceipt.BlockNumber.Uint64() != userReceipt.BlockNumber {
+		return nil, receiptOutcomeBlockMismatch, RiverError(Err_PERMISSION_DENIED, "Block number mismatch", "got",
+			chainReceipt.BlockNumber.Uint64(), "user uploaded", userReceipt.BlockNumber)
+	}
+
+	// Check logs count and match the event log data
+	if len(chainReceipt.Logs) != len(userReceipt.Logs) {
+		return nil, receiptOutcomeLogMismatch, RiverError(Err_PERMISSION_DENIED, "Log count mismatch: chain:",
+			len(chainReceipt.Logs), "uploaded:", len(userReceipt.Logs))
+	}
+
+	// For each log, check address, topics, data
+	for i, chainLog := range chainReceipt.Logs {
+		uploadedLog := userReceipt.Logs[i]
+		if !bytes.Equal(chainLog.Address[:], uploadedLog.Address) {
+			return nil, receiptOutcomeLogMismatch, RiverError(
+				Err_PERMISSION_DENIED,
+				"Log address mismatch:",
+				i,
+				"address:",
+				chainLog.Address.Hex(),
+				"uploaded:",
+				uploadedLog.Address,
+			)
+		}
+
+		if len(chainLog.Topics) != len(uploadedLog.Topics) {
+			return nil, receiptOutcomeLogMismatch, RiverError(Err_PERMISSION_DENIED, "Log topics count mismatch", i)
+		}
+
+		for j, topic := range chainLog.Topics {
+			if !bytes.Equal(topic[:], uploadedLog.Topics[j]) {
+				return nil, receiptOutcomeLogMismatch, RiverError(Err_PERMISSION_DENIED, "Log topic mismatch",
+					i, "topic index: ", j, "chain: ", topic.Hex(), "uploaded: ", uploadedLog.Topics[j])
+			}
+		}
+
+		if !bytes.Equal(chainLog.Data, uploadedLog.Data) {
+			return nil, receiptOutcomeLogMismatch, RiverError(Err_PERMISSION_DENIED, "Log data mismatch", i)
+		}
+	}
+
+	// get the transaction
+	var isPending bool
+	tx, err := retryRpc(
+		ctx,
+		v.retry,
+		"TransactionByHash",
+		func(ctx context.Context) (*ethTypes.Transaction, error) {
+			tx, pending, err := client.TransactionByHash(ctx, txHash)
+			isPending = pending
+			return tx, err
+		},
+	)
+	if err != nil {
+		if errors.Is(err, ethereum.NotFound) {
+			return nil, receiptOutcomeNotFound, err
+		}
+		return nil, receiptOutcomeRpcError, err
+	}
+	if isPending {
+		return nil, receiptOutcomePending, RiverError(
+			Err_PERMISSION_DENIED, "Transaction is pending", "txHash", txHash.Hex())
+	}
+
+	// check the to address
+	if !bytes.Equal(tx.To()[:], userReceipt.GetTo()) {
+		return nil, receiptOutcomeAddressMismatch, RiverError(
+			Err_PERMISSION_DENIED,
+			"To address mismatch",
+			"chain",
+			tx.To().Hex(),
+			"uploaded",
+			userReceipt.To,
+		)
+	}
+
+	// check the from addresses
+	signer := ethTypes.LatestSignerForChainID(tx.ChainId())
+	sender, err := signer.Sender(tx)
+	if err != nil {
+		return nil, receiptOutcomeAddressMismatch, err
+	}
+	if !bytes.Equal(sender.Bytes(), userReceipt.GetFrom()) {
+		return nil, receiptOutcomeAddressMismatch, RiverError(
+			Err_PERMISSION_DENIED,
+			"From address mismatch",
+			"chain",
+			sender.Hex(),
+			"uploaded",
+			userReceipt.From,
+		)
+	}
+
+	// If we reach here, the logs match exactly.
+
+	// 3) Check the number of confirmations on the chain of the transaction, which isn't necessarily the base chain.
+	latestBlockNumber, err := retryRpc(ctx, v.retry, "BlockNumber", client.BlockNumber)
+	if err != nil {
+		return nil, receiptOutcomeRpcError, RiverError(Err_PERMISSION_DENIED, "Failed to get latest block number: %v", err)
+	}
+
+	confirmations := latestBlockNumber - chainReceipt.BlockNumber.Uint64()
+	if confirmations < 1 {
+		return nil, receiptOutcomeInsufficientConfirmations, RiverError(
+			Err_PERMISSION_DENIED,
+			"Transaction has 0 confirmations.",
+			"latestBlockNumber",
+			latestBlockNumber,
+			"uploaded:",
+			chainReceipt.BlockNumber.Uint64(),
+		)
+	}
+
+	return &VerifiedTransaction{
+		To:   *tx.To(),
+		From: sender,
+		Logs: chainReceipt.Logs,
+	}, receiptOutcomeSuccess, nil
+}
@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	ethTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/towns-protocol/towns/core/node/base"
+	"github.com/towns-protocol/towns/core/node/base/test"
+	"github.com/towns-protocol/towns/core/node/crypto"
+	. "github.com/towns-protocol/towns/core/node/protocol"
+)
+
+// emitterBytecode deploys a contract that emits a log with the caller as its topic on every call. Its runtime
+// code is CALLER PUSH1 0x20 PUSH1 0x00 LOG1 STOP.
+var emitterBytecode = hexutil.MustDecode("0x6007600c60003960076000f33360206000a100")
+
+// TestReceiptVerifierOnChain verifies receipts of transactions executed on a chain, the simulated backend or
+// the Anvil node at RIVER_TEST_ANVIL_URL if set.
+func TestReceiptVerifierOnChain(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	btc, err := crypto.NewBlockchainTestContext(ctx, crypto.TestParams{MineOnTx: true})
+	require.NoError(t, err)
+	defer btc.Close()
+
+	deployer := btc.DeployerBlockchain
+	pendingTx, err := deployer.TxPool.Submit(
+		ctx,
+		"DeployEmitter",
+		func(opts *bind.TransactOpts) (*ethTypes.Transaction, error) {
+			_, tx, _, err := bind.DeployContract(opts, abi.ABI{}, emitterBytecode, deployer.Client)
+			return tx, err
+		},
+	)
+	require.NoError(t, err)
+	deployment, err := pendingTx.Wait(ctx)
+	require.NoError(t, err)
+	require.Equal(t, ethTypes.ReceiptStatusSuccessful, deployment.Status)
+	emitter := deployment.ContractAddress
+
+	pendingTx, err = deployer.TxPool.Submit(ctx, "Emit", func(opts *bind.TransactOpts) (*ethTypes.Transaction, error) {
+		return bind.NewBoundContract(emitter, abi.ABI{}, deployer.Client, deployer.Client, nil).RawTransact(opts, nil)
+	})
+	require.NoError(t, err)
+	chainReceipt, err := pendingTx.Wait(ctx)
+	require.NoError(t, err)
+	require.Len(t, chainReceipt.Logs, 1)
+
+	verifier := &ReceiptVerifier{clients: fakeReceiptClients{btc.ChainId.Uint64(): btc.Client()}}
+	newReceipt := func() *BlockchainTransactionReceipt {
+		receipt := &BlockchainTransactionReceipt{
+			ChainId:         btc.ChainId.Uint64(),
+			TransactionHash: pendingTx.TransactionHash().Bytes(),
+			BlockNumber:     chainReceipt.BlockNumber.Uint64(),
+			To:              emitter.Bytes(),
+			From:            deployer.Wallet.Address.Bytes(),
+		}
+		for _, log := range chainReceipt.Logs {
+			uploaded := &BlockchainTransactionReceipt_Log{Address: log.Address.Bytes(), Data: log.Data}
+			for _, topic := range log.Topics {
+				uploaded.Topics = append(uploaded.Topics, topic.Bytes())
+			}
+			receipt.Logs = append(receipt.Logs, uploaded)
+		}
+		return receipt
+	}
+
+	// The transaction is not confirmed until another block is mined on top of it.
+	_, err = verifier.Verify(ctx, newReceipt())
+	require.ErrorContains(t, err, "0 confirmations")
+	btc.Commit(ctx)
+
+	verified, err := verifier.Verify(ctx, newReceipt())
+	require.NoError(t, err)
+	require.Equal(t, emitter, verified.To)
+	require.Equal(t, deployer.Wallet.Address, verified.From)
+	require.Equal(t, common.BytesToHash(deployer.Wallet.Address.Bytes()), verified.Logs[0].Topics[0])
+
+	for name, tc := range map[string]struct {
+		mutate func(r *BlockchainTransactionReceipt)
+		err    string
+	}{
+		"wrong block": {func(r *BlockchainTransactionReceipt) { r.BlockNumber++ }, "Block number mismatch"},
+		"extra log": {
+			func(r *BlockchainTransactionReceipt) {
+				r.Logs = append(r.Logs, &BlockchainTransactionReceipt_Log{Address: emitter.Bytes()})
+			},
+			"Log count mismatch",
+		},
+		"wrong sender": {
+			func(r *BlockchainTransactionReceipt) { r.From = common.HexToAddress("0x5e").Bytes() },
+			"From address mismatch",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			receipt := newReceipt()
+			tc.mutate(receipt)
+			_, err := verifier.Verify(ctx, receipt)
+			require.Equal(t, Err_PERMISSION_DENIED, AsRiverError(err).Code)
+			require.ErrorContains(t, err, tc.err)
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package auth
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	ethTypes "github.com/ethereum/go-ethereum/core/types"
+	ethCrypto "github.com/ethereum/go-ethereum/crypto"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/towns-protocol/towns/core/node/base"
+	"github.com/towns-protocol/towns/core/node/base/test"
+	"github.com/towns-protocol/towns/core/node/crypto"
+	"github.com/towns-protocol/towns/core/node/infra"
+	. "github.com/towns-protocol/towns/core/node/protocol"
+)
+
+// fakeReceiptClient serves a single transaction and the latest block number.
+type fakeReceiptClient struct {
+	crypto.BlockchainClient
+
+	tx          *ethTypes.Transaction
+	receipt     *ethTypes.Receipt
+	blockNumber uint64
+}
+
+func (c *fakeReceiptClient) GetClient(uint64) (crypto.BlockchainClient, error) {
+	return c, nil
+}
+
+func (c *fakeReceiptClient) TransactionReceipt(_ context.Context, txHash common.Hash) (*ethTypes.Receipt, error) {
+	if txHash != c.tx.Hash() {
+		return nil, ethereum.NotFound
+	}
+	return c.receipt, nil
+}
+
+func (c *fakeReceiptClient) TransactionByHash(
+	_ context.Context,
+	txHash common.Hash,
+) (*ethTypes.Transaction, bool, error) {
+	if txHash != c.tx.Hash() {
+		return nil, false, ethereum.NotFound
+	}
+	return c.tx, false, nil
+}
+
+func (c *fakeReceiptClient) BlockNumber(context.Context) (uint64, error) {
+	return c.blockNumber, nil
+}
+
+// fakeReceiptClients serves the clients of several chains.
+type fakeReceiptClients map[uint64]crypto.BlockchainClient
+
+func (c fakeReceiptClients) GetClient(chainId uint64) (crypto.BlockchainClient, error) {
+	client, ok := c[chainId]
+	if !ok {
+		return nil, RiverError(Err_NOT_FOUND, "unknown chain", "chainId", chainId)
+	}
+	return client, nil
+}
+
+func TestReceiptVerifier(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	key, err := ethCrypto.GenerateKey()
+	require.NoError(t, err)
+	from := ethCrypto.PubkeyToAddress(key.PublicKey)
+	to := common.HexToAddress("0x5ace")
+	chainId := big.NewInt(1)
+
+	tx, err := ethTypes.SignTx(
+		ethTypes.NewTx(&ethTypes.DynamicFeeTx{ChainID: chainId, To: &to, Gas: 21000}),
+		ethTypes.LatestSignerForChainID(chainId),
+		key,
+	)
+	require.NoError(t, err)
+
+	chainLog := &ethTypes.Log{
+		Address: to,
+		Topics:  []common.Hash{membershipTokenIssuedTopic, common.BytesToHash(from.Bytes())},
+		Data:    []byte{1, 2, 3},
+	}
+	client := &fakeReceiptClient{
+		tx:          tx,
+		receipt:     &ethTypes.Receipt{BlockNumber: big.NewInt(100), Logs: []*ethTypes.Log{chainLog}},
+		blockNumber: 101,
+	}
+	metrics := newReceiptMetrics(infra.NewMetricsFactory(prometheus.NewRegistry(), "", ""))
+	verifier := &ReceiptVerifier{clients: client, metrics: metrics}
+	outcomes := func(outcome string) int {
+		return int(testutil.ToFloat64(metrics.outcomes.WithLabelValues(outcome)))
+	}
+
+	newReceipt := func() *BlockchainTransactionReceipt {
+		return &BlockchainTransactionReceipt{
+			ChainId:         chainId.Uint64(),
+			TransactionHash: tx.Hash().Bytes(),
+			BlockNumber:     100,
+			To:              to.Bytes(),
+			From:            from.Bytes(),
+			Logs: []*BlockchainTransactionReceipt_Log{{
+				Address: chainLog.Address.Bytes(),
+				Topics:  [][]byte{chainLog.Topics[0].Bytes(), chainLog.Topics[1].Bytes()},
+				Data:    chainLog.Data,
+			}},
+		}
+	}
+
+	verified, err := verifier.Verify(ctx, newReceipt())
+	require.NoError(t, err)
+	require.Equal(t, to, verified.To)
+	require.Equal(t, from, verified.From)
+	require.Equal(t, []*ethTypes.Log{chainLog}, verified.Logs)
+	require.Equal(t, 1, outcomes(receiptOutcomeSuccess))
+
+	for name, tc := range map[string]struct {
+		mutate  func(r *BlockchainTransactionReceipt)
+		outcome string
+	}{
+		"unknown transaction": {
+			func(r *BlockchainTransactionReceipt) { r.TransactionHash = common.Hash{1}.Bytes() },
+			receiptOutcomeNotFound,
+		},
+		"block mismatch": {func(r *BlockchainTransactionReceipt) { r.BlockNumber = 99 }, receiptOutcomeBlockMismatch},
+		"missing log":    {func(r *BlockchainTransactionReceipt) { r.Logs = nil }, receiptOutcomeLogMismatch},
+		"log data mismatch": {
+			func(r *BlockchainTransactionReceipt) { r.Logs[0].Data = []byte{3, 2, 1} },
+			receiptOutcomeLogMismatch,
+		},
+		"topic mismatch": {
+			func(r *BlockchainTransactionReceipt) { r.Logs[0].Topics[1] = common.Hash{}.Bytes() },
+			receiptOutcomeLogMismatch,
+		},
+		"to mismatch":   {func(r *BlockchainTransactionReceipt) { r.To = from.Bytes() }, receiptOutcomeAddressMismatch},
+		"from mismatch": {func(r *BlockchainTransactionReceipt) { r.From = to.Bytes() }, receiptOutcomeAddressMismatch},
+	} {
+		t.Run(name, func(t *testing.T) {
+			receipt := newReceipt()
+			tc.mutate(receipt)
+			before := outcomes(tc.outcome)
+			_, err := verifier.Verify(ctx, receipt)
+			require.Equal(t, Err_PERMISSION_DENIED, AsRiverError(err).Code)
+			require.Equal(t, before+1, outcomes(tc.outcome))
+		})
+	}
+
+	// The transaction must have at least one confirmation.
+	client.blockNumber = 100
+	_, err = verifier.Verify(ctx, newReceipt())
+	require.Equal(t, Err_PERMISSION_DENIED, AsRiverError(err).Code)
+	require.Equal(t, 1, outcomes(receiptOutcomeInsufficientConfirmations))
+
+	// Unknown chains are reported as RPC errors.
+	_, err = (&ReceiptVerifier{clients: fakeReceiptClients{}, metrics: metrics}).Verify(ctx, newReceipt())
+	require.Error(t, err)
+	require.Equal(t, 1, outcomes(receiptOutcomeRpcError))
+
+	// Confirmations are counted on the chain of the transaction, blocks of other chains don't confirm it.
+	baseChain := &fakeReceiptClient{tx: tx, blockNumber: 1000}
+	verifier = &ReceiptVerifier{clients: fakeReceiptClients{chainId.Uint64(): client, 8453: baseChain}}
+	_, err = verifier.Verify(ctx, newReceipt())
+	require.Equal(t, Err_PERMISSION_DENIED, AsRiverError(err).Code)
+
+	client.blockNumber = 101
+	_, err = verifier.Verify(ctx, newReceipt())
+	require.NoError(t, err)
+}
@@ -0,0 +1,201 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"math/big"
+	"slices"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	ethCrypto "github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/towns-protocol/towns/core/contracts/types"
+	. "github.com/towns-protocol/towns/core/node/base"
+	. "github.com/towns-protocol/towns/core/node/protocol"
+)
+
+type chainStateCtxKey struct{}
+
+// chainState is the state of the base chain the reads of the space contracts are pinned to, see atBlock.
+type chainState struct {
+	blockNum uint64
+	// at is the time the memberships are checked for expiry at.
+	at time.Time
+}
+
+// atBlock returns a context in which the space contracts are read as of blockNum, and memberships are expired
+// as of at, instead of at the latest block and now. The rules of entitlements checking other chains are still
+// evaluated at their latest block.
+func atBlock(ctx context.Context, blockNum uint64, at time.Time) context.Context {
+	return context.WithValue(ctx, chainStateCtxKey{}, chainState{blockNum: blockNum, at: at})
+}
+
+func chainStateFromCtx(ctx context.Context) (chainState, bool) {
+	state, ok := ctx.Value(chainStateCtxKey{}).(chainState)
+	return state, ok
+}
+
+// callOpts returns the options of contract calls made with ctx, pinned to the block of atBlock if any.
+func callOpts(ctx context.Context) *bind.CallOpts {
+	opts := &bind.CallOpts{Context: ctx}
+	if state, ok := chainStateFromCtx(ctx); ok {
+		opts.BlockNumber = new(big.Int).SetUint64(state.blockNum)
+	}
+	return opts
+}
+
+// blockTag returns the block parameter of raw eth_call requests made with ctx.
+func blockTag(ctx context.Context) string {
+	if state, ok := chainStateFromCtx(ctx); ok {
+		return hexutil.EncodeUint64(state.blockNum)
+	}
+	return "latest"
+}
+
+// stateTime returns the time memberships read with ctx expire at.
+func stateTime(ctx context.Context) time.Time {
+	if state, ok := chainStateFromCtx(ctx); ok {
+		return state.at
+	}
+	return time.Now()
+}
+
+// EntitlementsDigest identifies the entitlements a decision was evaluated with and the owner of the space,
+// without recording them.
+func EntitlementsDigest(entitlements []types.Entitlement, owner common.Address) common.Hash {
+	data, err := json.Marshal(struct {
+		Entitlements []types.Entitlement
+		Owner        common.Address
+	}{entitlements, owner})
+	if err != nil {
+		// Entitlements are plain data and always encode.
+		panic(err)
+	}
+	return ethCrypto.Keccak256Hash(data)
+}
+
+type DivergenceCause string
+
+const (
+	DivergenceCauseNone DivergenceCause = ""
+	// DivergenceCauseChainState means the inputs of the decision read at the recorded block differ from the
+	// recorded ones, e.g. the roles of the space were read after they changed.
+	DivergenceCauseChainState DivergenceCause = "chainState"
+	// DivergenceCauseCodeBehavior means the same inputs lead to a different decision, the node evaluates them
+	// differently than the node that recorded the decision.
+	DivergenceCauseCodeBehavior DivergenceCause = "codeBehavior"
+)
+
+const (
+	replayInputWallets      = "wallets"
+	replayInputEntitlements = "entitlements"
+)
+
+// DivergenceReport compares a replayed decision with the recorded one, see ReplayDecision.
+type DivergenceReport struct {
+	// Diverged is true if the replay decided differently or for a different reason than recorded.
+	Diverged bool            `json:"diverged"`
+	Cause    DivergenceCause `json:"cause,omitempty"`
+
+	RecordedDecision AuditDecision           `json:"recordedDecision"`
+	ReplayedDecision AuditDecision           `json:"replayedDecision"`
+	RecordedReason   EntitlementResultReason `json:"recordedReason"`
+	ReplayedReason   EntitlementResultReason `json:"replayedReason"`
+	// ChangedInputs are the inputs that differ from the recorded ones: wallets or entitlements. Inputs that
+	// were not recorded are not compared.
+	ChangedInputs []string `json:"changedInputs,omitempty"`
+}
+
+// ReplayDecision re-evaluates the decision of record with its recorded wallets, bypassing the caches and
+// reading the space contracts as of the recorded block, and reports whether, and why, the replay diverges
+// from the recorded decision. It is meant for resolving disputes of past decisions and requires an archive
+// node for blocks older than the state the base chain node keeps.
+func (ca *chainAuth) ReplayDecision(
+	ctx context.Context,
+	record AuditRecord,
+) (IsEntitledResult, DivergenceReport, error) {
+	args, err := replayArgs(record)
+	if err != nil {
+		return nil, DivergenceReport{}, AsRiverError(err).Func("ReplayDecision")
+	}
+
+	ctx = withoutCache(atBlock(ctx, record.BlockNumber, record.Timestamp))
+	result, err := ca.IsEntitled(ctx, nil, args)
+	if err != nil {
+		return nil, DivergenceReport{}, AsRiverError(err).Func("ReplayDecision").
+			Tag("blockNumber", record.BlockNumber).
+			Message("Failed to replay the decision")
+	}
+
+	report := DivergenceReport{
+		RecordedDecision: record.Decision,
+		ReplayedDecision: AuditDecisionDeny,
+		RecordedReason:   record.Reason,
+		ReplayedReason:   result.Reason(),
+	}
+	if result.IsEntitled() {
+		report.ReplayedDecision = AuditDecisionAllow
+	}
+
+	replayedDigest := DetailsOf(result).WalletSetDigest
+	if record.WalletSetDigest != (common.Hash{}) && replayedDigest != (common.Hash{}) &&
+		record.WalletSetDigest != replayedDigest {
+		report.ChangedInputs = append(report.ChangedInputs, replayInputWallets)
+	}
+	if record.EntitlementsDigest != (common.Hash{}) {
+		digest, err := ca.auditedEntitlements(ctx, args)
+		if err != nil {
+			return nil, DivergenceReport{}, AsRiverError(err).Func("ReplayDecision").
+				Tag("blockNumber", record.BlockNumber).
+				Message("Failed to read the entitlements of the decision")
+		}
+		if digest != record.EntitlementsDigest {
+			report.ChangedInputs = append(report.ChangedInputs, replayInputEntitlements)
+		}
+	}
+
+	report.Diverged = report.RecordedDecision != report.ReplayedDecision ||
+		report.RecordedReason != report.ReplayedReason
+	switch {
+	case !report.Diverged:
+		report.Cause = DivergenceCauseNone
+	case len(report.ChangedInputs) > 0:
+		report.Cause = DivergenceCauseChainState
+	default:
+		report.Cause = DivergenceCauseCodeBehavior
+	}
+	return result, report, nil
+}
+
+// replayArgs returns the arguments of the check of record.
+func replayArgs(record AuditRecord) (*ChainAuthArgs, error) {
+	if record.BlockNumber == 0 {
+		return nil, RiverError(Err_INVALID_ARGUMENT, "Audit record has no block number")
+	}
+	kind := slices.Index(chainAuthKindNames, record.Kind)
+	if kind < 0 {
+		return nil, RiverError(Err_INVALID_ARGUMENT, "Audit record has an unknown kind", "kind", record.Kind)
+	}
+
+	args := &ChainAuthArgs{
+		kind:             chainAuthKind(kind),
+		spaceId:          record.SpaceId,
+		channelId:        record.ChannelId,
+		principal:        record.Principal,
+		permission:       record.Permission,
+		customPermission: record.CustomPermission,
+		chainId:          record.ChainId,
+	}
+	if len(record.Permissions) > 0 {
+		args = args.WithPermissions(record.PermissionMode, record.Permissions...)
+	}
+	// Records whose wallets changed since the decision was cached don't hold them, the wallets are then
+	// resolved again and compared with the recorded digest.
+	if len(record.Wallets) > 0 {
+		args = args.WithPreFetchedWallets(record.Wallets)
+	}
+	return args, nil
+}
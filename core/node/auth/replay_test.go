@@ -0,0 +1,117 @@
+package auth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+
+	"github.com/towns-protocol/towns/core/contracts/types"
+	"github.com/towns-protocol/towns/core/node/base/test"
+	"github.com/towns-protocol/towns/core/node/crypto"
+	"github.com/towns-protocol/towns/core/node/shared"
+	"github.com/towns-protocol/towns/core/node/testutils"
+)
+
+// fakeBlockNumberClient serves the latest block number.
+type fakeBlockNumberClient struct {
+	crypto.BlockchainClient
+
+	blockNumber uint64
+}
+
+func (c *fakeBlockNumberClient) BlockNumber(context.Context) (uint64, error) {
+	return c.blockNumber, nil
+}
+
+// blockRecordingSpaceContract records the blocks the space entitlements are read at, 0 for the latest block.
+type blockRecordingSpaceContract struct {
+	*fakeSpaceContract
+
+	blocks []uint64
+}
+
+func (sc *blockRecordingSpaceContract) GetSpaceEntitlementsForPermission(
+	ctx context.Context,
+	spaceId shared.StreamId,
+	permission Permission,
+) ([]types.Entitlement, common.Address, error) {
+	state, _ := chainStateFromCtx(ctx)
+	sc.blocks = append(sc.blocks, state.blockNum)
+	return sc.fakeSpaceContract.GetSpaceEntitlementsForPermission(ctx, spaceId, permission)
+}
+
+func TestReplayDecision(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	alice := common.HexToAddress("0xa11ce")
+	bob := common.HexToAddress("0xb0b")
+	sc := &blockRecordingSpaceContract{fakeSpaceContract: newFakeSpaceContract(common.HexToAddress("0x0e"), alice, bob)}
+	ca := newTestChainAuth(t, ctx, sc)
+	ca.blockchain.Client = &fakeBlockNumberClient{blockNumber: 100}
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+	sink := &fakeAuditSink{}
+
+	_, err := ca.CheckEntitlementWithAuditLog(
+		ctx, nil, NewChainAuthArgsForSpace(spaceId, bob.Hex(), PermissionWrite), sink)
+	require.NoError(t, err)
+	require.Len(t, sink.records, 1)
+	record := sink.records[0]
+	require.Equal(t, uint64(100), record.BlockNumber)
+	require.Equal(t, "space", record.Kind)
+	require.Equal(t, AuditDecisionAllow, record.Decision)
+	require.NotEqual(t, common.Hash{}, record.EntitlementsDigest)
+
+	// The replay reads the space as of the recorded block and agrees with the record.
+	sc.blocks = nil
+	result, report, err := ca.ReplayDecision(ctx, record)
+	require.NoError(t, err)
+	require.True(t, result.IsEntitled())
+	require.False(t, report.Diverged)
+	require.Equal(t, DivergenceCauseNone, report.Cause)
+	require.Empty(t, report.ChangedInputs)
+	require.NotEmpty(t, sc.blocks)
+	for _, block := range sc.blocks {
+		require.Equal(t, uint64(100), block)
+	}
+
+	// Bob loses his role after the fact, and the node serves the entitlements after the change.
+	sc.entitlements = []types.Entitlement{
+		{EntitlementType: types.ModuleTypeUserEntitlement, UserEntitlement: []common.Address{alice}},
+	}
+	result, report, err = ca.ReplayDecision(ctx, record)
+	require.NoError(t, err)
+	require.False(t, result.IsEntitled())
+	require.True(t, report.Diverged)
+	require.Equal(t, DivergenceCauseChainState, report.Cause)
+	require.Equal(t, []string{replayInputEntitlements}, report.ChangedInputs)
+	require.Equal(t, AuditDecisionAllow, report.RecordedDecision)
+	require.Equal(t, AuditDecisionDeny, report.ReplayedDecision)
+	require.Equal(t, EntitlementResultReason_SPACE_ENTITLEMENTS, report.ReplayedReason)
+
+	// A record made after the change agrees with the replay, while the same inputs recorded as allowed point
+	// at a change in how the node evaluates them.
+	denied := record
+	denied.Decision = AuditDecisionDeny
+	denied.Reason = EntitlementResultReason_SPACE_ENTITLEMENTS
+	denied.EntitlementsDigest = EntitlementsDigest(sc.entitlements, sc.owner)
+	_, report, err = ca.ReplayDecision(ctx, denied)
+	require.NoError(t, err)
+	require.False(t, report.Diverged)
+
+	allowed := denied
+	allowed.Decision = AuditDecisionAllow
+	allowed.Reason = EntitlementResultReason_NONE
+	_, report, err = ca.ReplayDecision(ctx, allowed)
+	require.NoError(t, err)
+	require.True(t, report.Diverged)
+	require.Equal(t, DivergenceCauseCodeBehavior, report.Cause)
+	require.Empty(t, report.ChangedInputs)
+
+	// Records without a block can't be replayed.
+	record.BlockNumber = 0
+	_, _, err = ca.ReplayDecision(ctx, record)
+	require.Error(t, err)
+}
@@ -0,0 +1,96 @@
+package auth
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+
+	"github.com/towns-protocol/towns/core/config"
+	. "github.com/towns-protocol/towns/core/node/base"
+	"github.com/towns-protocol/towns/core/node/logging"
+	. "github.com/towns-protocol/towns/core/node/protocol"
+)
+
+const (
+	DEFAULT_CHAIN_AUTH_MAX_RETRIES     = 3
+	DEFAULT_CHAIN_AUTH_RETRY_DELAY     = 100 * time.Millisecond
+	DEFAULT_CHAIN_AUTH_MAX_RETRY_DELAY = 2 * time.Second
+)
+
+// RetryableChainAuth is a ChainAuth that retries the IsEntitled and VerifyReceipt calls of the wrapped ChainAuth
+// that fail with Err_DOWNSTREAM_NETWORK_ERROR, such as rate limited or dropped RPC calls. Other errors, e.g.
+// Err_PERMISSION_DENIED, are permanent and returned right away. The other calls are passed through as is.
+//
+// The delay before a retry doubles after each retry, up to MaxDelay, and is randomly shortened by up to half so
+// that callers that failed together don't retry together.
+type RetryableChainAuth struct {
+	ChainAuth
+
+	// MaxRetries is the number of times a failed call is retried, DEFAULT_CHAIN_AUTH_MAX_RETRIES if 0. Calls are
+	// not retried if it is negative.
+	MaxRetries int
+	// StartDelay is the delay before the first retry, DEFAULT_CHAIN_AUTH_RETRY_DELAY if 0.
+	StartDelay time.Duration
+	// MaxDelay caps the delay between two attempts, DEFAULT_CHAIN_AUTH_MAX_RETRY_DELAY if 0.
+	MaxDelay time.Duration
+}
+
+var _ ChainAuth = (*RetryableChainAuth)(nil)
+
+func (r *RetryableChainAuth) IsEntitled(
+	ctx context.Context,
+	cfg *config.Config,
+	args *ChainAuthArgs,
+) (IsEntitledResult, error) {
+	return retryChainAuth(ctx, r, "IsEntitled", func() (IsEntitledResult, error) {
+		return r.ChainAuth.IsEntitled(ctx, cfg, args)
+	})
+}
+
+func (r *RetryableChainAuth) VerifyReceipt(
+	ctx context.Context,
+	cfg *config.Config,
+	receipt *BlockchainTransactionReceipt,
+) (bool, error) {
+	return retryChainAuth(ctx, r, "VerifyReceipt", func() (bool, error) {
+		return r.ChainAuth.VerifyReceipt(ctx, cfg, receipt)
+	})
+}
+
+// retryChainAuth calls f until it succeeds, fails with an error other than Err_DOWNSTREAM_NETWORK_ERROR or the
+// retries of r are exhausted. No retry is made once the context is done or if its deadline would expire
+// before the next attempt, the last error is returned then.
+func retryChainAuth[T any](ctx context.Context, r *RetryableChainAuth, op string, f func() (T, error)) (T, error) {
+	maxRetries := r.MaxRetries
+	if maxRetries == 0 {
+		maxRetries = DEFAULT_CHAIN_AUTH_MAX_RETRIES
+	}
+	delay := r.StartDelay
+	if delay <= 0 {
+		delay = DEFAULT_CHAIN_AUTH_RETRY_DELAY
+	}
+	maxDelay := r.MaxDelay
+	if maxDelay <= 0 {
+		maxDelay = DEFAULT_CHAIN_AUTH_MAX_RETRY_DELAY
+	}
+
+	for retry := 0; ; retry++ {
+		result, err := f()
+		if err == nil || retry >= maxRetries || !IsRiverErrorCode(err, Err_DOWNSTREAM_NETWORK_ERROR) {
+			return result, err
+		}
+
+		wait := min(delay, maxDelay)
+		wait -= time.Duration(rand.Int64N(int64(wait)/2 + 1))
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return result, err
+		}
+		logging.FromCtx(ctx).Debugw("Retrying chain auth call", "op", op, "retry", retry+1, "error", err)
+		select {
+		case <-ctx.Done():
+			return result, err
+		case <-time.After(wait):
+		}
+		delay *= 2
+	}
+}
@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/towns-protocol/towns/core/config"
+	. "github.com/towns-protocol/towns/core/node/base"
+	"github.com/towns-protocol/towns/core/node/base/test"
+	. "github.com/towns-protocol/towns/core/node/protocol"
+	"github.com/towns-protocol/towns/core/node/shared"
+	"github.com/towns-protocol/towns/core/node/testutils"
+)
+
+// flakyChainAuth fails its calls with the errors in order, then allows them.
+type flakyChainAuth struct {
+	ChainAuth
+
+	errs  []error
+	calls int
+}
+
+func (f *flakyChainAuth) next() error {
+	f.calls++
+	if len(f.errs) == 0 {
+		return nil
+	}
+	err := f.errs[0]
+	f.errs = f.errs[1:]
+	return err
+}
+
+func (f *flakyChainAuth) IsEntitled(
+	ctx context.Context,
+	cfg *config.Config,
+	args *ChainAuthArgs,
+) (IsEntitledResult, error) {
+	if err := f.next(); err != nil {
+		return nil, err
+	}
+	return &isEntitledResult{isAllowed: true}, nil
+}
+
+func (f *flakyChainAuth) VerifyReceipt(
+	ctx context.Context,
+	cfg *config.Config,
+	receipt *BlockchainTransactionReceipt,
+) (bool, error) {
+	if err := f.next(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func TestRetryableChainAuth(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	args := NewChainAuthArgsForSpace(testutils.FakeStreamId(shared.STREAM_SPACE_BIN), "0xa11ce", PermissionRead)
+	networkErr := func() error { return RiverError(Err_DOWNSTREAM_NETWORK_ERROR, "rate limited") }
+
+	t.Run("transient errors are retried", func(t *testing.T) {
+		flaky := &flakyChainAuth{errs: []error{networkErr(), networkErr()}}
+		ca := &RetryableChainAuth{ChainAuth: flaky, StartDelay: time.Millisecond}
+
+		result, err := ca.IsEntitled(ctx, cfg, args)
+		require.NoError(t, err)
+		require.True(t, result.IsEntitled())
+		require.Equal(t, 3, flaky.calls)
+	})
+
+	t.Run("receipts are retried", func(t *testing.T) {
+		flaky := &flakyChainAuth{errs: []error{networkErr()}}
+		ca := &RetryableChainAuth{ChainAuth: flaky, StartDelay: time.Millisecond}
+
+		verified, err := ca.VerifyReceipt(ctx, cfg, &BlockchainTransactionReceipt{})
+		require.NoError(t, err)
+		require.True(t, verified)
+		require.Equal(t, 2, flaky.calls)
+	})
+
+	t.Run("retries are bounded", func(t *testing.T) {
+		flaky := &flakyChainAuth{errs: []error{networkErr(), networkErr(), networkErr()}}
+		ca := &RetryableChainAuth{ChainAuth: flaky, MaxRetries: 2, StartDelay: time.Millisecond}
+
+		_, err := ca.IsEntitled(ctx, cfg, args)
+		require.Equal(t, Err_DOWNSTREAM_NETWORK_ERROR, AsRiverError(err).Code)
+		require.Equal(t, 3, flaky.calls)
+	})
+
+	t.Run("permanent errors are not retried", func(t *testing.T) {
+		flaky := &flakyChainAuth{errs: []error{RiverError(Err_PERMISSION_DENIED, "denied")}}
+		ca := &RetryableChainAuth{ChainAuth: flaky, StartDelay: time.Millisecond}
+
+		_, err := ca.IsEntitled(ctx, cfg, args)
+		require.Equal(t, Err_PERMISSION_DENIED, AsRiverError(err).Code)
+		require.Equal(t, 1, flaky.calls)
+	})
+
+	t.Run("retries stop at the deadline", func(t *testing.T) {
+		flaky := &flakyChainAuth{errs: []error{networkErr(), networkErr()}}
+		ca := &RetryableChainAuth{ChainAuth: flaky, StartDelay: time.Hour, MaxDelay: time.Hour}
+		ctx, cancel := context.WithTimeout(ctx, time.Second)
+		defer cancel()
+
+		_, err := ca.IsEntitled(ctx, cfg, args)
+		require.Equal(t, Err_DOWNSTREAM_NETWORK_ERROR, AsRiverError(err).Code)
+		require.Equal(t, 1, flaky.calls)
+	})
+}
@@ -0,0 +1,123 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/towns-protocol/towns/core/config"
+	. "github.com/towns-protocol/towns/core/node/base"
+	"github.com/towns-protocol/towns/core/node/logging"
+)
+
+const (
+	DEFAULT_RPC_MAX_ATTEMPTS = 3
+	DEFAULT_RPC_RETRY_DELAY  = 100 * time.Millisecond
+	// rpcRetryMaxDelay caps the delay between two attempts.
+	rpcRetryMaxDelay = 2 * time.Second
+	// rpcErrLimitExceeded is the JSON-RPC error code providers return when a request is rate limited.
+	rpcErrLimitExceeded = -32005
+)
+
+// rpcRetryPolicy retries chain calls that fail with transient errors. The zero value makes a single attempt.
+type rpcRetryPolicy struct {
+	maxAttempts int
+	startDelay  time.Duration
+	// retries counts the retries per operation, may be nil.
+	retries *prometheus.CounterVec
+}
+
+func newRpcRetryPolicy(cfg *config.ChainConfig, retries *prometheus.CounterVec) rpcRetryPolicy {
+	policy := rpcRetryPolicy{
+		maxAttempts: DEFAULT_RPC_MAX_ATTEMPTS,
+		startDelay:  DEFAULT_RPC_RETRY_DELAY,
+		retries:     retries,
+	}
+	if cfg.EntitlementRpcMaxAttempts > 0 {
+		policy.maxAttempts = cfg.EntitlementRpcMaxAttempts
+	}
+	if cfg.EntitlementRpcRetryDelay > 0 {
+		policy.startDelay = cfg.EntitlementRpcRetryDelay
+	}
+	return policy
+}
+
+// retryRpc calls f until it succeeds, fails with an error that isn't transient or the attempts are exhausted.
+// The delay between attempts doubles after each retry. No retry is made if the context deadline would expire
+// before the next attempt, in which case the last error is returned.
+func retryRpc[T any](
+	ctx context.Context,
+	policy rpcRetryPolicy,
+	op string,
+	f func(ctx context.Context) (T, error),
+) (T, error) {
+	backoff := BackoffTracker{
+		NextDelay:   policy.startDelay,
+		MaxAttempts: max(policy.maxAttempts, 1),
+		Multiplier:  2,
+		Divisor:     1,
+	}
+	for {
+		result, err := f(ctx)
+		if err == nil || !isRetryableRpcError(ctx, err) {
+			return result, err
+		}
+
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < backoff.NextDelay {
+			return result, err
+		}
+		if waitErr := backoff.Wait(ctx, err); waitErr != nil {
+			return result, err
+		}
+		backoff.NextDelay = min(backoff.NextDelay, rpcRetryMaxDelay)
+
+		if policy.retries != nil {
+			policy.retries.WithLabelValues(op).Inc()
+		}
+		logging.FromCtx(ctx).Debugw("Retrying chain call", "op", op, "attempt", backoff.NumAttempts+1, "error", err)
+	}
+}
+
+// isRetryableRpcError returns true if err is likely to go away when the call is repeated, such as timeouts of
+// a single call, rate limits and temporarily unavailable nodes. Reverts and missing data are permanent.
+func isRetryableRpcError(ctx context.Context, err error) bool {
+	if err == nil || ctx.Err() != nil {
+		return false
+	}
+	if errors.Is(err, ethereum.NotFound) {
+		return false
+	}
+
+	var httpErr rpc.HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode == http.StatusTooManyRequests || httpErr.StatusCode >= http.StatusInternalServerError
+	}
+
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) {
+		return rpcErr.ErrorCode() == rpcErrLimitExceeded
+	}
+
+	// The context is not done, so a deadline error is the timeout of the single call.
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	return errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF)
+}
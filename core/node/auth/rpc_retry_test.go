@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/towns-protocol/towns/core/node/base"
+	"github.com/towns-protocol/towns/core/node/base/test"
+	. "github.com/towns-protocol/towns/core/node/protocol"
+)
+
+type fakeRpcError struct {
+	code int
+}
+
+func (e fakeRpcError) Error() string  { return fmt.Sprintf("rpc error %d", e.code) }
+func (e fakeRpcError) ErrorCode() int { return e.code }
+
+func TestIsRetryableRpcError(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	tests := []struct {
+		err       error
+		retryable bool
+	}{
+		{nil, false},
+		{ethereum.NotFound, false},
+		{AsRiverError(ethereum.NotFound, Err_DOWNSTREAM_NETWORK_ERROR), false},
+		{errors.New("execution reverted"), false},
+		{rpc.HTTPError{StatusCode: http.StatusTooManyRequests}, true},
+		{rpc.HTTPError{StatusCode: http.StatusBadGateway}, true},
+		{rpc.HTTPError{StatusCode: http.StatusUnauthorized}, false},
+		{fakeRpcError{code: rpcErrLimitExceeded}, true},
+		{fakeRpcError{code: 3}, false},
+		{context.DeadlineExceeded, true},
+		{AsRiverError(context.DeadlineExceeded, Err_DOWNSTREAM_NETWORK_ERROR), true},
+		{fmt.Errorf("dial: %w", syscall.ECONNREFUSED), true},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.retryable, isRetryableRpcError(ctx, tt.err), "%v", tt.err)
+	}
+
+	// Errors are permanent once the context of the caller is done.
+	canceled, cancelCanceled := context.WithCancel(ctx)
+	cancelCanceled()
+	require.False(t, isRetryableRpcError(canceled, context.DeadlineExceeded))
+}
+
+func TestRetryRpc(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	retries := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "retries"}, []string{"op"})
+	policy := rpcRetryPolicy{maxAttempts: 3, startDelay: time.Millisecond, retries: retries}
+	rateLimited := rpc.HTTPError{StatusCode: http.StatusTooManyRequests}
+
+	// failing returns a call that fails with the given errors before succeeding.
+	failing := func(calls *int, errs ...error) func(context.Context) (int, error) {
+		return func(context.Context) (int, error) {
+			*calls++
+			if *calls <= len(errs) {
+				return 0, errs[*calls-1]
+			}
+			return *calls, nil
+		}
+	}
+
+	// Transient errors are retried.
+	calls := 0
+	result, err := retryRpc(ctx, policy, "op", failing(&calls, rateLimited, rateLimited))
+	require.NoError(t, err)
+	require.Equal(t, 3, result)
+	require.Equal(t, 2.0, testutil.ToFloat64(retries.WithLabelValues("op")))
+
+	// Permanent errors are returned immediately.
+	calls = 0
+	_, err = retryRpc(ctx, policy, "op", failing(&calls, ethereum.NotFound))
+	require.ErrorIs(t, err, ethereum.NotFound)
+	require.Equal(t, 1, calls)
+
+	// The last error is returned once the attempts are exhausted.
+	calls = 0
+	_, err = retryRpc(ctx, policy, "op", failing(&calls, rateLimited, rateLimited, rateLimited))
+	require.Equal(t, rateLimited, err)
+	require.Equal(t, 3, calls)
+
+	// The zero policy makes a single attempt.
+	calls = 0
+	_, err = retryRpc(ctx, rpcRetryPolicy{}, "op", failing(&calls, rateLimited))
+	require.Equal(t, rateLimited, err)
+	require.Equal(t, 1, calls)
+
+	// No retry is made if the deadline expires before the next attempt.
+	deadlineCtx, deadlineCancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer deadlineCancel()
+	calls = 0
+	start := time.Now()
+	_, err = retryRpc(
+		deadlineCtx,
+		rpcRetryPolicy{maxAttempts: 3, startDelay: time.Second},
+		"op",
+		failing(&calls, rateLimited, rateLimited),
+	)
+	require.Equal(t, rateLimited, err)
+	require.Equal(t, 1, calls)
+	require.Less(t, time.Since(start), 50*time.Millisecond)
+}
@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/towns-protocol/towns/core/config"
+	"github.com/towns-protocol/towns/core/contracts/base"
+	"github.com/towns-protocol/towns/core/contracts/types"
+	"github.com/towns-protocol/towns/core/node/base/test"
+	"github.com/towns-protocol/towns/core/node/crypto"
+	"github.com/towns-protocol/towns/core/node/infra"
+	"github.com/towns-protocol/towns/core/node/shared"
+	"github.com/towns-protocol/towns/core/node/testutils"
+	"github.com/towns-protocol/towns/core/xchain/entitlement"
+)
+
+func TestRuleCheckFailed(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	evaluator, err := entitlement.NewEvaluatorFromConfig(
+		ctx,
+		&config.Config{},
+		&staticOnChainConfig{settings: crypto.DefaultOnChainSettings()},
+		infra.NewMetricsFactory(prometheus.NewRegistry(), "", ""),
+		nil,
+	)
+	require.NoError(t, err)
+
+	cfg := &config.Config{}
+	alice := common.HexToAddress("0xa11ce")
+	bob := common.HexToAddress("0xb0b")
+	params, err := (&types.ThresholdParams{Threshold: big.NewInt(1)}).AbiEncode()
+	require.NoError(t, err)
+	// The evaluator has no client for the chain of the rule, it can't be evaluated.
+	unreachableRule := types.Entitlement{
+		EntitlementType: types.ModuleTypeRuleEntitlementV2,
+		RuleEntitlementV2: &base.IRuleEntitlementBaseRuleDataV2{
+			Operations: []base.IRuleEntitlementBaseOperation{{OpType: uint8(types.CHECK), Index: 0}},
+			CheckOperations: []base.IRuleEntitlementBaseCheckOperationV2{{
+				OpType:          uint8(types.ERC20),
+				ChainId:         big.NewInt(424242),
+				ContractAddress: common.HexToAddress("0x20"),
+				Params:          params,
+			}},
+		},
+	}
+	spaceContract := newFakeSpaceContract(common.HexToAddress("0x0e"), alice)
+	spaceContract.entitlements = []types.Entitlement{unreachableRule}
+	ca := newTestChainAuth(t, ctx, spaceContract)
+	defer ca.Close()
+	ca.evaluator = evaluator
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+	args := NewChainAuthArgsForSpace(spaceId, alice.Hex(), PermissionWrite)
+
+	// The failed evaluation is a denial telling the check failed, not that the rule denied the user, and it
+	// is evaluated again by the next check.
+	for range 2 {
+		result, err := ca.IsEntitled(ctx, cfg, args)
+		require.NoError(t, err)
+		require.False(t, result.IsEntitled())
+		require.Equal(t, EntitlementResultReason_RULE_CHECK_FAILED, result.Reason())
+		for _, key := range ca.entitlementCache.negativeCache.Keys() {
+			val, _ := ca.entitlementCache.negativeCache.Peek(key)
+			require.NotEqual(t, EntitlementResultReason_RULE_CHECK_FAILED, val.Reason())
+		}
+	}
+
+	// Once the rule is satisfied the check is allowed and cached.
+	spaceContract.mu.Lock()
+	spaceContract.entitlements = []types.Entitlement{unreachableRule, mockRule(t, true)}
+	spaceContract.mu.Unlock()
+	ca.entitlementManagerCache.flush()
+	result, err := ca.IsEntitled(ctx, cfg, args)
+	require.NoError(t, err)
+	require.True(t, result.IsEntitled(), result.Reason())
+	result, err = ca.IsEntitled(ctx, cfg, args)
+	require.NoError(t, err)
+	require.True(t, DetailsOf(result).FromCache)
+
+	// Checks of several permissions fail rather than deny if a permission can't be checked.
+	spaceContract.mu.Lock()
+	spaceContract.entitlements = []types.Entitlement{unreachableRule}
+	spaceContract.members[bob] = true
+	spaceContract.mu.Unlock()
+	ca.entitlementManagerCache.flush()
+	result, err = ca.IsEntitled(
+		ctx,
+		cfg,
+		NewChainAuthArgsForSpace(spaceId, bob.Hex(), PermissionRead).
+			WithPermissions(RequireAny, PermissionRead, PermissionWrite),
+	)
+	require.NoError(t, err)
+	require.False(t, result.IsEntitled())
+	require.Equal(t, EntitlementResultReason_RULE_CHECK_FAILED, result.Reason())
+}
@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/towns-protocol/towns/core/config"
+	"github.com/towns-protocol/towns/core/contracts/base"
+	"github.com/towns-protocol/towns/core/contracts/types"
+	"github.com/towns-protocol/towns/core/node/base/test"
+	"github.com/towns-protocol/towns/core/node/crypto"
+	"github.com/towns-protocol/towns/core/node/infra"
+	"github.com/towns-protocol/towns/core/node/shared"
+	"github.com/towns-protocol/towns/core/node/testutils"
+	"github.com/towns-protocol/towns/core/xchain/entitlement"
+)
+
+// mockCheck is a mock check operation that passes or fails after the delay.
+func mockCheck(t *testing.T, delay time.Duration, pass bool) base.IRuleEntitlementBaseCheckOperationV2 {
+	params, err := (&types.ThresholdParams{Threshold: big.NewInt(delay.Milliseconds())}).AbiEncode()
+	require.NoError(t, err)
+	// Mock checks pass on any chain but 0.
+	chainId := big.NewInt(0)
+	if pass {
+		chainId = big.NewInt(1)
+	}
+	return base.IRuleEntitlementBaseCheckOperationV2{OpType: uint8(types.MOCK), ChainId: chainId, Params: params}
+}
+
+// logicalRule returns the rule combining the checks from left to right with op.
+func logicalRule(
+	op types.LogicalOperationType,
+	checks ...base.IRuleEntitlementBaseCheckOperationV2,
+) types.Entitlement {
+	rule := &base.IRuleEntitlementBaseRuleDataV2{CheckOperations: checks}
+	for i := range checks {
+		rule.Operations = append(rule.Operations, base.IRuleEntitlementBaseOperation{
+			OpType: uint8(types.CHECK),
+			Index:  uint8(i),
+		})
+		if i > 0 {
+			rule.Operations = append(rule.Operations, base.IRuleEntitlementBaseOperation{
+				OpType: uint8(types.LOGICAL),
+				Index:  uint8(len(rule.LogicalOperations)),
+			})
+			rule.LogicalOperations = append(rule.LogicalOperations, base.IRuleEntitlementBaseLogicalOperation{
+				LogOpType:           uint8(op),
+				LeftOperationIndex:  uint8(len(rule.Operations) - 3),
+				RightOperationIndex: uint8(len(rule.Operations) - 2),
+			})
+		}
+	}
+	return types.Entitlement{EntitlementType: types.ModuleTypeRuleEntitlementV2, RuleEntitlementV2: rule}
+}
+
+func TestRuleShortCircuit(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	evaluator, err := entitlement.NewEvaluatorFromConfig(
+		ctx,
+		&config.Config{},
+		&staticOnChainConfig{settings: crypto.DefaultOnChainSettings()},
+		infra.NewMetricsFactory(prometheus.NewRegistry(), "", ""),
+		nil,
+	)
+	require.NoError(t, err)
+
+	cfg := &config.Config{}
+	alice := common.HexToAddress("0xa11ce")
+	const slow = 5 * time.Second
+	for _, tc := range []struct {
+		name     string
+		rule     types.Entitlement
+		entitled bool
+		minTime  time.Duration
+	}{
+		{
+			"and, first child false",
+			logicalRule(types.AND, mockCheck(t, 0, false), mockCheck(t, slow, true)),
+			false,
+			0,
+		},
+		{
+			"and of three, first child false",
+			logicalRule(types.AND, mockCheck(t, 0, false), mockCheck(t, slow, true), mockCheck(t, slow, true)),
+			false,
+			0,
+		},
+		{
+			"or, first child true",
+			logicalRule(types.OR, mockCheck(t, 0, true), mockCheck(t, slow, false)),
+			true,
+			0,
+		},
+		// Children that don't decide the outcome wait for the others.
+		{
+			"and, first child true",
+			logicalRule(types.AND, mockCheck(t, 0, true), mockCheck(t, 100*time.Millisecond, true)),
+			true,
+			100 * time.Millisecond,
+		},
+		{
+			"or, first child false",
+			logicalRule(types.OR, mockCheck(t, 0, false), mockCheck(t, 100*time.Millisecond, false)),
+			false,
+			100 * time.Millisecond,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			spaceContract := newFakeSpaceContract(common.HexToAddress("0x0e"), alice)
+			spaceContract.entitlements = []types.Entitlement{tc.rule}
+			ca := newTestChainAuth(t, ctx, spaceContract)
+			defer ca.Close()
+			ca.evaluator = evaluator
+			spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+
+			// The slow child is canceled once the first one decides the outcome.
+			start := time.Now()
+			result, err := ca.IsEntitled(ctx, cfg, NewChainAuthArgsForSpace(spaceId, alice.Hex(), PermissionWrite))
+			elapsed := time.Since(start)
+			require.NoError(t, err)
+			require.Equal(t, tc.entitled, result.IsEntitled())
+			if !tc.entitled {
+				require.Equal(t, EntitlementResultReason_SPACE_ENTITLEMENTS, result.Reason())
+			}
+			require.GreaterOrEqual(t, elapsed, tc.minTime)
+			require.Less(t, elapsed, slow/2)
+		})
+	}
+}
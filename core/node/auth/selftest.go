@@ -0,0 +1,180 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+
+	. "github.com/towns-protocol/towns/core/node/base"
+	"github.com/towns-protocol/towns/core/node/crypto"
+	. "github.com/towns-protocol/towns/core/node/protocol"
+	"github.com/towns-protocol/towns/core/node/shared"
+)
+
+const DEFAULT_SELF_TEST_TIMEOUT = 5 * time.Second
+
+// SelfTestResult is the outcome of a single probe of the auth self-test.
+type SelfTestResult struct {
+	Component string        `json:"component"`
+	Passed    bool          `json:"passed"`
+	Skipped   bool          `json:"skipped,omitempty"`
+	Error     string        `json:"error,omitempty"`
+	Duration  time.Duration `json:"duration"`
+}
+
+// SelfTestReport is the outcome of the auth self-test. Passed is true if none of the probes failed.
+type SelfTestReport struct {
+	Passed  bool             `json:"passed"`
+	Results []SelfTestResult `json:"results"`
+}
+
+// SelfTester is implemented by ChainAuth implementations that can probe their dependencies.
+type SelfTester interface {
+	// SelfTest probes the contracts, chains and caches used to evaluate entitlements and reports the outcome
+	// per component. An error is returned only if the self-test could not run to completion.
+	SelfTest(ctx context.Context) (SelfTestReport, error)
+}
+
+var _ SelfTester = (*chainAuth)(nil)
+
+// xchainClients is implemented by entitlement.Evaluator.
+type xchainClients interface {
+	ChainIds() []uint64
+	GetClient(chainId uint64) (crypto.BlockchainClient, error)
+}
+
+type selfTestCache struct {
+	name  string
+	cache *entitlementCache
+}
+
+// errSelfTestSkipped is returned by probes of components that are not configured.
+var errSelfTestSkipped = errors.New("not configured")
+
+// selfTester probes the dependencies of chainAuth. Contracts and chains are called directly, so the
+// self-test neither reads nor populates the entitlement caches.
+type selfTester struct {
+	baseChain      ethereum.BlockNumberReader
+	spaceContract  SpaceContract
+	walletResolver *WalletResolver
+	// xchainClients is nil if cross-chain entitlements are not configured.
+	xchainClients xchainClients
+	caches        []selfTestCache
+	canarySpaceId string
+	timeout       time.Duration
+}
+
+func (t *selfTester) run(ctx context.Context) (SelfTestReport, error) {
+	report := SelfTestReport{Passed: true}
+
+	probe := func(component string, f func(ctx context.Context) error) {
+		ctx, cancel := context.WithTimeout(ctx, t.timeout)
+		defer cancel()
+
+		start := time.Now()
+		err := f(ctx)
+		result := SelfTestResult{Component: component, Passed: err == nil, Duration: time.Since(start)}
+		if errors.Is(err, errSelfTestSkipped) {
+			result.Passed = true
+			result.Skipped = true
+		}
+		if err != nil {
+			result.Error = err.Error()
+		}
+		if !result.Passed {
+			report.Passed = false
+		}
+		report.Results = append(report.Results, result)
+	}
+
+	probe("base_chain", t.probeBaseChain)
+	probe("wallet_link", t.probeWalletLink)
+	probe("canary_space", t.probeCanarySpace)
+	if t.xchainClients != nil {
+		for _, chainId := range t.xchainClients.ChainIds() {
+			probe(fmt.Sprintf("xchain_client/%d", chainId), func(ctx context.Context) error {
+				return t.probeXChainClient(ctx, chainId)
+			})
+		}
+	}
+	for _, c := range t.caches {
+		probe("cache/"+c.name, func(context.Context) error {
+			return c.cache.selfTest()
+		})
+	}
+
+	if err := ctx.Err(); err != nil {
+		return report, AsRiverError(err).Func("SelfTest")
+	}
+	return report, nil
+}
+
+func (t *selfTester) probeBaseChain(ctx context.Context) error {
+	if t.baseChain == nil {
+		return errSelfTestSkipped
+	}
+	_, err := t.baseChain.BlockNumber(ctx)
+	return err
+}
+
+func (t *selfTester) probeWalletLink(ctx context.Context) error {
+	if !t.walletResolver.hasWalletLink() {
+		return RiverError(Err_BAD_CONFIG, "Wallet link contract is not configured")
+	}
+	_, err := t.walletResolver.RootKey(ctx, common.Address{})
+	return err
+}
+
+func (t *selfTester) probeCanarySpace(ctx context.Context) error {
+	if t.canarySpaceId == "" {
+		return errSelfTestSkipped
+	}
+	spaceId, err := shared.StreamIdFromString(t.canarySpaceId)
+	if err != nil {
+		return err
+	}
+	if _, err := t.spaceContract.IsSpaceDisabled(ctx, spaceId); err != nil {
+		return err
+	}
+	_, _, err = t.spaceContract.GetSpaceEntitlementsForPermission(ctx, spaceId, PermissionRead)
+	return err
+}
+
+func (t *selfTester) probeXChainClient(ctx context.Context, chainId uint64) error {
+	client, err := t.xchainClients.GetClient(chainId)
+	if err != nil {
+		return err
+	}
+	_, err = client.BlockNumber(ctx)
+	return err
+}
+
+// selfTest checks that an entry can be stored in and read back from the cache. The entry is stored under
+// a random principal that no check uses and is removed before returning.
+func (ec *entitlementCache) selfTest() error {
+	key := ChainAuthArgs{kind: chainAuthKindSpace}
+	if _, err := rand.Read(key.principal[:]); err != nil {
+		return err
+	}
+	val := &timestampedCacheValue{result: boolCacheResult{isAllowed: true}, timestamp: time.Now()}
+
+	ec.positiveCache.Add(key, val)
+	defer ec.positiveCache.Remove(key)
+
+	if cached, ok := ec.positiveCache.Peek(key); !ok || cached != val {
+		return RiverError(Err_INTERNAL, "Entry stored in the cache could not be read back")
+	}
+	return nil
+}
+
+func (ca *chainAuth) SelfTest(ctx context.Context) (SelfTestReport, error) {
+	if ca.closeCtx.Err() != nil {
+		return SelfTestReport{}, RiverError(Err_UNAVAILABLE, "Chain auth is closed").Func("SelfTest")
+	}
+	return ca.selfTester.run(ctx)
+}
@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+
+	"github.com/towns-protocol/towns/core/config"
+	"github.com/towns-protocol/towns/core/contracts/base"
+	. "github.com/towns-protocol/towns/core/node/base"
+	"github.com/towns-protocol/towns/core/node/base/test"
+	"github.com/towns-protocol/towns/core/node/crypto"
+	. "github.com/towns-protocol/towns/core/node/protocol"
+	"github.com/towns-protocol/towns/core/node/shared"
+	"github.com/towns-protocol/towns/core/node/testutils"
+)
+
+// fakeSelfTestClient is a chain client whose BlockNumber fails with err, or blocks until the context is
+// done if hang is set.
+type fakeSelfTestClient struct {
+	crypto.BlockchainClient
+
+	err  error
+	hang bool
+}
+
+func (c *fakeSelfTestClient) BlockNumber(ctx context.Context) (uint64, error) {
+	if c.hang {
+		<-ctx.Done()
+		return 0, ctx.Err()
+	}
+	return 1, c.err
+}
+
+type fakeXChainClients map[uint64]*fakeSelfTestClient
+
+func (c fakeXChainClients) ChainIds() []uint64 {
+	return []uint64{1, 10, 137}
+}
+
+func (c fakeXChainClients) GetClient(chainId uint64) (crypto.BlockchainClient, error) {
+	client, ok := c[chainId]
+	if !ok {
+		return nil, RiverError(Err_NOT_FOUND, "Unsupported chain").Tag("chainID", chainId)
+	}
+	return client, nil
+}
+
+func TestSelfTest(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	spaceContract := newFakeSpaceContract(common.HexToAddress("0x0e"))
+	cache, err := newEntitlementCache(ctx, &config.ChainConfig{}, nil)
+	require.NoError(t, err)
+
+	walletLink, err := base.NewWalletLink(
+		common.HexToAddress("0xabc"),
+		&fakeWalletLinkBackend{t: t, rootKeys: map[common.Address]common.Address{}},
+	)
+	require.NoError(t, err)
+
+	tester := &selfTester{
+		baseChain:      &fakeSelfTestClient{},
+		spaceContract:  spaceContract,
+		walletResolver: &WalletResolver{walletLink: walletLink},
+		xchainClients: fakeXChainClients{
+			1:   {},
+			137: {hang: true},
+		},
+		caches:        []selfTestCache{{"entitlement", cache}},
+		canarySpaceId: testutils.FakeStreamId(shared.STREAM_SPACE_BIN).String(),
+		timeout:       100 * time.Millisecond,
+	}
+
+	// The xchain client of chain 10 is missing and the one of chain 137 doesn't respond.
+	report, err := tester.run(ctx)
+	require.NoError(t, err)
+	require.False(t, report.Passed)
+
+	failed := map[string]bool{}
+	for _, result := range report.Results {
+		require.False(t, result.Skipped, result.Component)
+		if !result.Passed {
+			require.NotEmpty(t, result.Error, result.Component)
+			failed[result.Component] = true
+		}
+	}
+	require.Len(t, report.Results, 7)
+	require.Equal(t, map[string]bool{"xchain_client/10": true, "xchain_client/137": true}, failed)
+
+	// The space probe reads the contract directly and the cache probe doesn't leave entries behind.
+	require.Equal(t, 1, spaceContract.callCount("GetSpaceEntitlementsForPermission"))
+	require.Zero(t, cache.positiveCache.Len())
+	require.Zero(t, cache.negativeCache.Len())
+
+	// Failures of the base chain and the missing wallet link are reported, unconfigured components are skipped.
+	tester.baseChain = &fakeSelfTestClient{err: errors.New("connection refused")}
+	tester.walletResolver = NewWalletResolver(nil, nil, WalletResolverMetrics{})
+	tester.xchainClients = nil
+	tester.canarySpaceId = ""
+
+	report, err = tester.run(ctx)
+	require.NoError(t, err)
+	require.False(t, report.Passed)
+	require.Len(t, report.Results, 4)
+
+	require.Equal(t, "base_chain", report.Results[0].Component)
+	require.False(t, report.Results[0].Passed)
+	require.Equal(t, "connection refused", report.Results[0].Error)
+	require.Equal(t, "wallet_link", report.Results[1].Component)
+	require.False(t, report.Results[1].Passed)
+	require.Equal(t, "canary_space", report.Results[2].Component)
+	require.True(t, report.Results[2].Passed)
+	require.True(t, report.Results[2].Skipped)
+	require.Equal(t, "cache/entitlement", report.Results[3].Component)
+	require.True(t, report.Results[3].Passed)
+
+	// Everything configured and reachable passes.
+	tester.baseChain = &fakeSelfTestClient{}
+	tester.walletResolver = &WalletResolver{walletLink: walletLink}
+	tester.xchainClients = fakeXChainClients{1: {}, 10: {}, 137: {}}
+
+	report, err = tester.run(ctx)
+	require.NoError(t, err)
+	require.True(t, report.Passed, report)
+}
@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/ethereum/go-ethereum/common"
+	"golang.org/x/sync/semaphore"
+
+	"github.com/towns-protocol/towns/core/config"
+	. "github.com/towns-protocol/towns/core/node/base"
+	. "github.com/towns-protocol/towns/core/node/protocol"
+)
+
+// DEFAULT_ENTITLEMENT_SIMULATION_CONCURRENCY is the default number of wallet set simulations run at once.
+const DEFAULT_ENTITLEMENT_SIMULATION_CONCURRENCY = 2
+
+// WalletSetSimulator evaluates entitlement checks against hypothetical sets of linked wallets, e.g. to tell
+// whether a user would still be entitled after unlinking a wallet without the user unlinking it.
+type WalletSetSimulator interface {
+	// SimulateWalletSet evaluates the check of args as if wallets were the linked wallets of its principal.
+	SimulateWalletSet(
+		ctx context.Context,
+		cfg *config.Config,
+		args *ChainAuthArgs,
+		wallets []common.Address,
+	) (IsEntitledResult, error)
+}
+
+var _ WalletSetSimulator = (*chainAuth)(nil)
+
+// MembershipPreviewer evaluates entitlement checks as if their principal were a member of the space, e.g. to show
+// a user what joining a space would unlock.
+type MembershipPreviewer interface {
+	// CheckEntitlementIgnoringMembership evaluates the space or channel check of args without requiring the
+	// principal to be a member of the space.
+	CheckEntitlementIgnoringMembership(
+		ctx context.Context,
+		cfg *config.Config,
+		args *ChainAuthArgs,
+	) (IsEntitledResult, error)
+}
+
+var _ MembershipPreviewer = (*chainAuth)(nil)
+
+func newSimulations(cfg *config.ChainConfig) *semaphore.Weighted {
+	concurrency := DEFAULT_ENTITLEMENT_SIMULATION_CONCURRENCY
+	if cfg.EntitlementSimulationConcurrency > 0 {
+		concurrency = cfg.EntitlementSimulationConcurrency
+	}
+	return semaphore.NewWeighted(int64(concurrency))
+}
+
+// SimulateWalletSet runs the full evaluation of the check of args, the membership, ban and entitlement checks,
+// against wallets instead of the linked wallets of the principal. The caches are neither read nor updated, so
+// every simulation reads the chain. Simulations over the concurrency limit are refused with
+// Err_RESOURCE_EXHAUSTED, and the wallets are subject to the linked wallets limit.
+func (ca *chainAuth) SimulateWalletSet(
+	ctx context.Context,
+	cfg *config.Config,
+	args *ChainAuthArgs,
+	wallets []common.Address,
+) (IsEntitledResult, error) {
+	if !ca.simulations.TryAcquire(1) {
+		return nil, RiverError(Err_RESOURCE_EXHAUSTED, "Too many concurrent wallet set simulations").
+			Func("SimulateWalletSet")
+	}
+	defer ca.simulations.Release(1)
+
+	result, err := ca.IsEntitled(withoutCache(ctx), cfg, args.WithPreFetchedWallets(wallets))
+	if err != nil {
+		return nil, AsRiverError(err).Func("SimulateWalletSet")
+	}
+	return result, nil
+}
+
+type ignoreMembershipCtxKey struct{}
+
+// withoutMembership returns a context in which checks skip the membership check of the principal.
+func withoutMembership(ctx context.Context) context.Context {
+	return context.WithValue(ctx, ignoreMembershipCtxKey{}, true)
+}
+
+func isMembershipIgnored(ctx context.Context) bool {
+	ignored, _ := ctx.Value(ignoreMembershipCtxKey{}).(bool)
+	return ignored
+}
+
+// CheckEntitlementIgnoringMembership runs the evaluation of the space or channel check of args, the owner, ban
+// and entitlement checks, without the membership check. Like wallet set simulations, the caches are neither read
+// nor updated, so results computed for non-members are never served to regular checks, and previews share the
+// concurrency limit of the simulations.
+func (ca *chainAuth) CheckEntitlementIgnoringMembership(
+	ctx context.Context,
+	cfg *config.Config,
+	args *ChainAuthArgs,
+) (IsEntitledResult, error) {
+	if args.kind != chainAuthKindSpace && args.kind != chainAuthKindChannel {
+		return nil, RiverError(Err_INVALID_ARGUMENT, "Only space and channel checks can ignore membership").
+			Func("CheckEntitlementIgnoringMembership").
+			Tag("kind", args.kind)
+	}
+	if !ca.simulations.TryAcquire(1) {
+		return nil, RiverError(Err_RESOURCE_EXHAUSTED, "Too many concurrent entitlement previews").
+			Func("CheckEntitlementIgnoringMembership")
+	}
+	defer ca.simulations.Release(1)
+
+	result, err := ca.IsEntitled(withoutMembership(withoutCache(ctx)), cfg, args)
+	if err != nil {
+		return nil, AsRiverError(err).Func("CheckEntitlementIgnoringMembership")
+	}
+	return result, nil
+}
@@ -0,0 +1,140 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+
+	"github.com/towns-protocol/towns/core/config"
+	. "github.com/towns-protocol/towns/core/node/base"
+	"github.com/towns-protocol/towns/core/node/base/test"
+	. "github.com/towns-protocol/towns/core/node/protocol"
+	"github.com/towns-protocol/towns/core/node/shared"
+	"github.com/towns-protocol/towns/core/node/testutils"
+)
+
+func TestSimulateWalletSet(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	principal := common.HexToAddress("0x9a")
+	// The member wallet holds the membership, the entitled wallet is the only one that satisfies the
+	// entitlements of the space.
+	member := common.HexToAddress("0xe0")
+	entitled := common.HexToAddress("0xe1")
+	spaceContract := newFakeSpaceContract(common.HexToAddress("0x0e"), entitled)
+	spaceContract.members[member] = true
+	delete(spaceContract.members, entitled)
+	ca := newTestChainAuth(t, ctx, spaceContract)
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+	args := NewChainAuthArgsForSpace(spaceId, principal.Hex(), PermissionWrite)
+
+	for _, tc := range []struct {
+		name    string
+		wallets []common.Address
+		allowed bool
+		reason  EntitlementResultReason
+	}{
+		{"all wallets", []common.Address{principal, member, entitled}, true, EntitlementResultReason_NONE},
+		{"without member", []common.Address{principal, entitled}, false, EntitlementResultReason_MEMBERSHIP},
+		{
+			"without entitled",
+			[]common.Address{principal, member},
+			false,
+			EntitlementResultReason_SPACE_ENTITLEMENTS,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := ca.SimulateWalletSet(ctx, cfg, args, tc.wallets)
+			require.NoError(t, err)
+			require.Equal(t, tc.allowed, result.IsEntitled())
+			require.Equal(t, tc.reason, result.Reason())
+			require.False(t, DetailsOf(result).FromCache)
+			if tc.allowed {
+				require.Equal(t, entitled, DetailsOf(result).SatisfiedBy)
+			}
+		})
+	}
+
+	// Simulations never read or populate the caches.
+	for _, ec := range []*entitlementCache{
+		ca.entitlementCache,
+		ca.membershipCache,
+		ca.entitlementManagerCache,
+		ca.linkedWalletCache,
+	} {
+		require.Zero(t, ec.positiveCache.Len())
+		require.Zero(t, ec.negativeCache.Len())
+	}
+
+	// Simulations over the concurrency limit are refused.
+	require.True(t, ca.simulations.TryAcquire(DEFAULT_ENTITLEMENT_SIMULATION_CONCURRENCY))
+	_, err := ca.SimulateWalletSet(ctx, cfg, args, []common.Address{principal, member, entitled})
+	require.Equal(t, Err_RESOURCE_EXHAUSTED, AsRiverError(err).Code)
+	ca.simulations.Release(DEFAULT_ENTITLEMENT_SIMULATION_CONCURRENCY)
+
+	_, err = ca.SimulateWalletSet(ctx, cfg, args, []common.Address{principal, member, entitled})
+	require.NoError(t, err)
+}
+
+func TestCheckEntitlementIgnoringMembership(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	alice := common.HexToAddress("0xa11ce")
+	bob := common.HexToAddress("0xb0b")
+	carol := common.HexToAddress("0xca201")
+	spaceContract := newFakeSpaceContract(common.HexToAddress("0x0e"), alice, carol)
+	delete(spaceContract.members, alice)
+	delete(spaceContract.members, carol)
+	spaceContract.banned[carol] = true
+	ca := newTestChainAuth(t, ctx, spaceContract)
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+	channelId := testutils.MakeChannelId(spaceId)
+
+	result, err := ca.IsEntitled(ctx, cfg, NewChainAuthArgsForSpace(spaceId, alice.Hex(), PermissionWrite))
+	require.NoError(t, err)
+	require.Equal(t, EntitlementResultReason_MEMBERSHIP, result.Reason())
+
+	for _, tc := range []struct {
+		name    string
+		args    *ChainAuthArgs
+		allowed bool
+		reason  EntitlementResultReason
+	}{
+		{"entitled", NewChainAuthArgsForSpace(spaceId, alice.Hex(), PermissionWrite), true, EntitlementResultReason_NONE},
+		{
+			"entitled in channel",
+			NewChainAuthArgsForChannel(spaceId, channelId, alice.Hex(), PermissionWrite),
+			true,
+			EntitlementResultReason_NONE,
+		},
+		{
+			"not entitled",
+			NewChainAuthArgsForSpace(spaceId, bob.Hex(), PermissionWrite),
+			false,
+			EntitlementResultReason_SPACE_ENTITLEMENTS,
+		},
+		{"banned", NewChainAuthArgsForSpace(spaceId, carol.Hex(), PermissionWrite), false, EntitlementResultReason_BANNED},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := ca.CheckEntitlementIgnoringMembership(ctx, cfg, tc.args)
+			require.NoError(t, err)
+			require.Equal(t, tc.allowed, result.IsEntitled())
+			require.Equal(t, tc.reason, result.Reason())
+			require.False(t, DetailsOf(result).FromCache)
+		})
+	}
+
+	// Previews don't change the results of regular checks.
+	result, err = ca.IsEntitled(ctx, cfg, NewChainAuthArgsForSpace(spaceId, alice.Hex(), PermissionWrite))
+	require.NoError(t, err)
+	require.Equal(t, EntitlementResultReason_MEMBERSHIP, result.Reason())
+
+	// Membership checks can't ignore membership.
+	_, err = ca.CheckEntitlementIgnoringMembership(ctx, cfg, NewChainAuthArgsForIsSpaceMember(spaceId, alice.Hex()))
+	require.Equal(t, Err_INVALID_ARGUMENT, AsRiverError(err).Code)
+}
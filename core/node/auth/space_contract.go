@@ -2,15 +2,27 @@ package auth
 
 import (
 	"context"
+	"errors"
 	"math/big"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 
+	. "github.com/towns-protocol/towns/core/node/base"
+	. "github.com/towns-protocol/towns/core/node/protocol"
 	"github.com/towns-protocol/towns/core/node/shared"
 
 	"github.com/towns-protocol/towns/core/contracts/types"
 )
 
+// ErrMembershipBatchUnsupported is returned by SpaceContract.GetMembershipStatusBatch if the backend can't
+// batch calls.
+var ErrMembershipBatchUnsupported = errors.New("membership batch calls are not supported by the backend")
+
+// ErrNoMoreSpaceMembers is returned by SpaceContract.ListSpaceMembers for the pages past the last membership
+// token of the space.
+var ErrNoMoreSpaceMembers = errors.New("no more space members")
+
 // MembershipStatus represents the membership status of a user
 type MembershipStatus struct {
 	IsMember   bool      // Whether the user is a member (has at least one token)
@@ -20,8 +32,46 @@ type MembershipStatus struct {
 	ExpiredAt  *big.Int  // When membership expired (if all tokens are expired, this is the most recent expiry)
 }
 
+// clone returns a copy of the status that doesn't share the token ids or expiry times with it.
+func (s *MembershipStatus) clone() *MembershipStatus {
+	ret := *s
+	ret.TokenIds = make([]*big.Int, len(s.TokenIds))
+	for i, tokenId := range s.TokenIds {
+		ret.TokenIds[i] = cloneBigInt(tokenId)
+	}
+	ret.ExpiryTime = cloneBigInt(s.ExpiryTime)
+	ret.ExpiredAt = cloneBigInt(s.ExpiredAt)
+	return &ret
+}
+
+// membershipExpiry returns when the membership of the status expires, or when it expired if it is expired. The
+// zero time is returned for memberships that never expire or whose expiry time couldn't be read. It fails with
+// Err_NOT_FOUND if the user holds no membership token.
+func membershipExpiry(status *MembershipStatus) (time.Time, error) {
+	if !status.IsMember {
+		return time.Time{}, RiverError(Err_NOT_FOUND, "No membership in the space")
+	}
+	if status.ExpiryTime != nil && status.ExpiryTime.Sign() != 0 {
+		return time.Unix(status.ExpiryTime.Int64(), 0), nil
+	}
+	if status.IsExpired && status.ExpiredAt != nil {
+		return time.Unix(status.ExpiredAt.Int64(), 0), nil
+	}
+	return time.Time{}, nil
+}
+
+func cloneBigInt(i *big.Int) *big.Int {
+	if i == nil {
+		return nil
+	}
+	return new(big.Int).Set(i)
+}
+
 type SpaceContract interface {
+	// IsSpaceDisabled returns whether the space is disabled, or an Err_NOT_FOUND error if the space doesn't exist.
 	IsSpaceDisabled(ctx context.Context, spaceId shared.StreamId) (bool, error)
+	// IsChannelDisabled returns whether the channel is disabled, or an Err_NOT_FOUND error if the space of the
+	// channel doesn't exist.
 	IsChannelDisabled(
 		ctx context.Context,
 		spaceId shared.StreamId,
@@ -51,6 +101,21 @@ type SpaceContract interface {
 		channelId shared.StreamId,
 		permission Permission,
 	) ([]types.Entitlement, common.Address, error)
+	// GetSpaceEntitlementsForCustomPermission is GetSpaceEntitlementsForPermission for an app-defined
+	// permission name. Names the space doesn't know have no entitlements.
+	GetSpaceEntitlementsForCustomPermission(
+		ctx context.Context,
+		spaceId shared.StreamId,
+		permissionName string,
+	) ([]types.Entitlement, common.Address, error)
+	// GetChannelEntitlementsForCustomPermission is GetChannelEntitlementsForPermission for an app-defined
+	// permission name. Names the channel doesn't know have no entitlements.
+	GetChannelEntitlementsForCustomPermission(
+		ctx context.Context,
+		spaceId shared.StreamId,
+		channelId shared.StreamId,
+		permissionName string,
+	) ([]types.Entitlement, common.Address, error)
 	IsMember(
 		ctx context.Context,
 		spaceId shared.StreamId,
@@ -61,11 +126,48 @@ type SpaceContract interface {
 		spaceId shared.StreamId,
 		user common.Address,
 	) (*MembershipStatus, error)
+	// GetMembershipExpiry returns when the membership of the wallet in the space expires, see membershipExpiry.
+	GetMembershipExpiry(
+		ctx context.Context,
+		spaceId shared.StreamId,
+		wallet common.Address,
+	) (time.Time, error)
+	// GetMembershipStatusBatch returns the membership statuses of the wallets in the space, in the order of
+	// the wallets, in fewer round trips than one GetMembershipStatus call per wallet. It returns
+	// ErrMembershipBatchUnsupported if the backend can't batch calls, the wallets are checked one by one then.
+	GetMembershipStatusBatch(
+		ctx context.Context,
+		spaceId shared.StreamId,
+		wallets []common.Address,
+	) ([]*MembershipStatus, error)
+	// IsAppEntitled returns whether the app is installed in the space and, if it is, whether it is granted the
+	// permission. Apps act under their own address, they hold no membership and have no linked wallets.
+	IsAppEntitled(
+		ctx context.Context,
+		spaceId shared.StreamId,
+		app common.Address,
+		permission Permission,
+	) (installed bool, entitled bool, err error)
 	IsBanned(
 		ctx context.Context,
 		spaceId shared.StreamId,
 		linkedWallets []common.Address,
 	) (bool, error)
+	// ListSpaceMembers returns the owners of the page-th page of pageSize membership tokens of the space by token
+	// id, including the owners of expired memberships, without duplicates within the page. Members holding
+	// several tokens may be listed in several pages, and pages may hold fewer members than pageSize, or none,
+	// if tokens were burned. ErrNoMoreSpaceMembers is returned for the pages past the last token.
+	ListSpaceMembers(
+		ctx context.Context,
+		spaceId shared.StreamId,
+		page int,
+		pageSize int,
+	) ([]common.Address, error)
+	// GetBannedWallets returns the wallets banned from the space, without duplicates.
+	GetBannedWallets(
+		ctx context.Context,
+		spaceId shared.StreamId,
+	) ([]common.Address, error)
 	GetRoles(
 		ctx context.Context,
 		spaceId shared.StreamId,
@@ -2,19 +2,25 @@ package auth
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math/big"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/accounts/abi/bind"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
 
 	"github.com/towns-protocol/towns/core/config"
 	"github.com/towns-protocol/towns/core/contracts/base"
 	"github.com/towns-protocol/towns/core/contracts/types"
 	. "github.com/towns-protocol/towns/core/node/base"
 	"github.com/towns-protocol/towns/core/node/logging"
+	. "github.com/towns-protocol/towns/core/node/protocol"
 	"github.com/towns-protocol/towns/core/node/shared"
 	"github.com/towns-protocol/towns/core/xchain/bindings/ierc5313"
 )
@@ -39,6 +45,12 @@ type SpaceContractV3 struct {
 
 var EMPTY_ADDRESS = common.Address{}
 
+// isContractRevert returns true if err is the revert of a contract call rather than a failure of the call.
+func isContractRevert(err error) bool {
+	var dataErr rpc.DataError
+	return errors.As(err, &dataErr)
+}
+
 func NewSpaceContractV3(
 	ctx context.Context,
 	architectCfg *config.ContractConfig,
@@ -69,7 +81,7 @@ func (sc *SpaceContractV3) GetChannels(
 	if err != nil {
 		return nil, err
 	}
-	contractChannels, err := space.channels.GetChannels(nil)
+	contractChannels, err := space.channels.GetChannels(callOpts(ctx))
 	if err != nil {
 		return nil, err
 	}
@@ -98,7 +110,7 @@ func (sc *SpaceContractV3) GetRoles(
 		return nil, err
 	}
 
-	iRoleBaseRoles, err := space.rolesContract.GetRoles(nil)
+	iRoleBaseRoles, err := space.rolesContract.GetRoles(callOpts(ctx))
 	if err != nil {
 		return nil, err
 	}
@@ -117,7 +129,7 @@ func (sc *SpaceContractV3) GetRoles(
 				iEntitlementCache[entitlement] = iEntitlement
 			}
 			iEntitlement := iEntitlementCache[entitlement]
-			entitlementType, err := iEntitlement.ModuleType(nil)
+			entitlementType, err := iEntitlement.ModuleType(callOpts(ctx))
 			if err != nil {
 				return nil, fmt.Errorf(
 					"error fetching entitlement type for IEntitlement @ address %v: %w",
@@ -125,7 +137,7 @@ func (sc *SpaceContractV3) GetRoles(
 					err,
 				)
 			}
-			entitlementData, err := iEntitlement.GetEntitlementDataByRoleId(nil, iRoleBaseRole.Id)
+			entitlementData, err := iEntitlement.GetEntitlementDataByRoleId(callOpts(ctx), iRoleBaseRole.Id)
 			if err != nil {
 				return nil, fmt.Errorf(
 					"error fetching entitlement data for role %v from IEntitlement @ address %v: %w",
@@ -139,6 +151,15 @@ func (sc *SpaceContractV3) GetRoles(
 				EntitlementData: entitlementData,
 			}
 			marshalledEntitlement, err := types.MarshalEntitlement(ctx, rawEntitlement)
+			if errors.Is(err, types.ErrUndecodableEntitlement) {
+				logging.FromCtx(ctx).Warnw(
+					"Skipping undecodable entitlement of role",
+					"roleId", iRoleBaseRole.Id,
+					"type", entitlementType,
+					"error", err,
+				)
+				continue
+			}
 			if err != nil {
 				return nil, fmt.Errorf(
 					"error marshalling entitlement for role id %v from IEntitlement @ address %v: %w",
@@ -184,52 +205,235 @@ func (sc *SpaceContractV3) GetMembershipStatus(
 		return nil, err
 	}
 
-	status := &MembershipStatus{
-		IsMember:   false,
-		IsExpired:  true,
-		TokenIds:   []*big.Int{},
-		ExpiryTime: nil,
-		ExpiredAt:  nil,
-	}
-
 	spaceAsQueryable, err := base.NewErc721aQueryable(space.address, sc.backend)
 	if err != nil {
 		return nil, err
 	}
 
-	tokens, err := spaceAsQueryable.TokensOfOwner(&bind.CallOpts{Context: ctx}, user)
+	tokens, err := spaceAsQueryable.TokensOfOwner(callOpts(ctx), user)
 	if err != nil {
 		return nil, err
 	}
 
-	status.TokenIds = tokens
-	status.IsMember = len(tokens) > 0
-
-	if !status.IsMember {
-		return status, nil
+	if len(tokens) == 0 {
+		return membershipStatusOf(tokens, nil, stateTime(ctx)), nil
 	}
 
 	// Check expirations
 	membership, err := base.NewMembership(space.address, sc.backend)
 	if err != nil {
-		status.IsExpired = false
-		return status, nil
+		return &MembershipStatus{IsMember: true, TokenIds: tokens}, nil
+	}
+
+	expiries := make([]*big.Int, len(tokens))
+	for i, tokenId := range tokens {
+		expiresAt, err := membership.ExpiresAt(callOpts(ctx), tokenId)
+		if err != nil {
+			log.Warnw("Failed to get expiration for token", "tokenId", tokenId, "error", err)
+			continue
+		}
+		expiries[i] = expiresAt
+	}
+
+	return membershipStatusOf(tokens, expiries, stateTime(ctx)), nil
+}
+
+func (sc *SpaceContractV3) GetMembershipExpiry(
+	ctx context.Context,
+	spaceId shared.StreamId,
+	wallet common.Address,
+) (time.Time, error) {
+	status, err := sc.GetMembershipStatus(ctx, spaceId, wallet)
+	if err != nil {
+		return time.Time{}, err
+	}
+	expiry, err := membershipExpiry(status)
+	if err != nil {
+		return time.Time{}, AsRiverError(err).Func("SpaceContractV3.GetMembershipExpiry").
+			Tag("spaceId", spaceId).
+			Tag("wallet", wallet)
+	}
+	return expiry, nil
+}
+
+// ListSpaceMembers reads the ownerships of the tokens of the page in a single call. Memberships are ERC721A
+// tokens with consecutive ids, the ownerships of the ids that were not minted are empty.
+func (sc *SpaceContractV3) ListSpaceMembers(
+	ctx context.Context,
+	spaceId shared.StreamId,
+	page int,
+	pageSize int,
+) ([]common.Address, error) {
+	if page < 0 || pageSize <= 0 {
+		return nil, RiverError(Err_INVALID_ARGUMENT, "Invalid page", "page", page, "pageSize", pageSize).
+			Func("SpaceContractV3.ListSpaceMembers")
+	}
+	space, err := sc.getSpace(ctx, spaceId)
+	if err != nil {
+		return nil, err
+	}
+	spaceAsQueryable, err := base.NewErc721aQueryable(space.address, sc.backend)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenIds := make([]*big.Int, pageSize)
+	for i := range tokenIds {
+		tokenIds[i] = new(big.Int).SetInt64(int64(page)*int64(pageSize) + int64(i))
+	}
+	ownerships, err := spaceAsQueryable.ExplicitOwnershipsOf(callOpts(ctx), tokenIds)
+	if err != nil {
+		return nil, AsRiverError(err).Func("SpaceContractV3.ListSpaceMembers").
+			Tag("spaceId", spaceId).
+			Tag("page", page)
+	}
+
+	minted := false
+	members := make([]common.Address, 0, len(ownerships))
+	seen := make(map[common.Address]struct{}, len(ownerships))
+	for _, ownership := range ownerships {
+		if ownership.Addr == EMPTY_ADDRESS {
+			continue
+		}
+		minted = true
+		if _, ok := seen[ownership.Addr]; ok || ownership.Burned {
+			continue
+		}
+		seen[ownership.Addr] = struct{}{}
+		members = append(members, ownership.Addr)
+	}
+	// The first ids may not be minted if the tokens of the space start at 1.
+	if !minted && page > 0 {
+		return nil, ErrNoMoreSpaceMembers
+	}
+	return members, nil
+}
+
+// rpcClientBackend is implemented by the backends that expose their JSON-RPC client, such as ethclient.Client.
+type rpcClientBackend interface {
+	Client() *rpc.Client
+}
+
+// GetMembershipStatusBatch reads the tokens of all the wallets in one JSON-RPC batch, then the expiry times
+// of all their tokens in another, instead of a round trip per wallet and token.
+func (sc *SpaceContractV3) GetMembershipStatusBatch(
+	ctx context.Context,
+	spaceId shared.StreamId,
+	wallets []common.Address,
+) ([]*MembershipStatus, error) {
+	log := logging.FromCtx(ctx).With("function", "SpaceContractV3.GetMembershipStatusBatch")
+	backend, ok := sc.backend.(rpcClientBackend)
+	if !ok || backend.Client() == nil {
+		return nil, ErrMembershipBatchUnsupported
+	}
+	client := backend.Client()
+
+	space, err := sc.getSpace(ctx, spaceId)
+	if err != nil {
+		return nil, err
+	}
+	queryableAbi, err := base.Erc721aQueryableMetaData.GetAbi()
+	if err != nil {
+		return nil, err
+	}
+	membershipAbi, err := base.MembershipMetaData.GetAbi()
+	if err != nil {
+		return nil, err
+	}
+
+	tokenCalls := make([]rpc.BatchElem, len(wallets))
+	for i, wallet := range wallets {
+		data, err := queryableAbi.Pack("tokensOfOwner", wallet)
+		if err != nil {
+			return nil, err
+		}
+		tokenCalls[i] = newEthCall(space.address, data, blockTag(ctx))
+	}
+	if err := client.BatchCallContext(ctx, tokenCalls); err != nil {
+		return nil, err
+	}
+
+	tokens := make([][]*big.Int, len(wallets))
+	var expiryCalls []rpc.BatchElem
+	for i, call := range tokenCalls {
+		if call.Error != nil {
+			return nil, call.Error
+		}
+		out, err := queryableAbi.Unpack("tokensOfOwner", *call.Result.(*hexutil.Bytes))
+		if err != nil {
+			return nil, err
+		}
+		tokens[i] = *abi.ConvertType(out[0], new([]*big.Int)).(*[]*big.Int)
+		for _, tokenId := range tokens[i] {
+			data, err := membershipAbi.Pack("expiresAt", tokenId)
+			if err != nil {
+				return nil, err
+			}
+			expiryCalls = append(expiryCalls, newEthCall(space.address, data, blockTag(ctx)))
+		}
+	}
+	if len(expiryCalls) > 0 {
+		if err := client.BatchCallContext(ctx, expiryCalls); err != nil {
+			return nil, err
+		}
+	}
+
+	statuses := make([]*MembershipStatus, len(wallets))
+	for i := range wallets {
+		expiries := make([]*big.Int, len(tokens[i]))
+		for j, tokenId := range tokens[i] {
+			call := expiryCalls[0]
+			expiryCalls = expiryCalls[1:]
+			if call.Error != nil {
+				log.Warnw("Failed to get expiration for token", "tokenId", tokenId, "error", call.Error)
+				continue
+			}
+			out, err := membershipAbi.Unpack("expiresAt", *call.Result.(*hexutil.Bytes))
+			if err != nil {
+				log.Warnw("Failed to get expiration for token", "tokenId", tokenId, "error", err)
+				continue
+			}
+			expiries[j] = *abi.ConvertType(out[0], new(*big.Int)).(**big.Int)
+		}
+		statuses[i] = membershipStatusOf(tokens[i], expiries, stateTime(ctx))
+	}
+	return statuses, nil
+}
+
+// newEthCall returns the batch element of an eth_call of the contract at block, see blockTag.
+func newEthCall(to common.Address, data []byte, block string) rpc.BatchElem {
+	return rpc.BatchElem{
+		Method: "eth_call",
+		Args:   []any{map[string]any{"to": to, "data": hexutil.Bytes(data)}, block},
+		Result: new(hexutil.Bytes),
 	}
+}
 
-	currentTime := big.NewInt(time.Now().Unix())
+// membershipStatusOf returns the membership status of the owner of the tokens from their expiry times at now.
+// The tokens whose expiry time couldn't be read have a nil expiry time and are ignored.
+func membershipStatusOf(tokens []*big.Int, expiries []*big.Int, now time.Time) *MembershipStatus {
+	status := &MembershipStatus{
+		IsMember:   len(tokens) > 0,
+		IsExpired:  true,
+		TokenIds:   tokens,
+		ExpiryTime: nil,
+		ExpiredAt:  nil,
+	}
+	if !status.IsMember {
+		return status
+	}
+
+	currentTime := big.NewInt(now.Unix())
 
 	// Track active and expired tokens
 	var hasActiveToken bool
 	var furthestExpiryTime *big.Int
 	var mostRecentExpiry *big.Int
 
-	for _, tokenId := range tokens {
-		expiresAt, err := membership.ExpiresAt(&bind.CallOpts{Context: ctx}, tokenId)
-		if err != nil {
-			log.Warnw("Failed to get expiration for token", "tokenId", tokenId, "error", err)
+	for _, expiresAt := range expiries {
+		if expiresAt == nil {
 			continue
 		}
-
 		// Token never expires
 		if expiresAt.Cmp(big.NewInt(0)) == 0 {
 			hasActiveToken = true
@@ -264,7 +468,7 @@ func (sc *SpaceContractV3) GetMembershipStatus(
 		status.ExpiredAt = mostRecentExpiry
 	}
 
-	return status, nil
+	return status
 }
 
 func (sc *SpaceContractV3) IsEntitledToSpace(
@@ -279,27 +483,87 @@ func (sc *SpaceContractV3) IsEntitledToSpace(
 		return false, err
 	}
 	isEntitled, err := space.managerContract.IsEntitledToSpace(
-		&bind.CallOpts{Context: ctx},
+		callOpts(ctx),
 		user,
 		permission.String(),
 	)
 	return isEntitled, err
 }
 
+// appAccountAbi is the part of the app account facet of spaces that app entitlement checks call. There are no
+// generated bindings of the facet.
+const appAccountAbi = `[
+	{"type": "function", "name": "isAppInstalled", "stateMutability": "view",
+		"inputs": [{"name": "app", "type": "address"}],
+		"outputs": [{"name": "", "type": "bool"}]},
+	{"type": "function", "name": "isAppEntitled", "stateMutability": "view",
+		"inputs": [
+			{"name": "app", "type": "address"},
+			{"name": "publicKey", "type": "address"},
+			{"name": "permission", "type": "bytes32"}
+		],
+		"outputs": [{"name": "", "type": "bool"}]}
+]`
+
+var parsedAppAccountAbi = sync.OnceValues(func() (abi.ABI, error) {
+	return abi.JSON(strings.NewReader(appAccountAbi))
+})
+
+// IsAppEntitled reads whether the app is installed in the space and, if it is, whether it is entitled to the
+// permission. Apps sign with their own address, which is passed as the key of the app.
+func (sc *SpaceContractV3) IsAppEntitled(
+	ctx context.Context,
+	spaceId shared.StreamId,
+	app common.Address,
+	permission Permission,
+) (bool, bool, error) {
+	space, err := sc.getSpace(ctx, spaceId)
+	if err != nil {
+		return false, false, err
+	}
+	parsed, err := parsedAppAccountAbi()
+	if err != nil {
+		return false, false, err
+	}
+	appAccount := bind.NewBoundContract(space.address, parsed, sc.backend, nil, nil)
+
+	var out []any
+	if err := appAccount.Call(callOpts(ctx), &out, "isAppInstalled", app); err != nil {
+		return false, false, err
+	}
+	if installed := *abi.ConvertType(out[0], new(bool)).(*bool); !installed {
+		return false, false, nil
+	}
+
+	var permissionName [32]byte
+	copy(permissionName[:], permission.String())
+	out = nil
+	if err := appAccount.Call(callOpts(ctx), &out, "isAppEntitled", app, app, permissionName); err != nil {
+		return true, false, err
+	}
+	return true, *abi.ConvertType(out[0], new(bool)).(*bool), nil
+}
+
 func (sc *SpaceContractV3) marshalEntitlements(
 	ctx context.Context,
 	entitlementData []base.IEntitlementDataQueryableBaseEntitlementData,
 ) ([]types.Entitlement, error) {
 	log := logging.FromCtx(ctx)
-	entitlements := make([]types.Entitlement, len(entitlementData))
+	entitlements := make([]types.Entitlement, 0, len(entitlementData))
 
 	for i, rawEntitlement := range entitlementData {
 		entitlement, err := types.MarshalEntitlement(ctx, rawEntitlement)
+		// Modules this node can't decode, e.g. added by a newer contract version, are skipped. This can only
+		// deny access that the module would grant.
+		if errors.Is(err, types.ErrUndecodableEntitlement) {
+			log.Warnw("Skipping undecodable entitlement", "index", i, "type", rawEntitlement.EntitlementType, "error", err)
+			continue
+		}
 		if err != nil {
 			log.Warnw("Failed to marshal entitlement", "index", i, "error", err)
 			return nil, AsRiverError(err)
 		}
-		entitlements[i] = entitlement
+		entitlements = append(entitlements, entitlement)
 	}
 	return entitlements, nil
 }
@@ -318,6 +582,19 @@ func (sc *SpaceContractV3) IsBanned(
 	return space.banning.IsBanned(ctx, linkedWallets)
 }
 
+func (sc *SpaceContractV3) GetBannedWallets(
+	ctx context.Context,
+	spaceId shared.StreamId,
+) ([]common.Address, error) {
+	log := logging.FromCtx(ctx).With("function", "SpaceContractV3.GetBannedWallets")
+	space, err := sc.getSpace(ctx, spaceId)
+	if err != nil {
+		log.Warnw("Failed to get space", "space_id", spaceId, "error", err)
+		return nil, err
+	}
+	return space.banning.GetBannedWallets(ctx)
+}
+
 /**
  * GetChannelEntitlementsForPermission returns the entitlements for the given permission for a channel.
  * The entitlements are returned as a list of `Entitlement`s.
@@ -331,6 +608,30 @@ func (sc *SpaceContractV3) GetChannelEntitlementsForPermission(
 	spaceId shared.StreamId,
 	channelId shared.StreamId,
 	permission Permission,
+) ([]types.Entitlement, common.Address, error) {
+	return sc.getChannelEntitlements(ctx, spaceId, channelId, permission.String(), false)
+}
+
+// GetChannelEntitlementsForCustomPermission returns the entitlements of the channel for an app-defined
+// permission. Names that no role of the channel grants have no entitlements, reverts of the contract are
+// treated the same so that the permission is denied.
+func (sc *SpaceContractV3) GetChannelEntitlementsForCustomPermission(
+	ctx context.Context,
+	spaceId shared.StreamId,
+	channelId shared.StreamId,
+	permissionName string,
+) ([]types.Entitlement, common.Address, error) {
+	return sc.getChannelEntitlements(ctx, spaceId, channelId, permissionName, true)
+}
+
+// getChannelEntitlements returns the entitlements of the channel for the permission with the given name. If
+// emptyOnRevert is set, no entitlements are returned if the contract reverts the query.
+func (sc *SpaceContractV3) getChannelEntitlements(
+	ctx context.Context,
+	spaceId shared.StreamId,
+	channelId shared.StreamId,
+	permissionName string,
+	emptyOnRevert bool,
 ) ([]types.Entitlement, common.Address, error) {
 	log := logging.FromCtx(ctx)
 	// get the channel entitlements and check if user is entitled.
@@ -347,18 +648,23 @@ func (sc *SpaceContractV3) GetChannelEntitlementsForPermission(
 		return nil, EMPTY_ADDRESS, err
 	}
 
-	owner, err := spaceAsIerc5313.Owner(nil)
+	owner, err := spaceAsIerc5313.Owner(callOpts(ctx))
 	if err != nil {
 		log.Warnw("Failed to get owner", "space_id", spaceId, "error", err)
 		return nil, EMPTY_ADDRESS, err
 	}
 
 	entitlementData, err := space.queryContract.GetChannelEntitlementDataByPermission(
-		&bind.CallOpts{Context: ctx},
+		callOpts(ctx),
 		channelId,
-		permission.String(),
+		permissionName,
 	)
 	if err != nil {
+		if emptyOnRevert && isContractRevert(err) {
+			log.Debugw("Channel entitlement query reverted", "space_id", spaceId, "channel_id", channelId,
+				"permission", permissionName, "error", err)
+			return nil, owner, nil
+		}
 		return nil, EMPTY_ADDRESS, err
 	}
 
@@ -371,7 +677,7 @@ func (sc *SpaceContractV3) GetChannelEntitlementsForPermission(
 		"channel_id",
 		channelId,
 		"permission",
-		permission.String(),
+		permissionName,
 	)
 
 	entitlements, err := sc.marshalEntitlements(ctx, entitlementData)
@@ -395,6 +701,28 @@ func (sc *SpaceContractV3) GetSpaceEntitlementsForPermission(
 	ctx context.Context,
 	spaceId shared.StreamId,
 	permission Permission,
+) ([]types.Entitlement, common.Address, error) {
+	return sc.getSpaceEntitlements(ctx, spaceId, permission.String(), false)
+}
+
+// GetSpaceEntitlementsForCustomPermission returns the entitlements of the space for an app-defined permission.
+// Names that no role of the space grants have no entitlements, reverts of the contract are treated the same
+// so that the permission is denied.
+func (sc *SpaceContractV3) GetSpaceEntitlementsForCustomPermission(
+	ctx context.Context,
+	spaceId shared.StreamId,
+	permissionName string,
+) ([]types.Entitlement, common.Address, error) {
+	return sc.getSpaceEntitlements(ctx, spaceId, permissionName, true)
+}
+
+// getSpaceEntitlements returns the entitlements of the space for the permission with the given name. If
+// emptyOnRevert is set, no entitlements are returned if the contract reverts the query.
+func (sc *SpaceContractV3) getSpaceEntitlements(
+	ctx context.Context,
+	spaceId shared.StreamId,
+	permissionName string,
+	emptyOnRevert bool,
 ) ([]types.Entitlement, common.Address, error) {
 	log := logging.FromCtx(ctx)
 	// get the space entitlements and check if user is entitled.
@@ -410,15 +738,15 @@ func (sc *SpaceContractV3) GetSpaceEntitlementsForPermission(
 		return nil, EMPTY_ADDRESS, err
 	}
 
-	owner, err := spaceAsIerc5313.Owner(nil)
+	owner, err := spaceAsIerc5313.Owner(callOpts(ctx))
 	if err != nil {
 		log.Warnw("Failed to get owner", "space_id", spaceId, "error", err)
 		return nil, EMPTY_ADDRESS, err
 	}
 
 	entitlementData, err := space.queryContract.GetEntitlementDataByPermission(
-		&bind.CallOpts{Context: ctx},
-		permission.String(),
+		callOpts(ctx),
+		permissionName,
 	)
 	log.Debugw(
 		"Got entitlement data",
@@ -429,9 +757,12 @@ func (sc *SpaceContractV3) GetSpaceEntitlementsForPermission(
 		"space_id",
 		spaceId,
 		"permission",
-		permission.String(),
+		permissionName,
 	)
 	if err != nil {
+		if emptyOnRevert && isContractRevert(err) {
+			return nil, owner, nil
+		}
 		return nil, EMPTY_ADDRESS, err
 	}
 
@@ -447,7 +778,7 @@ func (sc *SpaceContractV3) GetSpaceEntitlementsForPermission(
 		"space_id",
 		spaceId,
 		"permission",
-		permission.String(),
+		permissionName,
 	)
 
 	return entitlements, owner, nil
@@ -467,7 +798,7 @@ func (sc *SpaceContractV3) IsEntitledToChannel(
 	}
 	// channel entitlement check
 	isEntitled, err := space.managerContract.IsEntitledToChannel(
-		&bind.CallOpts{Context: ctx},
+		callOpts(ctx),
 		channelId,
 		user,
 		permission.String(),
@@ -481,8 +812,11 @@ func (sc *SpaceContractV3) IsSpaceDisabled(ctx context.Context, spaceId shared.S
 		return false, err
 	}
 
-	isDisabled, err := space.pausable.Paused(nil)
-	return isDisabled, err
+	isDisabled, err := space.pausable.Paused(callOpts(ctx))
+	if err != nil {
+		return false, spaceNotFoundError(err, spaceId)
+	}
+	return isDisabled, nil
 }
 
 func (sc *SpaceContractV3) IsChannelDisabled(
@@ -496,25 +830,37 @@ func (sc *SpaceContractV3) IsChannelDisabled(
 	}
 
 	channel, err := space.channels.GetChannel(
-		&bind.CallOpts{Context: ctx},
+		callOpts(ctx),
 		channelId,
 	)
 	if err != nil {
-		return false, err
+		return false, spaceNotFoundError(err, spaceId)
 	}
 
 	return channel.Disabled, nil
 }
 
+// spaceNotFoundError returns an Err_NOT_FOUND error if err tells there is no contract at the address of the
+// space, err otherwise.
+func spaceNotFoundError(err error, spaceId shared.StreamId) error {
+	if errors.Is(err, bind.ErrNoCode) {
+		return RiverErrorWithBase(Err_NOT_FOUND, "Space not found", err).Tag("spaceId", spaceId)
+	}
+	return err
+}
+
 func (sc *SpaceContractV3) getSpace(ctx context.Context, spaceId shared.StreamId) (*Space, error) {
 	sc.spacesLock.Lock()
 	defer sc.spacesLock.Unlock()
 	if sc.spaces[spaceId] == nil {
 		// use the networkId to fetch the space's contract address
 		address, err := shared.AddressFromSpaceId(spaceId)
-		if err != nil || address == EMPTY_ADDRESS {
+		if err != nil {
 			return nil, err
 		}
+		if address == EMPTY_ADDRESS {
+			return nil, RiverError(Err_NOT_FOUND, "Space not found").Tag("spaceId", spaceId)
+		}
 		managerContract, err := base.NewEntitlementsManager(address, sc.backend)
 		if err != nil {
 			return nil, err
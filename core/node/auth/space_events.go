@@ -0,0 +1,300 @@
+package auth
+
+import (
+	"context"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	ethTypes "github.com/ethereum/go-ethereum/core/types"
+
+	"github.com/towns-protocol/towns/core/contracts/base"
+	. "github.com/towns-protocol/towns/core/node/base"
+	"github.com/towns-protocol/towns/core/node/crypto"
+	"github.com/towns-protocol/towns/core/node/logging"
+	"github.com/towns-protocol/towns/core/node/shared"
+)
+
+type SpaceEventType int
+
+const (
+	SpaceEventType_UNKNOWN SpaceEventType = iota
+	SpaceEventType_ROLES_CHANGED
+	SpaceEventType_CHANNEL_CHANGED
+	SpaceEventType_ENTITLEMENTS_CHANGED
+	SpaceEventType_MEMBERSHIP_CHANGED
+	SpaceEventType_BANNING_CHANGED
+	SpaceEventType_PAUSED_CHANGED
+
+	SpaceEventType_MAX // MAX - leave at the end
+)
+
+var spaceEventTypeDescriptions = []string{
+	"UNKNOWN",
+	"ROLES_CHANGED",
+	"CHANNEL_CHANGED",
+	"ENTITLEMENTS_CHANGED",
+	"MEMBERSHIP_CHANGED",
+	"BANNING_CHANGED",
+	"PAUSED_CHANGED",
+}
+
+func (t SpaceEventType) String() string {
+	return spaceEventTypeDescriptions[t]
+}
+
+// SpaceEvent is an on-chain event of a space contract that affects cached entitlements.
+type SpaceEvent struct {
+	Type     SpaceEventType
+	SpaceId  shared.StreamId
+	BlockNum crypto.BlockNumber
+	// ChannelId is set for events that only affect a single channel.
+	ChannelId shared.StreamId
+	// Addresses are the wallets whose membership changed, empty for events that affect the whole space.
+	Addresses []common.Address
+}
+
+const spaceEventsMaxResubscribeDelay = 30 * time.Second
+
+type spaceEventSpec struct {
+	eventType SpaceEventType
+	event     abi.Event
+}
+
+// spaceEventSpecs maps the topics of the space contract events that affect entitlements to their type.
+var spaceEventSpecs = func() map[common.Hash]spaceEventSpec {
+	specs := make(map[common.Hash]spaceEventSpec)
+	add := func(eventType SpaceEventType, metaData *bind.MetaData, names ...string) {
+		contractAbi, err := metaData.GetAbi()
+		if err != nil {
+			panic(err)
+		}
+		for _, name := range names {
+			event := contractAbi.Events[name]
+			specs[event.ID] = spaceEventSpec{eventType: eventType, event: event}
+		}
+	}
+
+	add(SpaceEventType_ROLES_CHANGED, base.IRolesMetaData,
+		"RoleCreated", "RoleUpdated", "RoleRemoved",
+		"PermissionsAddedToChannelRole", "PermissionsRemovedFromChannelRole", "PermissionsUpdatedForChannelRole")
+	add(SpaceEventType_CHANNEL_CHANGED, base.ChannelsMetaData,
+		"ChannelCreated", "ChannelUpdated", "ChannelRemoved", "ChannelRoleAdded", "ChannelRoleRemoved")
+	add(SpaceEventType_ENTITLEMENTS_CHANGED, base.EntitlementsManagerMetaData,
+		"EntitlementModuleAdded", "EntitlementModuleRemoved")
+	add(SpaceEventType_MEMBERSHIP_CHANGED, base.MembershipMetaData, "MembershipTokenIssued")
+	add(SpaceEventType_MEMBERSHIP_CHANGED, base.ChannelsMetaData, "Transfer")
+	add(SpaceEventType_BANNING_CHANGED, base.BanningMetaData, "Banned", "Unbanned")
+	add(SpaceEventType_PAUSED_CHANGED, base.PausableMetaData, "Paused", "Unpaused")
+	return specs
+}()
+
+// parseSpaceEvent decodes a log emitted by the space contract. ok is false for logs of unrelated events.
+func parseSpaceEvent(spaceId shared.StreamId, l *ethTypes.Log) (event SpaceEvent, ok bool, err error) {
+	if len(l.Topics) == 0 {
+		return SpaceEvent{}, false, nil
+	}
+	spec, ok := spaceEventSpecs[l.Topics[0]]
+	if !ok {
+		return SpaceEvent{}, false, nil
+	}
+
+	values := make(map[string]any)
+	var indexed abi.Arguments
+	for _, input := range spec.event.Inputs {
+		if input.Indexed {
+			indexed = append(indexed, input)
+		}
+	}
+	if err := abi.ParseTopicsIntoMap(values, indexed, l.Topics[1:]); err != nil {
+		return SpaceEvent{}, false, err
+	}
+	if err := spec.event.Inputs.NonIndexed().UnpackIntoMap(values, l.Data); err != nil {
+		return SpaceEvent{}, false, err
+	}
+
+	event = SpaceEvent{
+		Type:     spec.eventType,
+		SpaceId:  spaceId,
+		BlockNum: crypto.BlockNumber(l.BlockNumber),
+	}
+	if channelId, ok := values["channelId"].([32]byte); ok {
+		if event.ChannelId, err = shared.StreamIdFromHash(channelId); err != nil {
+			return SpaceEvent{}, false, err
+		}
+	}
+	if spec.eventType == SpaceEventType_MEMBERSHIP_CHANGED {
+		for _, input := range spec.event.Inputs {
+			if address, ok := values[input.Name].(common.Address); ok && address != (common.Address{}) {
+				event.Addresses = append(event.Addresses, address)
+			}
+		}
+	}
+	return event, true, nil
+}
+
+// WatchSpaceEvents subscribes to the events of the space contract that affect entitlements and busts the
+// cached results they invalidate. Events are forwarded to eventCh if it is not nil. The subscription is
+// re-established when it drops until ctx is cancelled or chainAuth is closed. An error is returned if the initial subscription
+// can't be created.
+func (ca *chainAuth) WatchSpaceEvents(ctx context.Context, spaceId shared.StreamId, eventCh chan<- SpaceEvent) error {
+	spaceAddress, err := shared.AddressFromSpaceId(spaceId)
+	if err != nil {
+		return err
+	}
+
+	topics := make([]common.Hash, 0, len(spaceEventSpecs))
+	for topic := range spaceEventSpecs {
+		topics = append(topics, topic)
+	}
+	query := ethereum.FilterQuery{
+		Addresses: []common.Address{spaceAddress},
+		Topics:    [][]common.Hash{topics},
+	}
+
+	logs := make(chan ethTypes.Log, 64)
+	sub, err := ca.blockchain.Client.SubscribeFilterLogs(ctx, query, logs)
+	if err != nil {
+		return AsRiverError(err).Func("WatchSpaceEvents").Tag("spaceId", spaceId)
+	}
+
+	if err := ca.startWorker(ctx, func(ctx context.Context) {
+		ca.watchSpaceEvents(ctx, spaceId, query, logs, sub, eventCh)
+	}); err != nil {
+		sub.Unsubscribe()
+		return err
+	}
+	return nil
+}
+
+func (ca *chainAuth) watchSpaceEvents(
+	ctx context.Context,
+	spaceId shared.StreamId,
+	query ethereum.FilterQuery,
+	logs chan ethTypes.Log,
+	sub ethereum.Subscription,
+	eventCh chan<- SpaceEvent,
+) {
+	log := logging.FromCtx(ctx).With("spaceId", spaceId)
+
+	// Events are buffered while chainAuth is read-only, as busting the caches would turn the cached results
+	// into misses that can't be served, and applied in order once it leaves read-only mode.
+	var buffered []SpaceEvent
+	var readOnlyEnded <-chan struct{}
+	flush := func() bool {
+		for _, event := range buffered {
+			if !ca.deliverSpaceEvent(ctx, event, eventCh) {
+				return false
+			}
+		}
+		buffered, readOnlyEnded = nil, nil
+		return true
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			sub.Unsubscribe()
+			return
+
+		case <-readOnlyEnded:
+			// The window may have been extended.
+			if ended := ca.readOnly.endedCh(); ended != nil {
+				readOnlyEnded = ended
+				continue
+			}
+			if !flush() {
+				sub.Unsubscribe()
+				return
+			}
+
+		case err := <-sub.Err():
+			sub.Unsubscribe()
+			log.Warnw("Space events subscription dropped, resubscribing", "error", err)
+
+			backoff := BackoffTracker{}
+			for {
+				if err := backoff.Wait(ctx, err); err != nil {
+					return
+				}
+				backoff.NextDelay = min(backoff.NextDelay, spaceEventsMaxResubscribeDelay)
+
+				if sub, err = ca.blockchain.Client.SubscribeFilterLogs(ctx, query, logs); err == nil {
+					break
+				}
+				log.Warnw("Failed to resubscribe to space events", "error", err, "attempt", backoff.NumAttempts)
+			}
+
+		case l := <-logs:
+			if l.Removed {
+				continue
+			}
+			event, ok, err := parseSpaceEvent(spaceId, &l)
+			if err != nil {
+				log.Warnw("Failed to parse space event", "txHash", l.TxHash, "error", err)
+				continue
+			}
+			if !ok {
+				continue
+			}
+
+			if ended := ca.readOnly.endedCh(); ended != nil {
+				buffered = ca.readOnly.bufferSpaceEvent(buffered, event)
+				readOnlyEnded = ended
+				continue
+			}
+			if !flush() || !ca.deliverSpaceEvent(ctx, event, eventCh) {
+				sub.Unsubscribe()
+				return
+			}
+		}
+	}
+}
+
+// deliverSpaceEvent applies the event to the caches and forwards it to eventCh if it is not nil. Returns
+// false if ctx is done before the event is forwarded.
+func (ca *chainAuth) deliverSpaceEvent(ctx context.Context, event SpaceEvent, eventCh chan<- SpaceEvent) bool {
+	ca.onSpaceEvent(ctx, event)
+
+	if eventCh != nil {
+		select {
+		case eventCh <- event:
+		case <-ctx.Done():
+			return false
+		}
+	}
+	return true
+}
+
+// onSpaceEvent busts the cached results invalidated by the event and pre-warms the entitlements of new members.
+func (ca *chainAuth) onSpaceEvent(ctx context.Context, event SpaceEvent) {
+	var scopes []invalidationScope
+	var principals []common.Address
+	switch event.Type {
+	case SpaceEventType_MEMBERSHIP_CHANGED:
+		scopes, principals = ca.membershipScopes(ctx, event.SpaceId, event.Addresses...)
+		// A new member may have linked wallets to get in, refresh them.
+		for _, wallet := range append(principals, event.Addresses...) {
+			ca.linkedWalletCache.bust(newArgsForLinkedWallets(wallet))
+		}
+	default:
+		scopes = []invalidationScope{{spaceId: event.SpaceId, channelId: event.ChannelId}}
+	}
+
+	logging.FromCtx(ctx).Debugw("Busting caches for space event", "event", event.Type, "spaceId", event.SpaceId)
+
+	// With a chain monitor, invalidations are coalesced per block and applied once the block is complete.
+	if ca.blockchain.ChainMonitor == nil {
+		ca.invalidator.invalidateNow(scopes...)
+	} else {
+		for _, scope := range scopes {
+			ca.invalidator.invalidate(event.BlockNum, scope)
+		}
+	}
+
+	if len(principals) > 0 {
+		ca.onMemberJoined(ctx, event.SpaceId, event.BlockNum, principals)
+	}
+}
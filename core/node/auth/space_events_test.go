@@ -0,0 +1,222 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	ethTypes "github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/event"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/towns-protocol/towns/core/config"
+	"github.com/towns-protocol/towns/core/contracts/base"
+	"github.com/towns-protocol/towns/core/node/base/test"
+	"github.com/towns-protocol/towns/core/node/crypto"
+	"github.com/towns-protocol/towns/core/node/infra"
+	"github.com/towns-protocol/towns/core/node/shared"
+	"github.com/towns-protocol/towns/core/node/testutils"
+)
+
+// fakeLogsClient serves log subscriptions from logs sent by the test.
+type fakeLogsClient struct {
+	crypto.BlockchainClient
+
+	mu            sync.Mutex
+	subscriptions int
+	logs          chan<- ethTypes.Log
+	drop          chan error
+}
+
+func (c *fakeLogsClient) SubscribeFilterLogs(
+	ctx context.Context,
+	q ethereum.FilterQuery,
+	ch chan<- ethTypes.Log,
+) (ethereum.Subscription, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.subscriptions++
+	c.logs = ch
+	drop := make(chan error)
+	c.drop = drop
+	return event.NewSubscription(func(quit <-chan struct{}) error {
+		select {
+		case err := <-drop:
+			return err
+		case <-quit:
+			return nil
+		}
+	}), nil
+}
+
+func (c *fakeLogsClient) numSubscriptions() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.subscriptions
+}
+
+func (c *fakeLogsClient) send(l ethTypes.Log) {
+	c.mu.Lock()
+	logs := c.logs
+	c.mu.Unlock()
+	logs <- l
+}
+
+func (c *fakeLogsClient) dropSubscription() {
+	c.mu.Lock()
+	drop := c.drop
+	c.mu.Unlock()
+	drop <- errors.New("connection lost")
+}
+
+func TestWatchSpaceEvents(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	rolesAbi, err := base.IRolesMetaData.GetAbi()
+	require.NoError(t, err)
+	channelsAbi, err := base.ChannelsMetaData.GetAbi()
+	require.NoError(t, err)
+
+	cfg := &config.Config{}
+	alice := common.HexToAddress("0xa11ce")
+	bob := common.HexToAddress("0xb0b")
+	spaceContract := newFakeSpaceContract(common.HexToAddress("0x0e"), alice)
+	client := &fakeLogsClient{}
+	ca, err := newChainAuth(
+		ctx,
+		&crypto.Blockchain{Config: &config.ChainConfig{}, Client: client},
+		nil,
+		spaceContract,
+		nil,
+		nil,
+		0,
+		0,
+		0,
+		0,
+		nil,
+		infra.NewMetricsFactory(prometheus.NewRegistry(), "", ""),
+	)
+	require.NoError(t, err)
+
+	spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+	spaceAddress, err := shared.AddressFromSpaceId(spaceId)
+	require.NoError(t, err)
+	channelId := testutils.MakeChannelId(spaceId)
+
+	events := make(chan SpaceEvent, 1)
+	require.NoError(t, ca.WatchSpaceEvents(ctx, spaceId, events))
+
+	aliceArgs := NewChainAuthArgsForSpace(spaceId, alice.Hex(), PermissionWrite)
+	bobArgs := NewChainAuthArgsForSpace(spaceId, bob.Hex(), PermissionWrite)
+	for _, args := range []*ChainAuthArgs{aliceArgs, bobArgs} {
+		_, err := ca.IsEntitled(ctx, cfg, args)
+		require.NoError(t, err)
+	}
+	require.True(t, ca.entitlementCache.positiveCache.Contains(*aliceArgs))
+	require.True(t, ca.entitlementCache.negativeCache.Contains(*bobArgs))
+
+	// A membership change only busts the results cached for the affected wallet.
+	client.send(ethTypes.Log{
+		Address: spaceAddress,
+		Topics: []common.Hash{
+			channelsAbi.Events["Transfer"].ID,
+			{},
+			common.BytesToHash(bob.Bytes()),
+			common.BigToHash(common.Big1),
+		},
+		BlockNumber: 10,
+	})
+	event := <-events
+	require.Equal(t, SpaceEventType_MEMBERSHIP_CHANGED, event.Type)
+	require.Equal(t, crypto.BlockNumber(10), event.BlockNum)
+	require.Equal(t, []common.Address{bob}, event.Addresses)
+	require.True(t, ca.entitlementCache.positiveCache.Contains(*aliceArgs))
+	require.False(t, ca.entitlementCache.negativeCache.Contains(*bobArgs))
+
+	// Channel scoped events carry the channel id.
+	client.send(ethTypes.Log{
+		Address: spaceAddress,
+		Topics: []common.Hash{
+			rolesAbi.Events["PermissionsUpdatedForChannelRole"].ID,
+			common.BytesToHash(alice.Bytes()),
+			common.BigToHash(common.Big2),
+			common.Hash(channelId),
+		},
+	})
+	event = <-events
+	require.Equal(t, SpaceEventType_ROLES_CHANGED, event.Type)
+	require.Equal(t, channelId, event.ChannelId)
+	require.Empty(t, event.Addresses)
+	require.True(t, ca.entitlementCache.positiveCache.Contains(*aliceArgs))
+
+	// The subscription is re-established when it drops.
+	client.dropSubscription()
+	require.Eventually(t, func() bool {
+		return client.numSubscriptions() == 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// Role changes affect everyone in the space.
+	client.send(ethTypes.Log{
+		Address: spaceAddress,
+		Topics: []common.Hash{
+			rolesAbi.Events["RoleUpdated"].ID,
+			common.BytesToHash(alice.Bytes()),
+			common.BigToHash(common.Big3),
+		},
+	})
+	event = <-events
+	require.Equal(t, SpaceEventType_ROLES_CHANGED, event.Type)
+	require.Equal(t, shared.StreamId{}, event.ChannelId)
+	require.False(t, ca.entitlementCache.positiveCache.Contains(*aliceArgs))
+}
+
+func TestCloseStopsWorkersAndUnregistersMetrics(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	registry := prometheus.NewRegistry()
+	metrics := infra.NewMetricsFactory(registry, "", "")
+	client := &fakeLogsClient{}
+	newInstance := func() *chainAuth {
+		ca, err := newChainAuth(
+			ctx,
+			&crypto.Blockchain{Config: &config.ChainConfig{}, Client: client},
+			nil,
+			newFakeSpaceContract(common.HexToAddress("0x0e")),
+			nil,
+			nil,
+			0,
+			0,
+			0,
+			0,
+			nil,
+			metrics,
+		)
+		require.NoError(t, err)
+		return ca
+	}
+
+	for range 3 {
+		ca := newInstance()
+		spaceId := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+		require.NoError(t, ca.WatchSpaceEvents(ctx, spaceId, nil))
+
+		families, err := registry.Gather()
+		require.NoError(t, err)
+		require.NotEmpty(t, families)
+
+		require.NoError(t, ca.Close())
+		require.NoError(t, ca.Close())
+
+		families, err = registry.Gather()
+		require.NoError(t, err)
+		require.Empty(t, families)
+		require.Error(t, ca.WatchSpaceEvents(ctx, spaceId, nil))
+	}
+}
@@ -0,0 +1,314 @@
+package auth
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/towns-protocol/towns/core/contracts/types"
+	. "github.com/towns-protocol/towns/core/node/base"
+	. "github.com/towns-protocol/towns/core/node/protocol"
+	"github.com/towns-protocol/towns/core/node/shared"
+)
+
+const (
+	// USER_AUTH_BUNDLE_TIMEOUT bounds the chain reads of a single support bundle.
+	USER_AUTH_BUNDLE_TIMEOUT = 30 * time.Second
+	// maxBundleDecisions caps the recent decisions of a support bundle.
+	maxBundleDecisions = 100
+	// maxBundleCacheEntries caps the cache entries of a support bundle.
+	maxBundleCacheEntries = 1000
+)
+
+// bundlePermissions are the permissions the entitlements of the space are summarized for in support bundles.
+var bundlePermissions = []Permission{PermissionRead, PermissionWrite}
+
+// UserAuthBundleCollector is implemented by ChainAuth implementations that can collect support bundles.
+type UserAuthBundleCollector interface {
+	// CollectUserAuthBundle returns the auth state of the principal in the space, see UserAuthBundle.
+	CollectUserAuthBundle(
+		ctx context.Context,
+		spaceId shared.StreamId,
+		principal common.Address,
+	) (*UserAuthBundle, error)
+}
+
+var _ UserAuthBundleCollector = (*chainAuth)(nil)
+
+// WalletProvenance tells how a wallet of a support bundle is linked to the principal.
+type WalletProvenance string
+
+const (
+	WalletProvenancePrincipal WalletProvenance = "principal"
+	// WalletProvenanceWalletLink is a wallet linked to the principal in the wallet link contract.
+	WalletProvenanceWalletLink WalletProvenance = "walletLink"
+	// WalletProvenanceDelegation is a wallet that delegated to a linked wallet on Ethereum mainnet.
+	WalletProvenanceDelegation WalletProvenance = "delegation"
+	// WalletProvenanceLinked is a linked wallet whose provenance couldn't be read.
+	WalletProvenanceLinked WalletProvenance = "linked"
+)
+
+// UserAuthBundle is the auth state of a principal in a space, collected for support escalations by
+// CollectUserAuthBundle. The state is read from the caches where it is cached, like the checks read it. The
+// addresses of other users, such as the owner of the space or the wallets of other cached entries, are
+// redacted, see CacheDumpFilter.RedactAddresses.
+type UserAuthBundle struct {
+	Timestamp time.Time       `json:"timestamp"`
+	SpaceId   shared.StreamId `json:"spaceId"`
+	Principal common.Address  `json:"principal"`
+
+	// SpaceEnabled is false if the space is disabled or doesn't exist, SpaceReason tells which.
+	SpaceEnabled bool   `json:"spaceEnabled"`
+	SpaceReason  string `json:"spaceReason,omitempty"`
+	// Wallets are the principal and its linked wallets.
+	Wallets []UserAuthBundleWallet `json:"wallets"`
+	// BaseChainOnly is true if the linked wallets were read from the base chain only because the cross-chain
+	// evaluator failed, they miss the wallets that delegated to them on Ethereum mainnet.
+	BaseChainOnly bool `json:"baseChainOnly"`
+	// Banned is true if any of the wallets is banned from the space.
+	Banned bool `json:"banned"`
+	// Entitlements summarize the entitlements of the space for the Read and Write permissions.
+	Entitlements []UserAuthBundleEntitlements `json:"entitlements"`
+	// RecentDecisions are the latest decisions of the checks of the principal in the space, the latest first.
+	RecentDecisions []AuditRecord `json:"recentDecisions"`
+	// CacheEntries are the cache entries of the wallets in the space and of their linked wallets.
+	CacheEntries []CacheDumpEntry `json:"cacheEntries"`
+	// Truncated is true if the recent decisions or the cache entries were capped.
+	Truncated bool `json:"truncated"`
+	// Errors are the errors reading parts of the bundle, the other parts are still collected.
+	Errors []string `json:"errors,omitempty"`
+}
+
+// UserAuthBundleWallet is a wallet of the principal in a support bundle.
+type UserAuthBundleWallet struct {
+	Wallet     common.Address   `json:"wallet"`
+	Provenance WalletProvenance `json:"provenance"`
+	// Membership is the membership status of the wallet in the space.
+	Membership WalletMembershipExplanation `json:"membership"`
+	Banned     bool                        `json:"banned"`
+}
+
+// UserAuthBundleEntitlements summarizes the entitlements of the space for a permission without revealing the
+// users they entitle.
+type UserAuthBundleEntitlements struct {
+	Permission string `json:"permission"`
+	// Owner is the owner of the space, redacted unless it is one of the wallets.
+	Owner   string `json:"owner"`
+	IsOwner bool   `json:"isOwner"`
+	// Gated is false if the space grants the permission to everyone, see ChainAuth.IsSpaceGated.
+	Gated   bool                              `json:"gated"`
+	Modules []UserAuthBundleEntitlementModule `json:"modules"`
+	Error   string                            `json:"error,omitempty"`
+}
+
+// UserAuthBundleEntitlementModule is an entitlement of the space in a support bundle.
+type UserAuthBundleEntitlementModule struct {
+	Type string `json:"type"`
+	// Everyone is true for user entitlements granting everyone.
+	Everyone bool `json:"everyone,omitempty"`
+	// Users is the number of users of user entitlements, IncludesWallets is true if one of the wallets is one
+	// of them.
+	Users           int  `json:"users,omitempty"`
+	IncludesWallets bool `json:"includesWallets,omitempty"`
+}
+
+// CollectUserAuthBundle collects the auth state of the principal in the space for support escalations, see
+// UserAuthBundle. The chain reads are bounded by USER_AUTH_BUNDLE_TIMEOUT and the number of linked wallets.
+func (ca *chainAuth) CollectUserAuthBundle(
+	ctx context.Context,
+	spaceId shared.StreamId,
+	principal common.Address,
+) (*UserAuthBundle, error) {
+	if spaceId.Type() != shared.STREAM_SPACE_BIN {
+		return nil, RiverError(Err_INVALID_ARGUMENT, "Not a space id", "spaceId", spaceId).
+			Func("CollectUserAuthBundle")
+	}
+	ctx, cancel := context.WithTimeout(ctx, USER_AUTH_BUNDLE_TIMEOUT)
+	defer cancel()
+
+	bundle := &UserAuthBundle{
+		Timestamp: time.Now(),
+		SpaceId:   spaceId,
+		Principal: principal,
+	}
+	addError := func(part string, err error) {
+		bundle.Errors = append(bundle.Errors, part+": "+err.Error())
+	}
+
+	if enabled, err := ca.spaceEnabled(ctx, nil, spaceId, 0); err != nil {
+		addError("space", err)
+	} else {
+		bundle.SpaceEnabled = enabled.Enabled
+		if !enabled.Enabled {
+			bundle.SpaceReason = enabled.Reason.String()
+		}
+	}
+
+	wallets := ca.bundleWallets(ctx, bundle, addError)
+	bundle.Entitlements = make([]UserAuthBundleEntitlements, 0, len(bundlePermissions))
+	for _, permission := range bundlePermissions {
+		bundle.Entitlements = append(bundle.Entitlements, ca.bundleEntitlements(ctx, spaceId, permission, wallets))
+	}
+
+	var truncated bool
+	bundle.RecentDecisions, truncated = ca.auditBuffer.recent(func(record *AuditRecord) bool {
+		return record.SpaceId == spaceId && record.Principal == principal
+	}, maxBundleDecisions)
+	bundle.Truncated = truncated
+
+	bundle.CacheEntries = []CacheDumpEntry{}
+	dump := ca.DumpCache(CacheDumpFilter{Principal: principal})
+	for _, entry := range dump.Entries {
+		if entry.SpaceId != spaceId && entry.SpaceId != (shared.StreamId{}) {
+			continue
+		}
+		if len(bundle.CacheEntries) == maxBundleCacheEntries {
+			bundle.Truncated = true
+			break
+		}
+		bundle.CacheEntries = append(bundle.CacheEntries, redactOtherUsers(entry, wallets))
+	}
+	bundle.Truncated = bundle.Truncated || dump.Truncated
+	return bundle, nil
+}
+
+// bundleWallets resolves the wallets of the principal of the bundle with their provenance, membership and ban
+// status, and returns them. If the linked wallets can't be resolved the principal is reported alone.
+func (ca *chainAuth) bundleWallets(
+	ctx context.Context,
+	bundle *UserAuthBundle,
+	addError func(part string, err error),
+) []common.Address {
+	principal := bundle.Principal
+	wallets := []common.Address{principal}
+	linked, err := ca.linkedWalletsOf(ctx, nil, principal, false)
+	if err != nil {
+		addError("linkedWallets", err)
+	} else {
+		wallets = orderLinkedWallets(principal, linked.wallets, LinkedWalletsOpts{})
+		bundle.BaseChainOnly = !linked.baseChainOnlyUntil.IsZero()
+	}
+
+	// The wallets linked in the wallet link contract are told apart from the mainnet delegations by reading
+	// the base chain alone, unless that is all that was read.
+	onBaseChain := map[common.Address]bool{}
+	if len(wallets) > 1 && !bundle.BaseChainOnly {
+		baseChainWallets, err := ca.walletResolver.BaseChainLinkedWallets(ctx, principal, len(wallets))
+		if err != nil {
+			addError("walletLink", err)
+			onBaseChain = nil
+		}
+		for _, wallet := range baseChainWallets {
+			onBaseChain[wallet] = true
+		}
+	}
+
+	bannedWallets, err := ca.getBannedWallets(ctx, bundle.SpaceId, 0)
+	if err != nil {
+		addError("banList", err)
+	}
+
+	bundle.Wallets = make([]UserAuthBundleWallet, 0, len(wallets))
+	for _, wallet := range wallets {
+		entry := UserAuthBundleWallet{Wallet: wallet, Provenance: WalletProvenancePrincipal}
+		switch {
+		case wallet == principal:
+		case bundle.BaseChainOnly || onBaseChain[wallet]:
+			entry.Provenance = WalletProvenanceWalletLink
+		case onBaseChain == nil:
+			entry.Provenance = WalletProvenanceLinked
+		default:
+			entry.Provenance = WalletProvenanceDelegation
+		}
+
+		entry.Membership.Wallet = wallet
+		status, err := ca.getMembershipStatus(ctx, nil, newArgsForIsSpaceMember(bundle.SpaceId, wallet))
+		if err != nil {
+			entry.Membership.Error = err.Error()
+		} else {
+			entry.Membership.IsMember = status.IsMember
+			entry.Membership.IsExpired = status.IsExpired
+			entry.Membership.ExpiryTime = status.ExpiryTime
+			entry.Membership.ExpiredAt = status.ExpiredAt
+		}
+
+		if bannedWallets != nil && bannedWallets.isBanned([]common.Address{wallet}) {
+			entry.Banned = true
+			bundle.Banned = true
+		}
+		bundle.Wallets = append(bundle.Wallets, entry)
+	}
+	return wallets
+}
+
+// bundleEntitlements summarizes the entitlements of the space for the permission against the wallets.
+func (ca *chainAuth) bundleEntitlements(
+	ctx context.Context,
+	spaceId shared.StreamId,
+	permission Permission,
+	wallets []common.Address,
+) UserAuthBundleEntitlements {
+	summary := UserAuthBundleEntitlements{Permission: permission.String(), Modules: []UserAuthBundleEntitlementModule{}}
+	entitlements, err := ca.getSpaceEntitlements(ctx, nil, NewChainAuthArgsForSpace(spaceId, "", permission))
+	if err != nil {
+		summary.Error = err.Error()
+		return summary
+	}
+
+	summary.IsOwner = slices.Contains(wallets, entitlements.owner)
+	summary.Owner = bundleAddress(entitlements.owner, wallets)
+	summary.Gated = isGated(entitlements.entitlementData)
+	for _, ent := range entitlements.entitlementData {
+		module := UserAuthBundleEntitlementModule{Type: ent.EntitlementType}
+		if ent.EntitlementType == types.ModuleTypeUserEntitlement {
+			for _, user := range ent.UserEntitlement {
+				if user == everyone {
+					module.Everyone = true
+					continue
+				}
+				module.Users++
+				module.IncludesWallets = module.IncludesWallets || slices.Contains(wallets, user)
+			}
+		}
+		summary.Modules = append(summary.Modules, module)
+	}
+	return summary
+}
+
+// bundleAddress returns the hex address if it is one of the wallets, the redacted address otherwise.
+func bundleAddress(addr common.Address, wallets []common.Address) string {
+	if addr == (common.Address{}) || slices.Contains(wallets, addr) {
+		return addr.Hex()
+	}
+	return redactAddress(addr)
+}
+
+// redactOtherUsers redacts the addresses of the cache entry that are not among the wallets.
+func redactOtherUsers(entry CacheDumpEntry, wallets []common.Address) CacheDumpEntry {
+	redact := func(addr string) string {
+		if addr == "" || !common.IsHexAddress(addr) {
+			return addr
+		}
+		return bundleAddress(common.HexToAddress(addr), wallets)
+	}
+	redactAll := func(addrs []string) []string {
+		ret := make([]string, len(addrs))
+		for i, addr := range addrs {
+			ret[i] = redact(addr)
+		}
+		return ret
+	}
+
+	entry.Principal = redact(entry.Principal)
+	entry.WalletAddress = redact(entry.WalletAddress)
+	entry.LinkedWallets = redactAll(entry.LinkedWallets)
+	if owner, ok := entry.Value["owner"].(string); ok {
+		entry.Value["owner"] = redact(owner)
+	}
+	if addrs, ok := entry.Value["wallets"].([]string); ok {
+		entry.Value["wallets"] = redactAll(addrs)
+	}
+	return entry
+}
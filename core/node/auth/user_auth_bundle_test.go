@@ -0,0 +1,134 @@
+package auth
+
+import (
+	"encoding/json"
+	"flag"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+
+	"github.com/towns-protocol/towns/core/config"
+	"github.com/towns-protocol/towns/core/contracts/base"
+	"github.com/towns-protocol/towns/core/contracts/types"
+	"github.com/towns-protocol/towns/core/node/base/test"
+	"github.com/towns-protocol/towns/core/node/shared"
+)
+
+var updateGolden = flag.Bool("update", false, "update the golden files of the tests")
+
+func TestCollectUserAuthBundle(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	principal := common.HexToAddress("0x9a")
+	linked := common.HexToAddress("0x11")
+	delegated := common.HexToAddress("0x22")
+	other := common.HexToAddress("0x0f")
+	spaceContract := newFakeSpaceContract(common.HexToAddress("0x0e"), linked, other)
+	spaceContract.entitlements = []types.Entitlement{{
+		EntitlementType: types.ModuleTypeUserEntitlement,
+		UserEntitlement: []common.Address{linked, other},
+	}}
+	spaceContract.banned[delegated] = true
+	ca := newTestChainAuth(t, ctx, spaceContract)
+	defer ca.Close()
+	walletLink, err := base.NewWalletLink(
+		common.HexToAddress("0xabc"),
+		&fakeWalletLinkBackend{t: t, walletsByRootKey: map[common.Address][]common.Address{principal: {linked}}},
+	)
+	require.NoError(t, err)
+	evaluator := &fakeLinkedWalletsEvaluator{wallets: map[common.Address][]common.Address{
+		principal: {principal, linked, delegated},
+		other:     {other},
+	}}
+	ca.walletResolver = &WalletResolver{evaluator: evaluator, walletLink: walletLink}
+	spaceId := shared.SpaceIdFromAddress(common.HexToAddress("0x5bace"))
+	otherSpaceId := shared.SpaceIdFromAddress(common.HexToAddress("0x07"))
+
+	for _, args := range []*ChainAuthArgs{
+		NewChainAuthArgsForSpace(spaceId, principal.Hex(), PermissionWrite),
+		NewChainAuthArgsForSpace(spaceId, other.Hex(), PermissionWrite),
+		NewChainAuthArgsForSpace(otherSpaceId, principal.Hex(), PermissionWrite),
+		NewChainAuthArgsForSpace(spaceId, principal.Hex(), PermissionWrite),
+	} {
+		_, err := ca.IsEntitled(ctx, cfg, args)
+		require.NoError(t, err)
+	}
+
+	bundle, err := ca.CollectUserAuthBundle(ctx, spaceId, principal)
+	require.NoError(t, err)
+
+	// The bundle only holds the data of the principal in the space, other users are redacted.
+	require.Len(t, bundle.RecentDecisions, 2)
+	for _, record := range bundle.RecentDecisions {
+		require.Equal(t, principal, record.Principal)
+		require.Equal(t, spaceId, record.SpaceId)
+	}
+	data, err := json.Marshal(bundle)
+	require.NoError(t, err)
+	require.NotContains(t, strings.ToLower(string(data)), strings.ToLower(other.Hex()))
+
+	// Compare the shape of the bundle without the times, the cache entries are ordered as the membership
+	// checks of the wallets run in parallel.
+	bundle.Timestamp = time.Time{}
+	for i := range bundle.RecentDecisions {
+		bundle.RecentDecisions[i].Timestamp = time.Time{}
+	}
+	for i := range bundle.CacheEntries {
+		bundle.CacheEntries[i].StoredAt = time.Time{}
+		bundle.CacheEntries[i].ExpiresAt = time.Time{}
+	}
+	slices.SortStableFunc(bundle.CacheEntries, func(a, b CacheDumpEntry) int {
+		return strings.Compare(a.Cache+a.Kind+a.Principal+a.WalletAddress, b.Cache+b.Kind+b.Principal+b.WalletAddress)
+	})
+	data, err = json.MarshalIndent(bundle, "", "  ")
+	require.NoError(t, err)
+	data = append(data, '\n')
+
+	golden := "testdata/user_auth_bundle.json"
+	if *updateGolden {
+		require.NoError(t, os.WriteFile(golden, data, 0o644))
+	}
+	expected, err := os.ReadFile(golden)
+	require.NoError(t, err)
+	require.Equal(t, string(expected), string(data))
+
+	_, err = ca.CollectUserAuthBundle(ctx, shared.StreamId{}, principal)
+	require.Error(t, err)
+}
+
+func TestAuditBuffer(t *testing.T) {
+	buffer := newAuditBuffer(&config.ChainConfig{EntitlementAuditBufferSize: 3})
+	alice := common.HexToAddress("0xa11ce")
+	bob := common.HexToAddress("0xb0b")
+	for i, principal := range []common.Address{alice, bob, alice, alice, bob} {
+		require.NoError(t, buffer.Write(AuditRecord{Principal: principal, BlockNumber: uint64(i)}))
+	}
+
+	// The oldest records are replaced, the latest come first.
+	blocks := func(records []AuditRecord) []uint64 {
+		var ret []uint64
+		for _, record := range records {
+			ret = append(ret, record.BlockNumber)
+		}
+		return ret
+	}
+	records, truncated := buffer.recent(func(*AuditRecord) bool { return true }, 10)
+	require.Equal(t, []uint64{4, 3, 2}, blocks(records))
+	require.False(t, truncated)
+	records, truncated = buffer.recent(func(r *AuditRecord) bool { return r.Principal == alice }, 1)
+	require.Equal(t, []uint64{3}, blocks(records))
+	require.True(t, truncated)
+
+	disabled := newAuditBuffer(&config.ChainConfig{EntitlementAuditBufferSize: -1})
+	require.False(t, disabled.enabled())
+	require.NoError(t, disabled.Write(AuditRecord{Principal: alice}))
+	records, _ = disabled.recent(func(*AuditRecord) bool { return true }, 10)
+	require.Empty(t, records)
+}
@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	ethCrypto "github.com/ethereum/go-ethereum/crypto"
+
+	"github.com/towns-protocol/towns/core/config"
+	. "github.com/towns-protocol/towns/core/node/base"
+	. "github.com/towns-protocol/towns/core/node/protocol"
+)
+
+// LinkedWalletMessage is the message of the wallet link signatures created by the clients.
+const LinkedWalletMessage = "Link your external wallet"
+
+var (
+	eip712DomainTypeHash = ethCrypto.Keccak256Hash(
+		[]byte("EIP712Domain(string name,string version,uint256 chainId,address verifyingContract)"),
+	)
+	linkedWalletTypeHash = ethCrypto.Keccak256Hash([]byte("LinkedWallet(string message,address userID,uint256 nonce)"))
+	// walletLinkDomainName and walletLinkDomainVersion are the EIP-712 domain of the wallet link facet.
+	walletLinkDomainName    = ethCrypto.Keccak256Hash([]byte("SpaceFactory"))
+	walletLinkDomainVersion = ethCrypto.Keccak256Hash([]byte("1"))
+)
+
+// walletLinkDigest returns the EIP-712 digest the root key signs to link wallet, as computed by the wallet
+// link contract of the given chain and address.
+func walletLinkDigest(
+	chainId *big.Int,
+	walletLinkAddress common.Address,
+	wallet common.Address,
+	nonce *big.Int,
+) common.Hash {
+	domainSeparator := ethCrypto.Keccak256(
+		eip712DomainTypeHash[:],
+		walletLinkDomainName[:],
+		walletLinkDomainVersion[:],
+		math.U256Bytes(new(big.Int).Set(chainId)),
+		common.LeftPadBytes(walletLinkAddress[:], 32),
+	)
+	structHash := ethCrypto.Keccak256(
+		linkedWalletTypeHash[:],
+		ethCrypto.Keccak256([]byte(LinkedWalletMessage)),
+		common.LeftPadBytes(wallet[:], 32),
+		math.U256Bytes(new(big.Int).Set(nonce)),
+	)
+	return ethCrypto.Keccak256Hash([]byte{0x19, 0x01}, domainSeparator, structHash)
+}
+
+// recoverSigner returns the address that signed digest. Signatures with a recovery id of 27 or 28, as
+// returned by wallets, are accepted along with those of 0 or 1.
+func recoverSigner(digest common.Hash, signature []byte) (common.Address, error) {
+	if len(signature) != ethCrypto.SignatureLength {
+		return common.Address{}, RiverError(Err_INVALID_ARGUMENT, "Invalid signature length").
+			Tag("length", len(signature))
+	}
+	sig := common.CopyBytes(signature)
+	if sig[ethCrypto.RecoveryIDOffset] >= 27 {
+		sig[ethCrypto.RecoveryIDOffset] -= 27
+	}
+	pubKey, err := ethCrypto.SigToPub(digest[:], sig)
+	if err != nil {
+		return common.Address{}, AsRiverError(err, Err_INVALID_ARGUMENT).Message("Invalid signature")
+	}
+	return ethCrypto.PubkeyToAddress(*pubKey), nil
+}
+
+// VerifyWalletLink returns true if signature is the signature by rootKey of the link of wallet with the next
+// nonce of rootKey, i.e. the proof the root key gives to link the wallet that the wallet link contract has
+// not indexed yet. Only signatures of externally owned accounts are verified.
+func (ca *chainAuth) VerifyWalletLink(
+	ctx context.Context,
+	cfg *config.Config,
+	rootKey common.Address,
+	wallet common.Address,
+	signature []byte,
+) (bool, error) {
+	if !ca.walletResolver.hasWalletLink() || ca.blockchain.ChainId == nil {
+		return false, RiverError(Err_UNAVAILABLE, "Wallet link contract is not configured").Func("VerifyWalletLink")
+	}
+	if err := ca.readOnly.check("wallet_link"); err != nil {
+		return false, AsRiverError(err).Func("VerifyWalletLink")
+	}
+
+	// The contract accepts a link signed with the current nonce of the root key, and increments it.
+	nonce, err := ca.walletResolver.walletLink.GetLatestNonceForRootKey(&bind.CallOpts{Context: ctx}, rootKey)
+	if err != nil {
+		return false, AsRiverError(err, Err_CANNOT_CALL_CONTRACT).
+			Func("VerifyWalletLink").
+			Message("Failed to get the nonce of the root key").
+			Tag("rootKey", rootKey)
+	}
+
+	signer, err := recoverSigner(walletLinkDigest(ca.blockchain.ChainId, ca.walletLinkAddress, wallet, nonce), signature)
+	if err != nil {
+		return false, AsRiverError(err).Func("VerifyWalletLink").Tag("rootKey", rootKey).Tag("wallet", wallet)
+	}
+	return signer == rootKey, nil
+}
@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/math"
+	ethCrypto "github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+	"github.com/stretchr/testify/require"
+
+	"github.com/towns-protocol/towns/core/config"
+	"github.com/towns-protocol/towns/core/contracts/base"
+	. "github.com/towns-protocol/towns/core/node/base"
+	"github.com/towns-protocol/towns/core/node/base/test"
+	. "github.com/towns-protocol/towns/core/node/protocol"
+)
+
+func TestWalletLinkDigest(t *testing.T) {
+	chainId := big.NewInt(8453)
+	walletLinkAddress := common.HexToAddress("0x9978c826d93883701522d2ca645d5436e5654252")
+	wallet := common.HexToAddress("0xb0b")
+	nonce := big.NewInt(3)
+
+	// The digest matches the typed data the clients sign.
+	expected, _, err := apitypes.TypedDataAndHash(apitypes.TypedData{
+		Types: apitypes.Types{
+			"EIP712Domain": {
+				{Name: "name", Type: "string"},
+				{Name: "version", Type: "string"},
+				{Name: "chainId", Type: "uint256"},
+				{Name: "verifyingContract", Type: "address"},
+			},
+			"LinkedWallet": {
+				{Name: "message", Type: "string"},
+				{Name: "userID", Type: "address"},
+				{Name: "nonce", Type: "uint256"},
+			},
+		},
+		PrimaryType: "LinkedWallet",
+		Domain: apitypes.TypedDataDomain{
+			Name:              "SpaceFactory",
+			Version:           "1",
+			ChainId:           (*math.HexOrDecimal256)(chainId),
+			VerifyingContract: walletLinkAddress.Hex(),
+		},
+		Message: apitypes.TypedDataMessage{
+			"message": LinkedWalletMessage,
+			"userID":  wallet.Hex(),
+			"nonce":   nonce,
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, common.BytesToHash(expected), walletLinkDigest(chainId, walletLinkAddress, wallet, nonce))
+}
+
+func TestVerifyWalletLink(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	cfg := &config.Config{}
+	rootKey, err := ethCrypto.GenerateKey()
+	require.NoError(t, err)
+	rootKeyAddress := ethCrypto.PubkeyToAddress(rootKey.PublicKey)
+	wallet := common.HexToAddress("0xb0b")
+	walletLinkAddress := common.HexToAddress("0xabc")
+	chainId := big.NewInt(8453)
+
+	ca := newTestChainAuth(t, ctx, newFakeSpaceContract(common.HexToAddress("0x0e")))
+	defer ca.Close()
+
+	// Without a wallet link contract links can't be verified.
+	_, err = ca.VerifyWalletLink(ctx, cfg, rootKeyAddress, wallet, nil)
+	require.Equal(t, Err_UNAVAILABLE, AsRiverError(err).Code)
+
+	walletLink, err := base.NewWalletLink(walletLinkAddress, &fakeWalletLinkBackend{
+		t:      t,
+		nonces: map[common.Address]*big.Int{rootKeyAddress: big.NewInt(2)},
+	})
+	require.NoError(t, err)
+	ca.walletResolver = &WalletResolver{walletLink: walletLink}
+	ca.walletLinkAddress = walletLinkAddress
+	ca.blockchain.ChainId = chainId
+
+	sign := func(wallet common.Address, nonce int64) []byte {
+		digest := walletLinkDigest(chainId, walletLinkAddress, wallet, big.NewInt(nonce))
+		signature, err := ethCrypto.Sign(digest[:], rootKey)
+		require.NoError(t, err)
+		// Wallets return signatures with a recovery id of 27 or 28.
+		signature[ethCrypto.RecoveryIDOffset] += 27
+		return signature
+	}
+
+	// The link is signed by the root key with its current nonce.
+	verified, err := ca.VerifyWalletLink(ctx, cfg, rootKeyAddress, wallet, sign(wallet, 2))
+	require.NoError(t, err)
+	require.True(t, verified)
+
+	// Signatures of another wallet, with a used nonce or by another key don't prove the link.
+	verified, err = ca.VerifyWalletLink(ctx, cfg, rootKeyAddress, wallet, sign(common.HexToAddress("0xa11ce"), 2))
+	require.NoError(t, err)
+	require.False(t, verified)
+	verified, err = ca.VerifyWalletLink(ctx, cfg, rootKeyAddress, wallet, sign(wallet, 1))
+	require.NoError(t, err)
+	require.False(t, verified)
+	verified, err = ca.VerifyWalletLink(ctx, cfg, wallet, wallet, sign(wallet, 0))
+	require.NoError(t, err)
+	require.False(t, verified)
+
+	// Malformed signatures are rejected.
+	_, err = ca.VerifyWalletLink(ctx, cfg, rootKeyAddress, wallet, []byte{1, 2, 3})
+	require.Equal(t, Err_INVALID_ARGUMENT, AsRiverError(err).Code)
+}
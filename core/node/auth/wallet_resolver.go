@@ -0,0 +1,116 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/towns-protocol/towns/core/contracts/base"
+	"github.com/towns-protocol/towns/core/node/infra"
+	"github.com/towns-protocol/towns/core/node/logging"
+	"github.com/towns-protocol/towns/core/xchain/entitlement"
+)
+
+// linkedWalletsEvaluator is implemented by entitlement.Evaluator.
+type linkedWalletsEvaluator interface {
+	GetLinkedWallets(
+		ctx context.Context,
+		wallet common.Address,
+		maxWallets int,
+		walletLink *base.WalletLink,
+		callDurations *prometheus.HistogramVec,
+		getRootKeyForWalletCalls *infra.StatusCounterVec,
+		getWalletsByRootKeyCalls *infra.StatusCounterVec,
+	) ([]common.Address, error)
+}
+
+// WalletResolverMetrics holds the optional metrics of the wallet link contract calls made by a WalletResolver.
+type WalletResolverMetrics struct {
+	CallDurations            *prometheus.HistogramVec
+	GetRootKeyForWalletCalls *infra.StatusCounterVec
+	GetWalletsByRootKeyCalls *infra.StatusCounterVec
+}
+
+// WalletResolver resolves the wallets linked to a wallet through the wallet link contract, including the
+// wallets that delegated to them on Ethereum mainnet. It does not cache results and does not depend on the
+// space contract, so it can be used by the xchain node as well as by chainAuth.
+type WalletResolver struct {
+	evaluator  linkedWalletsEvaluator
+	walletLink *base.WalletLink
+	metrics    WalletResolverMetrics
+}
+
+// NewWalletResolver creates a WalletResolver. If walletLink is nil wallets are resolved to themselves.
+func NewWalletResolver(
+	evaluator *entitlement.Evaluator,
+	walletLink *base.WalletLink,
+	metrics WalletResolverMetrics,
+) *WalletResolver {
+	return &WalletResolver{
+		evaluator:  evaluator,
+		walletLink: walletLink,
+		metrics:    metrics,
+	}
+}
+
+func (r *WalletResolver) hasWalletLink() bool {
+	return r.walletLink != nil
+}
+
+// LinkedWallets returns the root key of the wallet and all wallets linked to it, including the wallet itself.
+// It fails with entitlement.ErrTooManyLinkedWallets as soon as there are more than maxWallets, 0 means no
+// maximum. The links are resolved with a fixed number of calls whatever their shape, cycles in the wallet link
+// contract are not followed.
+func (r *WalletResolver) LinkedWallets(
+	ctx context.Context,
+	wallet common.Address,
+	maxWallets int,
+) ([]common.Address, error) {
+	if !r.hasWalletLink() {
+		logging.FromCtx(ctx).Warnw("Wallet link contract is not setup properly, returning root key only")
+		return []common.Address{wallet}, nil
+	}
+
+	return r.evaluator.GetLinkedWallets(
+		ctx,
+		wallet,
+		maxWallets,
+		r.walletLink,
+		r.metrics.CallDurations,
+		r.metrics.GetRootKeyForWalletCalls,
+		r.metrics.GetWalletsByRootKeyCalls,
+	)
+}
+
+// BaseChainLinkedWallets returns the wallets linked to the wallet like LinkedWallets, without the wallets that
+// delegated to them on Ethereum mainnet. It only reads the wallet link contract, so it answers when the
+// cross-chain evaluator is unavailable.
+func (r *WalletResolver) BaseChainLinkedWallets(
+	ctx context.Context,
+	wallet common.Address,
+	maxWallets int,
+) ([]common.Address, error) {
+	if !r.hasWalletLink() {
+		return []common.Address{wallet}, nil
+	}
+
+	return entitlement.GetBaseChainLinkedWallets(
+		ctx,
+		wallet,
+		maxWallets,
+		r.walletLink,
+		r.metrics.CallDurations,
+		r.metrics.GetRootKeyForWalletCalls,
+		r.metrics.GetWalletsByRootKeyCalls,
+	)
+}
+
+// RootKey returns the root key the wallet is linked to, or the zero address if the wallet is not linked.
+func (r *WalletResolver) RootKey(ctx context.Context, wallet common.Address) (common.Address, error) {
+	if !r.hasWalletLink() {
+		return common.Address{}, nil
+	}
+	return r.walletLink.GetRootKeyForWallet(&bind.CallOpts{Context: ctx}, wallet)
+}
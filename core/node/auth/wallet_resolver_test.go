@@ -0,0 +1,173 @@
+package auth
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/towns-protocol/towns/core/contracts/base"
+	"github.com/towns-protocol/towns/core/node/base/test"
+	"github.com/towns-protocol/towns/core/node/infra"
+	"github.com/towns-protocol/towns/core/xchain/entitlement"
+)
+
+// fakeWalletLinkBackend answers the calls of the wallet link contract, or fails them with err if set.
+type fakeWalletLinkBackend struct {
+	bind.ContractBackend
+
+	t                *testing.T
+	rootKeys         map[common.Address]common.Address
+	walletsByRootKey map[common.Address][]common.Address
+	nonces           map[common.Address]*big.Int
+	err              error
+	calls            int
+}
+
+func (b *fakeWalletLinkBackend) CallContract(
+	_ context.Context,
+	call ethereum.CallMsg,
+	_ *big.Int,
+) ([]byte, error) {
+	b.calls++
+	if b.err != nil {
+		return nil, b.err
+	}
+	walletLinkAbi, err := base.WalletLinkMetaData.GetAbi()
+	require.NoError(b.t, err)
+	method, err := walletLinkAbi.MethodById(call.Data[:4])
+	require.NoError(b.t, err)
+	args, err := method.Inputs.Unpack(call.Data[4:])
+	require.NoError(b.t, err)
+	switch method.Name {
+	case "getRootKeyForWallet":
+		return method.Outputs.Pack(b.rootKeys[args[0].(common.Address)])
+	case "getWalletsByRootKey":
+		wallets := b.walletsByRootKey[args[0].(common.Address)]
+		if wallets == nil {
+			wallets = []common.Address{}
+		}
+		return method.Outputs.Pack(wallets)
+	case "getLatestNonceForRootKey":
+		nonce, ok := b.nonces[args[0].(common.Address)]
+		if !ok {
+			nonce = big.NewInt(0)
+		}
+		return method.Outputs.Pack(nonce)
+	}
+	require.FailNow(b.t, "unexpected wallet link call", method.Name)
+	return nil, nil
+}
+
+// fakeLinkedWalletsEvaluator returns the linked wallets configured by the test, or fails like
+// entitlement.Evaluator if there are more than the maximum of the lookup.
+type fakeLinkedWalletsEvaluator struct {
+	wallets       map[common.Address][]common.Address
+	callDurations *prometheus.HistogramVec
+	maxWallets    int
+}
+
+func (e *fakeLinkedWalletsEvaluator) GetLinkedWallets(
+	_ context.Context,
+	wallet common.Address,
+	maxWallets int,
+	_ *base.WalletLink,
+	callDurations *prometheus.HistogramVec,
+	_ *infra.StatusCounterVec,
+	_ *infra.StatusCounterVec,
+) ([]common.Address, error) {
+	e.callDurations = callDurations
+	e.maxWallets = maxWallets
+	if maxWallets > 0 && len(e.wallets[wallet]) > maxWallets {
+		return nil, entitlement.ErrTooManyLinkedWallets
+	}
+	return e.wallets[wallet], nil
+}
+
+func TestWalletResolver(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	rootKey := common.HexToAddress("0x1")
+	wallet := common.HexToAddress("0x2")
+	unlinked := common.HexToAddress("0x3")
+
+	walletLink, err := base.NewWalletLink(
+		common.HexToAddress("0xabc"),
+		&fakeWalletLinkBackend{t: t, rootKeys: map[common.Address]common.Address{wallet: rootKey}},
+	)
+	require.NoError(t, err)
+
+	metrics := WalletResolverMetrics{
+		CallDurations: prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "durations"}, []string{"op"}),
+	}
+	evaluator := &fakeLinkedWalletsEvaluator{
+		wallets: map[common.Address][]common.Address{wallet: {wallet, rootKey}},
+	}
+	resolver := &WalletResolver{evaluator: evaluator, walletLink: walletLink, metrics: metrics}
+
+	wallets, err := resolver.LinkedWallets(ctx, wallet, 0)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []common.Address{wallet, rootKey}, wallets)
+	require.Same(t, metrics.CallDurations, evaluator.callDurations)
+
+	key, err := resolver.RootKey(ctx, wallet)
+	require.NoError(t, err)
+	require.Equal(t, rootKey, key)
+
+	key, err = resolver.RootKey(ctx, unlinked)
+	require.NoError(t, err)
+	require.Equal(t, common.Address{}, key)
+
+	// Without a wallet link contract wallets resolve to themselves.
+	resolver = NewWalletResolver(nil, nil, WalletResolverMetrics{})
+	wallets, err = resolver.LinkedWallets(ctx, wallet, 0)
+	require.NoError(t, err)
+	require.Equal(t, []common.Address{wallet}, wallets)
+
+	key, err = resolver.RootKey(ctx, wallet)
+	require.NoError(t, err)
+	require.Equal(t, common.Address{}, key)
+}
+
+func TestWalletResolverLinkCycles(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	alice := common.HexToAddress("0xa11ce")
+	bob := common.HexToAddress("0xb0b")
+	for name, tc := range map[string]struct {
+		rootKeys         map[common.Address]common.Address
+		walletsByRootKey map[common.Address][]common.Address
+		expected         []common.Address
+	}{
+		"self-link": {
+			rootKeys:         map[common.Address]common.Address{alice: alice},
+			walletsByRootKey: map[common.Address][]common.Address{alice: {alice}},
+			expected:         []common.Address{alice},
+		},
+		"cycle": {
+			rootKeys:         map[common.Address]common.Address{alice: bob, bob: alice},
+			walletsByRootKey: map[common.Address][]common.Address{alice: {bob}, bob: {alice}},
+			expected:         []common.Address{alice, bob},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			backend := &fakeWalletLinkBackend{t: t, rootKeys: tc.rootKeys, walletsByRootKey: tc.walletsByRootKey}
+			walletLink, err := base.NewWalletLink(common.HexToAddress("0xabc"), backend)
+			require.NoError(t, err)
+			resolver := &WalletResolver{walletLink: walletLink}
+
+			// The links are resolved in a single hop, the root key and its wallets, whatever their shape.
+			wallets, err := resolver.BaseChainLinkedWallets(ctx, alice, 0)
+			require.NoError(t, err)
+			require.ElementsMatch(t, tc.expected, wallets)
+			require.Equal(t, 2, backend.calls)
+		})
+	}
+}
@@ -0,0 +1,271 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/towns-protocol/towns/core/config"
+	"github.com/towns-protocol/towns/core/node/infra"
+	"github.com/towns-protocol/towns/core/node/shared"
+)
+
+const (
+	DEFAULT_WORK_QUEUE_SIZE              = 1000
+	DEFAULT_WORK_QUEUE_CONCURRENCY       = 8
+	DEFAULT_WORK_QUEUE_SPACE_CONCURRENCY = 2
+)
+
+// workPriority orders the background work of chainAuth, work of a higher priority always runs first.
+type workPriority int
+
+const (
+	// workPriorityAudit is for the re-validation of cached decisions, such as dual reads.
+	workPriorityAudit workPriority = iota
+	// workPriorityRefresh is for refreshing cached decisions before they expire.
+	workPriorityRefresh
+	// workPriorityPrefetch is for resolving decisions users are about to need, such as join pre-warming.
+	workPriorityPrefetch
+
+	numWorkPriorities
+)
+
+func (p workPriority) String() string {
+	switch p {
+	case workPriorityAudit:
+		return "audit"
+	case workPriorityRefresh:
+		return "refresh"
+	case workPriorityPrefetch:
+		return "prefetch"
+	default:
+		return "unknown"
+	}
+}
+
+// workTask is a unit of background work scheduled on the workQueue.
+type workTask struct {
+	priority workPriority
+	// spaceId is the space the work is for, the work of a space is subject to the per-space concurrency cap.
+	// Work that isn't for a space leaves it zero.
+	spaceId shared.StreamId
+	// deadline is the time by which the work is no longer useful. Work that can't start before its deadline
+	// is dropped, and the context of running work is cancelled at the deadline. Zero for no deadline.
+	deadline time.Time
+	run      func(ctx context.Context)
+	// dropped is called instead of run if the work is dropped, e.g. to release the budget reserved for it.
+	// It can be nil.
+	dropped func()
+}
+
+type queuedWork struct {
+	ctx  context.Context
+	task *workTask
+}
+
+// workQueue schedules the background work of chainAuth, so that event-driven work such as join pre-warming
+// doesn't compete with user-facing checks, nor with more important background work, for the chain. The work
+// runs by priority, then in submission order, under a global and a per-space concurrency cap. The size of
+// the queue is bounded, on overflow the oldest work of the lowest priority is dropped, or the submitted work
+// itself if all queued work is more important.
+type workQueue struct {
+	maxSize          int
+	concurrency      int
+	spaceConcurrency int
+	// start runs the work in a background goroutine, see chainAuth.startWorker.
+	start func(ctx context.Context, f func(ctx context.Context)) error
+
+	mu             sync.Mutex
+	closed         bool
+	pending        [numWorkPriorities][]*queuedWork
+	size           int
+	running        int
+	runningBySpace map[shared.StreamId]int
+
+	// tasks counts the submitted work by priority and outcome: executed, dropped or expired.
+	tasks *prometheus.CounterVec
+	// depth is the number of queued work items by priority.
+	depth *prometheus.GaugeVec
+}
+
+func newWorkQueue(
+	cfg *config.ChainConfig,
+	metrics infra.MetricsFactory,
+	start func(ctx context.Context, f func(ctx context.Context)) error,
+) *workQueue {
+	maxSize := DEFAULT_WORK_QUEUE_SIZE
+	if cfg.EntitlementWorkQueueSize > 0 {
+		maxSize = cfg.EntitlementWorkQueueSize
+	}
+	concurrency := DEFAULT_WORK_QUEUE_CONCURRENCY
+	if cfg.EntitlementWorkQueueConcurrency > 0 {
+		concurrency = cfg.EntitlementWorkQueueConcurrency
+	}
+	spaceConcurrency := DEFAULT_WORK_QUEUE_SPACE_CONCURRENCY
+	if cfg.EntitlementWorkQueueSpaceConcurrency > 0 {
+		spaceConcurrency = cfg.EntitlementWorkQueueSpaceConcurrency
+	}
+
+	return &workQueue{
+		maxSize:          maxSize,
+		concurrency:      concurrency,
+		spaceConcurrency: spaceConcurrency,
+		start:            start,
+		runningBySpace:   make(map[shared.StreamId]int),
+		tasks: metrics.NewCounterVecEx(
+			"entitlement_work_queue_tasks", "Background entitlement work by priority and outcome", "priority", "result"),
+		depth: metrics.NewGaugeVecEx(
+			"entitlement_work_queue_depth", "Background entitlement work waiting to run by priority", "priority"),
+	}
+}
+
+// submit queues the task and starts the queued work the concurrency caps allow. The task runs with a context
+// derived from ctx, which must outlive the caller if the work does.
+func (q *workQueue) submit(ctx context.Context, task *workTask) {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		q.drop(task, "dropped")
+		return
+	}
+
+	var overflow *workTask
+	if q.size >= q.maxSize {
+		victim := q.takeOldest(task.priority)
+		if victim == nil {
+			q.mu.Unlock()
+			q.drop(task, "dropped")
+			return
+		}
+		overflow = victim.task
+	}
+	q.pending[task.priority] = append(q.pending[task.priority], &queuedWork{ctx: ctx, task: task})
+	q.size++
+	q.depth.WithLabelValues(task.priority.String()).Inc()
+	runnable, expired := q.takeRunnable()
+	q.mu.Unlock()
+
+	if overflow != nil {
+		q.drop(overflow, "dropped")
+	}
+	q.startAll(runnable, expired)
+}
+
+// takeOldest removes and returns the oldest queued work of the lowest priority up to maxPriority, nil if all
+// queued work is of a higher priority. Must be called with q.mu held.
+func (q *workQueue) takeOldest(maxPriority workPriority) *queuedWork {
+	for priority := workPriorityAudit; priority <= maxPriority; priority++ {
+		if len(q.pending[priority]) > 0 {
+			return q.remove(priority, 0)
+		}
+	}
+	return nil
+}
+
+// takeRunnable removes and returns the queued work that can start within the concurrency caps, along with
+// the work that expired while queued. Must be called with q.mu held.
+func (q *workQueue) takeRunnable() (runnable []*queuedWork, expired []*queuedWork) {
+	if q.closed {
+		return nil, nil
+	}
+
+	now := time.Now()
+	for priority := numWorkPriorities - 1; priority >= workPriorityAudit; priority-- {
+		for i := 0; i < len(q.pending[priority]) && q.running < q.concurrency; {
+			work := q.pending[priority][i]
+			if !work.task.deadline.IsZero() && now.After(work.task.deadline) {
+				expired = append(expired, q.remove(priority, i))
+				continue
+			}
+			spaceId := work.task.spaceId
+			if spaceId != (shared.StreamId{}) && q.runningBySpace[spaceId] >= q.spaceConcurrency {
+				i++
+				continue
+			}
+			runnable = append(runnable, q.remove(priority, i))
+			q.running++
+			if spaceId != (shared.StreamId{}) {
+				q.runningBySpace[spaceId]++
+			}
+		}
+	}
+	return runnable, expired
+}
+
+// remove removes and returns the i-th queued work of the priority. Must be called with q.mu held.
+func (q *workQueue) remove(priority workPriority, i int) *queuedWork {
+	work := q.pending[priority][i]
+	q.pending[priority] = append(q.pending[priority][:i], q.pending[priority][i+1:]...)
+	q.size--
+	q.depth.WithLabelValues(priority.String()).Dec()
+	return work
+}
+
+func (q *workQueue) startAll(runnable []*queuedWork, expired []*queuedWork) {
+	for _, work := range expired {
+		q.drop(work.task, "expired")
+	}
+	for _, work := range runnable {
+		q.run(work)
+	}
+}
+
+func (q *workQueue) run(work *queuedWork) {
+	ctx := work.ctx
+	cancel := context.CancelFunc(func() {})
+	if !work.task.deadline.IsZero() {
+		ctx, cancel = context.WithDeadline(ctx, work.task.deadline)
+	}
+	err := q.start(ctx, func(ctx context.Context) {
+		defer q.finish(work.task)
+		defer cancel()
+		work.task.run(ctx)
+		q.tasks.WithLabelValues(work.task.priority.String(), "executed").Inc()
+	})
+	if err != nil {
+		cancel()
+		q.drop(work.task, "dropped")
+		q.finish(work.task)
+	}
+}
+
+// finish releases the concurrency slots of the task and starts the queued work that can run in its place.
+func (q *workQueue) finish(task *workTask) {
+	q.mu.Lock()
+	q.running--
+	if task.spaceId != (shared.StreamId{}) {
+		if q.runningBySpace[task.spaceId]--; q.runningBySpace[task.spaceId] == 0 {
+			delete(q.runningBySpace, task.spaceId)
+		}
+	}
+	runnable, expired := q.takeRunnable()
+	q.mu.Unlock()
+
+	q.startAll(runnable, expired)
+}
+
+func (q *workQueue) drop(task *workTask, result string) {
+	q.tasks.WithLabelValues(task.priority.String(), result).Inc()
+	if task.dropped != nil {
+		task.dropped()
+	}
+}
+
+// close drops the queued work and the work submitted afterwards. Running work is not waited for.
+func (q *workQueue) close() {
+	q.mu.Lock()
+	q.closed = true
+	var dropped []*queuedWork
+	for priority := range q.pending {
+		for len(q.pending[priority]) > 0 {
+			dropped = append(dropped, q.remove(workPriority(priority), 0))
+		}
+	}
+	q.mu.Unlock()
+
+	for _, work := range dropped {
+		q.drop(work.task, "dropped")
+	}
+}
@@ -0,0 +1,202 @@
+package auth
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+
+	"github.com/towns-protocol/towns/core/config"
+	"github.com/towns-protocol/towns/core/node/base/test"
+	"github.com/towns-protocol/towns/core/node/infra"
+	"github.com/towns-protocol/towns/core/node/shared"
+	"github.com/towns-protocol/towns/core/node/testutils"
+)
+
+// workQueueRecorder records the order work submitted to a workQueue runs or is dropped in.
+type workQueueRecorder struct {
+	mu      sync.Mutex
+	ran     []string
+	dropped []string
+	done    chan struct{}
+}
+
+func newWorkQueueRecorder() *workQueueRecorder {
+	return &workQueueRecorder{done: make(chan struct{}, 100)}
+}
+
+func (r *workQueueRecorder) task(name string, priority workPriority, spaceId shared.StreamId) *workTask {
+	return &workTask{
+		priority: priority,
+		spaceId:  spaceId,
+		run: func(context.Context) {
+			r.mu.Lock()
+			r.ran = append(r.ran, name)
+			r.mu.Unlock()
+			r.done <- struct{}{}
+		},
+		dropped: func() {
+			r.mu.Lock()
+			r.dropped = append(r.dropped, name)
+			r.mu.Unlock()
+		},
+	}
+}
+
+func (r *workQueueRecorder) ranTasks() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.ran)
+}
+
+func (r *workQueueRecorder) droppedTasks() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Clone(r.dropped)
+}
+
+func (r *workQueueRecorder) wait(t *testing.T, n int) {
+	for range n {
+		select {
+		case <-r.done:
+		case <-time.After(5 * time.Second):
+			require.FailNow(t, "work didn't run")
+		}
+	}
+}
+
+// blockingTask returns a task that runs until release is called.
+func blockingTask(priority workPriority, spaceId shared.StreamId) (*workTask, func()) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	task := &workTask{
+		priority: priority,
+		spaceId:  spaceId,
+		run: func(context.Context) {
+			close(started)
+			<-release
+		},
+	}
+	return task, func() {
+		<-started
+		close(release)
+	}
+}
+
+func newTestWorkQueue(cfg *config.ChainConfig) *workQueue {
+	return newWorkQueue(
+		cfg,
+		infra.NewMetricsFactory(prometheus.NewRegistry(), "", ""),
+		func(ctx context.Context, f func(ctx context.Context)) error {
+			go f(ctx)
+			return nil
+		},
+	)
+}
+
+func TestWorkQueuePriority(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	q := newTestWorkQueue(&config.ChainConfig{EntitlementWorkQueueConcurrency: 1})
+	r := newWorkQueueRecorder()
+
+	blocker, release := blockingTask(workPriorityAudit, shared.StreamId{})
+	q.submit(ctx, blocker)
+	q.submit(ctx, r.task("audit", workPriorityAudit, shared.StreamId{}))
+	q.submit(ctx, r.task("refresh", workPriorityRefresh, shared.StreamId{}))
+	q.submit(ctx, r.task("prefetch1", workPriorityPrefetch, shared.StreamId{}))
+	q.submit(ctx, r.task("prefetch2", workPriorityPrefetch, shared.StreamId{}))
+	require.Equal(t, 4.0, testutil.ToFloat64(q.depth.WithLabelValues("prefetch"))+
+		testutil.ToFloat64(q.depth.WithLabelValues("refresh"))+
+		testutil.ToFloat64(q.depth.WithLabelValues("audit")))
+
+	// Queued work runs by priority, then in submission order.
+	release()
+	r.wait(t, 4)
+	require.Equal(t, []string{"prefetch1", "prefetch2", "refresh", "audit"}, r.ranTasks())
+	require.Empty(t, r.droppedTasks())
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(q.tasks.WithLabelValues("audit", "executed")) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, 2.0, testutil.ToFloat64(q.tasks.WithLabelValues("prefetch", "executed")))
+}
+
+func TestWorkQueueSpaceConcurrency(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	q := newTestWorkQueue(&config.ChainConfig{
+		EntitlementWorkQueueConcurrency:      2,
+		EntitlementWorkQueueSpaceConcurrency: 1,
+	})
+	r := newWorkQueueRecorder()
+	busy := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+	idle := testutils.FakeStreamId(shared.STREAM_SPACE_BIN)
+
+	// Work of a space at its cap waits while the work of other spaces runs, even if less important.
+	blocker, release := blockingTask(workPriorityAudit, busy)
+	q.submit(ctx, blocker)
+	q.submit(ctx, r.task("busy", workPriorityPrefetch, busy))
+	q.submit(ctx, r.task("idle", workPriorityAudit, idle))
+	r.wait(t, 1)
+	require.Equal(t, []string{"idle"}, r.ranTasks())
+
+	release()
+	r.wait(t, 1)
+	require.Equal(t, []string{"idle", "busy"}, r.ranTasks())
+}
+
+func TestWorkQueueOverflow(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	q := newTestWorkQueue(&config.ChainConfig{
+		EntitlementWorkQueueSize:        2,
+		EntitlementWorkQueueConcurrency: 1,
+	})
+	r := newWorkQueueRecorder()
+
+	blocker, release := blockingTask(workPriorityPrefetch, shared.StreamId{})
+	q.submit(ctx, blocker)
+	q.submit(ctx, r.task("audit1", workPriorityAudit, shared.StreamId{}))
+	q.submit(ctx, r.task("audit2", workPriorityAudit, shared.StreamId{}))
+
+	// On overflow the oldest work of the lowest priority is dropped.
+	q.submit(ctx, r.task("prefetch1", workPriorityPrefetch, shared.StreamId{}))
+	require.Equal(t, []string{"audit1"}, r.droppedTasks())
+	q.submit(ctx, r.task("audit3", workPriorityAudit, shared.StreamId{}))
+	require.Equal(t, []string{"audit1", "audit2"}, r.droppedTasks())
+	q.submit(ctx, r.task("refresh", workPriorityRefresh, shared.StreamId{}))
+	require.Equal(t, []string{"audit1", "audit2", "audit3"}, r.droppedTasks())
+
+	// Work less important than all the queued work is dropped itself.
+	q.submit(ctx, r.task("audit4", workPriorityAudit, shared.StreamId{}))
+	require.Equal(t, []string{"audit1", "audit2", "audit3", "audit4"}, r.droppedTasks())
+	require.Equal(t, 4.0, testutil.ToFloat64(q.tasks.WithLabelValues("audit", "dropped")))
+
+	// Work past its deadline is dropped when its turn comes.
+	expired := r.task("expired", workPriorityPrefetch, shared.StreamId{})
+	expired.deadline = time.Now().Add(-time.Second)
+	q.submit(ctx, expired)
+	require.Equal(t, []string{"audit1", "audit2", "audit3", "audit4", "refresh"}, r.droppedTasks())
+
+	release()
+	r.wait(t, 1)
+	require.Equal(t, []string{"prefetch1"}, r.ranTasks())
+	require.Eventually(t, func() bool {
+		return len(r.droppedTasks()) == 6
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, []string{"audit1", "audit2", "audit3", "audit4", "refresh", "expired"}, r.droppedTasks())
+	require.Equal(t, 1.0, testutil.ToFloat64(q.tasks.WithLabelValues("prefetch", "expired")))
+
+	// Work submitted after the queue is closed is dropped.
+	q.close()
+	q.submit(ctx, r.task("closed", workPriorityPrefetch, shared.StreamId{}))
+	require.Equal(t, "closed", r.droppedTasks()[6])
+}
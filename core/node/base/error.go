@@ -358,6 +358,11 @@ func WrapRiverError(code protocol.Err, err error) *RiverErrorImpl {
 }
 
 func ErrToConnectCode(err protocol.Err) connect.Code {
+	// The user has to unlink wallets before the request can succeed. Clients retry ResourceExhausted,
+	// so report it as a denial, the river error header carries the specific code.
+	if err == protocol.Err_LINKED_WALLETS_LIMIT_EXCEEDED {
+		return connect.CodePermissionDenied
+	}
 	if err < protocol.Err_CANCELED || err > protocol.Err_UNAUTHENTICATED {
 		return connect.CodeFailedPrecondition
 	}
@@ -91,6 +91,15 @@ func TestRiverErrorWrapsConnectNetworkingError(t *testing.T) {
 	require.Equal(t, "DOWNSTREAM_NETWORK_ERROR", wrappedConnectError.Meta().Values(RIVER_ERROR_HEADER)[0])
 }
 
+func TestLinkedWalletsLimitExceededConnectError(t *testing.T) {
+	err := RiverError(protocol.Err_LINKED_WALLETS_LIMIT_EXCEEDED, "too many wallets")
+	connectErr := err.AsConnectError()
+
+	require.Equal(t, connect.CodePermissionDenied, connectErr.Code())
+	require.Equal(t, "LINKED_WALLETS_LIMIT_EXCEEDED", connectErr.Meta().Values(RIVER_ERROR_HEADER)[0])
+	require.False(t, IsOperationRetriableOnRemotes(err))
+}
+
 func TestIsConnectNetworkError(t *testing.T) {
 	tests := map[string]struct {
 		err            error
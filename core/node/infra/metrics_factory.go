@@ -39,6 +39,10 @@ type MetricsFactory interface {
 	NewStatusCounterVecEx(name string, help string, labels ...string) *StatusCounterVec
 
 	Registry() *prometheus.Registry
+
+	// Unregister removes the collector created with the given name from the registry, so that it can be
+	// created again. Returns false if there is no such collector.
+	Unregister(name string) bool
 }
 
 // NewMetricsFactory creates a new MetricsFactory.
@@ -257,3 +261,15 @@ func (f *metricsFactory) NewStatusCounterVecEx(name string, help string, labels
 func (f *metricsFactory) Registry() *prometheus.Registry {
 	return f.registry
 }
+
+func (f *metricsFactory) Unregister(name string) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	c, ok := f.counters[name]
+	if !ok {
+		return false
+	}
+	delete(f.counters, name)
+	return f.registry.Unregister(c.(prometheus.Collector))
+}
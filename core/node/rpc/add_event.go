@@ -155,10 +155,12 @@ func (s *Service) addParsedEvent(
 				break
 			}
 		}
-		// If no chainAuthArgs grant entitlement, execute the OnChainAuthFailure side effect.
+		// If no chainAuthArgs grant entitlement, execute the OnChainAuthFailure side effect, unless the
+		// entitlements couldn't be checked.
 		if !isEntitledResult.IsEntitled() {
 			var newEvents []*EventRef = nil
-			if sideEffects.OnChainAuthFailure != nil {
+			if sideEffects.OnChainAuthFailure != nil &&
+				isEntitledResult.Reason() != auth.EntitlementResultReason_RULE_CHECK_FAILED {
 				newEvents, err = s.AddEventPayload(
 					ctx,
 					sideEffects.OnChainAuthFailure.StreamId,
@@ -175,7 +177,7 @@ func (s *Service) addParsedEvent(
 				"reason", isEntitledResult.Reason().String(),
 				"chainAuthArgsList",
 				verifications.OneOfChainAuths,
-			).Func("addParsedEvent")
+			).Tags(auth.DetailsOf(isEntitledResult).RuleDenial.Params()...).Func("addParsedEvent")
 		}
 	}
 
@@ -8,6 +8,7 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"google.golang.org/protobuf/proto"
 
+	"github.com/towns-protocol/towns/core/node/auth"
 	. "github.com/towns-protocol/towns/core/node/base"
 	. "github.com/towns-protocol/towns/core/node/events"
 	"github.com/towns-protocol/towns/core/node/logging"
@@ -121,7 +122,7 @@ func (s *Service) createMediaStream(ctx context.Context, req *CreateMediaStreamR
 				"reason", isEntitledResult.Reason().String(),
 				"chainAuthArgs",
 				csRules.ChainAuth.String(),
-			).Func("createStream")
+			).Tags(auth.DetailsOf(isEntitledResult).RuleDenial.Params()...).Func("createStream")
 		}
 	}
 
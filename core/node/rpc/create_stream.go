@@ -10,6 +10,7 @@ import (
 	"github.com/ethereum/go-ethereum/common"
 	"google.golang.org/protobuf/proto"
 
+	"github.com/towns-protocol/towns/core/node/auth"
 	. "github.com/towns-protocol/towns/core/node/base"
 	. "github.com/towns-protocol/towns/core/node/events"
 	"github.com/towns-protocol/towns/core/node/logging"
@@ -125,7 +126,7 @@ func (s *Service) createStream(ctx context.Context, req *CreateStreamRequest) (*
 				"reason", isEntitledResult.Reason().String(),
 				"chainAuthArgs",
 				csRules.ChainAuth.String(),
-			).Func("createStream")
+			).Tags(auth.DetailsOf(isEntitledResult).RuleDenial.Params()...).Func("createStream")
 		}
 	}
 
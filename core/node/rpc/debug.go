@@ -13,10 +13,14 @@ import (
 	runtimePProf "runtime/pprof"
 	"slices"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/ethereum/go-ethereum/common"
+
 	"github.com/towns-protocol/towns/core/config"
+	"github.com/towns-protocol/towns/core/node/auth"
 	"github.com/towns-protocol/towns/core/node/base"
 	"github.com/towns-protocol/towns/core/node/crypto"
 	. "github.com/towns-protocol/towns/core/node/events"
@@ -26,6 +30,7 @@ import (
 	"github.com/towns-protocol/towns/core/node/scrub"
 	"github.com/towns-protocol/towns/core/node/shared"
 	"github.com/towns-protocol/towns/core/node/storage"
+	"github.com/towns-protocol/towns/core/xchain/entitlement"
 )
 
 type debugHandler struct {
@@ -67,8 +72,12 @@ type httpMux interface {
 	Handle(pattern string, handler http.Handler)
 }
 
-func (s *Service) registerDebugHandlersOnMux(mux httpMux, enableDebugEndpoints bool, cfg config.DebugEndpointsConfig) {
-	handler := debugHandler{}
+func (s *Service) registerDebugHandlersOnMux(
+	mux httpMux,
+	enableDebugEndpoints bool,
+	cfg config.DebugEndpointsConfig,
+) *debugHandler {
+	handler := &debugHandler{}
 	mux.HandleFunc("/debug", handler.ServeHTTP)
 	mux.HandleFunc("/debug/", handler.ServeHTTP)
 	handler.HandleFunc(mux, "/debug/multi", s.handleDebugMulti)
@@ -104,12 +113,40 @@ func (s *Service) registerDebugHandlersOnMux(mux httpMux, enableDebugEndpoints b
 		handler.Handle(mux, "/debug/txpool", &txpoolHandler{riverTxPool: s.riverChain.TxPool})
 	}
 
+	if cfg.AuthSelfTest || enableDebugEndpoints {
+		if tester, ok := s.chainAuth.(auth.SelfTester); ok {
+			handler.Handle(mux, "/debug/auth/selftest", &authSelfTestHandler{tester: tester})
+		}
+	}
+
 	if cfg.Stream || enableDebugEndpoints {
 		handler.Handle(mux, "/debug/stream/{streamIdStr}", &streamHandler{store: s.storage})
 	}
 	if s.mode == ServerModeArchive && (cfg.CorruptStreams || enableDebugEndpoints) {
 		handler.Handle(mux, "/debug/corrupt_streams", &corruptStreamsHandler{service: s.Archiver})
 	}
+	return handler
+}
+
+// registerPrivateDebugHandlers registers the debug handlers that change the state of the node, expose the auth
+// state of users or read the chain on behalf of the caller. They are only served by the private debug server,
+// never on the public port.
+func (s *Service) registerPrivateDebugHandlers(mux httpMux, handler *debugHandler) {
+	if dumper, ok := s.chainAuth.(auth.CacheDumper); ok {
+		handler.Handle(mux, "/debug/auth/cache", &authCacheHandler{dumper: dumper})
+	}
+	if collector, ok := s.chainAuth.(auth.UserAuthBundleCollector); ok {
+		handler.Handle(mux, "/debug/auth/bundle", &authBundleHandler{collector: collector})
+	}
+	if simulator, ok := s.chainAuth.(auth.WalletSetSimulator); ok {
+		handler.Handle(mux, "/debug/auth/simulate", &authSimulateHandler{simulator: simulator, cfg: s.config})
+	}
+	if controller, ok := s.chainAuth.(auth.ReadOnlyController); ok {
+		handler.Handle(mux, "/debug/auth/readonly", &authReadOnlyHandler{controller: controller})
+	}
+	if invalidator, ok := s.chainAuth.(auth.CacheInvalidator); ok {
+		handler.Handle(mux, "/debug/auth/invalidate", &authInvalidateHandler{invalidator: invalidator})
+	}
 }
 
 func (s *Service) registerDebugHandlersOnPrivateAddress(cfg config.DebugEndpointsConfig) {
@@ -119,7 +156,8 @@ func (s *Service) registerDebugHandlersOnPrivateAddress(cfg config.DebugEndpoint
 
 	debugMux := http.NewServeMux()
 
-	s.registerDebugHandlersOnMux(debugMux, true, cfg)
+	handler := s.registerDebugHandlersOnMux(debugMux, true, cfg)
+	s.registerPrivateDebugHandlers(debugMux, handler)
 
 	debugServer := &http.Server{
 		Addr:    cfg.PrivateDebugServerAddress,
@@ -405,6 +443,309 @@ func (h *txpoolHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	_, _ = w.Write(output.Bytes())
 }
 
+// authSelfTestHandler runs the auth self-test and writes the report as json. The response status is
+// 503 if any probe failed, so the endpoint can be used by deployment checks.
+type authSelfTestHandler struct {
+	tester auth.SelfTester
+}
+
+func (h *authSelfTestHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	report, err := h.tester.SelfTest(ctx)
+	if err != nil {
+		logging.FromCtx(ctx).Errorw("Auth self-test failed to run", "error", err)
+		http.Error(w, "Internal Server Error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if report.Passed {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(w).Encode(report); err != nil {
+		logging.FromCtx(ctx).Errorw("Unable to write auth self-test report", "error", err)
+	}
+}
+
+// authCacheHandler writes the entitlement cache entries of a space and/or principal as json. Addresses are
+// redacted unless redact=0 is passed. It is only served by the private debug server, see
+// registerPrivateDebugHandlers.
+type authCacheHandler struct {
+	dumper auth.CacheDumper
+}
+
+func (h *authCacheHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	filter := auth.CacheDumpFilter{RedactAddresses: query.Get("redact") != "0"}
+	if spaceId := query.Get("spaceId"); spaceId != "" {
+		var err error
+		if filter.SpaceId, err = shared.StreamIdFromString(spaceId); err != nil {
+			http.Error(w, "Bad Request: invalid spaceId: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if principal := query.Get("principal"); principal != "" {
+		if !common.IsHexAddress(principal) {
+			http.Error(w, "Bad Request: invalid principal", http.StatusBadRequest)
+			return
+		}
+		filter.Principal = common.HexToAddress(principal)
+	}
+	if filter.SpaceId == (shared.StreamId{}) && filter.Principal == (common.Address{}) {
+		http.Error(w, "Bad Request: spaceId or principal is required", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(h.dumper.DumpCache(filter)); err != nil {
+		logging.FromCtx(ctx).Errorw("Unable to write auth cache dump", "error", err)
+	}
+}
+
+// authBundleHandler writes the support bundle of the auth state of a principal in a space as json, the addresses
+// of other users are redacted. It is only served by the private debug server, see registerPrivateDebugHandlers.
+type authBundleHandler struct {
+	collector auth.UserAuthBundleCollector
+}
+
+func (h *authBundleHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	spaceId, err := shared.StreamIdFromString(query.Get("spaceId"))
+	if err != nil || spaceId.Type() != shared.STREAM_SPACE_BIN {
+		http.Error(w, "Bad Request: invalid spaceId", http.StatusBadRequest)
+		return
+	}
+	principal := query.Get("principal")
+	if !common.IsHexAddress(principal) {
+		http.Error(w, "Bad Request: invalid principal", http.StatusBadRequest)
+		return
+	}
+
+	bundle, err := h.collector.CollectUserAuthBundle(ctx, spaceId, common.HexToAddress(principal))
+	if err != nil {
+		http.Error(w, "Internal Server Error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(bundle); err != nil {
+		logging.FromCtx(ctx).Errorw("Unable to write auth bundle", "error", err)
+	}
+}
+
+// authSimulateHandler evaluates the check of a principal in a space, or a channel if channelId is passed, as if
+// the comma-separated wallets were its linked wallets, and writes the outcome as json. The permission is
+// passed by name and defaults to Read. It is only served by the private debug server, see
+// registerPrivateDebugHandlers.
+type authSimulateHandler struct {
+	simulator auth.WalletSetSimulator
+	cfg       *config.Config
+}
+
+type authSimulateReply struct {
+	Allowed         bool                    `json:"allowed"`
+	Reason          string                  `json:"reason"`
+	WalletSetDigest common.Hash             `json:"walletSetDigest"`
+	SatisfiedBy     *common.Address         `json:"satisfiedBy,omitempty"`
+	RuleDenial      *entitlement.RuleDenial `json:"ruleDenial,omitempty"`
+}
+
+func (h *authSimulateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	spaceId, err := shared.StreamIdFromString(query.Get("spaceId"))
+	if err != nil {
+		http.Error(w, "Bad Request: invalid spaceId: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	var channelId shared.StreamId
+	if value := query.Get("channelId"); value != "" {
+		if channelId, err = shared.StreamIdFromString(value); err != nil {
+			http.Error(w, "Bad Request: invalid channelId: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	principal := query.Get("principal")
+	permission := auth.PermissionRead
+	if name := query.Get("permission"); name != "" {
+		var ok bool
+		if permission, ok = auth.ParsePermission(name); !ok {
+			http.Error(w, "Bad Request: invalid permission", http.StatusBadRequest)
+			return
+		}
+	}
+	var wallets []common.Address
+	if value := query.Get("wallets"); value != "" {
+		for _, wallet := range strings.Split(value, ",") {
+			if !common.IsHexAddress(wallet) {
+				http.Error(w, "Bad Request: invalid wallet "+wallet, http.StatusBadRequest)
+				return
+			}
+			wallets = append(wallets, common.HexToAddress(wallet))
+		}
+	}
+
+	var args *auth.ChainAuthArgs
+	if channelId != (shared.StreamId{}) {
+		args, err = auth.ParseChainAuthArgsForChannel(spaceId, channelId, principal, permission)
+	} else {
+		args, err = auth.ParseChainAuthArgsForSpace(spaceId, principal, permission)
+	}
+	if err != nil {
+		http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	result, err := h.simulator.SimulateWalletSet(ctx, h.cfg, args, wallets)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if base.AsRiverError(err).Code == protocol.Err_RESOURCE_EXHAUSTED {
+			status = http.StatusTooManyRequests
+		}
+		http.Error(w, http.StatusText(status)+": "+err.Error(), status)
+		return
+	}
+
+	details := auth.DetailsOf(result)
+	reply := authSimulateReply{
+		Allowed:         result.IsEntitled(),
+		Reason:          result.Reason().String(),
+		WalletSetDigest: details.WalletSetDigest,
+		RuleDenial:      details.RuleDenial,
+	}
+	if details.SatisfiedBy != (common.Address{}) {
+		reply.SatisfiedBy = &details.SatisfiedBy
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(reply); err != nil {
+		logging.FromCtx(ctx).Errorw("Unable to write auth simulation", "error", err)
+	}
+}
+
+// authReadOnlyHandler reports the read-only mode of the entitlement checks as json. POST requests with a
+// duration, such as duration=30m, make the checks read-only for that long, duration=0 leaves read-only mode.
+// It is only served by the private debug server, see registerPrivateDebugHandlers.
+type authReadOnlyHandler struct {
+	controller auth.ReadOnlyController
+}
+
+func (h *authReadOnlyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	log := logging.FromCtx(ctx)
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		duration, err := time.ParseDuration(r.URL.Query().Get("duration"))
+		if err != nil {
+			http.Error(w, "Bad Request: invalid duration: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := h.controller.SetReadOnly(duration); err != nil {
+			http.Error(w, "Bad Request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Infow("Auth read-only mode changed", "duration", duration, "remoteAddr", r.RemoteAddr)
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	until := h.controller.ReadOnlyUntil()
+	status := struct {
+		ReadOnly bool       `json:"readOnly"`
+		Until    *time.Time `json:"until,omitempty"`
+	}{ReadOnly: !until.IsZero()}
+	if status.ReadOnly {
+		status.Until = &until
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		log.Errorw("Unable to write auth read-only status", "error", err)
+	}
+}
+
+// authInvalidateHandler writes the audit trail of the latest entitlement cache invalidations as json. POST
+// requests with an idempotency key, a version, a spaceId and the actor requesting the invalidation, and optionally
+// a principal, invalidate the cache entries of the space or of the principal in the space and write the record of
+// the invalidation. Requests are applied once per key, and must have a version greater than the last applied
+// invalidation. It is only served by the private debug server, see registerPrivateDebugHandlers.
+type authInvalidateHandler struct {
+	invalidator auth.CacheInvalidator
+}
+
+func (h *authInvalidateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	log := logging.FromCtx(ctx)
+
+	var reply any
+	switch r.Method {
+	case http.MethodGet:
+		reply = h.invalidator.CacheInvalidations()
+	case http.MethodPost:
+		query := r.URL.Query()
+		actor := query.Get("actor")
+		if actor == "" {
+			http.Error(w, "Bad Request: actor is required", http.StatusBadRequest)
+			return
+		}
+		version, err := strconv.ParseUint(query.Get("version"), 10, 64)
+		if err != nil {
+			http.Error(w, "Bad Request: invalid version: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		spaceId, err := shared.StreamIdFromString(query.Get("spaceId"))
+		if err != nil {
+			http.Error(w, "Bad Request: invalid spaceId: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		req := auth.CacheInvalidationRequest{
+			IdempotencyKey: query.Get("key"),
+			Version:        version,
+			Actor:          actor,
+			SpaceId:        spaceId,
+		}
+		if principal := query.Get("principal"); principal != "" {
+			if !common.IsHexAddress(principal) {
+				http.Error(w, "Bad Request: invalid principal", http.StatusBadRequest)
+				return
+			}
+			req.Principal = common.HexToAddress(principal)
+		}
+		record, err := h.invalidator.InvalidateCaches(req)
+		if err != nil {
+			status := http.StatusBadRequest
+			if base.AsRiverError(err).Code == protocol.Err_FAILED_PRECONDITION {
+				status = http.StatusConflict
+			}
+			http.Error(w, http.StatusText(status)+": "+err.Error(), status)
+			return
+		}
+		log.Infow("Auth caches invalidated", "record", record, "remoteAddr", r.RemoteAddr)
+		reply = record
+	default:
+		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(reply); err != nil {
+		log.Errorw("Unable to write auth cache invalidations", "error", err)
+	}
+}
+
 type cacheHandler struct {
 	cache *StreamCache
 }
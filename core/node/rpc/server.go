@@ -300,18 +300,29 @@ func (s *Service) initBaseChain() error {
 			return err
 		}
 
+		entitlementChains, err := s.newEntitlementChains(ctx)
+		if err != nil {
+			return err
+		}
+
 		chainAuth, err := auth.NewChainAuth(
 			ctx,
 			s.baseChain,
+			entitlementChains,
 			s.entitlementEvaluator,
 			&cfg.ArchitectContract,
 			cfg.BaseChain.LinkedWalletsLimit,
 			cfg.BaseChain.ContractCallsTimeoutMs,
+			cfg.BaseChain.EntitlementMaxConcurrentMembershipChecks,
+			cfg.BaseChain.EntitlementCacheExpiryJitterPercent,
+			&cfg.DiskCache,
 			s.metrics,
+			auth.WithLinkedWalletsLimitByPermission(cfg.LinkedWalletsLimitByPermission),
 		)
 		if err != nil {
 			return err
 		}
+		s.onClose(chainAuth.Close)
 		s.chainAuth = chainAuth
 		return nil
 	} else {
@@ -323,6 +334,27 @@ func (s *Service) initBaseChain() error {
 	}
 }
 
+// newEntitlementChains connects to the chains besides the base chain that spaces live on, see
+// config.Config.EntitlementChainIds. Their rule entitlements are evaluated by the entitlement evaluator, which
+// reaches all the chains of the config.
+func (s *Service) newEntitlementChains(ctx context.Context) (map[uint64]*auth.EntitlementChain, error) {
+	chains := make(map[uint64]*auth.EntitlementChain, len(s.config.EntitlementChainIds))
+	for _, chainId := range s.config.EntitlementChainIds {
+		chainCfg, ok := s.config.ChainConfigs[chainId]
+		if !ok {
+			return nil, RiverError(Err_BAD_CONFIG, "Entitlement chain has no RPC endpoint in Chains", "chainId", chainId).
+				Func("newEntitlementChains")
+		}
+		chain, err := crypto.NewBlockchain(ctx, chainCfg, nil, s.metrics, s.otelTracer)
+		if err != nil {
+			return nil, err
+		}
+		s.onClose(chain.Close)
+		chains[chainId] = &auth.EntitlementChain{Blockchain: chain, Evaluator: s.entitlementEvaluator}
+	}
+	return chains, nil
+}
+
 func (s *Service) initRiverChain() error {
 	ctx := s.serverCtx
 	var err error
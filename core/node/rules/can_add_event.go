@@ -1617,19 +1617,16 @@ func (ru *aeMembershipRules) spaceMembershipEntitlements() (*auth.ChainAuthArgs,
 		return nil, nil
 	}
 
-	var chainAuthArgs *auth.ChainAuthArgs
 	// Space joins are a special case as they do not require an entitlement check. We simply
 	// verify that the user is a space member.
 	if ru.membership.Op == MembershipOp_SO_JOIN {
-		chainAuthArgs = auth.NewChainAuthArgsForIsSpaceMember(*streamId, permissionUser)
-	} else {
-		chainAuthArgs = auth.NewChainAuthArgsForSpace(
-			*streamId,
-			permissionUser,
-			permission,
-		)
+		return auth.ParseChainAuthArgsForIsSpaceMember(*streamId, permissionUser)
 	}
-	return chainAuthArgs, nil
+	return auth.ParseChainAuthArgsForSpace(
+		*streamId,
+		permissionUser,
+		permission,
+	)
 }
 
 func (ru *aeMembershipRules) channelMembershipEntitlements() (*auth.ChainAuthArgs, error) {
@@ -1655,21 +1652,19 @@ func (ru *aeMembershipRules) channelMembershipEntitlements() (*auth.ChainAuthArg
 	// ModifyBanning is a space level permission
 	// but users with this entitlement should also be entitled to kick users from the channel
 	if permission == auth.PermissionModifyBanning {
-		return auth.NewChainAuthArgsForSpace(
+		return auth.ParseChainAuthArgsForSpace(
 			spaceId,
 			permissionUser,
 			permission,
-		), nil
+		)
 	}
 
-	chainAuthArgs := auth.NewChainAuthArgsForChannel(
+	return auth.ParseChainAuthArgsForChannel(
 		spaceId,
 		*ru.params.streamView.StreamId(),
 		permissionUser,
 		permission,
 	)
-
-	return chainAuthArgs, nil
 }
 
 // return function that can be used to check if a user has a permission for a space
@@ -1685,12 +1680,11 @@ func (params *aeParams) spaceEntitlements(permission auth.Permission) func() (*a
 			return nil, err
 		}
 
-		chainAuthArgs := auth.NewChainAuthArgsForSpace(
+		return auth.ParseChainAuthArgsForSpace(
 			*spaceId,
 			permissionUser,
 			permission,
 		)
-		return chainAuthArgs, nil
 	}
 }
 
@@ -1713,14 +1707,12 @@ func (params *aeParams) channelEntitlements(permission auth.Permission) func() (
 			return nil, err
 		}
 
-		chainAuthArgs := auth.NewChainAuthArgsForChannel(
+		return auth.ParseChainAuthArgsForChannel(
 			spaceId,
 			channelId,
 			userId,
 			permission,
 		)
-
-		return chainAuthArgs, nil
 	}
 }
 
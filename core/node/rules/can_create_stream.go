@@ -464,11 +464,11 @@ func (ru *csSpaceRules) getCreateSpaceChainAuth() (*auth.ChainAuthArgs, error) {
 	if err != nil {
 		return nil, err
 	}
-	return auth.NewChainAuthArgsForSpace(
+	return auth.ParseChainAuthArgsForSpace(
 		ru.params.streamId,
 		userId,
 		auth.PermissionAddRemoveChannels, // todo should be isOwner...
-	), nil
+	)
 }
 
 func (ru *csChannelRules) getCreateChannelChainAuth() (*auth.ChainAuthArgs, error) {
@@ -481,11 +481,11 @@ func (ru *csChannelRules) getCreateChannelChainAuth() (*auth.ChainAuthArgs, erro
 	if err != nil {
 		return nil, err
 	}
-	return auth.NewChainAuthArgsForSpace(
+	return auth.ParseChainAuthArgsForSpace(
 		spaceId, // check parent space id
 		userId,
 		auth.PermissionAddRemoveChannels,
-	), nil
+	)
 }
 
 func (ru *csChannelRules) derivedChannelSpaceParentEvent() (*DerivedEvent, error) {
@@ -613,10 +613,10 @@ func (ru *csParams) getNewUserStreamChainAuth() (*auth.ChainAuthArgs, error) {
 		if err != nil {
 			return nil, err
 		}
-		return auth.NewChainAuthArgsForIsSpaceMember(
+		return auth.ParseChainAuthArgsForIsSpaceMember(
 			spaceId,
 			userId,
-		), nil
+		)
 	} else {
 		return nil, RiverError(Err_BAD_STREAM_CREATION_PARAMS, "A spaceId where spaceContract.isMember(userId)==true must be provided in metadata for user stream")
 	}
@@ -641,23 +641,23 @@ func (ru *csMediaRules) getChainAuthForMediaStream() (*auth.ChainAuthArgs, error
 			return nil, err
 		}
 
-		return auth.NewChainAuthArgsForChannel(
+		return auth.ParseChainAuthArgsForChannel(
 			spaceId,
 			channelId,
 			userId,
 			auth.PermissionWrite,
-		), nil
+		)
 	} else if shared.ValidSpaceStreamIdBytes(ru.inception.SpaceId) {
 		spaceId, err := shared.StreamIdFromBytes(ru.inception.SpaceId)
 		if err != nil {
 			return nil, err
 		}
 
-		return auth.NewChainAuthArgsForSpace(
+		return auth.ParseChainAuthArgsForSpace(
 			spaceId,
 			userId,
 			auth.PermissionModifySpaceSettings, // todo should it be isOwner?
-		), nil
+		)
 	} else {
 		return nil, nil
 	}
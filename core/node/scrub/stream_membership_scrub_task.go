@@ -134,8 +134,12 @@ func (tp *streamMembershipScrubTaskProcessorImpl) processMemberImpl(
 	}
 
 	// In the case that the user is not entitled, they must have lost their entitlement
-	// after joining the channel, so let's go ahead and boot them.
-	if !isEntitledResult.IsEntitled() {
+	// after joining the channel, so let's go ahead and boot them. Denials of local policy hooks
+	// don't change the on-chain membership and are not a reason to boot them, neither are rules
+	// that couldn't be evaluated.
+	if !isEntitledResult.IsEntitled() &&
+		isEntitledResult.Reason() != auth.EntitlementResultReason_POLICY_DENIED &&
+		isEntitledResult.Reason() != auth.EntitlementResultReason_RULE_CHECK_FAILED {
 		tp.entitlementLosses.Inc()
 
 		userId, err := AddressFromUserId(member)
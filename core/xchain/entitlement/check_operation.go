@@ -126,17 +126,17 @@ func (e *Evaluator) evaluateCheckOperation(
 	ctx context.Context,
 	op *types.CheckOperation,
 	linkedWallets []common.Address,
-) (bool, error) {
+) (bool, *RuleDenial, error) {
 	defer prometheus.NewTimer(e.evalHistrogram.WithLabelValues(op.CheckType.String())).ObserveDuration()
 
 	if op.CheckType == types.MOCK {
 		return e.evaluateMockOperation(ctx, op)
 	} else if op.CheckType == types.CheckNONE {
-		return false, fmt.Errorf("unknown operation")
+		return false, nil, fmt.Errorf("unknown operation")
 	}
 
 	if err := validateCheckOperation(ctx, op); err != nil {
-		return false, err
+		return false, nil, err
 	}
 
 	switch op.CheckType {
@@ -155,49 +155,63 @@ func (e *Evaluator) evaluateCheckOperation(
 	case types.MOCK:
 		fallthrough
 	default:
-		return false, fmt.Errorf("unknown operation")
+		return false, nil, fmt.Errorf("unknown operation")
 	}
 }
 
 func (e *Evaluator) evaluateMockOperation(
 	ctx context.Context,
 	op *types.CheckOperation,
-) (bool, error) {
+) (bool, *RuleDenial, error) {
 	log := logging.FromCtx(ctx).With("function", "evaluateMockOperation")
 	params, err := types.DecodeThresholdParams(op.Params)
 	if err != nil {
 		log.Errorw("evaluateMockOperation: failed to decode threshold params", "error", err)
-		return false, fmt.Errorf("evaluateMockOperation: failed to decode threshold params, %w", err)
+		return false, nil, fmt.Errorf("evaluateMockOperation: failed to decode threshold params, %w", err)
 	}
 	delay := int(params.Threshold.Int64())
 
-	result := awaitTimeout(ctx, func() error {
-		delayDuration := time.Duration(delay) * time.Millisecond
-		time.Sleep(delayDuration) // simulate a long-running operation
-		return nil
-	})
-	if result != nil {
-		return false, result
+	// simulate a long-running operation
+	if err := sleepContext(ctx, time.Duration(delay)*time.Millisecond); err != nil {
+		return false, nil, err
 	}
 
 	if (op.ContractAddress != common.Address{}) {
 		// Grab last byte of contract address as a unique identifier of which check
 		// caused the error, for ease of debugging test cases.
-		return false, fmt.Errorf("intentional failure (%.2x)", op.ContractAddress[19])
+		return false, nil, fmt.Errorf("intentional failure (%.2x)", op.ContractAddress[19])
+	}
+	if op.ChainID.Sign() == 0 {
+		return false, newRuleDenial(op, params.Threshold, nil, nil), nil
+	}
+	return true, nil, nil
+}
+
+// sleepContext waits for the delay, or until ctx is done if it comes first. Operations sleeping this way stop
+// when the evaluation of the other child of their logical operation cancels them.
+func sleepContext(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		// If the context was cancelled or expired, return an error
+		return fmt.Errorf("operation cancelled: %w", ctx.Err())
+	case <-timer.C:
+		return nil
 	}
-	return op.ChainID.Sign() != 0, nil
 }
 
 func (e *Evaluator) evaluateIsEntitledOperation(
 	ctx context.Context,
 	op *types.CheckOperation,
 	linkedWallets []common.Address,
-) (bool, error) {
+) (bool, *RuleDenial, error) {
 	log := logging.FromCtx(ctx).With("function", "evaluateIsEntitledOperation")
 	client, err := e.clients.Get(op.ChainID.Uint64())
 	if err != nil {
 		log.Errorw("Chain ID not found", "chainID", op.ChainID)
-		return false, fmt.Errorf("evaluateIsEntitledOperation: Chain ID %v not found", op.ChainID)
+		return false, nil, fmt.Errorf("evaluateIsEntitledOperation: Chain ID %v not found", op.ChainID)
 	}
 
 	crossChainEntitlementChecker, err := base.NewICrossChainEntitlement(
@@ -210,7 +224,7 @@ func (e *Evaluator) evaluateIsEntitledOperation(
 			"contractAddress", op.ContractAddress,
 			"chainId", op.ChainID,
 		)
-		return false, err
+		return false, nil, err
 	}
 	for _, wallet := range linkedWallets {
 		// Check if the caller is entitled
@@ -226,13 +240,13 @@ func (e *Evaluator) evaluateIsEntitledOperation(
 				"wallet", wallet,
 				"chainId", op.ChainID,
 			)
-			return false, err
+			return false, nil, err
 		}
 		if isEntitled {
-			return true, nil
+			return true, nil, nil
 		}
 	}
-	return false, nil
+	return false, newRuleDenial(op, nil, nil, nil), nil
 }
 
 // Check ETH balance, in decimals, across all supported chains that use Ether as the native token for payments.
@@ -240,9 +254,15 @@ func (e *Evaluator) evaluateEthBalanceOperation(
 	ctx context.Context,
 	op *types.CheckOperation,
 	linkedWallets []common.Address,
-) (bool, error) {
+) (bool, *RuleDenial, error) {
 	log := logging.FromCtx(ctx).With("function", "evaluateEthBalanceOperation")
 
+	params, err := types.DecodeThresholdParams(op.Params)
+	if err != nil {
+		log.Errorw("Failed to decode threshold params", "error", err)
+		return false, nil, fmt.Errorf("evaluateEthBalanceOperation: failed to decode threshold params, %w", err)
+	}
+
 	// Accumulator for the total balance across all chains.
 	total := big.NewInt(0)
 
@@ -251,12 +271,7 @@ func (e *Evaluator) evaluateEthBalanceOperation(
 		client, err := e.clients.Get(chainID)
 		if err != nil {
 			log.Errorw("Provider for Chain ID not found", "chainID", chainID)
-			return false, fmt.Errorf("evaluateEthBalanceOperation: Provider for chain ID %v not found", chainID)
-		}
-		params, err := types.DecodeThresholdParams(op.Params)
-		if err != nil {
-			log.Errorw("Failed to decode threshold params", "error", err)
-			return false, fmt.Errorf("evaluateEthBalanceOperation: failed to decode threshold params, %w", err)
+			return false, nil, fmt.Errorf("evaluateEthBalanceOperation: Provider for chain ID %v not found", chainID)
 		}
 
 		for _, wallet := range linkedWallets {
@@ -266,7 +281,7 @@ func (e *Evaluator) evaluateEthBalanceOperation(
 			balance, err := client.BalanceAt(ctx, wallet, nil)
 			if err != nil {
 				log.Errorw("Failed to retrieve ETH balance", "chain", chainID, "error", err)
-				return false, err
+				return false, nil, err
 			}
 			total.Add(total, balance)
 
@@ -281,23 +296,23 @@ func (e *Evaluator) evaluateEthBalanceOperation(
 			// Iteratively check if the total balance of evaluated wallets is greater than or equal to the
 			// threshold. Note threshold is always positive and total is non-negative.
 			if total.Cmp(params.Threshold) >= 0 {
-				return true, nil
+				return true, nil, nil
 			}
 		}
 	}
-	return false, nil
+	return false, newRuleDenial(op, params.Threshold, nil, total), nil
 }
 
 func (e *Evaluator) evaluateErc20Operation(
 	ctx context.Context,
 	op *types.CheckOperation,
 	linkedWallets []common.Address,
-) (bool, error) {
+) (bool, *RuleDenial, error) {
 	log := logging.FromCtx(ctx).With("function", "evaluateErc20Operation")
 	client, err := e.clients.Get(op.ChainID.Uint64())
 	if err != nil {
 		log.Errorw("Chain ID not found", "chainID", op.ChainID)
-		return false, fmt.Errorf("evaluateErc20Operation: Chain ID %v not found", op.ChainID)
+		return false, nil, fmt.Errorf("evaluateErc20Operation: Chain ID %v not found", op.ChainID)
 	}
 
 	// Create a new instance of the token contract
@@ -308,13 +323,13 @@ func (e *Evaluator) evaluateErc20Operation(
 			"error", err,
 			"contractAddress", op.ContractAddress,
 		)
-		return false, err
+		return false, nil, err
 	}
 
 	params, err := types.DecodeThresholdParams(op.Params)
 	if err != nil {
 		log.Errorw("evaluateErc20Operation: failed to decode threshold params", "error", err)
-		return false, fmt.Errorf("evaluateErc20Operation: failed to decode threshold params, %w", err)
+		return false, nil, fmt.Errorf("evaluateErc20Operation: failed to decode threshold params, %w", err)
 	}
 
 	total := big.NewInt(0)
@@ -326,7 +341,7 @@ func (e *Evaluator) evaluateErc20Operation(
 		balance, err := token.BalanceOf(&bind.CallOpts{Context: ctx}, wallet)
 		if err != nil {
 			log.Errorw("Failed to retrieve token balance", "error", err)
-			return false, err
+			return false, nil, err
 		}
 		total.Add(total, balance)
 
@@ -342,23 +357,23 @@ func (e *Evaluator) evaluateErc20Operation(
 		// Iteratively check if the total balance of evaluated wallets is greater than or equal to the threshold
 		// Note threshold is always positive and total is non-negative.
 		if total.Cmp(params.Threshold) >= 0 {
-			return true, nil
+			return true, nil, nil
 		}
 	}
-	return false, nil
+	return false, newRuleDenial(op, params.Threshold, nil, total), nil
 }
 
 func (e *Evaluator) evaluateErc721Operation(
 	ctx context.Context,
 	op *types.CheckOperation,
 	linkedWallets []common.Address,
-) (bool, error) {
+) (bool, *RuleDenial, error) {
 	log := logging.FromCtx(ctx).With("function", "evaluateErc721Operation")
 
 	client, err := e.clients.Get(op.ChainID.Uint64())
 	if err != nil {
 		log.Errorw("Chain ID not found", "chainID", op.ChainID)
-		return false, fmt.Errorf("evaluateErc721Operation: Chain ID %v not found", op.ChainID)
+		return false, nil, fmt.Errorf("evaluateErc721Operation: Chain ID %v not found", op.ChainID)
 	}
 
 	nft, err := erc721.NewErc721Caller(op.ContractAddress, client)
@@ -367,14 +382,14 @@ func (e *Evaluator) evaluateErc721Operation(
 			"error", err,
 			"contractAddress", op.ContractAddress,
 		)
-		return false, err
+		return false, nil, err
 	}
 
 	// Decode the threshold params
 	params, err := types.DecodeThresholdParams(op.Params)
 	if err != nil {
 		log.Errorw("evaluateErc721Operation: failed to decode threshold params", "error", err)
-		return false, fmt.Errorf("evaluateErc721Operation: failed to decode threshold params, %w", err)
+		return false, nil, fmt.Errorf("evaluateErc721Operation: failed to decode threshold params, %w", err)
 	}
 
 	total := big.NewInt(0)
@@ -386,7 +401,7 @@ func (e *Evaluator) evaluateErc721Operation(
 				"contractAddress", op.ContractAddress,
 				"wallet", wallet,
 			)
-			return false, err
+			return false, nil, err
 		}
 
 		// Accumulate the total balance across evaluated wallets
@@ -395,23 +410,23 @@ func (e *Evaluator) evaluateErc721Operation(
 		// Iteratively check if the total balance of evaluated wallets is greater than or equal to the threshold
 		// Note threshold is always positive and total is non-negative.
 		if total.Cmp(params.Threshold) >= 0 {
-			return true, nil
+			return true, nil, nil
 		}
 	}
-	return false, err
+	return false, newRuleDenial(op, params.Threshold, nil, total), err
 }
 
 func (e *Evaluator) evaluateErc1155Operation(
 	ctx context.Context,
 	op *types.CheckOperation,
 	linkedWallets []common.Address,
-) (bool, error) {
+) (bool, *RuleDenial, error) {
 	log := logging.FromCtx(ctx).With("function", "evaluateErc1155Operation")
 
 	client, err := e.clients.Get(op.ChainID.Uint64())
 	if err != nil {
 		log.Errorw("Chain ID not found", "chainID", op.ChainID)
-		return false, fmt.Errorf("evaluateErc1155Operation: Chain ID %v not found", op.ChainID)
+		return false, nil, fmt.Errorf("evaluateErc1155Operation: Chain ID %v not found", op.ChainID)
 	}
 
 	collection, err := erc1155.NewErc1155Caller(op.ContractAddress, client)
@@ -420,14 +435,14 @@ func (e *Evaluator) evaluateErc1155Operation(
 			"error", err,
 			"contractAddress", op.ContractAddress,
 		)
-		return false, err
+		return false, nil, err
 	}
 
 	// Decode the ERC1155 params
 	params, err := types.DecodeERC1155Params(op.Params)
 	if err != nil {
 		log.Errorw("evaluateErc1155Operation: failed to decode erc1155 params", "error", err)
-		return false, fmt.Errorf("evaluateErc1155Operation: failed to decode erc1155 params, %w", err)
+		return false, nil, fmt.Errorf("evaluateErc1155Operation: failed to decode erc1155 params, %w", err)
 	}
 
 	total := big.NewInt(0)
@@ -440,7 +455,7 @@ func (e *Evaluator) evaluateErc1155Operation(
 				"wallet", wallet,
 				"tokenId", params.TokenId.String(),
 			)
-			return false, err
+			return false, nil, err
 		}
 
 		// Accumulate the total balance across evaluated wallets
@@ -449,8 +464,8 @@ func (e *Evaluator) evaluateErc1155Operation(
 		// Iteratively check if the total balance of evaluated wallets is greater than or equal to the threshold
 		// Note threshold is always positive and total is non-negative.
 		if total.Cmp(params.Threshold) >= 0 {
-			return true, nil
+			return true, nil, nil
 		}
 	}
-	return false, err
+	return false, newRuleDenial(op, params.Threshold, params.TokenId, total), err
 }
@@ -18,11 +18,24 @@ func (e *Evaluator) EvaluateRuleData(
 	linkedWallets []common.Address,
 	ruleData *base.IRuleEntitlementBaseRuleDataV2,
 ) (bool, error) {
+	result, _, err := e.EvaluateRuleDataWithDenial(ctx, linkedWallets, ruleData)
+	return result, err
+}
+
+// EvaluateRuleDataWithDenial evaluates the rule like EvaluateRuleData and, if the wallets don't satisfy
+// it, also returns the check operation they failed. Of the branches of OR operations the one with the
+// fewest unsatisfied checks is reported, and of AND operations the unsatisfied child with the fewest
+// unsatisfied checks. The denial is nil if the rule is satisfied or its evaluation failed.
+func (e *Evaluator) EvaluateRuleDataWithDenial(
+	ctx context.Context,
+	linkedWallets []common.Address,
+	ruleData *base.IRuleEntitlementBaseRuleDataV2,
+) (bool, *RuleDenial, error) {
 	log := logging.FromCtx(ctx)
 	log.Infow("Evaluating rule data", "ruleData", ruleData)
 	opTree, err := types.GetOperationTree(ctx, ruleData)
 	if err != nil {
-		return false, err
+		return false, nil, err
 	}
 	return e.evaluateOp(ctx, opTree, linkedWallets)
 }
@@ -95,22 +108,24 @@ func (e *Evaluator) evaluateAndOperation(
 	ctx context.Context,
 	op *types.AndOperation,
 	linkedWallets []common.Address,
-) (bool, error) {
+) (bool, *RuleDenial, error) {
 	if op.LeftOperation == nil || op.RightOperation == nil {
-		return false, fmt.Errorf("operation is nil")
+		return false, nil, fmt.Errorf("operation is nil")
 	}
 	leftCtx, leftCancel := context.WithCancel(ctx)
 	rightCtx, rightCancel := context.WithCancel(ctx)
 	leftResult := false
+	leftDenial := (*RuleDenial)(nil)
 	leftErr := error(nil)
 	rightResult := false
+	rightDenial := (*RuleDenial)(nil)
 	rightErr := error(nil)
 	wg := sync.WaitGroup{}
 	wg.Add(2)
 	defer leftCancel()
 	defer rightCancel()
 	go func() {
-		leftResult, leftErr = e.evaluateOp(leftCtx, op.LeftOperation, linkedWallets)
+		leftResult, leftDenial, leftErr = e.evaluateOp(leftCtx, op.LeftOperation, linkedWallets)
 		if !leftResult && leftErr == nil {
 			// cancel the other goroutine if the left result is false, since we know
 			// the user is unentitled
@@ -120,7 +135,7 @@ func (e *Evaluator) evaluateAndOperation(
 	}()
 
 	go func() {
-		rightResult, rightErr = e.evaluateOp(rightCtx, op.RightOperation, linkedWallets)
+		rightResult, rightDenial, rightErr = e.evaluateOp(rightCtx, op.RightOperation, linkedWallets)
 		if !rightResult && rightErr == nil {
 			// cancel the other goroutine if the right result is false, since we know
 			// the user is unentitled
@@ -139,20 +154,28 @@ func (e *Evaluator) evaluateAndOperation(
 	// 4. If both checks were cancelations/timeouts, consider this a true timeout, as the context cancellation cause
 	//    must have propogated from the parent.
 	if leftResult && rightResult {
-		return true, nil
+		return true, nil, nil
 	}
 
-	if !leftResult && leftErr == nil {
-		logIfEntitlementError(ctx, rightErr)
-		return false, nil
-	}
-
-	if !rightResult && rightErr == nil {
+	if (!leftResult && leftErr == nil) || (!rightResult && rightErr == nil) {
 		logIfEntitlementError(ctx, leftErr)
-		return false, nil
+		logIfEntitlementError(ctx, rightErr)
+		// Report the cheaper of the unsatisfied children, the branch still requires the checks of both.
+		if leftErr != nil {
+			leftDenial = nil
+		}
+		if rightErr != nil {
+			rightDenial = nil
+		}
+		denial := cheaperDenial(leftDenial, rightDenial)
+		if denial != nil {
+			denial.unsatisfied = unsatisfiedChecks(op.LeftOperation, leftResult, leftDenial, leftErr) +
+				unsatisfiedChecks(op.RightOperation, rightResult, rightDenial, rightErr)
+		}
+		return false, denial, nil
 	}
 
-	return false, composeEntitlementEvaluationError(leftErr, rightErr)
+	return false, nil, composeEntitlementEvaluationError(leftErr, rightErr)
 }
 
 // evaluateOrOperation evaluates the results of it's two child operations, ORs them, and
@@ -170,22 +193,24 @@ func (e *Evaluator) evaluateOrOperation(
 	ctx context.Context,
 	op *types.OrOperation,
 	linkedWallets []common.Address,
-) (bool, error) {
+) (bool, *RuleDenial, error) {
 	if op.LeftOperation == nil || op.RightOperation == nil {
-		return false, fmt.Errorf("operation is nil")
+		return false, nil, fmt.Errorf("operation is nil")
 	}
 	leftCtx, leftCancel := context.WithCancel(ctx)
 	rightCtx, rightCancel := context.WithCancel(ctx)
 	leftResult := false
+	leftDenial := (*RuleDenial)(nil)
 	leftErr := error(nil)
 	rightResult := false
+	rightDenial := (*RuleDenial)(nil)
 	rightErr := error(nil)
 	wg := sync.WaitGroup{}
 	wg.Add(2)
 	defer leftCancel()
 	defer rightCancel()
 	go func() {
-		leftResult, leftErr = e.evaluateOp(leftCtx, op.LeftOperation, linkedWallets)
+		leftResult, leftDenial, leftErr = e.evaluateOp(leftCtx, op.LeftOperation, linkedWallets)
 		if leftResult {
 			// cancel the other goroutine if the left result is true, since we know
 			// the user is unentitled
@@ -195,7 +220,7 @@ func (e *Evaluator) evaluateOrOperation(
 	}()
 
 	go func() {
-		rightResult, rightErr = e.evaluateOp(rightCtx, op.RightOperation, linkedWallets)
+		rightResult, rightDenial, rightErr = e.evaluateOp(rightCtx, op.RightOperation, linkedWallets)
 		if rightResult {
 			// cancel the other goroutine if the right result is true, since we know
 			// the user is entitled
@@ -210,38 +235,25 @@ func (e *Evaluator) evaluateOrOperation(
 	if leftResult || rightResult {
 		logIfEntitlementError(ctx, leftErr)
 		logIfEntitlementError(ctx, rightErr)
-		return true, nil
+		return true, nil, nil
 	}
 
 	// Return a false result and handle error values to prioritize error types that come
 	// from entitlement evaluations.
-	return false, composeEntitlementEvaluationError(leftErr, rightErr)
-}
-
-func awaitTimeout(ctx context.Context, f func() error) error {
-	doneCh := make(chan error, 1)
-
-	go func() {
-		doneCh <- f()
-	}()
-
-	select {
-	case <-ctx.Done():
-		// If the context was cancelled or expired, return an error
-		return fmt.Errorf("operation cancelled: %w", ctx.Err())
-	case err := <-doneCh:
-		// If the function finished executing, return its result
-		return err
+	if err := composeEntitlementEvaluationError(leftErr, rightErr); err != nil {
+		return false, nil, err
 	}
+	// Both children are unsatisfied, report the one that is the cheapest to satisfy.
+	return false, cheaperDenial(leftDenial, rightDenial), nil
 }
 
 func (e *Evaluator) evaluateOp(
 	ctx context.Context,
 	op types.Operation,
 	linkedWallets []common.Address,
-) (bool, error) {
+) (bool, *RuleDenial, error) {
 	if op == nil {
-		return false, fmt.Errorf("operation is nil")
+		return false, nil, fmt.Errorf("operation is nil")
 	}
 
 	switch op.GetOpType() {
@@ -261,11 +273,11 @@ func (e *Evaluator) evaluateOp(
 		case types.LogNONE:
 			fallthrough
 		default:
-			return false, fmt.Errorf("invalid LogicalOperation type")
+			return false, nil, fmt.Errorf("invalid LogicalOperation type")
 		}
 	case types.NONE:
 		fallthrough
 	default:
-		return false, fmt.Errorf("invalid Operation type")
+		return false, nil, fmt.Errorf("invalid Operation type")
 	}
 }
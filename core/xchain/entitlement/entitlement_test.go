@@ -503,7 +503,7 @@ func TestAndOperation(t *testing.T) {
 
 			timeoutCtx, cancel := context.WithTimeout(ctx, checkTimeout*time.Millisecond)
 			defer cancel()
-			result, actualErr := evaluator.evaluateOp(timeoutCtx, tree, []common.Address{callerAddress})
+			result, _, actualErr := evaluator.evaluateOp(timeoutCtx, tree, []common.Address{callerAddress})
 			elapsedTime := time.Since(startTime)
 			if tc.expectedErr != nil {
 				require.EqualError(t, actualErr, tc.expectedErr.Error(), "Expected error was not found")
@@ -647,7 +647,7 @@ func TestOrOperation(t *testing.T) {
 
 			timeoutCtx, cancel := context.WithTimeout(ctx, checkTimeout*time.Millisecond)
 			defer cancel()
-			result, actualErr := evaluator.evaluateOp(timeoutCtx, tree, []common.Address{callerAddress})
+			result, _, actualErr := evaluator.evaluateOp(timeoutCtx, tree, []common.Address{callerAddress})
 			elapsedTime := time.Since(startTime)
 			if tc.expectedErr != nil {
 				require.EqualError(t, actualErr, tc.expectedErr.Error(), "Expected error was not found")
@@ -694,7 +694,7 @@ func TestCheckOperation(t *testing.T) {
 	for _, tc := range testCases {
 		startTime := time.Now() // Get the current time
 
-		result, err := evaluator.evaluateOp(ctx, tc.a, tc.wallets)
+		result, _, err := evaluator.evaluateOp(ctx, tc.a, tc.wallets)
 		elapsedTime := time.Since(startTime)
 
 		if err != nil {
@@ -720,6 +720,111 @@ func TestCheckOperation(t *testing.T) {
 	}
 }
 
+func TestRuleDenial(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	and := func(a, b Operation) Operation {
+		return &AndOperation{OpType: LOGICAL, LogicalType: LogicalOperationType(AND), LeftOperation: a, RightOperation: b}
+	}
+	or := func(a, b Operation) Operation {
+		return &OrOperation{OpType: LOGICAL, LogicalType: LogicalOperationType(OR), LeftOperation: a, RightOperation: b}
+	}
+
+	testCases := map[string]struct {
+		op                Operation
+		expectedThreshold *big.Int
+		expectedErr       error
+	}{
+		"satisfied check":          {&fastTrueCheck, nil, nil},
+		"unsatisfied check":        {&fastFalseCheck, big.NewInt(fast), nil},
+		"failed check":             {&fastErrorCheck, nil, errFast},
+		"and with one unsatisfied": {and(&fastTrueCheck, &slowFalseCheck), big.NewInt(slow), nil},
+		"and with error":           {and(&slowErrorCheck, &fastFalseCheck), big.NewInt(fast), nil},
+		"or of unsatisfied checks": {or(&slowFalseCheck, &fastFalseCheck), big.NewInt(slow), nil},
+		"satisfied or":             {or(&slowFalseCheck, &fastTrueCheck), nil, nil},
+		// The and branch requires both of its checks, the cancelled one is not known to be satisfied.
+		"cheapest branch of or": {
+			or(and(&fastFalseCheck, &slowTrueCheck), &slowFalseCheck),
+			big.NewInt(slow),
+			nil,
+		},
+		"cheapest branch of nested or": {
+			or(and(&fastFalseCheck, &slowTrueCheck), or(&slowFalseCheck, &fastFalseCheck)),
+			big.NewInt(slow),
+			nil,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			result, denial, err := evaluator.evaluateOp(ctx, tc.op, []common.Address{{}})
+			if tc.expectedErr != nil {
+				require.EqualError(t, err, tc.expectedErr.Error())
+			} else {
+				require.NoError(t, err)
+			}
+			if tc.expectedThreshold == nil {
+				require.Nil(t, denial)
+				return
+			}
+			require.False(t, result)
+			require.NotNil(t, denial)
+			require.Equal(t, CheckOperationType(MOCK), denial.CheckType)
+			require.Equal(t, tc.expectedThreshold, denial.Threshold)
+			require.Nil(t, denial.Balance)
+			require.Equal(
+				t,
+				[]any{
+					"ruleCheckType", "MOCK",
+					"ruleChainId", big.NewInt(0),
+					"ruleContractAddress", common.Address{},
+					"ruleThreshold", tc.expectedThreshold,
+				},
+				denial.Params(),
+			)
+		})
+	}
+}
+
+func TestExplainRuleData(t *testing.T) {
+	ctx, cancel := test.NewTestContext()
+	defer cancel()
+
+	// All checks are evaluated, and the errors of checks don't fail the evaluation.
+	op := &OrOperation{
+		OpType:      LOGICAL,
+		LogicalType: LogicalOperationType(OR),
+		LeftOperation: &AndOperation{
+			OpType:         LOGICAL,
+			LogicalType:    LogicalOperationType(AND),
+			LeftOperation:  &fastFalseCheck,
+			RightOperation: &slowTrueCheck,
+		},
+		RightOperation: &fastErrorCheck,
+	}
+	trace := evaluator.explainOp(ctx, op, []common.Address{{}})
+	require.Equal(t, "OR", trace.Operation)
+	require.False(t, trace.Satisfied)
+	require.Len(t, trace.Children, 2)
+
+	and := trace.Children[0]
+	require.Equal(t, "AND", and.Operation)
+	require.False(t, and.Satisfied)
+	require.Len(t, and.Children, 2)
+	require.Equal(t, "MOCK", and.Children[0].Operation)
+	require.False(t, and.Children[0].Satisfied)
+	require.Equal(t, big.NewInt(fast), and.Children[0].Denial.Threshold)
+	require.True(t, and.Children[1].Satisfied)
+	require.Nil(t, and.Children[1].Denial)
+
+	failed := trace.Children[1]
+	require.False(t, failed.Satisfied)
+	require.Equal(t, errFast.Error(), failed.Error)
+	require.Equal(t, common.HexToAddress("1"), *failed.ContractAddress)
+	require.Equal(t, big.NewInt(1), failed.ChainId)
+}
+
 // Disable this test case, which is relying on a public rpc endpoint.
 func TestCheckOperation_Untimed(t *testing.T) {
 	t.Skip("Skipping due to dependency on outbound network calls")
@@ -1062,7 +1167,7 @@ func TestCheckOperation_Untimed(t *testing.T) {
 		t.Run(name, func(t *testing.T) {
 			ctx, cancel := test.NewTestContext()
 			defer cancel()
-			result, err := evaluator.evaluateOp(ctx, tc.op, tc.wallets)
+			result, _, err := evaluator.evaluateOp(ctx, tc.op, tc.wallets)
 			if tc.expectedErr == nil {
 				require.NoError(t, err)
 			} else {
@@ -1130,7 +1235,7 @@ func Test_evaluateEthBalance_withConfig(t *testing.T) {
 			)
 			require.NoError(err)
 
-			result, err := customEvaluator.evaluateOp(ctx, tc.op, tc.wallets)
+			result, _, err := customEvaluator.evaluateOp(ctx, tc.op, tc.wallets)
 			if tc.expectedErr == nil {
 				require.NoError(err)
 			} else {
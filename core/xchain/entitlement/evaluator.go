@@ -16,6 +16,8 @@ import (
 type Evaluator struct {
 	clients        BlockchainClientPool
 	evalHistrogram *prometheus.HistogramVec
+	// chainIds are the chains configured for cross-chain entitlements.
+	chainIds []uint64
 	// etherNativeChainIds includes any chain that uses ethereum as a native currency.
 	etherNativeChainIds []uint64
 	// ethereumNetworkIds refers to the list of actual ethereum mainnet and testnets
@@ -63,7 +65,8 @@ func NewEvaluatorFromConfigWithBlockchainInfo(
 		return nil, err
 	}
 	evaluator := Evaluator{
-		clients: clients,
+		clients:  clients,
+		chainIds: onChainCfg.Get().XChain.Blockchains,
 		evalHistrogram: metrics.NewHistogramVecEx(
 			"entitlement_op_duration_seconds",
 			"Duration of entitlement evaluation",
@@ -90,3 +93,8 @@ func NewEvaluatorFromConfigWithBlockchainInfo(
 func (e *Evaluator) GetClient(chainId uint64) (crypto.BlockchainClient, error) {
 	return e.clients.Get(chainId)
 }
+
+// ChainIds returns the chains configured for cross-chain entitlements, including chains without a client.
+func (e *Evaluator) ChainIds() []uint64 {
+	return e.chainIds
+}
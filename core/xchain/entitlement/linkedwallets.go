@@ -2,6 +2,7 @@ package entitlement
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"slices"
 
@@ -19,9 +20,21 @@ var (
 	DelegationType_ALL      = uint8(1)
 )
 
+// ErrTooManyLinkedWallets is returned by the linked wallet lookups when a wallet is linked to more wallets than
+// the maximum of the lookup. The lookup stops as soon as the maximum is exceeded, without reading the
+// delegators of the wallets.
+var ErrTooManyLinkedWallets = errors.New("too many linked wallets")
+
+// getLinkedWallets returns the wallets linked to wallet in the wallet link contract, including the root key.
+// It fails with ErrTooManyLinkedWallets if there are more than maxWallets, 0 means no maximum.
+//
+// The lookup makes a single hop: it reads the root key of wallet and the wallets linked to that root key, the
+// links of the returned wallets are not followed. Cycles in the links, such as a wallet linked to itself or a
+// root key linked to one of its wallets, can't make it loop, it always makes two contract calls.
 func getLinkedWallets(
 	ctx context.Context,
 	wallet common.Address,
+	maxWallets int,
 	walletLink *base.WalletLink,
 	callDurations *prometheus.HistogramVec,
 	getRootKeyForWalletCalls *infra.StatusCounterVec,
@@ -79,12 +92,14 @@ func getLinkedWallets(
 
 	// Make sure the root wallet is included in the returned list of linked wallets. This will not
 	// be the case when the wallet passed to the check is the root wallet.
-	containsRootWallet := false
-	for _, w := range wallets {
-		if w == rootKey {
-			containsRootWallet = true
-			break
-		}
+	containsRootWallet := slices.Contains(wallets, rootKey)
+	count := len(wallets)
+	if !containsRootWallet {
+		count++
+	}
+	if maxWallets > 0 && count > maxWallets {
+		log.Warnw("Too many linked wallets", "rootKey", rootKey.Hex(), "wallets", count, "maxWallets", maxWallets)
+		return nil, ErrTooManyLinkedWallets
 	}
 	if !containsRootWallet {
 		wallets = append(wallets, rootKey)
@@ -95,15 +110,44 @@ func getLinkedWallets(
 	return wallets, nil
 }
 
+// GetBaseChainLinkedWallets returns the wallets linked to the wallet in the wallet link contract like
+// Evaluator.GetLinkedWallets does, without the wallets that delegated to them on Ethereum mainnet.
+func GetBaseChainLinkedWallets(
+	ctx context.Context,
+	wallet common.Address,
+	maxWallets int,
+	walletLink *base.WalletLink,
+	callDurations *prometheus.HistogramVec,
+	getRootKeyForWalletCalls *infra.StatusCounterVec,
+	getWalletsByRootKeyCalls *infra.StatusCounterVec,
+) ([]common.Address, error) {
+	return getLinkedWallets(
+		ctx,
+		wallet,
+		maxWallets,
+		walletLink,
+		callDurations,
+		getRootKeyForWalletCalls,
+		getWalletsByRootKeyCalls,
+	)
+}
+
 // getMainnetDelegators returns the list of wallets that delegated ALL to the list
 // of wallets passed into the functions, using the v1 deligation registry of delegate.xyz.
 // To compute the total list of linked wallets and mainnet delegators, the caller must
-// combine the returned result with the original list of linked wallets.
+// combine the returned result with the original list of linked wallets. Delegators that
+// are in the list of wallets are not returned. It fails with ErrTooManyLinkedWallets once
+// the wallets and their delegators exceed maxWallets, 0 means no maximum. The delegators
+// of the delegators are not looked up.
 func (e *Evaluator) getMainnetDelegators(
 	ctx context.Context,
 	wallets []common.Address,
+	maxWallets int,
 ) (delegators []common.Address, err error) {
 	uniqueDelegatorWallets := map[string]struct{}{}
+	for _, wallet := range wallets {
+		uniqueDelegatorWallets[wallet.Hex()] = struct{}{}
+	}
 	log := logging.FromCtx(ctx)
 	for _, chainId := range e.ethereumNetworkIds {
 		log.Debugw("Fetching delegate.xyz V1 delegators for wallets", "chainID", chainId, "wallets", wallets)
@@ -134,6 +178,9 @@ func (e *Evaluator) getMainnetDelegators(
 					if _, ok := uniqueDelegatorWallets[walletString]; !ok {
 						delegators = append(delegators, info.Vault)
 						uniqueDelegatorWallets[walletString] = struct{}{}
+						if maxWallets > 0 && len(wallets)+len(delegators) > maxWallets {
+							return nil, ErrTooManyLinkedWallets
+						}
 					}
 				}
 			}
@@ -142,9 +189,13 @@ func (e *Evaluator) getMainnetDelegators(
 	return delegators, nil
 }
 
+// GetLinkedWallets returns the wallets linked to wallet in the wallet link contract, including the root key,
+// and the wallets that delegated to them on Ethereum mainnet. It fails with ErrTooManyLinkedWallets if there
+// are more than maxWallets, 0 means no maximum.
 func (e *Evaluator) GetLinkedWallets(
 	ctx context.Context,
 	wallet common.Address,
+	maxWallets int,
 	walletLink *base.WalletLink,
 	callDurations *prometheus.HistogramVec,
 	getRootKeyForWalletCalls *infra.StatusCounterVec,
@@ -153,11 +204,15 @@ func (e *Evaluator) GetLinkedWallets(
 	wallets, err := getLinkedWallets(
 		ctx,
 		wallet,
+		maxWallets,
 		walletLink,
 		callDurations,
 		getRootKeyForWalletCalls,
 		getWalletsByRootKeyCalls,
 	)
+	if errors.Is(err, ErrTooManyLinkedWallets) {
+		return nil, err
+	}
 	// Attempt to parse any contract errors
 	if err != nil {
 		ce, se, err := e.decoder.DecodeEVMError(err)
@@ -169,7 +224,7 @@ func (e *Evaluator) GetLinkedWallets(
 		return nil, err
 	}
 
-	delegators, err := e.getMainnetDelegators(ctx, wallets)
+	delegators, err := e.getMainnetDelegators(ctx, wallets, maxWallets)
 	if err != nil {
 		return nil, err
 	}
@@ -177,15 +232,6 @@ func (e *Evaluator) GetLinkedWallets(
 	logging.FromCtx(ctx).
 		Debugw("Found the following delegators for linked wallets", "linkedWallets", wallet, "delegators", delegators)
 
-	// Append delegator wallets to the list
-	for _, delegator := range delegators {
-		// Ensure no duplicate wallets
-		if !slices.ContainsFunc(wallets, func(wallet common.Address) bool {
-			return wallet.Cmp(delegator) == 0
-		}) {
-			wallets = append(wallets, delegator)
-		}
-	}
-
-	return wallets, nil
+	// Append delegator wallets to the list, they don't include the linked wallets.
+	return append(wallets, delegators...), nil
 }
@@ -79,6 +79,7 @@ func TestFetchDelegateWallets(t *testing.T) {
 	linkedWallets, err := evaluator.GetLinkedWallets(
 		ctx,
 		root.Address,
+		0,
 		walletLink,
 		nil,
 		nil,
@@ -111,6 +112,7 @@ func TestFetchDelegateWallets(t *testing.T) {
 	linkedWallets, err = evaluator.GetLinkedWallets(
 		ctx,
 		root.Address,
+		0,
 		walletLink,
 		nil,
 		nil,
@@ -0,0 +1,102 @@
+package entitlement
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/towns-protocol/towns/core/contracts/types"
+)
+
+// RuleDenial describes the check operation a rule was not satisfied by, so that clients can tell the user
+// what they're missing, e.g. "requires 10 TOWNS on Base". For rules combining several checks it is the
+// unsatisfied check of the branch of the rule that is the cheapest to satisfy, see EvaluateRuleDataWithDenial.
+type RuleDenial struct {
+	CheckType       types.CheckOperationType
+	ChainId         *big.Int
+	ContractAddress common.Address
+	// Threshold is the balance the check requires, nil for checks without a threshold.
+	Threshold *big.Int
+	// TokenId is the token of ERC1155 checks, nil for other checks.
+	TokenId *big.Int
+	// Balance is the total balance of the evaluated wallets, nil if the check doesn't observe a balance.
+	Balance *big.Int
+
+	// unsatisfied is the number of checks of the branch the denial was reported for that are not known to
+	// be satisfied.
+	unsatisfied int
+}
+
+// Params returns the parameters of the denial as key-value pairs, e.g. to tag errors with them. It returns
+// nil if d is nil.
+func (d *RuleDenial) Params() []any {
+	if d == nil {
+		return nil
+	}
+	params := []any{
+		"ruleCheckType", d.CheckType.String(),
+		"ruleChainId", d.ChainId,
+		"ruleContractAddress", d.ContractAddress,
+	}
+	if d.Threshold != nil {
+		params = append(params, "ruleThreshold", d.Threshold)
+	}
+	if d.TokenId != nil {
+		params = append(params, "ruleTokenId", d.TokenId)
+	}
+	if d.Balance != nil {
+		params = append(params, "ruleBalance", d.Balance)
+	}
+	return params
+}
+
+func newRuleDenial(op *types.CheckOperation, threshold *big.Int, tokenId *big.Int, balance *big.Int) *RuleDenial {
+	return &RuleDenial{
+		CheckType:       op.CheckType,
+		ChainId:         op.ChainID,
+		ContractAddress: op.ContractAddress,
+		Threshold:       threshold,
+		TokenId:         tokenId,
+		Balance:         balance,
+		unsatisfied:     1,
+	}
+}
+
+// cheaperDenial returns the denial of the branch with the fewest unsatisfied checks, left on ties.
+func cheaperDenial(left *RuleDenial, right *RuleDenial) *RuleDenial {
+	if left == nil {
+		return right
+	}
+	if right == nil || left.unsatisfied <= right.unsatisfied {
+		return left
+	}
+	return right
+}
+
+// unsatisfiedChecks returns the number of checks of a child operation of a denied AND operation that
+// are not known to be satisfied: none if the child was satisfied, the checks of its denial if it was
+// denied, and all of its checks if its evaluation failed or was cancelled.
+func unsatisfiedChecks(op types.Operation, result bool, denial *RuleDenial, err error) int {
+	switch {
+	case result:
+		return 0
+	case err == nil && denial != nil:
+		return denial.unsatisfied
+	default:
+		return countChecks(op)
+	}
+}
+
+// countChecks returns the number of check operations of the operation tree.
+func countChecks(op types.Operation) int {
+	switch op := op.(type) {
+	case *types.AndOperation:
+		return countChecks(op.LeftOperation) + countChecks(op.RightOperation)
+	case *types.OrOperation:
+		return countChecks(op.LeftOperation) + countChecks(op.RightOperation)
+	case *types.CheckOperation:
+		return 1
+	default:
+		return 0
+	}
+}
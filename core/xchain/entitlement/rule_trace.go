@@ -0,0 +1,87 @@
+package entitlement
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+
+	"github.com/towns-protocol/towns/core/contracts/base"
+	"github.com/towns-protocol/towns/core/contracts/types"
+)
+
+// RuleTrace is the outcome of an operation of a rule and of its child operations, see ExplainRuleData.
+type RuleTrace struct {
+	// Operation is AND or OR for logical operations, the check type for check operations.
+	Operation string `json:"operation"`
+	Satisfied bool   `json:"satisfied"`
+	// ChainId and ContractAddress are the chain and the contract of check operations.
+	ChainId         *big.Int        `json:"chainId,omitempty"`
+	ContractAddress *common.Address `json:"contractAddress,omitempty"`
+	// Denial is what the wallets miss to satisfy an unsatisfied check operation.
+	Denial *RuleDenial `json:"denial,omitempty"`
+	// Error is the error evaluating the operation, which is then not satisfied.
+	Error    string       `json:"error,omitempty"`
+	Children []*RuleTrace `json:"children,omitempty"`
+}
+
+// ExplainRuleData evaluates the rule against the wallets and returns the outcome of each of its operations.
+// Unlike EvaluateRuleData it doesn't short-circuit, all the checks of the rule are evaluated, and the errors
+// of checks are reported in the trace instead of failing the evaluation. It fails if the rule can't be decoded.
+func (e *Evaluator) ExplainRuleData(
+	ctx context.Context,
+	linkedWallets []common.Address,
+	ruleData *base.IRuleEntitlementBaseRuleDataV2,
+) (*RuleTrace, error) {
+	opTree, err := types.GetOperationTree(ctx, ruleData)
+	if err != nil {
+		return nil, err
+	}
+	return e.explainOp(ctx, opTree, linkedWallets), nil
+}
+
+func (e *Evaluator) explainOp(
+	ctx context.Context,
+	op types.Operation,
+	linkedWallets []common.Address,
+) *RuleTrace {
+	switch op := op.(type) {
+	case *types.CheckOperation:
+		contractAddress := op.ContractAddress
+		trace := &RuleTrace{
+			Operation:       op.CheckType.String(),
+			ChainId:         op.ChainID,
+			ContractAddress: &contractAddress,
+		}
+		satisfied, denial, err := e.evaluateCheckOperation(ctx, op, linkedWallets)
+		if err != nil {
+			trace.Error = err.Error()
+			return trace
+		}
+		trace.Satisfied = satisfied
+		if !satisfied {
+			trace.Denial = denial
+		}
+		return trace
+	case *types.AndOperation:
+		left := e.explainOp(ctx, op.LeftOperation, linkedWallets)
+		right := e.explainOp(ctx, op.RightOperation, linkedWallets)
+		return &RuleTrace{
+			Operation: "AND",
+			Satisfied: left.Satisfied && right.Satisfied,
+			Children:  []*RuleTrace{left, right},
+		}
+	case *types.OrOperation:
+		left := e.explainOp(ctx, op.LeftOperation, linkedWallets)
+		right := e.explainOp(ctx, op.RightOperation, linkedWallets)
+		return &RuleTrace{
+			Operation: "OR",
+			Satisfied: left.Satisfied || right.Satisfied,
+			Children:  []*RuleTrace{left, right},
+		}
+	case nil:
+		return &RuleTrace{Operation: "NONE", Error: "operation is nil"}
+	default:
+		return &RuleTrace{Operation: "NONE", Error: "invalid Operation type"}
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/towns-protocol/towns/core/config"
 	"github.com/towns-protocol/towns/core/contracts/base"
+	"github.com/towns-protocol/towns/core/node/auth"
 	. "github.com/towns-protocol/towns/core/node/protocol"
 	"github.com/towns-protocol/towns/core/node/registries"
 	"github.com/towns-protocol/towns/core/xchain/contracts"
@@ -42,6 +43,7 @@ type (
 		config              *config.Config
 		cancel              context.CancelFunc
 		evaluator           *entitlement.Evaluator
+		walletResolver      *auth.WalletResolver
 
 		riverChain       *crypto.Blockchain
 		registryContract *registries.RiverRegistryContract
@@ -251,6 +253,16 @@ func New(
 		),
 	}
 
+	walletLink, err := base.NewWalletLink(cfg.GetWalletLinkContractAddress(), baseChain.Client)
+	if err != nil {
+		return nil, err
+	}
+	x.walletResolver = auth.NewWalletResolver(evaluator, walletLink, auth.WalletResolverMetrics{
+		CallDurations:            x.callDurations,
+		GetRootKeyForWalletCalls: x.getRootKeyForWalletCalls,
+		GetWalletsByRootKeyCalls: x.getWalletsByRootKeyCalls,
+	})
+
 	// If extrernal metrics registry is provided, caller is publishing metrics.
 	// Otherwies, if publishing is enabled, publish here.
 	if metricsRegistry == nil && x.config.Metrics.Enabled && x.config.Metrics.Port > 0 {
@@ -660,22 +672,7 @@ func (x *xchain) getLinkedWallets(ctx context.Context, wallet common.Address) ([
 		"walletLinkContract",
 		x.config.GetWalletLinkContractAddress(),
 	)
-	iWalletLink, err := base.NewWalletLink(
-		x.config.GetWalletLinkContractAddress(),
-		x.baseChain.Client,
-	)
-	if err != nil {
-		return nil, x.handleContractError(log, err, "Failed to create IWalletLink")
-	}
-
-	wallets, err := x.evaluator.GetLinkedWallets(
-		ctx,
-		wallet,
-		iWalletLink,
-		x.callDurations,
-		x.getRootKeyForWalletCalls,
-		x.getWalletsByRootKeyCalls,
-	)
+	wallets, err := x.walletResolver.LinkedWallets(ctx, wallet, 0)
 	if err != nil {
 		log.Errorw(
 			"Failed to get linked wallets",